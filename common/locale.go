@@ -0,0 +1,221 @@
+package common
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Locale tells how numbers and dates are written in a file: the decimal and
+// thousands separators and whether dates put the day first. The zero Locale
+// is auto: every common convention is accepted.
+type Locale struct {
+	Name      string
+	Decimal   rune // 0 for auto
+	Thousands rune
+	DayFirst  bool
+}
+
+// Locales lists the locales -locale accepts
+var Locales = map[string]Locale{
+	"en": {Name: "en", Decimal: '.', Thousands: ','},
+	"us": {Name: "us", Decimal: '.', Thousands: ','},
+	"uk": {Name: "uk", Decimal: '.', Thousands: ',', DayFirst: true},
+	"de": {Name: "de", Decimal: ',', Thousands: '.', DayFirst: true},
+	"nl": {Name: "nl", Decimal: ',', Thousands: '.', DayFirst: true},
+	"it": {Name: "it", Decimal: ',', Thousands: '.', DayFirst: true},
+	"es": {Name: "es", Decimal: ',', Thousands: '.', DayFirst: true},
+	"pt": {Name: "pt", Decimal: ',', Thousands: '.', DayFirst: true},
+	"fr": {Name: "fr", Decimal: ',', Thousands: ' ', DayFirst: true},
+	"ch": {Name: "ch", Decimal: '.', Thousands: '\'', DayFirst: true},
+}
+
+// ParseLocale returns the locale with the given name; "" and "auto" give the
+// auto locale
+func ParseLocale(name string) (Locale, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" || name == "auto" {
+		return Locale{}, nil
+	}
+	if locale, ok := Locales[name]; ok {
+		return locale, nil
+	}
+	names := make([]string, 0, len(Locales))
+	for name := range Locales {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return Locale{}, fmt.Errorf("unknown locale '%s' (use auto, %s)", name, strings.Join(names, ", "))
+}
+
+// autoSeparators are the conventions tried for numbers in the auto locale,
+// in order: 1,234.56 then 1.234,56 then 1 234,56 then 1'234.56
+var autoSeparators = [][2]rune{{'.', ','}, {',', '.'}, {',', ' '}, {'.', '\''}}
+
+// ParseNumber reads a number written with the locale's separators, such as
+// "1.234,56" in German files, or in accounting style as "(1,234.00)" for a
+// negative. Plain numbers like "1234.5" are accepted in every locale.
+func ParseNumber(value string, locale Locale) (float64, bool) {
+	value = strings.TrimSpace(value)
+	if inner, ok := strings.CutPrefix(value, "("); ok {
+		if inner, ok = strings.CutSuffix(inner, ")"); ok {
+			number, ok := ParseNumber(inner, locale)
+			return -number, ok
+		}
+	}
+
+	if locale.Decimal != 0 {
+		if number, ok := parseSeparated(value, locale.Decimal, locale.Thousands); ok {
+			return number, true
+		}
+	}
+	if number, err := strconv.ParseFloat(value, 64); err == nil {
+		return number, true
+	}
+	if locale.Decimal != 0 {
+		return 0, false
+	}
+	for _, separators := range autoSeparators {
+		if number, ok := parseSeparated(value, separators[0], separators[1]); ok {
+			return number, true
+		}
+	}
+	return 0, false
+}
+
+// parseSeparated reads a number with the given decimal separator and
+// thousands separators between groups of three digits
+func parseSeparated(value string, decimal, thousands rune) (float64, bool) {
+	sign := ""
+	if len(value) > 0 && (value[0] == '-' || value[0] == '+') {
+		sign, value = value[:1], value[1:]
+	}
+	integer, fraction, hasFraction := strings.Cut(value, string(decimal))
+	if hasFraction && (fraction == "" || !allDigits(fraction)) {
+		return 0, false
+	}
+
+	// Spaces in numbers are often non-breaking, and apostrophes typographic
+	integer = strings.NewReplacer("\u00a0", " ", "\u202f", " ", "\u2019", "'").Replace(integer)
+	groups := strings.Split(integer, string(thousands))
+	for i, group := range groups {
+		if !allDigits(group) || (i > 0 && len(group) != 3) || (i == 0 && len(groups) > 1 && len(group) > 3) {
+			return 0, false
+		}
+	}
+
+	digits := sign + strings.Join(groups, "")
+	if hasFraction {
+		digits += "." + fraction
+	}
+	number, err := strconv.ParseFloat(digits, 64)
+	return number, err == nil
+}
+
+// allDigits reports whether s is a non-empty run of ASCII digits
+func allDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// currencySymbols are the symbols and codes recognized around currency
+// amounts, longest first so "US$" is not read as "$"
+var currencySymbols = []string{"US$", "R$", "CHF", "USD", "EUR", "GBP", "JPY", "CAD", "AUD", "INR", "SEK", "NOK", "DKK", "kr", "$", "€", "£", "¥", "₹", "₩"}
+
+// ParseCurrency reads an amount with a currency symbol or code before or
+// after it, such as "$1,234.50", "-€5" or "1.234,56 €"
+func ParseCurrency(value string, locale Locale) (float64, bool) {
+	value = strings.TrimSpace(value)
+	negative := false
+	if inner, ok := strings.CutPrefix(value, "("); ok {
+		if inner, ok = strings.CutSuffix(inner, ")"); ok {
+			value, negative = strings.TrimSpace(inner), true
+		}
+	}
+	if rest, ok := strings.CutPrefix(value, "-"); ok && !negative {
+		value, negative = strings.TrimSpace(rest), true
+	}
+
+	for _, symbol := range currencySymbols {
+		amount, ok := strings.CutPrefix(value, symbol)
+		if !ok {
+			amount, ok = strings.CutSuffix(value, symbol)
+		}
+		if !ok {
+			continue
+		}
+		number, ok := ParseNumber(amount, locale)
+		if !ok {
+			return 0, false
+		}
+		if negative {
+			number = -number
+		}
+		return number, true
+	}
+	return 0, false
+}
+
+// ParsePercentage reads a percentage such as "12.5%" or "12,5 %" as a
+// fraction (0.125)
+func ParsePercentage(value string, locale Locale) (float64, bool) {
+	number, ok := strings.CutSuffix(strings.TrimSpace(value), "%")
+	if !ok {
+		return 0, false
+	}
+	fraction, ok := ParseNumber(number, locale)
+	return fraction / 100, ok
+}
+
+// Date layouts by convention. Go layouts with single-digit fields also
+// accept two digits, so 2/1/2006 matches 02/01/2006.
+var (
+	isoDateLayouts = []string{
+		"2006-01-02", "2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02T15:04:05",
+		"2006/01/02", "2006/01/02 15:04:05", "2006.01.02",
+		"Jan 2, 2006", "January 2, 2006", "2 Jan 2006", "2 January 2006", "02-Jan-2006",
+	}
+	dayFirstLayouts = []string{
+		"2/1/2006", "2.1.2006", "2-1-2006", "2/1/06", "2.1.06",
+		"2/1/2006 15:04", "2/1/2006 15:04:05", "2.1.2006 15:04", "2.1.2006 15:04:05",
+	}
+	monthFirstLayouts = []string{
+		"1/2/2006", "1-2-2006", "1/2/06", "1-2-06",
+		"1/2/2006 15:04", "1/2/2006 15:04:05", "1/2/2006 3:04 PM",
+	}
+)
+
+// ParseDate reads a date or date and time. Day-first locales read 03/04/2024
+// as 3 April, others as March 4; the auto locale tries month first, then day
+// first, so 31/12/2024 is a date too.
+func ParseDate(value string, locale Locale) (time.Time, bool) {
+	value = strings.TrimSpace(value)
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, true
+	}
+	layouts := [][]string{isoDateLayouts, monthFirstLayouts, dayFirstLayouts}
+	switch {
+	case locale.Decimal == 0:
+	case locale.DayFirst:
+		layouts = [][]string{isoDateLayouts, dayFirstLayouts}
+	default:
+		layouts = [][]string{isoDateLayouts, monthFirstLayouts, {"2.1.2006", "2.1.2006 15:04"}}
+	}
+	for _, group := range layouts {
+		for _, layout := range group {
+			if t, err := time.Parse(layout, value); err == nil {
+				return t, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
@@ -6,37 +6,40 @@ import "time"
 type DataType string
 
 const (
-	TypeString  DataType = "string"
-	TypeNumber  DataType = "number"
-	TypeDate    DataType = "date"
-	TypeBoolean DataType = "boolean"
-	TypeMixed   DataType = "mixed"
-	TypeEmpty   DataType = "empty"
+	TypeString     DataType = "string"
+	TypeNumber     DataType = "number"
+	TypeCurrency   DataType = "currency"   // numbers, mostly with a currency symbol
+	TypePercentage DataType = "percentage" // numbers, mostly with a % sign
+	TypeDate       DataType = "date"
+	TypeBoolean    DataType = "boolean"
+	TypeMixed      DataType = "mixed"
+	TypeEmpty      DataType = "empty"
 )
 
 // ColumnInfo contains metadata about a column
 type ColumnInfo struct {
-	Index        int
-	Name         string
-	DataType     DataType
-	UniqueCount  int
-	NullCount    int
-	TotalCount   int
-	SampleValues []string // First few unique values
+	Index        int      `json:"index"`
+	Name         string   `json:"name"`
+	DataType     DataType `json:"type"`
+	UniqueCount  int      `json:"unique_count"`
+	NullCount    int      `json:"null_count"`
+	TotalCount   int      `json:"total_count"`
+	SampleValues []string `json:"sample_values"` // First few unique values
 }
 
 // DataPreview represents the data structure for displaying file contents
 type DataPreview struct {
-	FileName     string
-	FileType     string
-	SheetInfo    string // For Excel files
-	TotalRows    int
-	TotalColumns int
-	RowsDisplayed int
-	SampleType   string // "first", "random"
-	Columns      []ColumnInfo
-	Headers      []string
-	Rows         [][]string
+	FileName      string       `json:"file"`
+	FileType      string       `json:"type"`
+	SheetInfo     string       `json:"sheet_info,omitempty"` // For Excel files
+	TotalRows     int          `json:"total_rows"`
+	TotalColumns  int          `json:"total_columns"`
+	RowsDisplayed int          `json:"rows_displayed"`
+	SampleType    string       `json:"sample_type"`   // "first", "random"
+	AnalyzedRows  int          `json:"analyzed_rows"` // rows of a sampled column analysis, 0 when every row was analyzed
+	Columns       []ColumnInfo `json:"columns"`
+	Headers       []string     `json:"headers"`
+	Rows          [][]string   `json:"rows"`
 }
 
 // ParsedDate represents a parsed date value
@@ -2,61 +2,82 @@ package common
 
 import (
 	"fmt"
+	"html"
 	"math"
 	"math/rand"
 	"regexp"
-	"strconv"
 	"strings"
 	"time"
 )
 
 // DetectDataType analyzes a slice of values and determines the column type
 func DetectDataType(values []string) DataType {
-	if len(values) == 0 {
-		return TypeEmpty
+	var counter TypeCounter
+	for _, val := range values {
+		counter.Add(val)
 	}
+	return counter.Type()
+}
 
-	var (
-		stringCount  int
-		numberCount  int
-		dateCount    int
-		booleanCount int
-		emptyCount   int
-	)
-
-	for _, val := range values {
-		trimmed := strings.TrimSpace(val)
+// TypeCounter detects the type of a column one value at a time, for columns
+// too large to hold in memory. Numbers and dates are read in its Locale.
+type TypeCounter struct {
+	Locale Locale
+
+	stringCount     int
+	numberCount     int
+	currencyCount   int
+	percentageCount int
+	dateCount       int
+	booleanCount    int
+	emptyCount      int
+}
 
-		// Check for empty
-		if trimmed == "" {
-			emptyCount++
-			continue
-		}
+// Add counts a value towards the column type
+func (c *TypeCounter) Add(val string) {
+	trimmed := strings.TrimSpace(val)
 
-		// Check for boolean
-		lower := strings.ToLower(trimmed)
-		if lower == "true" || lower == "false" || lower == "yes" || lower == "no" || lower == "1" || lower == "0" {
-			booleanCount++
-			continue
-		}
+	// Check for empty
+	if trimmed == "" {
+		c.emptyCount++
+		return
+	}
 
-		// Check for number
-		if _, err := strconv.ParseFloat(trimmed, 64); err == nil {
-			numberCount++
-			continue
-		}
+	// Check for boolean
+	lower := strings.ToLower(trimmed)
+	if lower == "true" || lower == "false" || lower == "yes" || lower == "no" || lower == "1" || lower == "0" {
+		c.booleanCount++
+		return
+	}
 
-		// Check for date (various formats)
-		if IsDateValue(trimmed) {
-			dateCount++
-			continue
-		}
+	// Check for number, with the separators of the locale
+	if _, ok := ParseNumber(trimmed, c.Locale); ok {
+		c.numberCount++
+		return
+	}
+	if _, ok := ParsePercentage(trimmed, c.Locale); ok {
+		c.percentageCount++
+		return
+	}
+	if _, ok := ParseCurrency(trimmed, c.Locale); ok {
+		c.currencyCount++
+		return
+	}
 
-		// Default to string
-		stringCount++
+	// Check for date (various formats)
+	if _, ok := ParseDate(trimmed, c.Locale); ok || (c.Locale.Decimal == 0 && IsDateValue(trimmed)) {
+		c.dateCount++
+		return
 	}
 
-	total := len(values) - emptyCount
+	// Default to string
+	c.stringCount++
+}
+
+// Type returns the type of the values added so far
+func (c *TypeCounter) Type() DataType {
+	numeric := c.numberCount + c.currencyCount + c.percentageCount
+	total := c.stringCount + numeric + c.dateCount + c.booleanCount
 	if total == 0 {
 		return TypeEmpty
 	}
@@ -64,16 +85,23 @@ func DetectDataType(values []string) DataType {
 	// Determine primary type (>80% threshold)
 	threshold := float64(total) * 0.8
 
-	if float64(numberCount) >= threshold {
+	// Amounts and percentages may have some values without their symbol
+	if float64(numeric) >= threshold {
+		switch {
+		case c.currencyCount*2 > numeric:
+			return TypeCurrency
+		case c.percentageCount*2 > numeric:
+			return TypePercentage
+		}
 		return TypeNumber
 	}
-	if float64(dateCount) >= threshold {
+	if float64(c.dateCount) >= threshold {
 		return TypeDate
 	}
-	if float64(booleanCount) >= threshold {
+	if float64(c.booleanCount) >= threshold {
 		return TypeBoolean
 	}
-	if float64(stringCount) >= threshold {
+	if float64(c.stringCount) >= threshold {
 		return TypeString
 	}
 
@@ -82,25 +110,9 @@ func DetectDataType(values []string) DataType {
 
 // IsDateValue checks if a string looks like a date
 func IsDateValue(val string) bool {
-	// Common date formats to try
-	formats := []string{
-		"2006-01-02",
-		"2006/01/02",
-		"01/02/2006",
-		"02/01/2006",
-		"Jan 2, 2006",
-		"2 Jan 2006",
-		"2006-01-02 15:04:05",
-		"2006/01/02 15:04:05",
-		"01-02-2006",
-		"02-01-2006",
-	}
-
 	trimmed := strings.TrimSpace(val)
-	for _, format := range formats {
-		if _, err := time.Parse(format, trimmed); err == nil {
-			return true
-		}
+	if _, ok := ParseDate(trimmed, Locale{}); ok {
+		return true
 	}
 
 	// Check for ISO 8601 format
@@ -138,14 +150,32 @@ func GetUniqueValues(values []string) []string {
 func CountNulls(values []string) int {
 	count := 0
 	for _, val := range values {
-		trimmed := strings.TrimSpace(val)
-		if trimmed == "" || strings.ToLower(trimmed) == "null" || strings.ToLower(trimmed) == "nil" {
+		if IsNull(val) {
 			count++
 		}
 	}
 	return count
 }
 
+// nullTokens are the values read as missing besides empty, null and nil,
+// lowercased; see SetNullTokens
+var nullTokens map[string]bool
+
+// SetNullTokens makes more values count as null, e.g. "n/a" or "-". Case and
+// surrounding whitespace are ignored.
+func SetNullTokens(tokens []string) {
+	nullTokens = make(map[string]bool, len(tokens))
+	for _, token := range tokens {
+		nullTokens[strings.ToLower(strings.TrimSpace(token))] = true
+	}
+}
+
+// IsNull reports whether a value is empty or null
+func IsNull(val string) bool {
+	trimmed := strings.TrimSpace(val)
+	return trimmed == "" || strings.ToLower(trimmed) == "null" || strings.ToLower(trimmed) == "nil" || nullTokens[strings.ToLower(trimmed)]
+}
+
 // FormatTable creates an ASCII table for display
 func FormatTable(headers []string, rows [][]string, maxWidth int) string {
 	if len(headers) == 0 || len(rows) == 0 {
@@ -233,6 +263,66 @@ func FormatTable(headers []string, rows [][]string, maxWidth int) string {
 	return result.String()
 }
 
+// FormatMarkdownTable creates a Markdown table. Pipes are escaped and line
+// breaks become <br>, so every row stays on one line.
+func FormatMarkdownTable(headers []string, rows [][]string) string {
+	cell := func(s string) string {
+		s = strings.ReplaceAll(s, "|", "\\|")
+		s = strings.ReplaceAll(s, "\r\n", "<br>")
+		return strings.ReplaceAll(s, "\n", "<br>")
+	}
+
+	var result strings.Builder
+	result.WriteString("|")
+	for _, header := range headers {
+		result.WriteString(" " + cell(header) + " |")
+	}
+	result.WriteString("\n|")
+	for range headers {
+		result.WriteString(" --- |")
+	}
+	result.WriteString("\n")
+	for _, row := range rows {
+		result.WriteString("|")
+		for i := range headers {
+			value := ""
+			if i < len(row) {
+				value = row[i]
+			}
+			result.WriteString(" " + cell(value) + " |")
+		}
+		result.WriteString("\n")
+	}
+	return result.String()
+}
+
+// FormatHTMLTable creates an HTML table with escaped cells
+func FormatHTMLTable(headers []string, rows [][]string) string {
+	cell := func(s string) string {
+		return strings.ReplaceAll(html.EscapeString(s), "\n", "<br>")
+	}
+
+	var result strings.Builder
+	result.WriteString("<table>\n<thead>\n<tr>")
+	for _, header := range headers {
+		result.WriteString("<th>" + cell(header) + "</th>")
+	}
+	result.WriteString("</tr>\n</thead>\n<tbody>\n")
+	for _, row := range rows {
+		result.WriteString("<tr>")
+		for i := range headers {
+			value := ""
+			if i < len(row) {
+				value = row[i]
+			}
+			result.WriteString("<td>" + cell(value) + "</td>")
+		}
+		result.WriteString("</tr>\n")
+	}
+	result.WriteString("</tbody>\n</table>\n")
+	return result.String()
+}
+
 // PadRight pads a string to the right with spaces
 func PadRight(s string, length int) string {
 	if len(s) >= length {
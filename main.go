@@ -3,65 +3,260 @@ package main
 import (
 	"fmt"
 	"os"
+	"strings"
 
 	"ai-general-tool/tools"
 )
 
+// command is a command of the CLI: its name in its group, the names it is
+// also known by (its name from before the groups, e.g. read-csv), and what
+// it does
+type command struct {
+	name    string
+	aliases []string
+	summary string
+	run     func([]string) error
+}
+
+// group is a group of commands, e.g. read. A group can be a command itself,
+// run when its first argument is not one of its commands (enrich, serve).
+type group struct {
+	name     string
+	summary  string
+	self     *command
+	commands []command
+}
+
+// groups are the commands of the CLI. main runs "<group> <command>" from
+// this table, or a command by one of its aliases without the group; a group
+// with a command of its own runs it for any other first argument. The
+// command then parses its own flags.
+var groups = []*group{
+	{
+		name:    "read",
+		summary: "Read and analyze data",
+		commands: []command{
+			{"csv", []string{"read-csv"}, "Read and analyze a CSV file", tools.RunReadCSV},
+			{"excel", []string{"read-excel"}, "Read and analyze an Excel or ODS file", tools.RunReadExcel},
+			{"json", []string{"read-json"}, "Read and analyze a JSON array of objects", tools.RunReadJSON},
+			{"sqlite", []string{"read-sqlite"}, "Read and analyze a SQLite table or query", tools.RunReadSQLite},
+			{"info", []string{"info"}, "Print size, encoding, dialect, sheets, rows, columns and estimated cost of a file", tools.RunFileInfo},
+			{"sheets", []string{"list-sheets"}, "List the sheets of a workbook: size, range, hidden", tools.RunListSheets},
+			{"describe", []string{"describe"}, "Summary statistics of every column: quartiles, mean, text lengths", tools.RunDescribe},
+			{"value-counts", []string{"value-counts"}, "Frequency table of a column's values over all rows", tools.RunValueCounts},
+			{"correlate", []string{"correlate"}, "Correlations between numeric columns, chi-square between categorical ones", tools.RunCorrelate},
+			{"profile", []string{"profile"}, "Write an HTML report: distributions, top values, missing values, correlations", tools.RunProfile},
+			{"inspect", []string{"inspect"}, "QA an enriched file: generated columns, fill/error rates, examples", tools.RunInspect},
+			{"verify-manifest", []string{"verify-manifest"}, "Check a signed output manifest and find edited rows", tools.RunVerifyManifest},
+		},
+	},
+	{
+		name:    "transform",
+		summary: "Check, clean, reshape and combine data",
+		commands: []command{
+			{"cast", []string{"cast"}, "Convert columns to number, integer, boolean or date; report failures", tools.RunCast},
+			{"clean", []string{"clean"}, "Trim, collapse spaces, fix casing and unicode, ISO dates, strip currency", tools.RunClean},
+			{"quality", []string{"quality"}, "Flag mixed types, outliers, bad dates, whitespace, casing, truncation", tools.RunQuality},
+			{"anomalies", []string{"anomalies"}, "Score unusual values: z-score/IQR for numbers, embeddings for text", tools.RunAnomalies},
+			{"validate", []string{"validate"}, "Check a file against a schema; exits non-zero on violations", tools.RunValidate},
+			{"duplicates", []string{"duplicates"}, "Find duplicate rows by key columns; write a deduplicated file", tools.RunDuplicates},
+			{"diff", []string{"diff"}, "Compare two files by key: added, removed and changed rows and cells", tools.RunDiff},
+			{"compare-runs", []string{"compare-runs"}, "Compare two enrichment runs: change rate per column, disagreements, cost", tools.RunCompareRuns},
+			{"join", []string{"join"}, "Merge two files on key columns (inner, left, right, outer)", tools.RunJoin},
+			{"filter", []string{"filter"}, "Keep the rows matching an expression, e.g. \"amount > 1000 && country == 'DE'\"", tools.RunFilter},
+			{"columns", []string{"columns"}, "Select, drop, reorder and rename columns", tools.RunColumns},
+			{"aggregate", []string{"aggregate"}, "Group rows and compute count, sum, avg, min, max, median", tools.RunAggregate},
+			{"pivot", []string{"pivot"}, "Turn a long table into a wide one (a column per value)", tools.RunPivot},
+			{"unpivot", []string{"unpivot", "melt"}, "Melt a wide table or cross-tab into a long one", tools.RunUnpivot},
+			{"head", []string{"head"}, "Write the first rows of a file (-n 10), streaming", tools.RunHead},
+			{"tail", []string{"tail"}, "Write the last rows of a file (-n 10), streaming", tools.RunTail},
+			{"slice", []string{"slice"}, "Write rows -from N -to M of a file, streaming", tools.RunSlice},
+			{"sort", []string{"sort"}, "Sort rows by columns, numbers and dates by value; -top N", tools.RunSort},
+			{"split", []string{"split"}, "Split a file into one file per column value or fixed-size chunks", tools.RunSplit},
+		},
+	},
+	{
+		name:    "enrich",
+		summary: "Add columns with AI or built-in local enrichments",
+		self:    &command{"enrich", nil, "Add columns with built-in local enrichments (no API), as enrich local", tools.RunEnrich},
+		commands: []command{
+			{"process", []string{"process-data"}, "Process data with AI to add new columns", tools.RunProcessData},
+			{"job", []string{"run-job"}, "Run a process-data job described by a YAML file, then validate its output", tools.RunJob},
+			{"reprocess", []string{"reprocess"}, "Regenerate specific columns of an enriched file", tools.RunReprocess},
+			{"experiment", []string{"experiment"}, "Compare prompt/model variants side by side on a sample", tools.RunExperiment},
+			{"analyze", []string{"analyze"}, "Ask the AI about a whole column (themes, taxonomy, anomalies)", tools.RunAnalyze},
+			{"local", nil, "Add columns with built-in local enrichments (no API)", tools.RunEnrich},
+		},
+	},
+	{
+		name:    "serve",
+		summary: "Run enrichments as a service or in the background",
+		self:    &command{"serve", nil, "Start a local web app (-ui) or a REST API (-api :8080) running enrichments", tools.RunServe},
+		commands: []command{
+			{"jobs", []string{"jobs"}, "Queue process-data runs or job files for the daemon: jobs submit|list|status|cancel", tools.RunJobs},
+			{"daemon", []string{"daemon"}, "Run queued jobs in the background; interrupted jobs resume when it restarts", tools.RunDaemon},
+			{"watch", []string{"watch"}, "Run a job file on every file dropped into a directory, then move it to -out", tools.RunWatch},
+		},
+	},
+}
+
+// helpArgs are the arguments asking for help
+var helpArgs = map[string]bool{"help": true, "-h": true, "-help": true, "--help": true}
+
 func printUsage() {
 	fmt.Println("AI General Tool - Data Enrichment Toolkit")
 	fmt.Println()
-	fmt.Println("Usage: go run . <command> [flags]")
-	fmt.Println()
-	fmt.Println("Available commands:")
-	fmt.Println()
-	fmt.Println("DATA INPUT:")
-	fmt.Println("  read-csv      Read and analyze a CSV file")
-	fmt.Println("  read-excel    Read and analyze an Excel file")
+	fmt.Println("Usage: go run . <group> <command> [flags] [arguments]")
+	for _, g := range groups {
+		fmt.Println()
+		fmt.Printf("%s: %s\n", strings.ToUpper(g.name), g.summary)
+		printCommands(g)
+	}
 	fmt.Println()
-	fmt.Println("DATA PROCESSING:")
-	fmt.Println("  process-data  Process data with AI to add new columns")
+	fmt.Print(tools.GlobalFlagUsage)
 	fmt.Println()
 	fmt.Println("Examples:")
-	fmt.Println("  go run . read-csv data.csv")
-	fmt.Println("  go run . read-csv data.csv -rows 50 -sample random")
-	fmt.Println("  go run . read-excel report.xlsx")
-	fmt.Println("  go run . read-excel report.xlsx -sheet 2 -rows 30")
+	fmt.Println("  go run . read csv data.csv")
+	fmt.Println("  go run . read csv -rows 50 -sample random data.csv")
+	fmt.Println("  go run . read excel -sheet 2 -rows 30 report.xlsx")
+	fmt.Println("  go run . read inspect customers_enriched.xlsx")
 	fmt.Println()
-	fmt.Println("  go run . process-data -input travel.xlsx \\")
+	fmt.Println("  go run . enrich process -input travel.xlsx \\")
 	fmt.Println("    -columns \"country,risk_level\" \\")
 	fmt.Println("    -prompt \"Extract destination country ISO code and assess risk level\"")
 	fmt.Println()
-	fmt.Println("Use '<command> -h' for help with a specific command")
+	fmt.Println("  go run . enrich local -type lang -column description feedback.csv")
+	fmt.Println("  go run . enrich analyze -column comment -task themes feedback.csv")
+	fmt.Println()
+	fmt.Println("Commands keep their earlier names as well, e.g. read-csv for read csv and process-data for enrich process")
+	fmt.Println("Defaults come from aitool.yaml (working directory or ~/.config/aitool/); -profile <name> selects a profile")
+	fmt.Println("Use 'help <group> [command]' or '<group> <command> -h' for help with a group or command")
+}
+
+// printCommands lists the commands of a group
+func printCommands(g *group) {
+	if g.self != nil {
+		fmt.Printf("  %-24s %s\n", g.name+" [flags]", g.self.summary)
+	}
+	for _, c := range g.commands {
+		fmt.Printf("  %-24s %s\n", g.name+" "+c.name, c.summary)
+	}
+}
+
+// printGroupUsage prints the help of a group
+func printGroupUsage(g *group) {
+	fmt.Printf("%s\n\n", g.summary)
+	fmt.Printf("Usage: go run . %s <command> [flags] [arguments]\n\n", g.name)
+	fmt.Println("Commands:")
+	printCommands(g)
+	fmt.Println()
+	fmt.Printf("Use 'go run . %s <command> -h' for help with a command\n", g.name)
+}
+
+// findGroup returns the group of a name, or nil
+func findGroup(name string) *group {
+	for _, g := range groups {
+		if g.name == name {
+			return g
+		}
+	}
+	return nil
+}
+
+// findCommand finds a command by its group and name, or by one of the names
+// it is also known by. It returns the command, the path shown in its help
+// and the arguments left for it.
+func findCommand(args []string) (*command, string, []string) {
+	if g := findGroup(args[0]); g != nil {
+		if len(args) > 1 {
+			for i, c := range g.commands {
+				if args[1] == c.name {
+					return &g.commands[i], g.name + " " + c.name, args[2:]
+				}
+			}
+		}
+		if g.self != nil {
+			return g.self, g.name, args[1:]
+		}
+		return nil, "", nil
+	}
+	for _, g := range groups {
+		for i, c := range g.commands {
+			for _, alias := range c.aliases {
+				if args[0] == alias {
+					return &g.commands[i], g.name + " " + c.name, args[1:]
+				}
+			}
+		}
+	}
+	return nil, "", nil
+}
+
+// suggest returns the paths of the commands called name in a group, for a
+// command not found
+func suggest(name string) []string {
+	var paths []string
+	for _, g := range groups {
+		for _, c := range g.commands {
+			if c.name == name {
+				paths = append(paths, g.name+" "+name)
+			}
+		}
+	}
+	return paths
 }
 
 func main() {
-	if len(os.Args) < 2 {
+	args, err := tools.ParseGlobalFlags(os.Args[1:])
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if len(args) == 0 {
 		printUsage()
 		os.Exit(1)
 	}
 
-	command := os.Args[1]
-	args := os.Args[2:]
-
-	var err error
-	switch command {
-	case "read-csv":
-		err = tools.RunReadCSV(args)
-	case "read-excel":
-		err = tools.RunReadExcel(args)
-	case "process-data":
-		err = tools.RunProcessData(args)
-	case "-h", "--help", "help":
-		printUsage()
+	// help, help <group> and help <group> <command>
+	if helpArgs[args[0]] {
+		if len(args) == 1 {
+			printUsage()
+			return
+		}
+		if g := findGroup(args[1]); g != nil && len(args) == 2 {
+			printGroupUsage(g)
+			return
+		}
+		args = append(args[1:], "-h")
+	}
+
+	// A group without a command, or asked for help
+	if g := findGroup(args[0]); g != nil && (len(args) == 1 || g.self == nil && helpArgs[args[1]]) {
+		printGroupUsage(g)
+		if len(args) == 1 {
+			os.Exit(1)
+		}
 		return
-	default:
-		fmt.Printf("Error: Unknown command '%s'\n\n", command)
-		printUsage()
+	}
+
+	c, path, rest := findCommand(args)
+	if c == nil {
+		if g := findGroup(args[0]); g != nil {
+			fmt.Printf("Error: Unknown command '%s %s'\n\n", args[0], args[1])
+			printGroupUsage(g)
+			os.Exit(1)
+		}
+		fmt.Printf("Error: Unknown command '%s'\n", args[0])
+		if paths := suggest(args[0]); len(paths) > 0 {
+			fmt.Printf("Did you mean: %s?\n", strings.Join(paths, ", "))
+		}
+		fmt.Println("Run 'go run . help' for the list of commands")
 		os.Exit(1)
 	}
 
-	if err != nil {
+	tools.SetCommand(path, c.summary)
+	if err := c.run(rest); err != nil {
 		fmt.Printf("Error: %v\n", err)
 		os.Exit(1)
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,130 @@
+// Package dataset reads, writes and summarizes tables with the readers and
+// writers of the command-line tool: CSV (any dialect, gzipped or not),
+// Excel, ODS, JSON, SQLite, cloud storage and connector sources.
+//
+// It is a facade over the tools package, not a separate implementation: its
+// option types are aliases of the tools types and its functions forward to
+// tools, so they share its process-wide state (aitool.yaml settings, log
+// level). Warnings are discarded unless SetWarnings names a writer; nothing
+// is written to standard output.
+//
+//	ds, err := dataset.Read("customers.xlsx", dataset.ReadOptions{Sheet: "Q3 Data"})
+//	if err != nil {
+//		return err
+//	}
+//	for _, column := range ds.Describe(common.Locale{}) {
+//		fmt.Println(column.Name, column.Type, column.Nulls)
+//	}
+//	err = ds.Write("customers.csv", dataset.WriteOptions{})
+package dataset
+
+import (
+	"fmt"
+	"io"
+
+	"ai-general-tool/common"
+	"ai-general-tool/tools"
+)
+
+func init() {
+	tools.SetMessageOutput(nil) // the host's stdout is its own
+}
+
+// SetWarnings sends the warnings and notes of the readers, writers and
+// enrichment engine, such as repaired CSV rows, to w; nil discards them, as
+// by default. The writer is shared by the whole process.
+func SetWarnings(w io.Writer) {
+	tools.SetMessageOutput(w)
+}
+
+// ReadOptions select the sheet, table, CSV dialect, header rows and JSON
+// flattening of an input, as the input flags of the commands do. The zero
+// value reads the first sheet, detects the CSV dialect and takes the first
+// row as headers.
+type ReadOptions = tools.InputOptions
+
+// WriteOptions select the output format and its settings, as the output
+// flags of the commands do. The zero value picks the format from the file
+// extension.
+type WriteOptions = tools.OutputOptions
+
+// ColumnStats is the summary of a column returned by Describe
+type ColumnStats = tools.ColumnSummary
+
+// Stdout is the file name that writes CSV to standard output
+const Stdout = "-"
+
+// Dataset is a table of string cells with named columns. Rows may be shorter
+// than Headers; missing cells read as empty.
+type Dataset struct {
+	Headers []string
+	Rows    [][]string
+}
+
+// New returns a dataset of the given headers and rows
+func New(headers []string, rows [][]string) *Dataset {
+	return &Dataset{Headers: headers, Rows: rows}
+}
+
+// Read loads a file or source
+func Read(filename string, opts ReadOptions) (*Dataset, error) {
+	headers, rows, err := tools.ReadTable(filename, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Dataset{Headers: headers, Rows: rows}, nil
+}
+
+// Write saves the dataset; the format follows opts.Format or the extension
+func (d *Dataset) Write(filename string, opts WriteOptions) error {
+	return tools.WriteTable(filename, d.Headers, d.Rows, opts)
+}
+
+// Len returns the number of rows
+func (d *Dataset) Len() int {
+	return len(d.Rows)
+}
+
+// ColumnIndex returns the position of a column, or -1
+func (d *Dataset) ColumnIndex(name string) int {
+	for i, header := range d.Headers {
+		if header == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Column returns the values of a column
+func (d *Dataset) Column(name string) ([]string, error) {
+	index := d.ColumnIndex(name)
+	if index == -1 {
+		return nil, fmt.Errorf("column '%s' not found", name)
+	}
+	values := make([]string, len(d.Rows))
+	for r, row := range d.Rows {
+		if index < len(row) {
+			values[r] = row[index]
+		}
+	}
+	return values, nil
+}
+
+// Record returns a row as a map of column name to value
+func (d *Dataset) Record(row int) map[string]string {
+	record := make(map[string]string, len(d.Headers))
+	for c, header := range d.Headers {
+		record[header] = ""
+		if c < len(d.Rows[row]) {
+			record[header] = d.Rows[row][c]
+		}
+	}
+	return record
+}
+
+// Describe summarizes every column: type, counts and, for numeric columns,
+// range, quartiles and mean. The locale sets how numbers and dates are
+// written; the zero value accepts every convention.
+func (d *Dataset) Describe(locale common.Locale) []ColumnStats {
+	return tools.DescribeColumns(d.Headers, d.Rows, locale)
+}
@@ -0,0 +1,198 @@
+// Package enrich generates new columns for the rows of a dataset with a
+// language model, using the engine of the process-data command: parallel
+// workers, retries, per-model column groups, token and cost accounting.
+//
+//	client, err := llm.FromEnv()
+//	if err != nil {
+//		return err
+//	}
+//	enricher := enrich.New(client, "Categorize the support ticket", []string{"category", "summary@gpt-4.1"},
+//		enrich.WithWorkers(20),
+//		enrich.WithProgress(func(p enrich.Progress) {
+//			log.Printf("%d/%d rows, $%.4f", p.Completed, p.Total, p.Cost)
+//		}),
+//	)
+//	out, stats, err := enricher.Enrich(ctx, ds)
+//
+// The prompt is sent as is, as the task after the data of the row; it has
+// no placeholders. Enrich does not print progress; it reaches the host through
+// WithProgress or WithEvents.
+//
+// The package is a facade over the engine of the tools package, not a
+// separate implementation. It shares the engine's process-wide state: the
+// rate limiter of llm.FromEnv clients, the pricing table, the aitool.yaml
+// settings and the log level. Nothing is written to standard output;
+// warnings are discarded unless dataset.SetWarnings names a writer.
+package enrich
+
+import (
+	"context"
+	"fmt"
+
+	"ai-general-tool/pkg/dataset"
+	"ai-general-tool/pkg/llm"
+	"ai-general-tool/tools"
+)
+
+// Progress is the running state of an enrichment: rows completed and
+// failed, tokens and cost so far
+type Progress = tools.Progress
+
+// Stats are the totals of a finished enrichment
+type Stats = tools.ProcessingStats
+
+// The events of an enrichment; a handler set with WithEvents receives them
+// in order from a single goroutine. Use a type switch on RowCompleted,
+// BatchSaved, ErrorEvent and BudgetWarning.
+type (
+	Event         = tools.Event
+	EventHandler  = tools.EventHandler
+	RowCompleted  = tools.RowCompleted
+	BatchSaved    = tools.BatchSaved
+	ErrorEvent    = tools.ErrorEvent
+	BudgetWarning = tools.BudgetWarning
+)
+
+// Column is a column to generate: its name and, optionally, the model that
+// generates it instead of the default model
+type Column = tools.ColumnSpec
+
+// Option configures an Enricher
+type Option func(*Enricher)
+
+// Enricher generates columns for the rows of datasets. It can be reused for
+// several datasets, one at a time.
+type Enricher struct {
+	config     tools.ProcessingConfig
+	workers    int
+	batchSize  int
+	checkpoint string
+	progress   func(Progress)
+	events     EventHandler
+}
+
+// New returns an Enricher generating columns with a prompt. Columns are
+// written as for the -columns flag: a name, optionally followed by @model,
+// e.g. "risk@gpt-4o". A column named like an input column overwrites it in
+// the rows where it gets a value.
+func New(client *llm.Client, prompt string, columns []string, opts ...Option) *Enricher {
+	var specs []Column
+	for _, column := range columns {
+		specs = append(specs, tools.ParseColumns(column)...)
+	}
+	e := &Enricher{
+		config: tools.ProcessingConfig{
+			Client:      client,
+			ColumnSpecs: specs,
+			Prompt:      prompt,
+			Quiet:       true,
+		},
+		workers:   10,
+		batchSize: 100,
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e
+}
+
+// WithModel sets the model of the columns that do not name one (default:
+// llm.DefaultModel)
+func WithModel(model string) Option {
+	return func(e *Enricher) { e.config.Model = model }
+}
+
+// WithWorkers sets the number of rows processed in parallel (default: 10)
+func WithWorkers(workers int) Option {
+	return func(e *Enricher) { e.workers = max(workers, 1) }
+}
+
+// WithCheckpoint records finished rows in the run journal
+// <file>.journal.db every batchSize rows, as process-data does for its
+// output file
+func WithCheckpoint(file string, batchSize int) Option {
+	return func(e *Enricher) {
+		e.checkpoint = file
+		e.batchSize = max(batchSize, 1)
+	}
+}
+
+// WithProgress calls fn with the running totals after every row and
+// checkpoint
+func WithProgress(fn func(Progress)) Option {
+	return func(e *Enricher) { e.progress = fn }
+}
+
+// WithEvents passes every engine event to handler, for hosts that need the
+// generated values or errors of each row as they come
+func WithEvents(handler EventHandler) Option {
+	return func(e *Enricher) { e.events = handler }
+}
+
+// WithTokenBudget emits BudgetWarning events when token usage reaches 80%
+// and 100% of budget; it does not stop the run
+func WithTokenBudget(budget int64) Option {
+	return func(e *Enricher) { e.config.TokenBudget = budget }
+}
+
+// WithHiddenColumns leaves input columns out of the row data sent to the
+// model; they are still in the output
+func WithHiddenColumns(columns ...string) Option {
+	return func(e *Enricher) {
+		e.config.Hidden = make(map[string]bool, len(columns))
+		for _, column := range columns {
+			e.config.Hidden[column] = true
+		}
+	}
+}
+
+// WithStrict stops the enrichment at the first row that fails
+func WithStrict() Option {
+	return func(e *Enricher) { e.config.Strict = true }
+}
+
+// Enrich generates the columns for every row of ds and returns a new dataset
+// with them appended, or written over the input columns they are named
+// after. Failed rows keep empty generated cells and are counted in the
+// stats' FailedRows. When ctx is cancelled, or a strict run stops, the rows
+// finished so far are returned with the error; the stats' Remaining lists
+// the rows left unprocessed.
+func (e *Enricher) Enrich(ctx context.Context, ds *dataset.Dataset) (*dataset.Dataset, *Stats, error) {
+	if len(e.config.ColumnSpecs) == 0 {
+		return nil, nil, fmt.Errorf("no columns to generate")
+	}
+	if e.config.Client == nil {
+		return nil, nil, fmt.Errorf("no client")
+	}
+
+	config := e.config
+	config.OnEvent = func(event Event) {
+		if e.events != nil {
+			e.events(event)
+		}
+		if e.progress == nil {
+			return
+		}
+		switch ev := event.(type) {
+		case RowCompleted:
+			e.progress(ev.Progress)
+		case ErrorEvent:
+			e.progress(ev.Progress)
+		case BatchSaved:
+			e.progress(ev.Progress)
+		case BudgetWarning:
+			e.progress(ev.Progress)
+		}
+	}
+
+	enriched, stats := tools.ProcessRows(ctx, &config, ds.Headers, ds.Rows, e.workers, e.batchSize, e.checkpoint)
+	headers, rows := tools.MergeColumns(ds.Headers, enriched, config.ColumnSpecs)
+	out := dataset.New(headers, rows)
+	if stats.Stopped != nil {
+		return out, stats, fmt.Errorf("enrichment stopped: %v", stats.Stopped)
+	}
+	if err := ctx.Err(); err != nil {
+		return out, stats, err
+	}
+	return out, stats, nil
+}
@@ -0,0 +1,62 @@
+// Package llm creates the OpenAI clients the enrichment engine uses and
+// prices their token usage.
+//
+// Like the other packages under pkg, it is a facade over the tools package.
+// Clients made by FromEnv share one process-wide rate limiter (rate_limit of
+// aitool.yaml), and FromEnv loads the pricing overrides into the pricing
+// table of the whole process. Its warnings, such as a missing .env file,
+// are discarded unless dataset.SetWarnings names a writer.
+//
+//	client := llm.New(os.Getenv("OPENAI_API_KEY"))
+//
+// Any OpenAI-compatible server works through a base URL:
+//
+//	client := llm.New(key, llm.WithBaseURL("http://localhost:8080/v1"))
+package llm
+
+import (
+	"ai-general-tool/tools"
+
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+)
+
+func init() {
+	tools.SetMessageOutput(nil) // the host's stdout is its own
+}
+
+// Client is an OpenAI API client
+type Client = openai.Client
+
+// Option configures a client
+type Option = option.RequestOption
+
+// Usage is the tokens used by API calls and what they cost
+type Usage = tools.TokenUsage
+
+// DefaultModel generates the columns that do not name a model
+const DefaultModel = tools.DefaultModel
+
+// New creates a client with an API key
+func New(apiKey string, opts ...Option) *Client {
+	return tools.NewClient(apiKey, opts...)
+}
+
+// FromEnv creates a client the way the command-line tool does: the API key
+// comes from OPENAI_API_KEY, in .env or the environment, and the prices of
+// the file named by AI_TOOL_PRICING are loaded
+func FromEnv() (*Client, error) {
+	return tools.NewClientFromEnv()
+}
+
+// WithBaseURL points a client at an OpenAI-compatible server
+func WithBaseURL(url string) Option {
+	return option.WithBaseURL(url)
+}
+
+// Price returns the dollars per million input and output tokens of a model.
+// known is false for models missing from the pricing table, which are
+// priced as DefaultModel.
+func Price(model string) (input, output float64, known bool) {
+	return tools.ModelPrice(model)
+}
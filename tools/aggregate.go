@@ -0,0 +1,283 @@
+package tools
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"ai-general-tool/common"
+)
+
+// aggregateFuncs lists the functions of -agg; count also works without a
+// column, counting the rows of a group
+var aggregateFuncs = map[string]bool{
+	"count": true, "distinct": true, "first": true, "sum": true, "avg": true, "mean": true,
+	"min": true, "max": true, "median": true,
+}
+
+// aggregatePattern matches an -agg term: count, or func(column), with an
+// optional "as name"
+var aggregatePattern = regexp.MustCompile(`(?i)^(\w+)\s*(?:\(\s*(.*?)\s*\))?(?:\s+as\s+(.+))?$`)
+
+// aggregation is a term of -agg: a function over a column (-1 for count)
+type aggregation struct {
+	name   string
+	fn     string
+	column int
+	dates  bool // min and max compare the column's values as dates
+}
+
+// RunAggregate handles the aggregate command: it groups rows by columns and
+// computes counts, sums, averages and other aggregates per group
+func RunAggregate(args []string) error {
+	fs := flag.NewFlagSet("aggregate", flag.ExitOnError)
+
+	// Define flags
+	inputFile := fs.String("input", "", "Input file (CSV, Excel or JSON)")
+	by := fs.String("by", "", "Comma-separated columns to group by (default: one group of every row)")
+	agg := fs.String("agg", "count", "Comma-separated aggregates: count, count(col) (non-empty values), distinct(col), first(col) (first non-empty value), sum(col), avg(col), min(col), max(col), median(col); add \"as name\" to name a column")
+	sortBy := fs.String("sort", "", "Sort the groups by output columns, as for sort -by, e.g. \"count desc\" (default: first appearance)")
+	outputFile := fs.String("output", "", "Save the summary table (default: only print it)")
+	fs.StringVar(outputFile, "o", "", "Shorthand for -output")
+	input := inputFlags(fs)
+	output := &OutputOptions{}
+	fs.StringVar(&output.Format, "format", "same", "Output format: same, csv, sqlite, ods, md (Markdown table), html")
+	fs.BoolVar(&output.QuoteAll, "quote-all", false, "Quote every field of CSV output")
+	var locale common.Locale
+	localeFlag(fs, &locale)
+
+	// Parse flags
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	// Handle positional argument for filename
+	if *inputFile == "" && fs.NArg() > 0 {
+		*inputFile = fs.Arg(0)
+	}
+
+	// Validation
+	if *inputFile == "" {
+		return fmt.Errorf("input file is required")
+	}
+	toStdout, err := useStdout(*inputFile, outputFile, *output)
+	if err != nil {
+		return err
+	}
+	if *outputFile == *inputFile && *inputFile != stdioName {
+		return fmt.Errorf("output would overwrite the input %s", *inputFile)
+	}
+
+	fmt.Printf("Loading %s...\n", *inputFile)
+	headers, rows, err := loadInputFile(*inputFile, *input)
+	if err != nil {
+		return fmt.Errorf("error loading input: %v", err)
+	}
+	var groupBy []int
+	if strings.TrimSpace(*by) != "" {
+		if groupBy, err = columnIndexes(headers, *by); err != nil {
+			return err
+		}
+	}
+	aggs, err := parseAggregations(*agg, headers, rows, locale)
+	if err != nil {
+		return err
+	}
+
+	outHeaders, outRows := aggregateRows(headers, rows, groupBy, aggs, locale)
+	if *sortBy != "" {
+		keys, err := parseSortKeys(*sortBy, outHeaders, outRows, locale)
+		if err != nil {
+			return err
+		}
+		sortRows(outRows, keys, locale)
+	}
+
+	if !toStdout {
+		fmt.Printf("\n%d rows in %d groups\n", len(rows), len(outRows))
+		fmt.Println(common.FormatTable(outHeaders, outRows, 160))
+	}
+	if *outputFile == "" {
+		return nil
+	}
+	if err := saveOutputTable(*outputFile, outHeaders, outRows, nil, *output); err != nil {
+		return fmt.Errorf("error saving output: %v", err)
+	}
+	if !toStdout {
+		fmt.Printf("Summary saved to: %s\n", *outputFile)
+	}
+	return nil
+}
+
+// parseAggregations reads -agg. min and max of date columns compare dates;
+// every other function but count, distinct and first reads numbers.
+func parseAggregations(spec string, headers []string, rows [][]string, locale common.Locale) ([]aggregation, error) {
+	var aggs []aggregation
+	for _, term := range strings.Split(spec, ",") {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			continue
+		}
+		m := aggregatePattern.FindStringSubmatch(term)
+		if m == nil || !aggregateFuncs[strings.ToLower(m[1])] {
+			return nil, fmt.Errorf("invalid aggregate '%s'", term)
+		}
+		a := aggregation{name: term, fn: strings.ToLower(m[1]), column: -1}
+		if a.fn == "mean" {
+			a.fn = "avg"
+		}
+		if m[2] != "" {
+			a.column = indexOf(headers, m[2])
+			if a.column == -1 {
+				return nil, fmt.Errorf("column '%s' not found", m[2])
+			}
+		} else if a.fn != "count" {
+			return nil, fmt.Errorf("%s needs a column, e.g. %s(amount)", a.fn, a.fn)
+		}
+		if m[3] != "" {
+			a.name = strings.TrimSpace(m[3])
+		}
+		if a.column != -1 && (a.fn == "min" || a.fn == "max") {
+			types := common.TypeCounter{Locale: locale}
+			for _, row := range rows {
+				types.Add(cell(row, a.column))
+			}
+			a.dates = types.Type() == common.TypeDate
+		}
+		aggs = append(aggs, a)
+	}
+	if len(aggs) == 0 {
+		return nil, fmt.Errorf("-agg names no aggregate")
+	}
+	return aggs, nil
+}
+
+// aggregateRows groups the rows by the groupBy columns, in order of first
+// appearance, and returns one row per group with its aggregates
+func aggregateRows(headers []string, rows [][]string, groupBy []int, aggs []aggregation, locale common.Locale) ([]string, [][]string) {
+	var outHeaders []string
+	for _, index := range groupBy {
+		outHeaders = append(outHeaders, headers[index])
+	}
+	for _, a := range aggs {
+		outHeaders = append(outHeaders, a.name)
+	}
+
+	groups := make(map[string][]int)
+	var order []string
+	for r, row := range rows {
+		parts := make([]string, len(groupBy))
+		for i, index := range groupBy {
+			parts[i] = cell(row, index)
+		}
+		key := strings.Join(parts, "\x00")
+		if _, ok := groups[key]; !ok {
+			order = append(order, key)
+		}
+		groups[key] = append(groups[key], r)
+	}
+	if len(rows) == 0 && len(groupBy) == 0 {
+		order = append(order, "")
+	}
+
+	var outRows [][]string
+	for _, key := range order {
+		members := groups[key]
+		var out []string
+		if len(groupBy) > 0 {
+			out = append(out, strings.Split(key, "\x00")...)
+		}
+		for _, a := range aggs {
+			out = append(out, a.apply(rows, members, locale))
+		}
+		outRows = append(outRows, out)
+	}
+	return outHeaders, outRows
+}
+
+// apply computes an aggregate over the rows of a group. Empty cells are
+// skipped, as are values that are not numbers for numeric functions.
+func (a aggregation) apply(rows [][]string, members []int, locale common.Locale) string {
+	if a.column == -1 {
+		return strconv.Itoa(len(members))
+	}
+	var values []string
+	for _, r := range members {
+		if value := cell(rows[r], a.column); !common.IsNull(value) {
+			values = append(values, value)
+		}
+	}
+	switch a.fn {
+	case "count":
+		return strconv.Itoa(len(values))
+	case "first":
+		if len(values) == 0 {
+			return ""
+		}
+		return values[0]
+	case "distinct":
+		seen := make(map[string]bool)
+		for _, value := range values {
+			seen[value] = true
+		}
+		return strconv.Itoa(len(seen))
+	}
+
+	if a.dates {
+		best, bestValue := 0.0, ""
+		for _, value := range values {
+			date, ok := common.ParseDate(value, locale)
+			if !ok {
+				continue
+			}
+			t := float64(date.UnixNano())
+			if bestValue == "" || (a.fn == "min" && t < best) || (a.fn == "max" && t > best) {
+				best, bestValue = t, value
+			}
+		}
+		return bestValue
+	}
+
+	var numbers []float64
+	for _, value := range values {
+		if number, ok := numericValue(value, locale); ok {
+			numbers = append(numbers, number)
+		}
+	}
+	if len(numbers) == 0 {
+		if a.fn == "sum" {
+			return "0"
+		}
+		return ""
+	}
+	switch a.fn {
+	case "sum", "avg":
+		sum := 0.0
+		for _, n := range numbers {
+			sum += n
+		}
+		if a.fn == "avg" {
+			sum /= float64(len(numbers))
+		}
+		return formatStat(sum)
+	case "min":
+		lowest := math.Inf(1)
+		for _, n := range numbers {
+			lowest = math.Min(lowest, n)
+		}
+		return formatStat(lowest)
+	case "max":
+		highest := math.Inf(-1)
+		for _, n := range numbers {
+			highest = math.Max(highest, n)
+		}
+		return formatStat(highest)
+	default: // median
+		sort.Float64s(numbers)
+		return formatStat(quantile(numbers, 0.5))
+	}
+}
@@ -0,0 +1,156 @@
+package tools
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// -sheet all reads every sheet of a workbook whose columns match as one
+// dataset, with a source_sheet column naming the sheet each row came from
+const (
+	allSheets         = "all"
+	sourceSheetColumn = "source_sheet"
+)
+
+// isAllSheets reports whether a -sheet value selects every sheet. A sheet
+// named "all" is then selected by its number.
+func isAllSheets(sheet string) bool {
+	return strings.EqualFold(strings.TrimSpace(sheet), allSheets)
+}
+
+// loadAllSheets loads the sheets of an Excel or ODS workbook as one dataset.
+// The sheets sharing the most common set of column names are combined, with
+// columns matched by name; empty sheets and sheets with other columns, such
+// as a summary or notes sheet, are skipped and listed.
+func loadAllSheets(filename string, opts InputOptions) ([]string, [][]string, error) {
+	names, sheetRows, err := readAllSheets(filename, opts.Excel)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	type sheetData struct {
+		name    string
+		headers []string
+		rows    [][]string
+		key     string
+	}
+	var sheets []sheetData
+	var empty []string
+	counts := make(map[string]int)
+	for i, name := range names {
+		if len(sheetRows[i]) == 0 || !opts.Header.None && len(sheetRows[i]) <= opts.Header.top() {
+			empty = append(empty, name)
+			continue
+		}
+		headers, rows, err := opts.Header.split(sheetRows[i])
+		if err != nil {
+			return nil, nil, fmt.Errorf("sheet '%s': %v", name, err)
+		}
+		if indexOf(headers, sourceSheetColumn) != -1 {
+			return nil, nil, fmt.Errorf("sheet '%s' already has a %s column", name, sourceSheetColumn)
+		}
+		set := slices.Clone(headers)
+		slices.Sort(set)
+		key := strings.Join(set, "\x00")
+		counts[key]++
+		sheets = append(sheets, sheetData{name, headers, rows, key})
+	}
+	if len(sheets) == 0 {
+		return nil, nil, fmt.Errorf("no sheet has headers and at least one data row")
+	}
+
+	// The most common columns win; on a tie, those of the earliest sheet
+	chosen := sheets[0].key
+	for _, s := range sheets {
+		if counts[s.key] > counts[chosen] {
+			chosen = s.key
+		}
+	}
+	var headers, combined, skipped []string
+	var rows [][]string
+	for _, s := range sheets {
+		if s.key != chosen {
+			skipped = append(skipped, s.name)
+			continue
+		}
+		if headers == nil {
+			headers = s.headers
+		}
+		positions := make([]int, len(s.headers))
+		for i, header := range s.headers {
+			positions[i] = indexOf(headers, header)
+		}
+		for _, sheetRow := range s.rows {
+			row := make([]string, len(headers)+1)
+			for i, value := range sheetRow {
+				if i < len(positions) {
+					row[positions[i]] = value
+				}
+			}
+			row[len(headers)] = s.name
+			rows = append(rows, row)
+		}
+		combined = append(combined, s.name)
+	}
+
+	infof("Combined %d of %d sheets: %s", len(combined), len(names), strings.Join(combined, ", "))
+	if len(skipped) > 0 {
+		infof("Skipped sheets with other columns: %s", strings.Join(skipped, ", "))
+	}
+	if len(empty) > 0 {
+		infof("Skipped empty sheets: %s", strings.Join(empty, ", "))
+	}
+	return append(slices.Clone(headers), sourceSheetColumn), rows, nil
+}
+
+// readAllSheets returns the names and rows of every sheet of a workbook
+func readAllSheets(filename string, excel ExcelOptions) ([]string, [][][]string, error) {
+	if isODSFile(filename) || isXLSFile(filename) {
+		read := readODS
+		if isXLSFile(filename) {
+			read = readXLS
+		}
+		sheets, err := read(filename)
+		if err != nil {
+			return nil, nil, err
+		}
+		rows := make([][][]string, len(sheets))
+		for i, sheet := range sheets {
+			rows[i] = sheet.Rows
+		}
+		return sheetNames(sheets), rows, nil
+	}
+
+	names, source, err := openExcelRows(filename, "1", excel)
+	if err != nil {
+		return nil, nil, err
+	}
+	rows := make([][][]string, len(names))
+	for i := range names {
+		if i > 0 {
+			if _, source, err = openExcelRows(filename, strconv.Itoa(i+1), excel); err != nil {
+				return nil, nil, err
+			}
+		}
+		rows[i], err = readRows(source)
+		source.Close()
+		if err != nil {
+			return nil, nil, fmt.Errorf("sheet '%s': %v", names[i], err)
+		}
+	}
+	return names, rows, nil
+}
+
+// routeSheets gives Excel and ODS outputs of a -sheet all input one sheet
+// per input sheet, unless the output is already split or routed
+func (o *OutputOptions) routeSheets(input InputOptions, outputFile string, headers []string) {
+	if !isAllSheets(input.Sheet) || o.SheetBy != "" || o.SplitBy != "" || o.SplitSize > 0 || o.Mode == outputModeDelta {
+		return
+	}
+	workbook := o.Format == "ods" || o.Format == "same" && (isExcelWorkbook(outputFile) || isODSFile(outputFile))
+	if workbook && indexOf(headers, sourceSheetColumn) != -1 {
+		o.SheetBy = sourceSheetColumn
+	}
+}
@@ -0,0 +1,189 @@
+package tools
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/openai/openai-go"
+)
+
+// analysisTasks are built-in dataset-level prompts
+var analysisTasks = map[string]string{
+	"themes":    "Identify the main themes in these values. For each theme give a short name, a one-sentence description, an estimate of how many values belong to it and two representative examples. Order themes by frequency.",
+	"taxonomy":  "Propose a category taxonomy for these values, suitable for classifying them one by one later. Give 5-15 mutually exclusive categories, each with a short name, a definition and example values. Mention values that do not fit well.",
+	"anomalies": "Describe the anomalies in these values: outliers, malformed or suspicious entries, unexpected formats and inconsistent spellings. For each, explain why it stands out and give examples.",
+}
+
+const analysisDefaultMaxChars = 100000
+
+// RunAnalyze handles the analyze command
+func RunAnalyze(args []string) error {
+	fs := flag.NewFlagSet("analyze", flag.ExitOnError)
+
+	// Define flags
+	inputFile := fs.String("input", "", "Input file (CSV, Excel or JSON)")
+	column := fs.String("column", "", "Name of the column to analyze")
+	task := fs.String("task", "", "Built-in analysis: themes, taxonomy, anomalies")
+	prompt := fs.String("prompt", "", "Custom question about the whole column (instead of -task)")
+	mode := fs.String("mode", "auto", "What is sent: values, counts (distinct values with counts), auto")
+	maxChars := fs.Int("max-chars", analysisDefaultMaxChars, "Maximum characters of column data sent to the model")
+	model := fs.String("model", openai.ChatModelGPT4o, "Model used for the analysis")
+	outputFile := fs.String("output", "", "Save the analysis to a file (optional)")
+	input := inputFlags(fs)
+
+	// Parse flags
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	// Handle positional argument for filename
+	if *inputFile == "" && fs.NArg() > 0 {
+		*inputFile = fs.Arg(0)
+	}
+
+	// Validate inputs
+	if *inputFile == "" {
+		return fmt.Errorf("input file is required")
+	}
+	if *column == "" {
+		return fmt.Errorf("column is required")
+	}
+	question := *prompt
+	if *task != "" {
+		taskPrompt, ok := analysisTasks[*task]
+		if !ok {
+			return fmt.Errorf("unknown task '%s' (use themes, taxonomy or anomalies)", *task)
+		}
+		question = strings.TrimSpace(taskPrompt + " " + question)
+	}
+	if question == "" {
+		return fmt.Errorf("either -task or -prompt is required")
+	}
+	if *mode != "auto" && *mode != "values" && *mode != "counts" {
+		return fmt.Errorf("invalid mode '%s' (use values, counts or auto)", *mode)
+	}
+
+	client, err := newOpenAIClient()
+	if err != nil {
+		return err
+	}
+
+	// Load input data
+	fmt.Printf("Loading %s...\n", *inputFile)
+	headers, rows, err := loadInputFile(*inputFile, *input)
+	if err != nil {
+		return fmt.Errorf("error loading input: %v", err)
+	}
+	columnIdx := indexOf(headers, *column)
+	if columnIdx == -1 {
+		return fmt.Errorf("column '%s' not found in %s", *column, *inputFile)
+	}
+
+	var values []string
+	for _, row := range rows {
+		if columnIdx < len(row) && strings.TrimSpace(row[columnIdx]) != "" {
+			values = append(values, strings.TrimSpace(row[columnIdx]))
+		}
+	}
+	if len(values) == 0 {
+		return fmt.Errorf("column '%s' has no values", *column)
+	}
+
+	data, description := buildColumnDigest(values, *mode, *maxChars)
+	fmt.Printf("Analyzing %d values from '%s' (%s)...\n", len(values), *column, description)
+
+	userMessage := fmt.Sprintf("Column: %s\nRows: %d (%d non-empty)\nData (%s):\n%s\n\nTask: %s",
+		*column, len(rows), len(values), description, data, question)
+
+	completion, err := client.Chat.Completions.New(context.Background(), openai.ChatCompletionNewParams{
+		Model: *model,
+		Messages: []openai.ChatCompletionMessageParamUnion{
+			openai.SystemMessage("You are a data analyst. You receive all values of one column of a dataset and answer questions about the column as a whole. Base every statement on the data given and say when the data is a sample or was cut."),
+			openai.UserMessage(userMessage),
+		},
+		Temperature: openai.Float(0.3),
+	})
+	if err != nil {
+		return fmt.Errorf("analysis failed: %v", err)
+	}
+	if len(completion.Choices) == 0 {
+		return fmt.Errorf("no response from AI")
+	}
+
+	analysis := completion.Choices[0].Message.Content
+	fmt.Println("\n=== ANALYSIS ===")
+	fmt.Println(analysis)
+	usage := chatUsage(*model, completion.Usage)
+	fmt.Printf("\nTokens used: %d (input %d, output %d), cost $%.4f\n", usage.Total(), usage.InputTokens, usage.OutputTokens, usage.Cost)
+
+	if *outputFile != "" {
+		if err := os.WriteFile(*outputFile, []byte(analysis+"\n"), 0644); err != nil {
+			return fmt.Errorf("error saving analysis: %v", err)
+		}
+		fmt.Printf("Analysis saved to: %s\n", *outputFile)
+	}
+
+	return nil
+}
+
+// buildColumnDigest renders the column for the prompt, either as raw values
+// or as distinct values with counts, within maxChars. In auto mode raw values
+// are used when they fit. Returns the text and a short description of it.
+func buildColumnDigest(values []string, mode string, maxChars int) (string, string) {
+	if mode == "values" || mode == "auto" {
+		total := 0
+		for _, value := range values {
+			total += len(value) + 1
+		}
+		if mode == "values" || total <= maxChars {
+			var text strings.Builder
+			included := 0
+			for _, value := range values {
+				if text.Len()+len(value)+1 > maxChars {
+					break
+				}
+				text.WriteString(value)
+				text.WriteString("\n")
+				included++
+			}
+			if included < len(values) {
+				return text.String(), fmt.Sprintf("first %d of %d values", included, len(values))
+			}
+			return text.String(), "all values"
+		}
+	}
+
+	counts := make(map[string]int)
+	for _, value := range values {
+		counts[value]++
+	}
+	distinct := make([]string, 0, len(counts))
+	for value := range counts {
+		distinct = append(distinct, value)
+	}
+	sort.Slice(distinct, func(a, b int) bool {
+		if counts[distinct[a]] != counts[distinct[b]] {
+			return counts[distinct[a]] > counts[distinct[b]]
+		}
+		return distinct[a] < distinct[b]
+	})
+
+	var text strings.Builder
+	included := 0
+	for _, value := range distinct {
+		line := fmt.Sprintf("%d\t%s\n", counts[value], value)
+		if text.Len()+len(line) > maxChars {
+			break
+		}
+		text.WriteString(line)
+		included++
+	}
+	if included < len(distinct) {
+		return text.String(), fmt.Sprintf("count<TAB>value for the %d most frequent of %d distinct values", included, len(distinct))
+	}
+	return text.String(), fmt.Sprintf("count<TAB>value for all %d distinct values", len(distinct))
+}
@@ -0,0 +1,300 @@
+package tools
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"ai-general-tool/common"
+)
+
+// Columns added to each row by the anomalies output
+const (
+	anomalyColumn      = "_anomaly"
+	anomalyScoreColumn = "_anomaly_score"
+)
+
+// anomalyMaxTextChars caps the characters of a value sent for embedding
+const anomalyMaxTextChars = 2000
+
+// anomaly is the score of a row: how far its value is from the rest, and
+// whether that makes it an outlier
+type anomaly struct {
+	Row     int
+	Score   float64
+	Outlier bool
+	Detail  string
+}
+
+// RunAnomalies handles the anomalies command: it scores how unusual each
+// row's value is, with z-scores or the IQR for numeric columns and, for text
+// columns, the distance of each value's embedding from the column's centroid
+func RunAnomalies(args []string) error {
+	fs := flag.NewFlagSet("anomalies", flag.ExitOnError)
+
+	// Define flags
+	inputFile := fs.String("input", "", "Input file (CSV, Excel or JSON)")
+	column := fs.String("column", "", "Column to check (required)")
+	method := fs.String("method", "auto", "Method: iqr or zscore for numbers, semantic (embedding distance, uses the API) for text, or auto (iqr for numeric columns, semantic otherwise)")
+	threshold := fs.Float64("threshold", 0, "Outlier threshold: IQR multiplier for iqr and semantic (default 1.5), standard deviations for zscore (default 3)")
+	top := fs.Int("top", 20, "Most unusual rows listed in the report")
+	maxValues := fs.Int("max-values", 10000, "semantic: maximum distinct values to embed")
+	outputFile := fs.String("output", "", "Save the rows with "+anomalyColumn+" and "+anomalyScoreColumn+" columns")
+	fs.StringVar(outputFile, "o", "", "Shorthand for -output")
+	onlyAnomalies := fs.Bool("only-anomalies", false, "Save only the outlier rows")
+	input := inputFlags(fs)
+	output := &OutputOptions{}
+	fs.StringVar(&output.Format, "format", "same", "Output format: same, csv, sqlite, ods, md (Markdown table), html")
+	fs.BoolVar(&output.QuoteAll, "quote-all", false, "Quote every field of CSV output")
+	var locale common.Locale
+	localeFlag(fs, &locale)
+
+	// Parse flags
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	// Handle positional argument for filename
+	if *inputFile == "" && fs.NArg() > 0 {
+		*inputFile = fs.Arg(0)
+	}
+
+	// Validation
+	if *inputFile == "" {
+		return fmt.Errorf("input file is required")
+	}
+	if *column == "" {
+		return fmt.Errorf("-column is required")
+	}
+	switch *method {
+	case "auto", "iqr", "zscore", "semantic":
+	default:
+		return fmt.Errorf("invalid method '%s' (use auto, iqr, zscore or semantic)", *method)
+	}
+	toStdout, err := useStdout(*inputFile, outputFile, *output)
+	if err != nil {
+		return err
+	}
+	if *outputFile == *inputFile && *inputFile != stdioName {
+		return fmt.Errorf("output would overwrite the input %s", *inputFile)
+	}
+
+	fmt.Printf("Loading %s...\n", *inputFile)
+	headers, rows, err := loadInputFile(*inputFile, *input)
+	if err != nil {
+		return fmt.Errorf("error loading input: %v", err)
+	}
+	index := indexOf(headers, strings.TrimSpace(*column))
+	if index == -1 {
+		return fmt.Errorf("column '%s' not found", *column)
+	}
+	values := make([]string, len(rows))
+	types := common.TypeCounter{Locale: locale}
+	for r, row := range rows {
+		values[r] = cell(row, index)
+		types.Add(values[r])
+	}
+	numeric := isNumericType(types.Type())
+	if *method == "auto" {
+		*method = "semantic"
+		if numeric {
+			*method = "iqr"
+		}
+	}
+	if *method != "semantic" && !numeric {
+		return fmt.Errorf("column '%s' is not numeric (%s); use -method semantic for text", *column, types.Type())
+	}
+	if *threshold == 0 {
+		*threshold = defaultOutlierThreshold(*method)
+	}
+
+	var anomalies []anomaly
+	if *method == "semantic" {
+		anomalies, err = semanticAnomalies(context.Background(), values, *threshold, *maxValues)
+	} else {
+		anomalies, err = numericAnomalies(values, *method, *threshold, locale)
+	}
+	if err != nil {
+		return err
+	}
+
+	outliers := 0
+	for _, a := range anomalies {
+		if a.Outlier {
+			outliers++
+		}
+	}
+	fmt.Printf("\n=== ANOMALIES: %s (%s, threshold %s) ===\n", headers[index], *method, formatStat(*threshold))
+	fmt.Printf("Rows scored: %d of %d | Outliers: %d (%s)\n", len(anomalies), len(rows), outliers, common.FormatPercentage(outliers, len(anomalies)))
+	ranked := append([]anomaly{}, anomalies...)
+	sort.SliceStable(ranked, func(i, j int) bool { return ranked[i].Score > ranked[j].Score })
+	var table [][]string
+	for _, a := range ranked[:common.Min(*top, len(ranked))] {
+		if a.Score == 0 {
+			break
+		}
+		table = append(table, []string{strconv.Itoa(a.Row + 1), common.TruncateString(values[a.Row], 50), formatStat(a.Score), strconv.FormatBool(a.Outlier), a.Detail})
+	}
+	if len(table) > 0 {
+		fmt.Printf("MOST UNUSUAL ROWS:\n")
+		fmt.Println(common.FormatTable([]string{"Row", "Value", "Score", "Outlier", "Detail"}, table, 160))
+	}
+
+	if *outputFile == "" {
+		return nil
+	}
+	scores := make(map[int]anomaly, len(anomalies))
+	for _, a := range anomalies {
+		scores[a.Row] = a
+	}
+	outHeaders := append(append([]string{}, headers...), anomalyColumn, anomalyScoreColumn)
+	var outRows [][]string
+	for r, row := range rows {
+		a, scored := scores[r]
+		if *onlyAnomalies && !a.Outlier {
+			continue
+		}
+		out := padRow(row, len(headers))
+		if scored {
+			out = append(out, strconv.FormatBool(a.Outlier), formatStat(a.Score))
+		} else {
+			out = append(out, "", "")
+		}
+		outRows = append(outRows, out)
+	}
+	if err := saveOutputTable(*outputFile, outHeaders, outRows, nil, *output); err != nil {
+		return fmt.Errorf("error saving output: %v", err)
+	}
+	if !toStdout {
+		fmt.Printf("Output saved to: %s\n", *outputFile)
+	}
+	return nil
+}
+
+// numericAnomalies scores the numbers of a column: for zscore the absolute
+// z-score, for iqr how many interquartile ranges a value lies beyond the
+// quartiles (0 inside them). Values that are not numbers are not scored.
+func numericAnomalies(values []string, method string, threshold float64, locale common.Locale) ([]anomaly, error) {
+	var numbers []float64
+	var rows []int
+	for r, value := range values {
+		if n, ok := numericValue(value, locale); ok {
+			numbers = append(numbers, n)
+			rows = append(rows, r)
+		}
+	}
+	if len(numbers) < 4 {
+		return nil, fmt.Errorf("at least 4 numeric values are needed, got %d", len(numbers))
+	}
+	lower, upper, err := outlierBounds(numbers, method, threshold)
+	if err != nil {
+		return nil, err
+	}
+	mean, stddev := meanStddev(numbers)
+	sorted := append([]float64{}, numbers...)
+	sort.Float64s(sorted)
+	q1, q3 := quantile(sorted, 0.25), quantile(sorted, 0.75)
+
+	anomalies := make([]anomaly, len(numbers))
+	for i, n := range numbers {
+		a := anomaly{Row: rows[i], Outlier: n < lower || n > upper}
+		switch {
+		case method == "zscore" && stddev > 0:
+			a.Score = math.Abs(n-mean) / stddev
+		case method == "iqr" && q3 > q1:
+			a.Score = math.Max(q1-n, n-q3) / (q3 - q1)
+			a.Score = math.Max(a.Score, 0)
+		}
+		if n < lower {
+			a.Detail = "below " + formatStat(lower)
+		} else if n > upper {
+			a.Detail = "above " + formatStat(upper)
+		}
+		anomalies[i] = a
+	}
+	return anomalies, nil
+}
+
+// semanticAnomalies embeds the distinct non-empty values and scores each
+// row by the cosine distance of its value from the mean embedding. Rows
+// beyond the upper IQR fence of those distances are outliers.
+func semanticAnomalies(ctx context.Context, values []string, threshold float64, maxValues int) ([]anomaly, error) {
+	var distinct []string
+	seen := make(map[string]int)
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if _, ok := seen[value]; !ok && !common.IsNull(value) {
+			seen[value] = len(distinct)
+			distinct = append(distinct, value)
+		}
+	}
+	if len(distinct) < 4 {
+		return nil, fmt.Errorf("at least 4 distinct values are needed, got %d", len(distinct))
+	}
+	if len(distinct) > maxValues {
+		return nil, fmt.Errorf("%d distinct values exceed -max-values %d", len(distinct), maxValues)
+	}
+
+	client, err := newOpenAIClient()
+	if err != nil {
+		return nil, err
+	}
+	fmt.Printf("Embedding %d distinct values...\n", len(distinct))
+	embeddings := make([][]float64, 0, len(distinct))
+	var tokens int64
+	for start := 0; start < len(distinct); start += knowledgeEmbedBatch {
+		batch := distinct[start:common.Min(start+knowledgeEmbedBatch, len(distinct))]
+		texts := make([]string, len(batch))
+		for i, value := range batch {
+			texts[i] = common.TruncateString(value, anomalyMaxTextChars)
+		}
+		batchEmbeddings, batchTokens, err := embedTexts(ctx, client, texts)
+		if err != nil {
+			return nil, fmt.Errorf("error embedding values: %v", err)
+		}
+		embeddings = append(embeddings, batchEmbeddings...)
+		tokens += batchTokens
+	}
+	fmt.Printf("Embedded %d values (%d tokens, $%.4f)\n", len(distinct), tokens, embeddingUsage(knowledgeEmbedModel, tokens).Cost)
+
+	// Every row counts towards the centroid, so frequent values weigh more
+	centroid := make([]float64, len(embeddings[0]))
+	counted := 0
+	for _, value := range values {
+		if i, ok := seen[strings.TrimSpace(value)]; ok {
+			for d, v := range embeddings[i] {
+				centroid[d] += v
+			}
+			counted++
+		}
+	}
+	for d := range centroid {
+		centroid[d] /= float64(counted)
+	}
+	distances := make([]float64, len(distinct))
+	for i, embedding := range embeddings {
+		distances[i] = 1 - cosineSimilarity(embedding, centroid)
+	}
+	_, upper, err := outlierBounds(distances, "iqr", threshold)
+	if err != nil {
+		return nil, err
+	}
+
+	var anomalies []anomaly
+	for r, value := range values {
+		i, ok := seen[strings.TrimSpace(value)]
+		if !ok {
+			continue
+		}
+		a := anomaly{Row: r, Score: distances[i], Outlier: distances[i] > upper}
+		if a.Outlier {
+			a.Detail = "far from the other values"
+		}
+		anomalies = append(anomalies, a)
+	}
+	return anomalies, nil
+}
@@ -0,0 +1,136 @@
+package tools
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// AttachmentOptions configures loading a per-row document into the prompt
+type AttachmentOptions struct {
+	Column   string // column holding the file path
+	MaxChars int    // maximum characters included per document
+	Strategy string // truncation strategy: head, tail, middle
+	BaseDir  string // directory relative paths are resolved against
+}
+
+// attachmentStrategies lists the supported truncation strategies
+var attachmentStrategies = map[string]bool{"head": true, "tail": true, "middle": true}
+
+// loadAttachment reads the document referenced by path and truncates it
+// according to the options
+func loadAttachment(path string, opts *AttachmentOptions) (string, error) {
+	resolved := path
+	if !filepath.IsAbs(resolved) {
+		if _, err := os.Stat(resolved); err != nil && opts.BaseDir != "" {
+			resolved = filepath.Join(opts.BaseDir, path)
+		}
+	}
+
+	var text string
+	var err error
+	switch strings.ToLower(filepath.Ext(resolved)) {
+	case ".txt", ".md", ".markdown", "":
+		var data []byte
+		data, err = os.ReadFile(resolved)
+		text = string(data)
+	case ".docx":
+		text, err = readDocxText(resolved)
+	default:
+		return "", fmt.Errorf("unsupported attachment type '%s' (use txt, md or docx)", filepath.Ext(resolved))
+	}
+	if err != nil {
+		return "", fmt.Errorf("error reading attachment '%s': %v", path, err)
+	}
+
+	return truncateText(strings.TrimSpace(text), opts.MaxChars, opts.Strategy), nil
+}
+
+// truncateText shortens text to maxChars runes, keeping the start (head),
+// the end (tail) or both ends (middle) and marking the cut
+func truncateText(text string, maxChars int, strategy string) string {
+	runes := []rune(text)
+	if maxChars <= 0 || len(runes) <= maxChars {
+		return text
+	}
+
+	const marker = "\n[... truncated ...]\n"
+	switch strategy {
+	case "tail":
+		return marker + string(runes[len(runes)-maxChars:])
+	case "middle":
+		half := maxChars / 2
+		return string(runes[:half]) + marker + string(runes[len(runes)-(maxChars-half):])
+	default:
+		return string(runes[:maxChars]) + marker
+	}
+}
+
+// readDocxText extracts the paragraph text of a .docx document
+func readDocxText(path string) (string, error) {
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		return "", err
+	}
+	defer archive.Close()
+
+	for _, file := range archive.File {
+		if file.Name != "word/document.xml" {
+			continue
+		}
+		rc, err := file.Open()
+		if err != nil {
+			return "", err
+		}
+		defer rc.Close()
+		return extractDocxXMLText(rc)
+	}
+
+	return "", fmt.Errorf("word/document.xml not found")
+}
+
+// extractDocxXMLText collects <w:t> text, separating paragraphs with newlines
+func extractDocxXMLText(r io.Reader) (string, error) {
+	decoder := xml.NewDecoder(r)
+	var text strings.Builder
+	inText := false
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "t":
+				inText = true
+			case "tab":
+				text.WriteString("\t")
+			case "br":
+				text.WriteString("\n")
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				text.WriteString("\n")
+			}
+		case xml.CharData:
+			if inText {
+				text.Write(t)
+			}
+		}
+	}
+
+	return text.String(), nil
+}
@@ -0,0 +1,349 @@
+package tools
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"ai-general-tool/common"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// Types of the cast command
+const (
+	castString  = "string"
+	castNumber  = "number"
+	castInteger = "integer"
+	castBoolean = "boolean"
+	castDate    = "date"
+)
+
+// Layouts of cast dates: a date alone, or a date with a time
+const (
+	castDateLayout     = "2006-01-02"
+	castDateTimeLayout = "2006-01-02 15:04:05"
+)
+
+// castBooleans maps the spellings of booleans cast reads
+var castBooleans = map[string]bool{
+	"true": true, "yes": true, "y": true, "1": true, "on": true,
+	"false": false, "no": false, "n": false, "0": false, "off": false,
+}
+
+// castColumn is a column and the type it is converted to; layout, when set,
+// is the Go layout dates are read with
+type castColumn struct {
+	index  int
+	kind   string
+	layout string
+}
+
+// castFailure is a value that could not be converted
+type castFailure struct {
+	Row    int
+	Column string
+	Value  string
+	Type   string
+}
+
+// RunCast handles the cast command: it converts columns to explicit types,
+// writing canonical values (plain numbers, true/false, ISO dates) that
+// SQLite and Excel outputs store typed, and reports values that fail
+func RunCast(args []string) error {
+	fs := flag.NewFlagSet("cast", flag.ExitOnError)
+
+	// Define flags
+	inputFile := fs.String("input", "", "Input file (CSV, Excel or JSON)")
+	spec := fs.String("column", "", "Comma-separated column:type pairs; types are string, number, integer, boolean, date, or date(<Go layout>) to read dates in that layout, e.g. amount:number,signup:date(02.01.2006) (required)")
+	onError := fs.String("on-error", "null", "Values that fail conversion: null (empty them), keep (keep them as they are) or fail (stop with an error)")
+	examples := fs.Int("examples", 10, "Failed values listed in the report")
+	errorsFile := fs.String("errors-output", "", "Save every failed value as a table with row, column, value and type")
+	outputFile := fs.String("output", "", "Output file (default: <input>_cast)")
+	fs.StringVar(outputFile, "o", "", "Shorthand for -output")
+	input := inputFlags(fs)
+	output := &OutputOptions{}
+	fs.StringVar(&output.Format, "format", "same", "Output format: same, csv, sqlite, ods, md (Markdown table), html")
+	fs.StringVar(&output.Table, "output-table", "", "Table written for SQLite outputs (default: "+sqliteDefaultTable+")")
+	fs.BoolVar(&output.QuoteAll, "quote-all", false, "Quote every field of CSV output")
+	var locale common.Locale
+	localeFlag(fs, &locale)
+
+	// Parse flags
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	// Handle positional argument for filename
+	if *inputFile == "" && fs.NArg() > 0 {
+		*inputFile = fs.Arg(0)
+	}
+
+	// Validation
+	if *inputFile == "" {
+		return fmt.Errorf("input file is required")
+	}
+	if *spec == "" {
+		return fmt.Errorf("-column is required")
+	}
+	switch *onError {
+	case "null", "keep", "fail":
+	default:
+		return fmt.Errorf("invalid on-error '%s' (use null, keep or fail)", *onError)
+	}
+	toStdout, err := useStdout(*inputFile, outputFile, *output)
+	if err != nil {
+		return err
+	}
+	if *outputFile == "" {
+		*outputFile = suffixedOutputFile(*inputFile, output.Format, "_cast")
+	}
+	if *outputFile == *inputFile && *inputFile != stdioName {
+		return fmt.Errorf("output would overwrite the input %s", *inputFile)
+	}
+
+	fmt.Printf("Loading %s...\n", *inputFile)
+	headers, rows, err := loadInputFile(*inputFile, *input)
+	if err != nil {
+		return fmt.Errorf("error loading input: %v", err)
+	}
+	columns, err := parseCastColumns(*spec, headers)
+	if err != nil {
+		return err
+	}
+
+	converted := make([]int, len(columns))
+	var failures []castFailure
+	out := make([][]string, len(rows))
+	for r, row := range rows {
+		out[r] = padRow(row, len(headers))
+		for i, c := range columns {
+			value := out[r][c.index]
+			if common.IsNull(value) {
+				out[r][c.index] = ""
+				continue
+			}
+			cast, ok := c.convert(value, locale)
+			if !ok {
+				failures = append(failures, castFailure{r + 1, headers[c.index], value, c.kind})
+				if *onError == "fail" {
+					return fmt.Errorf("row %d: cannot convert '%s' in column '%s' to %s", r+1, value, headers[c.index], c.kind)
+				}
+				if *onError == "null" {
+					out[r][c.index] = ""
+				}
+				continue
+			}
+			out[r][c.index] = cast
+			converted[i]++
+		}
+	}
+
+	// Report per column
+	failed := make(map[string]int)
+	for _, f := range failures {
+		failed[f.Column]++
+	}
+	fmt.Printf("\n=== CAST ===\n")
+	var table [][]string
+	for i, c := range columns {
+		kind := c.kind
+		if c.layout != "" {
+			kind += "(" + c.layout + ")"
+		}
+		table = append(table, []string{headers[c.index], kind, strconv.Itoa(converted[i]), strconv.Itoa(failed[headers[c.index]])})
+	}
+	fmt.Println(common.FormatTable([]string{"Column", "Type", "Converted", "Failed"}, table, 120))
+	if len(failures) > 0 {
+		action := map[string]string{"null": "emptied", "keep": "kept as they were"}[*onError]
+		fmt.Printf("%d values failed conversion and were %s\n", len(failures), action)
+		var shown [][]string
+		for _, f := range failures[:common.Min(*examples, len(failures))] {
+			shown = append(shown, []string{strconv.Itoa(f.Row), f.Column, f.Value, f.Type})
+		}
+		if len(shown) > 0 {
+			fmt.Println(common.FormatTable([]string{"Row", "Column", "Value", "Type"}, shown, 120))
+		}
+	}
+	if *errorsFile != "" {
+		var failureRows [][]string
+		for _, f := range failures {
+			failureRows = append(failureRows, []string{strconv.Itoa(f.Row), f.Column, f.Value, f.Type})
+		}
+		if err := saveOutputTable(*errorsFile, []string{"Row", "Column", "Value", "Type"}, failureRows, nil, OutputOptions{Format: "same"}); err != nil {
+			return fmt.Errorf("error saving failures: %v", err)
+		}
+		fmt.Printf("Failures saved to: %s\n", *errorsFile)
+	}
+
+	output.Types = make([]string, len(headers))
+	for _, c := range columns {
+		output.Types[c.index] = c.kind
+	}
+	if err := saveOutputTable(*outputFile, headers, out, nil, *output); err != nil {
+		return fmt.Errorf("error saving output: %v", err)
+	}
+	if !toStdout {
+		fmt.Printf("Output saved to: %s\n", *outputFile)
+	}
+	return nil
+}
+
+// parseCastColumns reads -column: column:type pairs, where a date type may
+// carry the layout to read its values with
+func parseCastColumns(spec string, headers []string) ([]castColumn, error) {
+	var columns []castColumn
+	for _, pair := range splitOutsideParens(spec) {
+		name, kind, ok := strings.Cut(pair, ":")
+		name, kind = strings.TrimSpace(name), strings.TrimSpace(kind)
+		if !ok || name == "" || kind == "" {
+			return nil, fmt.Errorf("invalid cast '%s' (use column:type)", strings.TrimSpace(pair))
+		}
+		c := castColumn{index: indexOf(headers, name), kind: strings.ToLower(kind)}
+		if c.index == -1 {
+			return nil, fmt.Errorf("column '%s' not found", name)
+		}
+		if layout, ok := strings.CutPrefix(kind, "date("); ok && strings.HasSuffix(layout, ")") {
+			c.kind, c.layout = castDate, strings.TrimSuffix(layout, ")")
+		}
+		switch c.kind {
+		case castString, castNumber, castInteger, castBoolean, castDate:
+		default:
+			return nil, fmt.Errorf("unknown type '%s' for column '%s' (use string, number, integer, boolean, date or date(<layout>))", kind, name)
+		}
+		columns = append(columns, c)
+	}
+	return columns, nil
+}
+
+// splitOutsideParens splits on commas that are not inside parentheses, so a
+// date layout may contain commas
+func splitOutsideParens(s string) []string {
+	var parts []string
+	depth, start := 0, 0
+	for i, r := range s {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// convert returns the canonical form of a non-empty value, and false when it
+// is not of the column's type
+func (c castColumn) convert(value string, locale common.Locale) (string, bool) {
+	trimmed := strings.TrimSpace(value)
+	switch c.kind {
+	case castNumber:
+		n, ok := numericValue(trimmed, locale)
+		return strconv.FormatFloat(n, 'f', -1, 64), ok
+	case castInteger:
+		n, ok := numericValue(trimmed, locale)
+		if !ok || n != float64(int64(n)) {
+			return "", false
+		}
+		return strconv.FormatInt(int64(n), 10), true
+	case castBoolean:
+		b, ok := castBooleans[strings.ToLower(trimmed)]
+		return strconv.FormatBool(b), ok
+	case castDate:
+		var date time.Time
+		var err error
+		ok := true
+		if c.layout != "" {
+			date, err = time.Parse(c.layout, trimmed)
+			ok = err == nil
+		} else {
+			date, ok = common.ParseDate(trimmed, locale)
+		}
+		if !ok {
+			return "", false
+		}
+		if date.Hour() == 0 && date.Minute() == 0 && date.Second() == 0 {
+			return date.Format(castDateLayout), true
+		}
+		return date.Format(castDateTimeLayout), true
+	}
+	return value, true
+}
+
+// typedValue returns a canonical value of a typed column as the Go value
+// outputs store: int64, float64, bool or time.Time, nil when empty. Values
+// that are not canonical, such as failures kept with -on-error keep, stay
+// text.
+func typedValue(value, kind string) interface{} {
+	if kind == "" || kind == castString {
+		return value
+	}
+	if value == "" {
+		return nil
+	}
+	switch kind {
+	case castInteger:
+		if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return n
+		}
+	case castNumber:
+		if n, err := strconv.ParseFloat(value, 64); err == nil {
+			return n
+		}
+	case castBoolean:
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	case castDate:
+		for _, layout := range []string{castDateLayout, castDateTimeLayout} {
+			if t, err := time.Parse(layout, value); err == nil {
+				return t
+			}
+		}
+	}
+	return value
+}
+
+// sqliteColumnType returns the declared SQLite type of a cast type
+func sqliteColumnType(kind string) string {
+	switch kind {
+	case castInteger, castBoolean:
+		return "INTEGER"
+	case castNumber:
+		return "REAL"
+	}
+	return "TEXT"
+}
+
+// styleDateColumns gives the date columns of a sheet a yyyy-mm-dd format,
+// since typed dates are stored as numbers
+func styleDateColumns(f *excelize.File, sheet string, types []string, rows int) error {
+	if rows == 0 {
+		return nil
+	}
+	format := "yyyy-mm-dd"
+	var style int
+	for i, kind := range types {
+		if kind != castDate {
+			continue
+		}
+		if style == 0 {
+			var err error
+			if style, err = f.NewStyle(&excelize.Style{CustomNumFmt: &format}); err != nil {
+				return err
+			}
+		}
+		letter := columnIndexToLetter(i)
+		if err := f.SetCellStyle(sheet, letter+"2", fmt.Sprintf("%s%d", letter, rows+1), style); err != nil {
+			return err
+		}
+	}
+	return nil
+}
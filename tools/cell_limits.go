@@ -0,0 +1,206 @@
+package tools
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"sort"
+	"sync/atomic"
+
+	"github.com/openai/openai-go"
+)
+
+// defaultMaxCellChars is the longest cell value sent to the model unless
+// -max-cell-chars says otherwise
+const defaultMaxCellChars = 20000
+
+// cellSummarize is the -cell-truncate strategy that has the model summarize
+// a long cell instead of cutting it
+const cellSummarize = "summarize"
+
+// summarizeMaxInputChars caps the text sent to be summarized, which has to
+// fit the summarizing model's context window itself
+const summarizeMaxInputChars = 200000
+
+// charsPerToken approximates prompt tokens for -max-row-tokens, as token
+// counts without a tokenizer do
+const charsPerToken = 4
+
+// CellLimitOptions keeps oversized cells, e.g. a 200KB notes field, from
+// overflowing the prompt of a row and failing it
+type CellLimitOptions struct {
+	MaxChars  int    // longest cell value sent to the model, 0 for no limit
+	Strategy  string // head, tail, middle or summarize
+	RowTokens int    // approximate tokens of a row's data, 0 for no budget
+
+	truncated  int64 // cells cut by the run, counted atomically
+	summarized int64 // cells summarized by the run, counted atomically
+}
+
+// cellLimitFlags registers -max-cell-chars, -cell-truncate and
+// -max-row-tokens
+func cellLimitFlags(fs *flag.FlagSet, opts *CellLimitOptions) {
+	fs.IntVar(&opts.MaxChars, "max-cell-chars", defaultMaxCellChars, "Longest cell value sent to the model; longer cells are shortened by -cell-truncate (0 = no limit)")
+	fs.StringVar(&opts.Strategy, "cell-truncate", "head", "How to shorten cells over -max-cell-chars: head, tail, middle, or summarize (the model summarizes the cell first, at extra cost)")
+	fs.IntVar(&opts.RowTokens, "max-row-tokens", 0, "Approximate token budget for the data of each row: the longest cells are cut until the row fits (0 = no budget)")
+}
+
+// check validates the options
+func (o *CellLimitOptions) check() error {
+	if o.Strategy != cellSummarize && !attachmentStrategies[o.Strategy] {
+		return fmt.Errorf("invalid cell truncation '%s' (use head, tail, middle or summarize)", o.Strategy)
+	}
+	if o.MaxChars < 0 || o.RowTokens < 0 {
+		return fmt.Errorf("-max-cell-chars and -max-row-tokens cannot be negative")
+	}
+	return nil
+}
+
+// cutStrategy is the strategy used where a cell is cut rather than
+// summarized
+func (o *CellLimitOptions) cutStrategy() string {
+	if o.Strategy == cellSummarize {
+		return "head"
+	}
+	return o.Strategy
+}
+
+// limitRowCells returns the row data as sent to the model: cells over the
+// limit summarized (with the usage of the calls) or cut, then the longest
+// cells cut until the row fits its token budget. rowData is not changed.
+func limitRowCells(ctx context.Context, config *ProcessingConfig, rowData map[string]string) (map[string]string, TokenUsage, error) {
+	var usage TokenUsage
+	o := config.Cells
+	if o == nil {
+		return rowData, usage, nil
+	}
+	if o.Strategy != cellSummarize || o.MaxChars == 0 {
+		return o.count(o.limit(rowData, config.Hidden)), usage, nil
+	}
+
+	limited := make(map[string]string, len(rowData))
+	for key, value := range rowData {
+		limited[key] = value
+		if config.Hidden[key] || len([]rune(value)) <= o.MaxChars {
+			continue
+		}
+		summary, callUsage, err := summarizeCell(ctx, config, key, value, o.MaxChars)
+		usage.add(callUsage)
+		if err != nil {
+			return nil, usage, keepClass(err, fmt.Errorf("summarizing column '%s' failed: %v", key, err))
+		}
+		limited[key] = summary
+		atomic.AddInt64(&o.summarized, 1)
+	}
+	return o.count(o.limit(limited, config.Hidden)), usage, nil
+}
+
+// count adds the cells a row had cut to the run's count
+func (o *CellLimitOptions) count(rowData map[string]string, cut int) map[string]string {
+	atomic.AddInt64(&o.truncated, int64(cut))
+	return rowData
+}
+
+// limit cuts the visible cells of a row over MaxChars, then the longest ones
+// to a common length until the row's data fits RowTokens. It returns the row
+// and the number of cells cut.
+func (o *CellLimitOptions) limit(rowData map[string]string, hidden map[string]bool) (map[string]string, int) {
+	lengths := make(map[string]int)
+	budget := o.RowTokens * charsPerToken
+	total := 0
+	for key, value := range rowData {
+		if hidden[key] {
+			continue
+		}
+		n := len([]rune(value))
+		if o.MaxChars > 0 {
+			n = min(n, o.MaxChars)
+		}
+		lengths[key] = n
+		total += n
+	}
+
+	limit := o.MaxChars
+	if budget > 0 && total > budget {
+		limit = fairShare(lengths, budget)
+	}
+	if limit == 0 {
+		return rowData, 0
+	}
+
+	limited := make(map[string]string, len(rowData))
+	cut := 0
+	for key, value := range rowData {
+		limited[key] = value
+		if _, visible := lengths[key]; visible && len([]rune(value)) > limit {
+			limited[key] = truncateText(value, limit, o.cutStrategy())
+			cut++
+		}
+	}
+	return limited, cut
+}
+
+// fairShare returns the largest length that cells can be cut to so that
+// their lengths add up to at most budget: short cells stay whole and the
+// longest ones share what is left
+func fairShare(lengths map[string]int, budget int) int {
+	sorted := make([]int, 0, len(lengths))
+	for _, n := range lengths {
+		sorted = append(sorted, n)
+	}
+	sort.Ints(sorted)
+	left := budget
+	for i, n := range sorted {
+		share := left / (len(sorted) - i)
+		if n > share {
+			return max(share, 1)
+		}
+		left -= n
+	}
+	return sorted[len(sorted)-1]
+}
+
+// summarizeCell has the default model summarize a long cell value in about
+// maxChars characters
+func summarizeCell(ctx context.Context, config *ProcessingConfig, column, value string, maxChars int) (string, TokenUsage, error) {
+	model := config.modelFor(ColumnSpec{})
+	value = truncateText(value, summarizeMaxInputChars, "middle")
+	completion, err := config.Client.Chat.Completions.New(ctx, openai.ChatCompletionNewParams{
+		Model: model,
+		Messages: []openai.ChatCompletionMessageParamUnion{
+			openai.SystemMessage(fmt.Sprintf("You summarize one field of a data row so it can be processed further. Keep names, numbers, dates, identifiers and conclusions. Answer with the summary only, in at most %d characters.", maxChars)),
+			openai.UserMessage(fmt.Sprintf("Field: %s\n\n%s", column, value)),
+		},
+		Temperature: openai.Float(0.3),
+		MaxTokens:   openai.Int(int64(maxChars/charsPerToken + 100)),
+	})
+	if err != nil {
+		return "", TokenUsage{}, err
+	}
+	usage := chatUsage(model, completion.Usage)
+	if len(completion.Choices) == 0 {
+		return "", usage, fmt.Errorf("no response from AI")
+	}
+	return completion.Choices[0].Message.Content, usage, nil
+}
+
+// reset clears the counts of shortened cells
+func (o *CellLimitOptions) reset() {
+	if o != nil {
+		atomic.StoreInt64(&o.truncated, 0)
+		atomic.StoreInt64(&o.summarized, 0)
+	}
+}
+
+// printSummary reports the cells the run shortened
+func (o *CellLimitOptions) printSummary() {
+	if o == nil {
+		return
+	}
+	if n := atomic.LoadInt64(&o.summarized); n > 0 {
+		fmt.Printf("Cells summarized (over %d characters): %d\n", o.MaxChars, n)
+	}
+	if n := atomic.LoadInt64(&o.truncated); n > 0 {
+		fmt.Printf("Cells truncated to fit -max-cell-chars or -max-row-tokens: %d\n", n)
+	}
+}
@@ -0,0 +1,329 @@
+package tools
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// journalSuffix names the run journal next to an output file
+const journalSuffix = ".journal.db"
+
+// Row states recorded in the run journal
+const (
+	journalDone  = "done"
+	journalError = "error"
+)
+
+// journalRow is the state of one input row in the run journal
+type journalRow struct {
+	Row        int      // data row of the input, 0-based
+	Input      []string // input cells, hashed when the row is written
+	Hash       string
+	Status     string
+	Results    map[string]string
+	Tokens     int
+	Error      string
+	ErrorClass string // rate_limit, timeout, parse, content_filter, api or other
+	Attempts   int    // times the row's requests were sent, retries included
+}
+
+// runJournal records the state of every processed row of a run in a SQLite
+// database next to the output (<output>.journal.db): status, generated values,
+// tokens, errors with their class, and attempts. Rows are written in the background, so the result
+// collector never waits on disk I/O, and each save only writes the rows
+// finished since the previous one. With -resume, rows already done are
+// taken from the journal instead of being processed again.
+type runJournal struct {
+	file    string
+	db      *sql.DB
+	headers []string
+	columns []int // input columns covered by the row hash
+	resumed map[int]journalRow
+	input   string // SHA-256 of the input file the journal was started from, empty when unknown
+
+	mu      sync.Mutex
+	pending map[int]journalRow // rows finished since the last save
+	err     error              // first failed save not yet reported
+
+	saves int64 // completed saves, read with atomic
+	wake  chan struct{}
+	done  chan struct{}
+}
+
+// openRunJournal opens the journal of an output. A new run starts an empty
+// journal, recording the SHA-256 of its input file (inputHash, empty when the
+// input is not a local file); a resumed run keeps the rows of the previous
+// one, which must have had the same input columns and generated columns.
+func openRunJournal(outputFile string, headers []string, columnSpecs []ColumnSpec, inputHash string, resume bool) (*runJournal, error) {
+	file := outputFile + journalSuffix
+	if !resume {
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	db, err := openSQLite(file, true)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+
+	j := &runJournal{
+		file:    file,
+		db:      db,
+		headers: headers,
+		columns: make([]int, len(headers)),
+		resumed: make(map[int]journalRow),
+		input:   inputHash,
+		pending: make(map[int]journalRow),
+		wake:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+	for i := range j.columns {
+		j.columns[i] = i
+	}
+	if err := j.init(columnSpecs); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error opening run journal %s: %v", file, err)
+	}
+	go j.run()
+	return j, nil
+}
+
+// init creates the tables and checks or records what the run generates. The
+// rows of a resumed journal are loaded.
+func (j *runJournal) init(columnSpecs []ColumnSpec) error {
+	if _, err := j.db.Exec(`CREATE TABLE IF NOT EXISTS meta (key TEXT PRIMARY KEY, value TEXT NOT NULL);
+CREATE TABLE IF NOT EXISTS rows (
+	row INTEGER PRIMARY KEY,
+	hash TEXT NOT NULL,
+	status TEXT NOT NULL,
+	results TEXT NOT NULL,
+	tokens INTEGER NOT NULL,
+	error TEXT NOT NULL,
+	updated_at TEXT NOT NULL,
+	error_class TEXT NOT NULL DEFAULT '',
+	attempts INTEGER NOT NULL DEFAULT 0
+)`); err != nil {
+		return err
+	}
+	if err := j.addColumns(); err != nil {
+		return err
+	}
+
+	names := make([]string, len(columnSpecs))
+	for i, spec := range columnSpecs {
+		names[i] = spec.Name
+	}
+	meta := map[string][]string{"headers": j.headers, "columns": names}
+	for key, want := range meta {
+		var value string
+		err := j.db.QueryRow("SELECT value FROM meta WHERE key = ?", key).Scan(&value)
+		if err == sql.ErrNoRows {
+			encoded, _ := json.Marshal(want)
+			if _, err := j.db.Exec("INSERT INTO meta (key, value) VALUES (?, ?)", key, string(encoded)); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		var got []string
+		if err := json.Unmarshal([]byte(value), &got); err != nil || !slices.Equal(got, want) {
+			return fmt.Errorf("it was written for other %s (%v); run without -resume to start over", key, got)
+		}
+	}
+
+	// The input hash is the one of the run that started the journal
+	err := j.db.QueryRow("SELECT value FROM meta WHERE key = 'input_sha256'").Scan(&j.input)
+	if err == sql.ErrNoRows {
+		_, err = j.db.Exec("INSERT INTO meta (key, value) VALUES ('input_sha256', ?)", j.input)
+	}
+	if err != nil {
+		return err
+	}
+
+	rows, err := j.db.Query("SELECT row, hash, status, results, tokens, error, error_class, attempts FROM rows")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var row journalRow
+		var results string
+		if err := rows.Scan(&row.Row, &row.Hash, &row.Status, &results, &row.Tokens, &row.Error, &row.ErrorClass, &row.Attempts); err != nil {
+			return err
+		}
+		if err := json.Unmarshal([]byte(results), &row.Results); err != nil {
+			return err
+		}
+		j.resumed[row.Row] = row
+	}
+	return rows.Err()
+}
+
+// addColumns adds the columns that journals written by older versions lack
+func (j *runJournal) addColumns() error {
+	rows, err := j.db.Query("SELECT name FROM pragma_table_info('rows')")
+	if err != nil {
+		return err
+	}
+	existing := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return err
+		}
+		existing[name] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, column := range []string{"error_class TEXT NOT NULL DEFAULT ''", "attempts INTEGER NOT NULL DEFAULT 0"} {
+		name, _, _ := strings.Cut(column, " ")
+		if existing[name] {
+			continue
+		}
+		if _, err := j.db.Exec("ALTER TABLE rows ADD COLUMN " + column); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkInput refuses to resume from an input file other than the one the
+// journal was started from. Results are matched to rows by position, so an
+// edited, reordered or shortened input would silently misalign them. Inputs
+// without a known hash fall back to the per-row hashes of finished.
+func (j *runJournal) checkInput(inputHash string, rows [][]string) error {
+	if j.input == "" || inputHash == "" || j.input == inputHash {
+		return nil
+	}
+	changed := 0
+	for index, row := range j.resumed {
+		if index >= len(rows) || hashRow(rows[index], j.columns) != row.Hash {
+			changed++
+		}
+	}
+	return fmt.Errorf("the input file changed since the run started (SHA-256 %.12s..., now %.12s...; %d of %d journaled rows differ); run without -resume to start over", j.input, inputHash, changed, len(j.resumed))
+}
+
+// finished returns the generated values of a row that an earlier run
+// completed, when the row's input is unchanged. Failed rows are processed
+// again.
+func (j *runJournal) finished(index int, input []string) (map[string]string, bool) {
+	if j == nil {
+		return nil, false
+	}
+	row, ok := j.resumed[index]
+	if !ok || row.Status != journalDone || row.Hash != hashRow(input, j.columns) {
+		return nil, false
+	}
+	return row.Results, true
+}
+
+// add records a finished row for the next save
+func (j *runJournal) add(row journalRow) {
+	j.mu.Lock()
+	j.pending[row.Row] = row
+	j.mu.Unlock()
+}
+
+// save asks for the finished rows to be written without waiting. A request
+// made while a save is running starts another save once it is done.
+func (j *runJournal) save() {
+	select {
+	case j.wake <- struct{}{}:
+	default:
+	}
+}
+
+// takeError returns the first failed save since the last call, if any
+func (j *runJournal) takeError() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	err := j.err
+	j.err = nil
+	return err
+}
+
+// close writes the rows finished since the last save and closes the journal
+func (j *runJournal) close() error {
+	if j == nil {
+		return nil
+	}
+	j.save()
+	close(j.wake)
+	<-j.done
+	err := j.takeError()
+	if closeErr := j.db.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func (j *runJournal) run() {
+	defer close(j.done)
+	for range j.wake {
+		j.mu.Lock()
+		pending := j.pending
+		j.pending = make(map[int]journalRow)
+		j.mu.Unlock()
+		if len(pending) == 0 {
+			continue
+		}
+
+		if err := j.write(pending); err != nil {
+			j.mu.Lock()
+			if j.err == nil {
+				j.err = err
+			}
+			// Keep the rows for the next save
+			for index, row := range pending {
+				if _, ok := j.pending[index]; !ok {
+					j.pending[index] = row
+				}
+			}
+			j.mu.Unlock()
+			continue
+		}
+		atomic.AddInt64(&j.saves, 1)
+	}
+}
+
+// write stores rows in one transaction
+func (j *runJournal) write(rows map[int]journalRow) error {
+	tx, err := j.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	insert, err := tx.Prepare("INSERT OR REPLACE INTO rows (row, hash, status, results, tokens, error, updated_at, error_class, attempts) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	defer insert.Close()
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	for _, row := range rows {
+		results, err := json.Marshal(row.Results)
+		if err != nil {
+			return err
+		}
+		if _, err := insert.Exec(row.Row, hashRow(row.Input, j.columns), row.Status, string(results), row.Tokens, row.Error, now, row.ErrorClass, row.Attempts); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,253 @@
+package tools
+
+import (
+	"flag"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"ai-general-tool/common"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// cleanTransform rewrites a cell value
+type cleanTransform func(value string, locale common.Locale) string
+
+// cleanTransforms lists the transforms of the clean command by name
+var cleanTransforms = map[string]cleanTransform{
+	"trim":            func(v string, _ common.Locale) string { return strings.TrimSpace(v) },
+	"collapse-spaces": collapseSpaces,
+	"unicode":         normalizeUnicode,
+	"strip-accents":   stripAccents,
+	"lower":           func(v string, _ common.Locale) string { return strings.ToLower(v) },
+	"upper":           func(v string, _ common.Locale) string { return strings.ToUpper(v) },
+	"title":           titleCase,
+	"sentence":        sentenceCase,
+	"iso-dates":       isoDate,
+	"strip-currency":  stripCurrency,
+	"nulls":           emptyNulls,
+}
+
+// cleanTransformOrder lists the transforms in help order
+var cleanTransformOrder = []string{"trim", "collapse-spaces", "unicode", "strip-accents", "lower", "upper", "title", "sentence", "iso-dates", "strip-currency", "nulls"}
+
+// spaceRun matches runs of spaces and tabs; line breaks are kept
+var spaceRun = regexp.MustCompile(`[ \t\x{00A0}]{2,}`)
+
+// unicodeReplacer maps typographic characters to their plain forms and
+// drops invisible ones
+var unicodeReplacer = strings.NewReplacer(
+	"\u00a0", " ", "\u2007", " ", "\u202f", " ",
+	"\u2018", "'", "\u2019", "'", "\u201a", "'", "\u201c", "\"", "\u201d", "\"", "\u201e", "\"",
+	"\u200b", "", "\u200c", "", "\u200d", "", "\ufeff", "",
+)
+
+// nullSpellings are the placeholders the nulls transform empties
+var nullSpellings = map[string]bool{"null": true, "nil": true, "none": true, "n/a": true, "na": true, "#n/a": true, "-": true, "--": true, "?": true, "nan": true}
+
+// RunClean handles the clean command: it applies deterministic local fixes
+// (whitespace, casing, unicode, dates, currency) to columns, without API
+// calls
+func RunClean(args []string) error {
+	fs := flag.NewFlagSet("clean", flag.ExitOnError)
+
+	// Define flags
+	inputFile := fs.String("input", "", "Input file (CSV, Excel or JSON)")
+	transforms := fs.String("transforms", "trim,collapse-spaces,unicode", "Comma-separated transforms applied in order: "+strings.Join(cleanTransformOrder, ", "))
+	columns := fs.String("columns", "", "Comma-separated columns to clean (default: all)")
+	dryRun := fs.Bool("dry-run", false, "Only report what would change")
+	examples := fs.Int("examples", 3, "Example changes per column and transform in the report")
+	outputFile := fs.String("output", "", "Output file (default: <input>_cleaned)")
+	fs.StringVar(outputFile, "o", "", "Shorthand for -output")
+	input := inputFlags(fs)
+	output := &OutputOptions{}
+	fs.StringVar(&output.Format, "format", "same", "Output format: same, csv, sqlite, ods, md (Markdown table), html")
+	fs.BoolVar(&output.QuoteAll, "quote-all", false, "Quote every field of CSV output")
+	var locale common.Locale
+	localeFlag(fs, &locale)
+
+	// Parse flags
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	// Handle positional argument for filename
+	if *inputFile == "" && fs.NArg() > 0 {
+		*inputFile = fs.Arg(0)
+	}
+
+	// Validation
+	if *inputFile == "" {
+		return fmt.Errorf("input file is required")
+	}
+	var names []string
+	for _, name := range strings.Split(*transforms, ",") {
+		name = strings.TrimSpace(name)
+		if _, ok := cleanTransforms[name]; !ok {
+			return fmt.Errorf("unknown transform '%s' (use %s)", name, strings.Join(cleanTransformOrder, ", "))
+		}
+		names = append(names, name)
+	}
+	toStdout, err := useStdout(*inputFile, outputFile, *output)
+	if err != nil {
+		return err
+	}
+	if *outputFile == "" && !*dryRun {
+		*outputFile = suffixedOutputFile(*inputFile, output.Format, "_cleaned")
+	}
+	if *outputFile == *inputFile && *inputFile != stdioName {
+		return fmt.Errorf("output would overwrite the input %s", *inputFile)
+	}
+
+	fmt.Printf("Loading %s...\n", *inputFile)
+	headers, rows, err := loadInputFile(*inputFile, *input)
+	if err != nil {
+		return fmt.Errorf("error loading input: %v", err)
+	}
+	indexes, err := columnIndexes(headers, *columns)
+	if err != nil {
+		return err
+	}
+
+	// Count the cells each transform changes, per column
+	type change struct {
+		column, transform string
+		count             int
+		examples          []string
+	}
+	var changes []*change
+	byKey := make(map[string]*change)
+	changedCells := 0
+	cleaned := make([][]string, len(rows))
+	for r, row := range rows {
+		cleaned[r] = padRow(row, len(headers))
+		for _, index := range indexes {
+			value := cleaned[r][index]
+			for _, name := range names {
+				next := cleanTransforms[name](value, locale)
+				if next == value {
+					continue
+				}
+				key := headers[index] + "\x00" + name
+				c, ok := byKey[key]
+				if !ok {
+					c = &change{column: headers[index], transform: name}
+					byKey[key] = c
+					changes = append(changes, c)
+				}
+				c.count++
+				if len(c.examples) < *examples {
+					c.examples = append(c.examples, fmt.Sprintf("%q -> %q", common.TruncateString(value, 25), common.TruncateString(next, 25)))
+				}
+				value = next
+			}
+			if value != cleaned[r][index] {
+				changedCells++
+				cleaned[r][index] = value
+			}
+		}
+	}
+
+	fmt.Printf("\n=== CLEAN: %s ===\n", strings.Join(names, ", "))
+	fmt.Printf("Rows: %d | Columns cleaned: %d | Cells changed: %d\n", len(rows), len(indexes), changedCells)
+	if len(changes) > 0 {
+		slices.SortStableFunc(changes, func(a, b *change) int { return indexOf(headers, a.column) - indexOf(headers, b.column) })
+		var table [][]string
+		for _, c := range changes {
+			table = append(table, []string{c.column, c.transform, strconv.Itoa(c.count), strings.Join(c.examples, ", ")})
+		}
+		fmt.Println(common.FormatTable([]string{"Column", "Transform", "Changed", "Examples"}, table, 200))
+	}
+	if *dryRun {
+		return nil
+	}
+
+	if err := saveOutputTable(*outputFile, headers, cleaned, nil, *output); err != nil {
+		return fmt.Errorf("error saving output: %v", err)
+	}
+	if !toStdout {
+		fmt.Printf("Output saved to: %s\n", *outputFile)
+	}
+	return nil
+}
+
+// collapseSpaces replaces runs of spaces and tabs inside a value with one
+// space
+func collapseSpaces(value string, _ common.Locale) string {
+	return spaceRun.ReplaceAllString(value, " ")
+}
+
+// normalizeUnicode composes characters (NFC), so "e" plus a combining accent
+// becomes "é", and replaces non-breaking spaces, smart quotes and invisible
+// characters
+func normalizeUnicode(value string, _ common.Locale) string {
+	return unicodeReplacer.Replace(norm.NFC.String(value))
+}
+
+// stripAccents removes diacritics: "Zoë Müller" becomes "Zoe Muller"
+func stripAccents(value string, _ common.Locale) string {
+	var b strings.Builder
+	for _, r := range norm.NFD.String(value) {
+		if !unicode.Is(unicode.Mn, r) {
+			b.WriteRune(r)
+		}
+	}
+	return norm.NFC.String(b.String())
+}
+
+// titleCase capitalizes the first letter of each word and lowers the rest
+func titleCase(value string, _ common.Locale) string {
+	runes := []rune(strings.ToLower(value))
+	for i, r := range runes {
+		if i == 0 || unicode.IsSpace(runes[i-1]) || runes[i-1] == '-' || runes[i-1] == '(' {
+			runes[i] = unicode.ToUpper(r)
+		}
+	}
+	return string(runes)
+}
+
+// sentenceCase capitalizes the first letter and lowers the rest
+func sentenceCase(value string, _ common.Locale) string {
+	runes := []rune(strings.ToLower(value))
+	for i, r := range runes {
+		if unicode.IsLetter(r) {
+			runes[i] = unicode.ToUpper(r)
+			break
+		}
+	}
+	return string(runes)
+}
+
+// isoDate rewrites a date as 2006-01-02, or 2006-01-02 15:04:05 when it has
+// a time. Ambiguous dates such as 03/04/2024 are read as -locale says.
+func isoDate(value string, locale common.Locale) string {
+	date, ok := common.ParseDate(value, locale)
+	if !ok {
+		return value
+	}
+	if date.Hour() == 0 && date.Minute() == 0 && date.Second() == 0 {
+		return date.Format("2006-01-02")
+	}
+	return date.Format("2006-01-02 15:04:05")
+}
+
+// stripCurrency rewrites an amount with a currency symbol or code as a plain
+// number: "$1,234.50" becomes 1234.5
+func stripCurrency(value string, locale common.Locale) string {
+	if amount, ok := common.ParseCurrency(value, locale); ok {
+		return strconv.FormatFloat(amount, 'f', -1, 64)
+	}
+	return value
+}
+
+// emptyNulls empties placeholders for missing values such as N/A or null
+func emptyNulls(value string, _ common.Locale) string {
+	if nullSpellings[strings.ToLower(strings.TrimSpace(value))] {
+		return ""
+	}
+	return value
+}
@@ -0,0 +1,250 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"golang.org/x/oauth2/google"
+)
+
+// Cloud objects are written as s3://bucket/key, gs://bucket/object or
+// az://container/blob. Inputs are downloaded to a temporary file and outputs
+// are written locally, then uploaded. Credentials come from each provider's
+// standard chain (environment, shared config files, instance metadata).
+const gcsScope = "https://www.googleapis.com/auth/devstorage.read_write"
+
+// cloudStore moves objects between a storage service and local files
+type cloudStore interface {
+	Download(ctx context.Context, bucket, key string, file *os.File) error
+	Upload(ctx context.Context, bucket, key string, file *os.File) error
+}
+
+// cloudStores maps URI schemes to store constructors
+var cloudStores = map[string]func(ctx context.Context) (cloudStore, error){
+	"s3": newS3Store,
+	"gs": newGCSStore,
+	"az": newAzureStore,
+}
+
+// isCloudURI reports whether a name refers to a cloud object
+func isCloudURI(name string) bool {
+	scheme, _, found := strings.Cut(name, "://")
+	return found && cloudStores[scheme] != nil
+}
+
+// parseCloudURI splits a cloud URI into its store, bucket and key
+func parseCloudURI(ctx context.Context, uri string) (cloudStore, string, string, error) {
+	scheme, rest, _ := strings.Cut(uri, "://")
+	bucket, key, _ := strings.Cut(rest, "/")
+	if bucket == "" || key == "" {
+		return nil, "", "", fmt.Errorf("invalid object URI '%s' (use %s://bucket/path)", uri, scheme)
+	}
+	store, err := cloudStores[scheme](ctx)
+	if err != nil {
+		return nil, "", "", fmt.Errorf("%s credentials: %v", scheme, err)
+	}
+	return store, bucket, key, nil
+}
+
+// stagingFile creates an empty temporary file with the object's base name, so
+// the extension still selects the format. remove deletes it.
+func stagingFile(uri string) (string, func(), error) {
+	dir, err := os.MkdirTemp("", "aitool-")
+	if err != nil {
+		return "", nil, err
+	}
+	return filepath.Join(dir, path.Base(uri)), func() { os.RemoveAll(dir) }, nil
+}
+
+// loadCloudInput downloads an object and loads it like a local file
+func loadCloudInput(uri string, opts InputOptions) ([]string, [][]string, error) {
+	ctx := context.Background()
+	store, bucket, key, err := parseCloudURI(ctx, uri)
+	if err != nil {
+		return nil, nil, err
+	}
+	local, remove, err := stagingFile(uri)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer remove()
+
+	file, err := os.Create(local)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = store.Download(ctx, bucket, key, file)
+	file.Close()
+	if err != nil {
+		return nil, nil, fmt.Errorf("error downloading %s: %v", uri, err)
+	}
+	return loadInputFile(local, opts)
+}
+
+// saveCloudOutput writes an output through a local staging file and uploads it
+func saveCloudOutput(uri string, write func(local string) error) error {
+	ctx := context.Background()
+	store, bucket, key, err := parseCloudURI(ctx, uri)
+	if err != nil {
+		return err
+	}
+	local, remove, err := stagingFile(uri)
+	if err != nil {
+		return err
+	}
+	defer remove()
+
+	if err := write(local); err != nil {
+		return err
+	}
+	file, err := os.Open(local)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if err := store.Upload(ctx, bucket, key, file); err != nil {
+		return fmt.Errorf("error uploading %s: %v", uri, err)
+	}
+	return nil
+}
+
+// s3Store uses the AWS default credential chain and region
+type s3Store struct {
+	client *s3.Client
+}
+
+func newS3Store(ctx context.Context) (cloudStore, error) {
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	return &s3Store{client: s3.NewFromConfig(cfg)}, nil
+}
+
+func (s *s3Store) Download(ctx context.Context, bucket, key string, file *os.File) error {
+	_, err := manager.NewDownloader(s.client).Download(ctx, file, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	return err
+}
+
+func (s *s3Store) Upload(ctx context.Context, bucket, key string, file *os.File) error {
+	_, err := manager.NewUploader(s.client).Upload(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+		Body:   file,
+	})
+	return err
+}
+
+// gcsStore calls the Cloud Storage JSON API with Application Default
+// Credentials
+type gcsStore struct {
+	client *http.Client
+}
+
+func newGCSStore(ctx context.Context) (cloudStore, error) {
+	client, err := google.DefaultClient(ctx, gcsScope)
+	if err != nil {
+		return nil, err
+	}
+	return &gcsStore{client: client}, nil
+}
+
+func (g *gcsStore) Download(ctx context.Context, bucket, key string, file *os.File) error {
+	endpoint := fmt.Sprintf("https://storage.googleapis.com/storage/v1/b/%s/o/%s?alt=media", url.PathEscape(bucket), url.PathEscape(key))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	_, err = io.Copy(file, resp.Body)
+	return err
+}
+
+func (g *gcsStore) Upload(ctx context.Context, bucket, key string, file *os.File) error {
+	endpoint := fmt.Sprintf("https://storage.googleapis.com/upload/storage/v1/b/%s/o?uploadType=media&name=%s", url.PathEscape(bucket), url.QueryEscape(key))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, file)
+	if err != nil {
+		return err
+	}
+	if info, err := file.Stat(); err == nil {
+		req.ContentLength = info.Size()
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// azureStore uses AZURE_STORAGE_CONNECTION_STRING, or the storage account in
+// AZURE_STORAGE_ACCOUNT with the default Azure credential chain
+type azureStore struct {
+	client *azblob.Client
+}
+
+func newAzureStore(ctx context.Context) (cloudStore, error) {
+	if connection := os.Getenv("AZURE_STORAGE_CONNECTION_STRING"); connection != "" {
+		client, err := azblob.NewClientFromConnectionString(connection, nil)
+		if err != nil {
+			return nil, err
+		}
+		return &azureStore{client: client}, nil
+	}
+
+	account := os.Getenv("AZURE_STORAGE_ACCOUNT")
+	if account == "" {
+		return nil, fmt.Errorf("AZURE_STORAGE_ACCOUNT or AZURE_STORAGE_CONNECTION_STRING must be set")
+	}
+	credential, err := azidentity.NewDefaultAzureCredential(nil)
+	if err != nil {
+		return nil, err
+	}
+	client, err := azblob.NewClient(fmt.Sprintf("https://%s.blob.core.windows.net/", account), credential, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &azureStore{client: client}, nil
+}
+
+func (a *azureStore) Download(ctx context.Context, container, blob string, file *os.File) error {
+	_, err := a.client.DownloadFile(ctx, container, blob, file, nil)
+	return err
+}
+
+func (a *azureStore) Upload(ctx context.Context, container, blob string, file *os.File) error {
+	_, err := a.client.UploadFile(ctx, container, blob, file, nil)
+	return err
+}
@@ -0,0 +1,195 @@
+package tools
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"slices"
+
+	"ai-general-tool/common"
+)
+
+// analysisSampleRows is the number of rows the column analysis of read-csv and
+// read-excel looks at without -full-scan. Bigger inputs are analyzed on a
+// uniform random sample of this many rows.
+const analysisSampleRows = 10000
+
+// columnAnalysis analyzes the columns of an input one row at a time. A full
+// scan counts unique values and nulls over every row, which keeps every
+// distinct value in memory; otherwise the analysis is run on a reservoir
+// sample of analysisSampleRows rows and the counts are estimates.
+type columnAnalysis struct {
+	full   bool
+	scans  []columnScan
+	sample rowSampler
+	first  [][]string // first unique values of each column, kept when sampling
+}
+
+func newColumnAnalysis(columns int, full bool, locale common.Locale) *columnAnalysis {
+	a := &columnAnalysis{
+		full:   full,
+		scans:  make([]columnScan, columns),
+		sample: rowSampler{count: analysisSampleRows, random: true},
+		first:  make([][]string, columns),
+	}
+	for i := range a.scans {
+		a.scans[i].types.Locale = locale
+	}
+	return a
+}
+
+// localeFlag registers -locale, how the numbers and dates of an input are
+// written
+func localeFlag(fs *flag.FlagSet, locale *common.Locale) {
+	fs.Func("locale", "Number and date conventions of the input: auto (default: any), en, us, uk, de, nl, it, es, pt, fr or ch, e.g. de for 1.234,56 and 31.12.2024", func(value string) error {
+		var err error
+		*locale, err = common.ParseLocale(value)
+		return err
+	})
+}
+
+// add analyzes a data row; missing cells count as empty
+func (a *columnAnalysis) add(row []string) {
+	if !a.full {
+		a.sample.add(row)
+		for i, values := range a.first {
+			if value := cell(row, i); len(values) < 5 && !slices.Contains(values, value) {
+				a.first[i] = append(values, value)
+			}
+		}
+		return
+	}
+	for i := range a.scans {
+		a.scans[i].add(cell(row, i))
+	}
+}
+
+// columns returns the analysis of every column and the number of rows it is
+// based on when sampled, 0 when every row was analyzed. Sampled null counts
+// are scaled to the whole input; sampled unique counts are the distinct
+// values of the sample, a lower bound. Sample values are the first unique
+// values either way.
+func (a *columnAnalysis) columns(headers []string) ([]common.ColumnInfo, int) {
+	sampled := 0
+	if !a.full {
+		for _, row := range a.sample.rows {
+			for i := range a.scans {
+				a.scans[i].add(cell(row, i))
+			}
+		}
+		if a.sample.seen > len(a.sample.rows) {
+			sampled = len(a.sample.rows)
+		}
+	}
+
+	columns := make([]common.ColumnInfo, len(headers))
+	for i, header := range headers {
+		columns[i] = a.scans[i].info(i, header)
+		if sampled > 0 {
+			columns[i].NullCount = int(float64(columns[i].NullCount)*float64(a.sample.seen)/float64(sampled) + 0.5)
+			columns[i].TotalCount = a.sample.seen
+		}
+		if !a.full {
+			columns[i].SampleValues = truncateValues(a.first[i])
+		}
+	}
+	return columns, sampled
+}
+
+// cell returns a cell of a row, or "" past its end
+func cell(row []string, i int) string {
+	if i < len(row) {
+		return row[i]
+	}
+	return ""
+}
+
+// analysisCounts formats the unique and null counts of a column for the
+// column analysis table, marking the estimates of a sampled analysis
+func analysisCounts(preview *common.DataPreview, col common.ColumnInfo) (string, string) {
+	nulls := fmt.Sprintf("%d (%s)", col.NullCount, common.FormatPercentage(col.NullCount, col.TotalCount))
+	if preview.AnalyzedRows == 0 {
+		return fmt.Sprintf("%d", col.UniqueCount), nulls
+	}
+	return fmt.Sprintf("%d+", col.UniqueCount), "~" + nulls
+}
+
+// analysisNote explains a sampled column analysis, or returns "" when every
+// row was analyzed
+func analysisNote(preview *common.DataPreview) string {
+	if preview.AnalyzedRows == 0 {
+		return ""
+	}
+	return fmt.Sprintf("Column analysis uses a random sample of %d of %d rows: null counts (~) are estimates, unique counts (+) are those seen in the sample and may be higher. Use -full-scan for exact counts.",
+		preview.AnalyzedRows, preview.TotalRows)
+}
+
+// columnScan analyzes a column one value at a time, so an input is never held
+// in memory as a whole
+type columnScan struct {
+	types  common.TypeCounter
+	seen   map[string]bool
+	unique []string // first unique values, shown as samples
+	nulls  int
+	total  int
+}
+
+func (c *columnScan) add(value string) {
+	c.total++
+	c.types.Add(value)
+	if common.IsNull(value) {
+		c.nulls++
+	}
+	if c.seen == nil {
+		c.seen = make(map[string]bool)
+	}
+	if !c.seen[value] {
+		c.seen[value] = true
+		if len(c.unique) < 5 {
+			c.unique = append(c.unique, value)
+		}
+	}
+}
+
+// info returns the analysis of the values added so far
+func (c *columnScan) info(index int, name string) common.ColumnInfo {
+	return common.ColumnInfo{
+		Index:        index,
+		Name:         name,
+		DataType:     c.types.Type(),
+		UniqueCount:  len(c.seen),
+		NullCount:    c.nulls,
+		TotalCount:   c.total,
+		SampleValues: truncateValues(c.unique),
+	}
+}
+
+// truncateValues shortens sample values for display
+func truncateValues(values []string) []string {
+	truncated := make([]string, len(values))
+	for i, value := range values {
+		truncated[i] = common.TruncateString(value, 15)
+	}
+	return truncated
+}
+
+// rowSampler keeps a selection of rows while an input is read: the first
+// count rows, or a uniform random sample of count rows (reservoir sampling)
+type rowSampler struct {
+	count  int
+	random bool
+	seen   int
+	rows   [][]string
+}
+
+func (s *rowSampler) add(row []string) {
+	s.seen++
+	switch {
+	case len(s.rows) < s.count:
+		s.rows = append(s.rows, row)
+	case s.random && s.count > 0:
+		if i := rand.Intn(s.seen); i < s.count {
+			s.rows[i] = row
+		}
+	}
+}
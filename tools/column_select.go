@@ -0,0 +1,126 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"ai-general-tool/common"
+
+	"github.com/openai/openai-go"
+)
+
+const (
+	columnSelectDefaultMax = 20 // columns kept by -input-columns auto
+	columnSelectSamples    = 3  // example values describing a column
+)
+
+// selectInputColumns resolves -input-columns to the input columns sent to the
+// model: a comma-separated list, or "auto" to keep the maxColumns columns most
+// relevant to the prompt. Columns named in the prompt are kept first, the rest
+// are ranked by embedding similarity between the prompt and the column name
+// with example values. Returns the kept columns and the embedding tokens used.
+func selectInputColumns(ctx context.Context, client *openai.Client, spec string, maxColumns int, prompt string, headers []string, rows [][]string) ([]string, int64, error) {
+	if spec != "auto" {
+		var selected []string
+		for _, name := range strings.Split(spec, ",") {
+			name = strings.TrimSpace(name)
+			if indexOf(headers, name) == -1 {
+				return nil, 0, fmt.Errorf("input column '%s' not found", name)
+			}
+			selected = append(selected, name)
+		}
+		return selected, 0, nil
+	}
+
+	if maxColumns <= 0 {
+		return nil, 0, fmt.Errorf("-max-input-columns must be positive")
+	}
+	if len(headers) <= maxColumns {
+		return headers, 0, nil
+	}
+
+	// Describe every column by its name and a few example values
+	descriptions := make([]string, len(headers))
+	for c, header := range headers {
+		var examples []string
+		seen := make(map[string]bool)
+		for _, row := range rows {
+			if c >= len(row) {
+				continue
+			}
+			value := strings.TrimSpace(row[c])
+			if value == "" || seen[value] {
+				continue
+			}
+			seen[value] = true
+			examples = append(examples, common.TruncateString(value, 40))
+			if len(examples) == columnSelectSamples {
+				break
+			}
+		}
+		descriptions[c] = fmt.Sprintf("%s: %s", header, strings.Join(examples, ", "))
+	}
+
+	texts := append([]string{prompt}, descriptions...)
+	var embeddings [][]float64
+	var tokens int64
+	for start := 0; start < len(texts); start += knowledgeEmbedBatch {
+		end := common.Min(start+knowledgeEmbedBatch, len(texts))
+		batch, batchTokens, err := embedTexts(ctx, client, texts[start:end])
+		if err != nil {
+			return nil, tokens, fmt.Errorf("error embedding columns: %v", err)
+		}
+		embeddings = append(embeddings, batch...)
+		tokens += batchTokens
+	}
+
+	promptWords := make(map[string]bool)
+	for _, word := range splitWords(prompt) {
+		promptWords[word] = true
+	}
+
+	type scored struct {
+		index   int
+		keyword bool
+		score   float64
+	}
+	scores := make([]scored, len(headers))
+	for c, header := range headers {
+		scores[c] = scored{index: c, score: cosineSimilarity(embeddings[0], embeddings[c+1])}
+		for _, word := range splitWords(header) {
+			if len(word) >= 3 && promptWords[word] {
+				scores[c].keyword = true
+				break
+			}
+		}
+	}
+	sort.SliceStable(scores, func(a, b int) bool {
+		if scores[a].keyword != scores[b].keyword {
+			return scores[a].keyword
+		}
+		return scores[a].score > scores[b].score
+	})
+
+	// Keep the selected columns in file order
+	keep := make([]bool, len(headers))
+	for _, s := range scores[:maxColumns] {
+		keep[s.index] = true
+	}
+	var selected []string
+	for c, header := range headers {
+		if keep[c] {
+			selected = append(selected, header)
+		}
+	}
+	return selected, tokens, nil
+}
+
+// splitWords lowercases text and splits it on anything but letters and digits
+func splitWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
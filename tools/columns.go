@@ -0,0 +1,195 @@
+package tools
+
+import (
+	"flag"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"ai-general-tool/common"
+)
+
+// columnsRest stands for the columns -keep does not name, so columns can be
+// moved without listing every other one
+const columnsRest = "*"
+
+// RunColumns handles the columns command: it selects, drops, reorders and
+// renames columns
+func RunColumns(args []string) error {
+	fs := flag.NewFlagSet("columns", flag.ExitOnError)
+
+	// Define flags
+	inputFile := fs.String("input", "", "Input file (CSV, Excel or JSON)")
+	keep := fs.String("keep", "", "Comma-separated columns to keep, in output order; * stands for the columns not listed, e.g. id,name,* moves id and name first")
+	drop := fs.String("drop", "", "Comma-separated columns to remove")
+	rename := fs.String("rename", "", "Comma-separated old:new pairs, e.g. email:contact_email")
+	list := fs.Bool("list", false, "Only list the columns with their position and an example value")
+	outputFile := fs.String("output", "", "Output file (default: <input>_columns)")
+	fs.StringVar(outputFile, "o", "", "Shorthand for -output")
+	input := inputFlags(fs)
+	output := &OutputOptions{}
+	fs.StringVar(&output.Format, "format", "same", "Output format: same, csv, sqlite, ods, md (Markdown table), html")
+	fs.BoolVar(&output.QuoteAll, "quote-all", false, "Quote every field of CSV output")
+
+	// Parse flags
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	// Handle positional argument for filename
+	if *inputFile == "" && fs.NArg() > 0 {
+		*inputFile = fs.Arg(0)
+	}
+
+	// Validation
+	if *inputFile == "" {
+		return fmt.Errorf("input file is required")
+	}
+	if !*list && *keep == "" && *drop == "" && *rename == "" {
+		return fmt.Errorf("one of -keep, -drop, -rename or -list is required")
+	}
+	toStdout, err := useStdout(*inputFile, outputFile, *output)
+	if err != nil {
+		return err
+	}
+	if *outputFile == "" && !*list {
+		*outputFile = suffixedOutputFile(*inputFile, output.Format, "_columns")
+	}
+	if *outputFile == *inputFile && *inputFile != stdioName {
+		return fmt.Errorf("output would overwrite the input %s", *inputFile)
+	}
+
+	fmt.Printf("Loading %s...\n", *inputFile)
+	headers, rows, err := loadInputFile(*inputFile, *input)
+	if err != nil {
+		return fmt.Errorf("error loading input: %v", err)
+	}
+	if *list {
+		printColumnList(headers, rows)
+		return nil
+	}
+
+	indexes, err := selectColumns(headers, *keep, *drop)
+	if err != nil {
+		return err
+	}
+	names := make([]string, len(indexes))
+	for i, index := range indexes {
+		names[i] = headers[index]
+	}
+	if names, err = renameColumns(names, *rename); err != nil {
+		return err
+	}
+	out := make([][]string, len(rows))
+	for r, row := range rows {
+		out[r] = make([]string, len(indexes))
+		for i, index := range indexes {
+			out[r][i] = cell(row, index)
+		}
+	}
+	fmt.Printf("Columns: %d -> %d\n", len(headers), len(names))
+
+	if err := saveOutputTable(*outputFile, names, out, nil, *output); err != nil {
+		return fmt.Errorf("error saving output: %v", err)
+	}
+	if !toStdout {
+		fmt.Printf("Output saved to: %s\n", *outputFile)
+	}
+	return nil
+}
+
+// selectColumns returns the columns of the output in order: those of -keep,
+// or every column, less those of -drop
+func selectColumns(headers []string, keep, drop string) ([]int, error) {
+	var indexes []int
+	if strings.TrimSpace(keep) == "" {
+		for i := range headers {
+			indexes = append(indexes, i)
+		}
+	} else {
+		names := strings.Split(keep, ",")
+		var named []int
+		for _, name := range names {
+			name = strings.TrimSpace(name)
+			if name == columnsRest {
+				continue
+			}
+			index := indexOf(headers, name)
+			if index == -1 {
+				return nil, fmt.Errorf("column '%s' not found", name)
+			}
+			if slices.Contains(named, index) {
+				return nil, fmt.Errorf("column '%s' is listed twice in -keep", name)
+			}
+			named = append(named, index)
+		}
+		for _, name := range names {
+			if strings.TrimSpace(name) != columnsRest {
+				indexes = append(indexes, indexOf(headers, strings.TrimSpace(name)))
+				continue
+			}
+			for i := range headers {
+				if !slices.Contains(named, i) {
+					indexes = append(indexes, i)
+				}
+			}
+		}
+	}
+
+	if strings.TrimSpace(drop) != "" {
+		dropped, err := columnIndexes(headers, drop)
+		if err != nil {
+			return nil, err
+		}
+		indexes = slices.DeleteFunc(indexes, func(i int) bool { return slices.Contains(dropped, i) })
+	}
+	if len(indexes) == 0 {
+		return nil, fmt.Errorf("no columns left")
+	}
+	return indexes, nil
+}
+
+// renameColumns applies -rename to the output headers
+func renameColumns(headers []string, rename string) ([]string, error) {
+	if strings.TrimSpace(rename) == "" {
+		return headers, nil
+	}
+	renamed := append([]string{}, headers...)
+	for _, pair := range strings.Split(rename, ",") {
+		old, name, ok := strings.Cut(pair, ":")
+		old, name = strings.TrimSpace(old), strings.TrimSpace(name)
+		if !ok || old == "" || name == "" {
+			return nil, fmt.Errorf("invalid rename '%s' (use old:new)", strings.TrimSpace(pair))
+		}
+		index := indexOf(headers, old)
+		if index == -1 {
+			return nil, fmt.Errorf("column '%s' to rename is not in the output", old)
+		}
+		renamed[index] = name
+	}
+	for i, name := range renamed {
+		if indexOf(renamed, name) != i {
+			return nil, fmt.Errorf("column '%s' would appear twice", name)
+		}
+	}
+	return renamed, nil
+}
+
+// printColumnList prints each column with its position and first non-empty
+// value, to pick the names for -keep, -drop and -rename
+func printColumnList(headers []string, rows [][]string) {
+	var table [][]string
+	for i, header := range headers {
+		example := ""
+		for _, row := range rows {
+			if value := cell(row, i); !common.IsNull(value) {
+				example = value
+				break
+			}
+		}
+		table = append(table, []string{strconv.Itoa(i + 1), header, example})
+	}
+	fmt.Printf("\n%d columns, %d rows\n", len(headers), len(rows))
+	fmt.Println(common.FormatTable([]string{"#", "Column", "Example"}, table, 120))
+}
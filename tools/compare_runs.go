@@ -0,0 +1,383 @@
+package tools
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"ai-general-tool/common"
+)
+
+// runPair is an enriched file of run A and the file of run B it is
+// compared with
+type runPair struct {
+	Name string // file name shown when comparing directories
+	A, B string
+}
+
+// runColumnStats counts the differences of one compared column
+type runColumnStats struct {
+	Name             string
+	Compared         int // matched rows where both runs have a value
+	Changed          int
+	ErrorsA, ErrorsB int
+	Examples         [][]string // key, value in A, value in B
+}
+
+// RunCompareRuns handles the compare-runs command: it compares the outputs
+// of two enrichment runs of the same input, e.g. before and after a model
+// upgrade or a prompt edit, column by column, with their cost
+func RunCompareRuns(args []string) error {
+	fs := flag.NewFlagSet("compare-runs", flag.ExitOnError)
+
+	// Define flags
+	key := fs.String("key", "", "Comma-separated columns matching the rows of both runs, e.g. id (default: row position)")
+	columns := fs.String("columns", "", "Columns to compare (default: the generated columns of the run sidecars)")
+	normalize := fs.Bool("normalize", false, "Ignore case and surrounding whitespace when comparing values")
+	examples := fs.Int("examples", 5, "Disagreements shown per column")
+	outputFile := fs.String("output", "", "Save every disagreement as a table (CSV, Excel, Markdown or HTML)")
+	input := inputFlags(fs)
+
+	// Parse flags
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		return fmt.Errorf("two runs are required: compare-runs [flags] <runA> <runB> (enriched files or directories of them)")
+	}
+
+	pairs, err := pairRuns(fs.Arg(0), fs.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	var disagreements [][]string
+	var costA, costB float64
+	for _, pair := range pairs {
+		infoA, infoB, rows, err := compareRunFiles(pair, *key, *columns, *normalize, *examples, *input)
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			if len(pairs) > 1 {
+				row = append([]string{pair.Name}, row...)
+			}
+			disagreements = append(disagreements, row)
+		}
+		if infoA != nil {
+			costA += infoA.EstimatedCost
+		}
+		if infoB != nil {
+			costB += infoB.EstimatedCost
+		}
+	}
+	if len(pairs) > 1 {
+		fmt.Printf("\nTotal over %d files: cost $%.4f -> $%.4f (%s)\n", len(pairs), costA, costB, costChange(costA, costB))
+	}
+
+	if *outputFile != "" {
+		headers := []string{"Key", "Column", "Run A", "Run B"}
+		if len(pairs) > 1 {
+			headers = append([]string{"File"}, headers...)
+		}
+		if err := saveOutputTable(*outputFile, headers, disagreements, nil, OutputOptions{Format: "same"}); err != nil {
+			return fmt.Errorf("error saving disagreements: %v", err)
+		}
+		fmt.Printf("%d disagreements saved to: %s\n", len(disagreements), *outputFile)
+	}
+	return nil
+}
+
+// pairRuns returns the files to compare. Two files are compared with each
+// other; two directories are compared file by file, pairing the enriched
+// files (those with a run sidecar) of the same name, or the only enriched
+// file of each.
+func pairRuns(a, b string) ([]runPair, error) {
+	dirA, dirB := isDirectory(a), isDirectory(b)
+	if dirA != dirB {
+		return nil, fmt.Errorf("compare two files or two directories, not a file with a directory")
+	}
+	if !dirA {
+		return []runPair{{Name: filepath.Base(b), A: a, B: b}}, nil
+	}
+
+	filesA, err := enrichedFiles(a)
+	if err != nil {
+		return nil, err
+	}
+	filesB, err := enrichedFiles(b)
+	if err != nil {
+		return nil, err
+	}
+	var pairs []runPair
+	var unmatched []string
+	for _, name := range filesA {
+		if indexOf(filesB, name) != -1 {
+			pairs = append(pairs, runPair{Name: name, A: filepath.Join(a, name), B: filepath.Join(b, name)})
+		} else {
+			unmatched = append(unmatched, name)
+		}
+	}
+	if len(pairs) == 0 && len(filesA) == 1 && len(filesB) == 1 {
+		return []runPair{{Name: filesB[0], A: filepath.Join(a, filesA[0]), B: filepath.Join(b, filesB[0])}}, nil
+	}
+	if len(pairs) == 0 {
+		return nil, fmt.Errorf("no enriched files of the same name in %s (%d files) and %s (%d files)", a, len(filesA), b, len(filesB))
+	}
+	for _, name := range filesB {
+		if indexOf(filesA, name) == -1 {
+			unmatched = append(unmatched, name)
+		}
+	}
+	if len(unmatched) > 0 {
+		fmt.Printf("Not in both runs, skipped: %s\n", strings.Join(unmatched, ", "))
+	}
+	return pairs, nil
+}
+
+// isDirectory reports whether a path is a local directory
+func isDirectory(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// enrichedFiles lists the files of a directory that have a run sidecar
+func enrichedFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), runInfoSuffix)
+		if !ok || entry.IsDir() {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// compareRunFiles prints the comparison of two enriched files and returns
+// their run sidecars, nil when missing, and the disagreements as rows of
+// key, column, value in A and value in B
+func compareRunFiles(pair runPair, key, columnSpec string, normalize bool, examples int, input InputOptions) (*RunInfo, *RunInfo, [][]string, error) {
+	infoA, err := readRunInfo(pair.A)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("error reading run info of %s: %v", pair.A, err)
+	}
+	infoB, err := readRunInfo(pair.B)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("error reading run info of %s: %v", pair.B, err)
+	}
+	headersA, rowsA, err := loadInputFile(pair.A, input)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("error loading %s: %v", pair.A, err)
+	}
+	headersB, rowsB, err := loadInputFile(pair.B, input)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("error loading %s: %v", pair.B, err)
+	}
+
+	names, err := comparedColumns(columnSpec, infoA, infoB, headersA, headersB, key)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	d, err := diffTables(headersA, rowsA, headersB, rowsB, key, normalize)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	same := func(a, b string) bool {
+		if normalize {
+			return strings.EqualFold(strings.TrimSpace(a), strings.TrimSpace(b))
+		}
+		return a == b
+	}
+	// Generated cells are errors in the rows the status column marks as
+	// failed
+	statusA, statusB := indexOf(headersA, statusColumn), indexOf(headersB, statusColumn)
+	failed := func(row []string, status int) bool {
+		return status != -1 && cell(row, status) == journalError
+	}
+
+	stats := make([]runColumnStats, len(names))
+	for i, name := range names {
+		stats[i].Name = name
+	}
+	var disagreements [][]string
+	matched := 0
+	for _, row := range d.rows {
+		if row.Old == -1 || row.New == -1 {
+			continue
+		}
+		matched++
+		for i, name := range names {
+			s := &stats[i]
+			a := cell(rowsA[row.Old], indexOf(headersA, name))
+			b := cell(rowsB[row.New], indexOf(headersB, name))
+			errA := failed(rowsA[row.Old], statusA)
+			errB := failed(rowsB[row.New], statusB)
+			if errA {
+				s.ErrorsA++
+			}
+			if errB {
+				s.ErrorsB++
+			}
+			if errA || errB {
+				continue
+			}
+			s.Compared++
+			if same(a, b) {
+				continue
+			}
+			s.Changed++
+			disagreements = append(disagreements, []string{row.Key, name, a, b})
+			if len(s.Examples) < examples {
+				s.Examples = append(s.Examples, []string{row.Key, common.TruncateString(a, 60), common.TruncateString(b, 60)})
+			}
+		}
+	}
+
+	fmt.Printf("\n=== COMPARE RUNS: %s ===\n", pair.Name)
+	fmt.Printf("A: %s\nB: %s\n", pair.A, pair.B)
+	printRunInfos(infoA, infoB)
+	fmt.Printf("Matched rows: %d | Only in A: %d | Only in B: %d\n", matched, d.count(diffRemoved), d.count(diffAdded))
+	if d.duplicateKeys > 0 {
+		warnf("%d rows repeat a key already seen in their file and were compared by their first occurrence only", d.duplicateKeys)
+	}
+
+	columnRows := make([][]string, len(stats))
+	for i, s := range stats {
+		columnRows[i] = []string{
+			names[i],
+			strconv.Itoa(s.Compared),
+			strconv.Itoa(s.Changed),
+			common.FormatPercentage(s.Changed, s.Compared),
+			strconv.Itoa(s.ErrorsA),
+			strconv.Itoa(s.ErrorsB),
+		}
+	}
+	fmt.Println("\nCHANGES BY COLUMN:")
+	fmt.Println(common.FormatTable([]string{"Column", "Compared", "Changed", "Change rate", "Errors A", "Errors B"}, columnRows, 120))
+	for _, s := range stats {
+		if len(s.Examples) == 0 {
+			continue
+		}
+		fmt.Printf("%s: first %d of %d disagreements\n", s.Name, len(s.Examples), s.Changed)
+		fmt.Println(common.FormatTable([]string{"Key", "A", "B"}, s.Examples, 140))
+	}
+	return infoA, infoB, disagreements, nil
+}
+
+// comparedColumns returns the columns to compare: those given, or the
+// generated columns of either run without the status and row hash columns,
+// which must be in both files
+func comparedColumns(spec string, infoA, infoB *RunInfo, headersA, headersB []string, key string) ([]string, error) {
+	var names []string
+	if strings.TrimSpace(spec) != "" {
+		for _, name := range strings.Split(spec, ",") {
+			names = append(names, strings.TrimSpace(name))
+		}
+	} else if infoA != nil || infoB != nil {
+		for _, info := range []*RunInfo{infoA, infoB} {
+			if info == nil {
+				continue
+			}
+			for _, column := range info.Columns {
+				if column.Source != "status" && column.Source != "row_hash" && indexOf(names, column.Name) == -1 {
+					names = append(names, column.Name)
+				}
+			}
+		}
+	} else {
+		return nil, fmt.Errorf("no run info found (%s); use -columns to name the generated columns", runInfoSuffix)
+	}
+
+	var keys []string
+	for _, name := range strings.Split(key, ",") {
+		keys = append(keys, strings.TrimSpace(name))
+	}
+	var compared []string
+	for _, name := range names {
+		if indexOf(headersA, name) == -1 || indexOf(headersB, name) == -1 {
+			if spec != "" {
+				return nil, fmt.Errorf("column '%s' is not in both runs", name)
+			}
+			fmt.Printf("Column '%s' is not in both runs, skipped\n", name)
+			continue
+		}
+		if indexOf(keys, name) == -1 {
+			compared = append(compared, name)
+		}
+	}
+	if len(compared) == 0 {
+		return nil, fmt.Errorf("no columns to compare")
+	}
+	return compared, nil
+}
+
+// printRunInfos prints the models, prompt, failures and cost of both runs
+// side by side
+func printRunInfos(a, b *RunInfo) {
+	if a == nil && b == nil {
+		fmt.Println("No run info found; cost and models are unknown")
+		return
+	}
+	field := func(info *RunInfo, value func(*RunInfo) string) string {
+		if info == nil {
+			return "-"
+		}
+		return value(info)
+	}
+	models := func(info *RunInfo) string {
+		var list []string
+		for _, column := range info.Columns {
+			if column.Model != "" && indexOf(list, column.Model) == -1 {
+				list = append(list, column.Model)
+			}
+		}
+		if len(list) == 0 {
+			return "local"
+		}
+		return strings.Join(list, ", ")
+	}
+	rows := [][]string{
+		{"Models", field(a, models), field(b, models), ""},
+		{"Rows", field(a, func(i *RunInfo) string { return strconv.Itoa(i.Rows) }), field(b, func(i *RunInfo) string { return strconv.Itoa(i.Rows) }), ""},
+		{"Failed rows", field(a, func(i *RunInfo) string { return strconv.Itoa(i.FailedRows) }), field(b, func(i *RunInfo) string { return strconv.Itoa(i.FailedRows) }), ""},
+		{"Tokens", field(a, func(i *RunInfo) string { return strconv.FormatInt(i.Tokens, 10) }), field(b, func(i *RunInfo) string { return strconv.FormatInt(i.Tokens, 10) }), ""},
+		{"Cost", field(a, func(i *RunInfo) string { return fmt.Sprintf("$%.4f", i.EstimatedCost) }), field(b, func(i *RunInfo) string { return fmt.Sprintf("$%.4f", i.EstimatedCost) }), ""},
+	}
+	if a != nil && b != nil {
+		rows[2][3] = fmt.Sprintf("%+d", b.FailedRows-a.FailedRows)
+		rows[3][3] = fmt.Sprintf("%+d", b.Tokens-a.Tokens)
+		rows[4][3] = costChange(a.EstimatedCost, b.EstimatedCost)
+		if a.Rows > 0 && b.Rows > 0 {
+			rows = append(rows, []string{"Cost per 1,000 rows", fmt.Sprintf("$%.4f", a.EstimatedCost*1000/float64(a.Rows)), fmt.Sprintf("$%.4f", b.EstimatedCost*1000/float64(b.Rows)), ""})
+		}
+	}
+	fmt.Println(common.FormatTable([]string{"", "A", "B", "Change"}, rows, 120))
+	if a != nil && b != nil && a.Prompt != b.Prompt {
+		fmt.Printf("Prompt changed:\n  A: %s\n  B: %s\n", common.TruncateString(a.Prompt, 200), common.TruncateString(b.Prompt, 200))
+	}
+}
+
+// costChange formats the difference between two costs, with its percentage
+// of the first
+func costChange(a, b float64) string {
+	change := fmt.Sprintf("%+.4f", b-a)
+	change = strings.Replace(change, "+", "+$", 1)
+	change = strings.Replace(change, "-", "-$", 1)
+	if a > 0 {
+		change += fmt.Sprintf(" (%+.1f%%)", (b-a)*100/a)
+	}
+	return change
+}
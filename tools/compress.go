@@ -0,0 +1,108 @@
+package tools
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// gzipSuffix marks gzip-compressed inputs and outputs, e.g. data.csv.gz
+const gzipSuffix = ".gz"
+
+// isGzipFile reports whether a file name has the gzip suffix
+func isGzipFile(filename string) bool {
+	return strings.HasSuffix(strings.ToLower(filename), gzipSuffix)
+}
+
+// dataExt returns the lowercased extension of a file name, ignoring the gzip
+// suffix: data.csv.gz -> .csv
+func dataExt(filename string) string {
+	name := strings.ToLower(filename)
+	return filepath.Ext(strings.TrimSuffix(name, gzipSuffix))
+}
+
+// isCSVFile reports whether a file name is a plain or gzipped CSV file
+func isCSVFile(filename string) bool {
+	return dataExt(filename) == ".csv"
+}
+
+// openInput opens a file for reading, decompressing gzip files on the fly
+func openInput(filename string) (io.ReadCloser, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	if !isGzipFile(filename) {
+		return file, nil
+	}
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("error reading gzip file: %v", err)
+	}
+	return &gzipFile{Reader: reader, file: file}, nil
+}
+
+// gzipFile closes the gzip stream together with the underlying file
+type gzipFile struct {
+	io.Reader
+	file *os.File
+}
+
+func (g *gzipFile) Close() error {
+	return g.file.Close()
+}
+
+// createOutput creates a file for writing, compressing gzip files
+func createOutput(filename string) (io.WriteCloser, error) {
+	file, err := os.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+	if !isGzipFile(filename) {
+		return file, nil
+	}
+	return &gzipWriter{Writer: gzip.NewWriter(file), file: file}, nil
+}
+
+// gzipWriter flushes the gzip stream before closing the underlying file
+type gzipWriter struct {
+	*gzip.Writer
+	file *os.File
+}
+
+func (g *gzipWriter) Close() error {
+	if err := g.Writer.Close(); err != nil {
+		g.file.Close()
+		return err
+	}
+	return g.file.Close()
+}
+
+// compressedName applies -compress to an output file name: gzip adds the .gz
+// suffix. Only CSV outputs can be compressed. Legacy .xls names are rejected,
+// since workbooks are written as .xlsx.
+func (o OutputOptions) compressedName(name string) (string, error) {
+	if isXLSFile(name) {
+		return "", fmt.Errorf("cannot write legacy .xls files; use an .xlsx output name")
+	}
+	switch o.Compress {
+	case "", "none":
+	case "gzip":
+		if name == stdioName {
+			return "", fmt.Errorf("stdout output is not compressed; pipe it through gzip instead")
+		}
+		if !isGzipFile(name) {
+			name += gzipSuffix
+		}
+	default:
+		return "", fmt.Errorf("invalid compression '%s' (use gzip or none)", o.Compress)
+	}
+	if isGzipFile(name) && !isCSVFile(name) {
+		return "", fmt.Errorf("only CSV outputs can be gzip-compressed (use -format csv)")
+	}
+	return name, nil
+}
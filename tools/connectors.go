@@ -0,0 +1,158 @@
+package tools
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+// connector pulls records from a SaaS system and writes generated columns
+// back to them. Inputs are written as "<prefix><spec>".
+type connector struct {
+	prefix   string
+	idColumn string // column holding the record ID used for push-back
+	load     func(spec string) ([]string, [][]string, error)
+	push     func(spec string, updates []recordUpdate) error
+}
+
+// connectors lists the supported SaaS connectors
+var connectors = []connector{
+	{prefix: hubspotPrefix, idColumn: "id", load: loadHubSpot, push: pushHubSpot},
+	{prefix: salesforcePrefix, idColumn: "Id", load: loadSalesforce, push: pushSalesforce},
+	{prefix: zendeskPrefix, idColumn: "id", load: loadZendesk, push: pushZendesk},
+	{prefix: intercomPrefix, idColumn: "id", load: loadIntercom, push: pushIntercom},
+	{prefix: sheetsPrefix, idColumn: sheetsRowColumn, load: loadGoogleSheet, push: pushGoogleSheet},
+}
+
+// recordUpdate holds the new property values for one record
+type recordUpdate struct {
+	ID         string
+	Properties map[string]string
+}
+
+// findConnector returns the connector handling input, or nil
+func findConnector(input string) *connector {
+	for i := range connectors {
+		if strings.HasPrefix(input, connectors[i].prefix) {
+			return &connectors[i]
+		}
+	}
+	return nil
+}
+
+// isConnectorSource reports whether the input refers to a SaaS connector
+func isConnectorSource(input string) bool {
+	return findConnector(input) != nil
+}
+
+// loadConnectorSource pulls records from the connector referenced by input
+func loadConnectorSource(input string) ([]string, [][]string, error) {
+	godotenv.Load(".env")
+
+	c := findConnector(input)
+	return c.load(strings.TrimPrefix(input, c.prefix))
+}
+
+// pushConnectorResults writes the generated columns back to the source
+// records. Only rows that were done are pushed, so failed rows and rows not
+// processed do not blank the records' fields; provenance and status columns
+// are skipped. Without status columns every row was done.
+func pushConnectorResults(input string, headers []string, enrichedRows [][]string, columnSpecs []ColumnSpec) error {
+	godotenv.Load(".env")
+
+	c := findConnector(input)
+	idIdx := -1
+	for i, header := range headers {
+		if header == c.idColumn {
+			idIdx = i
+			break
+		}
+	}
+	if idIdx == -1 {
+		return fmt.Errorf("input has no '%s' column to match source records", c.idColumn)
+	}
+
+	status := statusSpecIndex(columnSpecs)
+	updates := make([]recordUpdate, 0, len(enrichedRows))
+	for _, row := range enrichedRows {
+		if status != -1 && rowStatus(row, headers, status) != journalDone {
+			continue
+		}
+		properties := make(map[string]string)
+		for i, spec := range columnSpecs {
+			value := row[len(headers)+i]
+			if spec.Local {
+				continue
+			}
+			properties[spec.Name] = value
+		}
+		if len(properties) > 0 && row[idIdx] != "" {
+			updates = append(updates, recordUpdate{ID: row[idIdx], Properties: properties})
+		}
+	}
+
+	return c.push(strings.TrimPrefix(input, c.prefix), updates)
+}
+
+// bearerAuth returns request headers for bearer token authentication
+func bearerAuth(token string) map[string]string {
+	return map[string]string{"Authorization": "Bearer " + token}
+}
+
+// basicAuth returns request headers for HTTP basic authentication
+func basicAuth(username, password string) map[string]string {
+	credentials := base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
+	return map[string]string{"Authorization": "Basic " + credentials}
+}
+
+// connectorRequest sends a JSON request and decodes the JSON response into out
+func connectorRequest(method, endpoint string, headers map[string]string, payload interface{}, out interface{}) error {
+	var body io.Reader
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, endpoint, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	client := &http.Client{Timeout: 60 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	if out != nil && len(data) > 0 {
+		if err := json.Unmarshal(data, out); err != nil {
+			return fmt.Errorf("invalid response: %v", err)
+		}
+	}
+	return nil
+}
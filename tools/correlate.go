@@ -0,0 +1,596 @@
+package tools
+
+import (
+	"flag"
+	"fmt"
+	"html"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"ai-general-tool/common"
+)
+
+// correlationMethods lists the -method values of correlate
+var correlationMethods = map[string]bool{"pearson": true, "spearman": true}
+
+// RunCorrelate handles the correlate command: correlations between numeric
+// columns and chi-square tests between categorical ones, to see which
+// columns are related before feeding them to the model
+func RunCorrelate(args []string) error {
+	fs := flag.NewFlagSet("correlate", flag.ExitOnError)
+
+	// Define flags
+	inputFile := fs.String("input", "", "Input file (CSV, Excel or JSON)")
+	columns := fs.String("columns", "", "Comma-separated columns to compare (default: all)")
+	method := fs.String("method", "pearson", "Correlation of numeric columns: pearson or spearman (rank-based, for monotonic but non-linear relations)")
+	maxCategories := fs.Int("max-categories", 20, "Text and boolean columns with at most this many distinct values are compared as categories")
+	crosstab := fs.String("crosstab", "", "Print the cross-tabulation of two columns, e.g. region,segment")
+	outputFile := fs.String("output", "", "Also save the results as an HTML page with heatmaps")
+	jsonOutput := fs.Bool("json", false, "Print the results as JSON")
+	input := inputFlags(fs)
+	var locale common.Locale
+	localeFlag(fs, &locale)
+
+	// Parse flags
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *jsonOutput {
+		messageOutput = os.Stderr
+	}
+
+	// Handle positional argument for filename
+	if *inputFile == "" && fs.NArg() > 0 {
+		*inputFile = fs.Arg(0)
+	}
+
+	if *inputFile == "" {
+		return fmt.Errorf("input file is required")
+	}
+	if !correlationMethods[*method] {
+		return fmt.Errorf("invalid method '%s' (use pearson or spearman)", *method)
+	}
+	if *maxCategories < 2 {
+		return fmt.Errorf("-max-categories must be at least 2")
+	}
+
+	headers, rows, err := loadInputFile(*inputFile, *input)
+	if err != nil {
+		return fmt.Errorf("error loading file: %v", err)
+	}
+
+	if *crosstab != "" {
+		pair, err := columnIndexes(headers, *crosstab)
+		if err != nil {
+			return err
+		}
+		if len(pair) != 2 {
+			return fmt.Errorf("-crosstab takes two columns, e.g. region,segment")
+		}
+		table := newContingency(rows, pair[0], pair[1])
+		chi, df, p, v := table.chiSquare()
+		if *jsonOutput {
+			return printJSON(crosstabOutput{
+				File: *inputFile, Rows: headers[pair[0]], Columns: headers[pair[1]],
+				RowValues: table.rowValues, ColumnValues: table.colValues, Counts: table.counts, Total: table.total,
+				ChiSquare: jsonStat(chi), DF: df, P: jsonStat(p), CramersV: jsonStat(v),
+			})
+		}
+		fmt.Printf("\n=== CROSSTAB: %s x %s ===\n", headers[pair[0]], headers[pair[1]])
+		tableHeaders, tableRows := table.formatted(headers[pair[0]])
+		fmt.Println(common.FormatTable(tableHeaders, tableRows, 160))
+		fmt.Printf("Chi-square: %s, df %d, p %s, Cramer's V %s\n", formatStat(chi), df, formatPValue(p), formatStat(v))
+		return nil
+	}
+
+	indexes, err := columnIndexes(headers, *columns)
+	if err != nil {
+		return err
+	}
+	var numeric, categorical []int
+	for _, index := range indexes {
+		values := make([]string, len(rows))
+		for r, row := range rows {
+			values[r] = cell(row, index)
+		}
+		stats := describeColumn(headers[index], values, locale)
+		switch {
+		case isNumericType(stats.Type):
+			numeric = append(numeric, index)
+		case stats.Type != common.TypeDate && stats.Type != common.TypeEmpty && stats.Unique >= 2 && stats.Unique <= *maxCategories:
+			categorical = append(categorical, index)
+		}
+	}
+	if len(numeric) < 2 && len(categorical) < 2 {
+		return fmt.Errorf("need two numeric or two categorical columns (categorical: at most %d distinct values, see -max-categories)", *maxCategories)
+	}
+
+	var matrix correlationMatrix
+	if len(numeric) >= 2 {
+		matrix = numericCorrelations(headers, rows, numeric, *method, locale)
+	}
+	var associations []association
+	if len(categorical) >= 2 {
+		associations = categoricalAssociations(headers, rows, categorical)
+	}
+
+	if *jsonOutput {
+		output := correlateOutput{File: *inputFile, Rows: len(rows), Method: *method}
+		if len(matrix.names) > 0 {
+			output.Correlation = matrix.json()
+		}
+		for _, a := range associations {
+			output.Associations = append(output.Associations, associationOutput{a.a, a.b, jsonStat(a.chi), a.df, jsonStat(a.p), jsonStat(a.v)})
+		}
+		if err := printJSON(output); err != nil {
+			return err
+		}
+	} else {
+		printCorrelations(*inputFile, len(rows), len(numeric), len(categorical), *method, matrix, associations)
+	}
+
+	if *outputFile != "" {
+		var body strings.Builder
+		fmt.Fprintf(&body, "<h1>%s</h1>\n", html.EscapeString(*inputFile))
+		if len(matrix.names) > 0 {
+			fmt.Fprintf(&body, "<h2>%s correlation</h2>\n%s", strings.ToUpper((*method)[:1])+(*method)[1:], matrix.heatmap())
+		}
+		if len(associations) > 0 {
+			fmt.Fprintf(&body, "<h2>Categorical association (Cramer's V)</h2>\n%s", cramersMatrix(headers, categorical, associations).heatmap())
+		}
+		if err := os.WriteFile(*outputFile, []byte(profileDocument(*inputFile, body.String())), 0644); err != nil {
+			return fmt.Errorf("error saving output: %v", err)
+		}
+		fmt.Fprintf(messageOutput, "\nHeatmaps saved to: %s\n", *outputFile)
+	}
+	return nil
+}
+
+// printCorrelations prints the correlations of numeric columns and the
+// associations of categorical ones as tables
+func printCorrelations(filename string, rows, numeric, categorical int, method string, matrix correlationMatrix, associations []association) {
+	fmt.Printf("\n=== CORRELATE: %s ===\n", filename)
+	fmt.Printf("Rows: %d | Numeric columns: %d | Categorical columns: %d\n", rows, numeric, categorical)
+
+	if len(matrix.names) > 0 {
+		fmt.Printf("\n%s CORRELATION:\n", strings.ToUpper(method))
+		fmt.Println(common.FormatTable(matrix.formatted()))
+		if strongest := matrix.strongest(5); len(strongest) > 0 {
+			fmt.Println("Strongest pairs: " + strings.Join(strongest, ", "))
+		}
+	}
+
+	if len(associations) > 0 {
+		var tableRows [][]string
+		for _, a := range associations {
+			tableRows = append(tableRows, []string{a.a, a.b, formatStat(a.chi), strconv.Itoa(a.df), formatPValue(a.p), formatStat(a.v)})
+		}
+		fmt.Println("\nCATEGORICAL ASSOCIATION (chi-square):")
+		fmt.Println(common.FormatTable([]string{"Column A", "Column B", "Chi-square", "df", "p", "Cramer's V"}, tableRows, 160))
+		fmt.Println("Cramer's V is 0 for independent columns and 1 when one determines the other; use -crosstab a,b to see the counts.")
+	}
+}
+
+// correlationMatrix holds a symmetric measure between columns and the number
+// of rows each value is based on. Missing values are NaN.
+type correlationMatrix struct {
+	names  []string
+	values [][]float64
+	rows   [][]int
+}
+
+func newCorrelationMatrix(names []string) correlationMatrix {
+	m := correlationMatrix{names: names, values: make([][]float64, len(names)), rows: make([][]int, len(names))}
+	for i := range names {
+		m.values[i] = make([]float64, len(names))
+		m.rows[i] = make([]int, len(names))
+	}
+	return m
+}
+
+// numericCorrelations correlates every pair of the given numeric columns,
+// each over the rows where both are numbers
+func numericCorrelations(headers []string, rows [][]string, indexes []int, method string, locale common.Locale) correlationMatrix {
+	names := make([]string, len(indexes))
+	values := make([][]float64, len(indexes))
+	known := make([][]bool, len(indexes))
+	for i, index := range indexes {
+		names[i] = headers[index]
+		values[i], known[i] = numericColumn(rows, index, locale)
+	}
+	m := newCorrelationMatrix(names)
+	for a := range indexes {
+		for b := a; b < len(indexes); b++ {
+			var x, y []float64
+			for r := range rows {
+				if known[a][r] && known[b][r] {
+					x, y = append(x, values[a][r]), append(y, values[b][r])
+				}
+			}
+			if method == "spearman" {
+				x, y = ranks(x), ranks(y)
+			}
+			r, n := pearson(x, y)
+			m.values[a][b], m.values[b][a] = r, r
+			m.rows[a][b], m.rows[b][a] = n, n
+		}
+	}
+	return m
+}
+
+// ranks returns the rank of each value, ties getting their average rank
+func ranks(values []float64) []float64 {
+	order := make([]int, len(values))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool { return values[order[i]] < values[order[j]] })
+	ranked := make([]float64, len(values))
+	for i := 0; i < len(order); {
+		j := i
+		for j+1 < len(order) && values[order[j+1]] == values[order[i]] {
+			j++
+		}
+		for k := i; k <= j; k++ {
+			ranked[order[k]] = float64(i+j)/2 + 1
+		}
+		i = j + 1
+	}
+	return ranked
+}
+
+// formatted returns the matrix as table headers, rows and width for
+// common.FormatTable
+func (m correlationMatrix) formatted() ([]string, [][]string, int) {
+	headers := append([]string{""}, m.names...)
+	var rows [][]string
+	for a, name := range m.names {
+		row := []string{name}
+		for b := range m.names {
+			row = append(row, formatCorrelation(m.values[a][b]))
+		}
+		rows = append(rows, row)
+	}
+	return headers, rows, 20 * len(headers)
+}
+
+// strongest lists up to n pairs of different columns by the strength of
+// their relation, e.g. "price~quantity -0.82"
+func (m correlationMatrix) strongest(n int) []string {
+	type pair struct {
+		a, b int
+		r    float64
+	}
+	var pairs []pair
+	for a := range m.names {
+		for b := a + 1; b < len(m.names); b++ {
+			if !math.IsNaN(m.values[a][b]) {
+				pairs = append(pairs, pair{a, b, m.values[a][b]})
+			}
+		}
+	}
+	sort.SliceStable(pairs, func(i, j int) bool { return math.Abs(pairs[i].r) > math.Abs(pairs[j].r) })
+	var strongest []string
+	for _, p := range pairs[:min(n, len(pairs))] {
+		strongest = append(strongest, fmt.Sprintf("%s~%s %s", m.names[p.a], m.names[p.b], formatCorrelation(p.r)))
+	}
+	return strongest
+}
+
+// heatmap renders the matrix as an HTML table shaded blue for positive and
+// red for negative values, with the rows behind each value as a tooltip
+func (m correlationMatrix) heatmap() string {
+	var table strings.Builder
+	table.WriteString("<table>\n<thead><tr><th></th>")
+	for _, name := range m.names {
+		fmt.Fprintf(&table, "<th>%s</th>", html.EscapeString(name))
+	}
+	table.WriteString("</tr></thead>\n<tbody>\n")
+	for a, name := range m.names {
+		fmt.Fprintf(&table, "<tr><th>%s</th>", html.EscapeString(name))
+		for b := range m.names {
+			r := m.values[a][b]
+			if math.IsNaN(r) {
+				fmt.Fprintf(&table, "<td title=\"%d rows\"></td>", m.rows[a][b])
+				continue
+			}
+			fmt.Fprintf(&table, "<td title=\"%d rows\" style=\"background:%s\">%.2f</td>", m.rows[a][b], heatColor(r), r)
+		}
+		table.WriteString("</tr>\n")
+	}
+	table.WriteString("</tbody>\n</table>\n")
+	return table.String()
+}
+
+// correlateOutput is the JSON output of correlate
+type correlateOutput struct {
+	File         string              `json:"file"`
+	Rows         int                 `json:"rows"`
+	Method       string              `json:"method"`
+	Correlation  *matrixOutput       `json:"correlation,omitempty"`
+	Associations []associationOutput `json:"associations,omitempty"`
+}
+
+// matrixOutput is a correlation matrix in JSON output: the value of
+// columns i and j, null when there is none, and the rows it is based on
+type matrixOutput struct {
+	Columns []string     `json:"columns"`
+	Values  [][]*float64 `json:"values"`
+	Rows    [][]int      `json:"rows"`
+}
+
+// associationOutput is a chi-square test in JSON output
+type associationOutput struct {
+	A         string   `json:"a"`
+	B         string   `json:"b"`
+	ChiSquare *float64 `json:"chi_square"`
+	DF        int      `json:"df"`
+	P         *float64 `json:"p"`
+	CramersV  *float64 `json:"cramers_v"`
+}
+
+// crosstabOutput is the JSON output of correlate -crosstab: the count of
+// each pair of row and column values
+type crosstabOutput struct {
+	File         string   `json:"file"`
+	Rows         string   `json:"rows"`
+	Columns      string   `json:"columns"`
+	RowValues    []string `json:"row_values"`
+	ColumnValues []string `json:"column_values"`
+	Counts       [][]int  `json:"counts"`
+	Total        int      `json:"total"`
+	ChiSquare    *float64 `json:"chi_square"`
+	DF           int      `json:"df"`
+	P            *float64 `json:"p"`
+	CramersV     *float64 `json:"cramers_v"`
+}
+
+// json returns the matrix for JSON output
+func (m correlationMatrix) json() *matrixOutput {
+	output := &matrixOutput{Columns: m.names, Rows: m.rows}
+	for _, row := range m.values {
+		values := make([]*float64, len(row))
+		for i, r := range row {
+			values[i] = jsonStat(r)
+		}
+		output.Values = append(output.Values, values)
+	}
+	return output
+}
+
+// jsonStat rounds a statistic to 4 decimals for JSON output, or returns nil
+// (null) when it is NaN
+func jsonStat(v float64) *float64 {
+	if math.IsNaN(v) {
+		return nil
+	}
+	v = common.Round(v, 4)
+	return &v
+}
+
+// formatCorrelation formats a correlation with two decimals, or "" when
+// there is none
+func formatCorrelation(r float64) string {
+	if math.IsNaN(r) {
+		return ""
+	}
+	return fmt.Sprintf("%.2f", r)
+}
+
+// heatColor returns the background of a correlation: white for 0, blue
+// towards 1 and red towards -1
+func heatColor(r float64) string {
+	shade := int(255 - math.Abs(r)*150)
+	if r < 0 {
+		return fmt.Sprintf("rgb(255,%d,%d)", shade, shade)
+	}
+	return fmt.Sprintf("rgb(%d,%d,255)", shade, shade)
+}
+
+// contingency is the cross-tabulation of two categorical columns over the
+// rows where both have a value
+type contingency struct {
+	rowValues, colValues []string
+	counts               [][]int
+	total                int
+}
+
+func newContingency(rows [][]string, a, b int) contingency {
+	var pairs [][2]string
+	var aValues, bValues []string
+	for _, row := range rows {
+		x, y := strings.TrimSpace(cell(row, a)), strings.TrimSpace(cell(row, b))
+		if common.IsNull(x) || common.IsNull(y) {
+			continue
+		}
+		pairs = append(pairs, [2]string{x, y})
+		aValues, bValues = append(aValues, x), append(bValues, y)
+	}
+	t := contingency{total: len(pairs)}
+	aIndex, bIndex := make(map[string]int), make(map[string]int)
+	for _, vc := range valueCounts(aValues) {
+		aIndex[vc.Value] = len(t.rowValues)
+		t.rowValues = append(t.rowValues, vc.Value)
+	}
+	for _, vc := range valueCounts(bValues) {
+		bIndex[vc.Value] = len(t.colValues)
+		t.colValues = append(t.colValues, vc.Value)
+	}
+	t.counts = make([][]int, len(t.rowValues))
+	for i := range t.counts {
+		t.counts[i] = make([]int, len(t.colValues))
+	}
+	for _, pair := range pairs {
+		t.counts[aIndex[pair[0]]][bIndex[pair[1]]]++
+	}
+	return t
+}
+
+// formatted returns the cross-tabulation with row and column totals as table
+// headers and rows
+func (t contingency) formatted(rowName string) ([]string, [][]string) {
+	headers := append(append([]string{rowName}, t.colValues...), "Total")
+	var rows [][]string
+	colTotals := make([]int, len(t.colValues))
+	for i, value := range t.rowValues {
+		row := []string{value}
+		total := 0
+		for j, count := range t.counts[i] {
+			row = append(row, strconv.Itoa(count))
+			total += count
+			colTotals[j] += count
+		}
+		rows = append(rows, append(row, strconv.Itoa(total)))
+	}
+	totals := []string{"Total"}
+	for _, total := range colTotals {
+		totals = append(totals, strconv.Itoa(total))
+	}
+	return headers, append(rows, append(totals, strconv.Itoa(t.total)))
+}
+
+// chiSquare returns Pearson's chi-square statistic of independence, its
+// degrees of freedom and p-value, and Cramer's V
+func (t contingency) chiSquare() (float64, int, float64, float64) {
+	rows, cols := len(t.rowValues), len(t.colValues)
+	if rows < 2 || cols < 2 {
+		return math.NaN(), 0, math.NaN(), math.NaN()
+	}
+	rowTotals, colTotals := make([]float64, rows), make([]float64, cols)
+	for i := range t.counts {
+		for j, count := range t.counts[i] {
+			rowTotals[i] += float64(count)
+			colTotals[j] += float64(count)
+		}
+	}
+	chi := 0.0
+	for i := range t.counts {
+		for j, count := range t.counts[i] {
+			expected := rowTotals[i] * colTotals[j] / float64(t.total)
+			chi += (float64(count) - expected) * (float64(count) - expected) / expected
+		}
+	}
+	df := (rows - 1) * (cols - 1)
+	v := math.Sqrt(chi / float64(t.total) / float64(min(rows, cols)-1))
+	return chi, df, chiSquarePValue(chi, df), v
+}
+
+// association is the chi-square test of a pair of categorical columns
+type association struct {
+	a, b     string
+	chi      float64
+	df       int
+	p        float64
+	v        float64
+	aIndex   int
+	bIndex   int
+	complete bool // both columns had at least two values in common rows
+}
+
+// categoricalAssociations tests every pair of the given categorical columns,
+// strongest association (Cramer's V) first
+func categoricalAssociations(headers []string, rows [][]string, indexes []int) []association {
+	var associations []association
+	for i, a := range indexes {
+		for _, b := range indexes[i+1:] {
+			chi, df, p, v := newContingency(rows, a, b).chiSquare()
+			associations = append(associations, association{
+				a: headers[a], b: headers[b], chi: chi, df: df, p: p, v: v,
+				aIndex: a, bIndex: b, complete: df > 0,
+			})
+		}
+	}
+	sort.SliceStable(associations, func(i, j int) bool {
+		if associations[i].complete != associations[j].complete {
+			return associations[i].complete
+		}
+		return associations[i].v > associations[j].v
+	})
+	return associations
+}
+
+// cramersMatrix lays the Cramer's V of the associations out as a matrix
+func cramersMatrix(headers []string, indexes []int, associations []association) correlationMatrix {
+	names := make([]string, len(indexes))
+	position := make(map[int]int)
+	for i, index := range indexes {
+		names[i] = headers[index]
+		position[index] = i
+	}
+	m := newCorrelationMatrix(names)
+	for i := range names {
+		m.values[i][i] = 1
+	}
+	for _, a := range associations {
+		i, j := position[a.aIndex], position[a.bIndex]
+		m.values[i][j], m.values[j][i] = a.v, a.v
+	}
+	return m
+}
+
+// formatPValue formats a p-value, showing very small ones as "<0.0001"
+func formatPValue(p float64) string {
+	switch {
+	case math.IsNaN(p):
+		return ""
+	case p < 0.0001:
+		return "<0.0001"
+	}
+	return strconv.FormatFloat(common.Round(p, 4), 'f', -1, 64)
+}
+
+// chiSquarePValue returns the probability that a chi-square variable with df
+// degrees of freedom is at least x: the regularized upper incomplete gamma
+// function Q(df/2, x/2)
+func chiSquarePValue(x float64, df int) float64 {
+	if math.IsNaN(x) || df <= 0 {
+		return math.NaN()
+	}
+	if x <= 0 {
+		return 1
+	}
+	a, z := float64(df)/2, x/2
+	lgamma, _ := math.Lgamma(a)
+	prefix := math.Exp(-z + a*math.Log(z) - lgamma)
+
+	if z < a+1 {
+		// Series for the lower function P, then Q = 1 - P
+		sum, term := 1/a, 1/a
+		for n := 1; n < 500; n++ {
+			term *= z / (a + float64(n))
+			sum += term
+			if math.Abs(term) < math.Abs(sum)*1e-14 {
+				break
+			}
+		}
+		return math.Max(0, 1-prefix*sum)
+	}
+
+	// Continued fraction for Q (modified Lentz's method)
+	const tiny = 1e-300
+	b := z + 1 - a
+	c, d := 1/tiny, 1/b
+	h := d
+	for n := 1; n < 500; n++ {
+		an := -float64(n) * (float64(n) - a)
+		b += 2
+		d = an*d + b
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = b + an/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		delta := d * c
+		h *= delta
+		if math.Abs(delta-1) < 1e-14 {
+			break
+		}
+	}
+	return prefix * h
+}
@@ -0,0 +1,458 @@
+package tools
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// CSV dialects are detected from the first csvSniffSize bytes: the delimiter
+// that splits the most lines into the same number of fields, the quote
+// character that wraps fields, and whether the first row is a header.
+const csvSniffSize = 16 * 1024
+
+// csvDelimiters lists the candidate delimiters in order of preference
+var csvDelimiters = []rune{',', ';', '\t', '|'}
+
+// csvDialect describes how a CSV file is written
+type csvDialect struct {
+	Delimiter    rune
+	Quote        rune // '"' or '\''
+	Header       bool
+	Comment      rune // lines starting with it are skipped, 0 for none
+	StrictQuotes bool // reject stray quotes instead of keeping them
+	StrictFields bool // reject rows whose field count differs from the first row
+}
+
+// CSVOptions controls how CSV input is parsed. Unset delimiter and quote
+// settings are detected.
+type CSVOptions struct {
+	Delimiter    string // one character or "tab"
+	Quote        string // " or '
+	Comment      string // comment line prefix character
+	StrictQuotes bool   // fail on stray quotes
+	StrictFields bool   // fail on rows with missing or extra fields
+}
+
+// csvFlags registers the CSV parsing flags shared by every command that reads
+// CSV files
+func csvFlags(fs *flag.FlagSet, opts *CSVOptions) {
+	fs.StringVar(&opts.Delimiter, "delimiter", "auto", "CSV input: delimiter, e.g. ';' or tab (default: detected)")
+	fs.StringVar(&opts.Quote, "quote", "auto", "CSV input: quote character, \" or ' (default: detected)")
+	fs.StringVar(&opts.Comment, "comment", "", "CSV input: skip lines starting with this character, e.g. #")
+	fs.BoolVar(&opts.StrictQuotes, "strict-quotes", false, "CSV input: fail on stray quotes inside fields instead of keeping them")
+	fs.BoolVar(&opts.StrictFields, "strict-csv", false, "CSV input: fail on rows with missing or extra fields instead of padding or trimming them")
+}
+
+// dialect returns the settings given by the options; the delimiter and quote
+// are zero when left to detection
+func (o CSVOptions) dialect() (csvDialect, error) {
+	dialect, err := parseCSVDialect(o.Delimiter, o.Quote)
+	if err != nil {
+		return dialect, err
+	}
+	dialect.StrictQuotes = o.StrictQuotes
+	dialect.StrictFields = o.StrictFields
+	if o.Comment != "" {
+		runes := []rune(o.Comment)
+		if len(runes) != 1 || runes[0] == dialect.Delimiter || runes[0] == '"' || runes[0] == '\'' {
+			return dialect, fmt.Errorf("invalid comment character '%s' (use one character other than the delimiter and quotes)", o.Comment)
+		}
+		dialect.Comment = runes[0]
+	}
+	return dialect, nil
+}
+
+// String describes the dialect for previews
+func (d csvDialect) String() string {
+	names := map[rune]string{',': "comma", ';': "semicolon", '\t': "tab", '|': "pipe"}
+	name, ok := names[d.Delimiter]
+	if !ok {
+		name = strconv.QuoteRune(d.Delimiter)
+	}
+	header := "header row"
+	if !d.Header {
+		header = "no header row"
+	}
+	return fmt.Sprintf("%s-delimited, quote %c, %s", name, d.Quote, header)
+}
+
+// sniffCSV detects the dialect of a CSV sample. The delimiter and quote of
+// fixed are kept when set.
+func sniffCSV(sample []byte, fixed csvDialect) csvDialect {
+	dialect := fixed
+	if dialect.Quote == 0 {
+		dialect.Quote = sniffQuote(sample)
+		if dialect.Quote == dialect.Delimiter {
+			dialect.Quote = '"'
+		}
+	}
+	if dialect.Delimiter == 0 {
+		dialect.Delimiter = sniffDelimiter(sample, dialect.Quote)
+	}
+
+	reader := dialect.reader(bytes.NewReader(sample))
+	reader.FieldsPerRecord = -1
+	rows, err := reader.ReadAll()
+	if err != nil && len(rows) == 0 {
+		dialect.Header = true
+		return dialect
+	}
+	// The last row of a truncated sample may be incomplete
+	if len(sample) == csvSniffSize && len(rows) > 2 {
+		rows = rows[:len(rows)-1]
+	}
+	dialect.Header = sniffHeader(rows)
+	return dialect
+}
+
+// sniffQuote picks the quote character found around the most fields
+func sniffQuote(sample []byte) rune {
+	best, bestCount := '"', 0
+	for _, quote := range []rune{'"', '\''} {
+		count := 0
+		for i := 0; i < len(sample); i++ {
+			if rune(sample[i]) != quote {
+				continue
+			}
+			// An opening quote follows a line start, a delimiter or spaces
+			j := i - 1
+			for j >= 0 && sample[j] == ' ' {
+				j--
+			}
+			if j < 0 || sample[j] == '\n' || sample[j] == '\r' || strings.ContainsRune(",;\t|", rune(sample[j])) {
+				count++
+			}
+		}
+		if count > bestCount {
+			best, bestCount = quote, count
+		}
+	}
+	return best
+}
+
+// sniffDelimiter picks the delimiter that gives the most lines the same
+// number of fields, preferring more fields and then the order of
+// csvDelimiters. Delimiters inside quotes are not counted.
+func sniffDelimiter(sample []byte, quote rune) rune {
+	best, bestScore, bestFields := ',', 0.0, 0
+	for _, delimiter := range csvDelimiters {
+		var counts []int
+		count, inQuote := 0, false
+		for _, c := range string(sample) {
+			switch {
+			case c == quote:
+				inQuote = !inQuote
+			case inQuote:
+			case c == delimiter:
+				count++
+			case c == '\n':
+				counts = append(counts, count)
+				count = 0
+			}
+		}
+		if count > 0 && len(counts) == 0 {
+			counts = append(counts, count) // a single line without a newline
+		}
+
+		// Share of lines with the most common non-zero count
+		frequency := make(map[int]int)
+		for _, n := range counts {
+			if n > 0 {
+				frequency[n]++
+			}
+		}
+		mode, modeLines := 0, 0
+		for n, lines := range frequency {
+			if lines > modeLines || (lines == modeLines && n > mode) {
+				mode, modeLines = n, lines
+			}
+		}
+		if modeLines == 0 {
+			continue
+		}
+		score := float64(modeLines) / float64(len(counts))
+		if score > bestScore || (score == bestScore && mode > bestFields) {
+			best, bestScore, bestFields = delimiter, score, mode
+		}
+	}
+	return best
+}
+
+// sniffHeader reports whether the first row looks like a header: columns
+// whose values are all numbers, or all the same length, vote for a header
+// when the first row's cell differs, and against one when it matches
+func sniffHeader(rows [][]string) bool {
+	if len(rows) < 2 {
+		return true
+	}
+	votes := 0
+	for col, name := range rows[0] {
+		numeric, length, consistent := true, -1, true
+		values := 0
+		for _, row := range rows[1:] {
+			if col >= len(row) || row[col] == "" {
+				continue
+			}
+			values++
+			if _, err := strconv.ParseFloat(row[col], 64); err != nil {
+				numeric = false
+			}
+			if length == -1 {
+				length = len(row[col])
+			} else if len(row[col]) != length {
+				consistent = false
+			}
+		}
+		if values == 0 {
+			continue
+		}
+		_, err := strconv.ParseFloat(name, 64)
+		switch {
+		case numeric:
+			if err != nil {
+				votes++
+			} else {
+				votes--
+			}
+		case consistent:
+			if len(name) != length {
+				votes++
+			} else {
+				votes--
+			}
+		}
+	}
+	return votes >= 0
+}
+
+// reader returns a CSV reader for the dialect. encoding/csv only knows
+// double quotes, so single-quoted input has its quote characters swapped
+// while parsing; swapCSVQuotes restores them in the fields.
+func (d csvDialect) reader(r io.Reader) *csv.Reader {
+	if d.Quote == '\'' {
+		r = quoteSwapReader{r}
+	}
+	reader := csv.NewReader(r)
+	reader.Comma = d.Delimiter
+	reader.Comment = d.Comment
+	reader.LazyQuotes = !d.StrictQuotes
+	reader.TrimLeadingSpace = true
+	if !d.StrictFields {
+		reader.FieldsPerRecord = -1
+	}
+	return reader
+}
+
+// rows returns a source of the records of r, restoring swapped quote
+// characters. Unless the dialect is strict about fields, rows are fitted to
+// the width of the first row (the header) and the repairs are reported when
+// the input ends.
+func (d csvDialect) rows(r io.Reader) *csvRowSource {
+	return &csvRowSource{reader: d.reader(r), swap: d.Quote == '\'', fit: !d.StrictFields}
+}
+
+// maxRepairLines caps the line numbers listed in a CSV repair report
+const maxRepairLines = 10
+
+// csvRepairs counts the rows fitted to the header width
+type csvRepairs struct {
+	padded    []int // lines of rows with missing fields, filled with empty cells
+	truncated []int // lines of rows whose extra non-empty fields were dropped
+	trimmed   int   // rows with only empty extra fields, e.g. a trailing delimiter
+}
+
+// fit pads or trims a record read on line to width fields
+func (c *csvRepairs) fit(record []string, width, line int) []string {
+	switch {
+	case len(record) < width:
+		c.padded = append(c.padded, line)
+		return append(record, make([]string, width-len(record))...)
+	case len(record) > width:
+		if strings.Join(record[width:], "") == "" {
+			c.trimmed++
+		} else {
+			c.truncated = append(c.truncated, line)
+		}
+		return record[:width]
+	}
+	return record
+}
+
+// report prints what was repaired, if anything
+func (c *csvRepairs) report() {
+	repaired := len(c.padded) + len(c.truncated) + c.trimmed
+	if repaired == 0 {
+		return
+	}
+	var parts []string
+	if len(c.padded) > 0 {
+		parts = append(parts, fmt.Sprintf("%d with missing fields padded with empty cells (%s)", len(c.padded), formatLines(c.padded)))
+	}
+	if len(c.truncated) > 0 {
+		parts = append(parts, fmt.Sprintf("%d with extra fields dropped (%s)", len(c.truncated), formatLines(c.truncated)))
+	}
+	if c.trimmed > 0 {
+		parts = append(parts, fmt.Sprintf("%d with empty extra fields trimmed", c.trimmed))
+	}
+	warnf("repaired %d CSV rows whose field count differs from the header: %s. Use -strict-csv to fail on them instead.",
+		repaired, strings.Join(parts, "; "))
+}
+
+// formatLines lists the first line numbers, e.g. "lines 4, 9 and 12 more"
+func formatLines(lines []int) string {
+	shown := make([]string, min(len(lines), maxRepairLines))
+	for i := range shown {
+		shown[i] = strconv.Itoa(lines[i])
+	}
+	text := "line " + shown[0]
+	if len(lines) > 1 {
+		text = "lines " + strings.Join(shown, ", ")
+	}
+	if more := len(lines) - len(shown); more > 0 {
+		text += fmt.Sprintf(" and %d more", more)
+	}
+	return text
+}
+
+// quoteSwapReader exchanges single and double quotes
+type quoteSwapReader struct {
+	r io.Reader
+}
+
+func (q quoteSwapReader) Read(p []byte) (int, error) {
+	n, err := q.r.Read(p)
+	for i := range p[:n] {
+		switch p[i] {
+		case '"':
+			p[i] = '\''
+		case '\'':
+			p[i] = '"'
+		}
+	}
+	return n, err
+}
+
+// swapCSVQuotes exchanges single and double quotes in a field
+func swapCSVQuotes(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '"':
+			return '\''
+		case '\'':
+			return '"'
+		}
+		return r
+	}, s)
+}
+
+// sniffReader detects the dialect from the start of r and returns a reader
+// that still yields the whole input. Settings of fixed are kept.
+func sniffReader(r io.Reader, fixed csvDialect) (csvDialect, io.Reader) {
+	buffered := bufio.NewReaderSize(r, csvSniffSize)
+	sample, _ := buffered.Peek(csvSniffSize)
+	return sniffCSV(sample, fixed), buffered
+}
+
+// parseCSVDialect parses -delimiter and -quote values. Empty values and "auto"
+// leave the setting to detection.
+func parseCSVDialect(delimiter, quote string) (csvDialect, error) {
+	var dialect csvDialect
+	switch delimiter {
+	case "", "auto":
+	case `\t`, "tab":
+		dialect.Delimiter = '\t'
+	default:
+		runes := []rune(delimiter)
+		if len(runes) != 1 || runes[0] == '"' || runes[0] == '\n' || runes[0] == '\r' {
+			return dialect, fmt.Errorf("invalid delimiter '%s' (use one character, or tab)", delimiter)
+		}
+		dialect.Delimiter = runes[0]
+	}
+	switch quote {
+	case "", "auto":
+	case `"`, "double":
+		dialect.Quote = '"'
+	case "'", "single":
+		dialect.Quote = '\''
+	default:
+		return dialect, fmt.Errorf("invalid quote '%s' (use \" or ')", quote)
+	}
+	if dialect.Delimiter != 0 && dialect.Delimiter == dialect.Quote {
+		return dialect, fmt.Errorf("delimiter and quote must differ")
+	}
+	return dialect, nil
+}
+
+// writeQuotedCSV writes CSV with every field quoted, which encoding/csv does
+// not offer
+func writeQuotedCSV(w io.Writer, headers []string, rows [][]string) error {
+	writer := newQuotedCSVWriter(w)
+	writer.Write(headers)
+	for _, row := range rows {
+		writer.Write(row)
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// csvRecordWriter is implemented by csv.Writer and quotedCSVWriter
+type csvRecordWriter interface {
+	Write(record []string) error
+	Flush()
+	Error() error
+}
+
+// newCSVRecordWriter returns a CSV writer, quoting every field when quoteAll
+// is set
+func newCSVRecordWriter(w io.Writer, quoteAll bool) csvRecordWriter {
+	if quoteAll {
+		return newQuotedCSVWriter(w)
+	}
+	return csv.NewWriter(w)
+}
+
+// quotedCSVWriter writes records with every field quoted
+type quotedCSVWriter struct {
+	w   *bufio.Writer
+	err error
+}
+
+func newQuotedCSVWriter(w io.Writer) *quotedCSVWriter {
+	return &quotedCSVWriter{w: bufio.NewWriter(w)}
+}
+
+func (q *quotedCSVWriter) Write(record []string) error {
+	for i, field := range record {
+		if i > 0 {
+			q.w.WriteByte(',')
+		}
+		q.w.WriteByte('"')
+		q.w.WriteString(strings.ReplaceAll(field, `"`, `""`))
+		q.w.WriteByte('"')
+	}
+	_, err := q.w.WriteString("\n")
+	return err
+}
+
+func (q *quotedCSVWriter) Flush() {
+	q.err = q.w.Flush()
+}
+
+func (q *quotedCSVWriter) Error() error {
+	return q.err
+}
+
+// generatedHeaders names the columns of a file without a header row
+func generatedHeaders(n int) []string {
+	headers := make([]string, n)
+	for i := range headers {
+		headers[i] = fmt.Sprintf("col_%d", i+1)
+	}
+	return headers
+}
@@ -0,0 +1,405 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// daemonPIDFile is the file of a queue naming its running daemon, which
+// touches it on every poll; a file left untouched for daemonStale belongs to
+// a daemon that died
+const (
+	daemonPIDFile = "daemon.pid"
+	daemonLogFile = "daemon.log"
+	daemonStale   = 30 * time.Second
+)
+
+// daemonRun is a job the daemon has started
+type daemonRun struct {
+	job        *queuedJob
+	cmd        *exec.Cmd
+	log        *os.File
+	cancelling bool
+}
+
+// daemonExit reports the end of a job's process
+type daemonExit struct {
+	id  string
+	err error
+}
+
+// RunDaemon handles the daemon command: it runs the jobs of a queue, a few at
+// a time, until it is stopped. Jobs interrupted by stopping it, or by a crash,
+// are queued again and continue where they stopped when it restarts.
+func RunDaemon(args []string) error {
+	fs := flag.NewFlagSet("daemon", flag.ExitOnError)
+
+	// Define flags
+	queueDir := fs.String("queue", "", "Queue directory (default $"+queueEnv+" or ~/.aitool/queue)")
+	concurrency := fs.Int("concurrency", 1, "Jobs run at the same time")
+	poll := fs.Duration("poll", 2*time.Second, "How often the queue is checked for new and cancelled jobs")
+	detach := fs.Bool("detach", false, "Run in the background, logging to daemon.log in the queue directory, and return")
+
+	// Parse flags
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *concurrency < 1 {
+		return fmt.Errorf("-concurrency must be at least 1")
+	}
+	if *poll <= 0 || *poll > daemonStale/3 {
+		return fmt.Errorf("-poll must be between 0 and %s", daemonStale/3)
+	}
+	dir, err := queuePath(*queueDir)
+	if err != nil {
+		return err
+	}
+	if pid := daemonPID(dir); pid != 0 {
+		return fmt.Errorf("a daemon (pid %d) is already running on %s", pid, dir)
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("cannot find the aitool executable to run jobs with: %v", err)
+	}
+	if *detach {
+		return detachDaemon(exe, dir, args)
+	}
+
+	// Outlive the terminal: closing an SSH session must not stop the runs
+	signal.Ignore(syscall.SIGHUP)
+	ctx, stop := stopContext()
+	defer stop()
+
+	pidFile := filepath.Join(dir, daemonPIDFile)
+	if err := os.WriteFile(pidFile, []byte(strconv.Itoa(os.Getpid())), 0644); err != nil {
+		return fmt.Errorf("error writing %s: %v", pidFile, err)
+	}
+	defer os.Remove(pidFile)
+
+	// Jobs still marked running were cut short by a crash
+	jobs, err := loadQueue(dir)
+	if err != nil {
+		return err
+	}
+	for _, job := range jobs {
+		if job.State == jobRunning {
+			fmt.Printf("Job %s was interrupted; it is queued to resume\n", job.ID)
+			job.State = jobQueued
+			job.Resume = true
+			job.PID = 0
+			if err := saveQueuedJob(dir, job); err != nil {
+				return err
+			}
+		}
+	}
+
+	fmt.Printf("Daemon started on %s (pid %d), running up to %d jobs at a time\n", dir, os.Getpid(), *concurrency)
+	running := map[string]*daemonRun{}
+	exits := make(chan daemonExit)
+	ticker := time.NewTicker(*poll)
+	defer ticker.Stop()
+	for {
+		if err := checkQueue(dir, exe, running, *concurrency, exits); err != nil {
+			warnf("%v", err)
+		}
+		select {
+		case exit := <-exits:
+			finishRun(dir, running, exit, false)
+		case <-ticker.C:
+			now := time.Now()
+			os.Chtimes(pidFile, now, now)
+		case <-ctx.Done():
+			if len(running) > 0 {
+				fmt.Printf("Stopping: interrupting %d running jobs, which save their progress and resume on restart\n", len(running))
+			}
+			for _, run := range running {
+				stopProcess(ctx, run.cmd)
+			}
+			for len(running) > 0 {
+				finishRun(dir, running, <-exits, true)
+			}
+			fmt.Println("Daemon stopped")
+			return nil
+		}
+	}
+}
+
+// checkQueue applies cancel requests and starts queued jobs, oldest first,
+// while fewer than concurrency run
+func checkQueue(dir, exe string, running map[string]*daemonRun, concurrency int, exits chan<- daemonExit) error {
+	jobs, err := loadQueue(dir)
+	if err != nil {
+		return err
+	}
+	for _, job := range jobs {
+		if run := running[job.ID]; run != nil {
+			if !run.cancelling && cancelRequested(dir, job.ID) {
+				fmt.Printf("Cancelling job %s\n", job.ID)
+				run.cancelling = true
+				interruptProcess(run.cmd)
+			}
+			continue
+		}
+		if job.State != jobQueued {
+			continue
+		}
+		if cancelRequested(dir, job.ID) {
+			fmt.Printf("Job %s cancelled before it started\n", job.ID)
+			job.State = jobCancelled
+			job.Finished = time.Now()
+			if err := saveQueuedJob(dir, job); err != nil {
+				return err
+			}
+			os.Remove(filepath.Join(dir, job.ID+".cancel"))
+			continue
+		}
+		if len(running) >= concurrency {
+			continue
+		}
+		run, err := startRun(dir, exe, job, exits)
+		if err != nil {
+			job.State = jobFailed
+			job.Error = err.Error()
+			job.Finished = time.Now()
+			fmt.Printf("Job %s failed to start: %v\n", job.ID, err)
+			if err := saveQueuedJob(dir, job); err != nil {
+				return err
+			}
+			continue
+		}
+		running[job.ID] = run
+	}
+	return nil
+}
+
+// startRun starts a job as an aitool process in the job's directory, with
+// its output appended to the job's log
+func startRun(dir, exe string, job *queuedJob, exits chan<- daemonExit) (*daemonRun, error) {
+	log, err := os.OpenFile(filepath.Join(dir, job.ID+".log"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("error opening log: %v", err)
+	}
+	args := []string{job.Command, "-yes"}
+	if job.Resume && resumable(job.Args) {
+		args = append(args, "-resume")
+	}
+	args = append(args, job.Args...)
+
+	job.Attempts++
+	fmt.Fprintf(log, "=== %s: attempt %d: aitool %s ===\n", time.Now().Format(time.DateTime), job.Attempts, strings.Join(args, " "))
+	cmd := exec.Command(exe, args...)
+	cmd.Dir = job.Dir
+	cmd.Stdout = log
+	cmd.Stderr = log
+	if err := cmd.Start(); err != nil {
+		log.Close()
+		return nil, err
+	}
+
+	job.State = jobRunning
+	job.PID = cmd.Process.Pid
+	job.Resume = false
+	if job.Started.IsZero() {
+		job.Started = time.Now()
+	}
+	fmt.Printf("Job %s started (attempt %d, pid %d): %s\n", job.ID, job.Attempts, job.PID, job.title())
+	if err := saveQueuedJob(dir, job); err != nil {
+		warnf("%v", err)
+	}
+	go func() {
+		exits <- daemonExit{id: job.ID, err: cmd.Wait()}
+	}()
+	return &daemonRun{job: job, cmd: cmd, log: log}, nil
+}
+
+// finishRun records the end of a job's process: cancelled when asked to,
+// queued to resume when the daemon stopped it, else done or failed
+func finishRun(dir string, running map[string]*daemonRun, exit daemonExit, stopping bool) {
+	run := running[exit.id]
+	delete(running, exit.id)
+	run.log.Close()
+	job := run.job
+	job.PID = 0
+
+	switch {
+	case run.cancelling:
+		job.State = jobCancelled
+		os.Remove(filepath.Join(dir, job.ID+".cancel"))
+	case exit.err == nil:
+		job.State = jobDone
+	case stopping:
+		job.State = jobQueued
+		job.Resume = true
+	default:
+		job.State = jobFailed
+		job.Error = exit.err.Error()
+		if line := lastLogLine(filepath.Join(dir, job.ID+".log")); line != "" {
+			job.Error = strings.TrimPrefix(line, "Error: ")
+		}
+	}
+	if job.State != jobQueued {
+		job.Finished = time.Now()
+	}
+	if job.Resume {
+		fmt.Printf("Job %s interrupted; it resumes when the daemon restarts\n", job.ID)
+	} else {
+		fmt.Printf("Job %s %s\n", job.ID, job.State)
+	}
+	if err := saveQueuedJob(dir, job); err != nil {
+		warnf("%v", err)
+	}
+}
+
+// interruptProcess interrupts a job's process like Ctrl+C, so that it saves
+// the rows it finished. Where processes cannot be interrupted (Windows) it is
+// killed, and a resumed run redoes the rows not in its run journal.
+func interruptProcess(cmd *exec.Cmd) {
+	if err := cmd.Process.Signal(os.Interrupt); err != nil {
+		cmd.Process.Kill()
+	}
+}
+
+// stopSignal is the cause of a stop context's cancellation
+type stopSignal struct{ os.Signal }
+
+func (s stopSignal) Error() string { return s.String() }
+
+// stopContext returns a context cancelled on Ctrl+C or SIGTERM. A second
+// signal is not caught and stops the program at once.
+func stopContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		defer signal.Stop(sigChan)
+		select {
+		case sig := <-sigChan:
+			cancel(stopSignal{sig})
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, func() { cancel(nil) }
+}
+
+// stopProcess interrupts a child process when its parent is stopped. Ctrl+C
+// in a terminal reaches the child already, and a second interrupt would make
+// it abandon the rows in progress, so only other stops are passed on.
+func stopProcess(ctx context.Context, cmd *exec.Cmd) {
+	if sig, ok := context.Cause(ctx).(stopSignal); ok && sig.Signal == os.Interrupt {
+		return
+	}
+	interruptProcess(cmd)
+}
+
+// resumable reports whether process-data arguments can take -resume, which
+// needs a local output file without -stream. Job files are checked by
+// run-job itself.
+func resumable(args []string) bool {
+	for i, arg := range args {
+		name, value, _ := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !strings.HasPrefix(arg, "-") {
+			continue
+		}
+		switch name {
+		case "stream":
+			if value == "" || value == "true" {
+				return false
+			}
+		case "output":
+			if value == "" && i+1 < len(args) {
+				value = args[i+1]
+			}
+			if value == stdioName || isCloudURI(value) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// lastLogLine returns the last line of a job's log, which holds the error a
+// failed run ended with
+func lastLogLine(file string) string {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return ""
+	}
+	lines := logLines(string(data))
+	return strings.TrimSpace(lines[len(lines)-1])
+}
+
+// daemonPID returns the pid of the daemon running on a queue, or 0 once it
+// stopped touching its pid file or its process is gone
+func daemonPID(dir string) int {
+	file := filepath.Join(dir, daemonPIDFile)
+	info, err := os.Stat(file)
+	if err != nil || time.Since(info.ModTime()) > daemonStale {
+		return 0
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return 0
+	}
+	pid, _ := strconv.Atoi(strings.TrimSpace(string(data)))
+	process, err := os.FindProcess(pid)
+	if err != nil || pid <= 0 {
+		return 0
+	}
+	if err := process.Signal(syscall.Signal(0)); errors.Is(err, syscall.ESRCH) || errors.Is(err, os.ErrProcessDone) {
+		return 0
+	}
+	return pid
+}
+
+// detachDaemon starts the daemon again in the background, with its output
+// in the queue's daemon.log, and returns once it is running
+func detachDaemon(exe, dir string, args []string) error {
+	if strings.Contains(exe, "go-build") {
+		return fmt.Errorf("-detach needs a built binary (go build -o aitool .): go run deletes its binary when it exits")
+	}
+	logFile := filepath.Join(dir, daemonLogFile)
+	log, err := os.OpenFile(logFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("error opening %s: %v", logFile, err)
+	}
+	defer log.Close()
+
+	args = slices.DeleteFunc(slices.Clone(args), func(arg string) bool {
+		return arg == "-detach" || arg == "--detach" || arg == "-detach=true" || arg == "--detach=true"
+	})
+	cmd := exec.Command(exe, append([]string{"daemon", "-queue", dir}, args...)...)
+	cmd.Stdout = log
+	cmd.Stderr = log
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("error starting the daemon: %v", err)
+	}
+
+	// Wait until the daemon has claimed the queue, or has failed to
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+	deadline := time.After(5 * time.Second)
+	for daemonPID(dir) != cmd.Process.Pid {
+		select {
+		case <-exited:
+			return fmt.Errorf("the daemon exited at startup; see %s", logFile)
+		case <-deadline:
+			return fmt.Errorf("the daemon did not start in time; see %s", logFile)
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+	fmt.Printf("Daemon started in the background (pid %d) on %s\n", cmd.Process.Pid, dir)
+	fmt.Printf("Log: %s\n", logFile)
+	fmt.Println("Stop it with: kill", cmd.Process.Pid)
+	return nil
+}
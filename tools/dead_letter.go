@@ -0,0 +1,164 @@
+package tools
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+)
+
+// deadLetterNone keeps failed rows in the output instead of a dead-letter file
+const deadLetterNone = "none"
+
+// deadLetterRowColumn gives the data row of the input (1-based) each row of a
+// dead-letter file came from
+const deadLetterRowColumn = "_row"
+
+// FailureOptions controls what happens to rows that still fail after the API
+// client's retries
+type FailureOptions struct {
+	Strict     bool   // stop the run at the first failed row and save no output
+	DeadLetter string // CSV file receiving the failed rows; empty for <output>_failed.csv, none to keep them in the output
+}
+
+// failureFlags registers -strict and -dead-letter
+func failureFlags(fs *flag.FlagSet, opts *FailureOptions) {
+	fs.BoolVar(&opts.Strict, "strict", false, "Stop at the first row that fails after retries and save no output; finished rows stay in the run journal for -resume")
+	fs.StringVar(&opts.DeadLetter, "dead-letter", "", "CSV file receiving the failed rows with their original data and error details, which are left out of the output (default: <output>_failed.csv; none keeps them in the output)")
+}
+
+// deadLetterFile returns the dead-letter file of an output, or "" when failed
+// rows stay in the output. Outputs written to stdout only get one when it is
+// named.
+func (o FailureOptions) deadLetterFile(outputFile string) string {
+	switch {
+	case o.DeadLetter == deadLetterNone:
+		return ""
+	case o.DeadLetter != "":
+		return o.DeadLetter
+	case outputFile == stdioName:
+		return ""
+	}
+	return suffixedOutputFile(outputFile, "csv", "_failed")
+}
+
+// strictStop stops a -strict run at its first failed row, given by its data
+// row in the input (0-based), like an interrupt would: no new rows are
+// started and the rows in progress finish
+func (stats *ProcessingStats) strictStop(config *ProcessingConfig, result ProcessingResult, row int) {
+	if !config.Strict || result.Error == nil || stats.Stopped != nil {
+		return
+	}
+	stats.Stopped = fmt.Errorf("row %d failed after %d attempts (%s): %v", row+1, result.Attempts, result.ErrorClass, result.Error)
+	if stats.stop != nil {
+		stats.stop()
+	}
+}
+
+// withStrictStop returns the context of a run that strictStop cancels
+func (stats *ProcessingStats) withStrictStop(ctx context.Context, config *ProcessingConfig) (context.Context, context.CancelFunc) {
+	if !config.Strict {
+		return ctx, func() {}
+	}
+	ctx, stats.stop = context.WithCancel(ctx)
+	return ctx, stats.stop
+}
+
+// deadLetterHeaders returns the header row of a dead-letter file
+func deadLetterHeaders(headers []string) []string {
+	return append(append([]string{}, headers...), deadLetterRowColumn, errorClassColumn, errorColumn, attemptsColumn)
+}
+
+// deadLetterRow returns the row of a dead-letter file for a failed input row,
+// given by its data row (0-based) and the status values of its result
+func deadLetterRow(headers []string, input []string, row int, results map[string]string) []string {
+	out := make([]string, len(headers), len(headers)+4)
+	copy(out, input)
+	return append(out, strconv.Itoa(row+1), results[errorClassColumn], results[errorColumn], results[attemptsColumn])
+}
+
+// takeFailedRows moves the failed rows out of the enriched rows: it returns
+// the input and enriched rows that are kept, and the failed rows as rows of a
+// dead-letter file. inputRows gives the data row in the input of each row
+// when some were filtered out, nil when rows are the whole input.
+func takeFailedRows(headers []string, rows [][]string, enrichedRows [][]string, columnSpecs []ColumnSpec, inputRows []int) ([][]string, [][]string, [][]string) {
+	status := statusSpecIndex(columnSpecs)
+	var keptRows, keptEnriched, failed [][]string
+	for r, row := range enrichedRows {
+		if rowStatus(row, headers, status) != journalError {
+			keptRows = append(keptRows, rows[r])
+			keptEnriched = append(keptEnriched, row)
+			continue
+		}
+		results := make(map[string]string)
+		for i, spec := range columnSpecs {
+			if isStatusColumn(spec.Name) {
+				results[spec.Name] = row[len(headers)+i]
+			}
+		}
+		inputRow := r
+		if inputRows != nil {
+			inputRow = inputRows[r]
+		}
+		failed = append(failed, deadLetterRow(headers, rows[r], inputRow, results))
+	}
+	return keptRows, keptEnriched, failed
+}
+
+// saveDeadLetter writes the failed rows of a run to its dead-letter file. A
+// run without failed rows removes the file an earlier run may have left, so
+// the file always lists the failures of the latest run.
+func saveDeadLetter(filename string, headers []string, failed [][]string) error {
+	if len(failed) == 0 {
+		if isCloudURI(filename) {
+			return nil
+		}
+		if err := os.Remove(filename); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	return saveCSV(filename, deadLetterHeaders(headers), failed, false)
+}
+
+// deadLetterStream writes the failed rows of a streamed run to the
+// dead-letter file as they fail. The file is created with the first one.
+type deadLetterStream struct {
+	filename string
+	headers  []string
+	file     io.WriteCloser
+	writer   csvRecordWriter
+	rows     int
+}
+
+// add writes a failed row
+func (s *deadLetterStream) add(input []string, row int, results map[string]string) error {
+	if s.file == nil {
+		file, err := createOutput(s.filename)
+		if err != nil {
+			return err
+		}
+		s.file, s.writer = file, newCSVRecordWriter(file, false)
+		if err := s.writer.Write(deadLetterHeaders(s.headers)); err != nil {
+			return err
+		}
+	}
+	s.rows++
+	return s.writer.Write(deadLetterRow(s.headers, input, row, results))
+}
+
+// close finishes the file, or removes the one an earlier run left when no
+// row failed
+func (s *deadLetterStream) close() error {
+	if s.file == nil {
+		return saveDeadLetter(s.filename, s.headers, nil)
+	}
+	s.writer.Flush()
+	err := s.writer.Error()
+	if closeErr := s.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
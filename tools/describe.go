@@ -0,0 +1,390 @@
+package tools
+
+import (
+	"flag"
+	"fmt"
+	"html"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"ai-general-tool/common"
+)
+
+// columnStats are the summary statistics of a column: quartiles and moments
+// of its values for numeric columns, the range for dates and value lengths
+// for everything else
+type columnStats struct {
+	Name     string
+	Type     common.DataType
+	Count    int // non-null values
+	Nulls    int
+	Unique   int
+	Invalid  int       // non-null values of a numeric or date column that do not parse
+	Numbers  []float64 // sorted values of a numeric column
+	Dates    []time.Time
+	Lengths  []float64 // sorted lengths in characters of a text column
+	Examples []string
+}
+
+// RunDescribe handles the describe command
+func RunDescribe(args []string) error {
+	fs := flag.NewFlagSet("describe", flag.ExitOnError)
+
+	// Define flags
+	inputFile := fs.String("input", "", "Input file (CSV, Excel or JSON)")
+	columns := fs.String("columns", "", "Comma-separated columns to describe (default: all)")
+	format := fs.String("format", "text", "Output format: text, md (Markdown), html, json")
+	applyJSON := jsonFlag(fs, format)
+	input := inputFlags(fs)
+	var locale common.Locale
+	localeFlag(fs, &locale)
+
+	// Parse flags
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	applyJSON()
+	if !previewFormats[*format] {
+		return fmt.Errorf("invalid format '%s' (use text, md, html or json)", *format)
+	}
+
+	// Handle positional argument for filename
+	if *inputFile == "" && fs.NArg() > 0 {
+		*inputFile = fs.Arg(0)
+	}
+
+	if *inputFile == "" {
+		return fmt.Errorf("input file is required")
+	}
+
+	headers, rows, err := loadInputFile(*inputFile, *input)
+	if err != nil {
+		return fmt.Errorf("error loading file: %v", err)
+	}
+	indexes, err := columnIndexes(headers, *columns)
+	if err != nil {
+		return err
+	}
+
+	stats := make([]columnStats, len(indexes))
+	for i, index := range indexes {
+		values := make([]string, len(rows))
+		for r, row := range rows {
+			values[r] = cell(row, index)
+		}
+		stats[i] = describeColumn(headers[index], values, locale)
+	}
+
+	if *format == "json" {
+		return printJSON(describeJSON(*inputFile, len(rows), stats))
+	}
+	if *format != "text" {
+		printDescribeDocument(*inputFile, len(rows), stats, *format)
+		return nil
+	}
+
+	fmt.Printf("\n=== DESCRIBE: %s ===\n", *inputFile)
+	fmt.Printf("Rows: %d | Columns: %d\n", len(rows), len(headers))
+	for _, table := range describeTables(stats) {
+		fmt.Printf("\n%s:\n", strings.ToUpper(table.title))
+		fmt.Println(common.FormatTable(table.headers, table.rows, 160))
+	}
+	return nil
+}
+
+// columnIndexes resolves a comma-separated list of column names to their
+// indexes, or every column for an empty list
+func columnIndexes(headers []string, spec string) ([]int, error) {
+	var indexes []int
+	if strings.TrimSpace(spec) == "" {
+		for i := range headers {
+			indexes = append(indexes, i)
+		}
+		return indexes, nil
+	}
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.TrimSpace(name)
+		index := indexOf(headers, name)
+		if index == -1 {
+			return nil, fmt.Errorf("column '%s' not found", name)
+		}
+		indexes = append(indexes, index)
+	}
+	return indexes, nil
+}
+
+// isNumericType reports whether values of a type are read as numbers
+func isNumericType(t common.DataType) bool {
+	return t == common.TypeNumber || t == common.TypeCurrency || t == common.TypePercentage
+}
+
+// numericValue reads a value of a numeric column, accepting plain numbers,
+// amounts and percentages alike since a column is typed by most of its values
+func numericValue(value string, locale common.Locale) (float64, bool) {
+	if number, ok := common.ParseNumber(value, locale); ok {
+		return number, true
+	}
+	if number, ok := common.ParsePercentage(value, locale); ok {
+		return number, true
+	}
+	return common.ParseCurrency(value, locale)
+}
+
+// describeColumn computes the statistics of a column's values, using the
+// column type detected by the read commands
+func describeColumn(name string, values []string, locale common.Locale) columnStats {
+	stats := columnStats{Name: name}
+	types := common.TypeCounter{Locale: locale}
+	seen := make(map[string]bool)
+	for _, value := range values {
+		types.Add(value)
+		if common.IsNull(value) {
+			stats.Nulls++
+			continue
+		}
+		stats.Count++
+		if !seen[value] {
+			seen[value] = true
+			if len(stats.Examples) < 3 {
+				stats.Examples = append(stats.Examples, common.TruncateString(value, 20))
+			}
+		}
+	}
+	stats.Unique = len(seen)
+	stats.Type = types.Type()
+
+	for _, value := range values {
+		if common.IsNull(value) {
+			continue
+		}
+		switch {
+		case isNumericType(stats.Type):
+			if number, ok := numericValue(value, locale); ok {
+				stats.Numbers = append(stats.Numbers, number)
+			} else {
+				stats.Invalid++
+			}
+		case stats.Type == common.TypeDate:
+			if date, ok := common.ParseDate(value, locale); ok {
+				stats.Dates = append(stats.Dates, date)
+			} else {
+				stats.Invalid++
+			}
+		default:
+			stats.Lengths = append(stats.Lengths, float64(len([]rune(strings.TrimSpace(value)))))
+		}
+	}
+	sort.Float64s(stats.Numbers)
+	sort.Float64s(stats.Lengths)
+	sort.Slice(stats.Dates, func(i, j int) bool { return stats.Dates[i].Before(stats.Dates[j]) })
+	return stats
+}
+
+// quantile returns the q-quantile of sorted values, interpolating linearly
+// between the closest ranks as spreadsheets' PERCENTILE does
+func quantile(sorted []float64, q float64) float64 {
+	if len(sorted) == 0 {
+		return math.NaN()
+	}
+	pos := q * float64(len(sorted)-1)
+	lower := int(math.Floor(pos))
+	if lower+1 >= len(sorted) {
+		return sorted[len(sorted)-1]
+	}
+	return sorted[lower] + (pos-float64(lower))*(sorted[lower+1]-sorted[lower])
+}
+
+// meanStddev returns the mean and the sample standard deviation of values
+func meanStddev(values []float64) (float64, float64) {
+	if len(values) == 0 {
+		return math.NaN(), math.NaN()
+	}
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	mean := sum / float64(len(values))
+	if len(values) < 2 {
+		return mean, 0
+	}
+	squares := 0.0
+	for _, v := range values {
+		squares += (v - mean) * (v - mean)
+	}
+	return mean, math.Sqrt(squares / float64(len(values)-1))
+}
+
+// formatStat formats a statistic for display, with at most 4 decimals
+func formatStat(v float64) string {
+	if math.IsNaN(v) {
+		return ""
+	}
+	return strconv.FormatFloat(common.Round(v, 4), 'f', -1, 64)
+}
+
+// describeTable is one of the tables of the describe output
+type describeTable struct {
+	title   string
+	headers []string
+	rows    [][]string
+}
+
+// describeTables lays the statistics out as a table per kind of column:
+// numeric, date and text. Kinds without columns are left out.
+func describeTables(stats []columnStats) []describeTable {
+	numeric := describeTable{title: "Numeric columns", headers: []string{"Column", "Type", "Count", "Nulls", "Invalid", "Min", "Q1", "Median", "Q3", "Max", "Mean", "Stddev"}}
+	dates := describeTable{title: "Date columns", headers: []string{"Column", "Count", "Nulls", "Invalid", "Earliest", "Median", "Latest", "Span (days)"}}
+	text := describeTable{title: "Text columns", headers: []string{"Column", "Type", "Count", "Nulls", "Unique", "Min len", "Median len", "Max len", "Mean len", "Examples"}}
+
+	for _, s := range stats {
+		counts := []string{strconv.Itoa(s.Count), fmt.Sprintf("%d (%s)", s.Nulls, common.FormatPercentage(s.Nulls, s.Count+s.Nulls))}
+		switch {
+		case isNumericType(s.Type):
+			mean, stddev := meanStddev(s.Numbers)
+			row := append([]string{s.Name, string(s.Type)}, counts...)
+			row = append(row, strconv.Itoa(s.Invalid))
+			for _, q := range []float64{0, 0.25, 0.5, 0.75, 1} {
+				row = append(row, formatStat(quantile(s.Numbers, q)))
+			}
+			numeric.rows = append(numeric.rows, append(row, formatStat(mean), formatStat(stddev)))
+		case s.Type == common.TypeDate:
+			row := append(append([]string{s.Name}, counts...), strconv.Itoa(s.Invalid), "", "", "", "")
+			if n := len(s.Dates); n > 0 {
+				first, last := s.Dates[0], s.Dates[n-1]
+				row[4], row[5], row[6] = formatDate(first), formatDate(s.Dates[(n-1)/2]), formatDate(last)
+				row[7] = formatStat(last.Sub(first).Hours() / 24)
+			}
+			dates.rows = append(dates.rows, row)
+		default:
+			mean, _ := meanStddev(s.Lengths)
+			row := append([]string{s.Name, string(s.Type)}, counts...)
+			row = append(row, strconv.Itoa(s.Unique))
+			for _, q := range []float64{0, 0.5, 1} {
+				row = append(row, formatStat(quantile(s.Lengths, q)))
+			}
+			text.rows = append(text.rows, append(row, formatStat(mean), strings.Join(s.Examples, ", ")))
+		}
+	}
+
+	var tables []describeTable
+	for _, table := range []describeTable{numeric, dates, text} {
+		if len(table.rows) > 0 {
+			tables = append(tables, table)
+		}
+	}
+	return tables
+}
+
+// describeOutput is the JSON output of describe
+type describeOutput struct {
+	File    string            `json:"file"`
+	Rows    int               `json:"rows"`
+	Columns []describedColumn `json:"columns"`
+}
+
+// describedColumn is a column in the JSON output of describe. Numbers is set
+// for numeric columns, Dates for date columns and Lengths, the lengths of the
+// values in characters, for the others; none is set without valid values.
+type describedColumn struct {
+	Name     string          `json:"name"`
+	Type     common.DataType `json:"type"`
+	Count    int             `json:"count"`
+	Nulls    int             `json:"nulls"`
+	Unique   int             `json:"unique"`
+	Invalid  int             `json:"invalid"`
+	Numbers  *numberSummary  `json:"numbers,omitempty"`
+	Dates    *dateSummary    `json:"dates,omitempty"`
+	Lengths  *numberSummary  `json:"lengths,omitempty"`
+	Examples []string        `json:"examples"`
+}
+
+// numberSummary are the quartiles and moments of sorted values
+type numberSummary struct {
+	Min    float64 `json:"min"`
+	Q1     float64 `json:"q1"`
+	Median float64 `json:"median"`
+	Q3     float64 `json:"q3"`
+	Max    float64 `json:"max"`
+	Mean   float64 `json:"mean"`
+	Stddev float64 `json:"stddev"`
+}
+
+// dateSummary is the range of sorted dates
+type dateSummary struct {
+	Earliest string  `json:"earliest"`
+	Median   string  `json:"median"`
+	Latest   string  `json:"latest"`
+	SpanDays float64 `json:"span_days"`
+}
+
+// describeJSON arranges the statistics for JSON output, rounded as in the
+// tables
+func describeJSON(filename string, rows int, stats []columnStats) describeOutput {
+	output := describeOutput{File: filename, Rows: rows, Columns: []describedColumn{}}
+	for _, s := range stats {
+		column := describedColumn{Name: s.Name, Type: s.Type, Count: s.Count, Nulls: s.Nulls, Unique: s.Unique, Invalid: s.Invalid, Examples: s.Examples}
+		if column.Examples == nil {
+			column.Examples = []string{}
+		}
+		switch {
+		case isNumericType(s.Type):
+			column.Numbers = summarizeNumbers(s.Numbers)
+		case s.Type == common.TypeDate:
+			if n := len(s.Dates); n > 0 {
+				first, last := s.Dates[0], s.Dates[n-1]
+				column.Dates = &dateSummary{formatDate(first), formatDate(s.Dates[(n-1)/2]), formatDate(last), common.Round(last.Sub(first).Hours()/24, 4)}
+			}
+		default:
+			column.Lengths = summarizeNumbers(s.Lengths)
+		}
+		output.Columns = append(output.Columns, column)
+	}
+	return output
+}
+
+// summarizeNumbers returns the quartiles and moments of sorted values, or
+// nil when there are none
+func summarizeNumbers(sorted []float64) *numberSummary {
+	if len(sorted) == 0 {
+		return nil
+	}
+	mean, stddev := meanStddev(sorted)
+	round := func(v float64) float64 { return common.Round(v, 4) }
+	return &numberSummary{
+		Min:    round(quantile(sorted, 0)),
+		Q1:     round(quantile(sorted, 0.25)),
+		Median: round(quantile(sorted, 0.5)),
+		Q3:     round(quantile(sorted, 0.75)),
+		Max:    round(quantile(sorted, 1)),
+		Mean:   round(mean),
+		Stddev: round(stddev),
+	}
+}
+
+// formatDate formats a date, with its time when it has one
+func formatDate(t time.Time) string {
+	if t.Hour() == 0 && t.Minute() == 0 && t.Second() == 0 {
+		return t.Format("2006-01-02")
+	}
+	return t.Format("2006-01-02 15:04:05")
+}
+
+// printDescribeDocument prints the statistics as Markdown or HTML
+func printDescribeDocument(filename string, rows int, stats []columnStats, format string) {
+	summary := fmt.Sprintf("%d rows, %d columns described", rows, len(stats))
+	if format == "md" {
+		fmt.Printf("# %s\n\n%s\n", filename, summary)
+		for _, table := range describeTables(stats) {
+			fmt.Printf("\n## %s\n\n%s", table.title, common.FormatMarkdownTable(table.headers, table.rows))
+		}
+		return
+	}
+	body := fmt.Sprintf("<h1>%s</h1>\n<p>%s</p>\n", html.EscapeString(filename), summary)
+	for _, table := range describeTables(stats) {
+		body += fmt.Sprintf("<h2>%s</h2>\n%s", table.title, common.FormatHTMLTable(table.headers, table.rows))
+	}
+	fmt.Print(htmlDocument(filename, body))
+}
@@ -0,0 +1,240 @@
+package tools
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"ai-general-tool/common"
+)
+
+// duplicateOfColumn gives, in the duplicates-only output, the data row (1-based)
+// of the row each duplicate was matched to; it is empty for that row itself
+const duplicateOfColumn = "_duplicate_of"
+
+// RunDuplicates handles the duplicates command: it reports rows repeating the
+// key columns of an earlier row, exactly or ignoring case and whitespace, and
+// can write the file without them or the duplicate groups alone
+func RunDuplicates(args []string) error {
+	fs := flag.NewFlagSet("duplicates", flag.ExitOnError)
+
+	// Define flags
+	inputFile := fs.String("input", "", "Input file (CSV, Excel or JSON)")
+	keys := fs.String("keys", "", "Comma-separated columns identifying a row, e.g. email (default: all columns)")
+	match := fs.String("match", "normalized", "What counts as a duplicate: exact, or normalized (ignoring case and extra whitespace)")
+	keep := fs.String("keep", "first", "Row of each group kept by -output: first or last")
+	outputFile := fs.String("output", "", "Write the file without duplicates")
+	duplicatesFile := fs.String("duplicates-output", "", "Write the duplicate groups only, with a "+duplicateOfColumn+" column")
+	examples := fs.Int("examples", 10, "Largest duplicate groups listed")
+	input := inputFlags(fs)
+	output := &OutputOptions{}
+	fs.StringVar(&output.Format, "format", "same", "Output format: same, csv, sqlite, ods, md (Markdown table), html")
+	fs.BoolVar(&output.QuoteAll, "quote-all", false, "Quote every field of CSV output")
+
+	// Parse flags
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	// Handle positional argument for filename
+	if *inputFile == "" && fs.NArg() > 0 {
+		*inputFile = fs.Arg(0)
+	}
+
+	// Validation
+	if *inputFile == "" {
+		return fmt.Errorf("input file is required")
+	}
+	if *match != "exact" && *match != "normalized" {
+		return fmt.Errorf("invalid match '%s' (use exact or normalized)", *match)
+	}
+	if *keep != "first" && *keep != "last" {
+		return fmt.Errorf("invalid keep '%s' (use first or last)", *keep)
+	}
+	for _, name := range []string{*outputFile, *duplicatesFile} {
+		if name != "" && name == *inputFile {
+			return fmt.Errorf("output would overwrite the input %s", *inputFile)
+		}
+	}
+
+	headers, rows, err := loadInputFile(*inputFile, *input)
+	if err != nil {
+		return fmt.Errorf("error loading file: %v", err)
+	}
+	indexes, err := columnIndexes(headers, *keys)
+	if err != nil {
+		return err
+	}
+	keyNames := make([]string, len(indexes))
+	for i, index := range indexes {
+		keyNames[i] = headers[index]
+	}
+
+	exact := duplicateGroups(rows, indexes, false)
+	normalized := duplicateGroups(rows, indexes, true)
+	groups := normalized
+	if *match == "exact" {
+		groups = exact
+	}
+
+	fmt.Printf("\n=== DUPLICATES: %s ===\n", *inputFile)
+	fmt.Printf("Rows: %d | Keys: %s\n", len(rows), strings.Join(keyNames, ", "))
+	fmt.Printf("Exact duplicates: %d rows in %d groups\n", exact.duplicates(), len(exact.groups))
+	fmt.Printf("Duplicates ignoring case and whitespace: %d rows in %d groups\n", normalized.duplicates(), len(normalized.groups))
+	if groups.blank > 0 {
+		fmt.Printf("Rows with empty keys, never counted as duplicates: %d\n", groups.blank)
+	}
+
+	if len(groups.groups) > 0 && *examples > 0 {
+		var tableRows [][]string
+		for _, group := range groups.largest(*examples) {
+			var rowNumbers []string
+			for _, r := range group[:min(len(group), 10)] {
+				rowNumbers = append(rowNumbers, strconv.Itoa(r+1))
+			}
+			if len(group) > 10 {
+				rowNumbers = append(rowNumbers, "...")
+			}
+			tableRows = append(tableRows, []string{groups.label(rows[group[0]]), strconv.Itoa(len(group)), strings.Join(rowNumbers, ", ")})
+		}
+		fmt.Printf("\nLARGEST GROUPS (%s):\n", *match)
+		fmt.Println(common.FormatTable([]string{"Key", "Rows", "Data rows"}, tableRows, 120))
+	}
+
+	if *outputFile != "" {
+		kept := groups.deduplicated(rows, *keep == "last")
+		if err := saveOutputTable(*outputFile, headers, kept, nil, *output); err != nil {
+			return fmt.Errorf("error saving output: %v", err)
+		}
+		fmt.Printf("\n%d rows without duplicates saved to: %s\n", len(kept), *outputFile)
+	}
+	if *duplicatesFile != "" {
+		var dupRows [][]string
+		for _, group := range groups.groups {
+			first := group[0]
+			if *keep == "last" {
+				first = group[len(group)-1]
+			}
+			for _, r := range group {
+				of := ""
+				if r != first {
+					of = strconv.Itoa(first + 1)
+				}
+				dupRows = append(dupRows, append(append(make([]string, 0, len(headers)+1), padRow(rows[r], len(headers))...), of))
+			}
+		}
+		if err := saveOutputTable(*duplicatesFile, append(append([]string{}, headers...), duplicateOfColumn), dupRows, nil, *output); err != nil {
+			return fmt.Errorf("error saving duplicates: %v", err)
+		}
+		fmt.Printf("%d rows of duplicate groups saved to: %s\n", len(dupRows), *duplicatesFile)
+	}
+	return nil
+}
+
+// padRow returns a row with exactly width cells
+func padRow(row []string, width int) []string {
+	padded := make([]string, width)
+	copy(padded, row)
+	return padded
+}
+
+// duplicateKeys groups the rows of an input by their key columns
+type duplicateKeys struct {
+	indexes   []int
+	normalize bool
+	groups    [][]int // data rows (0-based) of every key found more than once, in input order
+	blank     int     // rows whose key columns are all empty
+}
+
+// duplicateGroups finds the rows sharing their key values. Normalized keys
+// ignore case and leading, trailing and repeated whitespace.
+func duplicateGroups(rows [][]string, indexes []int, normalize bool) duplicateKeys {
+	d := duplicateKeys{indexes: indexes, normalize: normalize}
+	byKey := make(map[string][]int)
+	var order []string
+	for r, row := range rows {
+		key, blank := d.key(row)
+		if blank {
+			d.blank++
+			continue
+		}
+		if _, ok := byKey[key]; !ok {
+			order = append(order, key)
+		}
+		byKey[key] = append(byKey[key], r)
+	}
+	for _, key := range order {
+		if len(byKey[key]) > 1 {
+			d.groups = append(d.groups, byKey[key])
+		}
+	}
+	return d
+}
+
+// key returns the key of a row and whether its key columns are all empty
+func (d duplicateKeys) key(row []string) (string, bool) {
+	parts := make([]string, len(d.indexes))
+	blank := true
+	for i, index := range d.indexes {
+		value := cell(row, index)
+		if d.normalize {
+			value = strings.ToLower(strings.Join(strings.Fields(value), " "))
+		}
+		if strings.TrimSpace(value) != "" {
+			blank = false
+		}
+		parts[i] = value
+	}
+	return strings.Join(parts, "\x00"), blank
+}
+
+// label shows the key of a row for the report
+func (d duplicateKeys) label(row []string) string {
+	parts := make([]string, len(d.indexes))
+	for i, index := range d.indexes {
+		parts[i] = common.TruncateString(cell(row, index), 40)
+	}
+	return strings.Join(parts, " | ")
+}
+
+// duplicates returns the number of rows that repeat an earlier row
+func (d duplicateKeys) duplicates() int {
+	n := 0
+	for _, group := range d.groups {
+		n += len(group) - 1
+	}
+	return n
+}
+
+// largest returns up to n groups, largest first
+func (d duplicateKeys) largest(n int) [][]int {
+	sorted := append([][]int{}, d.groups...)
+	sort.SliceStable(sorted, func(i, j int) bool { return len(sorted[i]) > len(sorted[j]) })
+	return sorted[:min(n, len(sorted))]
+}
+
+// deduplicated returns the rows with one row per group, the first or the
+// last of it, in input order
+func (d duplicateKeys) deduplicated(rows [][]string, last bool) [][]string {
+	dropped := make(map[int]bool)
+	for _, group := range d.groups {
+		kept := group[0]
+		if last {
+			kept = group[len(group)-1]
+		}
+		for _, r := range group {
+			if r != kept {
+				dropped[r] = true
+			}
+		}
+	}
+	kept := make([][]string, 0, len(rows)-len(dropped))
+	for r, row := range rows {
+		if !dropped[r] {
+			kept = append(kept, row)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,226 @@
+package tools
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// BuiltinEnricher computes new columns locally from a single source column,
+// without calling the AI API
+type BuiltinEnricher interface {
+	// Columns returns the default names of the columns produced
+	Columns() []string
+	// Enrich computes the column values for a single source value
+	Enrich(value string) ([]string, error)
+}
+
+// enrichOptions holds the settings shared by all built-in enrichers
+type enrichOptions struct {
+	GeoIPDB     string // comma-separated MaxMind database paths
+	LLMFallback bool   // use the AI API when local heuristics are insufficient
+	Geocoder    string // geocoding provider name, empty to disable
+}
+
+// builtinEnrichers maps enrichment names to their constructors
+var builtinEnrichers = map[string]func(opts enrichOptions) (BuiltinEnricher, error){
+	"lang":    newLanguageEnricher,
+	"ip":      newIPEnricher,
+	"address": newAddressEnricher,
+}
+
+// RunEnrich handles the enrich command
+func RunEnrich(args []string) error {
+	fs := flag.NewFlagSet("enrich", flag.ExitOnError)
+
+	// Define flags
+	inputFile := fs.String("input", "", "Input file (CSV, Excel or JSON)")
+	outputFile := fs.String("output", "", "Output file (optional, defaults to input_enriched)")
+	enrichType := fs.String("type", "", "Built-in enrichment: "+strings.Join(builtinEnricherNames(), ", "))
+	sourceColumn := fs.String("column", "", "Name of the column to enrich")
+	columns := fs.String("columns", "", "Comma-separated names for the new columns (optional)")
+	geoIPDB := fs.String("geoip-db", "", "Comma-separated MaxMind .mmdb files for the ip enrichment")
+	llmFallback := fs.Bool("llm-fallback", false, "Use the AI API for values the local heuristics cannot handle")
+	geocoder := fs.String("geocoder", "", "Geocoding provider for the address enrichment: nominatim")
+	input := inputFlags(fs)
+	output := outputFlags(fs)
+	outputTemplate := fs.String("output-template", "", "Output file name template, e.g. \"{{.Stem}}_{{.Date}}_{{.Model}}.xlsx\"")
+
+	// Parse flags
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	// Handle positional argument for filename
+	if *inputFile == "" && fs.NArg() > 0 {
+		*inputFile = fs.Arg(0)
+	}
+
+	// Validation
+	if *inputFile == "" {
+		return fmt.Errorf("input file is required")
+	}
+	if *sourceColumn == "" {
+		return fmt.Errorf("source column is required")
+	}
+	toStdout, err := useStdout(*inputFile, outputFile, *output)
+	if err != nil {
+		return err
+	}
+	newEnricher, ok := builtinEnrichers[*enrichType]
+	if !ok {
+		return fmt.Errorf("unknown enrichment type '%s' (available: %s)", *enrichType, strings.Join(builtinEnricherNames(), ", "))
+	}
+
+	enricher, err := newEnricher(enrichOptions{
+		GeoIPDB:     *geoIPDB,
+		LLMFallback: *llmFallback,
+		Geocoder:    *geocoder,
+	})
+	if err != nil {
+		return err
+	}
+	if closer, ok := enricher.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	// Resolve output column names
+	columnNames := enricher.Columns()
+	if *columns != "" {
+		custom := strings.Split(*columns, ",")
+		if len(custom) != len(columnNames) {
+			return fmt.Errorf("enrichment '%s' produces %d columns but %d names were given", *enrichType, len(columnNames), len(custom))
+		}
+		for i := range custom {
+			columnNames[i] = strings.TrimSpace(custom[i])
+		}
+	}
+	columnSpecs := make([]ColumnSpec, len(columnNames))
+	for i, name := range columnNames {
+		columnSpecs[i] = ColumnSpec{Name: name, DataType: "string"}
+	}
+
+	if *outputFile == "" && *outputTemplate != "" {
+		name, err := renderOutputTemplate(*outputTemplate, newOutputNameData("enrich", *inputFile, output.Format, "", columnSpecs))
+		if err != nil {
+			return err
+		}
+		*outputFile = name
+	}
+	if *outputFile == "" {
+		*outputFile = defaultOutputFile(*inputFile, output.Format)
+	}
+	if *outputFile, err = output.compressedName(*outputFile); err != nil {
+		return err
+	}
+
+	// Load input data
+	fmt.Printf("Loading %s...\n", *inputFile)
+	headers, rows, err := loadInputFile(*inputFile, *input)
+	if err != nil {
+		return fmt.Errorf("error loading input: %v", err)
+	}
+	if err := output.setInput(*inputFile, *input, headers); err != nil {
+		return err
+	}
+
+	sourceIdx := -1
+	for i, header := range headers {
+		if header == *sourceColumn {
+			sourceIdx = i
+			break
+		}
+	}
+	if sourceIdx == -1 {
+		return fmt.Errorf("column '%s' not found in %s", *sourceColumn, *inputFile)
+	}
+
+	fmt.Printf("Loaded %d rows with %d columns\n", len(rows), len(headers))
+	fmt.Printf("Running '%s' enrichment on column '%s'...\n", *enrichType, *sourceColumn)
+
+	// Enrich every row; failed rows keep empty columns and the status
+	// columns say why
+	startTime := time.Now()
+	failed := 0
+	columnSpecs = append(columnSpecs, statusColumnSpecs()...)
+	enrichedRows := make([][]string, len(rows))
+	for i, row := range rows {
+		enrichedRows[i] = make([]string, len(headers)+len(columnSpecs))
+		copy(enrichedRows[i], row)
+
+		value := ""
+		if sourceIdx < len(row) {
+			value = row[sourceIdx]
+		}
+
+		results, err := enricher.Enrich(value)
+		class := ""
+		if err != nil {
+			failed++
+			class = errorOther
+		} else {
+			copy(enrichedRows[i][len(headers):], results)
+		}
+		status := make(map[string]string)
+		setRowStatus(status, class, err, 1)
+		for j, spec := range columnSpecs {
+			if isStatusColumn(spec.Name) {
+				enrichedRows[i][len(headers)+j] = status[spec.Name]
+			}
+		}
+	}
+	enrichedRows, columnSpecs = dropStatusColumns(headers, enrichedRows, columnSpecs)
+
+	// Record how the output was produced
+	runInfo := &RunInfo{
+		Command:       "enrich",
+		Input:         *inputFile,
+		Output:        *outputFile,
+		StartedAt:     startTime,
+		FinishedAt:    time.Now(),
+		Rows:          len(rows),
+		CompletedRows: len(rows) - failed,
+		FailedRows:    failed,
+	}
+	for _, spec := range columnSpecs {
+		source := *enrichType
+		if isStatusColumn(spec.Name) {
+			source = "status"
+		}
+		runInfo.Columns = append(runInfo.Columns, RunColumn{
+			Name:        spec.Name,
+			Source:      source,
+			Overwritten: indexOf(headers, spec.Name) != -1,
+		})
+	}
+
+	output.Run = runInfo
+	if err := saveOutputFile(*outputFile, headers, enrichedRows, columnSpecs, *output); err != nil {
+		return fmt.Errorf("error saving output: %v", err)
+	}
+	if err := writeRunInfo(*outputFile, runInfo); err != nil {
+		warnf("could not write run info: %v", err)
+	}
+
+	fmt.Printf("Enriched %d rows (%d failed)\n", len(rows), failed)
+	if toStdout {
+		fmt.Println("Output written to stdout")
+	} else {
+		fmt.Printf("Output saved to: %s\n", *outputFile)
+	}
+
+	return nil
+}
+
+// builtinEnricherNames returns the sorted names of all built-in enrichments
+func builtinEnricherNames() []string {
+	names := make([]string, 0, len(builtinEnrichers))
+	for name := range builtinEnrichers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,220 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/openai/openai-go"
+)
+
+// postalCodePatterns are tried in order; more specific formats come first
+var postalCodePatterns = []*regexp.Regexp{
+	regexp.MustCompile(`\b[A-Z]{1,2}\d[A-Z\d]? ?\d[A-Z]{2}\b`), // UK
+	regexp.MustCompile(`\b[A-Z]\d[A-Z] ?\d[A-Z]\d\b`),          // Canada
+	regexp.MustCompile(`\b\d{5}-\d{4}\b`),                      // US ZIP+4
+	regexp.MustCompile(`\b\d{4} ?[A-Z]{2}\b`),                  // Netherlands
+	regexp.MustCompile(`\b\d{2}-\d{3}\b`),                      // Poland
+	regexp.MustCompile(`\b\d{3}-\d{4}\b`),                      // Japan
+	regexp.MustCompile(`\b\d{4}-\d{3}\b`),                      // Portugal
+	regexp.MustCompile(`\b\d{4,6}\b`),                          // Generic numeric
+}
+
+// usStatePattern matches a trailing two-letter US state or province code
+var usStatePattern = regexp.MustCompile(`^[A-Z]{2}$`)
+
+// usZipPattern matches US ZIP codes
+var usZipPattern = regexp.MustCompile(`^\d{5}(-\d{4})?$`)
+
+// addressCountries maps lowercase country names and codes to canonical names
+var addressCountries = map[string]string{
+	"usa": "United States", "us": "United States", "u.s.a.": "United States", "united states": "United States", "united states of america": "United States",
+	"uk": "United Kingdom", "u.k.": "United Kingdom", "united kingdom": "United Kingdom", "great britain": "United Kingdom", "england": "United Kingdom", "scotland": "United Kingdom", "wales": "United Kingdom",
+	"canada": "Canada", "mexico": "Mexico", "brazil": "Brazil", "argentina": "Argentina", "chile": "Chile", "colombia": "Colombia", "peru": "Peru",
+	"ireland": "Ireland", "france": "France", "germany": "Germany", "deutschland": "Germany", "spain": "Spain", "españa": "Spain", "portugal": "Portugal",
+	"italy": "Italy", "italia": "Italy", "netherlands": "Netherlands", "the netherlands": "Netherlands", "nederland": "Netherlands", "belgium": "Belgium",
+	"luxembourg": "Luxembourg", "switzerland": "Switzerland", "schweiz": "Switzerland", "suisse": "Switzerland", "austria": "Austria", "österreich": "Austria",
+	"denmark": "Denmark", "sweden": "Sweden", "norway": "Norway", "finland": "Finland", "iceland": "Iceland", "poland": "Poland", "polska": "Poland",
+	"czech republic": "Czech Republic", "czechia": "Czech Republic", "slovakia": "Slovakia", "hungary": "Hungary", "romania": "Romania", "bulgaria": "Bulgaria",
+	"greece": "Greece", "turkey": "Turkey", "türkiye": "Turkey", "malta": "Malta", "cyprus": "Cyprus", "croatia": "Croatia", "slovenia": "Slovenia", "serbia": "Serbia",
+	"ukraine": "Ukraine", "russia": "Russia", "estonia": "Estonia", "latvia": "Latvia", "lithuania": "Lithuania",
+	"china": "China", "japan": "Japan", "south korea": "South Korea", "korea": "South Korea", "india": "India", "pakistan": "Pakistan", "bangladesh": "Bangladesh",
+	"singapore": "Singapore", "malaysia": "Malaysia", "indonesia": "Indonesia", "thailand": "Thailand", "vietnam": "Vietnam", "philippines": "Philippines",
+	"australia": "Australia", "new zealand": "New Zealand", "south africa": "South Africa", "nigeria": "Nigeria", "kenya": "Kenya", "egypt": "Egypt", "morocco": "Morocco",
+	"israel": "Israel", "united arab emirates": "United Arab Emirates", "uae": "United Arab Emirates", "saudi arabia": "Saudi Arabia", "qatar": "Qatar",
+}
+
+// addressEnricher splits free-text addresses into components
+type addressEnricher struct {
+	client   *openai.Client // nil unless LLM fallback is enabled
+	geocoder Geocoder       // nil unless geocoding is enabled
+}
+
+func newAddressEnricher(opts enrichOptions) (BuiltinEnricher, error) {
+	enricher := &addressEnricher{}
+
+	if opts.LLMFallback {
+		client, err := newOpenAIClient()
+		if err != nil {
+			return nil, fmt.Errorf("%v (required for -llm-fallback)", err)
+		}
+		enricher.client = client
+	}
+
+	if opts.Geocoder != "" {
+		newGeocoder, ok := geocoders[opts.Geocoder]
+		if !ok {
+			return nil, fmt.Errorf("unknown geocoder '%s'", opts.Geocoder)
+		}
+		geocoder, err := newGeocoder()
+		if err != nil {
+			return nil, err
+		}
+		enricher.geocoder = geocoder
+	}
+
+	return enricher, nil
+}
+
+// Columns returns the default output column names
+func (e *addressEnricher) Columns() []string {
+	columns := []string{"street", "city", "postal_code", "country"}
+	if e.geocoder != nil {
+		columns = append(columns, "latitude", "longitude")
+	}
+	return columns
+}
+
+// Enrich parses the address, falling back to the LLM when the heuristics
+// cannot identify both street and city
+func (e *addressEnricher) Enrich(value string) ([]string, error) {
+	if strings.TrimSpace(value) == "" {
+		return make([]string, len(e.Columns())), nil
+	}
+
+	parsed := parseAddress(value)
+	if (parsed.Street == "" || parsed.City == "") && e.client != nil {
+		llmParsed, err := e.parseWithLLM(value)
+		if err != nil {
+			return nil, err
+		}
+		parsed = llmParsed
+	}
+
+	results := []string{parsed.Street, parsed.City, parsed.PostalCode, parsed.Country}
+	if e.geocoder != nil {
+		lat, lon, found, err := e.geocoder.Geocode(value)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			results = append(results, strconv.FormatFloat(lat, 'f', 6, 64), strconv.FormatFloat(lon, 'f', 6, 64))
+		} else {
+			results = append(results, "", "")
+		}
+	}
+
+	return results, nil
+}
+
+// parseWithLLM asks the model to split an address the heuristics could not
+func (e *addressEnricher) parseWithLLM(value string) (parsedAddress, error) {
+	specs := []ColumnSpec{
+		{Name: "street", DataType: "string"},
+		{Name: "city", DataType: "string"},
+		{Name: "postal_code", DataType: "string"},
+		{Name: "country", DataType: "string"},
+	}
+	prompt := "Split the address into street (including house number), city, postal code and country (full English name). Use an empty string for missing parts."
+
+	config := &ProcessingConfig{Client: e.client, ColumnSpecs: specs, Prompt: prompt}
+	result, err := processRow(context.Background(), config, map[string]string{"address": value})
+	if err != nil {
+		return parsedAddress{}, err
+	}
+
+	return parsedAddress{
+		Street:     result.Results["street"],
+		City:       result.Results["city"],
+		PostalCode: result.Results["postal_code"],
+		Country:    result.Results["country"],
+	}, nil
+}
+
+// parsedAddress holds the components of an address
+type parsedAddress struct {
+	Street     string
+	City       string
+	PostalCode string
+	Country    string
+}
+
+// parseAddress splits a comma-separated address using local heuristics
+func parseAddress(address string) parsedAddress {
+	var result parsedAddress
+
+	var parts []string
+	for _, part := range strings.Split(address, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	if len(parts) == 0 {
+		return result
+	}
+
+	// Country is usually the last part
+	if country, ok := addressCountries[strings.ToLower(parts[len(parts)-1])]; ok {
+		result.Country = country
+		parts = parts[:len(parts)-1]
+	}
+	if len(parts) == 0 {
+		return result // only a country, e.g. "Germany"
+	}
+
+	// Find the postal code, searching from the end where it usually appears
+	postalIdx := -1
+	for i := len(parts) - 1; i >= 0 && postalIdx == -1; i-- {
+		// Skip a leading street number like "221B Baker Street"
+		if i == 0 && len(parts) > 1 {
+			break
+		}
+		for _, pattern := range postalCodePatterns {
+			if loc := pattern.FindStringIndex(parts[i]); loc != nil {
+				result.PostalCode = parts[i][loc[0]:loc[1]]
+				parts[i] = strings.TrimSpace(parts[i][:loc[0]] + parts[i][loc[1]:])
+				postalIdx = i
+				break
+			}
+		}
+	}
+
+	// A leftover two-letter state code ("Springfield, IL 62704") means the
+	// city is in the preceding part
+	if postalIdx > 0 && usStatePattern.MatchString(parts[postalIdx]) {
+		parts = append(parts[:postalIdx], parts[postalIdx+1:]...)
+		postalIdx--
+		if result.Country == "" && usZipPattern.MatchString(result.PostalCode) {
+			result.Country = "United States"
+		}
+	}
+
+	switch {
+	case len(parts) == 0:
+	case len(parts) == 1:
+		result.Street = parts[0]
+	case postalIdx > 0 && parts[postalIdx] != "":
+		result.City = parts[postalIdx]
+		result.Street = strings.Join(parts[:postalIdx], ", ")
+	case postalIdx > 0:
+		result.City = parts[postalIdx-1]
+		result.Street = strings.Join(parts[:postalIdx-1], ", ")
+	default:
+		result.City = parts[len(parts)-1]
+		result.Street = strings.Join(parts[:len(parts)-1], ", ")
+	}
+
+	return result
+}
@@ -0,0 +1,89 @@
+package tools
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// geoRecord holds the fields read from MaxMind City/Country and ASN databases
+type geoRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+	ASN          uint   `maxminddb:"autonomous_system_number"`
+	Organization string `maxminddb:"autonomous_system_organization"`
+}
+
+// ipEnricher looks up IP addresses in one or more local MaxMind databases
+type ipEnricher struct {
+	readers []*maxminddb.Reader
+}
+
+func newIPEnricher(opts enrichOptions) (BuiltinEnricher, error) {
+	if opts.GeoIPDB == "" {
+		return nil, fmt.Errorf("the ip enrichment requires -geoip-db")
+	}
+
+	enricher := &ipEnricher{}
+	for _, path := range strings.Split(opts.GeoIPDB, ",") {
+		reader, err := maxminddb.Open(strings.TrimSpace(path))
+		if err != nil {
+			enricher.Close()
+			return nil, fmt.Errorf("error opening GeoIP database '%s': %v", path, err)
+		}
+		enricher.readers = append(enricher.readers, reader)
+	}
+
+	return enricher, nil
+}
+
+// Columns returns the default output column names
+func (e *ipEnricher) Columns() []string {
+	return []string{"ip_country", "ip_city", "ip_asn", "ip_org"}
+}
+
+// Close closes the databases once the lookups are done
+func (e *ipEnricher) Close() error {
+	var firstErr error
+	for _, reader := range e.readers {
+		if err := reader.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Enrich returns the country ISO code, city, ASN and AS organization of an IP
+func (e *ipEnricher) Enrich(value string) ([]string, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return []string{"", "", "", ""}, nil
+	}
+
+	ip := net.ParseIP(value)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid IP address '%s'", value)
+	}
+
+	// Each database fills the fields it knows about (City vs ASN editions)
+	var record geoRecord
+	for _, reader := range e.readers {
+		if err := reader.Lookup(ip, &record); err != nil {
+			return nil, err
+		}
+	}
+
+	asn := ""
+	if record.ASN > 0 {
+		asn = "AS" + strconv.FormatUint(uint64(record.ASN), 10)
+	}
+
+	return []string{record.Country.ISOCode, record.City.Names["en"], asn, record.Organization}, nil
+}
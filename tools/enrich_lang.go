@@ -0,0 +1,240 @@
+package tools
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Language detection uses the Cavnar-Trenkle "out-of-place" trigram ranking.
+// Latin-script languages are matched against profiles built from the short
+// reference texts below; other scripts are identified directly.
+
+const (
+	langProfileSize = 300
+	langMinLetters  = 3
+)
+
+// langSamples holds reference text used to build each language profile
+var langSamples = map[string]string{
+	"en": `All human beings are born free and equal in dignity and rights. They are endowed with reason and conscience and should act towards one another in a spirit of brotherhood.
+The weather was nice this morning so we decided to walk to the office. I would like to know when the next train leaves for the city and how much the ticket costs.
+Please send me the report by the end of the week. We have been working on this project for three months and the results are better than we expected.
+Thank you for your order, it will be shipped within two business days. If you have any questions about your account, please contact our support team.`,
+	"fr": `Tous les êtres humains naissent libres et égaux en dignité et en droits. Ils sont doués de raison et de conscience et doivent agir les uns envers les autres dans un esprit de fraternité.
+Il faisait beau ce matin alors nous avons décidé de marcher jusqu'au bureau. Je voudrais savoir quand part le prochain train pour la ville et combien coûte le billet.
+Merci de m'envoyer le rapport avant la fin de la semaine. Nous travaillons sur ce projet depuis trois mois et les résultats sont meilleurs que prévu.
+Merci pour votre commande, elle sera expédiée dans les deux jours ouvrables. Si vous avez des questions sur votre compte, veuillez contacter notre équipe.`,
+	"de": `Alle Menschen sind frei und gleich an Würde und Rechten geboren. Sie sind mit Vernunft und Gewissen begabt und sollen einander im Geist der Brüderlichkeit begegnen.
+Das Wetter war heute Morgen schön, also haben wir beschlossen, zu Fuß ins Büro zu gehen. Ich möchte wissen, wann der nächste Zug in die Stadt fährt und wie viel die Fahrkarte kostet.
+Bitte schicken Sie mir den Bericht bis zum Ende der Woche. Wir arbeiten seit drei Monaten an diesem Projekt und die Ergebnisse sind besser als erwartet.
+Vielen Dank für Ihre Bestellung, sie wird innerhalb von zwei Werktagen versandt. Wenn Sie Fragen zu Ihrem Konto haben, wenden Sie sich bitte an unser Team.`,
+	"es": `Todos los seres humanos nacen libres e iguales en dignidad y derechos y, dotados como están de razón y conciencia, deben comportarse fraternalmente los unos con los otros.
+Hacía buen tiempo esta mañana, así que decidimos caminar hasta la oficina. Me gustaría saber cuándo sale el próximo tren hacia la ciudad y cuánto cuesta el billete.
+Por favor, envíeme el informe antes del final de la semana. Llevamos tres meses trabajando en este proyecto y los resultados son mejores de lo que esperábamos.
+Gracias por su pedido, será enviado en un plazo de dos días hábiles. Si tiene alguna pregunta sobre su cuenta, póngase en contacto con nuestro equipo.`,
+	"it": `Tutti gli esseri umani nascono liberi ed eguali in dignità e diritti. Essi sono dotati di ragione e di coscienza e devono agire gli uni verso gli altri in spirito di fratellanza.
+Stamattina faceva bel tempo, quindi abbiamo deciso di andare in ufficio a piedi. Vorrei sapere quando parte il prossimo treno per la città e quanto costa il biglietto.
+Per favore mandami il rapporto entro la fine della settimana. Lavoriamo a questo progetto da tre mesi e i risultati sono migliori del previsto.
+Grazie per il suo ordine, sarà spedito entro due giorni lavorativi. Se ha domande sul suo account, contatti il nostro gruppo di assistenza.`,
+	"pt": `Todos os seres humanos nascem livres e iguais em dignidade e em direitos. Dotados de razão e de consciência, devem agir uns para com os outros em espírito de fraternidade.
+O tempo estava bom esta manhã, então decidimos ir a pé até o escritório. Eu gostaria de saber quando sai o próximo trem para a cidade e quanto custa a passagem.
+Por favor, envie-me o relatório até o final da semana. Estamos trabalhando neste projeto há três meses e os resultados são melhores do que esperávamos.
+Obrigado pelo seu pedido, ele será enviado em até dois dias úteis. Se tiver alguma dúvida sobre a sua conta, entre em contato com a nossa equipe.`,
+	"nl": `Alle mensen worden vrij en gelijk in waardigheid en rechten geboren. Zij zijn begiftigd met verstand en geweten, en behoren zich jegens elkander in een geest van broederschap te gedragen.
+Het weer was mooi vanochtend, dus we besloten naar het kantoor te lopen. Ik wil graag weten wanneer de volgende trein naar de stad vertrekt en hoeveel het kaartje kost.
+Stuur mij alstublieft het verslag voor het einde van de week. We werken al drie maanden aan dit project en de resultaten zijn beter dan we hadden verwacht.
+Bedankt voor uw bestelling, deze wordt binnen twee werkdagen verzonden. Als u vragen heeft over uw account, neem dan contact op met ons team.`,
+	"sv": `Alla människor är födda fria och lika i värde och rättigheter. De har utrustats med förnuft och samvete och bör handla gentemot varandra i en anda av broderskap.
+Vädret var fint i morse så vi bestämde oss för att gå till kontoret. Jag skulle vilja veta när nästa tåg går till staden och hur mycket biljetten kostar.
+Skicka mig rapporten före slutet av veckan. Vi har arbetat med det här projektet i tre månader och resultaten är bättre än vi hade väntat oss.
+Tack för din beställning, den skickas inom två arbetsdagar. Om du har frågor om ditt konto, kontakta vårt supportteam.`,
+	"pl": `Wszyscy ludzie rodzą się wolni i równi pod względem swej godności i swych praw. Są oni obdarzeni rozumem i sumieniem i powinni postępować wobec innych w duchu braterstwa.
+Dziś rano była ładna pogoda, więc postanowiliśmy pójść do biura pieszo. Chciałbym wiedzieć, kiedy odjeżdża następny pociąg do miasta i ile kosztuje bilet.
+Proszę przesłać mi raport do końca tygodnia. Pracujemy nad tym projektem od trzech miesięcy i wyniki są lepsze, niż się spodziewaliśmy.
+Dziękujemy za zamówienie, zostanie ono wysłane w ciągu dwóch dni roboczych. Jeśli masz pytania dotyczące konta, skontaktuj się z naszym zespołem.`,
+	"tr": `Bütün insanlar hür, haysiyet ve haklar bakımından eşit doğarlar. Akıl ve vicdana sahiptirler ve birbirlerine karşı kardeşlik zihniyeti ile hareket etmelidirler.
+Bu sabah hava güzeldi, bu yüzden ofise yürümeye karar verdik. Şehre giden bir sonraki trenin ne zaman kalktığını ve biletin ne kadar olduğunu öğrenmek istiyorum.
+Lütfen raporu hafta sonuna kadar bana gönderin. Bu proje üzerinde üç aydır çalışıyoruz ve sonuçlar beklediğimizden daha iyi.
+Siparişiniz için teşekkür ederiz, iki iş günü içinde kargoya verilecektir. Hesabınızla ilgili sorularınız varsa lütfen ekibimizle iletişime geçin.`,
+	"ro": `Toate ființele umane se nasc libere și egale în demnitate și în drepturi. Ele sunt înzestrate cu rațiune și conștiință și trebuie să se comporte unele față de altele în spiritul fraternității.
+Vremea a fost frumoasă în această dimineață, așa că am decis să mergem pe jos la birou. Aș dori să știu când pleacă următorul tren spre oraș și cât costă biletul.
+Vă rog să îmi trimiteți raportul până la sfârșitul săptămânii. Lucrăm la acest proiect de trei luni și rezultatele sunt mai bune decât ne așteptam.
+Vă mulțumim pentru comandă, aceasta va fi expediată în două zile lucrătoare. Dacă aveți întrebări despre contul dumneavoastră, contactați echipa noastră.`,
+	"fi": `Kaikki ihmiset syntyvät vapaina ja tasavertaisina arvoltaan ja oikeuksiltaan. Heille on annettu järki ja omatunto, ja heidän on toimittava toisiaan kohtaan veljeyden hengessä.
+Sää oli kaunis tänä aamuna, joten päätimme kävellä toimistolle. Haluaisin tietää, milloin seuraava juna lähtee kaupunkiin ja paljonko lippu maksaa.
+Lähetä minulle raportti viikon loppuun mennessä. Olemme työskennelleet tämän projektin parissa kolme kuukautta ja tulokset ovat odotettua parempia.
+Kiitos tilauksestasi, se lähetetään kahden arkipäivän kuluessa. Jos sinulla on kysyttävää tilistäsi, ota yhteyttä tukitiimiimme.`,
+}
+
+// langProfiles holds the ranked trigram profile of each language
+var langProfiles = buildLangProfiles()
+
+// languageEnricher detects the language of a text value
+type languageEnricher struct{}
+
+func newLanguageEnricher(opts enrichOptions) (BuiltinEnricher, error) {
+	return languageEnricher{}, nil
+}
+
+// Columns returns the default output column names
+func (languageEnricher) Columns() []string {
+	return []string{"language", "language_confidence"}
+}
+
+// Enrich returns the ISO 639-1 code and a confidence label for the value
+func (languageEnricher) Enrich(value string) ([]string, error) {
+	if strings.TrimSpace(value) == "" {
+		return []string{"", ""}, nil
+	}
+	lang, confidence := detectLanguage(value)
+	return []string{lang, fmt.Sprintf("%.2f", confidence)}, nil
+}
+
+// detectLanguage returns the ISO 639-1 code of the most likely language of
+// text along with a confidence between 0 and 1. "und" is returned when the
+// text is too short to classify.
+func detectLanguage(text string) (string, float64) {
+	// Identify non-Latin scripts directly
+	scripts := map[string]int{}
+	letters := 0
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		switch {
+		case unicode.Is(unicode.Hiragana, r), unicode.Is(unicode.Katakana, r):
+			scripts["ja"]++
+		case unicode.Is(unicode.Han, r):
+			scripts["zh"]++
+		case unicode.Is(unicode.Hangul, r):
+			scripts["ko"]++
+		case unicode.Is(unicode.Cyrillic, r):
+			scripts["ru"]++
+			if strings.ContainsRune("іїєґІЇЄҐ", r) {
+				scripts["uk"]++
+			}
+		case unicode.Is(unicode.Arabic, r):
+			scripts["ar"]++
+		case unicode.Is(unicode.Greek, r):
+			scripts["el"]++
+		case unicode.Is(unicode.Hebrew, r):
+			scripts["he"]++
+		case unicode.Is(unicode.Devanagari, r):
+			scripts["hi"]++
+		case unicode.Is(unicode.Thai, r):
+			scripts["th"]++
+		case unicode.Is(unicode.Latin, r):
+			scripts["latin"]++
+		}
+	}
+
+	if letters < langMinLetters {
+		return "und", 0
+	}
+
+	// Japanese text mixes kana with Han characters
+	if scripts["ja"] > 0 {
+		scripts["ja"] += scripts["zh"]
+		delete(scripts, "zh")
+	}
+	if scripts["uk"] > 0 {
+		scripts["uk"] = scripts["ru"]
+		delete(scripts, "ru")
+	}
+
+	best, bestCount := "", 0
+	for script, count := range scripts {
+		if count > bestCount || (count == bestCount && script < best) {
+			best, bestCount = script, count
+		}
+	}
+	if best != "latin" {
+		return best, float64(bestCount) / float64(letters)
+	}
+
+	// Rank Latin-script languages by trigram profile distance
+	profile := rankTrigrams(text, langProfileSize)
+
+	type candidate struct {
+		lang     string
+		distance int
+	}
+	var candidates []candidate
+	for lang, langProfile := range langProfiles {
+		distance := 0
+		for rank, gram := range profile {
+			if langRank, ok := langProfile[gram]; ok {
+				diff := rank - langRank
+				if diff < 0 {
+					diff = -diff
+				}
+				distance += diff
+			} else {
+				distance += langProfileSize
+			}
+		}
+		candidates = append(candidates, candidate{lang, distance})
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].distance != candidates[j].distance {
+			return candidates[i].distance < candidates[j].distance
+		}
+		return candidates[i].lang < candidates[j].lang
+	})
+
+	// Confidence reflects how clearly the best match beats the runner-up
+	best1, best2 := candidates[0], candidates[1]
+	if best2.distance == 0 {
+		return best1.lang, 0
+	}
+	return best1.lang, float64(best2.distance-best1.distance) / float64(best2.distance)
+}
+
+// buildLangProfiles builds ranked trigram profiles from langSamples
+func buildLangProfiles() map[string]map[string]int {
+	profiles := make(map[string]map[string]int, len(langSamples))
+	for lang, sample := range langSamples {
+		ranked := rankTrigrams(sample, langProfileSize)
+		profile := make(map[string]int, len(ranked))
+		for rank, gram := range ranked {
+			profile[gram] = rank
+		}
+		profiles[lang] = profile
+	}
+	return profiles
+}
+
+// rankTrigrams returns the most frequent character trigrams of text, ordered
+// by descending frequency. Words are padded with spaces so that prefixes and
+// suffixes form their own trigrams.
+func rankTrigrams(text string, limit int) []string {
+	counts := make(map[string]int)
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	for _, word := range words {
+		runes := []rune(" " + word + " ")
+		for i := 0; i+3 <= len(runes); i++ {
+			counts[string(runes[i:i+3])]++
+		}
+	}
+
+	grams := make([]string, 0, len(counts))
+	for gram := range counts {
+		grams = append(grams, gram)
+	}
+	sort.Slice(grams, func(i, j int) bool {
+		if counts[grams[i]] != counts[grams[j]] {
+			return counts[grams[i]] > counts[grams[j]]
+		}
+		return grams[i] < grams[j]
+	})
+
+	if len(grams) > limit {
+		grams = grams[:limit]
+	}
+	return grams
+}
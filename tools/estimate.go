@@ -0,0 +1,254 @@
+package tools
+
+import (
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkoukk/tiktoken-go"
+)
+
+// Chat requests add a few tokens per message and to prime the reply, as in
+// OpenAI's token counting guide
+const (
+	tokensPerMessage = 3
+	tokensPerReply   = 3
+)
+
+// fallbackEncoding tokenizes models the tokenizer library does not know
+const fallbackEncoding = "o200k_base"
+
+// tokenizerDownloadTimeout bounds the one-time download of a tokenizer
+// vocabulary, so an unreachable host does not hold up the run
+const tokenizerDownloadTimeout = 15 * time.Second
+
+func init() {
+	tiktoken.SetBpeLoader(tokenizerLoader{tiktoken.NewDefaultBpeLoader()})
+}
+
+// tokenizerLoader fetches tokenizer vocabularies into the cache the library
+// reads them from (TIKTOKEN_CACHE_DIR, or data-gym-cache in the temporary
+// directory), with a timeout the library's own download does not have
+type tokenizerLoader struct {
+	tiktoken.BpeLoader
+}
+
+func (l tokenizerLoader) LoadTiktokenBpe(url string) (map[string]int, error) {
+	dir := strings.TrimSpace(os.Getenv("TIKTOKEN_CACHE_DIR"))
+	if dir == "" {
+		dir = strings.TrimSpace(os.Getenv("DATA_GYM_CACHE_DIR"))
+	}
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), "data-gym-cache")
+	}
+	path := filepath.Join(dir, fmt.Sprintf("%x", sha1.Sum([]byte(url))))
+	if _, err := os.Stat(path); err != nil && strings.HasPrefix(url, "https://") {
+		if err := downloadFile(url, path); err != nil {
+			return nil, err
+		}
+	}
+	return l.BpeLoader.LoadTiktokenBpe(url)
+}
+
+// downloadFile saves a URL to a file, replacing it only once complete
+func downloadFile(url, path string) error {
+	client := &http.Client{Timeout: tokenizerDownloadTimeout}
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, resp.Body); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// sampleOutcome is what the sample test saw of the rows it processed
+type sampleOutcome struct {
+	Rows    []map[string]string // input of the sample rows
+	Results []map[string]string // generated values of the rows that succeeded
+	Elapsed time.Duration       // time spent on the rows, one at a time
+}
+
+// tokenCounter counts tokens with the tokenizer of each model. When a
+// tokenizer cannot be loaded (its vocabulary is downloaded once and cached),
+// text is counted as four characters per token.
+type tokenCounter struct {
+	encodings map[string]*tiktoken.Tiktoken
+	err       error // first tokenizer that failed to load
+}
+
+func (t *tokenCounter) count(model, text string) int {
+	if t.encodings == nil {
+		t.encodings = make(map[string]*tiktoken.Tiktoken)
+	}
+	enc, ok := t.encodings[model]
+	if !ok {
+		var err error
+		if enc, err = tiktoken.EncodingForModel(model); err != nil {
+			enc, err = tiktoken.GetEncoding(fallbackEncoding)
+		}
+		if err != nil && t.err == nil {
+			t.err = err
+		}
+		t.encodings[model] = enc
+	}
+	if enc == nil {
+		return (len(text) + 3) / 4
+	}
+	return len(enc.EncodeOrdinary(text))
+}
+
+// runEstimate is the projected usage of one row
+type runEstimate struct {
+	InputTokens  float64       // prompt tokens per row
+	OutputTokens float64       // generated tokens per row, from the sample's values
+	InputCost    float64       // dollars per row for the prompt tokens
+	OutputCost   float64       // dollars per row for the generated tokens
+	RowTime      time.Duration // time per row and worker, 0 when unknown
+	Outputs      bool          // whether any sample row produced values
+	Tokenizer    error         // why counts are approximate, nil when tokenized
+}
+
+// estimateRun counts the tokens of the requests built for the sample rows
+// with each model's tokenizer and prices them from the pricing table.
+// Generated tokens are counted from the values the sample produced. Reference documents are counted as an average chunk
+// times the number retrieved; web search rounds are not counted.
+func estimateRun(config *ProcessingConfig, sample *sampleOutcome) (*runEstimate, error) {
+	if len(sample.Rows) == 0 {
+		return nil, fmt.Errorf("no sample rows")
+	}
+	var counter tokenCounter
+	groups := groupColumnsByModel(config)
+
+	var input, output int
+	var inputCost, outputCost float64
+	for _, rowData := range sample.Rows {
+		if config.Cells != nil {
+			rowData, _ = config.Cells.limit(rowData, config.Hidden)
+		}
+		systemPrompt, userMessage, err := rowPrompt(config, rowData, rowDataContext(config, rowData))
+		if err != nil {
+			return nil, err
+		}
+		for _, group := range groups {
+			function, _ := json.Marshal(extractDataFunction(group.Specs))
+			tokens := counter.count(group.Model, systemPrompt) + counter.count(group.Model, userMessage) +
+				counter.count(group.Model, string(function)) + 2*tokensPerMessage + tokensPerReply
+			if config.Knowledge != nil {
+				tokens += config.Knowledge.TopK * averageChunkTokens(&counter, group.Model, config.Knowledge)
+			}
+			price, _ := priceFor(group.Model)
+			input += tokens
+			inputCost += float64(tokens) * price.Input / 1000000
+		}
+	}
+	for _, results := range sample.Results {
+		for _, group := range groups {
+			values := make(map[string]string, len(group.Specs))
+			for _, spec := range group.Specs {
+				values[spec.Name] = results[spec.Name]
+			}
+			arguments, _ := json.Marshal(values)
+			tokens := counter.count(group.Model, string(arguments)) + tokensPerReply
+			price, _ := priceFor(group.Model)
+			output += tokens
+			outputCost += float64(tokens) * price.Output / 1000000
+		}
+	}
+
+	estimate := &runEstimate{
+		InputTokens: float64(input) / float64(len(sample.Rows)),
+		InputCost:   inputCost / float64(len(sample.Rows)),
+		Outputs:     len(sample.Results) > 0,
+		Tokenizer:   counter.err,
+	}
+	if estimate.Outputs {
+		estimate.OutputTokens = float64(output) / float64(len(sample.Results))
+		estimate.OutputCost = outputCost / float64(len(sample.Results))
+	}
+	if sample.Elapsed > 0 {
+		estimate.RowTime = sample.Elapsed / time.Duration(len(sample.Rows))
+	}
+	return estimate, nil
+}
+
+// averageChunkTokens returns the average size of the first reference chunks
+func averageChunkTokens(counter *tokenCounter, model string, kb *KnowledgeBase) int {
+	chunks := kb.Chunks[:min(len(kb.Chunks), 50)]
+	if len(chunks) == 0 {
+		return 0
+	}
+	total := 0
+	for _, chunk := range chunks {
+		total += counter.count(model, chunk.Text)
+	}
+	return total / len(chunks)
+}
+
+// print shows the estimate per row and projected over rows processed by the
+// given number of workers. With rows 0 (a streamed input of unknown length)
+// the projection is per 1,000 rows.
+func (e *runEstimate) print(rows, workers int) {
+	fmt.Println("\n=== ESTIMATE ===")
+	method := "tokenized"
+	if e.Tokenizer != nil {
+		method = fmt.Sprintf("approximate, 4 characters per token; tokenizer not loaded: %v", e.Tokenizer)
+	}
+	output := fmt.Sprintf("~%.0f output tokens", e.OutputTokens)
+	if !e.Outputs {
+		output = "output tokens unknown (no sample row succeeded)"
+	}
+	fmt.Printf("Per row: ~%.0f input tokens, %s (%s)\n", e.InputTokens, output, method)
+
+	label := fmt.Sprintf("%d rows", rows)
+	if rows == 0 {
+		rows, label = 1000, "every 1,000 rows (total unknown while streaming)"
+	}
+	input := int64(e.InputTokens * float64(rows))
+	generated := int64(e.OutputTokens * float64(rows))
+	cost := (e.InputCost + e.OutputCost) * float64(rows)
+
+	parts := []string{fmt.Sprintf("~%d tokens", input+generated), fmt.Sprintf("~$%.4f", cost)}
+	if e.RowTime > 0 {
+		workers = max(min(workers, rows), 1)
+		duration := e.RowTime * time.Duration(rows) / time.Duration(workers)
+		parts = append(parts, fmt.Sprintf("~%s with %d workers", duration.Round(time.Second), workers))
+	}
+	fmt.Printf("Projected for %s: %s\n", label, strings.Join(parts, ", "))
+}
+
+// printRunEstimate shows the estimate of a run from its sample test, before
+// the user is asked to go ahead
+func printRunEstimate(config *ProcessingConfig, sample *sampleOutcome, rows, workers int) {
+	estimate, err := estimateRun(config, sample)
+	if err != nil {
+		if len(sample.Rows) > 0 {
+			warnf("\ncould not estimate the run: %v", err)
+		}
+		return
+	}
+	estimate.print(rows, workers)
+}
@@ -0,0 +1,198 @@
+package tools
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"ai-general-tool/common"
+)
+
+// evalMaxClasses caps the classes shown in the confusion matrix; the rest
+// are grouped as "(other)"
+const evalMaxClasses = 12
+
+// evalSpec pairs a generated column with the input column holding the
+// expected labels
+type evalSpec struct {
+	Generated int // index into the column specs
+	Expected  int // index into the input headers
+}
+
+// parseEvalSpec resolves -eval-column, written as "expected" when a single
+// column is generated or "generated=expected" otherwise
+func parseEvalSpec(spec string, headers []string, columnSpecs []ColumnSpec) (*evalSpec, error) {
+	generatedName, expectedName, paired := strings.Cut(spec, "=")
+	if !paired {
+		expectedName = generatedName
+		generatedName = ""
+		var modelColumns []string
+		for _, columnSpec := range columnSpecs {
+			if !columnSpec.Local {
+				modelColumns = append(modelColumns, columnSpec.Name)
+			}
+		}
+		if len(modelColumns) != 1 {
+			return nil, fmt.Errorf("-eval-column must be written as generated=expected when several columns are generated")
+		}
+		generatedName = modelColumns[0]
+	}
+
+	result := &evalSpec{Generated: -1, Expected: indexOf(headers, strings.TrimSpace(expectedName))}
+	for i, columnSpec := range columnSpecs {
+		if columnSpec.Name == strings.TrimSpace(generatedName) {
+			result.Generated = i
+		}
+	}
+	if result.Generated == -1 {
+		return nil, fmt.Errorf("'%s' is not a generated column", generatedName)
+	}
+	if result.Expected == -1 {
+		return nil, fmt.Errorf("expected column '%s' not found", expectedName)
+	}
+	return result, nil
+}
+
+// printEvaluation compares the generated labels with the expected ones and
+// prints accuracy, per-class precision/recall and a confusion matrix. Labels
+// are compared case-insensitively; rows without an expected label or with a
+// failed generation are left out.
+func printEvaluation(headers []string, enrichedRows [][]string, columnSpecs []ColumnSpec, spec *evalSpec) {
+	normalize := func(label string) string { return strings.ToLower(strings.TrimSpace(label)) }
+
+	display := make(map[string]string) // normalized -> first spelling seen
+	type pair struct{ expected, predicted string }
+	var pairs []pair
+	skipped := 0
+	status := statusSpecIndex(columnSpecs)
+	for _, row := range enrichedRows {
+		expected := row[spec.Expected]
+		predicted := row[len(headers)+spec.Generated]
+		if strings.TrimSpace(expected) == "" || predicted == "" || rowStatus(row, headers, status) == journalError {
+			skipped++
+			continue
+		}
+		e, p := normalize(expected), normalize(predicted)
+		if _, ok := display[e]; !ok {
+			display[e] = strings.TrimSpace(expected)
+		}
+		if _, ok := display[p]; !ok {
+			display[p] = strings.TrimSpace(predicted)
+		}
+		pairs = append(pairs, pair{e, p})
+	}
+
+	fmt.Printf("\n=== EVALUATION: %s vs %s ===\n", columnSpecs[spec.Generated].Name, headers[spec.Expected])
+	if len(pairs) == 0 {
+		fmt.Println("No rows with both an expected and a generated label.")
+		return
+	}
+
+	correct := 0
+	support := make(map[string]int)
+	predictedCount := make(map[string]int)
+	truePositive := make(map[string]int)
+	confusion := make(map[string]map[string]int)
+	for _, p := range pairs {
+		support[p.expected]++
+		predictedCount[p.predicted]++
+		if p.expected == p.predicted {
+			correct++
+			truePositive[p.expected]++
+		}
+		if confusion[p.expected] == nil {
+			confusion[p.expected] = make(map[string]int)
+		}
+		confusion[p.expected][p.predicted]++
+	}
+
+	fmt.Printf("Rows compared: %d (skipped %d without expected label or with errors)\n", len(pairs), skipped)
+	fmt.Printf("Accuracy: %d/%d (%s)\n", correct, len(pairs), common.FormatPercentage(correct, len(pairs)))
+
+	// Classes ordered by support, then by predictions
+	classes := make([]string, 0, len(display))
+	for label := range display {
+		classes = append(classes, label)
+	}
+	sort.Slice(classes, func(a, b int) bool {
+		if support[classes[a]] != support[classes[b]] {
+			return support[classes[a]] > support[classes[b]]
+		}
+		if predictedCount[classes[a]] != predictedCount[classes[b]] {
+			return predictedCount[classes[a]] > predictedCount[classes[b]]
+		}
+		return classes[a] < classes[b]
+	})
+
+	// Per-class precision and recall
+	ratio := func(n, d int) string {
+		if d == 0 {
+			return "-"
+		}
+		return fmt.Sprintf("%.2f", float64(n)/float64(d))
+	}
+	var macroF1 float64
+	var classRows [][]string
+	for _, class := range classes {
+		precision := ratio(truePositive[class], predictedCount[class])
+		recall := ratio(truePositive[class], support[class])
+		f1 := "-"
+		if predictedCount[class]+support[class] > 0 {
+			value := 2 * float64(truePositive[class]) / float64(predictedCount[class]+support[class])
+			f1 = fmt.Sprintf("%.2f", value)
+			if support[class] > 0 {
+				macroF1 += value
+			}
+		}
+		classRows = append(classRows, []string{display[class], precision, recall, f1, fmt.Sprintf("%d", support[class]), fmt.Sprintf("%d", predictedCount[class])})
+	}
+	fmt.Println(common.FormatTable([]string{"Class", "Precision", "Recall", "F1", "Expected", "Predicted"}, classRows, 120))
+	fmt.Printf("Macro F1: %.2f\n", macroF1/float64(len(support)))
+
+	// Confusion matrix, expected labels as rows
+	shown := classes[:common.Min(len(classes), evalMaxClasses)]
+	bucket := func(label string) string {
+		for _, class := range shown {
+			if class == label {
+				return label
+			}
+		}
+		return "(other)"
+	}
+	columns := append([]string{}, shown...)
+	if len(classes) > len(shown) {
+		columns = append(columns, "(other)")
+	}
+
+	matrixHeaders := []string{"expected \\ predicted"}
+	for _, column := range columns {
+		name := display[column]
+		if column == "(other)" {
+			name = column
+		}
+		matrixHeaders = append(matrixHeaders, common.TruncateString(name, 12))
+	}
+	var matrixRows [][]string
+	for _, expected := range columns {
+		counts := make(map[string]int)
+		for actual, byPredicted := range confusion {
+			if bucket(actual) != expected {
+				continue
+			}
+			for predicted, n := range byPredicted {
+				counts[bucket(predicted)] += n
+			}
+		}
+		name := display[expected]
+		if expected == "(other)" {
+			name = expected
+		}
+		row := []string{common.TruncateString(name, 20)}
+		for _, column := range columns {
+			row = append(row, fmt.Sprintf("%d", counts[column]))
+		}
+		matrixRows = append(matrixRows, row)
+	}
+	fmt.Println("\nConfusion matrix:")
+	fmt.Println(common.FormatTable(matrixHeaders, matrixRows, 200))
+}
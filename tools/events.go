@@ -0,0 +1,100 @@
+package tools
+
+import (
+	"context"
+	"time"
+)
+
+// Event is emitted by the processing engine while rows are processed. Use a
+// type switch on RowCompleted, BatchSaved, ErrorEvent and BudgetWarning.
+type Event interface {
+	EventTime() time.Time
+}
+
+// EventHandler receives engine events. Handlers are called from a single
+// goroutine, in order; a slow handler slows down result collection.
+type EventHandler func(Event)
+
+// Progress is the running state included in every event
+type Progress struct {
+	Time      time.Time `json:"time"`
+	Completed int       `json:"completed"`
+	Failed    int       `json:"failed"`
+	Total     int       `json:"total"` // 0 while a streamed input is still being read
+	Tokens    int64     `json:"tokens"`
+	Cost      float64   `json:"cost"` // dollars, from the model pricing table
+}
+
+// EventTime returns when the event happened
+func (p Progress) EventTime() time.Time { return p.Time }
+
+// RowCompleted reports a row whose columns were generated
+type RowCompleted struct {
+	Progress
+	Row     int // index into the input rows
+	Results map[string]string
+	Tokens  int
+}
+
+// BatchSaved reports that progress was written to the checkpoint file
+type BatchSaved struct {
+	Progress
+	File string
+}
+
+// ErrorEvent reports a failed row (Row >= 0) or a failed checkpoint save
+// (Row == -1)
+type ErrorEvent struct {
+	Progress
+	Row      int
+	Err      error
+	Class    string // error class of a failed row: rate_limit, timeout, parse, content_filter, api or other
+	Attempts int    // times the failed row's requests were sent, retries included
+}
+
+// BudgetWarning reports that token usage reached a share of the token budget
+type BudgetWarning struct {
+	Progress
+	Budget   int64
+	Fraction float64 // 0.8 when 80% is used, 1 when the budget is exhausted
+}
+
+// budgetWarningLevels are the budget shares at which a warning is emitted
+var budgetWarningLevels = []float64{0.8, 1.0}
+
+// EventChannel returns a handler forwarding events to a buffered channel, for
+// hosts that prefer channels over callbacks. Sends block when the buffer is
+// full. The channel is not closed; stop reading when processing returns.
+func EventChannel(buffer int) (EventHandler, <-chan Event) {
+	ch := make(chan Event, buffer)
+	return func(event Event) { ch <- event }, ch
+}
+
+// emit passes the event to the configured handler, if any
+func (config *ProcessingConfig) emit(event Event) {
+	if config.OnEvent != nil {
+		config.OnEvent(event)
+	}
+}
+
+// ProcessRows runs the configured enrichment over the rows with the given
+// number of workers and returns the rows with the generated columns appended.
+// It is the entry point for embedding the engine; progress is reported
+// through config.OnEvent. With checkpointFile set, the finished rows are also
+// recorded in the run journal checkpointFile + ".journal.db" every batchSize
+// rows. Cancelling ctx stops new rows and the requests of rows in progress;
+// the rows left unprocessed are listed in the stats' Remaining.
+func ProcessRows(ctx context.Context, config *ProcessingConfig, headers []string, rows [][]string, workers int, batchSize int, checkpointFile string) ([][]string, *ProcessingStats) {
+	var journal *runJournal
+	if checkpointFile != "" {
+		var err error
+		if journal, err = openRunJournal(checkpointFile, headers, config.ColumnSpecs, "", false); err != nil {
+			config.emit(ErrorEvent{Row: -1, Err: err})
+		}
+	}
+	enrichedRows, stats := processFullDataset(ctx, config, headers, rows, workers, batchSize, journal, 0)
+	if err := journal.close(); err != nil {
+		config.emit(ErrorEvent{Progress: stats.progress(), Row: -1, Err: err})
+	}
+	return enrichedRows, stats
+}
@@ -0,0 +1,367 @@
+package tools
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// Cell values of .xlsx inputs: dates in ISO 8601 and numbers at full
+// precision, as Excel displays them (number formats applied), or as stored
+// (dates as serial numbers)
+const (
+	excelValuesTyped     = "typed"
+	excelValuesFormatted = "formatted"
+	excelValuesRaw       = "raw"
+)
+
+var excelValueModes = map[string]bool{excelValuesTyped: true, excelValuesFormatted: true, excelValuesRaw: true}
+
+// Formula cells of .xlsx inputs: their computed value, or the formula itself
+const (
+	excelFormulasValue = "value"
+	excelFormulasText  = "text"
+)
+
+// ExcelOptions controls how the cells of .xlsx inputs are read
+type ExcelOptions struct {
+	Values     string // typed, formatted or raw; empty for typed
+	Formulas   string // value or text; empty for value
+	FillMerged bool   // repeat the value of a merged cell over its range
+}
+
+// excelFlags registers the Excel reading flags shared by every command that
+// reads workbooks
+func excelFlags(fs *flag.FlagSet, opts *ExcelOptions) {
+	fs.StringVar(&opts.Values, "excel-values", excelValuesTyped, "Excel input: cell values as typed (dates in ISO 8601, numbers at full precision), formatted (as Excel displays them) or raw (as stored, dates as serial numbers)")
+	fs.StringVar(&opts.Formulas, "formulas", excelFormulasValue, "Excel input: formula cells as their computed value, or as the formula text, e.g. =SUM(B2:B10)")
+	fs.BoolVar(&opts.FillMerged, "fill-merged", false, "Excel input: repeat the value of a merged cell in every cell of its range, e.g. a Region merged over the rows of its group (default: only the first cell has it)")
+}
+
+// values returns the value mode, checked
+func (o ExcelOptions) values() (string, error) {
+	if o.Values == "" {
+		return excelValuesTyped, nil
+	}
+	if !excelValueModes[o.Values] {
+		return "", fmt.Errorf("invalid -excel-values '%s' (use typed, formatted or raw)", o.Values)
+	}
+	return o.Values, nil
+}
+
+// formulas returns the formula mode, checked
+func (o ExcelOptions) formulas() (string, error) {
+	switch o.Formulas {
+	case "":
+		return excelFormulasValue, nil
+	case excelFormulasValue, excelFormulasText:
+		return o.Formulas, nil
+	}
+	return "", fmt.Errorf("invalid -formulas '%s' (use value or text)", o.Formulas)
+}
+
+// formatExcelNumber renders a number as Excel would show it in General
+// format, or as an ISO date/time when its cell has a date format
+func formatExcelNumber(value float64, date, date1904 bool) string {
+	if date {
+		base := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+		if date1904 {
+			base = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+		}
+		t := base.Add(time.Duration(math.Round(value*86400)) * time.Second)
+		switch {
+		case value < 1 && !date1904:
+			return t.Format("15:04:05")
+		case t.Hour() == 0 && t.Minute() == 0 && t.Second() == 0:
+			return t.Format("2006-01-02")
+		}
+		return t.Format("2006-01-02 15:04:05")
+	}
+
+	// Excel keeps 15 significant digits
+	rounded, _ := strconv.ParseFloat(strconv.FormatFloat(value, 'g', 15, 64), 64)
+	return strconv.FormatFloat(rounded, 'f', -1, 64)
+}
+
+// excelDateStyles lists which cell styles of a workbook have a date format
+func excelDateStyles(f *excelize.File) []bool {
+	var dates []bool
+	for id := 0; ; id++ {
+		style, err := f.GetStyle(id)
+		if err != nil {
+			return dates
+		}
+		format := ""
+		if style.CustomNumFmt != nil {
+			format = *style.CustomNumFmt
+		}
+		dates = append(dates, isDateFormat(uint16(style.NumFmt), format))
+	}
+}
+
+// excelCellAttrs is what the sheet XML says about a cell besides its value:
+// its style, its type (b, d, e, n, s, str or inlineStr; empty for n) and its
+// formula
+type excelCellAttrs struct {
+	style   int
+	kind    string
+	formula bool
+	text    string // formula text; empty in cells sharing the formula of another
+	cached  bool   // the file stores the formula's last computed value
+}
+
+// sheetCellScanner streams the cell attributes and formulas of a sheet, which
+// the excelize row iterator does not expose, from the sheet's XML part
+type sheetCellScanner struct {
+	archive *zip.ReadCloser
+	part    io.ReadCloser
+	decoder *xml.Decoder
+	row     int  // number of the last row element read
+	pending bool // that row was read ahead and not returned yet
+}
+
+// openSheetCells opens the XML part of a sheet (1-based) of an .xlsx file
+func openSheetCells(filename string, sheetIndex int) (*sheetCellScanner, error) {
+	archive, err := zip.OpenReader(filename)
+	if err != nil {
+		return nil, err
+	}
+	part, err := sheetPart(archive, sheetIndex)
+	if err == nil {
+		var file io.ReadCloser
+		if file, err = archive.Open(part); err == nil {
+			return &sheetCellScanner{archive: archive, part: file, decoder: xml.NewDecoder(file)}, nil
+		}
+	}
+	archive.Close()
+	return nil, err
+}
+
+// sheetPart finds the part name of a sheet (1-based) through the workbook
+// and its relationships
+func sheetPart(archive *zip.ReadCloser, sheetIndex int) (string, error) {
+	var rels struct {
+		Relationships []struct {
+			ID     string `xml:"Id,attr"`
+			Type   string `xml:"Type,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	resolve := func(dir, target string) string {
+		if strings.HasPrefix(target, "/") {
+			return strings.TrimPrefix(target, "/")
+		}
+		return path.Join(dir, target)
+	}
+
+	workbookPart := "xl/workbook.xml"
+	if err := readZipXML(archive, "_rels/.rels", &rels); err == nil {
+		for _, rel := range rels.Relationships {
+			if strings.HasSuffix(rel.Type, "/officeDocument") {
+				workbookPart = resolve("", rel.Target)
+			}
+		}
+	}
+	var workbook struct {
+		Sheets []struct {
+			ID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err := readZipXML(archive, workbookPart, &workbook); err != nil {
+		return "", err
+	}
+	if sheetIndex < 1 || sheetIndex > len(workbook.Sheets) {
+		return "", fmt.Errorf("invalid sheet index %d (file has %d sheets)", sheetIndex, len(workbook.Sheets))
+	}
+	rels.Relationships = nil
+	dir, name := path.Split(workbookPart)
+	if err := readZipXML(archive, path.Join(dir, "_rels", name+".rels"), &rels); err != nil {
+		return "", err
+	}
+	for _, rel := range rels.Relationships {
+		if rel.ID == workbook.Sheets[sheetIndex-1].ID {
+			return resolve(dir, rel.Target), nil
+		}
+	}
+	return "", fmt.Errorf("sheet %d has no part in the workbook", sheetIndex)
+}
+
+// readZipXML decodes an XML part of an archive
+func readZipXML(archive *zip.ReadCloser, name string, v any) error {
+	file, err := archive.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return xml.NewDecoder(file).Decode(v)
+}
+
+// cells returns the attributes of the cells of row n (1-based), by 0-based
+// column. Rows must be asked for in increasing order; rows without cells in
+// the sheet give nil.
+func (s *sheetCellScanner) cells(n int) (map[int]excelCellAttrs, error) {
+	for {
+		if !s.pending {
+			token, err := s.decoder.RawToken()
+			if err == io.EOF {
+				return nil, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			start, ok := token.(xml.StartElement)
+			if !ok || start.Name.Local != "row" {
+				continue
+			}
+			s.row++
+			if r, err := strconv.Atoi(xmlAttr(start, "r")); err == nil {
+				s.row = r
+			}
+			s.pending = true
+		}
+		switch {
+		case s.row > n:
+			return nil, nil
+		case s.row < n:
+			s.pending = false
+			continue
+		}
+		s.pending = false
+
+		cells := make(map[int]excelCellAttrs)
+		col := -1
+		var cell excelCellAttrs
+		inside := "" // f or v element of the cell being read
+		for {
+			token, err := s.decoder.RawToken()
+			if err != nil {
+				return nil, err
+			}
+			switch element := token.(type) {
+			case xml.StartElement:
+				switch element.Name.Local {
+				case "c":
+					col++
+					if ref := xmlAttr(element, "r"); ref != "" {
+						if c, _, err := excelize.CellNameToCoordinates(ref); err == nil {
+							col = c - 1
+						}
+					}
+					style, _ := strconv.Atoi(xmlAttr(element, "s"))
+					cell = excelCellAttrs{style: style, kind: xmlAttr(element, "t")}
+				case "f":
+					cell.formula, inside = true, "f"
+				case "v":
+					inside = "v"
+				}
+			case xml.CharData:
+				switch inside {
+				case "f":
+					cell.text += string(element)
+				case "v":
+					cell.cached = cell.cached || len(element) > 0
+				}
+			case xml.EndElement:
+				switch element.Name.Local {
+				case "f", "v":
+					inside = ""
+				case "c":
+					cells[col] = cell
+				case "row":
+					return cells, nil
+				}
+			}
+		}
+	}
+}
+
+// mergedRange is a merged cell of a sheet, by 1-based coordinates, with the
+// value of its top-left cell once its first row is read
+type mergedRange struct {
+	top, left, bottom, right int
+	value                    string
+}
+
+// sheetMergedRanges lists the merged cells of a sheet (1-based). They follow
+// the cells in the sheet XML, so the part is scanned once on its own.
+func sheetMergedRanges(filename string, sheetIndex int) ([]*mergedRange, error) {
+	scanner, err := openSheetCells(filename, sheetIndex)
+	if err != nil {
+		return nil, err
+	}
+	defer scanner.Close()
+
+	var ranges []*mergedRange
+	for {
+		token, err := scanner.decoder.RawToken()
+		if err == io.EOF {
+			return ranges, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "mergeCell" {
+			continue
+		}
+		from, to, _ := strings.Cut(xmlAttr(start, "ref"), ":")
+		left, top, err := excelize.CellNameToCoordinates(from)
+		if err != nil {
+			continue
+		}
+		right, bottom, err := excelize.CellNameToCoordinates(to)
+		if err != nil {
+			continue
+		}
+		ranges = append(ranges, &mergedRange{top: min(top, bottom), left: min(left, right), bottom: max(top, bottom), right: max(left, right)})
+	}
+}
+
+// Close releases the sheet part and the archive
+func (s *sheetCellScanner) Close() error {
+	s.part.Close()
+	return s.archive.Close()
+}
+
+// xmlAttr returns the value of an attribute of an element, by local name
+func xmlAttr(element xml.StartElement, name string) string {
+	for _, attr := range element.Attr {
+		if attr.Name.Local == name {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// typedCells converts the raw values of a row: numbers in date-formatted
+// cells become ISO dates, other numbers are shown at full precision and
+// booleans as TRUE or FALSE
+func typedCells(row []string, cells map[int]excelCellAttrs, dateStyles []bool, date1904 bool) []string {
+	for col, value := range row {
+		cell := cells[col]
+		switch cell.kind {
+		case "b":
+			row[col] = "FALSE"
+			if value == "1" {
+				row[col] = "TRUE"
+			}
+		case "", "n":
+			number, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			date := cell.style > 0 && cell.style < len(dateStyles) && dateStyles[cell.style]
+			row[col] = formatExcelNumber(number, date, date1904)
+		}
+	}
+	return row
+}
@@ -0,0 +1,325 @@
+package tools
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// excelWorkbookExtensions lists the workbooks whose formatting is kept when
+// the output is written into a copy of the input
+var excelWorkbookExtensions = map[string]bool{".xlsx": true, ".xlsm": true}
+
+// isExcelWorkbook reports whether a file name is an Excel 2007+ workbook
+func isExcelWorkbook(filename string) bool {
+	return excelWorkbookExtensions[strings.ToLower(filepath.Ext(filename))]
+}
+
+// saveIntoWorkbook writes the generated columns into a copy of the source
+// workbook, keeping its styles, formulas, conditional formatting, column
+// widths and other sheets. Existing columns that were regenerated are updated
+// in place; new columns are appended with the style of the last header,
+// merged down stacked header rows. It reports false, writing nothing, when the
+// rows no longer line up with the sheet below its header rows.
+func saveIntoWorkbook(source string, sheetName string, header HeaderOptions, filename string, headers []string, rows [][]string, columnSpecs []ColumnSpec, sheets *runSheets) (bool, error) {
+	f, err := excelize.OpenFile(source)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	sheetList := f.GetSheetList()
+	sheetIndex, err := findSheet(sheetList, sheetName)
+	if err != nil {
+		return false, err
+	}
+	sheet := sheetList[sheetIndex-1]
+	original, err := f.GetRows(sheet)
+	if err != nil {
+		return false, err
+	}
+	first, top := header.first(), header.top()
+	if len(original) != len(rows)+top {
+		return false, nil
+	}
+	sheets.listErrors(sheet, headers, rows, columnSpecs, top)
+
+	columns := 0
+	for _, row := range original[first-1 : top] {
+		columns = max(columns, len(row))
+	}
+	lastHeader := fmt.Sprintf("%s%d", columnIndexToLetter(columns-1), top)
+	headerStyle, _ := f.GetCellStyle(sheet, lastHeader)
+	width, _ := f.GetColWidth(sheet, columnIndexToLetter(columns-1))
+
+	for _, spec := range columnSpecs {
+		col := indexOf(headers, spec.Name)
+		if col == -1 {
+			continue
+		}
+		letter := columnIndexToLetter(col)
+		if col >= columns {
+			cell, last := fmt.Sprintf("%s%d", letter, first), fmt.Sprintf("%s%d", letter, top)
+			if err := f.SetCellValue(sheet, cell, spec.Name); err != nil {
+				return false, err
+			}
+			if last != cell {
+				if err := f.MergeCell(sheet, cell, last); err != nil {
+					return false, err
+				}
+			}
+			f.SetCellStyle(sheet, cell, last, headerStyle)
+			f.SetColWidth(sheet, letter, letter, width)
+		}
+		for r, row := range rows {
+			value := ""
+			if col < len(row) {
+				value = row[col]
+			}
+			if err := f.SetCellValue(sheet, fmt.Sprintf("%s%d", letter, r+top+1), value); err != nil {
+				return false, err
+			}
+		}
+	}
+
+	if err := highlightErrors(f, sheet, headers, rows, top); err != nil {
+		return false, err
+	}
+	if sheets != nil {
+		if err := addRunSheets(f, sheets); err != nil {
+			return false, err
+		}
+	}
+	return true, f.SaveAs(filename)
+}
+
+// Column widths of generated workbooks follow the longest value, within
+// these bounds
+const (
+	excelMinWidth = 8
+	excelMaxWidth = 60
+)
+
+// styleSheet makes a generated sheet easier to review: a bold, filled header
+// row that stays frozen, an autofilter, columns sized to their contents and
+// failed rows highlighted
+func styleSheet(f *excelize.File, sheet string, headers []string, rows [][]string) error {
+	if len(headers) == 0 {
+		return nil
+	}
+	headerStyle, err := f.NewStyle(&excelize.Style{
+		Font:   &excelize.Font{Bold: true},
+		Fill:   excelize.Fill{Type: "pattern", Pattern: 1, Color: []string{"D9E1F2"}},
+		Border: []excelize.Border{{Type: "bottom", Color: "8EA9DB", Style: 1}},
+	})
+	if err != nil {
+		return err
+	}
+	last := columnIndexToLetter(len(headers) - 1)
+	if err := f.SetCellStyle(sheet, "A1", last+"1", headerStyle); err != nil {
+		return err
+	}
+	if err := f.SetPanes(sheet, &excelize.Panes{
+		Freeze: true, YSplit: 1, TopLeftCell: "A2", ActivePane: "bottomLeft",
+	}); err != nil {
+		return err
+	}
+	if err := f.AutoFilter(sheet, fmt.Sprintf("A1:%s%d", last, len(rows)+1), nil); err != nil {
+		return err
+	}
+
+	widths := make([]int, len(headers))
+	for i, header := range headers {
+		widths[i] = cellWidth(header)
+	}
+	for _, row := range rows {
+		for i, value := range row {
+			if i < len(widths) {
+				widths[i] = max(widths[i], cellWidth(value))
+			}
+		}
+	}
+	for i, width := range widths {
+		letter := columnIndexToLetter(i)
+		if err := f.SetColWidth(sheet, letter, letter, float64(min(max(width+2, excelMinWidth), excelMaxWidth))); err != nil {
+			return err
+		}
+	}
+	return highlightErrors(f, sheet, headers, rows, 1)
+}
+
+// highlightErrors fills the status and error cells of the rows whose status
+// column says they failed in red; the rows start below the top rows of the
+// sheet
+func highlightErrors(f *excelize.File, sheet string, headers []string, rows [][]string, top int) error {
+	status := indexOf(headers, statusColumn)
+	if status == -1 {
+		return nil
+	}
+	var cols []int
+	for _, name := range []string{statusColumn, errorClassColumn, errorColumn} {
+		if col := indexOf(headers, name); col != -1 {
+			cols = append(cols, col)
+		}
+	}
+	errorStyle := -1
+	for r, row := range rows {
+		if status >= len(row) || row[status] != journalError {
+			continue
+		}
+		if errorStyle == -1 {
+			style, err := f.NewStyle(&excelize.Style{
+				Font: &excelize.Font{Color: "9C0006"},
+				Fill: excelize.Fill{Type: "pattern", Pattern: 1, Color: []string{"FFC7CE"}},
+			})
+			if err != nil {
+				return err
+			}
+			errorStyle = style
+		}
+		for _, c := range cols {
+			cell := fmt.Sprintf("%s%d", columnIndexToLetter(c), r+top+1)
+			if err := f.SetCellStyle(sheet, cell, cell, errorStyle); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// cellWidth is the length of the longest line of a value, in characters
+func cellWidth(value string) int {
+	width := 0
+	for _, line := range strings.Split(value, "\n") {
+		width = max(width, utf8.RuneCountInString(line))
+	}
+	return width
+}
+
+// Sheets added to final Excel outputs, next to the data sheet
+const (
+	errorsSheet  = "Errors"
+	runInfoSheet = "Run Info"
+)
+
+// runError is a row failed according to its status columns, listed on the
+// Errors sheet
+type runError struct {
+	Sheet   string
+	Row     int    // spreadsheet row of the data sheet
+	Column  string // the generated columns of the row
+	Class   string
+	Message string
+}
+
+// runSheets holds the contents of the Errors and Run Info sheets
+type runSheets struct {
+	Info   *RunInfo
+	Errors []runError
+}
+
+// listErrors lists the rows written to a sheet whose status column says they
+// failed, for the Errors sheet. Errors are listed by sheet row, the data
+// starting below top rows.
+func (s *runSheets) listErrors(sheet string, headers []string, rows [][]string, columnSpecs []ColumnSpec, top int) {
+	status := indexOf(headers, statusColumn)
+	if s == nil || status == -1 {
+		return
+	}
+	var generated []string
+	for _, spec := range columnSpecs {
+		if !spec.Local && indexOf(headers, spec.Name) != -1 {
+			generated = append(generated, spec.Name)
+		}
+	}
+	class, message := indexOf(headers, errorClassColumn), indexOf(headers, errorColumn)
+	cell := func(row []string, col int) string {
+		if col == -1 || col >= len(row) {
+			return ""
+		}
+		return row[col]
+	}
+	for r, row := range rows {
+		if cell(row, status) == journalError {
+			s.Errors = append(s.Errors, runError{
+				Sheet:   sheet,
+				Row:     r + top + 1,
+				Column:  strings.Join(generated, ", "),
+				Class:   cell(row, class),
+				Message: cell(row, message),
+			})
+		}
+	}
+}
+
+// addRunSheets writes the Errors sheet, when there are errors, and the Run
+// Info sheet, replacing sheets of the same names left by an earlier run
+func addRunSheets(f *excelize.File, sheets *runSheets) error {
+	for _, name := range []string{errorsSheet, runInfoSheet} {
+		if index, _ := f.GetSheetIndex(name); index != -1 {
+			if err := f.DeleteSheet(name); err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(sheets.Errors) > 0 {
+		rows := make([][]string, len(sheets.Errors))
+		for i, e := range sheets.Errors {
+			rows[i] = []string{e.Sheet, fmt.Sprint(e.Row), e.Column, e.Class, e.Message}
+		}
+		if err := writeSheet(f, errorsSheet, []string{"Sheet", "Row", "Column", "Class", "Error"}, rows); err != nil {
+			return err
+		}
+	}
+
+	info := sheets.Info
+	rows := [][]string{
+		{"Command", info.Command},
+		{"Input", info.Input},
+		{"Output", info.Output},
+		{"Prompt", info.Prompt},
+	}
+	for _, column := range info.Columns {
+		source := column.Model
+		if source == "" {
+			source = column.Source
+		}
+		if column.Overwritten {
+			source += " (overwritten)"
+		}
+		rows = append(rows, []string{"Column " + column.Name, source})
+	}
+	rows = append(rows,
+		[]string{"Started", info.StartedAt.Format(time.RFC3339)},
+		[]string{"Finished", info.FinishedAt.Format(time.RFC3339)},
+		[]string{"Rows", fmt.Sprint(info.Rows)},
+		[]string{"Completed rows", fmt.Sprint(info.CompletedRows)},
+		[]string{"Failed rows", fmt.Sprint(info.FailedRows)},
+		[]string{"Tokens", fmt.Sprint(info.Tokens)},
+		[]string{"Input tokens", fmt.Sprint(info.InputTokens)},
+		[]string{"Output tokens", fmt.Sprint(info.OutputTokens)},
+		[]string{"Cost", fmt.Sprintf("$%.4f", info.EstimatedCost)},
+	)
+	return writeSheet(f, runInfoSheet, []string{"Field", "Value"}, rows)
+}
+
+// writeSheet adds a styled sheet holding a table
+func writeSheet(f *excelize.File, sheet string, headers []string, rows [][]string) error {
+	if _, err := f.NewSheet(sheet); err != nil {
+		return err
+	}
+	if err := f.SetSheetRow(sheet, "A1", &headers); err != nil {
+		return err
+	}
+	for i, row := range rows {
+		if err := f.SetSheetRow(sheet, fmt.Sprintf("A%d", i+2), &row); err != nil {
+			return err
+		}
+	}
+	return styleSheet(f, sheet, headers, rows)
+}
@@ -0,0 +1,206 @@
+package tools
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// excelRowSource reads the rows of an Excel sheet one at a time with the
+// excelize iterator, so the sheet is never held in memory as a whole. Empty
+// rows are held back until a non-empty row follows them, which drops trailing
+// empty rows as GetRows does.
+type excelRowSource struct {
+	file  *excelize.File
+	rows  *excelize.Rows
+	empty int      // empty rows read before held
+	held  []string // non-empty row returned after the empty rows
+
+	sheet      string
+	values     string            // excelValuesTyped, excelValuesFormatted or excelValuesRaw
+	formulas   string            // excelFormulasValue or excelFormulasText
+	row        int               // number of the last row read
+	cells      *sheetCellScanner // cell styles, types and formulas
+	dateStyles []bool
+	date1904   bool
+	uncomputed int            // formula cells without a stored value that could not be calculated
+	merged     []*mergedRange // merged cells not read past yet, for -fill-merged
+}
+
+// openExcelRows opens a sheet, by name or number (1-based), of an Excel workbook for reading row
+// by row and returns the workbook's sheet names. The caller closes the
+// source.
+func openExcelRows(filename string, sheet string, opts ExcelOptions) ([]string, *excelRowSource, error) {
+	values, err := opts.values()
+	if err != nil {
+		return nil, nil, err
+	}
+	formulas, err := opts.formulas()
+	if err != nil {
+		return nil, nil, err
+	}
+	f, err := excelize.OpenFile(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	sheetList := f.GetSheetList()
+	sheetIndex, err := findSheet(sheetList, sheet)
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	source := &excelRowSource{file: f, sheet: sheetList[sheetIndex-1], values: values, formulas: formulas}
+	if source.cells, err = openSheetCells(filename, sheetIndex); err != nil {
+		f.Close()
+		return nil, nil, fmt.Errorf("error reading cell types: %v", err)
+	}
+	if opts.FillMerged {
+		if source.merged, err = sheetMergedRanges(filename, sheetIndex); err != nil {
+			source.Close()
+			return nil, nil, fmt.Errorf("error reading merged cells: %v", err)
+		}
+	}
+	if values == excelValuesTyped {
+		source.dateStyles = excelDateStyles(f)
+		if props, err := f.GetWorkbookProps(); err == nil && props.Date1904 != nil {
+			source.date1904 = *props.Date1904
+		}
+	}
+	if source.rows, err = f.Rows(source.sheet); err != nil {
+		source.Close()
+		return nil, nil, err
+	}
+	return sheetList, source, nil
+}
+
+func (s *excelRowSource) Next() ([]string, error) {
+	if s.empty > 0 {
+		s.empty--
+		return []string{}, nil
+	}
+	if s.held != nil {
+		row := s.held
+		s.held = nil
+		return row, nil
+	}
+	for s.rows.Next() {
+		s.row++
+		row, err := s.columns()
+		if err != nil {
+			return nil, err
+		}
+		row = s.fillMerged(row)
+		if len(row) == 0 {
+			s.empty++
+			continue
+		}
+		if s.empty == 0 {
+			return row, nil
+		}
+		s.held = row
+		s.empty--
+		return []string{}, nil
+	}
+	if err := s.rows.Error(); err != nil {
+		return nil, err
+	}
+	s.empty = 0 // trailing empty rows
+	if s.uncomputed > 0 {
+		warnf("%d formula cells have no stored value and could not be calculated, so they are empty; open and save the workbook in Excel to store their values", s.uncomputed)
+		s.uncomputed = 0
+	}
+	return nil, io.EOF
+}
+
+// columns reads the cells of the current row in the source's value and
+// formula modes
+func (s *excelRowSource) columns() ([]string, error) {
+	raw := excelize.Options{RawCellValue: s.values != excelValuesFormatted}
+	row, err := s.rows.Columns(raw)
+	if err != nil || len(row) == 0 {
+		return row, err
+	}
+	cells, err := s.cells.cells(s.row)
+	if err != nil {
+		return nil, fmt.Errorf("error reading cell types: %v", err)
+	}
+
+	for col, cell := range cells {
+		if !cell.formula || (s.formulas == excelFormulasValue && cell.cached) {
+			continue
+		}
+		name, err := excelize.CoordinatesToCellName(col+1, s.row)
+		if err != nil {
+			return nil, err
+		}
+		for len(row) <= col {
+			row = append(row, "")
+		}
+		if s.formulas == excelFormulasText {
+			// Cells sharing a formula only store it in the first cell
+			text := cell.text
+			if text == "" {
+				if text, err = s.file.GetCellFormula(s.sheet, name); err != nil {
+					return nil, err
+				}
+			}
+			row[col] = "=" + text
+			continue
+		}
+		// Files written by other programs than Excel may not store the
+		// values of their formulas
+		value, err := s.file.CalcCellValue(s.sheet, name, raw)
+		if err != nil {
+			s.uncomputed++
+			continue
+		}
+		row[col] = value
+	}
+
+	if s.values != excelValuesTyped {
+		return row, nil
+	}
+	return typedCells(row, cells, s.dateStyles, s.date1904), nil
+}
+
+// fillMerged repeats the values of the merged cells covering the current row
+// over their ranges. A merged cell's value is in its top-left cell, read with
+// its first row.
+func (s *excelRowSource) fillMerged(row []string) []string {
+	ranges := s.merged[:0]
+	for _, merged := range s.merged {
+		if merged.bottom < s.row {
+			continue
+		}
+		ranges = append(ranges, merged)
+		if merged.top > s.row {
+			continue
+		}
+		if merged.top == s.row && merged.left <= len(row) {
+			merged.value = row[merged.left-1]
+		}
+		if merged.value == "" {
+			continue
+		}
+		for len(row) < merged.right {
+			row = append(row, "")
+		}
+		for col := merged.left; col <= merged.right; col++ {
+			if row[col-1] == "" {
+				row[col-1] = merged.value
+			}
+		}
+	}
+	s.merged = ranges
+	return row
+}
+
+// Close releases the sheet iterator and the workbook
+func (s *excelRowSource) Close() error {
+	s.cells.Close()
+	if s.rows != nil {
+		s.rows.Close()
+	}
+	return s.file.Close()
+}
@@ -0,0 +1,357 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"ai-general-tool/common"
+)
+
+// ExperimentVariant is one prompt/model configuration under test
+type ExperimentVariant struct {
+	Name   string `json:"name"`
+	Model  string `json:"model"`
+	Prompt string `json:"prompt"`
+}
+
+// variantResult holds the outputs and measurements of one variant
+type variantResult struct {
+	Values    [][]string // per row, per generated column
+	Failed    []bool
+	Status    []map[string]string // per row, the values of the status columns
+	Usage     TokenUsage
+	Latencies []time.Duration
+	Elapsed   time.Duration
+}
+
+// RunExperiment handles the experiment command
+func RunExperiment(args []string) error {
+	fs := flag.NewFlagSet("experiment", flag.ExitOnError)
+
+	// Define flags
+	inputFile := fs.String("input", "", "Input file (CSV, Excel or JSON)")
+	outputFile := fs.String("output", "", "Output file (optional, defaults to input_experiment)")
+	columns := fs.String("columns", "", "Comma-separated list of new column names")
+	variantsFile := fs.String("variants", "", "JSON file with a list of {name, model, prompt} variants")
+	prompt := fs.String("prompt", "", "Prompt shared by variants that do not set their own")
+	models := fs.String("models", "", "Comma-separated models to compare with -prompt (instead of -variants)")
+	sampleSize := fs.Int("sample", 20, "Number of rows every variant is run on")
+	randomSample := fs.Bool("random", false, "Pick the sample rows at random instead of the first rows")
+	workers := fs.Int("workers", 10, "Number of parallel workers per variant")
+	input := inputFlags(fs)
+	output := outputFlags(fs)
+
+	// Parse flags
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	// Handle positional argument for filename
+	if *inputFile == "" && fs.NArg() > 0 {
+		*inputFile = fs.Arg(0)
+	}
+
+	// Validate inputs
+	if *inputFile == "" {
+		return fmt.Errorf("input file is required")
+	}
+	if *columns == "" {
+		return fmt.Errorf("columns are required")
+	}
+
+	variants, err := loadExperimentVariants(*variantsFile, *models, *prompt)
+	if err != nil {
+		return err
+	}
+
+	client, err := newOpenAIClient()
+	if err != nil {
+		return err
+	}
+	columnSpecs := parseColumnSpecs(*columns)
+
+	if *outputFile == "" {
+		*outputFile = suffixedOutputFile(*inputFile, output.Format, "_experiment")
+	}
+	if *outputFile, err = output.compressedName(*outputFile); err != nil {
+		return err
+	}
+
+	// Load input data
+	fmt.Printf("Loading %s...\n", *inputFile)
+	headers, rows, err := loadInputFile(*inputFile, *input)
+	if err != nil {
+		return fmt.Errorf("error loading input: %v", err)
+	}
+
+	sample := rows
+	if *randomSample {
+		sample = make([][]string, len(rows))
+		copy(sample, rows)
+		rand.Shuffle(len(sample), func(i, j int) { sample[i], sample[j] = sample[j], sample[i] })
+	}
+	sample = sample[:common.Min(*sampleSize, len(sample))]
+	fmt.Printf("Running %d variants on %d rows\n", len(variants), len(sample))
+
+	ctx, cancel := interruptContext()
+	defer cancel()
+
+	results := make([]*variantResult, len(variants))
+	for v, variant := range variants {
+		fmt.Printf("\nVariant %s (%s)...\n", variant.Name, variant.Model)
+		config := &ProcessingConfig{
+			Client:      client,
+			ColumnSpecs: columnSpecs,
+			Prompt:      variant.Prompt,
+			Model:       variant.Model,
+		}
+		results[v] = runVariant(ctx, config, headers, sample, *workers)
+		if ctx.Err() != nil {
+			return fmt.Errorf("experiment interrupted")
+		}
+	}
+
+	// Write the results side by side: every column once per variant, then
+	// the status columns of the variants that had failed rows
+	var outputSpecs []ColumnSpec
+	for _, spec := range columnSpecs {
+		for _, variant := range variants {
+			outputSpecs = append(outputSpecs, ColumnSpec{Name: fmt.Sprintf("%s [%s]", spec.Name, variant.Name), DataType: spec.DataType})
+		}
+	}
+	var failedVariants []int
+	for v, variant := range variants {
+		if slices.Contains(results[v].Failed, true) {
+			failedVariants = append(failedVariants, v)
+			for _, name := range statusColumnNames {
+				outputSpecs = append(outputSpecs, ColumnSpec{Name: fmt.Sprintf("%s [%s]", name, variant.Name), DataType: "string", Local: true})
+			}
+		}
+	}
+	outputRows := make([][]string, len(sample))
+	for r, row := range sample {
+		outputRows[r] = make([]string, len(headers), len(headers)+len(outputSpecs))
+		copy(outputRows[r], row)
+		for c := range columnSpecs {
+			for v := range variants {
+				outputRows[r] = append(outputRows[r], results[v].Values[r][c])
+			}
+		}
+		for _, v := range failedVariants {
+			for _, name := range statusColumnNames {
+				outputRows[r] = append(outputRows[r], results[v].Status[r][name])
+			}
+		}
+	}
+	if err := saveOutputFile(*outputFile, headers, outputRows, outputSpecs, *output); err != nil {
+		return fmt.Errorf("error saving output: %v", err)
+	}
+
+	printExperimentReport(variants, columnSpecs, results)
+	fmt.Printf("\nResults saved to: %s\n", *outputFile)
+
+	return nil
+}
+
+// loadExperimentVariants reads the variants from a JSON file, or builds one
+// variant per model when -models is used
+func loadExperimentVariants(variantsFile, models, prompt string) ([]ExperimentVariant, error) {
+	var variants []ExperimentVariant
+	switch {
+	case variantsFile != "" && models != "":
+		return nil, fmt.Errorf("use either -variants or -models, not both")
+	case variantsFile != "":
+		data, err := os.ReadFile(variantsFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading variants: %v", err)
+		}
+		if err := json.Unmarshal(data, &variants); err != nil {
+			return nil, fmt.Errorf("invalid variants file: %v", err)
+		}
+	case models != "":
+		for _, model := range strings.Split(models, ",") {
+			model = strings.TrimSpace(model)
+			variants = append(variants, ExperimentVariant{Name: model, Model: model})
+		}
+	default:
+		return nil, fmt.Errorf("either -variants or -models is required")
+	}
+
+	if len(variants) < 2 {
+		return nil, fmt.Errorf("at least two variants are required")
+	}
+	names := make(map[string]bool)
+	for i := range variants {
+		if variants[i].Name == "" {
+			variants[i].Name = fmt.Sprintf("v%d", i+1)
+		}
+		if names[variants[i].Name] {
+			return nil, fmt.Errorf("duplicate variant name '%s'", variants[i].Name)
+		}
+		names[variants[i].Name] = true
+		if variants[i].Model == "" {
+			variants[i].Model = defaultModel
+		}
+		if variants[i].Prompt == "" {
+			variants[i].Prompt = prompt
+		}
+		if variants[i].Prompt == "" {
+			return nil, fmt.Errorf("variant '%s' has no prompt (set it in the file or pass -prompt)", variants[i].Name)
+		}
+	}
+	return variants, nil
+}
+
+// runVariant processes the rows with one configuration, timing every row
+func runVariant(ctx context.Context, config *ProcessingConfig, headers []string, rows [][]string, workers int) *variantResult {
+	result := &variantResult{
+		Values:    make([][]string, len(rows)),
+		Failed:    make([]bool, len(rows)),
+		Status:    make([]map[string]string, len(rows)),
+		Latencies: make([]time.Duration, len(rows)),
+	}
+	usage := make([]TokenUsage, len(rows))
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, common.Max(workers, 1))
+	for r, row := range rows {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(r int, row []string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			rowStart := time.Now()
+			var retries int64
+			output, err := processRow(withRowRetries(ctx, &retries), config, rowToMap(headers, row))
+			result.Latencies[r] = time.Since(rowStart)
+
+			// Failed rows keep empty columns; the status columns say why
+			result.Values[r] = make([]string, len(config.ColumnSpecs))
+			result.Status[r] = make(map[string]string)
+			class := ""
+			if err != nil {
+				result.Failed[r] = true
+				class = classifyError(err)
+			} else {
+				for c, spec := range config.ColumnSpecs {
+					result.Values[r][c] = output.Results[spec.Name]
+				}
+				usage[r] = output.Usage
+			}
+			setRowStatus(result.Status[r], class, err, 1+int(atomic.LoadInt64(&retries)))
+		}(r, row)
+	}
+	wg.Wait()
+	result.Elapsed = time.Since(start)
+
+	for _, u := range usage {
+		result.Usage.add(u)
+	}
+	return result
+}
+
+// printExperimentReport compares the variants: failures, cost, latency and
+// agreement with the first variant, then agreement per column
+func printExperimentReport(variants []ExperimentVariant, columnSpecs []ColumnSpec, results []*variantResult) {
+	same := func(a, b string) bool {
+		return strings.EqualFold(strings.TrimSpace(a), strings.TrimSpace(b))
+	}
+
+	fmt.Println("\n=== EXPERIMENT RESULTS ===")
+	baseline := results[0]
+	reportRows := make([][]string, len(variants))
+	for v, variant := range variants {
+		result := results[v]
+		failed := 0
+		for _, f := range result.Failed {
+			if f {
+				failed++
+			}
+		}
+
+		agreement := "baseline"
+		if v > 0 {
+			agree, compared := 0, 0
+			for r := range result.Values {
+				if result.Failed[r] || baseline.Failed[r] {
+					continue
+				}
+				for c := range columnSpecs {
+					compared++
+					if same(result.Values[r][c], baseline.Values[r][c]) {
+						agree++
+					}
+				}
+			}
+			agreement = "-"
+			if compared > 0 {
+				agreement = common.FormatPercentage(agree, compared)
+			}
+		}
+
+		latencies := append([]time.Duration{}, result.Latencies...)
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+		var total time.Duration
+		for _, l := range latencies {
+			total += l
+		}
+		avg, p95 := time.Duration(0), time.Duration(0)
+		if len(latencies) > 0 {
+			avg = total / time.Duration(len(latencies))
+			p95 = latencies[(len(latencies)*95+99)/100-1]
+		}
+
+		reportRows[v] = []string{
+			variant.Name,
+			variant.Model,
+			fmt.Sprintf("%d", failed),
+			fmt.Sprintf("%d", result.Usage.Total()),
+			fmt.Sprintf("$%.4f", result.Usage.Cost),
+			avg.Round(time.Millisecond).String(),
+			p95.Round(time.Millisecond).String(),
+			agreement,
+		}
+	}
+	fmt.Println(common.FormatTable([]string{"Variant", "Model", "Errors", "Tokens", "Cost", "Avg latency", "p95 latency", "Agreement"}, reportRows, 140))
+
+	// Share of rows where all variants give the same value
+	columnRows := make([][]string, len(columnSpecs))
+	for c, spec := range columnSpecs {
+		agree, compared := 0, 0
+		for r := range baseline.Values {
+			allSame := true
+			skip := false
+			for _, result := range results {
+				if result.Failed[r] {
+					skip = true
+					break
+				}
+				if !same(result.Values[r][c], baseline.Values[r][c]) {
+					allSame = false
+				}
+			}
+			if skip {
+				continue
+			}
+			compared++
+			if allSame {
+				agree++
+			}
+		}
+		columnRows[c] = []string{spec.Name, fmt.Sprintf("%d/%d (%s)", agree, compared, common.FormatPercentage(agree, compared))}
+	}
+	fmt.Println("\nAll variants agree:")
+	fmt.Println(common.FormatTable([]string{"Column", "Rows"}, columnRows, 100))
+}
@@ -0,0 +1,683 @@
+package tools
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"ai-general-tool/common"
+)
+
+// Row expressions select rows by their values, e.g.
+//
+//	amount > 1000 && country == 'DE'
+//	lower(status) in ('open', 'pending') and not empty(email)
+//	`order date` >= '2024-01-01' || notes contains "urgent"
+//
+// Columns are named bare or in backticks; strings are quoted with ' or ".
+// Comparisons are type-aware: values that both read as numbers (in the
+// expression's locale) compare as numbers, values that both read as dates
+// compare as dates, and anything else compares as text.
+
+// rowExpr is a compiled row expression
+type rowExpr struct {
+	source string
+	root   exprNode
+	locale common.Locale
+}
+
+// exprNode is a node of a compiled expression. Values are string, float64,
+// bool or nil for null.
+type exprNode interface {
+	eval(e *rowExpr, row []string) (interface{}, error)
+}
+
+// compileRowExpr parses an expression, resolving its columns against the
+// headers
+func compileRowExpr(source string, headers []string, locale common.Locale) (*rowExpr, error) {
+	tokens, err := tokenizeExpr(source)
+	if err != nil {
+		return nil, fmt.Errorf("invalid expression: %v", err)
+	}
+	p := &exprParser{tokens: tokens, headers: headers}
+	root, err := p.parseOr()
+	if err == nil && p.pos < len(p.tokens) {
+		err = fmt.Errorf("unexpected '%s'", p.tokens[p.pos].text)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid expression: %v", err)
+	}
+	return &rowExpr{source: source, root: root, locale: locale}, nil
+}
+
+// match reports whether a row satisfies the expression
+func (e *rowExpr) match(row []string) (bool, error) {
+	value, err := e.root.eval(e, row)
+	if err != nil {
+		return false, err
+	}
+	return truthy(value), nil
+}
+
+// Token kinds
+const (
+	tokenIdent = iota
+	tokenColumn
+	tokenNumber
+	tokenString
+	tokenOp
+)
+
+type exprToken struct {
+	kind int
+	text string
+}
+
+// exprOperators are the symbol operators, longest first
+var exprOperators = []string{"==", "!=", "<=", ">=", "&&", "||", "<>", "<", ">", "=", "!", "(", ")", ",", "+", "-", "*", "/"}
+
+func tokenizeExpr(source string) ([]exprToken, error) {
+	var tokens []exprToken
+	runes := []rune(source)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '\'' || r == '"' || r == '`':
+			var text strings.Builder
+			j := i + 1
+			for ; j < len(runes) && runes[j] != r; j++ {
+				if runes[j] == '\\' && j+1 < len(runes) {
+					j++
+				}
+				text.WriteRune(runes[j])
+			}
+			if j == len(runes) {
+				return nil, fmt.Errorf("unterminated %c", r)
+			}
+			kind := tokenString
+			if r == '`' {
+				kind = tokenColumn
+			}
+			tokens = append(tokens, exprToken{kind, text.String()})
+			i = j + 1
+		case unicode.IsDigit(r) || r == '.' && i+1 < len(runes) && unicode.IsDigit(runes[i+1]):
+			j := i
+			for j < len(runes) && (unicode.IsDigit(runes[j]) || runes[j] == '.' || runes[j] == 'e' || runes[j] == 'E') {
+				j++
+			}
+			tokens = append(tokens, exprToken{tokenNumber, string(runes[i:j])})
+			i = j
+		case unicode.IsLetter(r) || r == '_':
+			j := i
+			for j < len(runes) && (unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j]) || runes[j] == '_' || runes[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, exprToken{tokenIdent, string(runes[i:j])})
+			i = j
+		default:
+			op := ""
+			for _, candidate := range exprOperators {
+				if strings.HasPrefix(string(runes[i:]), candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected character '%c'", r)
+			}
+			tokens = append(tokens, exprToken{tokenOp, op})
+			i += len([]rune(op))
+		}
+	}
+	return tokens, nil
+}
+
+// exprParser is a recursive descent parser. From loosest to tightest:
+// or, and, not, comparisons, + and -, * and /, unary minus.
+type exprParser struct {
+	tokens  []exprToken
+	pos     int
+	headers []string
+}
+
+// accept consumes the next token when it is one of the given operators or
+// keywords (case-insensitive) and returns it
+func (p *exprParser) accept(words ...string) (string, bool) {
+	if p.pos >= len(p.tokens) {
+		return "", false
+	}
+	t := p.tokens[p.pos]
+	if t.kind != tokenOp && t.kind != tokenIdent {
+		return "", false
+	}
+	for _, word := range words {
+		if strings.EqualFold(t.text, word) {
+			p.pos++
+			return word, true
+		}
+	}
+	return "", false
+}
+
+func (p *exprParser) expect(op string) error {
+	if _, ok := p.accept(op); !ok {
+		if p.pos >= len(p.tokens) {
+			return fmt.Errorf("expected '%s' at the end", op)
+		}
+		return fmt.Errorf("expected '%s' before '%s'", op, p.tokens[p.pos].text)
+	}
+	return nil
+}
+
+func (p *exprParser) parseOr() (exprNode, error) {
+	left, err := p.parseAnd()
+	for err == nil {
+		if _, ok := p.accept("||", "or"); !ok {
+			break
+		}
+		var right exprNode
+		if right, err = p.parseAnd(); err == nil {
+			left = logicNode{or: true, left: left, right: right}
+		}
+	}
+	return left, err
+}
+
+func (p *exprParser) parseAnd() (exprNode, error) {
+	left, err := p.parseNot()
+	for err == nil {
+		if _, ok := p.accept("&&", "and"); !ok {
+			break
+		}
+		var right exprNode
+		if right, err = p.parseNot(); err == nil {
+			left = logicNode{left: left, right: right}
+		}
+	}
+	return left, err
+}
+
+func (p *exprParser) parseNot() (exprNode, error) {
+	if _, ok := p.accept("!", "not"); ok {
+		operand, err := p.parseNot()
+		return notNode{operand}, err
+	}
+	return p.parseComparison()
+}
+
+func (p *exprParser) parseComparison() (exprNode, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	negate := false
+	if _, ok := p.accept("not"); ok {
+		negate = true
+	}
+	op, ok := p.accept("==", "!=", "<>", "<=", ">=", "<", ">", "=", "contains", "startswith", "endswith", "matches", "in")
+	if !ok {
+		if negate {
+			return nil, fmt.Errorf("expected an operator after 'not'")
+		}
+		return left, nil
+	}
+	var node exprNode
+	switch op {
+	case "in":
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		list := inNode{value: left}
+		for {
+			item, err := p.parseAdditive()
+			if err != nil {
+				return nil, err
+			}
+			list.items = append(list.items, item)
+			if _, ok := p.accept(","); !ok {
+				break
+			}
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		node = list
+	case "matches":
+		pattern, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		literal, ok := pattern.(literalNode)
+		text, isText := literal.value.(string)
+		if !ok || !isText {
+			return nil, fmt.Errorf("matches takes a quoted regular expression")
+		}
+		re, err := regexp.Compile(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression '%s': %v", text, err)
+		}
+		node = matchNode{value: left, re: re}
+	default:
+		right, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		node = compareNode{op: op, left: left, right: right}
+	}
+	if negate {
+		node = notNode{node}
+	}
+	return node, nil
+}
+
+func (p *exprParser) parseAdditive() (exprNode, error) {
+	left, err := p.parseMultiplicative()
+	for err == nil {
+		op, ok := p.accept("+", "-")
+		if !ok {
+			break
+		}
+		var right exprNode
+		if right, err = p.parseMultiplicative(); err == nil {
+			left = arithNode{op: op, left: left, right: right}
+		}
+	}
+	return left, err
+}
+
+func (p *exprParser) parseMultiplicative() (exprNode, error) {
+	left, err := p.parseUnary()
+	for err == nil {
+		op, ok := p.accept("*", "/")
+		if !ok {
+			break
+		}
+		var right exprNode
+		if right, err = p.parseUnary(); err == nil {
+			left = arithNode{op: op, left: left, right: right}
+		}
+	}
+	return left, err
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	if _, ok := p.accept("-"); ok {
+		operand, err := p.parseUnary()
+		return arithNode{op: "-", left: literalNode{0.0}, right: operand}, err
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	if p.pos >= len(p.tokens) {
+		return nil, fmt.Errorf("unexpected end")
+	}
+	t := p.tokens[p.pos]
+	p.pos++
+	switch t.kind {
+	case tokenNumber:
+		number, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number '%s'", t.text)
+		}
+		return literalNode{number}, nil
+	case tokenString:
+		return literalNode{t.text}, nil
+	case tokenColumn:
+		return p.column(t.text)
+	case tokenOp:
+		if t.text != "(" {
+			return nil, fmt.Errorf("unexpected '%s'", t.text)
+		}
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		return node, p.expect(")")
+	}
+
+	switch strings.ToLower(t.text) {
+	case "true":
+		return literalNode{true}, nil
+	case "false":
+		return literalNode{false}, nil
+	case "null":
+		return literalNode{nil}, nil
+	}
+	if _, ok := exprFunctions[strings.ToLower(t.text)]; ok && p.pos < len(p.tokens) && p.tokens[p.pos].text == "(" {
+		p.pos++
+		call := callNode{name: strings.ToLower(t.text)}
+		if _, ok := p.accept(")"); !ok {
+			for {
+				arg, err := p.parseOr()
+				if err != nil {
+					return nil, err
+				}
+				call.args = append(call.args, arg)
+				if _, ok := p.accept(","); !ok {
+					break
+				}
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+		}
+		if len(call.args) != 1 {
+			return nil, fmt.Errorf("%s takes one argument", call.name)
+		}
+		return call, nil
+	}
+	return p.column(t.text)
+}
+
+func (p *exprParser) column(name string) (exprNode, error) {
+	index := indexOf(p.headers, name)
+	if index == -1 {
+		return nil, fmt.Errorf("column '%s' not found (quote column names with spaces in backticks, text in ' or \")", name)
+	}
+	return columnNode{index}, nil
+}
+
+type literalNode struct{ value interface{} }
+
+func (n literalNode) eval(*rowExpr, []string) (interface{}, error) { return n.value, nil }
+
+type columnNode struct{ index int }
+
+func (n columnNode) eval(_ *rowExpr, row []string) (interface{}, error) {
+	value := cell(row, n.index)
+	if common.IsNull(value) {
+		return nil, nil
+	}
+	return value, nil
+}
+
+type notNode struct{ operand exprNode }
+
+func (n notNode) eval(e *rowExpr, row []string) (interface{}, error) {
+	value, err := n.operand.eval(e, row)
+	return !truthy(value), err
+}
+
+type logicNode struct {
+	or          bool
+	left, right exprNode
+}
+
+func (n logicNode) eval(e *rowExpr, row []string) (interface{}, error) {
+	left, err := n.left.eval(e, row)
+	if err != nil {
+		return nil, err
+	}
+	if truthy(left) == n.or {
+		return n.or, nil
+	}
+	right, err := n.right.eval(e, row)
+	return truthy(right), err
+}
+
+type compareNode struct {
+	op          string
+	left, right exprNode
+}
+
+func (n compareNode) eval(e *rowExpr, row []string) (interface{}, error) {
+	left, err := n.left.eval(e, row)
+	if err != nil {
+		return nil, err
+	}
+	right, err := n.right.eval(e, row)
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case "contains":
+		return strings.Contains(strings.ToLower(exprText(left)), strings.ToLower(exprText(right))), nil
+	case "startswith":
+		return strings.HasPrefix(strings.ToLower(exprText(left)), strings.ToLower(exprText(right))), nil
+	case "endswith":
+		return strings.HasSuffix(strings.ToLower(exprText(left)), strings.ToLower(exprText(right))), nil
+	}
+
+	// Null equals only null and is neither smaller nor larger than anything
+	if left == nil || right == nil {
+		switch n.op {
+		case "==", "=":
+			return left == nil && right == nil, nil
+		case "!=", "<>":
+			return (left == nil) != (right == nil), nil
+		}
+		return false, nil
+	}
+	c := compareExprValues(left, right, e.locale)
+	switch n.op {
+	case "==", "=":
+		return c == 0, nil
+	case "!=", "<>":
+		return c != 0, nil
+	case "<":
+		return c < 0, nil
+	case "<=":
+		return c <= 0, nil
+	case ">":
+		return c > 0, nil
+	}
+	return c >= 0, nil
+}
+
+type inNode struct {
+	value exprNode
+	items []exprNode
+}
+
+func (n inNode) eval(e *rowExpr, row []string) (interface{}, error) {
+	value, err := n.value.eval(e, row)
+	if err != nil || value == nil {
+		return false, err
+	}
+	for _, item := range n.items {
+		candidate, err := item.eval(e, row)
+		if err != nil {
+			return nil, err
+		}
+		if candidate != nil && compareExprValues(value, candidate, e.locale) == 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+type matchNode struct {
+	value exprNode
+	re    *regexp.Regexp
+}
+
+func (n matchNode) eval(e *rowExpr, row []string) (interface{}, error) {
+	value, err := n.value.eval(e, row)
+	return value != nil && n.re.MatchString(exprText(value)), err
+}
+
+type arithNode struct {
+	op          string
+	left, right exprNode
+}
+
+func (n arithNode) eval(e *rowExpr, row []string) (interface{}, error) {
+	left, err := n.left.eval(e, row)
+	if err != nil {
+		return nil, err
+	}
+	right, err := n.right.eval(e, row)
+	if err != nil {
+		return nil, err
+	}
+	a, okA := exprNumber(left, e.locale)
+	b, okB := exprNumber(right, e.locale)
+	if !okA || !okB {
+		if n.op == "+" && left != nil && right != nil {
+			return exprText(left) + exprText(right), nil
+		}
+		return nil, nil
+	}
+	switch n.op {
+	case "+":
+		return a + b, nil
+	case "-":
+		return a - b, nil
+	case "*":
+		return a * b, nil
+	}
+	if b == 0 {
+		return nil, nil
+	}
+	return a / b, nil
+}
+
+// exprFunctions are the functions of row expressions, each taking one value
+var exprFunctions = map[string]func(value interface{}, locale common.Locale) interface{}{
+	"lower": func(v interface{}, _ common.Locale) interface{} { return exprNullable(v, strings.ToLower) },
+	"upper": func(v interface{}, _ common.Locale) interface{} { return exprNullable(v, strings.ToUpper) },
+	"trim":  func(v interface{}, _ common.Locale) interface{} { return exprNullable(v, strings.TrimSpace) },
+	"len": func(v interface{}, _ common.Locale) interface{} {
+		return float64(len([]rune(exprText(v))))
+	},
+	"empty": func(v interface{}, _ common.Locale) interface{} {
+		return v == nil || strings.TrimSpace(exprText(v)) == ""
+	},
+	"number": func(v interface{}, locale common.Locale) interface{} {
+		if number, ok := exprNumber(v, locale); ok {
+			return number
+		}
+		return nil
+	},
+	"year": func(v interface{}, locale common.Locale) interface{} {
+		if date, ok := common.ParseDate(exprText(v), locale); ok && v != nil {
+			return float64(date.Year())
+		}
+		return nil
+	},
+	"month": func(v interface{}, locale common.Locale) interface{} {
+		if date, ok := common.ParseDate(exprText(v), locale); ok && v != nil {
+			return float64(date.Month())
+		}
+		return nil
+	},
+}
+
+type callNode struct {
+	name string
+	args []exprNode
+}
+
+func (n callNode) eval(e *rowExpr, row []string) (interface{}, error) {
+	value, err := n.args[0].eval(e, row)
+	if err != nil {
+		return nil, err
+	}
+	return exprFunctions[n.name](value, e.locale), nil
+}
+
+// exprNullable applies a text function to a value, keeping null
+func exprNullable(v interface{}, f func(string) string) interface{} {
+	if v == nil {
+		return nil
+	}
+	return f(exprText(v))
+}
+
+// exprText returns a value as text
+func exprText(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return fmt.Sprint(v)
+}
+
+// exprNumber reads a value as a number: plain, amount or percentage
+func exprNumber(v interface{}, locale common.Locale) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, !math.IsNaN(v)
+	case string:
+		return numericValue(v, locale)
+	}
+	return 0, false
+}
+
+// compareExprValues compares two non-null values as numbers when both read
+// as numbers, as dates when both read as dates, and as case-sensitive text
+// otherwise. Booleans compare with the text true, yes, 1 and the like.
+func compareExprValues(a, b interface{}, locale common.Locale) int {
+	if x, ok := a.(bool); ok {
+		a = boolText(x)
+		b = boolText(truthyText(exprText(b)))
+	} else if y, ok := b.(bool); ok {
+		a = boolText(truthyText(exprText(a)))
+		b = boolText(y)
+	}
+	if x, ok := exprNumber(a, locale); ok {
+		if y, ok := exprNumber(b, locale); ok {
+			switch {
+			case x < y:
+				return -1
+			case x > y:
+				return 1
+			}
+			return 0
+		}
+	}
+	textA, textB := exprText(a), exprText(b)
+	if x, ok := common.ParseDate(textA, locale); ok {
+		if y, ok := common.ParseDate(textB, locale); ok {
+			return x.Compare(y)
+		}
+	}
+	return strings.Compare(textA, textB)
+}
+
+func boolText(b bool) string {
+	if b {
+		return "true"
+	}
+	return "false"
+}
+
+// truthyText reads text as a boolean: true, yes, y and 1 are true
+func truthyText(s string) bool {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "true", "yes", "y", "1":
+		return true
+	}
+	return false
+}
+
+// truthy reports whether a value counts as true: non-null, non-zero numbers,
+// true, and text other than empty, false, no, n and 0
+func truthy(v interface{}) bool {
+	switch v := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case float64:
+		return v != 0
+	case string:
+		switch strings.ToLower(strings.TrimSpace(v)) {
+		case "", "false", "no", "n", "0":
+			return false
+		}
+	}
+	return true
+}
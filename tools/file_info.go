@@ -0,0 +1,339 @@
+package tools
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/joho/godotenv"
+)
+
+// infoSampleRows is the number of first rows the cost estimate of the info
+// command is computed from
+const infoSampleRows = 20
+
+// FileInfo is what the info command reports about a file
+type FileInfo struct {
+	File     string        `json:"file"`
+	Type     string        `json:"type"`
+	Size     int64         `json:"size_bytes"`
+	Encoding string        `json:"encoding,omitempty"` // text files only
+	Dialect  string        `json:"dialect,omitempty"`  // CSV files only
+	Sheets   []string      `json:"sheets,omitempty"`   // workbooks only
+	Sheet    string        `json:"sheet,omitempty"`    // the sheet counted
+	Rows     int           `json:"rows"`
+	Columns  []string      `json:"columns"`
+	Estimate *InfoEstimate `json:"estimate,omitempty"`
+}
+
+// InfoEstimate is the projected cost of enriching every row of a file
+type InfoEstimate struct {
+	Model        string  `json:"model"`
+	Columns      int     `json:"generated_columns"`
+	InputTokens  float64 `json:"input_tokens_per_row"`
+	OutputTokens float64 `json:"output_tokens_per_row"`
+	CostPerRow   float64 `json:"cost_per_row"`
+	Cost         float64 `json:"cost"`
+	Approximate  bool    `json:"approximate,omitempty"` // counted as 4 characters per token
+}
+
+// RunFileInfo handles the info command: it prints the size, encoding,
+// dialect, sheets, row and column counts of a file and what enriching it
+// would cost, without analyzing its columns. CSV files are read once without
+// loading them into memory; .xlsx row counts come from the sheet's range.
+func RunFileInfo(args []string) error {
+	fs := flag.NewFlagSet("info", flag.ExitOnError)
+
+	// Define flags
+	inputFile := fs.String("input", "", "Input file")
+	format := fs.String("format", "text", "Output format: text or json")
+	applyJSON := jsonFlag(fs, format)
+	model := fs.String("model", defaultModel, "Model the cost is estimated for")
+	columns := fs.String("columns", "result", "Comma-separated columns a run would generate, with @model suffixes as for process-data")
+	prompt := fs.String("prompt", "", "Prompt a run would use (default: none; the row data is counted)")
+	answerTokens := fs.Int("answer-tokens", 10, "Tokens assumed per generated value")
+	input := inputFlags(fs)
+
+	// Parse flags
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	// Handle positional argument for filename
+	if *inputFile == "" && fs.NArg() > 0 {
+		*inputFile = fs.Arg(0)
+	}
+
+	if *inputFile == "" {
+		return fmt.Errorf("input file is required")
+	}
+	applyJSON()
+	if *format != "text" && *format != "json" {
+		return fmt.Errorf("invalid format '%s' (use text or json)", *format)
+	}
+
+	info, sample, err := fileInfo(*inputFile, *input)
+	if err != nil {
+		return fmt.Errorf("error reading %s: %v", *inputFile, err)
+	}
+
+	// Prices and the default model follow the settings of a run
+	godotenv.Load(".env")
+	if err := loadPricingOverrides(); err != nil {
+		return err
+	}
+	config := &ProcessingConfig{ColumnSpecs: parseColumnSpecs(*columns), Prompt: *prompt, Model: *model}
+	if info.Estimate, err = estimateInfo(config, info.Columns, sample, info.Rows, *answerTokens); err != nil {
+		return fmt.Errorf("error estimating cost: %v", err)
+	}
+
+	if *format == "json" {
+		return printJSON(info)
+	}
+	info.print()
+	return nil
+}
+
+// fileInfo describes a file and returns its first rows for the estimate
+func fileInfo(filename string, opts InputOptions) (*FileInfo, [][]string, error) {
+	info := &FileInfo{File: filename, Type: fileType(filename)}
+	if !isCloudURI(filename) && !isConnectorSource(filename) && !isDatabaseSource(filename) && filename != stdioName {
+		stat, err := os.Stat(filename)
+		if err != nil {
+			return nil, nil, err
+		}
+		info.Size = stat.Size()
+	}
+
+	if isExcelWorkbook(filename) || isODSFile(filename) || isXLSFile(filename) {
+		sheets, err := summarizeSheets(filename)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, sheet := range sheets {
+			info.Sheets = append(info.Sheets, sheet.Name)
+		}
+		if isAllSheets(opts.Sheet) {
+			info.Sheet = allSheets
+		} else {
+			n, err := findSheet(info.Sheets, opts.Sheet)
+			if err != nil {
+				return nil, nil, err
+			}
+			info.Sheet = info.Sheets[n-1]
+			// .xlsx sizes come from the sheet's range, so only the first
+			// rows are read
+			if isExcelWorkbook(filename) {
+				info.Rows = max(sheets[n-1].Rows-opts.Header.top(), 0)
+			}
+		}
+	}
+	if isCSVFile(filename) && filename != stdioName {
+		encoding, dialect, err := sniffTextFile(filename, opts.CSV)
+		if err != nil {
+			return nil, nil, err
+		}
+		info.Encoding, info.Dialect = encoding, dialect
+	}
+
+	var sample [][]string
+	if canStreamInput(filename) {
+		headers, source, closer, err := openStreamInput(filename, opts)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer closer.Close()
+		info.Columns = headers
+		counted := info.Rows > 0 && !isAllSheets(opts.Sheet)
+		for rows := 0; ; rows++ {
+			if counted && rows == infoSampleRows {
+				break
+			}
+			row, err := source.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, nil, fmt.Errorf("error reading row %d: %v", rows+1, err)
+			}
+			if len(sample) < infoSampleRows {
+				sample = append(sample, row)
+			}
+			if !counted {
+				info.Rows = rows + 1
+			}
+		}
+		return info, sample, nil
+	}
+
+	headers, rows, err := loadInputFile(filename, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	info.Columns, info.Rows = headers, len(rows)
+	return info, rows[:min(len(rows), infoSampleRows)], nil
+}
+
+// fileType names the format of a file for the info command
+func fileType(filename string) string {
+	var name string
+	switch {
+	case isConnectorSource(filename) || isDatabaseSource(filename):
+		return "connector"
+	case isExcelWorkbook(filename):
+		name = "Excel"
+	case isXLSFile(filename):
+		name = "Excel 97-2003"
+	case isODSFile(filename):
+		name = "OpenDocument spreadsheet"
+	case isSQLiteFile(filename):
+		name = "SQLite"
+	case dataExt(filename) == ".jsonl":
+		name = "JSON Lines"
+	case dataExt(filename) == ".json":
+		name = "JSON"
+	default:
+		name = "CSV"
+	}
+	if isGzipFile(filename) {
+		name += " (gzip)"
+	}
+	return name
+}
+
+// sniffTextFile detects the encoding and CSV dialect of a text file from its
+// first 16 KB. Encodings are told apart by their byte order mark; without
+// one, text that is not valid UTF-8 is reported as a single-byte encoding.
+func sniffTextFile(filename string, opts CSVOptions) (string, string, error) {
+	fixed, err := opts.dialect()
+	if err != nil {
+		return "", "", err
+	}
+	file, err := openInput(filename)
+	if err != nil {
+		return "", "", err
+	}
+	defer file.Close()
+	sample := make([]byte, csvSniffSize)
+	n, err := io.ReadFull(file, sample)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", "", err
+	}
+	sample = sample[:n]
+
+	var encoding string
+	switch {
+	case strings.HasPrefix(string(sample), "\xef\xbb\xbf"):
+		encoding = "UTF-8 with BOM"
+	case strings.HasPrefix(string(sample), "\xff\xfe"):
+		encoding = "UTF-16 LE"
+	case strings.HasPrefix(string(sample), "\xfe\xff"):
+		encoding = "UTF-16 BE"
+	case validUTF8Prefix(sample):
+		encoding = "UTF-8"
+	default:
+		encoding = "not UTF-8 (likely Windows-1252 or ISO-8859-1)"
+	}
+	return encoding, sniffCSV(sample, fixed).String(), nil
+}
+
+// validUTF8Prefix reports whether a sample is valid UTF-8, allowing it to
+// end in the middle of a character
+func validUTF8Prefix(sample []byte) bool {
+	for i := 0; i < utf8.UTFMax && len(sample) > 0; i++ {
+		if utf8.Valid(sample) {
+			return true
+		}
+		sample = sample[:len(sample)-1]
+	}
+	return utf8.Valid(sample)
+}
+
+// estimateInfo projects the cost of enriching rows with the run settings:
+// the prompt tokens are counted from the sample rows, the generated tokens
+// assumed per value
+func estimateInfo(config *ProcessingConfig, headers []string, sample [][]string, rows, answerTokens int) (*InfoEstimate, error) {
+	if len(sample) == 0 {
+		return nil, nil
+	}
+	outcome := &sampleOutcome{}
+	for _, row := range sample {
+		outcome.Rows = append(outcome.Rows, rowToMap(headers, row))
+	}
+	estimate, err := estimateRun(config, outcome)
+	if err != nil {
+		return nil, err
+	}
+
+	var models []string
+	for _, group := range groupColumnsByModel(config) {
+		tokens := float64(len(group.Specs)*answerTokens + tokensPerReply)
+		price, _ := priceFor(group.Model)
+		estimate.OutputTokens += tokens
+		estimate.OutputCost += tokens * price.Output / 1000000
+		models = append(models, group.Model)
+	}
+	perRow := estimate.InputCost + estimate.OutputCost
+	return &InfoEstimate{
+		Model:        strings.Join(models, ", "),
+		Columns:      len(config.ColumnSpecs),
+		InputTokens:  estimate.InputTokens,
+		OutputTokens: estimate.OutputTokens,
+		CostPerRow:   perRow,
+		Cost:         perRow * float64(rows),
+		Approximate:  estimate.Tokenizer != nil,
+	}, nil
+}
+
+// print shows the file info as aligned lines
+func (info *FileInfo) print() {
+	fmt.Printf("File:      %s\n", info.File)
+	fmt.Printf("Type:      %s\n", info.Type)
+	if info.Size >= 1024 {
+		fmt.Printf("Size:      %s (%d bytes)\n", formatFileSize(info.Size), info.Size)
+	} else if info.Size > 0 {
+		fmt.Printf("Size:      %d bytes\n", info.Size)
+	}
+	if info.Encoding != "" {
+		fmt.Printf("Encoding:  %s\n", info.Encoding)
+	}
+	if info.Dialect != "" {
+		fmt.Printf("Dialect:   %s\n", info.Dialect)
+	}
+	if len(info.Sheets) > 0 {
+		names := make([]string, len(info.Sheets))
+		for i, name := range info.Sheets {
+			names[i] = fmt.Sprintf("%d. %s", i+1, name)
+		}
+		fmt.Printf("Sheets:    %s\n", strings.Join(names, ", "))
+		fmt.Printf("Sheet:     %s\n", info.Sheet)
+	}
+	fmt.Printf("Rows:      %d\n", info.Rows)
+	fmt.Printf("Columns:   %d (%s)\n", len(info.Columns), strings.Join(info.Columns, ", "))
+	if e := info.Estimate; e != nil {
+		method := ""
+		if e.Approximate {
+			method = ", approximate"
+		}
+		fmt.Printf("Estimate:  %d generated column(s) with %s: ~%.0f input and ~%.0f output tokens per row%s\n", e.Columns, e.Model, e.InputTokens, e.OutputTokens, method)
+		fmt.Printf("Cost:      ~$%.4f for %d rows (~$%.4f per 1,000 rows)\n", e.Cost, info.Rows, e.CostPerRow*1000)
+	}
+}
+
+// formatFileSize formats a byte count in KB, MB or GB
+func formatFileSize(size int64) string {
+	units := []string{"bytes", "KB", "MB", "GB", "TB"}
+	value := float64(size)
+	unit := 0
+	for value >= 1024 && unit < len(units)-1 {
+		value /= 1024
+		unit++
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%d bytes", size)
+	}
+	return fmt.Sprintf("%.1f %s", value, units[unit])
+}
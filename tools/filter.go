@@ -0,0 +1,112 @@
+package tools
+
+import (
+	"flag"
+	"fmt"
+
+	"ai-general-tool/common"
+)
+
+// RunFilter handles the filter command: it keeps the rows matching a row
+// expression, e.g. to send only the relevant rows through enrichment
+func RunFilter(args []string) error {
+	fs := flag.NewFlagSet("filter", flag.ExitOnError)
+
+	// Define flags
+	inputFile := fs.String("input", "", "Input file (CSV, Excel or JSON)")
+	where := fs.String("where", "", "Row expression, e.g. \"amount > 1000 && country == 'DE'\" (required)")
+	invert := fs.Bool("invert", false, "Keep the rows that do not match instead")
+	count := fs.Bool("count", false, "Only print how many rows match")
+	outputFile := fs.String("output", "", "Output file (default: <input>_filtered)")
+	fs.StringVar(outputFile, "o", "", "Shorthand for -output")
+	input := inputFlags(fs)
+	output := &OutputOptions{}
+	fs.StringVar(&output.Format, "format", "same", "Output format: same, csv, sqlite, ods, md (Markdown table), html")
+	fs.BoolVar(&output.QuoteAll, "quote-all", false, "Quote every field of CSV output")
+	var locale common.Locale
+	localeFlag(fs, &locale)
+
+	// Parse flags
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	// Handle positional argument for filename
+	if *inputFile == "" && fs.NArg() > 0 {
+		*inputFile = fs.Arg(0)
+	}
+
+	// Validation
+	if *inputFile == "" {
+		return fmt.Errorf("input file is required")
+	}
+	if *where == "" {
+		return fmt.Errorf("-where is required")
+	}
+	toStdout, err := useStdout(*inputFile, outputFile, *output)
+	if err != nil {
+		return err
+	}
+	if *outputFile == "" && !*count {
+		*outputFile = suffixedOutputFile(*inputFile, output.Format, "_filtered")
+	}
+	if *outputFile == *inputFile && *inputFile != stdioName {
+		return fmt.Errorf("output would overwrite the input %s", *inputFile)
+	}
+
+	fmt.Printf("Loading %s...\n", *inputFile)
+	headers, rows, err := loadInputFile(*inputFile, *input)
+	if err != nil {
+		return fmt.Errorf("error loading input: %v", err)
+	}
+	expr, err := compileRowExpr(*where, headers, locale)
+	if err != nil {
+		return err
+	}
+	kept, err := filterRows(expr, rows, *invert)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Rows matching: %d of %d (%s)\n", len(kept), len(rows), common.FormatPercentage(len(kept), len(rows)))
+	if *count {
+		return nil
+	}
+
+	if err := saveOutputTable(*outputFile, headers, kept, nil, *output); err != nil {
+		return fmt.Errorf("error saving output: %v", err)
+	}
+	if !toStdout {
+		fmt.Printf("Output saved to: %s\n", *outputFile)
+	}
+	return nil
+}
+
+// filterRows returns the rows matching an expression, or with invert those
+// that do not
+func filterRows(expr *rowExpr, rows [][]string, invert bool) ([][]string, error) {
+	matched, err := matchingRows(expr, rows, invert)
+	if err != nil {
+		return nil, err
+	}
+	kept := make([][]string, len(matched))
+	for i, r := range matched {
+		kept[i] = rows[r]
+	}
+	return kept, nil
+}
+
+// matchingRows returns the indexes of the rows matching an expression, or
+// with invert of those that do not
+func matchingRows(expr *rowExpr, rows [][]string, invert bool) ([]int, error) {
+	var matched []int
+	for r, row := range rows {
+		ok, err := expr.match(row)
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %v", r+1, err)
+		}
+		if ok != invert {
+			matched = append(matched, r)
+		}
+	}
+	return matched, nil
+}
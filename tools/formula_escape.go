@@ -0,0 +1,68 @@
+package tools
+
+import (
+	"strconv"
+	"strings"
+)
+
+// formulaTriggers are the first characters that make spreadsheets read a
+// CSV field as a formula
+const formulaTriggers = "=+-@\t\r"
+
+// escapeFormula prefixes a value that a spreadsheet opening the CSV would run
+// as a formula with ', which Excel and LibreOffice show as text. Numbers such
+// as -5 or +1.5 are left as they are.
+func escapeFormula(value string) string {
+	if value == "" || !strings.ContainsRune(formulaTriggers, rune(value[0])) {
+		return value
+	}
+	if _, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+		return value
+	}
+	return "'" + value
+}
+
+// generatedColumns returns the indexes in headers of the generated columns
+func generatedColumns(headers []string, columnSpecs []ColumnSpec) []int {
+	var cols []int
+	for _, spec := range columnSpecs {
+		if idx := indexOf(headers, spec.Name); idx != -1 {
+			cols = append(cols, idx)
+		}
+	}
+	return cols
+}
+
+// escapeRow escapes the given columns of a row, copying it only when a value
+// changes
+func escapeRow(row []string, cols []int) []string {
+	escaped, copied := row, false
+	for _, col := range cols {
+		if col >= len(row) {
+			continue
+		}
+		if value := escapeFormula(row[col]); value != row[col] {
+			if !copied {
+				escaped, copied = append([]string(nil), row...), true
+			}
+			escaped[col] = value
+		}
+	}
+	return escaped
+}
+
+// escapeGeneratedFormulas escapes the generated columns of an output table
+// written as CSV, leaving the rows it was given unchanged: model output is
+// untrusted, and a value like =HYPERLINK(...) would be live when the file is
+// opened in a spreadsheet
+func escapeGeneratedFormulas(headers []string, rows [][]string, columnSpecs []ColumnSpec) [][]string {
+	cols := generatedColumns(headers, columnSpecs)
+	if len(cols) == 0 {
+		return rows
+	}
+	escaped := make([][]string, len(rows))
+	for r, row := range rows {
+		escaped[r] = escapeRow(row, cols)
+	}
+	return escaped
+}
@@ -0,0 +1,99 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Geocoder resolves a free-text address to coordinates
+type Geocoder interface {
+	// Geocode returns the coordinates of query, with found=false when the
+	// provider has no match
+	Geocode(query string) (lat, lon float64, found bool, err error)
+}
+
+// geocoders maps provider names to their constructors
+var geocoders = map[string]func() (Geocoder, error){
+	"nominatim": newNominatimGeocoder,
+}
+
+// nominatimGeocoder uses the OpenStreetMap Nominatim search API. The public
+// instance allows at most one request per second; NOMINATIM_URL can point at
+// a self-hosted instance instead.
+type nominatimGeocoder struct {
+	baseURL  string
+	client   *http.Client
+	mu       sync.Mutex
+	lastCall time.Time
+	interval time.Duration
+}
+
+func newNominatimGeocoder() (Geocoder, error) {
+	baseURL := os.Getenv("NOMINATIM_URL")
+	if baseURL == "" {
+		baseURL = "https://nominatim.openstreetmap.org"
+	}
+	return &nominatimGeocoder{
+		baseURL:  baseURL,
+		client:   &http.Client{Timeout: 30 * time.Second},
+		interval: time.Second,
+	}, nil
+}
+
+// Geocode looks up the query, respecting the provider rate limit
+func (g *nominatimGeocoder) Geocode(query string) (float64, float64, bool, error) {
+	g.mu.Lock()
+	if wait := g.interval - time.Since(g.lastCall); wait > 0 {
+		time.Sleep(wait)
+	}
+	g.lastCall = time.Now()
+	g.mu.Unlock()
+
+	params := url.Values{}
+	params.Set("q", query)
+	params.Set("format", "json")
+	params.Set("limit", "1")
+
+	req, err := http.NewRequest(http.MethodGet, g.baseURL+"/search?"+params.Encode(), nil)
+	if err != nil {
+		return 0, 0, false, err
+	}
+	req.Header.Set("User-Agent", "ai-general-tool")
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return 0, 0, false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, 0, false, fmt.Errorf("geocoder returned HTTP %d", resp.StatusCode)
+	}
+
+	var results []struct {
+		Lat string `json:"lat"`
+		Lon string `json:"lon"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&results); err != nil {
+		return 0, 0, false, fmt.Errorf("invalid geocoder response: %v", err)
+	}
+	if len(results) == 0 {
+		return 0, 0, false, nil
+	}
+
+	lat, err := strconv.ParseFloat(results[0].Lat, 64)
+	if err != nil {
+		return 0, 0, false, err
+	}
+	lon, err := strconv.ParseFloat(results[0].Lon, 64)
+	if err != nil {
+		return 0, 0, false, err
+	}
+	return lat, lon, true, nil
+}
@@ -0,0 +1,296 @@
+package tools
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/openai/openai-go/option"
+)
+
+// Log levels of --log-level: debug adds a line per API request, warn hides
+// notes and error hides warnings as well
+const (
+	logDebug = "debug"
+	logInfo  = "info"
+	logWarn  = "warn"
+	logError = "error"
+)
+
+var logLevels = map[string]int{logDebug: 0, logInfo: 1, logWarn: 2, logError: 3}
+
+// The log level and --no-color pass to child processes, such as the runs of
+// daemon and watch, through the environment. NO_COLOR is the common
+// convention of terminal programs.
+const (
+	logLevelEnv = "AITOOL_LOG_LEVEL"
+	noColorEnv  = "NO_COLOR"
+)
+
+// GlobalFlags are the flags every command takes, before its name or among
+// its flags
+type GlobalFlags struct {
+	Config   string // settings file replacing aitool.yaml
+	LogLevel string
+	JSON     bool // machine-readable output, for the commands that have -json
+	NoColor  bool // no terminal escape codes
+	Yes      bool // skip confirmation prompts, for the commands that have -yes
+}
+
+// globals are the global flags of the running command
+var globals GlobalFlags
+
+// GlobalFlagUsage documents the global flags in help output
+const GlobalFlagUsage = `Global flags (before the command or among its flags):
+  --config <file>      Settings file to use instead of aitool.yaml (same as $AITOOL_CONFIG)
+  --log-level <level>  debug (adds a line per API request), info (default), warn (hides notes) or error (hides warnings too)
+  --json               Machine-readable JSON output, for commands that have -json
+  --no-color           No terminal escape codes: progress is printed as plain text (same as $NO_COLOR)
+  --yes                Skip confirmation prompts, for commands that have -yes
+`
+
+// ParseGlobalFlags takes the global flags at the start of args, before the
+// command, and applies them. Single and double dashes are both accepted, as
+// for the other flags. The global flags among a command's flags are taken by
+// parseFlags.
+func ParseGlobalFlags(args []string) ([]string, error) {
+	for len(args) > 0 {
+		n, err := takeGlobalFlag(args)
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			break
+		}
+		args = args[n:]
+	}
+	return args, applyGlobals()
+}
+
+// commandGlobalFlags takes the global flags out of a command's arguments.
+// Like fs.Parse, it stops at the first argument that is not a flag or a flag
+// value, so the arguments after it, which may be forwarded to another
+// command, are left alone. Flags the command defines itself stay its own.
+func commandGlobalFlags(fs *flag.FlagSet, args []string) ([]string, error) {
+	var rest []string
+	for i := 0; i < len(args); {
+		arg := args[i]
+		if arg == "-" || arg == "--" || !strings.HasPrefix(arg, "-") {
+			rest = append(rest, args[i:]...)
+			break
+		}
+		name, _, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if f := fs.Lookup(name); f != nil {
+			n := 1
+			if b, ok := f.Value.(interface{ IsBoolFlag() bool }); !hasValue && !(ok && b.IsBoolFlag()) {
+				n = min(2, len(args)-i) // the flag's value
+			}
+			rest = append(rest, args[i:i+n]...)
+			i += n
+			continue
+		}
+		n, err := takeGlobalFlag(args[i:])
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			rest = append(rest, arg) // unknown, reported by fs.Parse
+			n = 1
+		}
+		i += n
+	}
+	return rest, applyGlobals()
+}
+
+// takeGlobalFlag sets the global flag args starts with and returns the
+// number of arguments it took: 0 when args does not start with one
+func takeGlobalFlag(args []string) (int, error) {
+	if !strings.HasPrefix(args[0], "-") || args[0] == "--" {
+		return 0, nil
+	}
+	name, value, hasValue := strings.Cut(strings.TrimLeft(args[0], "-"), "=")
+	n := 1
+	switch name {
+	case "config", "log-level":
+		if !hasValue {
+			if len(args) == 1 {
+				return 0, fmt.Errorf("--%s needs a value", name)
+			}
+			value, n = args[1], 2
+		}
+		if name == "config" {
+			globals.Config = value
+		} else {
+			globals.LogLevel = strings.ToLower(value)
+		}
+	case "json", "no-color", "yes":
+		on := true
+		if hasValue {
+			var err error
+			if on, err = strconv.ParseBool(value); err != nil {
+				return 0, fmt.Errorf("invalid value %q for --%s", value, name)
+			}
+		}
+		switch name {
+		case "json":
+			globals.JSON = on
+		case "no-color":
+			globals.NoColor = on
+		default:
+			globals.Yes = on
+		}
+	default:
+		return 0, nil
+	}
+	return n, nil
+}
+
+// applyGlobals checks the global flags and passes them to child processes
+// through the environment
+func applyGlobals() error {
+	if globals.Config != "" {
+		if _, err := os.Stat(globals.Config); err != nil {
+			return fmt.Errorf("--config: %v", err)
+		}
+		os.Setenv(settingsEnv, globals.Config)
+	}
+	if globals.LogLevel != "" {
+		if _, ok := logLevels[globals.LogLevel]; !ok {
+			return fmt.Errorf("invalid --log-level %q; use debug, info, warn or error", globals.LogLevel)
+		}
+		os.Setenv(logLevelEnv, globals.LogLevel)
+	}
+	if globals.NoColor {
+		os.Setenv(noColorEnv, "1")
+	}
+	return nil
+}
+
+// applyGlobalFlags sets the flags of a command that global flags stand for,
+// unless they were given to the command itself. They then count as given, so
+// that aitool.yaml does not override them.
+func applyGlobalFlags(fs *flag.FlagSet, explicit map[string]bool) error {
+	if globals.Yes && fs.Lookup("yes") != nil && !explicit["yes"] {
+		fs.Set("yes", "true")
+		explicit["yes"] = true
+	}
+	if globals.JSON {
+		if fs.Lookup("json") == nil {
+			return fmt.Errorf("%s has no JSON output", fs.Name())
+		}
+		if !explicit["json"] {
+			fs.Set("json", "true")
+			explicit["json"] = true
+		}
+	}
+	return nil
+}
+
+// commandPath and commandSummary are the name and description of the
+// running command, shown by its -h
+var commandPath, commandSummary string
+
+// SetCommand names the running command for its help, e.g. "read csv"
+func SetCommand(path, summary string) {
+	commandPath, commandSummary = path, summary
+}
+
+// usage prints the help of a command: its usage line, summary, flags and
+// the global flags
+func usage(fs *flag.FlagSet) func() {
+	return func() {
+		path := commandPath
+		if path == "" {
+			path = fs.Name()
+		} else if _, sub, ok := strings.Cut(fs.Name(), " "); ok {
+			path += " " + sub // a subcommand, e.g. jobs submit
+		}
+		out := fs.Output()
+		fmt.Fprintf(out, "Usage: go run . %s [flags] [arguments]\n", path)
+		if commandSummary != "" {
+			fmt.Fprintf(out, "\n%s\n", commandSummary)
+		}
+		fmt.Fprintln(out, "\nFlags:")
+		fs.PrintDefaults()
+		fmt.Fprintf(out, "\n%s", GlobalFlagUsage)
+	}
+}
+
+// messageOutput is where warnings and notes go: stdout, or stderr while a
+// command prints JSON or writes its data to stdout, so that its output
+// parses
+var messageOutput io.Writer = os.Stdout
+
+// logLevel returns the log level of the run
+func logLevel() string {
+	if level := os.Getenv(logLevelEnv); level != "" {
+		if _, ok := logLevels[level]; ok {
+			return level
+		}
+	}
+	return logInfo
+}
+
+// logsAt reports whether messages of a level are shown
+func logsAt(level string) bool {
+	return logLevels[level] >= logLevels[logLevel()]
+}
+
+// warnf prints a warning, unless --log-level is error. Newlines leading the
+// message are printed before the "Warning:" prefix.
+func warnf(format string, args ...any) {
+	if !logsAt(logWarn) {
+		return
+	}
+	message := fmt.Sprintf(format, args...)
+	trimmed := strings.TrimLeft(message, "\n")
+	fmt.Fprintf(messageOutput, "%sWarning: %s\n", message[:len(message)-len(trimmed)], trimmed)
+}
+
+// notef prints a note, unless --log-level is warn or error
+func notef(format string, args ...any) {
+	if logsAt(logInfo) {
+		fmt.Fprintf(messageOutput, "Note: "+format+"\n", args...)
+	}
+}
+
+// infof prints a progress line of a reader, such as the pages fetched from
+// an API, unless --log-level is warn or error
+func infof(format string, args ...any) {
+	if logsAt(logInfo) {
+		fmt.Fprintf(messageOutput, format+"\n", args...)
+	}
+}
+
+// debugf prints a debug line to stderr with --log-level debug
+func debugf(format string, args ...any) {
+	if logsAt(logDebug) {
+		fmt.Fprintf(os.Stderr, "Debug: "+format+"\n", args...)
+	}
+}
+
+// debugRequests is client middleware logging each API request at the debug
+// level: method, URL, status and time, without headers or bodies so that
+// keys and data stay out of logs
+func debugRequests(req *http.Request, next option.MiddlewareNext) (*http.Response, error) {
+	start := time.Now()
+	resp, err := next(req)
+	elapsed := time.Since(start).Round(time.Millisecond)
+	if err != nil {
+		debugf("%s %s: %v after %s", req.Method, req.URL, err, elapsed)
+		return resp, err
+	}
+	debugf("%s %s: %s in %s", req.Method, req.URL, resp.Status, elapsed)
+	return resp, err
+}
+
+// plainOutput reports whether terminal escape codes are off, with --no-color
+// or $NO_COLOR
+func plainOutput() bool {
+	return os.Getenv(noColorEnv) != ""
+}
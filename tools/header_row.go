@@ -0,0 +1,221 @@
+package tools
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// noHeaderPeekRows is how many rows of an input without a header are read
+// ahead to count its columns; spreadsheet rows leave out trailing empty cells
+const noHeaderPeekRows = 100
+
+// HeaderOptions locates the header of a table that does not start on the
+// first row, e.g. a report with a title block above its data, or names the
+// columns of one without a header. As a flag.Value it is -header-row.
+type HeaderOptions struct {
+	Row   int    // 1-based row of the (first) header row, 0 for row 1
+	Rows  int    // stacked header rows merged into the column names, 0 for 1
+	None  bool   // no header row: the first row is data
+	Names string // comma-separated names replacing the first column names
+}
+
+// headerFlags registers -header-row, -no-header and -column-names
+func headerFlags(fs *flag.FlagSet, opts *HeaderOptions) {
+	fs.Var(opts, "header-row", "Row holding the column names, e.g. 3 when a title block comes first; 3-4 merges two stacked header rows into names like \"Sales Q1\" (default: 1)")
+	fs.BoolVar(&opts.None, "no-header", false, "The first row is data: columns are named col_1, col_2, ... (see -column-names)")
+	fs.StringVar(&opts.Names, "column-names", "", "Comma-separated column names, replacing the generated names of -no-header or the names in the header row, from the first column on")
+}
+
+// String shows the header rows as -header-row takes them
+func (h *HeaderOptions) String() string {
+	if h == nil || h.Row == 0 {
+		return ""
+	}
+	if h.Rows <= 1 {
+		return strconv.Itoa(h.Row)
+	}
+	return fmt.Sprintf("%d-%d", h.Row, h.Row+h.Rows-1)
+}
+
+// Set parses a -header-row value: a row number, or a range of stacked rows
+func (h *HeaderOptions) Set(value string) error {
+	first, last, isRange := strings.Cut(strings.TrimSpace(value), "-")
+	from, err := strconv.Atoi(strings.TrimSpace(first))
+	to := from
+	if err == nil && isRange {
+		to, err = strconv.Atoi(strings.TrimSpace(last))
+	}
+	if err != nil || from < 1 || to < from {
+		return fmt.Errorf("invalid header row %q (use a row number such as 3, or a range such as 3-4)", value)
+	}
+	h.Row, h.Rows = from, to-from+1
+	return nil
+}
+
+// set reports whether a header row was given
+func (h HeaderOptions) set() bool {
+	return h.Row > 0
+}
+
+func (h HeaderOptions) first() int {
+	return max(h.Row, 1)
+}
+
+func (h HeaderOptions) count() int {
+	if h.None {
+		return 0
+	}
+	return max(h.Rows, 1)
+}
+
+// top returns the number of sheet rows above the data: the rows skipped
+// before the header and the header rows
+func (h HeaderOptions) top() int {
+	return h.first() - 1 + h.count()
+}
+
+// readHeader skips the rows above the header, reads the header rows from
+// source and returns them merged into column names, with a source for the
+// data rows. CSV sources skip whole lines, so blank lines of a title block
+// count as they do in a spreadsheet.
+func (h HeaderOptions) readHeader(source rowSource) ([]string, rowSource, error) {
+	if h.None {
+		return h.generateHeader(source)
+	}
+	skip := h.first() - 1
+	if csvSource, ok := source.(*csvRowSource); ok {
+		csvSource.start, skip = h.first(), 0
+	}
+	for i := 0; i < skip; i++ {
+		if _, err := source.Next(); err != nil {
+			return nil, nil, h.missing(err)
+		}
+	}
+	rows := make([][]string, h.count())
+	for i := range rows {
+		row, err := source.Next()
+		if err != nil {
+			return nil, nil, h.missing(err)
+		}
+		rows[i] = row
+	}
+	headers, err := h.rename(mergeHeaderRows(rows))
+	return headers, source, err
+}
+
+// generateHeader names the columns of a source without a header row, counted
+// over its first rows, which the returned source still yields
+func (h HeaderOptions) generateHeader(source rowSource) ([]string, rowSource, error) {
+	if h.set() {
+		return nil, nil, fmt.Errorf("-no-header cannot be combined with -header-row")
+	}
+	peeked := &peekSource{source: source}
+	rows, err := peeked.peek(noHeaderPeekRows)
+	if err != nil {
+		return nil, nil, err
+	}
+	headers, err := h.rename(generatedHeaders(rowsWidth(rows)))
+	return headers, peeked, err
+}
+
+// missing explains an input that ends before its header rows
+func (h HeaderOptions) missing(err error) error {
+	if err != io.EOF {
+		return err
+	}
+	if !h.set() {
+		return io.EOF
+	}
+	return fmt.Errorf("input ends before header row %d", h.first()+h.count()-1)
+}
+
+// split returns the header and data rows of a loaded sheet
+func (h HeaderOptions) split(rows [][]string) ([]string, [][]string, error) {
+	if h.None {
+		if h.set() {
+			return nil, nil, fmt.Errorf("-no-header cannot be combined with -header-row")
+		}
+		if len(rows) == 0 {
+			return nil, nil, fmt.Errorf("sheet has no data rows")
+		}
+		headers, err := h.rename(generatedHeaders(rowsWidth(rows)))
+		return headers, rows, err
+	}
+	if len(rows) <= h.top() {
+		if h.set() {
+			return nil, nil, fmt.Errorf("sheet must have headers on row %s and at least one data row after them", h.String())
+		}
+		return nil, nil, fmt.Errorf("sheet must have headers and at least one data row")
+	}
+	headers, err := h.rename(mergeHeaderRows(rows[h.first()-1 : h.top()]))
+	return headers, rows[h.top():], err
+}
+
+// rename replaces the first column names with those of -column-names
+func (h HeaderOptions) rename(headers []string) ([]string, error) {
+	if strings.TrimSpace(h.Names) == "" {
+		return headers, nil
+	}
+	names := strings.Split(h.Names, ",")
+	if len(names) > len(headers) {
+		return nil, fmt.Errorf("-column-names gives %d names for %d columns", len(names), len(headers))
+	}
+	renamed := slices.Clone(headers)
+	for i, name := range names {
+		if name = strings.TrimSpace(name); name != "" {
+			renamed[i] = name
+		}
+	}
+	return renamed, nil
+}
+
+// rowsWidth returns the number of cells of the longest row
+func rowsWidth(rows [][]string) int {
+	width := 0
+	for _, row := range rows {
+		width = max(width, len(row))
+	}
+	return width
+}
+
+// mergeHeaderRows joins stacked header rows into one name per column. An
+// upper-row label spanning several columns (a merged cell, so empty after
+// its first column) is repeated over the columns that have a label below:
+// "Sales" above "Q1" and "Q2" gives "Sales Q1" and "Sales Q2".
+func mergeHeaderRows(rows [][]string) []string {
+	if len(rows) == 1 {
+		return rows[0]
+	}
+	width := rowsWidth(rows)
+	cell := func(row []string, col int) string {
+		if col < len(row) {
+			return strings.TrimSpace(row[col])
+		}
+		return ""
+	}
+
+	bottom := rows[len(rows)-1]
+	names := make([]string, width)
+	for col := range names {
+		var parts []string
+		for r, row := range rows {
+			value := cell(row, col)
+			if value == "" && r < len(rows)-1 && cell(bottom, col) != "" {
+				// Repeat the label of a merged cell from the left, across
+				// columns labelled below
+				for left := col - 1; left >= 0 && value == "" && cell(bottom, left) != ""; left-- {
+					value = cell(row, left)
+				}
+			}
+			if value != "" && (len(parts) == 0 || parts[len(parts)-1] != value) {
+				parts = append(parts, value)
+			}
+		}
+		names[col] = strings.Join(parts, " ")
+	}
+	return names
+}
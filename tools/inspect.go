@@ -0,0 +1,183 @@
+package tools
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+
+	"ai-general-tool/common"
+)
+
+// RunInspect handles the inspect command
+func RunInspect(args []string) error {
+	fs := flag.NewFlagSet("inspect", flag.ExitOnError)
+
+	// Define flags
+	inputFile := fs.String("input", "", "Enriched file (CSV or Excel)")
+	columns := fs.String("columns", "", "Generated columns to inspect (default: from the run sidecar)")
+	examples := fs.Int("examples", 3, "Random examples shown per column")
+	sheet := fs.String("sheet", "1", "Excel sheet: name or number (1-based)")
+
+	// Parse flags
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	// Handle positional argument for filename
+	if *inputFile == "" && fs.NArg() > 0 {
+		*inputFile = fs.Arg(0)
+	}
+
+	if *inputFile == "" {
+		return fmt.Errorf("input file is required")
+	}
+
+	info, err := readRunInfo(*inputFile)
+	if err != nil {
+		return fmt.Errorf("error reading run info: %v", err)
+	}
+
+	headers, rows, err := loadInputFile(*inputFile, InputOptions{Sheet: *sheet})
+	if err != nil {
+		return fmt.Errorf("error loading file: %v", err)
+	}
+
+	// Decide which columns to inspect
+	var names []string
+	models := make(map[string]string)
+	if *columns != "" {
+		for _, name := range strings.Split(*columns, ",") {
+			names = append(names, strings.TrimSpace(name))
+		}
+	} else if info != nil {
+		for _, column := range info.Columns {
+			names = append(names, column.Name)
+		}
+	} else {
+		return fmt.Errorf("no run info found (%s%s); use -columns to name the generated columns", *inputFile, runInfoSuffix)
+	}
+	if info != nil {
+		for _, column := range info.Columns {
+			models[column.Name] = column.Model
+			if column.Model == "" {
+				models[column.Name] = column.Source + " (local)"
+			}
+		}
+	}
+
+	fmt.Printf("\n=== INSPECT: %s ===\n", *inputFile)
+	fmt.Printf("Rows: %d | Columns: %d\n", len(rows), len(headers))
+	if info != nil {
+		fmt.Printf("Produced by: %s on %s from %s\n", info.Command, info.FinishedAt.Local().Format("2006-01-02 15:04"), info.Input)
+		if info.Prompt != "" {
+			fmt.Printf("Prompt: %s\n", common.TruncateString(info.Prompt, 200))
+		}
+		fmt.Printf("Run: %d rows, %d failed, %d tokens, $%.4f\n", info.Rows, info.FailedRows, info.Tokens, info.EstimatedCost)
+		if info.InputTokens+info.OutputTokens > 0 {
+			fmt.Printf("Tokens: %d input, %d output\n", info.InputTokens, info.OutputTokens)
+		}
+	}
+
+	// Fill and error rates per column; the generated cells of rows failed
+	// according to the status column are errors too
+	status := indexOf(headers, statusColumn)
+	failedRow := func(row []string) bool {
+		return status != -1 && status < len(row) && row[status] == journalError
+	}
+	summaryRows := make([][]string, 0, len(names))
+	indexes := make([]int, len(names))
+	for i, name := range names {
+		indexes[i] = indexOf(headers, name)
+		if indexes[i] == -1 {
+			summaryRows = append(summaryRows, []string{name, models[name], "missing", "", "", ""})
+			continue
+		}
+
+		filled, empty, errors := 0, 0, 0
+		distinct := make(map[string]bool)
+		for _, row := range rows {
+			value := ""
+			if indexes[i] < len(row) {
+				value = row[indexes[i]]
+			}
+			switch {
+			case failedRow(row) && !isStatusColumn(name):
+				errors++
+			case value == "":
+				empty++
+			default:
+				filled++
+				distinct[value] = true
+			}
+		}
+		summaryRows = append(summaryRows, []string{
+			name,
+			models[name],
+			fmt.Sprintf("%d (%s)", filled, common.FormatPercentage(filled, len(rows))),
+			fmt.Sprintf("%d", empty),
+			fmt.Sprintf("%d (%s)", errors, common.FormatPercentage(errors, len(rows))),
+			fmt.Sprintf("%d", len(distinct)),
+		})
+	}
+	fmt.Println()
+	fmt.Println(common.FormatTable([]string{"Column", "Model", "Filled", "Empty", "Errors", "Distinct"}, summaryRows, 120))
+
+	// Failed rows by error class
+	if class := indexOf(headers, errorClassColumn); class != -1 {
+		counts := make(map[string]int)
+		failed := 0
+		for _, row := range rows {
+			if failedRow(row) {
+				failed++
+				if class < len(row) {
+					counts[row[class]]++
+				}
+			}
+		}
+		if failed > 0 {
+			classes := make([]string, 0, len(counts))
+			for name := range counts {
+				classes = append(classes, name)
+			}
+			sort.Slice(classes, func(a, b int) bool {
+				if counts[classes[a]] != counts[classes[b]] {
+					return counts[classes[a]] > counts[classes[b]]
+				}
+				return classes[a] < classes[b]
+			})
+			parts := make([]string, len(classes))
+			for i, name := range classes {
+				parts[i] = fmt.Sprintf("%s %d", name, counts[name])
+			}
+			fmt.Printf("\nFailed rows: %d (%s)\n", failed, strings.Join(parts, ", "))
+		}
+	}
+
+	// Random examples per column
+	random := rand.New(rand.NewSource(time.Now().UnixNano()))
+	for i, name := range names {
+		if indexes[i] == -1 || *examples <= 0 || isStatusColumn(name) {
+			continue
+		}
+		var candidates []int
+		for r, row := range rows {
+			if indexes[i] < len(row) && row[indexes[i]] != "" {
+				candidates = append(candidates, r)
+			}
+		}
+		if len(candidates) == 0 {
+			continue
+		}
+
+		fmt.Printf("\n%s:\n", name)
+		random.Shuffle(len(candidates), func(a, b int) { candidates[a], candidates[b] = candidates[b], candidates[a] })
+		for _, r := range candidates[:common.Min(*examples, len(candidates))] {
+			fmt.Printf("  row %d: %s\n", r+2, common.TruncateString(rows[r][indexes[i]], 100))
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,117 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// interruptGrace is how long rows in progress may take to finish after an
+// interrupt before their requests are abandoned
+const interruptGrace = 30 * time.Second
+
+// maxRemainingRanges caps the row ranges listed after a run that stopped
+// early
+const maxRemainingRanges = 50
+
+// abandonKey carries, in a run's context, the context whose cancellation
+// abandons the requests of rows in progress
+type abandonKey struct{}
+
+// interruptContext returns a context cancelled on Ctrl+C or SIGTERM. Once it
+// is cancelled no new rows are started, while rows in progress get
+// interruptGrace to finish; a second interrupt abandons them at once. Every
+// finished row is then saved. A third interrupt exits immediately.
+func interruptContext() (context.Context, context.CancelFunc) {
+	stop, cancelStop := context.WithCancel(context.Background())
+	abandon, cancelAbandon := context.WithCancel(context.Background())
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		defer signal.Stop(sigChan)
+		select {
+		case <-sigChan:
+		case <-abandon.Done():
+			return
+		}
+		fmt.Printf("\n\nInterrupt received: no new rows are started. Rows in progress get %s to finish (Ctrl+C again to abandon them), then progress is saved...\n", interruptGrace)
+		cancelStop()
+
+		timer := time.NewTimer(interruptGrace)
+		defer timer.Stop()
+		select {
+		case <-sigChan:
+			fmt.Println("\nAbandoning rows in progress. Saving progress...")
+		case <-timer.C:
+			fmt.Println("\nRows in progress did not finish in time and are abandoned. Saving progress...")
+		case <-abandon.Done():
+			return
+		}
+		cancelAbandon()
+	}()
+
+	ctx := context.WithValue(stop, abandonKey{}, abandon)
+	return ctx, func() {
+		cancelStop()
+		cancelAbandon()
+	}
+}
+
+// requestContext returns the context for the API requests of a worker. With
+// a context from interruptContext, requests outlive the interrupt until they
+// are abandoned; otherwise they are cancelled with ctx.
+func requestContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	abandon, ok := ctx.Value(abandonKey{}).(context.Context)
+	if !ok {
+		return ctx, func() {}
+	}
+	requests, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	stop := context.AfterFunc(abandon, cancel)
+	return requests, func() {
+		stop()
+		cancel()
+	}
+}
+
+// printRemainingRows lists the rows a run did not process, by 1-based data
+// row number (the first row after the header is 1)
+func printRemainingRows(remaining []int, total int, resumable bool) {
+	if len(remaining) == 0 {
+		return
+	}
+	fmt.Printf("\nNot processed: %d of %d rows (no values generated)\n", len(remaining), total)
+	fmt.Printf("Rows (first data row = 1): %s\n", formatRowRanges(remaining, maxRemainingRanges))
+	if resumable {
+		fmt.Println("Run the same command with -resume to process them.")
+	}
+}
+
+// formatRowRanges shows sorted 0-based row indexes as 1-based ranges, e.g.
+// "3-7, 10", listing at most limit ranges
+func formatRowRanges(rows []int, limit int) string {
+	var ranges []string
+	more := 0
+	for i := 0; i < len(rows); {
+		j := i
+		for j+1 < len(rows) && rows[j+1] == rows[j]+1 {
+			j++
+		}
+		if len(ranges) == limit {
+			more += j - i + 1
+		} else if i == j {
+			ranges = append(ranges, fmt.Sprint(rows[i]+1))
+		} else {
+			ranges = append(ranges, fmt.Sprintf("%d-%d", rows[i]+1, rows[j]+1))
+		}
+		i = j + 1
+	}
+	if more > 0 {
+		ranges = append(ranges, fmt.Sprintf("and %d more rows", more))
+	}
+	return strings.Join(ranges, ", ")
+}
@@ -0,0 +1,445 @@
+package tools
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// queueEnv names the environment variable overriding the default queue
+// directory of the jobs and daemon commands
+const queueEnv = "AITOOL_QUEUE"
+
+// jobQueued is the state of a queued job waiting for the daemon; the other
+// states are those of serve's jobs
+const jobQueued = "queued"
+
+// queueCommands are the commands that can be queued
+var queueCommands = map[string]bool{"process-data": true, "run-job": true}
+
+// queuedJob is a job of the queue, kept in <id>.json in the queue directory
+// with its console output in <id>.log. Only the daemon changes a job once it
+// is submitted; jobs cancel leaves a <id>.cancel marker for it.
+type queuedJob struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name,omitempty"`
+	Command   string    `json:"command"`
+	Args      []string  `json:"args"`
+	Dir       string    `json:"dir"` // the directory the job runs in
+	State     string    `json:"state"`
+	Submitted time.Time `json:"submitted"`
+	Started   time.Time `json:"started,omitzero"`
+	Finished  time.Time `json:"finished,omitzero"`
+	Attempts  int       `json:"attempts"`         // runs started, resumed runs included
+	Resume    bool      `json:"resume,omitempty"` // the next run continues an interrupted one
+	PID       int       `json:"pid,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// RunJobs handles the jobs command: it submits jobs to the daemon's queue,
+// lists them, shows their status and cancels them
+func RunJobs(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("a subcommand is required: jobs submit|list|status|cancel")
+	}
+	switch args[0] {
+	case "submit":
+		return runJobsSubmit(args[1:])
+	case "list":
+		return runJobsList(args[1:])
+	case "status":
+		return runJobsStatus(args[1:])
+	case "cancel":
+		return runJobsCancel(args[1:])
+	}
+	return fmt.Errorf("unknown jobs subcommand %q; use submit, list, status or cancel", args[0])
+}
+
+// runJobsSubmit queues a process-data or run-job command, or a job file, to
+// run in the current directory
+func runJobsSubmit(args []string) error {
+	fs := flag.NewFlagSet("jobs submit", flag.ExitOnError)
+	queueDir := fs.String("queue", "", "Queue directory (default $"+queueEnv+" or ~/.aitool/queue)")
+	name := fs.String("name", "", "Name shown by jobs list")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	command := fs.Args()
+	if len(command) == 0 {
+		return fmt.Errorf("nothing to submit: jobs submit [flags] <job.yaml> or jobs submit [flags] process-data|run-job [args...]")
+	}
+	if ext := strings.ToLower(filepath.Ext(command[0])); ext == ".yaml" || ext == ".yml" {
+		command = append([]string{"run-job"}, command...)
+	}
+	if !queueCommands[command[0]] {
+		return fmt.Errorf("only process-data and run-job can be queued, not %q", command[0])
+	}
+	if command[0] == "run-job" {
+		// Catch a broken job file now rather than when the daemon runs it
+		for _, arg := range command[1:] {
+			if ext := strings.ToLower(filepath.Ext(arg)); ext == ".yaml" || ext == ".yml" {
+				spec, err := loadJob(arg)
+				if err != nil {
+					return fmt.Errorf("error loading job %s: %v", arg, err)
+				}
+				if *name == "" {
+					*name = spec.Name
+				}
+			}
+		}
+	}
+
+	dir, err := queuePath(*queueDir)
+	if err != nil {
+		return err
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	job := &queuedJob{
+		Name:      *name,
+		Command:   command[0],
+		Args:      command[1:],
+		Dir:       cwd,
+		State:     jobQueued,
+		Submitted: time.Now(),
+	}
+	if err := submitJob(dir, job); err != nil {
+		return err
+	}
+
+	fmt.Printf("Queued job %s: %s\n", job.ID, job.title())
+	if pid := daemonPID(dir); pid == 0 {
+		fmt.Printf("No daemon is running on %s; start one with: aitool daemon -detach\n", dir)
+	}
+	return nil
+}
+
+// runJobsList prints the jobs of the queue, oldest first
+func runJobsList(args []string) error {
+	fs := flag.NewFlagSet("jobs list", flag.ExitOnError)
+	queueDir := fs.String("queue", "", "Queue directory (default $"+queueEnv+" or ~/.aitool/queue)")
+	state := fs.String("state", "", "Only list jobs in this state: queued, running, done, failed or cancelled")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	dir, err := queuePath(*queueDir)
+	if err != nil {
+		return err
+	}
+	jobs, err := loadQueue(dir)
+	if err != nil {
+		return err
+	}
+
+	var listed []*queuedJob
+	for _, job := range jobs {
+		if *state == "" || job.State == *state {
+			listed = append(listed, job)
+		}
+	}
+	if len(listed) == 0 {
+		fmt.Printf("No jobs in %s\n", dir)
+		return nil
+	}
+	fmt.Printf("%-5s %-10s %-17s %-9s %s\n", "ID", "STATE", "SUBMITTED", "TIME", "JOB")
+	for _, job := range listed {
+		state := job.State
+		if cancelRequested(dir, job.ID) && (state == jobQueued || state == jobRunning) {
+			state += "*"
+		}
+		fmt.Printf("%-5s %-10s %-17s %-9s %s\n", job.ID, state, job.Submitted.Format("2006-01-02 15:04"), job.elapsed(), job.title())
+	}
+	if pid := daemonPID(dir); pid != 0 {
+		fmt.Printf("\nDaemon running (pid %d)\n", pid)
+	} else {
+		fmt.Println("\nNo daemon running")
+	}
+	return nil
+}
+
+// runJobsStatus prints one job and the end of its log
+func runJobsStatus(args []string) error {
+	fs := flag.NewFlagSet("jobs status", flag.ExitOnError)
+	queueDir := fs.String("queue", "", "Queue directory (default $"+queueEnv+" or ~/.aitool/queue)")
+	lines := fs.Int("lines", 15, "Lines of the job's log to show (0 for the whole log)")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("a job ID is required: jobs status [flags] <id>")
+	}
+	dir, err := queuePath(*queueDir)
+	if err != nil {
+		return err
+	}
+	job, err := loadQueuedJob(dir, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Job:       %s\n", job.ID)
+	if job.Name != "" {
+		fmt.Printf("Name:      %s\n", job.Name)
+	}
+	fmt.Printf("Command:   %s\n", job.commandLine())
+	fmt.Printf("Directory: %s\n", job.Dir)
+	state := job.State
+	if cancelRequested(dir, job.ID) && (state == jobQueued || state == jobRunning) {
+		state += " (cancel requested)"
+	}
+	if job.State == jobQueued && job.Resume {
+		state += " (resumes an interrupted run)"
+	}
+	fmt.Printf("State:     %s\n", state)
+	fmt.Printf("Submitted: %s\n", job.Submitted.Format(time.DateTime))
+	if !job.Started.IsZero() {
+		fmt.Printf("Started:   %s (attempt %d)\n", job.Started.Format(time.DateTime), job.Attempts)
+	}
+	if !job.Finished.IsZero() {
+		fmt.Printf("Finished:  %s (%s)\n", job.Finished.Format(time.DateTime), job.elapsed())
+	}
+	if job.State == jobRunning && job.PID != 0 {
+		fmt.Printf("PID:       %d\n", job.PID)
+	}
+	if job.Error != "" {
+		fmt.Printf("Error:     %s\n", job.Error)
+	}
+
+	logFile := filepath.Join(dir, job.ID+".log")
+	data, err := os.ReadFile(logFile)
+	if err != nil || len(data) == 0 {
+		return nil
+	}
+	tail := logLines(string(data))
+	if *lines > 0 && len(tail) > *lines {
+		tail = tail[len(tail)-*lines:]
+	}
+	fmt.Printf("\nLog (%s):\n", logFile)
+	for _, line := range tail {
+		fmt.Printf("  %s\n", line)
+	}
+	return nil
+}
+
+// runJobsCancel cancels a queued job, or interrupts a running one, which
+// saves the rows it finished
+func runJobsCancel(args []string) error {
+	fs := flag.NewFlagSet("jobs cancel", flag.ExitOnError)
+	queueDir := fs.String("queue", "", "Queue directory (default $"+queueEnv+" or ~/.aitool/queue)")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return fmt.Errorf("a job ID is required: jobs cancel [flags] <id>...")
+	}
+	dir, err := queuePath(*queueDir)
+	if err != nil {
+		return err
+	}
+	daemon := daemonPID(dir)
+	for _, id := range fs.Args() {
+		job, err := loadQueuedJob(dir, id)
+		if err != nil {
+			return err
+		}
+		if job.State != jobQueued && job.State != jobRunning {
+			fmt.Printf("Job %s is already %s\n", job.ID, job.State)
+			continue
+		}
+		if daemon == 0 {
+			// Without a daemon nothing runs the job or changes its record
+			job.State = jobCancelled
+			job.Finished = time.Now()
+			if err := saveQueuedJob(dir, job); err != nil {
+				return err
+			}
+			fmt.Printf("Cancelled job %s\n", job.ID)
+			continue
+		}
+		if err := os.WriteFile(filepath.Join(dir, job.ID+".cancel"), nil, 0644); err != nil {
+			return fmt.Errorf("error cancelling job %s: %v", job.ID, err)
+		}
+		if job.State == jobRunning {
+			fmt.Printf("Cancelling job %s: it saves the rows it finished, then stops\n", job.ID)
+		} else {
+			fmt.Printf("Cancelled job %s\n", job.ID)
+		}
+	}
+	return nil
+}
+
+// queuePath returns the queue directory, creating it: the given one, else
+// $AITOOL_QUEUE, else ~/.aitool/queue
+func queuePath(dir string) (string, error) {
+	if dir == "" {
+		dir = os.Getenv(queueEnv)
+	}
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("cannot find the home directory for the queue; use -queue or $%s: %v", queueEnv, err)
+		}
+		dir = filepath.Join(home, ".aitool", "queue")
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("error creating queue directory %s: %v", dir, err)
+	}
+	return dir, nil
+}
+
+// submitJob gives a job the next free ID of the queue and saves it. The ID
+// is claimed by creating the job's log, so concurrent submits never share one.
+func submitJob(dir string, job *queuedJob) error {
+	jobs, err := loadQueue(dir)
+	if err != nil {
+		return err
+	}
+	next := 1
+	if len(jobs) > 0 {
+		last, _ := strconv.Atoi(jobs[len(jobs)-1].ID)
+		next = last + 1
+	}
+	for ; ; next++ {
+		file, err := os.OpenFile(filepath.Join(dir, strconv.Itoa(next)+".log"), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if os.IsExist(err) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("error submitting job: %v", err)
+		}
+		file.Close()
+		break
+	}
+	job.ID = strconv.Itoa(next)
+	return saveQueuedJob(dir, job)
+}
+
+// loadQueue reads the jobs of a queue in ID order
+func loadQueue(dir string) ([]*queuedJob, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var jobs []*queuedJob
+	for _, file := range files {
+		job, err := loadQueuedJob(dir, strings.TrimSuffix(filepath.Base(file), ".json"))
+		if err != nil {
+			warnf("skipping %s: %v", file, err)
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		a, _ := strconv.Atoi(jobs[i].ID)
+		b, _ := strconv.Atoi(jobs[j].ID)
+		return a < b
+	})
+	return jobs, nil
+}
+
+// loadQueuedJob reads one job of a queue
+func loadQueuedJob(dir, id string) (*queuedJob, error) {
+	if _, err := strconv.Atoi(id); err != nil {
+		return nil, fmt.Errorf("invalid job ID %q", id)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, id+".json"))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("no job %s in %s", id, dir)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var job queuedJob
+	if err := json.Unmarshal(data, &job); err != nil {
+		return nil, fmt.Errorf("invalid job file: %v", err)
+	}
+	return &job, nil
+}
+
+// saveQueuedJob writes a job through a temporary file, so that a crash never
+// leaves a half-written job behind
+func saveQueuedJob(dir string, job *queuedJob) error {
+	data, err := json.MarshalIndent(job, "", "  ")
+	if err != nil {
+		return err
+	}
+	file := filepath.Join(dir, job.ID+".json")
+	if err := os.WriteFile(file+".tmp", data, 0644); err != nil {
+		return fmt.Errorf("error saving job %s: %v", job.ID, err)
+	}
+	if err := os.Rename(file+".tmp", file); err != nil {
+		return fmt.Errorf("error saving job %s: %v", job.ID, err)
+	}
+	return nil
+}
+
+// cancelRequested reports whether jobs cancel marked a job for the daemon
+func cancelRequested(dir, id string) bool {
+	_, err := os.Stat(filepath.Join(dir, id+".cancel"))
+	return err == nil
+}
+
+// title returns the job's name, or its command line
+func (job *queuedJob) title() string {
+	if job.Name != "" {
+		return job.Name
+	}
+	line := job.commandLine()
+	if len(line) > 70 {
+		line = line[:67] + "..."
+	}
+	return line
+}
+
+// commandLine returns the job's command with its arguments quoted for display
+func (job *queuedJob) commandLine() string {
+	parts := []string{job.Command}
+	for _, arg := range job.Args {
+		parts = append(parts, quoteArg(arg))
+	}
+	return strings.Join(parts, " ")
+}
+
+// elapsed returns how long the job ran, or has been running
+func (job *queuedJob) elapsed() string {
+	if job.Started.IsZero() || job.State == jobQueued {
+		return "-"
+	}
+	end := job.Finished
+	if end.IsZero() || job.State == jobRunning {
+		end = time.Now()
+	}
+	return end.Sub(job.Started).Round(time.Second).String()
+}
+
+// terminalCodes matches the escape sequences progress displays move the
+// cursor and clear lines with
+var terminalCodes = regexp.MustCompile("\x1b\\[[0-9;?]*[A-Za-z]")
+
+// logLines splits a log into lines, keeping only the last state of lines
+// rewritten in place by the line progress display
+func logLines(log string) []string {
+	var lines []string
+	log = terminalCodes.ReplaceAllString(log, "")
+	for _, line := range strings.Split(strings.TrimRight(log, "\n"), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if i := strings.LastIndex(line, "\r"); i >= 0 {
+			line = line[i+1:]
+		}
+		lines = append(lines, strings.TrimRight(line, " "))
+	}
+	return lines
+}
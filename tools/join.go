@@ -0,0 +1,259 @@
+package tools
+
+import (
+	"flag"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// joinTypes lists the -type values of join
+var joinTypes = map[string]bool{"inner": true, "left": true, "right": true, "outer": true}
+
+// RunJoin handles the join command: it merges the rows of two files on key
+// columns, like a SQL join
+func RunJoin(args []string) error {
+	fs := flag.NewFlagSet("join", flag.ExitOnError)
+
+	// Define flags
+	on := fs.String("on", "", "Comma-separated key columns, or left=right pairs when they are named differently, e.g. customer_id or id=customer_id (required)")
+	joinType := fs.String("type", "left", "Join type: inner (matched rows only), left (every left row), right (every right row), outer (every row of both)")
+	collision := fs.String("collision", "suffix", "Right columns named like a left column: suffix (keep both, right one renamed with -suffix), left (keep the left one), right (keep the right one), error")
+	suffix := fs.String("suffix", "_right", "Suffix of right columns named like a left column")
+	ignoreCase := fs.Bool("ignore-case", false, "Match keys ignoring case and surrounding whitespace")
+	rightSheet := fs.String("right-sheet", "", "Excel sheet of the right file, by name or number (default: -sheet)")
+	outputFile := fs.String("output", "", "Output file (default: <left>_joined)")
+	fs.StringVar(outputFile, "o", "", "Shorthand for -output")
+	input := inputFlags(fs)
+	output := &OutputOptions{}
+	fs.StringVar(&output.Format, "format", "same", "Output format: same, csv, sqlite, ods, md (Markdown table), html")
+	fs.BoolVar(&output.QuoteAll, "quote-all", false, "Quote every field of CSV output")
+
+	// Parse flags
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		return fmt.Errorf("two files are required: join [flags] <left> <right>")
+	}
+	leftFile, rightFile := fs.Arg(0), fs.Arg(1)
+
+	// Validation
+	if *on == "" {
+		return fmt.Errorf("-on is required")
+	}
+	if !joinTypes[*joinType] {
+		return fmt.Errorf("invalid join type '%s' (use inner, left, right or outer)", *joinType)
+	}
+	switch *collision {
+	case "suffix", "left", "right", "error":
+	default:
+		return fmt.Errorf("invalid collision '%s' (use suffix, left, right or error)", *collision)
+	}
+	if *outputFile == "" {
+		*outputFile = suffixedOutputFile(leftFile, output.Format, "_joined")
+	}
+	if *outputFile == leftFile || *outputFile == rightFile {
+		return fmt.Errorf("output would overwrite an input")
+	}
+
+	leftHeaders, leftRows, err := loadInputFile(leftFile, *input)
+	if err != nil {
+		return fmt.Errorf("error loading %s: %v", leftFile, err)
+	}
+	rightInput := *input
+	if *rightSheet != "" {
+		rightInput.Sheet = *rightSheet
+	}
+	rightHeaders, rightRows, err := loadInputFile(rightFile, rightInput)
+	if err != nil {
+		return fmt.Errorf("error loading %s: %v", rightFile, err)
+	}
+
+	leftKeys, rightKeys, err := joinKeys(*on, leftHeaders, rightHeaders)
+	if err != nil {
+		return err
+	}
+	j := joiner{leftKeys: leftKeys, rightKeys: rightKeys, ignoreCase: *ignoreCase}
+	headers, err := j.layout(leftHeaders, rightHeaders, *collision, *suffix)
+	if err != nil {
+		return err
+	}
+	rows, stats := j.join(leftRows, rightRows, *joinType)
+
+	fmt.Printf("\n=== JOIN (%s): %s + %s ===\n", *joinType, leftFile, rightFile)
+	fmt.Printf("Left rows: %d (%d matched) | Right rows: %d (%d matched)\n", len(leftRows), stats.leftMatched, len(rightRows), stats.rightMatched)
+	if stats.multiple > 0 {
+		warnf("%d left rows matched several right rows and appear once per match", stats.multiple)
+	}
+	if len(j.renamed) > 0 {
+		fmt.Printf("Renamed right columns: %s\n", strings.Join(j.renamed, ", "))
+	}
+	if len(j.dropped) > 0 {
+		fmt.Printf("Columns named in both files, %s values kept: %s\n", *collision, strings.Join(j.dropped, ", "))
+	}
+	fmt.Printf("Output rows: %d | Columns: %d\n", len(rows), len(headers))
+
+	if err := saveOutputTable(*outputFile, headers, rows, nil, *output); err != nil {
+		return fmt.Errorf("error saving output: %v", err)
+	}
+	fmt.Printf("Output saved to: %s\n", *outputFile)
+	return nil
+}
+
+// joinKeys resolves -on to the key columns of both files
+func joinKeys(on string, leftHeaders, rightHeaders []string) ([]int, []int, error) {
+	var leftKeys, rightKeys []int
+	for _, pair := range strings.Split(on, ",") {
+		left, right, ok := strings.Cut(pair, "=")
+		left = strings.TrimSpace(left)
+		right = strings.TrimSpace(right)
+		if !ok {
+			right = left
+		}
+		l, r := indexOf(leftHeaders, left), indexOf(rightHeaders, right)
+		if l == -1 {
+			return nil, nil, fmt.Errorf("key column '%s' not found in the left file", left)
+		}
+		if r == -1 {
+			return nil, nil, fmt.Errorf("key column '%s' not found in the right file", right)
+		}
+		leftKeys, rightKeys = append(leftKeys, l), append(rightKeys, r)
+	}
+	return leftKeys, rightKeys, nil
+}
+
+// joiner merges the rows of two files. The output has the left columns, then
+// the right columns except its keys, with name collisions resolved.
+type joiner struct {
+	leftKeys, rightKeys []int
+	ignoreCase          bool
+
+	leftWidth    int
+	rightColumns []int       // right columns appended to the left ones
+	replaced     map[int]int // left column -> right column whose value replaces it
+	renamed      []string
+	dropped      []string
+}
+
+// layout returns the output headers, resolving right columns named like a
+// left column as -collision says
+func (j *joiner) layout(leftHeaders, rightHeaders []string, collision, suffix string) ([]string, error) {
+	headers := append([]string{}, leftHeaders...)
+	j.leftWidth = len(leftHeaders)
+	j.replaced = make(map[int]int)
+	for c, header := range rightHeaders {
+		if slices.Contains(j.rightKeys, c) {
+			continue
+		}
+		l := indexOf(leftHeaders, header)
+		switch {
+		case l == -1:
+			headers = append(headers, header)
+			j.rightColumns = append(j.rightColumns, c)
+		case collision == "error":
+			return nil, fmt.Errorf("column '%s' is in both files (use -collision suffix, left or right)", header)
+		case collision == "left":
+			j.dropped = append(j.dropped, header)
+		case collision == "right":
+			j.replaced[l] = c
+			j.dropped = append(j.dropped, header)
+		default:
+			name := header + suffix
+			for indexOf(headers, name) != -1 || indexOf(rightHeaders, name) != -1 {
+				name += suffix
+			}
+			headers = append(headers, name)
+			j.rightColumns = append(j.rightColumns, c)
+			j.renamed = append(j.renamed, header+" -> "+name)
+		}
+	}
+	return headers, nil
+}
+
+// joinStats counts the rows of a join that found a match
+type joinStats struct {
+	leftMatched, rightMatched int
+	multiple                  int // left rows matching more than one right row
+}
+
+// join returns the joined rows: left rows in order with their matches, then
+// for right and outer joins the right rows nobody matched
+func (j *joiner) join(leftRows, rightRows [][]string, joinType string) ([][]string, joinStats) {
+	var stats joinStats
+	byKey := make(map[string][]int)
+	for r, row := range rightRows {
+		if key, ok := j.key(row, j.rightKeys); ok {
+			byKey[key] = append(byKey[key], r)
+		}
+	}
+
+	var rows [][]string
+	matched := make([]bool, len(rightRows))
+	for _, left := range leftRows {
+		var matches []int
+		if key, ok := j.key(left, j.leftKeys); ok {
+			matches = byKey[key]
+		}
+		if len(matches) > 0 {
+			stats.leftMatched++
+		}
+		if len(matches) > 1 {
+			stats.multiple++
+		}
+		for _, r := range matches {
+			matched[r] = true
+			rows = append(rows, j.row(left, rightRows[r]))
+		}
+		if len(matches) == 0 && (joinType == "left" || joinType == "outer") {
+			rows = append(rows, j.row(left, nil))
+		}
+	}
+	for r, right := range rightRows {
+		if matched[r] {
+			stats.rightMatched++
+		} else if joinType == "right" || joinType == "outer" {
+			// Unmatched right rows get their key values in the left key columns
+			left := make([]string, j.leftWidth)
+			for i, l := range j.leftKeys {
+				left[l] = cell(right, j.rightKeys[i])
+			}
+			rows = append(rows, j.row(left, right))
+		}
+	}
+	return rows, stats
+}
+
+// key returns the key of a row, and false when its key cells are all empty
+func (j *joiner) key(row []string, keys []int) (string, bool) {
+	parts := make([]string, len(keys))
+	blank := true
+	for i, index := range keys {
+		value := cell(row, index)
+		if j.ignoreCase {
+			value = strings.ToLower(strings.TrimSpace(value))
+		}
+		if value != "" {
+			blank = false
+		}
+		parts[i] = value
+	}
+	return strings.Join(parts, "\x00"), !blank
+}
+
+// row builds an output row from a left row and its matching right row, or
+// nil when there is none
+func (j *joiner) row(left, right []string) []string {
+	out := make([]string, 0, j.leftWidth+len(j.rightColumns))
+	for l := 0; l < j.leftWidth; l++ {
+		value := cell(left, l)
+		if c, ok := j.replaced[l]; ok && right != nil {
+			value = cell(right, c)
+		}
+		out = append(out, value)
+	}
+	for _, c := range j.rightColumns {
+		out = append(out, cell(right, c))
+	}
+	return out
+}
@@ -0,0 +1,218 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/openai/openai-go"
+)
+
+const (
+	knowledgeChunkChars   = 1200 // target chunk size in characters
+	knowledgeEmbedBatch   = 100  // chunks embedded per API request
+	knowledgeEmbedModel   = openai.EmbeddingModelTextEmbedding3Small
+	knowledgeDefaultTopK  = 3
+	knowledgeMaxFileBytes = 5 << 20
+)
+
+// knowledgeExtensions lists the file types loaded from a knowledge directory
+var knowledgeExtensions = map[string]bool{".md": true, ".txt": true, ".markdown": true}
+
+// KnowledgeChunk is a piece of a knowledge document with its embedding
+type KnowledgeChunk struct {
+	Source    string
+	Text      string
+	Embedding []float64
+}
+
+// KnowledgeBase holds embedded document chunks for per-row retrieval
+type KnowledgeBase struct {
+	Chunks []KnowledgeChunk
+	TopK   int
+	Tokens int64 // tokens spent embedding the documents
+}
+
+// loadKnowledgeBase reads a file or directory of text/markdown documents,
+// splits them into chunks and embeds every chunk
+func loadKnowledgeBase(ctx context.Context, client *openai.Client, path string, topK int) (*KnowledgeBase, error) {
+	var files []string
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		err := filepath.Walk(path, func(p string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !fi.IsDir() && knowledgeExtensions[strings.ToLower(filepath.Ext(p))] {
+				files = append(files, p)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		files = []string{path}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no .md or .txt files found in %s", path)
+	}
+
+	kb := &KnowledgeBase{TopK: topK}
+	if kb.TopK <= 0 {
+		kb.TopK = knowledgeDefaultTopK
+	}
+
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if len(data) > knowledgeMaxFileBytes {
+			return nil, fmt.Errorf("knowledge file %s is larger than %d MB", file, knowledgeMaxFileBytes>>20)
+		}
+		for _, text := range chunkText(string(data), knowledgeChunkChars) {
+			kb.Chunks = append(kb.Chunks, KnowledgeChunk{Source: file, Text: text})
+		}
+	}
+
+	// Embed chunks in batches
+	for start := 0; start < len(kb.Chunks); start += knowledgeEmbedBatch {
+		end := start + knowledgeEmbedBatch
+		if end > len(kb.Chunks) {
+			end = len(kb.Chunks)
+		}
+		texts := make([]string, end-start)
+		for i := range texts {
+			texts[i] = kb.Chunks[start+i].Text
+		}
+
+		embeddings, tokens, err := embedTexts(ctx, client, texts)
+		if err != nil {
+			return nil, fmt.Errorf("error embedding knowledge: %v", err)
+		}
+		for i, embedding := range embeddings {
+			kb.Chunks[start+i].Embedding = embedding
+		}
+		kb.Tokens += tokens
+	}
+
+	return kb, nil
+}
+
+// Retrieve returns the chunks most similar to the query, along with the
+// tokens spent embedding the query
+func (kb *KnowledgeBase) Retrieve(ctx context.Context, client *openai.Client, query string) ([]KnowledgeChunk, int64, error) {
+	embeddings, tokens, err := embedTexts(ctx, client, []string{query})
+	if err != nil {
+		return nil, 0, err
+	}
+	queryEmbedding := embeddings[0]
+
+	type scored struct {
+		index int
+		score float64
+	}
+	scores := make([]scored, len(kb.Chunks))
+	for i, chunk := range kb.Chunks {
+		scores[i] = scored{i, cosineSimilarity(queryEmbedding, chunk.Embedding)}
+	}
+	sort.Slice(scores, func(i, j int) bool { return scores[i].score > scores[j].score })
+
+	k := kb.TopK
+	if k > len(scores) {
+		k = len(scores)
+	}
+	chunks := make([]KnowledgeChunk, k)
+	for i := 0; i < k; i++ {
+		chunks[i] = kb.Chunks[scores[i].index]
+	}
+	return chunks, tokens, nil
+}
+
+// embedTexts embeds the texts in a single request
+func embedTexts(ctx context.Context, client *openai.Client, texts []string) ([][]float64, int64, error) {
+	resp, err := client.Embeddings.New(ctx, openai.EmbeddingNewParams{
+		Input: openai.EmbeddingNewParamsInputUnion{OfArrayOfStrings: texts},
+		Model: knowledgeEmbedModel,
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(resp.Data) != len(texts) {
+		return nil, 0, fmt.Errorf("expected %d embeddings, got %d", len(texts), len(resp.Data))
+	}
+
+	embeddings := make([][]float64, len(texts))
+	for _, item := range resp.Data {
+		embeddings[item.Index] = item.Embedding
+	}
+	return embeddings, resp.Usage.TotalTokens, nil
+}
+
+// chunkText splits text on blank lines, packing paragraphs into chunks of
+// roughly maxChars. Oversized paragraphs are split on whitespace.
+func chunkText(text string, maxChars int) []string {
+	var chunks []string
+	var current strings.Builder
+
+	flush := func() {
+		if s := strings.TrimSpace(current.String()); s != "" {
+			chunks = append(chunks, s)
+		}
+		current.Reset()
+	}
+
+	for _, paragraph := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n\n") {
+		paragraph = strings.TrimSpace(paragraph)
+		if paragraph == "" {
+			continue
+		}
+
+		if current.Len() > 0 && current.Len()+len(paragraph) > maxChars {
+			flush()
+		}
+
+		for len(paragraph) > maxChars {
+			cut := strings.LastIndexAny(paragraph[:maxChars], " \n\t")
+			if cut <= 0 {
+				cut = maxChars
+			}
+			current.WriteString(paragraph[:cut])
+			flush()
+			paragraph = strings.TrimSpace(paragraph[cut:])
+		}
+
+		if current.Len() > 0 {
+			current.WriteString("\n\n")
+		}
+		current.WriteString(paragraph)
+	}
+	flush()
+
+	return chunks
+}
+
+// cosineSimilarity returns the cosine of the angle between two vectors
+func cosineSimilarity(a, b []float64) float64 {
+	var dot, normA, normB float64
+	for i := range a {
+		if i >= len(b) {
+			break
+		}
+		dot += a[i] * b[i]
+		normA += a[i] * a[i]
+		normB += b[i] * b[i]
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
@@ -0,0 +1,129 @@
+package tools
+
+import (
+	"io"
+
+	"ai-general-tool/common"
+
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+)
+
+// The functions of this file expose the readers, writers and analysis behind
+// the commands to Go code; the packages under pkg/ build their API on them.
+
+// DefaultModel generates the columns that name no model
+const DefaultModel = defaultModel
+
+// SetMessageOutput sends warnings, notes and the progress lines of readers
+// to w instead of stdout; nil discards them
+func SetMessageOutput(w io.Writer) {
+	if w == nil {
+		w = io.Discard
+	}
+	messageOutput = w
+}
+
+// ReadTable loads the headers and rows of a file as the commands do: CSV,
+// Excel, ODS, JSON, SQLite, gzip, cloud and connector inputs. Zero options
+// read the first sheet, detect the CSV dialect and take the first row as
+// headers.
+func ReadTable(filename string, opts InputOptions) ([]string, [][]string, error) {
+	return loadInputFile(filename, opts)
+}
+
+// WriteTable saves a table in the format given by opts.Format or, when it is
+// empty or "same", by the file extension. stdioName ("-") writes CSV to
+// standard output.
+func WriteTable(filename string, headers []string, rows [][]string, opts OutputOptions) error {
+	if opts.Format == "" {
+		opts.Format = "same"
+	}
+	return saveOutputTable(filename, headers, rows, nil, opts)
+}
+
+// ParseColumns parses a -columns value such as "city,risk@gpt-4o" into
+// column specs
+func ParseColumns(spec string) []ColumnSpec {
+	return parseColumnSpecs(spec)
+}
+
+// MergeColumns builds the output table of ProcessRows: the generated columns
+// are appended to the headers, or overwrite the input column of the same
+// name where they have a value
+func MergeColumns(headers []string, enrichedRows [][]string, columnSpecs []ColumnSpec) ([]string, [][]string) {
+	return mergeGeneratedColumns(headers, enrichedRows, columnSpecs)
+}
+
+// NewClient creates an OpenAI client with an API key, counting retried
+// requests in the run statistics like the commands' client. Options such as
+// option.WithBaseURL point it at a compatible server.
+func NewClient(apiKey string, opts ...option.RequestOption) *openai.Client {
+	opts = append([]option.RequestOption{option.WithAPIKey(apiKey), option.WithMiddleware(countRetries)}, opts...)
+	client := openai.NewClient(opts...)
+	return &client
+}
+
+// NewClientFromEnv creates the client of the commands: the API key and
+// prices come from .env or the environment
+func NewClientFromEnv() (*openai.Client, error) {
+	return newOpenAIClient()
+}
+
+// ModelPrice returns the dollars per million input and output tokens of a
+// model, and false when it is priced as the default model for lack of a
+// price
+func ModelPrice(model string) (float64, float64, bool) {
+	price, ok := priceFor(model)
+	return price.Input, price.Output, ok
+}
+
+// ColumnSummary is the summary of a column computed by describe: its type,
+// counts, and the range and quartiles of numeric columns
+type ColumnSummary struct {
+	Name     string
+	Type     common.DataType
+	Count    int // non-null values
+	Nulls    int
+	Unique   int
+	Invalid  int // non-null values of a numeric or date column that do not parse
+	Min      float64
+	Q1       float64
+	Median   float64
+	Q3       float64
+	Max      float64
+	Mean     float64
+	Examples []string
+}
+
+// DescribeColumns summarizes every column of a table with the type detection
+// of the read commands
+func DescribeColumns(headers []string, rows [][]string, locale common.Locale) []ColumnSummary {
+	summaries := make([]ColumnSummary, len(headers))
+	for c, header := range headers {
+		values := make([]string, len(rows))
+		for r, row := range rows {
+			values[r] = cell(row, c)
+		}
+		s := describeColumn(header, values, locale)
+		summary := ColumnSummary{
+			Name:     s.Name,
+			Type:     s.Type,
+			Count:    s.Count,
+			Nulls:    s.Nulls,
+			Unique:   s.Unique,
+			Invalid:  s.Invalid,
+			Examples: s.Examples,
+		}
+		if len(s.Numbers) > 0 {
+			summary.Min, summary.Max = s.Numbers[0], s.Numbers[len(s.Numbers)-1]
+			summary.Q1, summary.Median, summary.Q3 = quantile(s.Numbers, 0.25), quantile(s.Numbers, 0.5), quantile(s.Numbers, 0.75)
+			for _, n := range s.Numbers {
+				summary.Mean += n
+			}
+			summary.Mean /= float64(len(s.Numbers))
+		}
+		summaries[c] = summary
+	}
+	return summaries
+}
@@ -0,0 +1,210 @@
+package tools
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"ai-general-tool/common"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// sheetSummary describes one sheet of a workbook
+type sheetSummary struct {
+	Name    string `json:"name"`
+	Range   string `json:"range"` // used cell range, e.g. A1:F120; empty for an empty sheet
+	Rows    int    `json:"rows"`
+	Columns int    `json:"columns"`
+	Hidden  bool   `json:"hidden"`
+}
+
+// RunListSheets handles the list-sheets command: it lists the sheets of an
+// Excel or ODS workbook with their size and whether they are hidden
+func RunListSheets(args []string) error {
+	fs := flag.NewFlagSet("list-sheets", flag.ExitOnError)
+
+	// Define flags
+	fileName := fs.String("file", "", "Excel or ODS file (required)")
+	jsonOutput := fs.Bool("json", false, "Print the sheets as JSON")
+
+	// Parse flags
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	// Handle positional argument for filename
+	if *fileName == "" && fs.NArg() > 0 {
+		*fileName = fs.Arg(0)
+	}
+
+	if *fileName == "" {
+		return fmt.Errorf("file is required")
+	}
+	if !isExcelWorkbook(*fileName) && !isODSFile(*fileName) && !isXLSFile(*fileName) {
+		return fmt.Errorf("%s is not an Excel or ODS workbook", *fileName)
+	}
+
+	sheets, err := summarizeSheets(*fileName)
+	if err != nil {
+		return fmt.Errorf("error opening file '%s': %v", *fileName, err)
+	}
+	if *jsonOutput {
+		return printJSON(sheets)
+	}
+
+	fmt.Printf("\n=== SHEETS: %s ===\n", *fileName)
+	var table [][]string
+	hidden := 0
+	for i, s := range sheets {
+		visibility := "visible"
+		if s.Hidden {
+			visibility = "hidden"
+			hidden++
+		}
+		table = append(table, []string{strconv.Itoa(i + 1), s.Name, strconv.Itoa(s.Rows), strconv.Itoa(s.Columns), s.Range, visibility})
+	}
+	fmt.Println(common.FormatTable([]string{"#", "Sheet", "Rows", "Columns", "Range", "Visibility"}, table, 120))
+	fmt.Printf("%d sheets (%d hidden). Rows include header rows. Select a sheet with -sheet <number> or -sheet \"<name>\".\n", len(sheets), hidden)
+	return nil
+}
+
+// summarizeSheets describes the sheets of a workbook. Excel 2007+ sizes come
+// from the dimension each sheet stores, when it has one; ODS and .xls sheets
+// are read.
+func summarizeSheets(filename string) ([]sheetSummary, error) {
+	if isODSFile(filename) || isXLSFile(filename) {
+		read := readODS
+		if isXLSFile(filename) {
+			read = readXLS
+		}
+		sheets, err := read(filename)
+		if err != nil {
+			return nil, err
+		}
+		summaries := make([]sheetSummary, len(sheets))
+		for i, sheet := range sheets {
+			s := sheetSummary{Name: sheet.Name, Rows: len(sheet.Rows), Hidden: sheet.Hidden}
+			for _, row := range sheet.Rows {
+				s.Columns = common.Max(s.Columns, len(row))
+			}
+			if s.Rows > 0 && s.Columns > 0 {
+				s.Range = fmt.Sprintf("A1:%s%d", columnIndexToLetter(s.Columns-1), s.Rows)
+			}
+			summaries[i] = s
+		}
+		return summaries, nil
+	}
+
+	f, err := excelize.OpenFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var summaries []sheetSummary
+	for _, name := range f.GetSheetList() {
+		s := sheetSummary{Name: name}
+		if visible, err := f.GetSheetVisible(name); err == nil {
+			s.Hidden = !visible
+		}
+		dimension, err := f.GetSheetDimension(name)
+		if err != nil {
+			return nil, fmt.Errorf("sheet '%s': %v", name, err)
+		}
+		s.Range, s.Rows, s.Columns = rangeSize(dimension)
+		if s.Range == "" {
+			// Some writers, excelize among them, record A1 for every sheet
+			if s.Rows, s.Columns, err = countSheetCells(f, name); err != nil {
+				return nil, fmt.Errorf("sheet '%s': %v", name, err)
+			}
+			if s.Rows > 0 && s.Columns > 0 {
+				s.Range = fmt.Sprintf("A1:%s%d", columnIndexToLetter(s.Columns-1), s.Rows)
+			}
+		}
+		summaries = append(summaries, s)
+	}
+	return summaries, nil
+}
+
+// countSheetCells reads a sheet row by row and returns the number of its
+// last row and column holding a value
+func countSheetCells(f *excelize.File, sheet string) (int, int, error) {
+	rows, err := f.Rows(sheet)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer rows.Close()
+	last, columns := 0, 0
+	for n := 1; rows.Next(); n++ {
+		cells, err := rows.Columns()
+		if err != nil {
+			return 0, 0, err
+		}
+		for c := len(cells); c > 0; c-- {
+			if cells[c-1] != "" {
+				last, columns = n, common.Max(columns, c)
+				break
+			}
+		}
+	}
+	return last, columns, rows.Error()
+}
+
+// rangeSize returns a cell range such as B2:F120 with its row and column
+// counts, counted from A1 as the rows and columns read from the sheet are.
+// An empty range or a lone A1 with nothing in it are reported as empty.
+func rangeSize(ref string) (string, int, int) {
+	last := ref
+	if _, end, ok := strings.Cut(ref, ":"); ok {
+		last = end
+	}
+	col, row, err := excelize.CellNameToCoordinates(last)
+	if err != nil || ref == "A1" {
+		return "", 0, 0
+	}
+	return ref, row, col
+}
+
+// sheetNames returns the names of the sheets of a workbook
+func sheetNames(sheets []workbookSheet) []string {
+	names := make([]string, len(sheets))
+	for i, sheet := range sheets {
+		names[i] = sheet.Name
+	}
+	return names
+}
+
+// findSheet returns the 1-based position of a sheet given by name or by
+// number. A number is read as a position unless it is out of range and a
+// sheet is named so; names match exactly, or ignoring case when only one
+// sheet matches that way. An empty selection is the first sheet.
+func findSheet(names []string, sheet string) (int, error) {
+	if strings.TrimSpace(sheet) == "" {
+		return 1, nil
+	}
+	n, numErr := strconv.Atoi(strings.TrimSpace(sheet))
+	if numErr == nil && n >= 1 && n <= len(names) {
+		return n, nil
+	}
+	folded := 0
+	for i, name := range names {
+		if name == sheet {
+			return i + 1, nil
+		}
+		if strings.EqualFold(name, sheet) {
+			if folded != 0 {
+				folded = -1
+			} else {
+				folded = i + 1
+			}
+		}
+	}
+	if folded > 0 {
+		return folded, nil
+	}
+	if numErr == nil {
+		return 0, fmt.Errorf("invalid sheet index %d (file has %d sheets)", n, len(names))
+	}
+	return 0, fmt.Errorf("sheet '%s' not found (sheets: %s)", sheet, strings.Join(names, ", "))
+}
@@ -0,0 +1,321 @@
+package tools
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	rowHashColumn  = "_row_hash"
+	manifestSuffix = ".manifest.json"
+)
+
+// Manifest lets recipients of an output file check that it is unchanged and
+// which input values each row was enriched from. It is signed with ed25519.
+type Manifest struct {
+	Version       int       `json:"version"`
+	Output        string    `json:"output"`
+	OutputSHA256  string    `json:"output_sha256"`
+	Input         string    `json:"input"`
+	InputSHA256   string    `json:"input_sha256,omitempty"` // set for local input files
+	RowHashColumn string    `json:"row_hash_column,omitempty"`
+	HashedColumns []string  `json:"hashed_columns,omitempty"`    // input columns covered by the row hash, in order
+	RowHashesSHA  string    `json:"row_hashes_sha256,omitempty"` // hash of all row hashes, in row order
+	Rows          int       `json:"rows"`
+	CreatedAt     time.Time `json:"created_at"`
+	PublicKey     string    `json:"public_key"`
+	Signature     string    `json:"signature"`
+}
+
+// rowHashColumns returns the input columns covered by the row hash: those not
+// overwritten by a generated column, which keep their original values
+func rowHashColumns(headers []string, columnSpecs []ColumnSpec) []int {
+	var columns []int
+	for c, header := range headers {
+		overwritten := false
+		for _, spec := range columnSpecs {
+			if spec.Name == header {
+				overwritten = true
+				break
+			}
+		}
+		if !overwritten {
+			columns = append(columns, c)
+		}
+	}
+	return columns
+}
+
+// hashRow returns the hex SHA-256 of the given cells. Every cell is length
+// prefixed, so moving text between cells changes the hash.
+func hashRow(row []string, columns []int) string {
+	h := sha256.New()
+	var length [binary.MaxVarintLen64]byte
+	for _, c := range columns {
+		cell := ""
+		if c < len(row) {
+			cell = row[c]
+		}
+		n := binary.PutUvarint(length[:], uint64(len(cell)))
+		h.Write(length[:n])
+		h.Write([]byte(cell))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// fillRowHashes writes the hash of each row's original cells into the row
+// hash column
+func fillRowHashes(headers []string, rows [][]string, enrichedRows [][]string, columnSpecs []ColumnSpec) {
+	col := -1
+	for i, spec := range columnSpecs {
+		if spec.Name == rowHashColumn {
+			col = len(headers) + i
+		}
+	}
+	if col == -1 {
+		return
+	}
+	columns := rowHashColumns(headers, columnSpecs)
+	for r, row := range rows {
+		enrichedRows[r][col] = hashRow(row, columns)
+	}
+}
+
+// rowHashesDigest returns the hex SHA-256 of the row hash column, so row
+// hashes rewritten along with the values they cover are detected
+func rowHashesDigest(rows [][]string, col int) string {
+	h := sha256.New()
+	for _, row := range rows {
+		if col < len(row) {
+			h.Write([]byte(row[col]))
+		}
+		h.Write([]byte{'\n'})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// fileSHA256 returns the hex SHA-256 of a file's contents
+func fileSHA256(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// loadSigningKey reads a base64 ed25519 private key seed, generating a new
+// key pair (keyFile and keyFile.pub) when the file does not exist
+func loadSigningKey(keyFile string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(keyFile)
+	if os.IsNotExist(err) {
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(keyFile, []byte(base64.StdEncoding.EncodeToString(key.Seed())+"\n"), 0600); err != nil {
+			return nil, fmt.Errorf("error saving signing key: %v", err)
+		}
+		public := base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey))
+		if err := os.WriteFile(keyFile+".pub", []byte(public+"\n"), 0644); err != nil {
+			return nil, fmt.Errorf("error saving public key: %v", err)
+		}
+		fmt.Printf("Generated signing key %s (share %s.pub with recipients)\n", keyFile, keyFile)
+		return key, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading signing key: %v", err)
+	}
+
+	seed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("invalid signing key in %s", keyFile)
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// manifestPayload is the signed content: the manifest without its signature
+func manifestPayload(manifest Manifest) ([]byte, error) {
+	manifest.Signature = ""
+	return json.Marshal(manifest)
+}
+
+// writeManifest signs a manifest for the saved output file and writes it next
+// to the output. inputHash is the SHA-256 of the input file when the run
+// started, empty when the input is not a local file.
+func writeManifest(outputFile, inputFile, inputHash string, headers []string, enrichedRows [][]string, columnSpecs []ColumnSpec, key ed25519.PrivateKey) error {
+	outputHash, err := fileSHA256(outputFile)
+	if err != nil {
+		return err
+	}
+	manifest := Manifest{
+		Version:      1,
+		Output:       outputFile,
+		OutputSHA256: outputHash,
+		Input:        redactSource(inputFile),
+		InputSHA256:  inputHash,
+		Rows:         len(enrichedRows),
+		CreatedAt:    time.Now().UTC(),
+		PublicKey:    base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey)),
+	}
+	for i, spec := range columnSpecs {
+		if spec.Name == rowHashColumn {
+			manifest.RowHashColumn = rowHashColumn
+			for _, c := range rowHashColumns(headers, columnSpecs) {
+				manifest.HashedColumns = append(manifest.HashedColumns, headers[c])
+			}
+			manifest.RowHashesSHA = rowHashesDigest(enrichedRows, len(headers)+i)
+		}
+	}
+
+	payload, err := manifestPayload(manifest)
+	if err != nil {
+		return err
+	}
+	manifest.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(key, payload))
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(outputFile+manifestSuffix, append(data, '\n'), 0644)
+}
+
+// RunVerifyManifest handles the verify-manifest command: it checks the
+// signature of an output's manifest, whether the file changed and, with row
+// hashes, which rows no longer match their original input values. A changed
+// file is an error, so the command exits non-zero.
+func RunVerifyManifest(args []string) error {
+	fs := flag.NewFlagSet("verify-manifest", flag.ExitOnError)
+
+	// Define flags
+	inputFile := fs.String("input", "", "Output file to verify (CSV or Excel)")
+	manifestFile := fs.String("manifest", "", "Manifest file (default: <input>.manifest.json)")
+	publicKeyFile := fs.String("public-key", "", "Expected signer's public key file (recommended)")
+	sheet := fs.String("sheet", "1", "Excel sheet: name or number (1-based)")
+
+	// Parse flags
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	// Handle positional argument for filename
+	if *inputFile == "" && fs.NArg() > 0 {
+		*inputFile = fs.Arg(0)
+	}
+
+	// Validate inputs
+	if *inputFile == "" {
+		return fmt.Errorf("input file is required")
+	}
+	if *manifestFile == "" {
+		*manifestFile = *inputFile + manifestSuffix
+	}
+
+	data, err := os.ReadFile(*manifestFile)
+	if err != nil {
+		return fmt.Errorf("error reading manifest: %v", err)
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return fmt.Errorf("invalid manifest: %v", err)
+	}
+
+	// Check the signature, and the signer when a public key is given
+	publicKey, err := base64.StdEncoding.DecodeString(manifest.PublicKey)
+	if err != nil || len(publicKey) != ed25519.PublicKeySize {
+		return fmt.Errorf("invalid public key in manifest")
+	}
+	signature, err := base64.StdEncoding.DecodeString(manifest.Signature)
+	if err != nil {
+		return fmt.Errorf("invalid signature in manifest")
+	}
+	payload, err := manifestPayload(manifest)
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(publicKey, payload, signature) {
+		return fmt.Errorf("manifest signature is invalid: the manifest was modified")
+	}
+	if *publicKeyFile != "" {
+		expected, err := os.ReadFile(*publicKeyFile)
+		if err != nil {
+			return fmt.Errorf("error reading public key: %v", err)
+		}
+		if strings.TrimSpace(string(expected)) != manifest.PublicKey {
+			return fmt.Errorf("manifest was signed by a different key")
+		}
+		fmt.Println("Signature: valid, signed by the expected key")
+	} else {
+		fmt.Println("Signature: valid (pass -public-key to check who signed it)")
+	}
+	fmt.Printf("Produced from %s at %s, %d rows\n", manifest.Input, manifest.CreatedAt.Format(time.RFC3339), manifest.Rows)
+
+	outputHash, err := fileSHA256(*inputFile)
+	if err != nil {
+		return fmt.Errorf("error reading output: %v", err)
+	}
+	if outputHash == manifest.OutputSHA256 {
+		fmt.Println("File: unchanged since the manifest was signed")
+		return nil
+	}
+	fmt.Println("File: CHANGED since the manifest was signed")
+
+	if manifest.RowHashColumn == "" {
+		return fmt.Errorf("the output was changed; it has no row hashes, so changed rows cannot be identified")
+	}
+
+	// Recompute the row hashes from the file's current values
+	headers, rows, err := loadInputFile(*inputFile, InputOptions{Sheet: *sheet})
+	if err != nil {
+		return fmt.Errorf("error loading output: %v", err)
+	}
+	hashCol := indexOf(headers, manifest.RowHashColumn)
+	if hashCol == -1 {
+		return fmt.Errorf("row hash column '%s' is missing", manifest.RowHashColumn)
+	}
+	var columns []int
+	for _, name := range manifest.HashedColumns {
+		c := indexOf(headers, name)
+		if c == -1 {
+			return fmt.Errorf("hashed column '%s' is missing", name)
+		}
+		columns = append(columns, c)
+	}
+
+	var changed []string
+	for r, row := range rows {
+		if hashCol >= len(row) || hashRow(row, columns) != row[hashCol] {
+			changed = append(changed, fmt.Sprintf("%d", r+2))
+		}
+	}
+	if len(rows) != manifest.Rows {
+		fmt.Printf("Row count: %d, manifest says %d\n", len(rows), manifest.Rows)
+	}
+	if len(changed) == 0 {
+		if rowHashesDigest(rows, hashCol) != manifest.RowHashesSHA {
+			fmt.Println("Input values: CHANGED, row hashes were rewritten to match edited values")
+			return fmt.Errorf("the output was changed, and its row hashes rewritten")
+		}
+		fmt.Println("Input values: all rows match their row hash (only generated values or formatting changed)")
+		return fmt.Errorf("the output was changed since the manifest was signed")
+	}
+	fmt.Printf("Input values: %d rows no longer match their row hash: %s\n", len(changed), strings.Join(changed, ", "))
+	return fmt.Errorf("%d rows of the output no longer match their row hash", len(changed))
+}
@@ -0,0 +1,199 @@
+package tools
+
+import (
+	"archive/zip"
+	"flag"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Inputs made of many files: a glob such as "exports/*.csv", a .zip archive,
+// or one archive member written as "exports.zip/day1.csv". Combined inputs
+// get a source_file column naming the file each row came from.
+const (
+	sourceFileColumn = "source_file"
+	zipSuffix        = ".zip"
+	zipSeparator     = ".zip/"
+)
+
+// zipEntryExtensions lists the archive members read as data
+var zipEntryExtensions = map[string]bool{".csv": true, ".json": true, ".jsonl": true}
+
+// isZipFile reports whether a file name is a zip archive
+func isZipFile(filename string) bool {
+	return strings.HasSuffix(strings.ToLower(filename), zipSuffix)
+}
+
+// isGlobInput reports whether a file name is a glob pattern
+func isGlobInput(filename string) bool {
+	return strings.ContainsAny(filename, "*?[")
+}
+
+// isMultiInput reports whether an input names several files
+func isMultiInput(filename string) bool {
+	return isGlobInput(filename) || isZipFile(filename)
+}
+
+// splitZipEntry splits "exports.zip/day1.csv" into the archive and member
+func splitZipEntry(filename string) (string, string, bool) {
+	i := strings.Index(strings.ToLower(filename), zipSeparator)
+	if i == -1 {
+		return "", "", false
+	}
+	return filename[:i+len(zipSuffix)], filename[i+len(zipSeparator):], true
+}
+
+// expandInput lists the files of a glob or archive input in name order.
+// Archive members are named "<archive>/<member>".
+func expandInput(filename string) ([]string, error) {
+	if isGlobInput(filename) {
+		matches, err := filepath.Glob(filename)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern '%s': %v", filename, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no files match '%s'", filename)
+		}
+		return matches, nil
+	}
+
+	archive, err := zip.OpenReader(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer archive.Close()
+
+	var names []string
+	for _, entry := range archive.File {
+		base := path.Base(entry.Name)
+		if entry.FileInfo().IsDir() || strings.HasPrefix(base, ".") || strings.HasPrefix(entry.Name, "__MACOSX/") {
+			continue
+		}
+		if zipEntryExtensions[dataExt(entry.Name)] {
+			names = append(names, filename+"/"+entry.Name)
+		}
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("%s contains no CSV, JSON or JSONL files", filename)
+	}
+	return names, nil
+}
+
+// loadMultiInput loads every file of a glob or archive input as one dataset.
+// Columns are matched by name; a file lacking a column leaves it empty.
+func loadMultiInput(filename string, opts InputOptions) ([]string, [][]string, error) {
+	names, err := expandInput(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var headers, sources []string
+	var rows [][]string
+	for _, name := range names {
+		fileHeaders, fileRows, err := loadInputFile(name, opts)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %v", name, err)
+		}
+		if indexOf(fileHeaders, sourceFileColumn) != -1 {
+			return nil, nil, fmt.Errorf("%s already has a %s column", name, sourceFileColumn)
+		}
+
+		positions := make([]int, len(fileHeaders))
+		for i, header := range fileHeaders {
+			positions[i] = indexOf(headers, header)
+			if positions[i] == -1 {
+				positions[i] = len(headers)
+				headers = append(headers, header)
+			}
+		}
+		for _, fileRow := range fileRows {
+			row := make([]string, len(headers))
+			for i, value := range fileRow {
+				if i < len(positions) {
+					row[positions[i]] = value
+				}
+			}
+			rows = append(rows, row)
+			sources = append(sources, name)
+		}
+	}
+
+	// Pad earlier rows to the final width and add source_file
+	for i, row := range rows {
+		padded := make([]string, len(headers)+1)
+		copy(padded, row)
+		padded[len(headers)] = sources[i]
+		rows[i] = padded
+	}
+	return append(headers, sourceFileColumn), rows, nil
+}
+
+// loadZipEntry reads one CSV, JSON or JSONL member of a zip archive
+func loadZipEntry(archivePath, entryName string, opts InputOptions) ([]string, [][]string, error) {
+	archive, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer archive.Close()
+
+	file, err := archive.Open(entryName)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	switch dataExt(entryName) {
+	case ".csv":
+		return readCSV(file, opts)
+	case ".json", ".jsonl":
+		return readJSON(file, dataExt(entryName) == ".jsonl", opts)
+	}
+	return nil, nil, fmt.Errorf("unsupported archive member '%s' (use CSV, JSON or JSONL)", entryName)
+}
+
+// multiInputStem names the output of a combined input: the archive name, or
+// "combined" in the directory a glob starts from
+func multiInputStem(filename string) string {
+	if !isGlobInput(filename) {
+		return strings.TrimSuffix(filename, filepath.Ext(filename))
+	}
+	dir := filepath.Dir(filename)
+	for isGlobInput(dir) {
+		dir = filepath.Dir(dir)
+	}
+	return filepath.Join(dir, "combined")
+}
+
+// runPerFile runs a command once for each file of a glob or archive input,
+// passing on the other flags that were set. Failed files are reported and
+// skipped.
+func runPerFile(fs *flag.FlagSet, filename string, run func(args []string) error) error {
+	names, err := expandInput(filename)
+	if err != nil {
+		return err
+	}
+
+	var args []string
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name != "input" && f.Name != "per-file" {
+			args = append(args, "-"+f.Name+"="+f.Value.String())
+		}
+	})
+
+	var failed []string
+	for i, name := range names {
+		fmt.Printf("\n=== FILE %d/%d: %s ===\n", i+1, len(names), name)
+		fileArgs := append(append([]string{}, args...), "-input", name)
+		if err := run(fileArgs); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			failed = append(failed, name)
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d files failed: %s", len(failed), len(names), strings.Join(failed, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/openai/openai-go"
+)
+
+// normalizeMaxValues caps the distinct values sent per column; columns with
+// more values are free text rather than labels and are skipped
+const normalizeMaxValues = 1000
+
+// selectNormalizeColumns resolves the -normalize flag ("all" or a
+// comma-separated list) to indexes into the column specs
+func selectNormalizeColumns(spec string, columnSpecs []ColumnSpec) ([]int, error) {
+	var indexes []int
+	if spec == "all" {
+		for i, columnSpec := range columnSpecs {
+			if !columnSpec.Local {
+				indexes = append(indexes, i)
+			}
+		}
+		return indexes, nil
+	}
+
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.TrimSpace(name)
+		found := false
+		for i, columnSpec := range columnSpecs {
+			if columnSpec.Name == name && !columnSpec.Local {
+				indexes = append(indexes, i)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("cannot normalize '%s': not a generated column", name)
+		}
+	}
+	return indexes, nil
+}
+
+// normalizeColumns maps variant spellings in the generated columns to a
+// canonical form. The model only proposes the mapping from the distinct
+// values; it is applied locally to every cell.
+func normalizeColumns(ctx context.Context, config *ProcessingConfig, headers []string, enrichedRows [][]string, columns []int, stats *ProcessingStats) {
+	fmt.Println("\n=== CONSISTENCY PASS ===")
+	status := statusSpecIndex(config.ColumnSpecs)
+
+	for _, i := range columns {
+		spec := config.ColumnSpecs[i]
+		col := len(headers) + i
+
+		counts := make(map[string]int)
+		for _, row := range enrichedRows {
+			if value := row[col]; value != "" && rowStatus(row, headers, status) != journalError {
+				counts[value]++
+			}
+		}
+		if len(counts) < 2 {
+			fmt.Printf("%s: nothing to normalize\n", spec.Name)
+			continue
+		}
+		if len(counts) > normalizeMaxValues {
+			fmt.Printf("%s: skipped, %d distinct values (max %d)\n", spec.Name, len(counts), normalizeMaxValues)
+			continue
+		}
+
+		mapping, usage, err := requestNormalization(ctx, config, spec, counts)
+		stats.addUsage(usage)
+		if err != nil {
+			fmt.Printf("%s: normalization failed: %v\n", spec.Name, err)
+			continue
+		}
+
+		changed := 0
+		for _, row := range enrichedRows {
+			if canonical, ok := mapping[row[col]]; ok && canonical != row[col] {
+				row[col] = canonical
+				changed++
+			}
+		}
+
+		after := make(map[string]bool)
+		for _, row := range enrichedRows {
+			if value := row[col]; value != "" && rowStatus(row, headers, status) != journalError {
+				after[value] = true
+			}
+		}
+		fmt.Printf("%s: %d -> %d distinct values, %d cells changed\n", spec.Name, len(counts), len(after), changed)
+	}
+}
+
+// requestNormalization asks the model to group the values into canonical
+// forms and returns a variant -> canonical mapping
+func requestNormalization(ctx context.Context, config *ProcessingConfig, spec ColumnSpec, counts map[string]int) (map[string]string, TokenUsage, error) {
+	values := make([]string, 0, len(counts))
+	for value := range counts {
+		values = append(values, value)
+	}
+	sort.Slice(values, func(a, b int) bool {
+		if counts[values[a]] != counts[values[b]] {
+			return counts[values[a]] > counts[values[b]]
+		}
+		return values[a] < values[b]
+	})
+
+	var list strings.Builder
+	for _, value := range values {
+		list.WriteString(fmt.Sprintf("%d\t%s\n", counts[value], value))
+	}
+
+	schema := map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"mappings": map[string]interface{}{
+				"type": "array",
+				"items": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"value":     map[string]interface{}{"type": "string", "description": "A value exactly as listed"},
+						"canonical": map[string]interface{}{"type": "string", "description": "The canonical form it should be replaced with"},
+					},
+					"required":             []string{"value", "canonical"},
+					"additionalProperties": false,
+				},
+			},
+		},
+		"required":             []string{"mappings"},
+		"additionalProperties": false,
+	}
+
+	userMessage := fmt.Sprintf("Column: %s\nThe values were generated for the task: %s\n\nDistinct values (count<TAB>value):\n%s\n"+
+		"Find values that mean the same thing but are written differently (abbreviations, casing, spelling, synonyms) "+
+		"and map each variant to one canonical form, preferring the most frequent well-formed spelling. "+
+		"Only list values that should change. Do not merge values with different meanings.",
+		spec.Name, config.Prompt, list.String())
+
+	completion, err := config.Client.Chat.Completions.New(ctx, openai.ChatCompletionNewParams{
+		Model: config.modelFor(spec),
+		Messages: []openai.ChatCompletionMessageParamUnion{
+			openai.SystemMessage("You are a data cleaning assistant that makes the values of a column consistent."),
+			openai.UserMessage(userMessage),
+		},
+		Functions: []openai.ChatCompletionNewParamsFunction{
+			{
+				Name:        "map_values",
+				Description: openai.String("Map variant values to their canonical form"),
+				Parameters:  openai.FunctionParameters(schema),
+			},
+		},
+		FunctionCall: openai.ChatCompletionNewParamsFunctionCallUnion{
+			OfFunctionCallOption: &openai.ChatCompletionFunctionCallOptionParam{Name: "map_values"},
+		},
+		Temperature: openai.Float(0),
+	})
+	if err != nil {
+		return nil, TokenUsage{}, err
+	}
+	usage := chatUsage(config.modelFor(spec), completion.Usage)
+	if len(completion.Choices) == 0 || completion.Choices[0].Message.FunctionCall.Name == "" {
+		return nil, usage, fmt.Errorf("no function call in response")
+	}
+
+	var result struct {
+		Mappings []struct {
+			Value     string `json:"value"`
+			Canonical string `json:"canonical"`
+		} `json:"mappings"`
+	}
+	if err := json.Unmarshal([]byte(completion.Choices[0].Message.FunctionCall.Arguments), &result); err != nil {
+		return nil, usage, fmt.Errorf("failed to parse AI response: %v", err)
+	}
+
+	// Ignore values the model invented and empty targets
+	mapping := make(map[string]string)
+	for _, m := range result.Mappings {
+		if _, ok := counts[m.Value]; ok && strings.TrimSpace(m.Canonical) != "" {
+			mapping[m.Value] = strings.TrimSpace(m.Canonical)
+		}
+	}
+	return mapping, usage, nil
+}
@@ -0,0 +1,302 @@
+package tools
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// OpenDocument spreadsheets (.ods) are zip archives whose content.xml holds
+// the tables. Cells are read as their displayed text and written as strings.
+const (
+	odsExtension = ".ods"
+	odsMimeType  = "application/vnd.oasis.opendocument.spreadsheet"
+
+	odsTableNS  = "urn:oasis:names:tc:opendocument:xmlns:table:1.0"
+	odsTextNS   = "urn:oasis:names:tc:opendocument:xmlns:text:1.0"
+	odsOfficeNS = "urn:oasis:names:tc:opendocument:xmlns:office:1.0"
+	odsStyleNS  = "urn:oasis:names:tc:opendocument:xmlns:style:1.0"
+)
+
+// workbookSheet is one sheet of an ODS or .xls workbook
+type workbookSheet struct {
+	Name   string
+	Rows   [][]string
+	Hidden bool
+}
+
+// isODSFile reports whether a file name is an OpenDocument spreadsheet
+func isODSFile(filename string) bool {
+	return strings.HasSuffix(strings.ToLower(filename), odsExtension)
+}
+
+// readODS reads every table of a spreadsheet. Repeated empty rows and cells,
+// which pad tables to the full sheet size, are dropped at the end of a row or
+// table.
+func readODS(filename string) ([]workbookSheet, error) {
+	archive, err := zip.OpenReader(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer archive.Close()
+
+	content, err := archive.Open("content.xml")
+	if err != nil {
+		return nil, fmt.Errorf("not an OpenDocument spreadsheet: %v", err)
+	}
+	defer content.Close()
+
+	var sheets []workbookSheet
+	var sheet *workbookSheet
+	var row []string
+	var text strings.Builder
+	rowRepeat, cellRepeat := 1, 1
+	pendingRows, pendingCells := 0, 0
+	inCell, paragraphs := false, 0
+	style, hiddenStyles := "", make(map[string]bool) // table styles with display off
+
+	decoder := xml.NewDecoder(bufio.NewReader(content))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid content.xml: %v", err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch {
+			case t.Name.Space == odsStyleNS && t.Name.Local == "style":
+				style = odsAttr(t, odsStyleNS, "name")
+			case t.Name.Space == odsStyleNS && t.Name.Local == "table-properties":
+				if odsAttr(t, odsTableNS, "display") == "false" {
+					hiddenStyles[style] = true
+				}
+			case t.Name.Space == odsTableNS && t.Name.Local == "table":
+				sheets = append(sheets, workbookSheet{Name: odsAttr(t, odsTableNS, "name"), Hidden: hiddenStyles[odsAttr(t, odsTableNS, "style-name")]})
+				sheet = &sheets[len(sheets)-1]
+				pendingRows = 0
+			case t.Name.Space == odsTableNS && t.Name.Local == "table-row":
+				row = nil
+				pendingCells = 0
+				rowRepeat = odsRepeat(t, "number-rows-repeated")
+			case t.Name.Space == odsTableNS && (t.Name.Local == "table-cell" || t.Name.Local == "covered-table-cell"):
+				inCell, paragraphs = true, 0
+				text.Reset()
+				cellRepeat = odsRepeat(t, "number-columns-repeated")
+				if value := odsAttr(t, odsOfficeNS, "value"); value != "" {
+					text.WriteString(value) // replaced by the displayed text if any
+					paragraphs = -1
+				}
+			case inCell && t.Name.Space == odsTextNS && t.Name.Local == "p":
+				if paragraphs == -1 {
+					text.Reset()
+					paragraphs = 0
+				}
+				if paragraphs > 0 {
+					text.WriteByte('\n')
+				}
+				paragraphs++
+			case inCell && t.Name.Space == odsTextNS && t.Name.Local == "s":
+				text.WriteString(strings.Repeat(" ", odsRepeat(t, "c")))
+			case inCell && t.Name.Space == odsTextNS && t.Name.Local == "tab":
+				text.WriteByte('\t')
+			case inCell && t.Name.Space == odsTextNS && t.Name.Local == "line-break":
+				text.WriteByte('\n')
+			}
+		case xml.CharData:
+			if inCell && paragraphs > 0 {
+				text.Write(t)
+			}
+		case xml.EndElement:
+			switch {
+			case t.Name.Space == odsTableNS && (t.Name.Local == "table-cell" || t.Name.Local == "covered-table-cell"):
+				inCell = false
+				value := text.String()
+				if value == "" {
+					pendingCells += cellRepeat
+					continue
+				}
+				for ; pendingCells > 0; pendingCells-- {
+					row = append(row, "")
+				}
+				for i := 0; i < cellRepeat; i++ {
+					row = append(row, value)
+				}
+			case t.Name.Space == odsTableNS && t.Name.Local == "table-row" && sheet != nil:
+				if len(row) == 0 {
+					pendingRows += rowRepeat
+					continue
+				}
+				for ; pendingRows > 0; pendingRows-- {
+					sheet.Rows = append(sheet.Rows, nil)
+				}
+				for i := 0; i < rowRepeat; i++ {
+					sheet.Rows = append(sheet.Rows, append([]string(nil), row...))
+				}
+			}
+		}
+	}
+
+	if len(sheets) == 0 {
+		return nil, fmt.Errorf("no sheets found in %s", filename)
+	}
+	return sheets, nil
+}
+
+// odsAttr returns an attribute value
+func odsAttr(element xml.StartElement, space, local string) string {
+	for _, attr := range element.Attr {
+		if attr.Name.Space == space && attr.Name.Local == local {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// odsRepeat returns a repeat count attribute, 1 when missing
+func odsRepeat(element xml.StartElement, local string) int {
+	space := odsTableNS
+	if local == "c" {
+		space = odsTextNS
+	}
+	n, err := strconv.Atoi(odsAttr(element, space, local))
+	if err != nil || n < 1 {
+		return 1
+	}
+	return n
+}
+
+// loadODS loads one sheet, by name or number (1-based), of a spreadsheet
+func loadODS(filename string, sheet string, header HeaderOptions) ([]string, [][]string, error) {
+	sheets, err := readODS(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	return sheetTable(sheets, sheet, header)
+}
+
+// sheetTable splits one sheet, by name or number (1-based), into headers
+// and data rows
+func sheetTable(sheets []workbookSheet, sheet string, header HeaderOptions) ([]string, [][]string, error) {
+	sheetIndex, err := findSheet(sheetNames(sheets), sheet)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return header.split(sheets[sheetIndex-1].Rows)
+}
+
+// saveODS writes the rows as a single-sheet spreadsheet
+func saveODS(filename string, headers []string, rows [][]string) error {
+	return saveODSSheets(filename, []workbookSheet{{Name: "Sheet1", Rows: append([][]string{headers}, rows...)}})
+}
+
+// saveODSSheets writes a spreadsheet with one table per sheet; the rows of
+// each sheet start with its header row
+func saveODSSheets(filename string, sheets []workbookSheet) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	archive := zip.NewWriter(file)
+
+	// The mimetype comes first and uncompressed
+	mimetype, err := archive.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	if err != nil {
+		return err
+	}
+	io.WriteString(mimetype, odsMimeType)
+
+	manifest, err := archive.Create("META-INF/manifest.xml")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(manifest, `<?xml version="1.0" encoding="UTF-8"?>
+<manifest:manifest xmlns:manifest="urn:oasis:names:tc:opendocument:xmlns:manifest:1.0" manifest:version="1.2">
+ <manifest:file-entry manifest:full-path="/" manifest:version="1.2" manifest:media-type="%s"/>
+ <manifest:file-entry manifest:full-path="content.xml" manifest:media-type="text/xml"/>
+</manifest:manifest>
+`, odsMimeType)
+
+	content, err := archive.Create("content.xml")
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(content)
+	fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<office:document-content xmlns:office="%s" xmlns:table="%s" xmlns:text="%s" office:version="1.2">
+<office:body><office:spreadsheet>
+`, odsOfficeNS, odsTableNS, odsTextNS)
+	for _, sheet := range sheets {
+		w.WriteString(`<table:table table:name="`)
+		xml.EscapeText(w, []byte(sheet.Name))
+		w.WriteString("\">\n")
+		for _, row := range sheet.Rows {
+			w.WriteString("<table:table-row>")
+			for _, value := range row {
+				if value == "" {
+					w.WriteString("<table:table-cell/>")
+					continue
+				}
+				w.WriteString(`<table:table-cell office:value-type="string">`)
+				writeODSText(w, value)
+				w.WriteString("</table:table-cell>")
+			}
+			w.WriteString("</table:table-row>\n")
+		}
+		w.WriteString("</table:table>\n")
+	}
+	w.WriteString("</office:spreadsheet></office:body></office:document-content>\n")
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	return archive.Close()
+}
+
+// writeODSText writes a value as paragraphs, one per line, keeping repeated,
+// leading and trailing spaces and tabs, which ODF would otherwise collapse
+func writeODSText(w *bufio.Writer, value string) {
+	for _, line := range strings.Split(value, "\n") {
+		w.WriteString("<text:p>")
+		for i := 0; i < len(line); {
+			switch line[i] {
+			case '\t':
+				w.WriteString("<text:tab/>")
+				i++
+			case ' ':
+				end := i
+				for end < len(line) && line[end] == ' ' {
+					end++
+				}
+				spaces := end - i
+				if i > 0 && end < len(line) {
+					w.WriteByte(' ')
+					spaces--
+				}
+				if spaces > 0 {
+					fmt.Fprintf(w, `<text:s text:c="%d"/>`, spaces)
+				}
+				i = end
+			default:
+				end := strings.IndexAny(line[i:], " \t")
+				if end == -1 {
+					end = len(line) - i
+				}
+				xml.EscapeText(w, []byte(line[i:i+end]))
+				i += end
+			}
+		}
+		w.WriteString("</text:p>")
+	}
+}
@@ -0,0 +1,141 @@
+package tools
+
+import (
+	"fmt"
+	"strings"
+
+	"ai-general-tool/common"
+)
+
+// mergeGeneratedColumns builds the output table from the enriched rows. A
+// generated column named like an input column overwrites it instead of being
+// appended; empty and failed cells keep the original value. Status columns
+// are replaced as a whole in the rows that were processed.
+func mergeGeneratedColumns(headers []string, enrichedRows [][]string, columnSpecs []ColumnSpec) ([]string, [][]string) {
+	overwrites := make(map[int]int) // spec index -> input column index
+	status := statusSpecIndex(columnSpecs)
+	outHeaders := append([]string{}, headers...)
+	for i, spec := range columnSpecs {
+		if idx := indexOf(headers, spec.Name); idx != -1 {
+			overwrites[i] = idx
+		} else {
+			outHeaders = append(outHeaders, spec.Name)
+		}
+	}
+	if len(overwrites) == 0 {
+		return outHeaders, enrichedRows
+	}
+
+	outRows := make([][]string, len(enrichedRows))
+	for r, row := range enrichedRows {
+		out := make([]string, len(outHeaders))
+		copy(out, row[:common.Min(len(headers), len(row))])
+		rowState := rowStatus(row, headers, status)
+		pos := len(headers)
+		for i := range columnSpecs {
+			value := ""
+			if len(headers)+i < len(row) {
+				value = row[len(headers)+i]
+			}
+			if idx, ok := overwrites[i]; ok {
+				if value != "" && rowState != journalError || isStatusColumn(columnSpecs[i].Name) && rowState != "" {
+					out[idx] = value
+				}
+				continue
+			}
+			out[pos] = value
+			pos++
+		}
+		outRows[r] = out
+	}
+	return outHeaders, outRows
+}
+
+// printOutputDiff summarizes how the output differs from the input: row
+// counts, new and overwritten columns, and per-column fill, change and error
+// counts
+func printOutputDiff(headers []string, rows [][]string, enrichedRows [][]string, columnSpecs []ColumnSpec) {
+	_, outRows := mergeGeneratedColumns(headers, enrichedRows, columnSpecs)
+
+	fmt.Println("\n=== OUTPUT PREVIEW ===")
+	fmt.Printf("Rows: %d in, %d out", len(rows), len(outRows))
+	if dropped := len(rows) - len(outRows); dropped > 0 {
+		fmt.Printf(" (%d dropped)", dropped)
+	}
+	fmt.Println()
+
+	var newColumns, overwritten []string
+	for _, spec := range columnSpecs {
+		if indexOf(headers, spec.Name) != -1 {
+			overwritten = append(overwritten, spec.Name)
+		} else {
+			newColumns = append(newColumns, spec.Name)
+		}
+	}
+	if len(newColumns) > 0 {
+		fmt.Printf("New columns: %s\n", strings.Join(newColumns, ", "))
+	}
+	if len(overwritten) > 0 {
+		fmt.Printf("Overwritten columns: %s\n", strings.Join(overwritten, ", "))
+	}
+
+	status := statusSpecIndex(columnSpecs)
+	unprocessed := 0
+	tableRows := make([][]string, len(columnSpecs))
+	filled := make([]int, len(columnSpecs))
+	changed := make([]int, len(columnSpecs))
+	failed := make([]int, len(columnSpecs))
+	for r, row := range enrichedRows {
+		empty := true
+		rowFailed := rowStatus(row, headers, status) == journalError
+		for i, spec := range columnSpecs {
+			value := row[len(headers)+i]
+			switch {
+			case value == "" && rowFailed && !spec.Local:
+				failed[i]++
+				continue
+			case value == "":
+				continue
+			default:
+				filled[i]++
+				if idx := indexOf(headers, spec.Name); idx != -1 && r < len(rows) && idx < len(rows[r]) && rows[r][idx] != value {
+					changed[i]++
+				}
+			}
+			empty = false
+		}
+		if empty {
+			unprocessed++
+		}
+	}
+	if unprocessed > 0 {
+		fmt.Printf("Unprocessed rows: %d (generated columns left empty)\n", unprocessed)
+	}
+
+	for i, spec := range columnSpecs {
+		status := "new"
+		changes := "-"
+		if indexOf(headers, spec.Name) != -1 {
+			status = "overwritten"
+			changes = fmt.Sprintf("%d", changed[i])
+		}
+		tableRows[i] = []string{
+			spec.Name,
+			status,
+			fmt.Sprintf("%d (%s)", filled[i], common.FormatPercentage(filled[i], len(enrichedRows))),
+			changes,
+			fmt.Sprintf("%d", failed[i]),
+		}
+	}
+	fmt.Println(common.FormatTable([]string{"Column", "Status", "Filled", "Changed", "Errors"}, tableRows, 120))
+}
+
+// indexOf returns the position of target in values, or -1
+func indexOf(values []string, target string) int {
+	for i, value := range values {
+		if value == target {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,81 @@
+package tools
+
+import (
+	"flag"
+	"fmt"
+)
+
+// Output modes: full writes every input column next to the generated ones,
+// delta only a key column and the generated columns, for merging the results
+// back into a system of record
+const (
+	outputModeFull  = "full"
+	outputModeDelta = "delta"
+)
+
+// outputMode is the value of -output-mode
+type outputMode string
+
+func (m *outputMode) String() string { return string(*m) }
+
+func (m *outputMode) Set(value string) error {
+	if value != outputModeFull && value != outputModeDelta {
+		return fmt.Errorf("invalid output mode '%s' (use full or delta)", value)
+	}
+	*m = outputMode(value)
+	return nil
+}
+
+// outputModeFlags registers -output-mode and -key-column
+func outputModeFlags(fs *flag.FlagSet, opts *OutputOptions) {
+	opts.Mode = outputModeFull
+	fs.Var(&opts.Mode, "output-mode", "Output columns: full (every input column) or delta (key column plus generated columns)")
+	fs.StringVar(&opts.KeyColumn, "key-column", "", "Key column kept by -output-mode delta (default: first column)")
+}
+
+// setInput adapts the output to the loaded input: delta outputs need their
+// key column, and full Excel outputs of a local Excel input are written into
+// a copy of it so the generated columns are added to the original sheet
+func (o *OutputOptions) setInput(inputFile string, input InputOptions, headers []string) error {
+	if o.Mode == outputModeDelta {
+		if o.KeyColumn == "" {
+			o.KeyColumn = headers[0]
+		}
+		if indexOf(headers, o.KeyColumn) == -1 {
+			return fmt.Errorf("key column '%s' not found", o.KeyColumn)
+		}
+		return nil
+	}
+	// A sheet without a header row has nowhere to name new columns, and
+	// combined sheets are no longer one sheet of the input
+	if isExcelWorkbook(inputFile) && !isCloudURI(inputFile) && !input.Header.None && !isAllSheets(input.Sheet) {
+		o.Workbook, o.Sheet, o.Header = inputFile, input.Sheet, input.Header
+	}
+	return nil
+}
+
+// deltaColumns keeps the key column and the generated columns of the output
+func deltaColumns(headers []string, rows [][]string, key string, columnSpecs []ColumnSpec) ([]string, [][]string) {
+	cols := []int{indexOf(headers, key)}
+	for _, spec := range columnSpecs {
+		if col := indexOf(headers, spec.Name); col != -1 && spec.Name != key {
+			cols = append(cols, col)
+		}
+	}
+
+	outHeaders := make([]string, len(cols))
+	for i, col := range cols {
+		outHeaders[i] = headers[col]
+	}
+	outRows := make([][]string, len(rows))
+	for r, row := range rows {
+		out := make([]string, len(cols))
+		for i, col := range cols {
+			if col < len(row) {
+				out[i] = row[col]
+			}
+		}
+		outRows[r] = out
+	}
+	return outHeaders, outRows
+}
@@ -0,0 +1,71 @@
+package tools
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// OutputNameData is available to -output-template, e.g.
+// "{{.Stem}}_{{.Date}}_{{.Model}}.xlsx"
+type OutputNameData struct {
+	Stem    string // input file name without extension
+	Ext     string // default extension for the output format, e.g. ".csv"
+	Date    string // 2006-01-02
+	Time    string // 150405
+	Model   string // default model of the run
+	Columns string // generated column names joined with "-"
+	Command string
+}
+
+// renderOutputTemplate builds the output file name from a template. The
+// default extension is appended when the template produces none, and
+// directories in the name are created.
+func renderOutputTemplate(tmpl string, data OutputNameData) (string, error) {
+	t, err := template.New("output").Option("missingkey=error").Parse(tmpl)
+	if err != nil {
+		return "", fmt.Errorf("invalid output template: %v", err)
+	}
+
+	var name strings.Builder
+	if err := t.Execute(&name, data); err != nil {
+		return "", fmt.Errorf("invalid output template: %v", err)
+	}
+
+	result := strings.TrimSpace(name.String())
+	if result == "" {
+		return "", fmt.Errorf("output template produced an empty file name")
+	}
+	if filepath.Ext(result) == "" {
+		result += data.Ext
+	}
+	if dir := filepath.Dir(result); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return "", fmt.Errorf("error creating output directory: %v", err)
+		}
+	}
+	return result, nil
+}
+
+// newOutputNameData fills the template fields for a run
+func newOutputNameData(command, inputFile, format, model string, columnSpecs []ColumnSpec) OutputNameData {
+	now := time.Now()
+	names := make([]string, 0, len(columnSpecs))
+	for _, spec := range columnSpecs {
+		if !spec.Local {
+			names = append(names, spec.Name)
+		}
+	}
+	return OutputNameData{
+		Stem:    outputStem(inputFile),
+		Ext:     outputExt(inputFile, format),
+		Date:    now.Format("2006-01-02"),
+		Time:    now.Format("150405"),
+		Model:   model,
+		Columns: strings.Join(names, "-"),
+		Command: command,
+	}
+}
@@ -0,0 +1,267 @@
+package tools
+
+import (
+	"flag"
+	"fmt"
+	"slices"
+	"strings"
+
+	"ai-general-tool/common"
+)
+
+// RunPivot handles the pivot command: it turns a long table into a wide one,
+// with a column per value of -columns and a row per -index key
+func RunPivot(args []string) error {
+	fs := flag.NewFlagSet("pivot", flag.ExitOnError)
+
+	// Define flags
+	inputFile := fs.String("input", "", "Input file (CSV, Excel or JSON)")
+	index := fs.String("index", "", "Comma-separated columns identifying an output row (required)")
+	columns := fs.String("columns", "", "Column whose values become the output columns (required)")
+	values := fs.String("values", "", "Column holding the cell values (required unless -agg count)")
+	agg := fs.String("agg", "first", "How several values of a cell combine: first, count, distinct, sum, avg, min, max, median")
+	outputFile := fs.String("output", "", "Output file (default: <input>_pivoted)")
+	fs.StringVar(outputFile, "o", "", "Shorthand for -output")
+	input := inputFlags(fs)
+	output := &OutputOptions{}
+	fs.StringVar(&output.Format, "format", "same", "Output format: same, csv, sqlite, ods, md (Markdown table), html")
+	fs.BoolVar(&output.QuoteAll, "quote-all", false, "Quote every field of CSV output")
+	var locale common.Locale
+	localeFlag(fs, &locale)
+
+	// Parse flags
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	// Handle positional argument for filename
+	if *inputFile == "" && fs.NArg() > 0 {
+		*inputFile = fs.Arg(0)
+	}
+
+	// Validation
+	if *inputFile == "" {
+		return fmt.Errorf("input file is required")
+	}
+	if *index == "" || *columns == "" {
+		return fmt.Errorf("-index and -columns are required")
+	}
+	if *values == "" && *agg != "count" {
+		return fmt.Errorf("-values is required unless -agg is count")
+	}
+	if !aggregateFuncs[*agg] {
+		return fmt.Errorf("invalid aggregate '%s'", *agg)
+	}
+	toStdout, err := useStdout(*inputFile, outputFile, *output)
+	if err != nil {
+		return err
+	}
+	if *outputFile == "" {
+		*outputFile = suffixedOutputFile(*inputFile, output.Format, "_pivoted")
+	}
+	if *outputFile == *inputFile && *inputFile != stdioName {
+		return fmt.Errorf("output would overwrite the input %s", *inputFile)
+	}
+
+	fmt.Printf("Loading %s...\n", *inputFile)
+	headers, rows, err := loadInputFile(*inputFile, *input)
+	if err != nil {
+		return fmt.Errorf("error loading input: %v", err)
+	}
+	indexColumns, err := columnIndexes(headers, *index)
+	if err != nil {
+		return err
+	}
+	pivotColumn := indexOf(headers, strings.TrimSpace(*columns))
+	if pivotColumn == -1 {
+		return fmt.Errorf("column '%s' not found", *columns)
+	}
+	spec := *agg
+	if *values != "" {
+		spec = fmt.Sprintf("%s(%s)", *agg, strings.TrimSpace(*values))
+	}
+	aggs, err := parseAggregations(spec, headers, rows, locale)
+	if err != nil {
+		return err
+	}
+
+	outHeaders, outRows, multiple := pivotRows(headers, rows, indexColumns, pivotColumn, aggs[0], locale)
+	fmt.Printf("Pivoted %d rows into %d rows and %d value columns\n", len(rows), len(outRows), len(outHeaders)-len(indexColumns))
+	if multiple > 0 && *agg == "first" {
+		warnf("%d cells had several values and kept the first one (use -agg to combine them)", multiple)
+	}
+
+	if err := saveOutputTable(*outputFile, outHeaders, outRows, nil, *output); err != nil {
+		return fmt.Errorf("error saving output: %v", err)
+	}
+	if !toStdout {
+		fmt.Printf("Output saved to: %s\n", *outputFile)
+	}
+	return nil
+}
+
+// pivotRows builds the wide table: the index columns, then a column per
+// value of the pivot column, both in order of first appearance. It also
+// returns how many cells combined several rows.
+func pivotRows(headers []string, rows [][]string, indexColumns []int, pivotColumn int, a aggregation, locale common.Locale) ([]string, [][]string, int) {
+	var keys, pivots []string
+	cells := make(map[string]map[string][]int)
+	for r, row := range rows {
+		parts := make([]string, len(indexColumns))
+		for i, c := range indexColumns {
+			parts[i] = cell(row, c)
+		}
+		key := strings.Join(parts, "\x00")
+		if cells[key] == nil {
+			cells[key] = make(map[string][]int)
+			keys = append(keys, key)
+		}
+		pivot := cell(row, pivotColumn)
+		if !slices.Contains(pivots, pivot) {
+			pivots = append(pivots, pivot)
+		}
+		cells[key][pivot] = append(cells[key][pivot], r)
+	}
+
+	var outHeaders []string
+	for _, c := range indexColumns {
+		outHeaders = append(outHeaders, headers[c])
+	}
+	for _, pivot := range pivots {
+		if pivot == "" {
+			pivot = emptyValueLabel
+		}
+		name := pivot
+		for indexOf(outHeaders, name) != -1 {
+			name += "_" + a.fn
+		}
+		outHeaders = append(outHeaders, name)
+	}
+
+	multiple := 0
+	outRows := make([][]string, 0, len(keys))
+	for _, key := range keys {
+		out := strings.Split(key, "\x00")
+		for _, pivot := range pivots {
+			members := cells[key][pivot]
+			if len(members) > 1 {
+				multiple++
+			}
+			value := ""
+			if len(members) > 0 {
+				value = a.apply(rows, members, locale)
+			}
+			out = append(out, value)
+		}
+		outRows = append(outRows, out)
+	}
+	return outHeaders, outRows, multiple
+}
+
+// RunUnpivot handles the unpivot command: it melts a wide table, such as a
+// cross-tab, into a long one with a row per id and value column
+func RunUnpivot(args []string) error {
+	fs := flag.NewFlagSet("unpivot", flag.ExitOnError)
+
+	// Define flags
+	inputFile := fs.String("input", "", "Input file (CSV, Excel or JSON)")
+	id := fs.String("id", "", "Comma-separated columns kept on every output row (required)")
+	valueColumns := fs.String("value-columns", "", "Comma-separated columns to melt (default: every column not in -id)")
+	keyName := fs.String("key-name", "variable", "Name of the output column holding the melted column names")
+	valueName := fs.String("value-name", "value", "Name of the output column holding the values")
+	dropEmpty := fs.Bool("drop-empty", false, "Skip empty values")
+	outputFile := fs.String("output", "", "Output file (default: <input>_unpivoted)")
+	fs.StringVar(outputFile, "o", "", "Shorthand for -output")
+	input := inputFlags(fs)
+	output := &OutputOptions{}
+	fs.StringVar(&output.Format, "format", "same", "Output format: same, csv, sqlite, ods, md (Markdown table), html")
+	fs.BoolVar(&output.QuoteAll, "quote-all", false, "Quote every field of CSV output")
+
+	// Parse flags
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	// Handle positional argument for filename
+	if *inputFile == "" && fs.NArg() > 0 {
+		*inputFile = fs.Arg(0)
+	}
+
+	// Validation
+	if *inputFile == "" {
+		return fmt.Errorf("input file is required")
+	}
+	if *id == "" {
+		return fmt.Errorf("-id is required")
+	}
+	toStdout, err := useStdout(*inputFile, outputFile, *output)
+	if err != nil {
+		return err
+	}
+	if *outputFile == "" {
+		*outputFile = suffixedOutputFile(*inputFile, output.Format, "_unpivoted")
+	}
+	if *outputFile == *inputFile && *inputFile != stdioName {
+		return fmt.Errorf("output would overwrite the input %s", *inputFile)
+	}
+
+	fmt.Printf("Loading %s...\n", *inputFile)
+	headers, rows, err := loadInputFile(*inputFile, *input)
+	if err != nil {
+		return fmt.Errorf("error loading input: %v", err)
+	}
+	idColumns, err := columnIndexes(headers, *id)
+	if err != nil {
+		return err
+	}
+	var melted []int
+	if strings.TrimSpace(*valueColumns) != "" {
+		if melted, err = columnIndexes(headers, *valueColumns); err != nil {
+			return err
+		}
+	} else {
+		for c := range headers {
+			if !slices.Contains(idColumns, c) {
+				melted = append(melted, c)
+			}
+		}
+	}
+	if len(melted) == 0 {
+		return fmt.Errorf("no columns to unpivot")
+	}
+
+	var outHeaders []string
+	for _, c := range idColumns {
+		outHeaders = append(outHeaders, headers[c])
+	}
+	outHeaders = append(outHeaders, *keyName, *valueName)
+	for i, name := range outHeaders {
+		if indexOf(outHeaders, name) != i {
+			return fmt.Errorf("column '%s' would appear twice (use -key-name or -value-name)", name)
+		}
+	}
+
+	var outRows [][]string
+	for _, row := range rows {
+		for _, c := range melted {
+			value := cell(row, c)
+			if *dropEmpty && common.IsNull(value) {
+				continue
+			}
+			out := make([]string, 0, len(outHeaders))
+			for _, i := range idColumns {
+				out = append(out, cell(row, i))
+			}
+			outRows = append(outRows, append(out, headers[c], value))
+		}
+	}
+	fmt.Printf("Unpivoted %d rows and %d columns into %d rows\n", len(rows), len(melted), len(outRows))
+
+	if err := saveOutputTable(*outputFile, outHeaders, outRows, nil, *output); err != nil {
+		return fmt.Errorf("error saving output: %v", err)
+	}
+	if !toStdout {
+		fmt.Printf("Output saved to: %s\n", *outputFile)
+	}
+	return nil
+}
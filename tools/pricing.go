@@ -0,0 +1,162 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"github.com/openai/openai-go"
+)
+
+// modelPrice is what a model costs in dollars per million tokens. Cached
+// input tokens use CachedInput when set, and Input otherwise.
+type modelPrice struct {
+	Input       float64 `json:"input" yaml:"input"`
+	CachedInput float64 `json:"cached_input,omitempty" yaml:"cached_input"`
+	Output      float64 `json:"output" yaml:"output"`
+}
+
+// modelPrices lists the standard prices of OpenAI models. Dated snapshots,
+// e.g. gpt-4o-2024-08-06, use the price of their model. The file named by
+// pricingEnv adds models or overrides prices.
+var modelPrices = map[string]modelPrice{
+	"gpt-5":                  {Input: 1.25, CachedInput: 0.125, Output: 10.00},
+	"gpt-5-mini":             {Input: 0.25, CachedInput: 0.025, Output: 2.00},
+	"gpt-5-nano":             {Input: 0.05, CachedInput: 0.005, Output: 0.40},
+	"gpt-4.1":                {Input: 2.00, CachedInput: 0.50, Output: 8.00},
+	"gpt-4.1-mini":           {Input: 0.40, CachedInput: 0.10, Output: 1.60},
+	"gpt-4.1-nano":           {Input: 0.10, CachedInput: 0.025, Output: 0.40},
+	"gpt-4o":                 {Input: 2.50, CachedInput: 1.25, Output: 10.00},
+	"gpt-4o-mini":            {Input: 0.15, CachedInput: 0.075, Output: 0.60},
+	"o1":                     {Input: 15.00, CachedInput: 7.50, Output: 60.00},
+	"o1-mini":                {Input: 1.10, CachedInput: 0.55, Output: 4.40},
+	"o3":                     {Input: 2.00, CachedInput: 0.50, Output: 8.00},
+	"o3-mini":                {Input: 1.10, CachedInput: 0.55, Output: 4.40},
+	"o4-mini":                {Input: 1.10, CachedInput: 0.275, Output: 4.40},
+	"gpt-4-turbo":            {Input: 10.00, Output: 30.00},
+	"gpt-4":                  {Input: 30.00, Output: 60.00},
+	"gpt-3.5-turbo":          {Input: 0.50, Output: 1.50},
+	"text-embedding-3-small": {Input: 0.02},
+	"text-embedding-3-large": {Input: 0.13},
+	"text-embedding-ada-002": {Input: 0.10},
+}
+
+// pricingEnv names a JSON file of model prices, e.g.
+// {"gpt-4o-mini": {"input": 0.15, "output": 0.60}}, loaded with the API key
+// (it can be set in .env)
+const pricingEnv = "AI_TOOL_PRICING"
+
+// loadPricingOverrides merges the prices of the file named by pricingEnv, if
+// set, into the pricing table
+func loadPricingOverrides() error {
+	file := strings.TrimSpace(os.Getenv(pricingEnv))
+	if file == "" {
+		return nil
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("error reading %s file: %v", pricingEnv, err)
+	}
+	var prices map[string]modelPrice
+	if err := json.Unmarshal(data, &prices); err != nil {
+		return fmt.Errorf("invalid %s file %s: %v", pricingEnv, file, err)
+	}
+	for model, price := range prices {
+		modelPrices[model] = price
+	}
+	return nil
+}
+
+// priceFor returns the price of a model: its own, or that of the longest
+// model name it extends with a "-" suffix. Unknown models are priced as the
+// default model and reported with false.
+func priceFor(model string) (modelPrice, bool) {
+	if price, ok := modelPrices[model]; ok {
+		return price, true
+	}
+	best := ""
+	for name := range modelPrices {
+		if strings.HasPrefix(model, name+"-") && len(name) > len(best) {
+			best = name
+		}
+	}
+	if best == "" {
+		return modelPrices[defaultModel], false
+	}
+	return modelPrices[best], true
+}
+
+// warnUnpricedModels tells which generated columns use a model missing from
+// the pricing table
+func warnUnpricedModels(config *ProcessingConfig) {
+	for _, group := range groupColumnsByModel(config) {
+		if _, ok := priceFor(group.Model); !ok {
+			warnf("no price known for model %s; its cost is counted at %s prices (add it with %s)", group.Model, defaultModel, pricingEnv)
+		}
+	}
+}
+
+// TokenUsage is the tokens used by API calls and what they cost
+type TokenUsage struct {
+	InputTokens  int64
+	OutputTokens int64
+	Cost         float64 // dollars, from the model pricing table
+}
+
+// Total returns the input and output tokens together
+func (u TokenUsage) Total() int64 {
+	return u.InputTokens + u.OutputTokens
+}
+
+// add adds the usage of another call
+func (u *TokenUsage) add(other TokenUsage) {
+	u.InputTokens += other.InputTokens
+	u.OutputTokens += other.OutputTokens
+	u.Cost += other.Cost
+}
+
+// chatUsage prices the usage reported for a chat completion by a model
+func chatUsage(model string, usage openai.CompletionUsage) TokenUsage {
+	price, _ := priceFor(model)
+	cachedPrice := price.CachedInput
+	if cachedPrice == 0 {
+		cachedPrice = price.Input
+	}
+	cached := usage.PromptTokensDetails.CachedTokens
+	return TokenUsage{
+		InputTokens:  usage.PromptTokens,
+		OutputTokens: usage.CompletionTokens,
+		Cost: (float64(usage.PromptTokens-cached)*price.Input + float64(cached)*cachedPrice +
+			float64(usage.CompletionTokens)*price.Output) / 1000000,
+	}
+}
+
+// embeddingUsage prices the tokens of an embedding request
+func embeddingUsage(model string, tokens int64) TokenUsage {
+	price, _ := priceFor(model)
+	return TokenUsage{InputTokens: tokens, Cost: float64(tokens) * price.Input / 1000000}
+}
+
+// addUsage counts the usage of a row or call in the stats
+func (stats *ProcessingStats) addUsage(u TokenUsage) {
+	atomic.AddInt64(&stats.TotalTokens, u.Total())
+	atomic.AddInt64(&stats.InputTokens, u.InputTokens)
+	atomic.AddInt64(&stats.OutputTokens, u.OutputTokens)
+	atomic.AddInt64(&stats.costNanos, int64(u.Cost*1e9+0.5))
+}
+
+// usage returns the tokens used so far and their cost
+func (stats *ProcessingStats) usage() TokenUsage {
+	return TokenUsage{
+		InputTokens:  atomic.LoadInt64(&stats.InputTokens),
+		OutputTokens: atomic.LoadInt64(&stats.OutputTokens),
+		Cost:         stats.Cost(),
+	}
+}
+
+// Cost returns the cost of the tokens used so far, in dollars
+func (stats *ProcessingStats) Cost() float64 {
+	return float64(atomic.LoadInt64(&stats.costNanos)) / 1e9
+}
@@ -2,18 +2,24 @@ package tools
 
 import (
 	"context"
+	"crypto/ed25519"
 	"encoding/csv"
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"os"
-	"os/signal"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
-	"syscall"
 	"time"
 
+	"ai-general-tool/common"
 
 	"github.com/joho/godotenv"
 	"github.com/openai/openai-go"
@@ -21,6 +27,9 @@ import (
 	"github.com/xuri/excelize/v2"
 )
 
+// defaultModel generates columns when no model is given
+const defaultModel = openai.ChatModelGPT4oMini
+
 // ProcessingTask represents a single row to process
 type ProcessingTask struct {
 	RowIndex int
@@ -29,11 +38,37 @@ type ProcessingTask struct {
 
 // ProcessingResult represents the result of processing a row
 type ProcessingResult struct {
-	RowIndex int
-	RowData  map[string]string // original data
-	Results  map[string]string // new column -> value
-	Error    error
-	Tokens   int
+	RowIndex   int
+	RowData    map[string]string // original data
+	Results    map[string]string // new column -> value
+	Error      error
+	ErrorClass string     // rate_limit, timeout, parse, content_filter, api or other; empty without Error
+	Attempts   int        // times the row's requests were sent, retries included
+	Tokens     int        // Usage.Total()
+	Usage      TokenUsage // tokens by kind and their cost
+}
+
+// ProcessingConfig holds the settings used to process each row
+type ProcessingConfig struct {
+	Client      *openai.Client
+	ColumnSpecs []ColumnSpec
+	Prompt      string
+	Model       string             // default model for columns without their own
+	Knowledge   *KnowledgeBase     // optional reference documents for retrieval
+	Attachment  *AttachmentOptions // optional per-row document
+	WebSearch   *WebSearchOptions  // optional web search tool
+	AssumeYes   bool               // answer yes to confirmation prompts
+	Hidden      map[string]bool    // input columns left out of the row data sent to the model
+	OnEvent     EventHandler       // optional receiver of progress events
+	TokenBudget int64              // optional token budget for BudgetWarning events
+	Quiet       bool               // no console progress output
+	Progress    string             // console progress display: line (default) or bar
+	Deadline    time.Time          // optional: no new rows are started after it
+	Priority    string             // optional column: rows with higher values are processed first
+	Cells       *CellLimitOptions  // optional limits on the cell values sent to the model
+	Strict      bool               // stop the run at the first row that fails
+
+	tuner *workerTuner // concurrency limit of -workers auto
 }
 
 // ProcessingStats tracks overall progress
@@ -43,7 +78,19 @@ type ProcessingStats struct {
 	FailedRows     int32
 	TotalTokens    int64
 	StartTime      time.Time
-	EstimatedCost  float64
+	InputTokens    int64 // prompt tokens, part of TotalTokens
+	OutputTokens   int64 // generated tokens, part of TotalTokens
+	ResumedRows    int32 // completed rows taken from the run journal
+	InFlight       int32 // rows being processed by workers
+	Retries        int64 // API requests retried after a failure or rate limit
+	Workers        int32 // concurrency chosen by -workers auto, 0 otherwise
+	Remaining      []int // rows not processed when the run stopped early, in order
+	Stopped        error // the failed row that stopped a Strict run
+
+	costNanos     int64              // cost in billionths of a dollar, read with Cost
+	progressDrawn bool               // the bar display has been printed
+	progressWidth int                // length of the last plain progress line
+	stop          context.CancelFunc // stops a Strict run, see strictStop
 }
 
 // RunProcessData handles the process-data command
@@ -51,18 +98,53 @@ func RunProcessData(args []string) error {
 	fs := flag.NewFlagSet("process-data", flag.ExitOnError)
 
 	// Define flags
-	inputFile := fs.String("input", "", "Input file (CSV or Excel)")
+	inputFile := fs.String("input", "", "Input file (CSV, Excel or JSON)")
 	outputFile := fs.String("output", "", "Output file (optional, defaults to input_enriched)")
 	columns := fs.String("columns", "", "Comma-separated list of new column names")
 	prompt := fs.String("prompt", "", "AI prompt describing what to extract")
 	sampleSize := fs.Int("sample", 5, "Number of rows to test before full processing")
 	batchSize := fs.Int("batch-size", 100, "Save progress every N rows")
-	workers := fs.Int("workers", 10, "Number of parallel workers")
-	sheetIndex := fs.Int("sheet", 1, "Excel sheet number (1-based)")
-	outputFormat := fs.String("format", "same", "Output format: same, csv")
+	workers := fs.String("workers", "10", "Number of parallel workers, or auto to find the fastest number without rate limit errors while processing")
+	input := inputFlags(fs)
+	output := outputFlags(fs)
+	splitFlags(fs, output)
+	outputTemplate := fs.String("output-template", "", "Output file name template, e.g. \"{{.Stem}}_{{.Date}}_{{.Model}}.xlsx\"")
+	knowledgePath := fs.String("knowledge", "", "File or directory of .md/.txt documents used as reference for each row")
+	knowledgeTopK := fs.Int("knowledge-top-k", knowledgeDefaultTopK, "Number of knowledge chunks retrieved per row")
+	model := fs.String("model", defaultModel, "Default model for generated columns (override per column with name@model)")
+	attachmentColumn := fs.String("attachment-column", "", "Column with a txt/md/docx file path whose contents are added to the row's prompt")
+	attachmentMaxChars := fs.Int("attachment-max-chars", 8000, "Maximum characters included from each attachment")
+	attachmentTruncate := fs.String("attachment-truncate", "head", "How to shorten long attachments: head, tail, middle")
+	webSearch := fs.String("web-search", "", "Let the model search the web per row: brave, bing, serpapi")
+	searchBudget := fs.Int("search-budget", 3, "Maximum web searches per row")
+	sourcesColumn := fs.String("sources-column", "sources", "Column receiving the URLs of the search results per row")
+	inputColumns := fs.String("input-columns", "", "Input columns sent to the model: comma-separated names, or 'auto' to pick those relevant to the prompt")
+	maxInputColumns := fs.Int("max-input-columns", columnSelectDefaultMax, "Number of columns kept by -input-columns auto")
+	evalColumn := fs.String("eval-column", "", "Input column with expected labels to score a generated column against (expected or generated=expected)")
+	verifySpec := fs.String("verify-sample", "", "Have a stronger model review a random sample of the results, e.g. 5% or 50")
+	verifyModel := fs.String("verify-model", defaultVerifyModel, "Model reviewing the -verify-sample rows")
+	normalize := fs.String("normalize", "", "After processing, make values consistent in these generated columns (comma-separated or 'all')")
+	rowHash := fs.Bool("row-hash", false, "Add a _row_hash column with a hash of each row's original input values")
+	signKey := fs.String("sign-key", "", "Write a signed manifest next to the output, using this ed25519 key file (created if missing)")
+	timeBudget := fs.Duration("time-budget", 0, "Stop starting new rows after this long, e.g. 30m, and save what is done")
+	priority := fs.String("priority", "", "Column whose highest values are processed first (useful with -time-budget)")
+	where := fs.String("where", "", "Only process the rows matching an expression, e.g. \"status == 'open'\"; the other rows are left out of the output")
+	var locale common.Locale
+	localeFlag(fs, &locale)
+	assumeYes := fs.Bool("yes", false, "Skip confirmation prompts (sample, rollout stages, output preview)")
+	rollout := fs.String("rollout", "", "Process in growing stages with a review between each, e.g. 1%,10%,100%")
+	perFile := fs.Bool("per-file", false, "With a glob or .zip input, process each file separately into its own output")
+	push := fs.Bool("push", false, "Write generated columns back to the source (hubspot:, salesforce:, zendesk:, intercom:, gsheet: inputs)")
+	resume := fs.Bool("resume", false, "Continue an interrupted run: rows already done in the output's run journal are not processed again")
+	progress := fs.String("progress", progressLine, "Progress display: line, bar (status block with a progress bar) or none")
+	stream := fs.Bool("stream", false, "Write rows to the CSV output as they finish instead of holding the enriched dataset in memory")
+	var cells CellLimitOptions
+	cellLimitFlags(fs, &cells)
+	var failure FailureOptions
+	failureFlags(fs, &failure)
 
 	// Parse flags
-	if err := fs.Parse(args); err != nil {
+	if err := parseFlags(fs, args); err != nil {
 		return err
 	}
 
@@ -81,105 +163,542 @@ func RunProcessData(args []string) error {
 	if *prompt == "" {
 		return fmt.Errorf("AI prompt is required")
 	}
-
-	// Load API key
-	if err := godotenv.Load(".env"); err != nil {
-		fmt.Printf("Warning: .env file not found: %v\n", err)
+	if *push && !isConnectorSource(*inputFile) {
+		return fmt.Errorf("-push requires a hubspot:, salesforce:, zendesk:, intercom: or gsheet: input")
 	}
-
-	apiKey := os.Getenv("OPENAI_API_KEY")
-	if apiKey == "" {
-		return fmt.Errorf("OPENAI_API_KEY not found in environment")
+	if *perFile {
+		if !isMultiInput(*inputFile) || isConnectorSource(*inputFile) || isDatabaseSource(*inputFile) || isCloudURI(*inputFile) {
+			return fmt.Errorf("-per-file requires a glob or .zip input")
+		}
+		if *outputFile != "" {
+			return fmt.Errorf("-per-file writes one output per file; use -output-template instead of -output")
+		}
+		return runPerFile(fs, *inputFile, RunProcessData)
+	}
+	if !progressModes[*progress] {
+		return fmt.Errorf("invalid progress display '%s' (use line, bar or none)", *progress)
+	}
+	if err := cells.check(); err != nil {
+		return err
+	}
+	workerCount, tuner, err := parseWorkers(*workers)
+	if err != nil {
+		return err
+	}
+	if *inputFile == stdioName && !*assumeYes {
+		return fmt.Errorf("reading stdin requires -yes, as confirmation prompts cannot be answered")
+	}
+	toStdout, err := useStdout(*inputFile, outputFile, *output)
+	if err != nil {
+		return err
+	}
+	if toStdout && *signKey != "" {
+		return fmt.Errorf("-sign-key needs an output file")
 	}
 
 	// Initialize OpenAI client
-	client := openai.NewClient(option.WithAPIKey(apiKey))
+	client, err := newOpenAIClient()
+	if err != nil {
+		return err
+	}
 
 	// Parse column specifications
 	columnSpecs := parseColumnSpecs(*columns)
 
+	config := &ProcessingConfig{
+		Client:      client,
+		ColumnSpecs: columnSpecs,
+		Prompt:      *prompt,
+		Model:       *model,
+		AssumeYes:   *assumeYes,
+		Progress:    *progress,
+		Quiet:       *progress == progressNone,
+		Cells:       &cells,
+		Strict:      failure.Strict,
+		tuner:       tuner,
+	}
+
+	if *attachmentColumn != "" {
+		if !attachmentStrategies[*attachmentTruncate] {
+			return fmt.Errorf("invalid attachment truncation '%s' (use head, tail or middle)", *attachmentTruncate)
+		}
+		config.Attachment = &AttachmentOptions{
+			Column:   *attachmentColumn,
+			MaxChars: *attachmentMaxChars,
+			Strategy: *attachmentTruncate,
+			BaseDir:  filepath.Dir(*inputFile),
+		}
+	}
+
+	if *webSearch != "" {
+		newSearcher, ok := webSearchers[*webSearch]
+		if !ok {
+			return fmt.Errorf("unknown web search provider '%s' (use brave, bing or serpapi)", *webSearch)
+		}
+		searcher, err := newSearcher()
+		if err != nil {
+			return err
+		}
+		for _, spec := range config.ColumnSpecs {
+			if spec.Name == *sourcesColumn {
+				return fmt.Errorf("sources column '%s' is also a generated column", *sourcesColumn)
+			}
+		}
+		config.WebSearch = &WebSearchOptions{
+			Searcher:      searcher,
+			Budget:        *searchBudget,
+			SourcesColumn: *sourcesColumn,
+		}
+		config.ColumnSpecs = append(config.ColumnSpecs, ColumnSpec{Name: *sourcesColumn, DataType: "string", Local: true})
+	}
+
+	if *rowHash {
+		config.ColumnSpecs = append(config.ColumnSpecs, ColumnSpec{Name: rowHashColumn, DataType: "string", Local: true})
+	}
+	config.ColumnSpecs = append(config.ColumnSpecs, statusColumnSpecs()...)
+	var signingKey ed25519.PrivateKey
+	if *signKey != "" {
+		if signingKey, err = loadSigningKey(*signKey); err != nil {
+			return err
+		}
+	}
+
+	var normalizeIdx []int
+	if *normalize != "" {
+		if normalizeIdx, err = selectNormalizeColumns(*normalize, config.ColumnSpecs); err != nil {
+			return err
+		}
+	}
+
+	if *verifySpec != "" {
+		if _, err := parseSampleCount(*verifySpec, 1); err != nil {
+			return err
+		}
+	}
+
+	// Embed reference documents
+	if *knowledgePath != "" {
+		fmt.Printf("Embedding knowledge from %s...\n", *knowledgePath)
+		kb, err := loadKnowledgeBase(context.Background(), client, *knowledgePath, *knowledgeTopK)
+		if err != nil {
+			return fmt.Errorf("error loading knowledge: %v", err)
+		}
+		fmt.Printf("Embedded %d knowledge chunks (%d tokens, $%.4f)\n", len(kb.Chunks), kb.Tokens, embeddingUsage(knowledgeEmbedModel, kb.Tokens).Cost)
+		config.Knowledge = kb
+	}
+
+	if output.Table == "" && input.Table != "" {
+		output.Table = input.Table + "_enriched"
+	}
+
 	// Determine output file name
+	if *outputFile == "" && *outputTemplate != "" {
+		name, err := renderOutputTemplate(*outputTemplate, newOutputNameData("process-data", *inputFile, output.Format, config.Model, config.ColumnSpecs))
+		if err != nil {
+			return err
+		}
+		*outputFile = name
+	}
 	if *outputFile == "" {
-		ext := ".xlsx"
-		if *outputFormat == "csv" || strings.HasSuffix(*inputFile, ".csv") {
-			ext = ".csv"
+		*outputFile = defaultOutputFile(*inputFile, output.Format)
+	}
+	if *outputFile, err = output.compressedName(*outputFile); err != nil {
+		return err
+	}
+	checkpointFile := *outputFile
+	if toStdout || isCloudURI(*outputFile) {
+		checkpointFile = ""
+	}
+	if isCloudURI(*outputFile) && signingKey != nil {
+		return fmt.Errorf("-sign-key needs a local output file")
+	}
+	if (output.SplitBy != "" || output.SplitSize > 0) && signingKey != nil {
+		return fmt.Errorf("-sign-key needs a single output file; it cannot be used with -split-by or -split-size")
+	}
+	if *stream {
+		switch {
+		case isCloudURI(*outputFile) || !isCSVFile(*outputFile) && *outputFile != stdioName:
+			return fmt.Errorf("-stream writes a local CSV file or stdout; use a .csv or .csv.gz output")
+		case output.Format != "same" && output.Format != "csv":
+			return fmt.Errorf("-stream writes CSV (got -format %s)", output.Format)
+		case *rollout != "" || *normalize != "" || *verifySpec != "" || *evalColumn != "" || *priority != "" || *where != "" || signingKey != nil || *push:
+			return fmt.Errorf("-stream cannot be combined with -rollout, -normalize, -verify-sample, -eval-column, -priority, -where, -sign-key or -push, which need every row at once")
+		case output.SplitBy != "" || output.SplitSize > 0 || output.SheetBy != "":
+			return fmt.Errorf("-stream writes a single CSV file; it cannot be used with -split-by, -split-size or -sheet-by")
+		case isDatabaseSource(*inputFile) && output.Table != "":
+			return fmt.Errorf("-stream cannot write results back to a database table")
 		}
-		base := strings.TrimSuffix(*inputFile, ".csv")
-		base = strings.TrimSuffix(base, ".xlsx")
-		*outputFile = base + "_enriched" + ext
+		checkpointFile = "" // the output itself is the progress
+	}
+	if *resume && checkpointFile == "" {
+		return fmt.Errorf("-resume needs a local output file without -stream; the run journal is kept next to it")
+	}
+	deadLetter := failure.deadLetterFile(*outputFile)
+	if deadLetter != "" && deadLetter == *outputFile {
+		return fmt.Errorf("-dead-letter must differ from the output file")
+	}
+	if deadLetter != "" && *stream && isCloudURI(deadLetter) {
+		return fmt.Errorf("-stream writes the dead-letter file as rows fail; use a local file")
 	}
 
-	// Load input data
-	fmt.Printf("Loading %s...\n", *inputFile)
-	headers, rows, err := loadInputFile(*inputFile, *sheetIndex)
-	if err != nil {
-		return fmt.Errorf("error loading input: %v", err)
+	// The input file's hash lets -resume detect an edited input and records
+	// what the output was made from; it is empty for inputs that are not
+	// local files
+	inputHash, _ := fileSHA256(*inputFile)
+
+	// Load input data. Streamed CSV and Excel inputs are read as they are
+	// processed; only their first rows are read ahead for the sample test.
+	var headers []string
+	var rows [][]string
+	var source rowSource
+	if *stream && canStreamInput(*inputFile) {
+		fmt.Printf("Reading %s...\n", redactSource(*inputFile))
+		inputHeaders, inputSource, closer, err := openStreamInput(*inputFile, *input)
+		if err != nil {
+			return fmt.Errorf("error loading input: %v", err)
+		}
+		defer closer.Close()
+		if rows, err = inputSource.peek(max(*sampleSize, streamPeekRows)); err != nil {
+			return fmt.Errorf("error loading input: %v", err)
+		}
+		headers, source = inputHeaders, inputSource
+	} else {
+		fmt.Printf("Loading %s...\n", redactSource(*inputFile))
+		if headers, rows, err = loadInputFile(*inputFile, *input); err != nil {
+			return fmt.Errorf("error loading input: %v", err)
+		}
+	}
+	// The data rows in the input of the rows kept by -where, for the
+	// dead-letter file
+	var inputRows []int
+	if *where != "" {
+		expr, err := compileRowExpr(*where, headers, locale)
+		if err != nil {
+			return err
+		}
+		if inputRows, err = matchingRows(expr, rows, false); err != nil {
+			return err
+		}
+		kept := make([][]string, len(inputRows))
+		for i, r := range inputRows {
+			kept[i] = rows[r]
+		}
+		fmt.Printf("Rows matching -where: %d of %d (%s)\n", len(kept), len(rows), common.FormatPercentage(len(kept), len(rows)))
+		rows = kept
+	}
+	if err := output.setInput(*inputFile, *input, headers); err != nil {
+		return err
+	}
+	output.routeSheets(*input, *outputFile, headers)
+	if err := checkSplit(*output, *outputFile, headers, config.ColumnSpecs); err != nil {
+		return err
 	}
 
-	fmt.Printf("Loaded %d rows with %d columns\n", len(rows), len(headers))
+	totalRows := len(rows)
+	if source != nil {
+		totalRows = 0 // counted while streaming
+		fmt.Printf("Streaming rows with %d columns\n", len(headers))
+	} else {
+		fmt.Printf("Loaded %d rows with %d columns\n", len(rows), len(headers))
+	}
 
-	// Test on sample first
-	fmt.Println("\n=== TESTING ON SAMPLE ===")
-	if err := testSample(&client, headers, rows, columnSpecs, *prompt, *sampleSize); err != nil {
-		return fmt.Errorf("sample test failed: %v", err)
+	if config.Attachment != nil && indexOf(headers, config.Attachment.Column) == -1 {
+		return fmt.Errorf("attachment column '%s' not found", config.Attachment.Column)
 	}
 
-	// Ask for confirmation
-	fmt.Print("\nProceed with full processing? (y/n): ")
-	var response string
-	fmt.Scanln(&response)
-	if strings.ToLower(response) != "y" {
-		fmt.Println("Processing cancelled.")
-		return nil
+	config.Hidden = make(map[string]bool)
+
+	// Inputs that are dead-letter files of an earlier run keep the status of
+	// their failure, which is not data for the model
+	for _, name := range append([]string{deadLetterRowColumn}, statusColumnNames...) {
+		if indexOf(headers, name) != -1 {
+			config.Hidden[name] = true
+		}
+	}
+
+	// Leave irrelevant columns of wide files out of the prompt
+	if *inputColumns != "" {
+		selected, tokens, err := selectInputColumns(context.Background(), client, *inputColumns, *maxInputColumns, *prompt, headers, rows)
+		if err != nil {
+			return err
+		}
+		for _, header := range headers {
+			config.Hidden[header] = indexOf(selected, header) == -1
+		}
+		fmt.Printf("Sending %d of %d columns to the model: %s\n", len(selected), len(headers), strings.Join(selected, ", "))
+		if tokens > 0 {
+			fmt.Printf("Column selection used %d embedding tokens\n", tokens)
+		}
+	}
+
+	if isDatabaseSource(*inputFile) && output.Key != "" && indexOf(headers, output.Key) == -1 {
+		return fmt.Errorf("output key column '%s' not found", output.Key)
+	}
+
+	if *priority != "" {
+		if indexOf(headers, *priority) == -1 {
+			return fmt.Errorf("priority column '%s' not found", *priority)
+		}
+		config.Priority = *priority
 	}
 
-	// Process full dataset
-	fmt.Println("\n=== PROCESSING FULL DATASET ===")
-	ctx, cancel := context.WithCancel(context.Background())
+	// The expected labels are scored after processing and never shown to the model
+	var eval *evalSpec
+	if *evalColumn != "" {
+		if eval, err = parseEvalSpec(*evalColumn, headers, config.ColumnSpecs); err != nil {
+			return err
+		}
+		config.Hidden[headers[eval.Expected]] = true
+	}
+
+	warnUnpricedModels(config)
+
+	// A progressive rollout replaces the fixed sample test
+	var stages []int
+	if *rollout != "" {
+		stages, err = parseRolloutStages(*rollout, len(rows))
+		if err != nil {
+			return err
+		}
+	} else {
+		// Test on sample first
+		fmt.Println("\n=== TESTING ON SAMPLE ===")
+		sample, err := testSample(config, headers, rows, *sampleSize)
+		if err != nil {
+			return fmt.Errorf("sample test failed: %v", err)
+		}
+		// -workers auto starts small, so its time is projected from there
+		estimateWorkers := workerCount
+		if tuner != nil {
+			estimateWorkers = autoStartWorkers
+		}
+		printRunEstimate(config, sample, totalRows, estimateWorkers)
+
+		// Ask for confirmation
+		if !config.AssumeYes && !confirm("\nProceed with full processing? (y/n): ") {
+			fmt.Println("Processing cancelled.")
+			return nil
+		}
+	}
+
+	ctx, cancel := interruptContext()
 	defer cancel()
 
-	// Handle interrupts gracefully
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
-	go func() {
-		<-sigChan
-		fmt.Println("\n\nInterrupt received. Saving progress...")
-		cancel()
-	}()
+	if *timeBudget > 0 {
+		config.Deadline = time.Now().Add(*timeBudget)
+		fmt.Printf("\nTime budget %s: no new rows are started after %s\n", *timeBudget, config.Deadline.Format("15:04:05"))
+	}
+
+	// Record each finished row in the run journal
+	var journal *runJournal
+	if checkpointFile != "" {
+		if journal, err = openRunJournal(checkpointFile, headers, config.ColumnSpecs, inputHash, *resume); err != nil {
+			return err
+		}
+		if *resume {
+			if err := journal.checkInput(inputHash, rows); err != nil {
+				journal.close()
+				return fmt.Errorf("cannot resume from %s: %v", journal.file, err)
+			}
+			done := 0
+			for i, row := range rows {
+				if _, ok := journal.finished(i, row); ok {
+					done++
+				}
+			}
+			fmt.Printf("\nResuming from %s: %d of %d rows already done\n", journal.file, done, len(rows))
+		}
+	}
 
 	// Process data
-	enrichedRows, stats := processFullDataset(
-		ctx,
-		&client,
-		headers,
-		rows,
-		columnSpecs,
-		*prompt,
-		*workers,
-		*batchSize,
-		*outputFile,
-	)
+	var enrichedRows [][]string
+	var stats *ProcessingStats
+	if *stream {
+		fmt.Println("\n=== STREAMING FULL DATASET ===")
+		if source == nil {
+			source = &sliceSource{rows: rows}
+		}
+		if stats, err = streamDataset(ctx, config, headers, source, totalRows, workerCount, *batchSize, *outputFile, *output, deadLetter); err != nil {
+			return fmt.Errorf("error streaming rows: %v", err)
+		}
+		totalRows = stats.TotalRows
+	} else if stages != nil {
+		fmt.Println("\n=== PROGRESSIVE ROLLOUT ===")
+		enrichedRows, stats = runRollout(ctx, config, headers, rows, stages, workerCount, *batchSize, journal)
+	} else {
+		fmt.Println("\n=== PROCESSING FULL DATASET ===")
+		enrichedRows, stats = processFullDataset(
+			ctx,
+			config,
+			headers,
+			rows,
+			workerCount,
+			*batchSize,
+			journal,
+			0,
+		)
+	}
+	if err := journal.close(); err != nil {
+		warnf("\nrun journal: %v", err)
+	}
+
+	if !config.Deadline.IsZero() && len(stats.Remaining) > 0 && ctx.Err() == nil {
+		fmt.Printf("\nTime budget reached: %d of %d rows processed\n", int(stats.CompletedRows+stats.FailedRows), totalRows)
+	}
+	printRemainingRows(stats.Remaining, totalRows, journal != nil)
+	if stats.Stopped != nil {
+		return fmt.Errorf("stopped by -strict: %v", stats.Stopped)
+	}
+
+	// Map variant spellings to canonical values
+	if *normalize != "" && ctx.Err() == nil {
+		normalizeColumns(ctx, config, headers, enrichedRows, normalizeIdx, stats)
+	}
+
+	if !*stream {
+		fillRowHashes(headers, rows, enrichedRows, config.ColumnSpecs)
+	}
+
+	if eval != nil {
+		printEvaluation(headers, enrichedRows, config.ColumnSpecs, eval)
+	}
+
+	// Estimate the error rate on a reviewed sample
+	if *verifySpec != "" && ctx.Err() == nil {
+		qaFile := suffixedOutputFile(*outputFile, "csv", "_qa")
+		verifyWorkers := workerCount
+		if tuner != nil {
+			verifyWorkers = tuner.workers()
+		}
+		if err := verifySample(ctx, config, headers, enrichedRows, *verifySpec, *verifyModel, verifyWorkers, qaFile, stats); err != nil {
+			warnf("verification failed: %v", err)
+		}
+	}
+
+	// Failed rows are moved to the dead-letter file, so the output only
+	// holds rows that were processed or not started
+	var failedRows [][]string
+	if deadLetter != "" && !*stream {
+		rows, enrichedRows, failedRows = takeFailedRows(headers, rows, enrichedRows, config.ColumnSpecs, inputRows)
+		if len(failedRows) > 0 {
+			fmt.Printf("\n%d failed rows are left out of the output and saved to %s\n", len(failedRows), deadLetter)
+		}
+	}
+	switch {
+	case !*stream:
+		enrichedRows, config.ColumnSpecs = dropStatusColumns(headers, enrichedRows, config.ColumnSpecs)
+	case deadLetter != "":
+		config.ColumnSpecs = withoutStatusColumns(config.ColumnSpecs) // as streamDataset wrote the output
+	}
+
+	// Show what will change and confirm before writing; streamed rows are
+	// already written
+	if !*stream {
+		printOutputDiff(headers, rows, enrichedRows, config.ColumnSpecs)
+		if !config.AssumeYes && !confirm(fmt.Sprintf("\nSave output to %s? (y/n): ", *outputFile)) {
+			fmt.Println("Output not saved.")
+			return nil
+		}
+	}
+
+	// Record how the output was produced
+	runInfo := &RunInfo{
+		Command:       "process-data",
+		Input:         redactSource(*inputFile),
+		InputSHA256:   inputHash,
+		Output:        *outputFile,
+		Prompt:        *prompt,
+		Columns:       runColumns(config, headers),
+		StartedAt:     stats.StartTime,
+		FinishedAt:    time.Now(),
+		Rows:          totalRows,
+		CompletedRows: int(stats.CompletedRows),
+		FailedRows:    int(stats.FailedRows),
+		Tokens:        stats.TotalTokens,
+		InputTokens:   stats.InputTokens,
+		OutputTokens:  stats.OutputTokens,
+		EstimatedCost: stats.Cost(),
+	}
+	if deadLetter != "" && stats.FailedRows > 0 {
+		runInfo.DeadLetter = deadLetter
+	}
 
 	// Save final output
-	fmt.Println("\nSaving final output...")
-	if err := saveOutputFile(*outputFile, headers, enrichedRows, columnSpecs, *outputFormat); err != nil {
-		return fmt.Errorf("error saving output: %v", err)
+	if !*stream {
+		fmt.Println("\nSaving final output...")
+		output.Run = runInfo
+		if err := saveOutputFile(*outputFile, headers, enrichedRows, config.ColumnSpecs, *output); err != nil {
+			return fmt.Errorf("error saving output: %v", err)
+		}
+		if deadLetter != "" {
+			if err := saveDeadLetter(deadLetter, headers, failedRows); err != nil {
+				return fmt.Errorf("error saving failed rows: %v", err)
+			}
+		}
+	}
+	if err := writeRunInfo(*outputFile, runInfo); err != nil {
+		warnf("could not write run info: %v", err)
+	}
+	if signingKey != nil {
+		if err := writeManifest(*outputFile, *inputFile, inputHash, headers, enrichedRows, config.ColumnSpecs, signingKey); err != nil {
+			return fmt.Errorf("error writing manifest: %v", err)
+		}
+		fmt.Printf("Signed manifest saved to: %s\n", *outputFile+manifestSuffix)
 	}
 
 	// Print final statistics
 	printFinalStats(stats)
-	fmt.Printf("\nOutput saved to: %s\n", *outputFile)
+	config.Cells.printSummary()
+	printWorkerTuning(config.tuner)
+	if toStdout {
+		fmt.Println("\nOutput written to stdout")
+	} else {
+		fmt.Printf("\nOutput saved to: %s\n", *outputFile)
+	}
+	if runInfo.DeadLetter != "" {
+		fmt.Printf("Failed rows saved to: %s (%d rows; reprocess them with -input %s)\n", runInfo.DeadLetter, stats.FailedRows, runInfo.DeadLetter)
+	}
+
+	// Upsert the results into a table of the source database
+	if isDatabaseSource(*inputFile) && output.Table != "" {
+		fmt.Printf("\nWriting results to table %s...\n", output.Table)
+		fullHeaders, outRows := mergeGeneratedColumns(headers, enrichedRows, config.ColumnSpecs)
+		if err := writeDatabaseTable(*inputFile, output.Table, output.Key, fullHeaders, outRows); err != nil {
+			return fmt.Errorf("error writing results to database: %v", err)
+		}
+	}
+
+	// Write results back to the source system, unless the run was
+	// interrupted: it is pushed once complete
+	if *push && ctx.Err() != nil {
+		fmt.Println("\nRun interrupted: results not pushed to source; run again to push them")
+	} else if *push {
+		fmt.Println("\nPushing results to source...")
+		if err := pushConnectorResults(*inputFile, headers, enrichedRows, config.ColumnSpecs); err != nil {
+			return fmt.Errorf("error pushing results: %v", err)
+		}
+	}
 
+	// Everything finished is saved, but the run is not complete
+	if ctx.Err() != nil {
+		return fmt.Errorf("interrupted with %d rows not processed", len(stats.Remaining))
+	}
 	return nil
 }
 
-// parseColumnSpecs parses column specifications (with optional type hints)
+// parseColumnSpecs parses column specifications (with optional type hints
+// and models), e.g. "city,score:number@gpt-4o"
 func parseColumnSpecs(columnsStr string) []ColumnSpec {
 	parts := strings.Split(columnsStr, ",")
 	specs := make([]ColumnSpec, len(parts))
 
 	for i, part := range parts {
 		part = strings.TrimSpace(part)
+		model := ""
+		if at := strings.LastIndex(part, "@"); at != -1 {
+			model = strings.TrimSpace(part[at+1:])
+			part = strings.TrimSpace(part[:at])
+		}
 		if strings.Contains(part, ":") {
 			// Has type hint
 			subparts := strings.SplitN(part, ":", 2)
@@ -194,6 +713,7 @@ func parseColumnSpecs(columnsStr string) []ColumnSpec {
 				DataType: "string",
 			}
 		}
+		specs[i].Model = model
 	}
 
 	return specs
@@ -203,68 +723,271 @@ func parseColumnSpecs(columnsStr string) []ColumnSpec {
 type ColumnSpec struct {
 	Name     string
 	DataType string
+	Model    string // overrides the default model when set
+	Local    bool   // filled by the tool itself rather than a model
+}
+
+// modelGroup is a set of columns generated by one model in a single call
+type modelGroup struct {
+	Model string
+	Specs []ColumnSpec
+}
+
+// modelFor returns the model generating the column
+func (config *ProcessingConfig) modelFor(spec ColumnSpec) string {
+	if spec.Model != "" {
+		return spec.Model
+	}
+	if config.Model != "" {
+		return config.Model
+	}
+	return defaultModel
+}
+
+// groupColumnsByModel groups the column specs by the model generating them,
+// keeping the order in which models first appear
+func groupColumnsByModel(config *ProcessingConfig) []modelGroup {
+	var groups []modelGroup
+	index := make(map[string]int)
+	for _, spec := range config.ColumnSpecs {
+		if spec.Local {
+			continue
+		}
+		model := config.modelFor(spec)
+		i, ok := index[model]
+		if !ok {
+			i = len(groups)
+			index[model] = i
+			groups = append(groups, modelGroup{Model: model})
+		}
+		groups[i].Specs = append(groups[i].Specs, spec)
+	}
+	return groups
+}
+
+// defaultOutputFile derives the output file name from the input file name
+func defaultOutputFile(inputFile string, format string) string {
+	return suffixedOutputFile(inputFile, format, "_enriched")
 }
 
-// loadInputFile loads data from CSV or Excel
-func loadInputFile(filename string, sheetIndex int) ([]string, [][]string, error) {
-	if strings.HasSuffix(strings.ToLower(filename), ".csv") {
-		return loadCSV(filename)
+// suffixedOutputFile names an output file after the input with the given
+// suffix, e.g. data.csv -> data_enriched.csv
+func suffixedOutputFile(inputFile string, format string, suffix string) string {
+	return outputStem(inputFile) + suffix + outputExt(inputFile, format)
+}
+
+// outputStem returns the input name without extension; connector inputs are
+// named after the connector and object, e.g. hubspot_contacts
+func outputStem(inputFile string) string {
+	if isConnectorSource(inputFile) {
+		connector, object, _ := strings.Cut(inputFile, ":")
+		object, _, _ = strings.Cut(object, "?")
+		if strings.HasPrefix(inputFile, salesforcePrefix) {
+			object = "query"
+		}
+		if strings.HasPrefix(inputFile, sheetsPrefix) {
+			if input, err := parseSheetsInput(strings.TrimPrefix(inputFile, sheetsPrefix)); err == nil {
+				object = input.ID
+			}
+		}
+		return connector + "_" + object
+	}
+	if isDatabaseSource(inputFile) {
+		return databaseStem(inputFile)
+	}
+	if inputFile == stdioName {
+		return "stdin"
+	}
+	if archive, entry, ok := splitZipEntry(inputFile); ok {
+		return strings.TrimSuffix(archive, zipSuffix) + "_" + strings.TrimSuffix(path.Base(entry), filepath.Ext(entry))
+	}
+	if isMultiInput(inputFile) {
+		return multiInputStem(inputFile)
+	}
+	base := strings.TrimSuffix(strings.TrimPrefix(inputFile, apiSourcePrefix), gzipSuffix)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+// outputExt returns the output file extension for the input and format
+func outputExt(inputFile string, format string) string {
+	switch format {
+	case "csv", "sqlite", "ods", "md", "html":
+		return "." + format
+	}
+	switch {
+	case isCSVFile(inputFile) || isZipFile(inputFile):
+		return ".csv"
+	case isSQLiteFile(inputFile):
+		return ".sqlite"
+	case isODSFile(inputFile):
+		return odsExtension
+	}
+	return ".xlsx"
+}
+
+// OutputOptions controls how output files are written
+type OutputOptions struct {
+	Format    string        // same, csv, sqlite, ods, md, html
+	Mode      outputMode    // full or delta
+	KeyColumn string        // key column kept by delta outputs
+	Table     string        // table written to SQLite outputs or back to a database input
+	Key       string        // key column for upserts into a database table
+	Compress  string        // gzip or none
+	QuoteAll  bool          // quote every field of CSV outputs
+	Formulas  bool          // write generated values that look like formulas to CSV unescaped
+	Workbook  string        // Excel input whose formatting the output keeps
+	Sheet     string        // sheet of Workbook holding the data, by name or number
+	Header    HeaderOptions // header rows of that sheet
+	Run       *RunInfo      // run shown on the Run Info sheet of Excel outputs
+	SplitBy   string        // column whose values get one output file each
+	SplitSize int           // maximum rows per output file
+	SheetBy   string        // column whose values get one sheet each
+	Types     []string      // per column: number, integer, boolean or date values written typed to SQLite and Excel outputs
+}
+
+// outputFlags registers the output flags shared by commands that write
+// enriched files
+func outputFlags(fs *flag.FlagSet) *OutputOptions {
+	opts := &OutputOptions{}
+	fs.StringVar(&opts.Format, "format", "same", "Output format: same, csv, sqlite, ods, md (Markdown table), html")
+	fs.StringVar(&opts.Table, "output-table", "", "Table written for SQLite outputs (default: <input table>_enriched, or enriched), or upserted into the database of a postgres:// or mysql:// input")
+	fs.StringVar(&opts.Key, "output-key", "", "Key column for upserts into a database table (default: first column)")
+	fs.StringVar(&opts.Compress, "compress", "none", "Compress CSV output: gzip, none")
+	fs.BoolVar(&opts.QuoteAll, "quote-all", false, "Quote every field of CSV output")
+	fs.BoolVar(&opts.Formulas, "allow-formulas", false, "Write generated values starting with =, +, - or @ to CSV output as they are (default: prefixed with ' so spreadsheets show them as text instead of running them as formulas)")
+	outputModeFlags(fs, opts)
+	return opts
+}
+
+// InputOptions controls how input files are read
+type InputOptions struct {
+	Sheet      string // Excel sheet name or number (1-based)
+	JSONDepth  int    // levels of nested objects flattened into columns, 0 for all
+	JSONArrays string // how JSON arrays become cells: join, explode, json
+	Table      string // SQLite table to read
+	Query      string // SQLite query to read instead of a table
+	CSV        CSVOptions
+	Excel      ExcelOptions
+	Header     HeaderOptions // header rows of CSV and spreadsheet inputs
+}
+
+// inputFlags registers the input reading flags shared by commands that load
+// arbitrary input files
+func inputFlags(fs *flag.FlagSet) *InputOptions {
+	opts := &InputOptions{}
+	fs.StringVar(&opts.Sheet, "sheet", "1", "Excel sheet: name, number (1-based), or all to combine the sheets with the same columns, adding a "+sourceSheetColumn+" column")
+	fs.IntVar(&opts.JSONDepth, "json-depth", 0, "JSON input: levels of nested objects flattened into columns (0 = all)")
+	fs.StringVar(&opts.JSONArrays, "json-arrays", "json", "JSON input: how arrays are stored: join, explode (one row per element), json")
+	fs.StringVar(&opts.Table, "table", "", "SQLite input: table to read")
+	fs.StringVar(&opts.Query, "query", "", "SQLite input: SELECT query to read instead of a table")
+	csvFlags(fs, &opts.CSV)
+	excelFlags(fs, &opts.Excel)
+	headerFlags(fs, &opts.Header)
+	return opts
+}
+
+// loadInputFile loads data from CSV, Excel (.xlsx, .xls), ODS, JSON, SQLite, a
+// database query, an API source, a connector, an S3/GCS/Azure object, CSV on
+// stdin ("-"), or several files given as a glob or zip archive
+func loadInputFile(filename string, opts InputOptions) ([]string, [][]string, error) {
+	if filename == stdioName {
+		return readCSV(os.Stdin, opts)
+	}
+	if isConnectorSource(filename) {
+		return loadConnectorSource(filename)
+	}
+	if strings.HasPrefix(filename, apiSourcePrefix) {
+		return loadAPISource(strings.TrimPrefix(filename, apiSourcePrefix))
+	}
+	if isDatabaseSource(filename) {
+		return loadDatabaseSource(filename)
+	}
+	if isCloudURI(filename) {
+		return loadCloudInput(filename, opts)
+	}
+	if archive, entry, ok := splitZipEntry(filename); ok {
+		return loadZipEntry(archive, entry, opts)
+	}
+	if isMultiInput(filename) {
+		return loadMultiInput(filename, opts)
+	}
+	switch dataExt(filename) {
+	case ".csv":
+		return loadCSV(filename, opts)
+	case ".json", ".jsonl":
+		return loadJSON(filename, opts)
 	}
-	return loadExcel(filename, sheetIndex)
+	if isSQLiteFile(filename) {
+		return loadSQLite(filename, opts.Table, opts.Query)
+	}
+	if isAllSheets(opts.Sheet) {
+		return loadAllSheets(filename, opts)
+	}
+	if isODSFile(filename) {
+		return loadODS(filename, opts.Sheet, opts.Header)
+	}
+	if isXLSFile(filename) {
+		return loadXLS(filename, opts.Sheet, opts.Header)
+	}
+	return loadExcel(filename, opts)
 }
 
 // loadCSV loads data from a CSV file
-func loadCSV(filename string) ([]string, [][]string, error) {
-	file, err := os.Open(filename)
+func loadCSV(filename string, opts InputOptions) ([]string, [][]string, error) {
+	file, err := openInput(filename)
 	if err != nil {
 		return nil, nil, err
 	}
 	defer file.Close()
 
-	reader := csv.NewReader(file)
-	reader.LazyQuotes = true
-	reader.TrimLeadingSpace = true
+	return readCSV(file, opts)
+}
 
-	allData, err := reader.ReadAll()
+// readCSV reads CSV data with a header row, on the line given by the header
+// options, or without one; the delimiter and quote character are detected
+// unless set
+func readCSV(r io.Reader, opts InputOptions) ([]string, [][]string, error) {
+	fixed, err := opts.CSV.dialect()
 	if err != nil {
 		return nil, nil, err
 	}
+	dialect, r := sniffReader(r, fixed)
+	headers, source, err := opts.Header.readHeader(dialect.rows(r))
+	if err != nil && err != io.EOF {
+		return nil, nil, err
+	}
+	var data [][]string
+	if err == nil {
+		if data, err = readRows(source); err != nil {
+			return nil, nil, err
+		}
+	}
 
-	if len(allData) < 2 {
+	if len(data) == 0 {
 		return nil, nil, fmt.Errorf("file must have headers and at least one data row")
 	}
 
-	return allData[0], allData[1:], nil
+	return headers, data, nil
 }
 
-// loadExcel loads data from an Excel file
-func loadExcel(filename string, sheetIndex int) ([]string, [][]string, error) {
-	f, err := excelize.OpenFile(filename)
+// loadExcel loads data from an Excel file, reading the sheet row by row
+func loadExcel(filename string, opts InputOptions) ([]string, [][]string, error) {
+	_, source, err := openExcelRows(filename, opts.Sheet, opts.Excel)
 	if err != nil {
 		return nil, nil, err
 	}
-	defer f.Close()
-
-	sheets := f.GetSheetList()
-	if sheetIndex < 1 || sheetIndex > len(sheets) {
-		return nil, nil, fmt.Errorf("invalid sheet index %d (file has %d sheets)", sheetIndex, len(sheets))
-	}
+	defer source.Close()
 
-	sheetName := sheets[sheetIndex-1]
-	rows, err := f.GetRows(sheetName)
+	rows, err := readRows(source)
 	if err != nil {
 		return nil, nil, err
 	}
-
-	if len(rows) < 2 {
-		return nil, nil, fmt.Errorf("sheet must have headers and at least one data row")
-	}
-
-	return rows[0], rows[1:], nil
+	return opts.Header.split(rows)
 }
 
-// testSample tests processing on a small sample
-func testSample(client *openai.Client, headers []string, rows [][]string, columnSpecs []ColumnSpec, userPrompt string, sampleSize int) error {
+// testSample tests processing on a small sample and returns what it saw, for
+// the run estimate
+func testSample(config *ProcessingConfig, headers []string, rows [][]string, sampleSize int) (*sampleOutcome, error) {
 	fmt.Printf("Testing on %d sample rows...\n\n", sampleSize)
 
 	// Take sample rows
@@ -274,47 +997,138 @@ func testSample(client *openai.Client, headers []string, rows [][]string, column
 	}
 
 	// Process each sample row
+	outcome := &sampleOutcome{}
+	start := time.Now()
 	for i, row := range sample {
-		rowData := make(map[string]string)
-		for j, header := range headers {
-			if j < len(row) {
-				rowData[header] = row[j]
-			} else {
-				rowData[header] = ""
-			}
-		}
+		rowData := rowToMap(headers, row)
+		outcome.Rows = append(outcome.Rows, rowData)
 
-		result, err := processRow(context.Background(), client, rowData, columnSpecs, userPrompt)
+		result, err := processRow(context.Background(), config, rowData)
 		if err != nil {
 			fmt.Printf("Row %d: ERROR - %v\n", i+1, err)
 			continue
 		}
+		outcome.Results = append(outcome.Results, result.Results)
 
 		fmt.Printf("Row %d:\n", i+1)
 		fmt.Printf("  Input: %v\n", truncateMap(rowData, 50))
 		fmt.Printf("  Output: %v\n", result.Results)
 	}
+	outcome.Elapsed = time.Since(start)
+	config.Cells.reset() // the run processes the sample rows again
 
-	return nil
+	return outcome, nil
 }
 
-// processRow processes a single row using OpenAI
-func processRow(ctx context.Context, client *openai.Client, rowData map[string]string, columnSpecs []ColumnSpec, userPrompt string) (*ProcessingResult, error) {
-	// Build the context for the AI
+// rowDataContext lists the row's values shown to the model, one per line
+func rowDataContext(config *ProcessingConfig, rowData map[string]string) string {
 	var dataContext strings.Builder
 	for key, value := range rowData {
+		if config.Hidden[key] {
+			continue
+		}
 		if value == "" {
 			dataContext.WriteString(fmt.Sprintf("%s: [empty]\n", key))
 		} else {
 			dataContext.WriteString(fmt.Sprintf("%s: %s\n", key, value))
 		}
 	}
+	return dataContext.String()
+}
+
+// rowPrompt builds the system prompt and user message sent for a row, before
+// reference documents and web search are added
+func rowPrompt(config *ProcessingConfig, rowData map[string]string, dataContext string) (string, string, error) {
+	// System prompt
+	systemPrompt := `You are a data processing assistant. You analyze input data and extract or generate the requested information in a structured format.
+Always return valid values for all requested fields. If a value cannot be determined, use "N/A" or an appropriate default.
+Be consistent in your formatting across all rows.`
+
+	// User message combining data and prompt
+	userMessage := fmt.Sprintf("Data:\n%s\n\nTask: %s", dataContext, config.Prompt)
+
+	// Append the row's attached document
+	if config.Attachment != nil {
+		if path := strings.TrimSpace(rowData[config.Attachment.Column]); path != "" {
+			text, err := loadAttachment(path, config.Attachment)
+			if err != nil {
+				return "", "", err
+			}
+			userMessage += fmt.Sprintf("\n\nAttached document (%s):\n%s", filepath.Base(path), text)
+		}
+	}
+
+	return systemPrompt, userMessage, nil
+}
+
+// processRow processes a single row using OpenAI
+func processRow(ctx context.Context, config *ProcessingConfig, rowData map[string]string) (*ProcessingResult, error) {
+	// Shorten oversized cells before they reach the prompt
+	rowData, usage, err := limitRowCells(ctx, config, rowData)
+	if err != nil {
+		return nil, err
+	}
+
+	// Build the context for the AI
+	dataContext := rowDataContext(config, rowData)
+	systemPrompt, userMessage, err := rowPrompt(config, rowData, dataContext)
+	if err != nil {
+		return nil, err
+	}
+
+	// Ground the answer in the most relevant reference documents
+	if config.Knowledge != nil {
+		chunks, tokens, err := config.Knowledge.Retrieve(ctx, config.Client, dataContext)
+		if err != nil {
+			return nil, keepClass(err, fmt.Errorf("knowledge retrieval failed: %v", err))
+		}
+		usage.add(embeddingUsage(knowledgeEmbedModel, tokens))
+
+		var reference strings.Builder
+		for _, chunk := range chunks {
+			reference.WriteString(fmt.Sprintf("[%s]\n%s\n\n", filepath.Base(chunk.Source), chunk.Text))
+		}
+		systemPrompt += "\nUse the reference material provided with the data as the authoritative source. When it defines categories or rules, only use those."
+		userMessage = fmt.Sprintf("Reference material:\n%s%s", reference.String(), userMessage)
+	}
+
+	var search *rowSearch
+	if config.WebSearch != nil {
+		search = newRowSearch(config.WebSearch)
+		systemPrompt += "\nYou can call web_search to look up current information that is not in the data. Only search when the data cannot answer the task."
+	}
+
+	// Generate each model's columns in a single call
+	results := make(map[string]string)
+	for _, group := range groupColumnsByModel(config) {
+		groupResults, groupUsage, err := generateColumns(ctx, config.Client, group, systemPrompt, userMessage, search)
+		usage.add(groupUsage)
+		if err != nil {
+			return nil, err
+		}
+		for name, value := range groupResults {
+			results[name] = value
+		}
+	}
+	if search != nil {
+		results[config.WebSearch.SourcesColumn] = search.provenance()
+	}
+
+	return &ProcessingResult{
+		Results: results,
+		Tokens:  int(usage.Total()),
+		Usage:   usage,
+	}, nil
+}
 
+// extractDataFunction describes the function the model calls with the values
+// of the given columns, for structured output
+func extractDataFunction(specs []ColumnSpec) openai.ChatCompletionNewParamsFunction {
 	// Build JSON schema for structured output
 	properties := make(map[string]interface{})
 	required := make([]string, 0)
 
-	for _, spec := range columnSpecs {
+	for _, spec := range specs {
 		properties[spec.Name] = map[string]interface{}{
 			"type":        "string", // For now, all strings
 			"description": fmt.Sprintf("Value for %s column", spec.Name),
@@ -329,74 +1143,105 @@ func processRow(ctx context.Context, client *openai.Client, rowData map[string]s
 		"additionalProperties": false,
 	}
 
-	// System prompt
-	systemPrompt := `You are a data processing assistant. You analyze input data and extract or generate the requested information in a structured format.
-Always return valid values for all requested fields. If a value cannot be determined, use "N/A" or an appropriate default.
-Be consistent in your formatting across all rows.`
+	return openai.ChatCompletionNewParamsFunction{
+		Name:        "extract_data",
+		Description: openai.String("Extract or generate the requested data fields"),
+		Parameters:  openai.FunctionParameters(schema),
+	}
+}
 
-	// User message combining data and prompt
-	userMessage := fmt.Sprintf("Data:\n%s\n\nTask: %s", dataContext.String(), userPrompt)
-
-	// Call OpenAI with function calling for structured output
-	params := openai.ChatCompletionNewParams{
-		Model: openai.ChatModelGPT4oMini,
-		Messages: []openai.ChatCompletionMessageParamUnion{
-			openai.SystemMessage(systemPrompt),
-			openai.UserMessage(userMessage),
-		},
-		Functions: []openai.ChatCompletionNewParamsFunction{
-			{
-				Name:        "extract_data",
-				Description: openai.String("Extract or generate the requested data fields"),
-				Parameters:  openai.FunctionParameters(schema),
-			},
-		},
-		Temperature: openai.Float(0.3),
-		MaxTokens:   openai.Int(500),
-	}
-
-	completion, err := client.Chat.Completions.New(ctx, params)
-	if err != nil {
-		return nil, err
+// generateColumns asks the group's model for its columns using function
+// calling for structured output. With web search enabled the model may call
+// web_search until the row's budget is spent.
+func generateColumns(ctx context.Context, client *openai.Client, group modelGroup, systemPrompt, userMessage string, search *rowSearch) (map[string]string, TokenUsage, error) {
+	functions := []openai.ChatCompletionNewParamsFunction{extractDataFunction(group.Specs)}
+	if search != nil {
+		functions = append(functions, webSearchFunction())
 	}
 
-	if len(completion.Choices) == 0 {
-		return nil, fmt.Errorf("no response from AI")
+	messages := []openai.ChatCompletionMessageParamUnion{
+		openai.SystemMessage(systemPrompt),
+		openai.UserMessage(userMessage),
+	}
+
+	var usage TokenUsage
+	var choice openai.ChatCompletionChoice
+	for {
+		params := openai.ChatCompletionNewParams{
+			Model:       group.Model,
+			Messages:    messages,
+			Functions:   functions,
+			Temperature: openai.Float(0.3),
+			MaxTokens:   openai.Int(500),
+		}
+		if search != nil && !search.available() {
+			// Budget spent, the model has to answer now
+			params.FunctionCall = openai.ChatCompletionNewParamsFunctionCallUnion{
+				OfFunctionCallOption: &openai.ChatCompletionFunctionCallOptionParam{Name: "extract_data"},
+			}
+		}
+
+		completion, err := client.Chat.Completions.New(ctx, params)
+		if err != nil {
+			return nil, usage, err
+		}
+		usage.add(chatUsage(group.Model, completion.Usage))
+
+		if len(completion.Choices) == 0 {
+			return nil, usage, fmt.Errorf("no response from AI")
+		}
+
+		choice = completion.Choices[0]
+		if choice.FinishReason == "content_filter" {
+			return nil, usage, withClass(errorContentFilter, fmt.Errorf("response blocked by the content filter"))
+		}
+		call := choice.Message.FunctionCall
+		if call.Name != webSearchFunctionName || search == nil || !search.available() {
+			break
+		}
+
+		query, err := parseSearchQuery(call.Arguments)
+		if err != nil {
+			return nil, usage, err
+		}
+		found, err := search.run(ctx, query)
+		if err != nil {
+			return nil, usage, err
+		}
+		messages = append(messages,
+			openai.ChatCompletionMessageParamUnion{OfAssistant: &openai.ChatCompletionAssistantMessageParam{
+				FunctionCall: openai.ChatCompletionAssistantMessageParamFunctionCall{Name: call.Name, Arguments: call.Arguments},
+			}},
+			openai.ChatCompletionMessageParamUnion{OfFunction: &openai.ChatCompletionFunctionMessageParam{
+				Name:    webSearchFunctionName,
+				Content: openai.String(found),
+			}},
+		)
 	}
 
-	choice := completion.Choices[0]
-	if choice.Message.FunctionCall.Name == "" {
-		return nil, fmt.Errorf("no function call in response")
+	if choice.Message.FunctionCall.Name != "extract_data" {
+		return nil, usage, withClass(errorParse, fmt.Errorf("no function call in response"))
 	}
 
 	// Parse the function arguments
 	var results map[string]string
 	if err := json.Unmarshal([]byte(choice.Message.FunctionCall.Arguments), &results); err != nil {
-		return nil, fmt.Errorf("failed to parse AI response: %v", err)
-	}
-
-	tokens := 0
-	if completion.Usage.TotalTokens > 0 {
-		tokens = int(completion.Usage.TotalTokens)
+		return nil, usage, withClass(errorParse, fmt.Errorf("failed to parse AI response: %v", err))
 	}
 
-	return &ProcessingResult{
-		Results: results,
-		Tokens:  tokens,
-	}, nil
+	return results, usage, nil
 }
 
 // processFullDataset processes the entire dataset
 func processFullDataset(
 	ctx context.Context,
-	client *openai.Client,
+	config *ProcessingConfig,
 	headers []string,
 	rows [][]string,
-	columnSpecs []ColumnSpec,
-	userPrompt string,
 	workerCount int,
 	batchSize int,
-	outputFile string,
+	journal *runJournal,
+	offset int,
 ) ([][]string, *ProcessingStats) {
 
 	stats := &ProcessingStats{
@@ -411,43 +1256,71 @@ func processFullDataset(
 	// Create enriched rows (copy of original with space for new columns)
 	enrichedRows := make([][]string, len(rows))
 	for i, row := range rows {
-		enrichedRows[i] = make([]string, len(row)+len(columnSpecs))
+		enrichedRows[i] = make([]string, len(headers)+len(config.ColumnSpecs))
 		copy(enrichedRows[i], row)
 	}
 
-	// Mutex for protecting enrichedRows
-	var rowMutex sync.Mutex
+	// Rows a resumed run already completed keep their journaled values;
+	// the collector marks the others as their results come in
+	finished := make([]bool, len(rows))
+	for i, row := range rows {
+		results, ok := journal.finished(offset+i, row)
+		if !ok {
+			continue
+		}
+		for c, spec := range config.ColumnSpecs {
+			enrichedRows[i][len(headers)+c] = results[spec.Name]
+		}
+		finished[i] = true
+		stats.CompletedRows++
+		stats.ResumedRows++
+	}
+
+	// A strict run stops at the first failed row
+	ctx, stop := stats.withStrictStop(ctx, config)
+	defer stop()
 
 	// Start result collector
 	doneChan := make(chan bool)
-	go collectResults(ctx, resultChan, enrichedRows, headers, columnSpecs, &rowMutex, stats, batchSize, outputFile, doneChan)
+	handled := slices.Clone(finished)
+	go collectResults(config, resultChan, rows, enrichedRows, handled, headers, stats, batchSize, journal, offset, doneChan)
 
-	// Start workers
+	// Start workers; with -workers auto the tuner limits how many are busy
+	defer config.tuner.tune(ctx, stats)()
 	var wg sync.WaitGroup
 	for i := 0; i < workerCount; i++ {
 		wg.Add(1)
-		go processWorker(ctx, client, headers, columnSpecs, userPrompt, taskChan, resultChan, &wg, stats)
+		go processWorker(ctx, config, taskChan, resultChan, &wg, stats)
 	}
 
-	// Send tasks
+	// Send tasks, in priority order when set, until the deadline
 	go func() {
-		for i, row := range rows {
-			rowData := make(map[string]string)
-			for j, header := range headers {
-				if j < len(row) {
-					rowData[header] = row[j]
-				} else {
-					rowData[header] = ""
-				}
+		defer close(taskChan)
+
+		var deadline <-chan time.Time
+		if !config.Deadline.IsZero() {
+			timer := time.NewTimer(time.Until(config.Deadline))
+			defer timer.Stop()
+			deadline = timer.C
+		}
+
+		for _, i := range processingOrder(headers, rows, config.Priority) {
+			if finished[i] {
+				continue
 			}
+			if !config.Deadline.IsZero() && !time.Now().Before(config.Deadline) {
+				return
+			}
+			rowData := rowToMap(headers, rows[i])
 
 			select {
 			case <-ctx.Done():
-				break
+				return
+			case <-deadline:
+				return
 			case taskChan <- ProcessingTask{RowIndex: i, RowData: rowData}:
 			}
 		}
-		close(taskChan)
 	}()
 
 	// Wait for workers to finish
@@ -455,16 +1328,55 @@ func processFullDataset(
 	close(resultChan)
 	<-doneChan
 
+	for i, ok := range handled {
+		if !ok {
+			stats.Remaining = append(stats.Remaining, offset+i)
+		}
+	}
 	return enrichedRows, stats
 }
 
+// processingOrder returns the row indexes in the order they are processed:
+// file order, or by descending priority column value. Numbers sort before
+// text and empty values last.
+func processingOrder(headers []string, rows [][]string, priority string) []int {
+	order := make([]int, len(rows))
+	for i := range order {
+		order[i] = i
+	}
+	col := indexOf(headers, priority)
+	if priority == "" || col == -1 {
+		return order
+	}
+
+	value := func(r int) string {
+		if col < len(rows[r]) {
+			return strings.TrimSpace(rows[r][col])
+		}
+		return ""
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		va, vb := value(order[a]), value(order[b])
+		if (va == "") != (vb == "") {
+			return vb == ""
+		}
+		na, errA := strconv.ParseFloat(va, 64)
+		nb, errB := strconv.ParseFloat(vb, 64)
+		switch {
+		case errA == nil && errB == nil:
+			return na > nb
+		case errA == nil || errB == nil:
+			return errA == nil
+		}
+		return va > vb
+	})
+	return order
+}
+
 // processWorker is a worker goroutine
 func processWorker(
 	ctx context.Context,
-	client *openai.Client,
-	headers []string,
-	columnSpecs []ColumnSpec,
-	userPrompt string,
+	config *ProcessingConfig,
 	taskChan <-chan ProcessingTask,
 	resultChan chan<- ProcessingResult,
 	wg *sync.WaitGroup,
@@ -472,141 +1384,284 @@ func processWorker(
 ) {
 	defer wg.Done()
 
+	// Once ctx is cancelled no new row is started, but the requests of the
+	// row in progress run on until they are abandoned (see requestContext)
+	requestCtx, cancel := requestContext(ctx)
+	defer cancel()
+	requestCtx = withRetryCounter(requestCtx, &stats.Retries)
+
 	for task := range taskChan {
-		select {
-		case <-ctx.Done():
+		if ctx.Err() != nil {
 			return
-		default:
-			result, err := processRow(ctx, client, task.RowData, columnSpecs, userPrompt)
-
-			processingResult := ProcessingResult{
-				RowIndex: task.RowIndex,
-				RowData:  task.RowData,
-			}
+		}
+		config.tuner.acquire()
+		if ctx.Err() != nil {
+			config.tuner.release()
+			return
+		}
+		atomic.AddInt32(&stats.InFlight, 1)
+		var retries int64
+		result, err := processRow(withRowRetries(requestCtx, &retries), config, task.RowData)
+		atomic.AddInt32(&stats.InFlight, -1)
+		config.tuner.release()
+
+		// An abandoned row is not a failure: it stays unprocessed
+		if err != nil && requestCtx.Err() != nil {
+			continue
+		}
 
-			if err != nil {
-				processingResult.Error = err
-				// Put error message in results
-				processingResult.Results = make(map[string]string)
-				for _, spec := range columnSpecs {
-					processingResult.Results[spec.Name] = fmt.Sprintf("ERROR: %v", err)
-				}
-			} else {
-				processingResult.Results = result.Results
-				processingResult.Tokens = result.Tokens
-			}
+		processingResult := ProcessingResult{
+			RowIndex: task.RowIndex,
+			RowData:  task.RowData,
+			Attempts: 1 + int(atomic.LoadInt64(&retries)),
+		}
 
-			resultChan <- processingResult
+		if err != nil {
+			// The generated columns stay empty; the status columns say why
+			processingResult.Error = err
+			processingResult.ErrorClass = classifyError(err)
+			processingResult.Results = make(map[string]string)
+		} else {
+			processingResult.Results = result.Results
+			processingResult.Tokens = result.Tokens
+			processingResult.Usage = result.Usage
 		}
+		setRowStatus(processingResult.Results, processingResult.ErrorClass, err, processingResult.Attempts)
+
+		resultChan <- processingResult
 	}
 }
 
-// collectResults collects and saves results
+// collectResults collects the results into the enriched rows, marking them
+// in handled, and records them in the run journal, which saves them in the
+// background so collection never waits for the disk. It runs until the
+// workers are done, so rows that finish after an interrupt are kept too.
 func collectResults(
-	ctx context.Context,
+	config *ProcessingConfig,
 	resultChan <-chan ProcessingResult,
+	rows [][]string,
 	enrichedRows [][]string,
+	handled []bool,
 	headers []string,
-	columnSpecs []ColumnSpec,
-	rowMutex *sync.Mutex,
 	stats *ProcessingStats,
 	batchSize int,
-	outputFile string,
+	journal *runJournal,
+	offset int,
 	doneChan chan<- bool,
 ) {
 	saveTimer := time.NewTicker(30 * time.Second)
 	defer saveTimer.Stop()
 
 	processedCount := 0
+	savedCount := 0
+	budgetLevel := 0
+	var reportedSaves int64
+
+	// Ask for the rows finished since the last request to be saved, and
+	// report the saves done since then; events are emitted from this
+	// goroutine only
+	checkpoint := func() {
+		if journal == nil {
+			return
+		}
+		if err := journal.takeError(); err != nil {
+			config.emit(ErrorEvent{Progress: stats.progress(), Row: -1, Err: err})
+		}
+		if saves := atomic.LoadInt64(&journal.saves); saves != reportedSaves {
+			reportedSaves = saves
+			config.emit(BatchSaved{Progress: stats.progress(), File: journal.file})
+		}
+		if processedCount != savedCount {
+			journal.save()
+			savedCount = processedCount
+		}
+	}
 
 	for {
 		select {
 		case result, ok := <-resultChan:
 			if !ok {
+				checkpoint()
 				doneChan <- true
 				return
 			}
 
 			// Update enriched rows
-			rowMutex.Lock()
+			handled[result.RowIndex] = true
 			row := enrichedRows[result.RowIndex]
 			startIdx := len(headers)
-			for i, spec := range columnSpecs {
+			for i, spec := range config.ColumnSpecs {
 				if val, ok := result.Results[spec.Name]; ok {
 					row[startIdx+i] = val
 				} else {
 					row[startIdx+i] = ""
 				}
 			}
-			rowMutex.Unlock()
-
-			// Update stats
-			if result.Error == nil {
-				atomic.AddInt32(&stats.CompletedRows, 1)
-				atomic.AddInt64(&stats.TotalTokens, int64(result.Tokens))
-			} else {
-				atomic.AddInt32(&stats.FailedRows, 1)
+
+			if journal != nil {
+				entry := journalRow{
+					Row:      offset + result.RowIndex,
+					Input:    rows[result.RowIndex],
+					Status:   journalDone,
+					Results:  result.Results,
+					Tokens:   result.Tokens,
+					Attempts: result.Attempts,
+				}
+				if result.Error != nil {
+					entry.Status, entry.Error, entry.ErrorClass = journalError, result.Error.Error(), result.ErrorClass
+				}
+				journal.add(entry)
 			}
 
+			recordResult(config, stats, result, &budgetLevel)
+			stats.strictStop(config, result, offset+result.RowIndex)
 			processedCount++
-			printProgress(stats)
 
 			// Save periodically
-			if processedCount%batchSize == 0 {
-				saveProgress(outputFile, headers, enrichedRows, columnSpecs, rowMutex)
+			if batchSize > 0 && processedCount%batchSize == 0 {
+				checkpoint()
 			}
 
 		case <-saveTimer.C:
 			// Periodic save
-			saveProgress(outputFile, headers, enrichedRows, columnSpecs, rowMutex)
-
-		case <-ctx.Done():
-			// Save on interrupt
-			saveProgress(outputFile, headers, enrichedRows, columnSpecs, rowMutex)
-			doneChan <- true
-			return
+			checkpoint()
 		}
 	}
 }
 
-// saveProgress saves current progress to temp file
-func saveProgress(outputFile string, headers []string, enrichedRows [][]string, columnSpecs []ColumnSpec, rowMutex *sync.Mutex) {
-	tempFile := outputFile + ".tmp"
-
-	rowMutex.Lock()
-	defer rowMutex.Unlock()
+// recordResult updates the stats and progress display for a finished row
+// and emits its events, warning as token usage crosses budget levels
+func recordResult(config *ProcessingConfig, stats *ProcessingStats, result ProcessingResult, budgetLevel *int) {
+	if result.Error == nil {
+		atomic.AddInt32(&stats.CompletedRows, 1)
+		stats.addUsage(result.Usage)
+	} else {
+		atomic.AddInt32(&stats.FailedRows, 1)
+	}
 
-	// Build full headers
-	fullHeaders := append(headers, getColumnNames(columnSpecs)...)
+	if !config.Quiet {
+		printProgress(stats, config.Progress)
+	}
 
-	if strings.HasSuffix(outputFile, ".csv") {
-		saveCSV(tempFile, fullHeaders, enrichedRows)
+	if result.Error == nil {
+		config.emit(RowCompleted{Progress: stats.progress(), Row: result.RowIndex, Results: result.Results, Tokens: result.Tokens})
 	} else {
-		saveExcel(tempFile, fullHeaders, enrichedRows)
+		config.emit(ErrorEvent{Progress: stats.progress(), Row: result.RowIndex, Err: result.Error, Class: result.ErrorClass, Attempts: result.Attempts})
+	}
+
+	if config.TokenBudget > 0 {
+		for *budgetLevel < len(budgetWarningLevels) &&
+			float64(atomic.LoadInt64(&stats.TotalTokens)) >= budgetWarningLevels[*budgetLevel]*float64(config.TokenBudget) {
+			config.emit(BudgetWarning{Progress: stats.progress(), Budget: config.TokenBudget, Fraction: budgetWarningLevels[*budgetLevel]})
+			*budgetLevel++
+		}
 	}
 }
 
 // saveOutputFile saves the final output
-func saveOutputFile(outputFile string, headers []string, enrichedRows [][]string, columnSpecs []ColumnSpec, format string) error {
+func saveOutputFile(outputFile string, headers []string, enrichedRows [][]string, columnSpecs []ColumnSpec, opts OutputOptions) error {
+	if isCloudURI(outputFile) {
+		return saveCloudOutput(outputFile, func(local string) error {
+			return saveOutputFile(local, headers, enrichedRows, columnSpecs, opts)
+		})
+	}
+
 	// Build full headers
-	fullHeaders := append(headers, getColumnNames(columnSpecs)...)
+	fullHeaders, outRows := mergeGeneratedColumns(headers, enrichedRows, columnSpecs)
+	if opts.Mode == outputModeDelta {
+		key := opts.KeyColumn
+		if key == "" {
+			key = fullHeaders[0]
+		}
+		if indexOf(fullHeaders, key) == -1 {
+			return fmt.Errorf("key column '%s' not found", key)
+		}
+		fullHeaders, outRows = deltaColumns(fullHeaders, outRows, key, columnSpecs)
+	}
+	if opts.SplitBy != "" || opts.SplitSize > 0 {
+		return saveSplitOutput(outputFile, fullHeaders, outRows, columnSpecs, opts)
+	}
+	return saveOutputTable(outputFile, fullHeaders, outRows, columnSpecs, opts)
+}
+
+// saveOutputTable writes the output table in the format of the output file
+func saveOutputTable(outputFile string, fullHeaders []string, outRows [][]string, columnSpecs []ColumnSpec, opts OutputOptions) error {
+	if outputFile == stdioName {
+		if opts.Format == "md" || opts.Format == "html" {
+			return writeTableDocument(dataStdout, opts.Format, "stdout", fullHeaders, outRows)
+		}
+		return writeCSV(dataStdout, fullHeaders, opts.csvRows(fullHeaders, outRows, columnSpecs), opts.QuoteAll)
+	}
+	if opts.Format == "sqlite" || isSQLiteFile(outputFile) {
+		return saveSQLite(outputFile, opts.Table, fullHeaders, outRows, opts.Types)
+	}
+	if opts.Format == "csv" || isCSVFile(outputFile) {
+		return saveCSV(outputFile, fullHeaders, opts.csvRows(fullHeaders, outRows, columnSpecs), opts.QuoteAll)
+	}
+	if format := tableFormat(outputFile, opts.Format); format != "" {
+		return saveTableDocument(outputFile, format, fullHeaders, outRows)
+	}
+	if opts.Format == "ods" || isODSFile(outputFile) {
+		if opts.SheetBy != "" {
+			return saveRoutedODS(outputFile, fullHeaders, outRows, opts.SheetBy)
+		}
+		return saveODS(outputFile, fullHeaders, outRows)
+	}
+
+	// Failed cells and the run details go to their own sheets
+	var sheets *runSheets
+	if opts.Run != nil {
+		sheets = &runSheets{Info: opts.Run}
+	}
+	if opts.SheetBy != "" {
+		return saveRoutedExcel(outputFile, fullHeaders, outRows, columnSpecs, opts.SheetBy, sheets)
+	}
+	if opts.Workbook != "" && strings.EqualFold(filepath.Ext(outputFile), filepath.Ext(opts.Workbook)) {
+		saved, err := saveIntoWorkbook(opts.Workbook, opts.Sheet, opts.Header, outputFile, fullHeaders, outRows, columnSpecs, sheets)
+		if saved || err != nil {
+			return err
+		}
+		notef("rows no longer match %s; writing a new workbook without its formatting", filepath.Base(opts.Workbook))
+	}
+	sheets.listErrors("Sheet1", fullHeaders, outRows, columnSpecs, 1)
+	return saveExcel(outputFile, fullHeaders, outRows, sheets, opts.Types)
+}
 
-	if format == "csv" || strings.HasSuffix(outputFile, ".csv") {
-		return saveCSV(outputFile, fullHeaders, enrichedRows)
+// csvRows returns the rows of an output table as written to CSV, with
+// generated values that look like formulas escaped unless -allow-formulas
+func (o OutputOptions) csvRows(headers []string, rows [][]string, columnSpecs []ColumnSpec) [][]string {
+	if o.Formulas {
+		return rows
 	}
-	return saveExcel(outputFile, fullHeaders, enrichedRows)
+	return escapeGeneratedFormulas(headers, rows, columnSpecs)
 }
 
-// saveCSV saves data to CSV
-func saveCSV(filename string, headers []string, rows [][]string) error {
-	file, err := os.Create(filename)
+// saveCSV saves data to CSV, gzip-compressed when the name ends in .gz
+func saveCSV(filename string, headers []string, rows [][]string, quoteAll bool) error {
+	if isCloudURI(filename) {
+		return saveCloudOutput(filename, func(local string) error {
+			return saveCSV(local, headers, rows, quoteAll)
+		})
+	}
+
+	file, err := createOutput(filename)
 	if err != nil {
 		return err
 	}
-	defer file.Close()
 
-	writer := csv.NewWriter(file)
-	defer writer.Flush()
+	if err := writeCSV(file, headers, rows, quoteAll); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// writeCSV writes headers and rows as CSV; quoteAll quotes every field
+func writeCSV(w io.Writer, headers []string, rows [][]string, quoteAll bool) error {
+	if quoteAll {
+		return writeQuotedCSV(w, headers, rows)
+	}
+	writer := csv.NewWriter(w)
 
 	// Write headers
 	if err := writer.Write(headers); err != nil {
@@ -620,11 +1675,13 @@ func saveCSV(filename string, headers []string, rows [][]string) error {
 		}
 	}
 
-	return nil
+	writer.Flush()
+	return writer.Error()
 }
 
-// saveExcel saves data to Excel
-func saveExcel(filename string, headers []string, rows [][]string) error {
+// saveExcel saves data to Excel. Columns with a type are written as numbers,
+// booleans or dates instead of text.
+func saveExcel(filename string, headers []string, rows [][]string, sheets *runSheets, types []string) error {
 	f := excelize.NewFile()
 	sheetName := "Sheet1"
 
@@ -638,27 +1695,68 @@ func saveExcel(filename string, headers []string, rows [][]string) error {
 	for i, row := range rows {
 		for j, value := range row {
 			cell := fmt.Sprintf("%s%d", columnIndexToLetter(j), i+2)
+			if j < len(types) {
+				f.SetCellValue(sheetName, cell, typedValue(value, types[j]))
+				continue
+			}
 			f.SetCellValue(sheetName, cell, value)
 		}
 	}
 
+	if err := styleSheet(f, sheetName, headers, rows); err != nil {
+		return err
+	}
+	if err := styleDateColumns(f, sheetName, types, len(rows)); err != nil {
+		return err
+	}
+	if sheets != nil {
+		if err := addRunSheets(f, sheets); err != nil {
+			return err
+		}
+	}
 	return f.SaveAs(filename)
 }
 
 // Helper functions
 
-func getColumnNames(specs []ColumnSpec) []string {
-	names := make([]string, len(specs))
-	for i, spec := range specs {
-		names[i] = spec.Name
+// newOpenAIClient loads the API key and model prices from .env or the
+// environment and creates a client
+func newOpenAIClient() (*openai.Client, error) {
+	if err := godotenv.Load(".env"); err != nil {
+		warnf(".env file not found: %v", err)
+	}
+	if err := loadPricingOverrides(); err != nil {
+		return nil, err
+	}
+
+	opts, keyEnv := activeSettings.clientOptions()
+	apiKey := os.Getenv(keyEnv)
+	if apiKey == "" {
+		return nil, fmt.Errorf("%s not found in environment", keyEnv)
 	}
-	return names
+
+	opts = append([]option.RequestOption{option.WithAPIKey(apiKey), option.WithMiddleware(countRetries)}, opts...)
+	client := openai.NewClient(opts...)
+	return &client, nil
+}
+
+// rowToMap maps the headers to the row's values, padding short rows
+func rowToMap(headers []string, row []string) map[string]string {
+	rowData := make(map[string]string, len(headers))
+	for j, header := range headers {
+		if j < len(row) {
+			rowData[header] = row[j]
+		} else {
+			rowData[header] = ""
+		}
+	}
+	return rowData
 }
 
 func columnIndexToLetter(index int) string {
 	result := ""
 	for index >= 0 {
-		result = string('A'+index%26) + result
+		result = string(rune('A'+index%26)) + result
 		index = index/26 - 1
 	}
 	return result
@@ -676,22 +1774,24 @@ func truncateMap(m map[string]string, maxLen int) map[string]string {
 	return result
 }
 
-func printProgress(stats *ProcessingStats) {
-	completed := atomic.LoadInt32(&stats.CompletedRows)
-	failed := atomic.LoadInt32(&stats.FailedRows)
-	total := stats.TotalRows
-	tokens := atomic.LoadInt64(&stats.TotalTokens)
-
-	percentage := float64(completed+failed) * 100 / float64(total)
-	elapsed := time.Since(stats.StartTime)
-
-	// Estimate cost (GPT-4o-mini pricing)
-	costPerMillion := 0.15  // $0.15 per 1M input tokens
-	costPer1MOutput := 0.60 // $0.60 per 1M output tokens
-	estimatedCost := float64(tokens) / 1000000 * ((costPerMillion + costPer1MOutput) / 2)
+// confirm prints a yes/no question and reports whether the user answered y
+func confirm(question string) bool {
+	fmt.Print(question)
+	var response string
+	fmt.Scanln(&response)
+	return strings.ToLower(response) == "y"
+}
 
-	fmt.Printf("\rProgress: %d/%d (%.1f%%) | Failed: %d | Tokens: %d | Cost: $%.4f | Elapsed: %s",
-		completed, total, percentage, failed, tokens, estimatedCost, elapsed.Round(time.Second))
+// progress returns a snapshot of the stats for events
+func (stats *ProcessingStats) progress() Progress {
+	return Progress{
+		Time:      time.Now(),
+		Completed: int(atomic.LoadInt32(&stats.CompletedRows)),
+		Failed:    int(atomic.LoadInt32(&stats.FailedRows)),
+		Total:     stats.TotalRows,
+		Tokens:    atomic.LoadInt64(&stats.TotalTokens),
+		Cost:      stats.Cost(),
+	}
 }
 
 func printFinalStats(stats *ProcessingStats) {
@@ -699,13 +1799,11 @@ func printFinalStats(stats *ProcessingStats) {
 	fmt.Printf("Total rows processed: %d\n", stats.CompletedRows+stats.FailedRows)
 	fmt.Printf("Successful: %d\n", stats.CompletedRows)
 	fmt.Printf("Failed: %d\n", stats.FailedRows)
-	fmt.Printf("Total tokens used: %d\n", stats.TotalTokens)
-
-	// Calculate final cost
-	costPerMillion := 0.15
-	costPer1MOutput := 0.60
-	estimatedCost := float64(stats.TotalTokens) / 1000000 * ((costPerMillion + costPer1MOutput) / 2)
-	fmt.Printf("Estimated cost: $%.4f\n", estimatedCost)
+	if stats.Retries > 0 {
+		fmt.Printf("Retried requests: %d\n", stats.Retries)
+	}
+	fmt.Printf("Total tokens used: %d (input %d, output %d)\n", stats.TotalTokens, stats.InputTokens, stats.OutputTokens)
+	fmt.Printf("Cost: $%.4f\n", stats.Cost())
 
 	elapsed := time.Since(stats.StartTime)
 	fmt.Printf("Total time: %s\n", elapsed.Round(time.Second))
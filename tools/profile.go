@@ -0,0 +1,407 @@
+package tools
+
+import (
+	"flag"
+	"fmt"
+	"html"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"ai-general-tool/common"
+)
+
+// profileNullMapBuckets is the number of row ranges the null map of a
+// profile report splits the rows into
+const profileNullMapBuckets = 100
+
+// RunProfile handles the profile command: a standalone HTML report of every
+// column with its statistics, a histogram, its top values, a map of missing
+// values and the correlations between numeric columns
+func RunProfile(args []string) error {
+	fs := flag.NewFlagSet("profile", flag.ExitOnError)
+
+	// Define flags
+	inputFile := fs.String("input", "", "Input file (CSV, Excel or JSON)")
+	outputFile := fs.String("output", "", "HTML report file (default: <input>_profile.html)")
+	fs.StringVar(outputFile, "o", "", "Shorthand for -output")
+	columns := fs.String("columns", "", "Comma-separated columns to profile (default: all)")
+	top := fs.Int("top", 10, "Most frequent values listed per column")
+	bins := fs.Int("bins", 20, "Histogram bars per column")
+	charts := profileCharts{}
+	fs.StringVar(&charts.Format, "charts", "svg", "Histogram images: svg (inline, scalable) or png (embedded images, for viewers and mail clients that drop inline SVG)")
+	fs.StringVar(&charts.Dir, "charts-dir", "", "Also save the histogram of each column to this directory as <column>.svg or .png")
+	input := inputFlags(fs)
+	var locale common.Locale
+	localeFlag(fs, &locale)
+
+	// Parse flags
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	// Handle positional argument for filename
+	if *inputFile == "" && fs.NArg() > 0 {
+		*inputFile = fs.Arg(0)
+	}
+
+	if *inputFile == "" {
+		return fmt.Errorf("input file is required")
+	}
+	if *top <= 0 || *bins <= 0 {
+		return fmt.Errorf("-top and -bins must be positive")
+	}
+	if charts.Format != "svg" && charts.Format != "png" {
+		return fmt.Errorf("invalid charts format '%s' (use svg or png)", charts.Format)
+	}
+	if *outputFile == "" {
+		*outputFile = suffixedOutputFile(*inputFile, "html", "_profile")
+	}
+
+	fmt.Printf("Loading %s...\n", *inputFile)
+	headers, rows, err := loadInputFile(*inputFile, *input)
+	if err != nil {
+		return fmt.Errorf("error loading file: %v", err)
+	}
+	indexes, err := columnIndexes(headers, *columns)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Profiling %d rows and %d columns...\n", len(rows), len(indexes))
+
+	report, err := profileReport(*inputFile, headers, rows, indexes, *top, *bins, charts, locale)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(*outputFile, []byte(report), 0644); err != nil {
+		return fmt.Errorf("error saving report: %v", err)
+	}
+	fmt.Printf("Report saved to: %s\n", *outputFile)
+	if charts.Dir != "" {
+		fmt.Printf("Charts saved to: %s\n", charts.Dir)
+	}
+	return nil
+}
+
+// valueCount is a distinct value of a column and how many rows have it
+type valueCount struct {
+	Value string
+	Count int
+}
+
+// valueCounts counts the distinct values, most frequent first and equal
+// counts in value order
+func valueCounts(values []string) []valueCount {
+	counts := make(map[string]int)
+	for _, value := range values {
+		counts[value]++
+	}
+	sorted := make([]valueCount, 0, len(counts))
+	for value, count := range counts {
+		sorted = append(sorted, valueCount{value, count})
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Count != sorted[j].Count {
+			return sorted[i].Count > sorted[j].Count
+		}
+		return sorted[i].Value < sorted[j].Value
+	})
+	return sorted
+}
+
+// histogram counts values in bins of equal width between the smallest and the
+// largest value. It returns the lower edge of every bin and an extra upper
+// edge, and the counts.
+func histogram(values []float64, bins int) ([]float64, []int) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+	low, high := values[0], values[0]
+	for _, v := range values {
+		low, high = math.Min(low, v), math.Max(high, v)
+	}
+	if low == high {
+		return []float64{low, high}, []int{len(values)}
+	}
+	width := (high - low) / float64(bins)
+	edges := make([]float64, bins+1)
+	for i := range edges {
+		edges[i] = low + float64(i)*width
+	}
+	counts := make([]int, bins)
+	for _, v := range values {
+		counts[min(int((v-low)/width), bins-1)]++
+	}
+	return edges, counts
+}
+
+// pearson returns the Pearson correlation of the pairs (x[i], y[i]) and the
+// number of pairs. It is NaN for fewer than two pairs or a constant variable.
+func pearson(x, y []float64) (float64, int) {
+	var sx, sy, sxx, syy, sxy float64
+	n := len(x)
+	for i := range x {
+		sx += x[i]
+		sy += y[i]
+		sxx += x[i] * x[i]
+		syy += y[i] * y[i]
+		sxy += x[i] * y[i]
+	}
+	if n < 2 {
+		return math.NaN(), n
+	}
+	cov := sxy - sx*sy/float64(n)
+	vx, vy := sxx-sx*sx/float64(n), syy-sy*sy/float64(n)
+	if vx <= 0 || vy <= 0 {
+		return math.NaN(), n
+	}
+	return cov / math.Sqrt(vx*vy), n
+}
+
+// numericColumn reads every row's value of a column as a number: values and
+// whether each row has one
+func numericColumn(rows [][]string, index int, locale common.Locale) ([]float64, []bool) {
+	values := make([]float64, len(rows))
+	known := make([]bool, len(rows))
+	for r, row := range rows {
+		if value := cell(row, index); !common.IsNull(value) {
+			values[r], known[r] = numericValue(value, locale)
+		}
+	}
+	return values, known
+}
+
+// profileReport renders the HTML report of the given columns
+func profileReport(filename string, headers []string, rows [][]string, indexes []int, top, bins int, charts profileCharts, locale common.Locale) (string, error) {
+	var body strings.Builder
+	stats := make([]columnStats, len(indexes))
+	missing := 0
+	for i, index := range indexes {
+		values := make([]string, len(rows))
+		for r, row := range rows {
+			values[r] = cell(row, index)
+		}
+		stats[i] = describeColumn(headers[index], values, locale)
+		missing += stats[i].Nulls
+	}
+
+	// Overview
+	types := make(map[common.DataType]int)
+	for _, s := range stats {
+		types[s.Type]++
+	}
+	var typeNames []string
+	for t, n := range types {
+		typeNames = append(typeNames, fmt.Sprintf("%s %d", t, n))
+	}
+	sort.Strings(typeNames)
+	seen := make(map[string]bool)
+	duplicates := 0
+	for _, row := range rows {
+		key := strings.Join(row, "\x00")
+		if seen[key] {
+			duplicates++
+		}
+		seen[key] = true
+	}
+	fmt.Fprintf(&body, "<h1>%s</h1>\n", html.EscapeString(filename))
+	fmt.Fprintf(&body, "<p>Profiled %s</p>\n", time.Now().Format("2006-01-02 15:04"))
+	body.WriteString(common.FormatHTMLTable([]string{"Rows", "Columns", "Missing cells", "Duplicate rows", "Types"}, [][]string{{
+		strconv.Itoa(len(rows)),
+		strconv.Itoa(len(indexes)),
+		fmt.Sprintf("%d (%s)", missing, common.FormatPercentage(missing, len(rows)*len(indexes))),
+		fmt.Sprintf("%d (%s)", duplicates, common.FormatPercentage(duplicates, len(rows))),
+		strings.Join(typeNames, ", "),
+	}}))
+	body.WriteString("<h2>Columns</h2>\n")
+	for _, table := range describeTables(stats) {
+		fmt.Fprintf(&body, "<h3>%s</h3>\n%s", table.title, common.FormatHTMLTable(table.headers, table.rows))
+	}
+
+	// One section per column
+	for i, index := range indexes {
+		s := stats[i]
+		fmt.Fprintf(&body, "<h2 id=\"col%d\">%s <small>%s</small></h2>\n", index, html.EscapeString(s.Name), s.Type)
+		body.WriteString("<div class=\"column\">\n<div>\n")
+		title, labels, counts := columnHistogram(s, bins)
+		if len(counts) > 0 {
+			chart, err := charts.histogram(s.Name, labels, counts)
+			if err != nil {
+				return "", err
+			}
+			fmt.Fprintf(&body, "<h4>%s</h4>\n%s", title, chart)
+		}
+		body.WriteString("</div>\n<div>\n")
+		values := make([]string, 0, s.Count)
+		for _, row := range rows {
+			if value := cell(row, index); !common.IsNull(value) {
+				values = append(values, value)
+			}
+		}
+		fmt.Fprintf(&body, "<h4>Top values</h4>\n%s", topValuesTable(valueCounts(values), top, len(rows)))
+		body.WriteString("</div>\n</div>\n")
+	}
+
+	body.WriteString("<h2>Missing values</h2>\n")
+	body.WriteString(svgNullMap(headers, rows, indexes))
+
+	body.WriteString("<h2>Correlations</h2>\n")
+	body.WriteString(correlationHeatmap(headers, rows, indexes, stats, locale))
+
+	return profileDocument(filename, body.String()), nil
+}
+
+// columnHistogram returns the histogram of a column: of its values when
+// numeric, its dates by time, or the lengths of its text
+func columnHistogram(s columnStats, bins int) (string, []string, []int) {
+	switch {
+	case isNumericType(s.Type):
+		edges, counts := histogram(s.Numbers, bins)
+		return "Distribution", rangeLabels(edges, formatStat), counts
+	case s.Type == common.TypeDate:
+		days := make([]float64, len(s.Dates))
+		for i, date := range s.Dates {
+			days[i] = float64(date.Unix()) / 86400
+		}
+		edges, counts := histogram(days, bins)
+		return "Distribution", rangeLabels(edges, func(day float64) string {
+			return formatDate(time.Unix(int64(day*86400), 0).UTC())
+		}), counts
+	}
+	edges, counts := histogram(s.Lengths, bins)
+	return "Length in characters", rangeLabels(edges, formatStat), counts
+}
+
+// rangeLabels labels the bins of a histogram by their range
+func rangeLabels(edges []float64, format func(float64) string) []string {
+	var labels []string
+	for i := 0; i+1 < len(edges); i++ {
+		labels = append(labels, format(edges[i])+" to "+format(edges[i+1]))
+	}
+	return labels
+}
+
+// svgHistogram draws a bar chart of counts, labelled by a tooltip per bar
+// and the range of the first and last bars
+func svgHistogram(labels []string, counts []int) string {
+	const width, height = 420.0, 140.0
+	highest := 0
+	for _, count := range counts {
+		highest = max(highest, count)
+	}
+	barWidth := width / float64(len(counts))
+	var svg strings.Builder
+	fmt.Fprintf(&svg, "<svg width=\"%g\" height=\"%g\" viewBox=\"0 0 %g %g\">\n", width, height+20, width, height+20)
+	for i, count := range counts {
+		h := height * float64(count) / float64(highest)
+		fmt.Fprintf(&svg, "<rect x=\"%.1f\" y=\"%.1f\" width=\"%.1f\" height=\"%.1f\" class=\"bar\"><title>%s: %d</title></rect>\n",
+			float64(i)*barWidth+1, height-h, math.Max(barWidth-2, 1), h, html.EscapeString(labels[i]), count)
+	}
+	first, _, _ := strings.Cut(labels[0], " to ")
+	_, last, _ := strings.Cut(labels[len(labels)-1], " to ")
+	fmt.Fprintf(&svg, "<text x=\"0\" y=\"%g\" class=\"axis\">%s</text>\n", height+15, html.EscapeString(first))
+	fmt.Fprintf(&svg, "<text x=\"%g\" y=\"%g\" class=\"axis\" text-anchor=\"end\">%s</text>\n", width, height+15, html.EscapeString(last))
+	svg.WriteString("</svg>\n")
+	return svg.String()
+}
+
+// topValuesTable lists the most frequent values with their share of the rows
+// as a bar
+func topValuesTable(counts []valueCount, top, rows int) string {
+	if len(counts) == 0 {
+		return "<p>No values</p>\n"
+	}
+	var table strings.Builder
+	table.WriteString("<table>\n<thead><tr><th>Value</th><th>Count</th><th>Share</th></tr></thead>\n<tbody>\n")
+	for _, vc := range counts[:min(top, len(counts))] {
+		share := float64(vc.Count) * 100 / float64(rows)
+		fmt.Fprintf(&table, "<tr><td>%s</td><td>%d</td><td><span class=\"share\" style=\"width:%.0fpx\"></span> %s</td></tr>\n",
+			html.EscapeString(common.TruncateString(vc.Value, 60)), vc.Count, share*1.5, common.FormatPercentage(vc.Count, rows))
+	}
+	table.WriteString("</tbody>\n</table>\n")
+	if len(counts) > top {
+		fmt.Fprintf(&table, "<p>%d more distinct values</p>\n", len(counts)-top)
+	}
+	return table.String()
+}
+
+// svgNullMap draws a row per column, split into ranges of rows shaded by how
+// many of their values are missing, so gaps that start at some point of the
+// file stand out
+func svgNullMap(headers []string, rows [][]string, indexes []int) string {
+	if len(rows) == 0 {
+		return "<p>No rows</p>\n"
+	}
+	buckets := min(profileNullMapBuckets, len(rows))
+	const label, cellWidth, cellHeight = 160.0, 5.0, 14.0
+	var svg strings.Builder
+	width, height := label+float64(buckets)*cellWidth, float64(len(indexes))*cellHeight+20
+	fmt.Fprintf(&svg, "<svg width=\"%g\" height=\"%g\" viewBox=\"0 0 %g %g\">\n", width, height, width, height)
+	for i, index := range indexes {
+		y := float64(i) * cellHeight
+		fmt.Fprintf(&svg, "<text x=\"0\" y=\"%g\" class=\"axis\">%s</text>\n", y+11, html.EscapeString(common.TruncateString(headers[index], 24)))
+		for b := 0; b < buckets; b++ {
+			from, to := b*len(rows)/buckets, (b+1)*len(rows)/buckets
+			nulls := 0
+			for _, row := range rows[from:to] {
+				if common.IsNull(cell(row, index)) {
+					nulls++
+				}
+			}
+			if nulls == 0 {
+				continue
+			}
+			fmt.Fprintf(&svg, "<rect x=\"%g\" y=\"%g\" width=\"%g\" height=\"%g\" class=\"null\" fill-opacity=\"%.2f\"><title>rows %d-%d: %d missing</title></rect>\n",
+				label+float64(b)*cellWidth, y+1, cellWidth, cellHeight-2, 0.2+0.8*float64(nulls)/float64(to-from), from+1, to, nulls)
+		}
+	}
+	fmt.Fprintf(&svg, "<text x=\"%g\" y=\"%g\" class=\"axis\">row 1</text>\n", label, height-4)
+	fmt.Fprintf(&svg, "<text x=\"%g\" y=\"%g\" class=\"axis\" text-anchor=\"end\">row %d</text>\n", width, height-4, len(rows))
+	svg.WriteString("</svg>\n")
+	return svg.String()
+}
+
+// correlationHeatmap renders the Pearson correlations between the numeric
+// columns as a heatmap
+func correlationHeatmap(headers []string, rows [][]string, indexes []int, stats []columnStats, locale common.Locale) string {
+	var numeric []int
+	for i, index := range indexes {
+		if isNumericType(stats[i].Type) {
+			numeric = append(numeric, index)
+		}
+	}
+	if len(numeric) < 2 {
+		return "<p>Fewer than two numeric columns</p>\n"
+	}
+	return numericCorrelations(headers, rows, numeric, "pearson", locale).heatmap() +
+		"<p>Pearson correlation over the rows where both values are numbers.</p>\n"
+}
+
+// profileDocument wraps the report body in a standalone page
+func profileDocument(title, body string) string {
+	return fmt.Sprintf(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Profile: %s</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; vertical-align: top; }
+th { background: #f2f2f2; }
+h2 small { color: #888; font-weight: normal; }
+.column { display: flex; gap: 3em; flex-wrap: wrap; }
+.bar { fill: #4a7fc1; }
+.null { fill: #c14a4a; }
+.axis { font-size: 10px; fill: #555; }
+.share { display: inline-block; height: 10px; background: #4a7fc1; }
+</style>
+</head>
+<body>
+%s</body>
+</html>
+`, html.EscapeString(title), body)
+}
@@ -0,0 +1,101 @@
+package tools
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"html"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Size of the histogram images of a profile report, in pixels
+const (
+	chartImageWidth  = 420
+	chartImageHeight = 140
+)
+
+// chartBarColor is the color of histogram bars, as in the report's CSS
+var chartBarColor = color.RGBA{0x4a, 0x7f, 0xc1, 0xff}
+
+// profileCharts controls the histograms of a profile report: inline SVG or
+// embedded PNG images, and a directory the images are also saved to
+type profileCharts struct {
+	Format string // svg or png
+	Dir    string
+}
+
+// histogram returns the markup of a column's histogram, saving it to the
+// charts directory when there is one
+func (c profileCharts) histogram(column string, labels []string, counts []int) (string, error) {
+	first, _, _ := strings.Cut(labels[0], " to ")
+	_, last, _ := strings.Cut(labels[len(labels)-1], " to ")
+	if c.Format != "png" {
+		svg := svgHistogram(labels, counts)
+		return svg, c.save(column, ".svg", []byte(standaloneSVG(svg)))
+	}
+
+	data, err := pngHistogram(counts)
+	if err != nil {
+		return "", fmt.Errorf("error drawing the histogram of '%s': %v", column, err)
+	}
+	if err := c.save(column, ".png", data); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("<img src=\"data:image/png;base64,%s\" width=\"%d\" height=\"%d\" alt=\"Histogram of %s\">\n<p><small>%s to %s</small></p>\n",
+		base64.StdEncoding.EncodeToString(data), chartImageWidth, chartImageHeight, html.EscapeString(column), html.EscapeString(first), html.EscapeString(last)), nil
+}
+
+// save writes a chart to <dir>/<column><ext>
+func (c profileCharts) save(column, ext string, data []byte) error {
+	if c.Dir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(c.Dir, 0755); err != nil {
+		return fmt.Errorf("error creating charts directory: %v", err)
+	}
+	filename := filepath.Join(c.Dir, fileNamePart(column)+ext)
+	if err := os.WriteFile(filename, data, 0644); err != nil {
+		return fmt.Errorf("error saving chart: %v", err)
+	}
+	return nil
+}
+
+// standaloneSVG makes an inline chart a file of its own: the namespace and
+// the styles it takes from the report's CSS
+func standaloneSVG(svg string) string {
+	open, rest, _ := strings.Cut(svg, "\n")
+	open = strings.Replace(open, "<svg ", "<svg xmlns=\"http://www.w3.org/2000/svg\" ", 1)
+	return "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n" + open +
+		"\n<style>.bar { fill: #4a7fc1; } .axis { font: 10px sans-serif; fill: #555; }</style>\n" + rest
+}
+
+// pngHistogram draws the bars of a histogram on a white background
+func pngHistogram(counts []int) ([]byte, error) {
+	img := image.NewRGBA(image.Rect(0, 0, chartImageWidth, chartImageHeight))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+	highest := 0
+	for _, count := range counts {
+		highest = max(highest, count)
+	}
+	barWidth := float64(chartImageWidth) / float64(len(counts))
+	for i, count := range counts {
+		if count == 0 {
+			continue
+		}
+		h := max(int(float64(chartImageHeight)*float64(count)/float64(highest)), 1)
+		left := int(float64(i)*barWidth) + 1
+		right := max(int(float64(i+1)*barWidth)-1, left+1)
+		draw.Draw(img, image.Rect(left, chartImageHeight-h, right, chartImageHeight), &image.Uniform{chartBarColor}, image.Point{}, draw.Src)
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,144 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/openai/openai-go/option"
+)
+
+// Console progress displays: one line rewritten in place, or a status block
+// with a progress bar
+const (
+	progressLine = "line"
+	progressBar  = "bar"
+	progressNone = "none"
+)
+
+var progressModes = map[string]bool{progressLine: true, progressBar: true, progressNone: true}
+
+// progressBarWidth is the number of cells of the bar display
+const progressBarWidth = 30
+
+// retryCounterKey carries the retry counter of a run in request contexts
+type retryCounterKey struct{}
+
+// withRetryCounter makes the API client count the retries of requests made
+// with the returned context
+func withRetryCounter(ctx context.Context, counter *int64) context.Context {
+	return context.WithValue(ctx, retryCounterKey{}, counter)
+}
+
+// rowRetriesKey carries the retry counter of one row in request contexts
+type rowRetriesKey struct{}
+
+// withRowRetries makes the API client count the retries of requests made
+// with the returned context for one row as well
+func withRowRetries(ctx context.Context, counter *int64) context.Context {
+	return context.WithValue(ctx, rowRetriesKey{}, counter)
+}
+
+// countRetries is client middleware counting the requests the client retries
+// after a failure or rate limit, for the run and for the row. The client
+// numbers its attempts in the X-Stainless-Retry-Count header.
+func countRetries(req *http.Request, next option.MiddlewareNext) (*http.Response, error) {
+	if attempt := req.Header.Get("X-Stainless-Retry-Count"); attempt != "" && attempt != "0" {
+		for _, key := range []any{retryCounterKey{}, rowRetriesKey{}} {
+			if counter, ok := req.Context().Value(key).(*int64); ok {
+				atomic.AddInt64(counter, 1)
+			}
+		}
+	}
+	return next(req)
+}
+
+// rate returns the rows finished per minute by this run, leaving out rows
+// taken from the run journal
+func (stats *ProcessingStats) rate() float64 {
+	processed := atomic.LoadInt32(&stats.CompletedRows) + atomic.LoadInt32(&stats.FailedRows) - atomic.LoadInt32(&stats.ResumedRows)
+	elapsed := time.Since(stats.StartTime)
+	if processed <= 0 || elapsed <= 0 {
+		return 0
+	}
+	return float64(processed) / elapsed.Minutes()
+}
+
+// eta returns the time left at the current rate, or false when it is not
+// known yet or the total is not (streamed inputs)
+func (stats *ProcessingStats) eta() (time.Duration, bool) {
+	rate := stats.rate()
+	if stats.TotalRows == 0 || rate == 0 {
+		return 0, false
+	}
+	remaining := stats.TotalRows - int(atomic.LoadInt32(&stats.CompletedRows)+atomic.LoadInt32(&stats.FailedRows))
+	return time.Duration(float64(remaining) / rate * float64(time.Minute)), true
+}
+
+// printProgress shows the progress of a run on the console in the given
+// display mode
+func printProgress(stats *ProcessingStats, mode string) {
+	completed := atomic.LoadInt32(&stats.CompletedRows)
+	failed := atomic.LoadInt32(&stats.FailedRows)
+	total := stats.TotalRows
+	tokens := atomic.LoadInt64(&stats.TotalTokens)
+	elapsed := time.Since(stats.StartTime).Round(time.Second)
+
+	// Streamed inputs are counted as they are read
+	count := fmt.Sprintf("%d", completed)
+	var fraction float64
+	if total > 0 {
+		fraction = float64(completed+failed) / float64(total)
+		count = fmt.Sprintf("%d/%d (%.1f%%)", completed, total, fraction*100)
+	}
+
+	eta := "ETA: -"
+	if left, ok := stats.eta(); ok {
+		left = left.Round(time.Second)
+		eta = fmt.Sprintf("ETA: %s (%s)", left, time.Now().Add(left).Format("15:04"))
+	}
+	// With -workers auto, in flight is shown against the tuned limit
+	inFlight := fmt.Sprintf("%d", atomic.LoadInt32(&stats.InFlight))
+	if workers := atomic.LoadInt32(&stats.Workers); workers > 0 {
+		inFlight += fmt.Sprintf("/%d auto", workers)
+	}
+	activity := fmt.Sprintf("Rate: %s rows/min | %s | In flight: %s | Retries: %d | Failed: %d",
+		formatRate(stats.rate()), eta, inFlight, atomic.LoadInt64(&stats.Retries), failed)
+	usage := fmt.Sprintf("Tokens: %d | Cost: $%.4f | Elapsed: %s", tokens, stats.Cost(), elapsed)
+
+	if plainOutput() {
+		// Without escape codes, spaces clear the rest of a longer previous line
+		line := fmt.Sprintf("Progress: %s | %s | %s", count, activity, usage)
+		fmt.Printf("\r%-*s", stats.progressWidth, line)
+		stats.progressWidth = len(line)
+		return
+	}
+	if mode != progressBar {
+		// Clear the rest of the line in case it got shorter
+		fmt.Printf("\rProgress: %s | %s | %s\033[K", count, activity, usage)
+		return
+	}
+
+	// Redraw the three lines of the status block in place
+	if stats.progressDrawn {
+		fmt.Print("\033[2A")
+	}
+	stats.progressDrawn = true
+	filled := int(fraction * progressBarWidth)
+	bar := strings.Repeat("█", filled) + strings.Repeat("░", progressBarWidth-filled)
+	if total == 0 {
+		bar = strings.Repeat("░", progressBarWidth)
+	}
+	fmt.Printf("\r[%s] %s\033[K\n%s\033[K\n%s\033[K", bar, count, activity, usage)
+}
+
+// formatRate shows a rate with one decimal when it is small
+func formatRate(rate float64) string {
+	if rate < 10 {
+		return fmt.Sprintf("%.1f", rate)
+	}
+	return fmt.Sprintf("%.0f", rate)
+}
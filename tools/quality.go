@@ -0,0 +1,385 @@
+package tools
+
+import (
+	"flag"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"ai-general-tool/common"
+)
+
+// qualityColumn lists the issues of each row in the flags file
+const qualityColumn = "_quality_flags"
+
+// Checks of the quality command
+const (
+	checkTypes      = "types"
+	checkOutliers   = "outliers"
+	checkDates      = "dates"
+	checkWhitespace = "whitespace"
+	checkCasing     = "casing"
+	checkTruncation = "truncation"
+)
+
+// qualityChecks lists the checks in report order
+var qualityChecks = []string{checkTypes, checkOutliers, checkDates, checkWhitespace, checkCasing, checkTruncation}
+
+// dateLikePattern matches values written like a date, e.g. 2024-02-30 or
+// 31/31/2024, to tell impossible dates from text
+var dateLikePattern = regexp.MustCompile(`^\d{1,4}[-/.]\d{1,2}[-/.]\d{1,4}([ T]\d{1,2}:\d{2}(:\d{2})?)?$`)
+
+// truncationLengths are field limits of common systems; several values of a
+// column cut at one of them were likely truncated on export
+var truncationLengths = []int{50, 64, 80, 100, 128, 200, 250, 255, 256, 500, 512, 1000, 1024, 2000, 4000, 4096, 8000, 32767}
+
+// qualityIssue is a likely problem with a cell
+type qualityIssue struct {
+	Row    int // 0-based data row
+	Column int
+	Check  string
+	Detail string
+}
+
+// RunQuality handles the quality command: it flags likely data problems
+// (mixed types, outliers, impossible dates, stray whitespace, inconsistent
+// casing and truncated values) in a report and a per-row flags file
+func RunQuality(args []string) error {
+	fs := flag.NewFlagSet("quality", flag.ExitOnError)
+
+	// Define flags
+	inputFile := fs.String("input", "", "Input file (CSV, Excel or JSON)")
+	columns := fs.String("columns", "", "Comma-separated columns to check (default: all)")
+	checks := fs.String("checks", strings.Join(qualityChecks, ","), "Comma-separated checks: "+strings.Join(qualityChecks, ", "))
+	method := fs.String("outliers", "iqr", "Outlier method: iqr (beyond -threshold times the interquartile range) or zscore (more than -threshold standard deviations from the mean)")
+	threshold := fs.Float64("threshold", 0, "Outlier threshold (default: 1.5 for iqr, 3 for zscore)")
+	examples := fs.Int("examples", 3, "Example values per issue in the report")
+	outputFile := fs.String("output", "", "Flags file: the rows with a "+qualityColumn+" column (default: <input>_quality)")
+	fs.StringVar(outputFile, "o", "", "Shorthand for -output")
+	onlyFlagged := fs.Bool("only-flagged", false, "Write only the rows with issues to the flags file")
+	noFlags := fs.Bool("no-flags", false, "Only print the report, without writing the flags file")
+	input := inputFlags(fs)
+	output := &OutputOptions{}
+	fs.StringVar(&output.Format, "format", "same", "Output format: same, csv, sqlite, ods, md (Markdown table), html")
+	fs.BoolVar(&output.QuoteAll, "quote-all", false, "Quote every field of CSV output")
+	var locale common.Locale
+	localeFlag(fs, &locale)
+
+	// Parse flags
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	// Handle positional argument for filename
+	if *inputFile == "" && fs.NArg() > 0 {
+		*inputFile = fs.Arg(0)
+	}
+
+	// Validation
+	if *inputFile == "" {
+		return fmt.Errorf("input file is required")
+	}
+	enabled := make(map[string]bool)
+	for _, check := range strings.Split(*checks, ",") {
+		check = strings.TrimSpace(check)
+		if !slices.Contains(qualityChecks, check) {
+			return fmt.Errorf("unknown check '%s' (use %s)", check, strings.Join(qualityChecks, ", "))
+		}
+		enabled[check] = true
+	}
+	if *threshold == 0 {
+		*threshold = defaultOutlierThreshold(*method)
+	}
+	if _, _, err := outlierBounds([]float64{0}, *method, *threshold); err != nil {
+		return err
+	}
+	toStdout, err := useStdout(*inputFile, outputFile, *output)
+	if err != nil {
+		return err
+	}
+	if *outputFile == "" && !*noFlags {
+		*outputFile = suffixedOutputFile(*inputFile, output.Format, "_quality")
+	}
+	if *outputFile == *inputFile && *inputFile != stdioName {
+		return fmt.Errorf("output would overwrite the input %s", *inputFile)
+	}
+
+	fmt.Printf("Loading %s...\n", *inputFile)
+	headers, rows, err := loadInputFile(*inputFile, *input)
+	if err != nil {
+		return fmt.Errorf("error loading input: %v", err)
+	}
+	indexes, err := columnIndexes(headers, *columns)
+	if err != nil {
+		return err
+	}
+
+	var issues []qualityIssue
+	for _, index := range indexes {
+		values := make([]string, len(rows))
+		for r, row := range rows {
+			values[r] = cell(row, index)
+		}
+		for _, issue := range checkColumnQuality(values, enabled, *method, *threshold, locale) {
+			issue.Column = index
+			issues = append(issues, issue)
+		}
+	}
+	printQualityReport(headers, rows, issues, *examples)
+
+	if *noFlags {
+		return nil
+	}
+	flags := make(map[int][]string)
+	for _, issue := range issues {
+		flags[issue.Row] = append(flags[issue.Row], headers[issue.Column]+": "+issue.Detail)
+	}
+	outHeaders := append(append([]string{}, headers...), qualityColumn)
+	var outRows [][]string
+	for r, row := range rows {
+		if *onlyFlagged && len(flags[r]) == 0 {
+			continue
+		}
+		outRows = append(outRows, append(padRow(row, len(headers)), strings.Join(flags[r], "; ")))
+	}
+	if err := saveOutputTable(*outputFile, outHeaders, outRows, nil, *output); err != nil {
+		return fmt.Errorf("error saving output: %v", err)
+	}
+	if !toStdout {
+		fmt.Printf("Flags saved to: %s (%d of %d rows flagged)\n", *outputFile, len(flags), len(rows))
+	}
+	return nil
+}
+
+// checkColumnQuality runs the enabled checks on the values of a column
+func checkColumnQuality(values []string, enabled map[string]bool, method string, threshold float64, locale common.Locale) []qualityIssue {
+	var issues []qualityIssue
+	kinds := make([]string, len(values))
+	counts := make(map[string]int)
+	for r, value := range values {
+		kinds[r] = valueKind(value, locale)
+		counts[kinds[r]]++
+	}
+	majority, total := "", 0
+	for _, kind := range []string{"number", "date", "boolean", "text"} {
+		total += counts[kind]
+		if counts[kind] > counts[majority] {
+			majority = kind
+		}
+	}
+
+	// Mixed types: values not of a typed column's type, e.g. "n/a" among
+	// numbers; impossible dates are left to the dates check
+	if enabled[checkTypes] && majority != "text" && majority != "" && counts[majority]*2 > total {
+		for r, kind := range kinds {
+			if majority == "date" && enabled[checkDates] && dateLikePattern.MatchString(strings.TrimSpace(values[r])) {
+				continue
+			}
+			if kind != "" && kind != "either" && kind != majority && !(kind == "number" && majority == "boolean") {
+				issues = append(issues, qualityIssue{Row: r, Check: checkTypes, Detail: fmt.Sprintf("%s in a %s column", kind, majority)})
+			}
+		}
+	}
+
+	if enabled[checkOutliers] && majority == "number" {
+		var numbers []float64
+		for _, value := range values {
+			if n, ok := numericValue(value, locale); ok {
+				numbers = append(numbers, n)
+			}
+		}
+		if len(numbers) >= 4 {
+			lower, upper, _ := outlierBounds(numbers, method, threshold)
+			for r, value := range values {
+				if n, ok := numericValue(value, locale); ok && (n < lower || n > upper) {
+					issues = append(issues, qualityIssue{Row: r, Check: checkOutliers, Detail: fmt.Sprintf("outlier (outside %s to %s)", formatStat(lower), formatStat(upper))})
+				}
+			}
+		}
+	}
+
+	if enabled[checkDates] {
+		now := time.Now()
+		for r, value := range values {
+			trimmed := strings.TrimSpace(value)
+			if kinds[r] == "date" {
+				if date, ok := common.ParseDate(trimmed, locale); ok && (date.Year() < 1900 || date.After(now.AddDate(100, 0, 0))) {
+					issues = append(issues, qualityIssue{Row: r, Check: checkDates, Detail: "implausible date"})
+				}
+			} else if kinds[r] == "text" && dateLikePattern.MatchString(trimmed) {
+				issues = append(issues, qualityIssue{Row: r, Check: checkDates, Detail: "impossible date"})
+			}
+		}
+	}
+
+	if enabled[checkWhitespace] {
+		for r, value := range values {
+			if value != "" && value != strings.TrimSpace(value) {
+				issues = append(issues, qualityIssue{Row: r, Check: checkWhitespace, Detail: "leading or trailing whitespace"})
+			}
+		}
+	}
+
+	// Inconsistent casing: spellings of a text value differing only in case,
+	// flagging all but the most frequent spelling
+	if enabled[checkCasing] && majority == "text" {
+		spellings := make(map[string]map[string]int)
+		for _, value := range values {
+			trimmed := strings.TrimSpace(value)
+			if trimmed == "" {
+				continue
+			}
+			folded := strings.ToLower(trimmed)
+			if spellings[folded] == nil {
+				spellings[folded] = make(map[string]int)
+			}
+			spellings[folded][trimmed]++
+		}
+		preferred := make(map[string]string)
+		for folded, variants := range spellings {
+			if len(variants) < 2 {
+				continue
+			}
+			best := ""
+			for variant, n := range variants {
+				if best == "" || n > variants[best] || (n == variants[best] && variant < best) {
+					best = variant
+				}
+			}
+			preferred[folded] = best
+		}
+		for r, value := range values {
+			trimmed := strings.TrimSpace(value)
+			if best, ok := preferred[strings.ToLower(trimmed)]; ok && trimmed != best {
+				issues = append(issues, qualityIssue{Row: r, Check: checkCasing, Detail: fmt.Sprintf("casing differs from %q", best)})
+			}
+		}
+	}
+
+	// Truncation: values ending in an ellipsis, or several values cut at the
+	// column's longest length when that is a common field limit
+	if enabled[checkTruncation] {
+		longest, atLongest := 0, 0
+		for _, value := range values {
+			switch n := utf8.RuneCountInString(value); {
+			case n > longest:
+				longest, atLongest = n, 1
+			case n == longest:
+				atLongest++
+			}
+		}
+		cut := atLongest >= 2 && slices.Contains(truncationLengths, longest)
+		for r, value := range values {
+			switch {
+			case cut && utf8.RuneCountInString(value) == longest:
+				issues = append(issues, qualityIssue{Row: r, Check: checkTruncation, Detail: fmt.Sprintf("possibly truncated at %d characters", longest)})
+			case kinds[r] == "text" && (strings.HasSuffix(strings.TrimSpace(value), "...") || strings.HasSuffix(strings.TrimSpace(value), "…")):
+				issues = append(issues, qualityIssue{Row: r, Check: checkTruncation, Detail: "ends with an ellipsis"})
+			}
+		}
+	}
+
+	sort.SliceStable(issues, func(i, j int) bool { return issues[i].Row < issues[j].Row })
+	return issues
+}
+
+// valueKind classifies a value as number, date, boolean or text, "either"
+// for 1 and 0 which read as numbers and booleans, or "" when empty
+func valueKind(value string, locale common.Locale) string {
+	trimmed := strings.TrimSpace(value)
+	if common.IsNull(trimmed) {
+		return ""
+	}
+	switch strings.ToLower(trimmed) {
+	case "1", "0":
+		return "either"
+	case "true", "false", "yes", "no":
+		return "boolean"
+	}
+	if _, ok := numericValue(trimmed, locale); ok {
+		return "number"
+	}
+	if _, ok := common.ParseDate(trimmed, locale); ok {
+		return "date"
+	}
+	return "text"
+}
+
+// defaultOutlierThreshold returns the usual threshold of an outlier method
+func defaultOutlierThreshold(method string) float64 {
+	if method == "zscore" {
+		return 3
+	}
+	return 1.5
+}
+
+// outlierBounds returns the range outside which values are outliers: for
+// iqr the quartiles widened by threshold times the interquartile range, for
+// zscore the mean plus or minus threshold standard deviations
+func outlierBounds(values []float64, method string, threshold float64) (float64, float64, error) {
+	switch method {
+	case "iqr":
+		sorted := append([]float64{}, values...)
+		sort.Float64s(sorted)
+		q1, q3 := quantile(sorted, 0.25), quantile(sorted, 0.75)
+		return q1 - threshold*(q3-q1), q3 + threshold*(q3-q1), nil
+	case "zscore":
+		mean, stddev := meanStddev(values)
+		return mean - threshold*stddev, mean + threshold*stddev, nil
+	}
+	return 0, 0, fmt.Errorf("invalid outlier method '%s' (use iqr or zscore)", method)
+}
+
+// printQualityReport prints the issues found per column and check, with
+// example values and rows
+func printQualityReport(headers []string, rows [][]string, issues []qualityIssue, examples int) {
+	fmt.Printf("\n=== QUALITY CHECK ===\n")
+	flagged := make(map[int]bool)
+	for _, issue := range issues {
+		flagged[issue.Row] = true
+	}
+	fmt.Printf("Rows: %d | Columns: %d | Issues: %d | Rows flagged: %d (%s)\n",
+		len(rows), len(headers), len(issues), len(flagged), common.FormatPercentage(len(flagged), len(rows)))
+	if len(issues) == 0 {
+		fmt.Println("No issues found")
+		return
+	}
+
+	type group struct {
+		column   int
+		check    string
+		count    int
+		examples []string
+	}
+	var groups []*group
+	byKey := make(map[string]*group)
+	for _, issue := range issues {
+		key := strconv.Itoa(issue.Column) + "\x00" + issue.Check
+		g, ok := byKey[key]
+		if !ok {
+			g = &group{column: issue.Column, check: issue.Check}
+			byKey[key] = g
+			groups = append(groups, g)
+		}
+		g.count++
+		if len(g.examples) < examples {
+			g.examples = append(g.examples, fmt.Sprintf("row %d: %q", issue.Row+1, common.TruncateString(cell(rows[issue.Row], issue.Column), 30)))
+		}
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		if groups[i].column != groups[j].column {
+			return groups[i].column < groups[j].column
+		}
+		return slices.Index(qualityChecks, groups[i].check) < slices.Index(qualityChecks, groups[j].check)
+	})
+	var table [][]string
+	for _, g := range groups {
+		table = append(table, []string{headers[g.column], g.check, strconv.Itoa(g.count), strings.Join(g.examples, ", ")})
+	}
+	fmt.Println(common.FormatTable([]string{"Column", "Check", "Issues", "Examples"}, table, 180))
+}
@@ -1,10 +1,9 @@
 package tools
 
 import (
-	"encoding/csv"
 	"flag"
 	"fmt"
-	"os"
+	"io"
 	"strings"
 
 	"ai-general-tool/common"
@@ -18,10 +17,27 @@ func RunReadCSV(args []string) error {
 	fileName := fs.String("file", "", "CSV file to read (required)")
 	rowCount := fs.Int("rows", 20, "Number of rows to display")
 	sampleType := fs.String("sample", "first", "Sample type: 'first' or 'random'")
-	delimiter := fs.String("delimiter", ",", "CSV delimiter")
+	format := fs.String("format", "text", "Output format: text, md (Markdown), html, json")
+	applyJSON := jsonFlag(fs, format)
+	chart := chartFlags(fs)
+	var csvOpts CSVOptions
+	csvFlags(fs, &csvOpts)
+	header := fs.String("header", "auto", "Whether the first row is a header: auto, yes, no")
+	var headerRows HeaderOptions
+	headerFlags(fs, &headerRows)
+	var locale common.Locale
+	localeFlag(fs, &locale)
+	fullScan := fs.Bool("full-scan", false, fmt.Sprintf("Analyze every row for exact unique and null counts (default: a random sample of %d rows)", analysisSampleRows))
 
 	// Parse flags
-	if err := fs.Parse(args); err != nil {
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	applyJSON()
+	if !previewFormats[*format] {
+		return fmt.Errorf("invalid format '%s' (use text, md, html or json)", *format)
+	}
+	if err := chart.check(*format); err != nil {
 		return err
 	}
 
@@ -41,59 +57,95 @@ func RunReadCSV(args []string) error {
 	}
 
 	// Open the CSV file
-	file, err := os.Open(*fileName)
+	file, err := openInput(*fileName)
 	if err != nil {
 		return fmt.Errorf("error opening file '%s': %v", *fileName, err)
 	}
 	defer file.Close()
 
-	// Create CSV reader
-	reader := csv.NewReader(file)
-	reader.Comma = []rune(*delimiter)[0]
-	reader.LazyQuotes = true
-	reader.TrimLeadingSpace = true
-
-	// Read all data (for analysis)
-	allData, err := reader.ReadAll()
+	// Detect the dialect, keeping what was given
+	fixed, err := csvOpts.dialect()
 	if err != nil {
-		return fmt.Errorf("error reading CSV: %v", err)
+		return err
+	}
+	dialect, input := sniffReader(file, fixed)
+	switch *header {
+	case "auto":
+	case "yes":
+		dialect.Header = true
+	case "no":
+		dialect.Header = false
+	default:
+		return fmt.Errorf("invalid header '%s' (use auto, yes or no)", *header)
 	}
+	if headerRows.None {
+		dialect.Header = false
+	} else if headerRows.set() {
+		if *header == "no" {
+			return fmt.Errorf("-header no cannot be combined with -header-row")
+		}
+		dialect.Header = true
+	}
+	headerRows.None = !dialect.Header
 
-	if len(allData) == 0 {
+	// Analyze columns and pick the rows to display in one pass, so the file
+	// is never held in memory as a whole
+	headers, source, err := headerRows.readHeader(dialect.rows(input))
+	if err == io.EOF {
 		return fmt.Errorf("CSV file is empty")
 	}
+	if err != nil {
+		return fmt.Errorf("error reading CSV: %v", err)
+	}
+	analysis := newColumnAnalysis(len(headers), *fullScan, locale)
+	sampler := rowSampler{count: *rowCount, random: *sampleType == "random"}
+	chartRows := chart.sampler()
+	for {
+		row, err := source.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("error reading CSV: %v", err)
+		}
+		analysis.add(row)
+		sampler.add(row)
+		chartRows.add(row)
+	}
 
-	// Extract headers
-	headers := allData[0]
-	data := allData[1:]
-
-	if len(data) == 0 {
-		fmt.Println("Warning: CSV file contains only headers, no data rows")
-		return nil
+	if sampler.seen == 0 {
+		warnf("CSV file contains only headers, no data rows")
+		if *format != "json" {
+			return nil
+		}
+		sampler.rows = [][]string{}
 	}
 
 	// Create data preview
 	preview := &common.DataPreview{
 		FileName:     *fileName,
 		FileType:     "CSV File",
-		TotalRows:    len(data),
+		SheetInfo:    dialect.String(),
+		TotalRows:    sampler.seen,
 		TotalColumns: len(headers),
 		Headers:      headers,
 		SampleType:   *sampleType,
 	}
-
-	// Analyze columns
-	preview.Columns = analyzeColumns(headers, data)
-
-	// Select rows to display
-	displayRows := selectRows(data, *rowCount, *sampleType)
-	preview.Rows = displayRows
-	preview.RowsDisplayed = len(displayRows)
+	preview.Columns, preview.AnalyzedRows = analysis.columns(headers)
+	preview.Rows = sampler.rows
+	preview.RowsDisplayed = len(sampler.rows)
 
 	// Display the preview
+	if *format == "json" {
+		return printJSON(preview)
+	}
+	if *format != "text" {
+		printPreviewDocument(preview, *format)
+		return nil
+	}
 	displayPreview(preview)
 
-	return nil
+	return chart.print(headers, chartRows.rows, chartRows.seen, locale)
 }
 
 // analyzeColumns analyzes the columns in the data
@@ -165,7 +217,11 @@ func displayPreview(preview *common.DataPreview) {
 	// Header
 	fmt.Println(separator)
 	fmt.Printf("FILE: %s\n", preview.FileName)
-	fmt.Printf("TYPE: %s\n", preview.FileType)
+	if preview.SheetInfo != "" {
+		fmt.Printf("TYPE: %s (%s)\n", preview.FileType, preview.SheetInfo)
+	} else {
+		fmt.Printf("TYPE: %s\n", preview.FileType)
+	}
 	fmt.Println(separator)
 	fmt.Println()
 
@@ -182,7 +238,7 @@ func displayPreview(preview *common.DataPreview) {
 	var analysisRows [][]string
 
 	for _, col := range preview.Columns {
-		nullPercent := common.FormatPercentage(col.NullCount, col.TotalCount)
+		unique, nulls := analysisCounts(preview, col)
 		sampleStr := strings.Join(col.SampleValues, ", ")
 		if len(col.SampleValues) < col.UniqueCount {
 			sampleStr += "..."
@@ -192,14 +248,17 @@ func displayPreview(preview *common.DataPreview) {
 			fmt.Sprintf("%d", col.Index),
 			common.TruncateString(col.Name, 20),
 			string(col.DataType),
-			fmt.Sprintf("%d", col.UniqueCount),
-			fmt.Sprintf("%d (%s)", col.NullCount, nullPercent),
+			unique,
+			nulls,
 			sampleStr,
 		}
 		analysisRows = append(analysisRows, row)
 	}
 
 	fmt.Println(common.FormatTable(analysisHeaders, analysisRows, 120))
+	if note := analysisNote(preview); note != "" {
+		fmt.Println(note)
+	}
 	fmt.Println()
 
 	// Data Preview
@@ -246,13 +305,20 @@ func displayPreview(preview *common.DataPreview) {
 	fmt.Println()
 
 	// Usage hints
+	command := "read-csv"
+	switch preview.FileType {
+	case "JSON File":
+		command = "read-json"
+	case "SQLite Database":
+		command = "read-sqlite"
+	}
 	fmt.Println("USAGE HINTS:")
 	fmt.Printf("• Use column index (0-%d) or column name to reference columns\n", len(preview.Headers)-1)
-	fmt.Printf("• To see more rows: read-csv %s -rows 50\n", preview.FileName)
+	fmt.Printf("• To see more rows: %s %s -rows 50\n", command, preview.FileName)
 	if preview.SampleType == "random" {
-		fmt.Printf("• To see first rows instead: read-csv %s -sample first\n", preview.FileName)
+		fmt.Printf("• To see first rows instead: %s %s -sample first\n", command, preview.FileName)
 	} else {
-		fmt.Printf("• To see random sample: read-csv %s -sample random\n", preview.FileName)
+		fmt.Printf("• To see random sample: %s %s -sample random\n", command, preview.FileName)
 	}
 	fmt.Println(separator)
 }
\ No newline at end of file
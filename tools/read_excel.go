@@ -3,10 +3,10 @@ package tools
 import (
 	"flag"
 	"fmt"
+	"io"
 	"strings"
 
 	"ai-general-tool/common"
-	"github.com/xuri/excelize/v2"
 )
 
 // RunReadExcel handles the read-excel command
@@ -14,13 +14,30 @@ func RunReadExcel(args []string) error {
 	fs := flag.NewFlagSet("read-excel", flag.ExitOnError)
 
 	// Define flags
-	fileName := fs.String("file", "", "Excel file to read (required)")
+	fileName := fs.String("file", "", "Excel or ODS file to read (required)")
 	rowCount := fs.Int("rows", 20, "Number of rows to display")
 	sampleType := fs.String("sample", "first", "Sample type: 'first' or 'random'")
-	sheetIndex := fs.Int("sheet", 1, "Sheet number to read (1-based index)")
+	format := fs.String("format", "text", "Output format: text, md (Markdown), html, json")
+	applyJSON := jsonFlag(fs, format)
+	chart := chartFlags(fs)
+	sheet := fs.String("sheet", "1", "Sheet to read: name, number (1-based index), or all to combine the sheets with the same columns")
+	var headerRows HeaderOptions
+	headerFlags(fs, &headerRows)
+	var excelOpts ExcelOptions
+	excelFlags(fs, &excelOpts)
+	var locale common.Locale
+	localeFlag(fs, &locale)
+	fullScan := fs.Bool("full-scan", false, fmt.Sprintf("Analyze every row for exact unique and null counts (default: a random sample of %d rows)", analysisSampleRows))
 
 	// Parse flags
-	if err := fs.Parse(args); err != nil {
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	applyJSON()
+	if !previewFormats[*format] {
+		return fmt.Errorf("invalid format '%s' (use text, md, html or json)", *format)
+	}
+	if err := chart.check(*format); err != nil {
 		return err
 	}
 
@@ -42,153 +59,138 @@ func RunReadExcel(args []string) error {
 		return fmt.Errorf("missing required file argument")
 	}
 
-	// Open the Excel file
-	f, err := excelize.OpenFile(*fileName)
-	if err != nil {
-		return fmt.Errorf("error opening file '%s': %v", *fileName, err)
-	}
-	defer f.Close()
-
-	// Get sheet list
-	sheetList := f.GetSheetList()
-	if len(sheetList) == 0 {
-		return fmt.Errorf("no sheets found in Excel file")
-	}
+	// Open the workbook and read the sheet row by row; -sheet all combines
+	// the sheets first
+	var headers, sheetList []string
+	var source rowSource
+	var sheetInfo, sheetName string
+	if isAllSheets(*sheet) {
+		allHeaders, rows, err := loadAllSheets(*fileName, InputOptions{Sheet: *sheet, Excel: excelOpts, Header: headerRows})
+		if err != nil {
+			return fmt.Errorf("error reading '%s': %v", *fileName, err)
+		}
+		headers, source = allHeaders, &sliceSource{rows: rows}
+		sheetName = "all sheets"
+		sheetInfo = fmt.Sprintf("All sheets, %s column added", sourceSheetColumn)
+	} else {
+		var sheetIndex int
+		var sheetSource rowSource
+		var err error
+		sheetList, sheetIndex, sheetSource, err = readWorkbookSheet(*fileName, *sheet, excelOpts)
+		if err != nil {
+			return err
+		}
+		if closer, ok := sheetSource.(io.Closer); ok {
+			defer closer.Close()
+		}
+		sheetName = sheetList[sheetIndex-1]
+		sheetInfo = fmt.Sprintf("Sheet %d of %d: \"%s\"", sheetIndex, len(sheetList), sheetName)
 
-	// Validate sheet index
-	if *sheetIndex < 1 || *sheetIndex > len(sheetList) {
-		return fmt.Errorf("invalid sheet index %d. File has %d sheet(s)", *sheetIndex, len(sheetList))
+		// Extract headers
+		headers, source, err = headerRows.readHeader(sheetSource)
+		if err == io.EOF {
+			return fmt.Errorf("sheet '%s' is empty", sheetName)
+		}
+		if err != nil {
+			return fmt.Errorf("error reading sheet '%s': %v", sheetName, err)
+		}
 	}
 
-	// Get the sheet name
-	sheetName := sheetList[*sheetIndex-1]
-
-	// Read all rows from the sheet
-	rows, err := f.GetRows(sheetName)
-	if err != nil {
-		return fmt.Errorf("error reading sheet '%s': %v", sheetName, err)
+	// Analyze columns and pick the rows to display in one pass
+	analysis := newColumnAnalysis(len(headers), *fullScan, locale)
+	sampler := rowSampler{count: *rowCount, random: *sampleType == "random"}
+	chartRows := chart.sampler()
+	for {
+		row, err := source.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("error reading sheet '%s': %v", sheetName, err)
+		}
+		// Normalize data rows (ensure all rows have same number of columns)
+		row = normalizeRow(row, len(headers))
+		analysis.add(row)
+		sampler.add(row)
+		chartRows.add(row)
 	}
 
-	if len(rows) == 0 {
-		return fmt.Errorf("sheet '%s' is empty", sheetName)
+	if sampler.seen == 0 {
+		warnf("Excel sheet contains only headers, no data rows")
+		if *format != "json" {
+			return nil
+		}
+		sampler.rows = [][]string{}
 	}
 
-	// Extract headers
-	headers := rows[0]
-	data := rows[1:]
-
-	if len(data) == 0 {
-		fmt.Println("Warning: Excel sheet contains only headers, no data rows")
-		return nil
+	fileType := "Excel Spreadsheet"
+	if isODSFile(*fileName) {
+		fileType = "OpenDocument Spreadsheet"
 	}
 
-	// Create sheet info string
-	sheetInfo := fmt.Sprintf("Sheet %d of %d: \"%s\"", *sheetIndex, len(sheetList), sheetName)
-
 	// Create data preview
 	preview := &common.DataPreview{
 		FileName:     *fileName,
-		FileType:     "Excel Spreadsheet",
+		FileType:     fileType,
 		SheetInfo:    sheetInfo,
-		TotalRows:    len(data),
+		TotalRows:    sampler.seen,
 		TotalColumns: len(headers),
 		Headers:      headers,
 		SampleType:   *sampleType,
 	}
 
-	// Normalize data rows (ensure all rows have same number of columns)
-	normalizedData := normalizeData(data, len(headers))
-
-	// Analyze columns
-	preview.Columns = analyzeExcelColumns(headers, normalizedData)
-
-	// Select rows to display
-	displayRows := selectExcelRows(normalizedData, *rowCount, *sampleType)
-	preview.Rows = displayRows
-	preview.RowsDisplayed = len(displayRows)
+	preview.Columns, preview.AnalyzedRows = analysis.columns(headers)
+	preview.Rows = sampler.rows
+	preview.RowsDisplayed = len(sampler.rows)
 
 	// Display the preview
+	if *format == "json" {
+		return printJSON(preview)
+	}
+	if *format != "text" {
+		printPreviewDocument(preview, *format)
+		return nil
+	}
 	displayExcelPreview(preview, len(sheetList))
 
-	return nil
+	return chart.print(headers, chartRows.rows, chartRows.seen, locale)
 }
 
-// normalizeData ensures all rows have the same number of columns
-func normalizeData(data [][]string, colCount int) [][]string {
-	normalized := make([][]string, len(data))
-	for i, row := range data {
-		normalized[i] = make([]string, colCount)
-		for j := 0; j < colCount; j++ {
-			if j < len(row) {
-				normalized[i][j] = row[j]
-			} else {
-				normalized[i][j] = ""
-			}
-		}
-	}
-	return normalized
-}
-
-// analyzeExcelColumns analyzes the columns in the Excel data
-func analyzeExcelColumns(headers []string, data [][]string) []common.ColumnInfo {
-	columns := make([]common.ColumnInfo, len(headers))
-
-	for i, header := range headers {
-		// Collect all values for this column
-		var values []string
-		for _, row := range data {
-			if i < len(row) {
-				values = append(values, row[i])
-			} else {
-				values = append(values, "")
-			}
-		}
-
-		// Get unique values
-		uniqueValues := common.GetUniqueValues(values)
-
-		// Get sample values (first 5 unique)
-		sampleValues := uniqueValues
-		if len(sampleValues) > 5 {
-			sampleValues = sampleValues[:5]
+// readWorkbookSheet returns the sheet names of an Excel (.xlsx, .xls) or ODS
+// workbook, the position (1-based) of one sheet given by name or number and
+// a source for its rows. Excel 2007+ sheets are read with the excelize
+// iterator, their cells as set by excel; the source then has to be closed.
+func readWorkbookSheet(filename string, sheet string, excel ExcelOptions) ([]string, int, rowSource, error) {
+	if isODSFile(filename) || isXLSFile(filename) {
+		read := readODS
+		if isXLSFile(filename) {
+			read = readXLS
 		}
-
-		// Truncate sample values for display
-		for j := range sampleValues {
-			sampleValues[j] = common.TruncateString(sampleValues[j], 15)
+		sheets, err := read(filename)
+		if err != nil {
+			return nil, 0, nil, fmt.Errorf("error opening file '%s': %v", filename, err)
 		}
-
-		columns[i] = common.ColumnInfo{
-			Index:        i,
-			Name:         header,
-			DataType:     common.DetectDataType(values),
-			UniqueCount:  len(uniqueValues),
-			NullCount:    common.CountNulls(values),
-			TotalCount:   len(values),
-			SampleValues: sampleValues,
+		sheetList := sheetNames(sheets)
+		sheetIndex, err := findSheet(sheetList, sheet)
+		if err != nil {
+			return nil, 0, nil, err
 		}
+		return sheetList, sheetIndex, &sliceSource{rows: sheets[sheetIndex-1].Rows}, nil
 	}
 
-	return columns
-}
-
-// selectExcelRows selects rows to display based on sample type
-func selectExcelRows(data [][]string, count int, sampleType string) [][]string {
-	if len(data) <= count {
-		return data
-	}
-
-	if sampleType == "random" {
-		indices := common.GenerateRandomIndices(count, len(data))
-		result := make([][]string, len(indices))
-		for i, idx := range indices {
-			result[i] = data[idx]
-		}
-		return result
+	sheetList, source, err := openExcelRows(filename, sheet, excel)
+	if err != nil {
+		return nil, 0, nil, fmt.Errorf("error opening file '%s': %v", filename, err)
 	}
+	sheetIndex, _ := findSheet(sheetList, sheet)
+	return sheetList, sheetIndex, source, nil
+}
 
-	// Default to first rows
-	return data[:count]
+// normalizeRow pads or cuts a row to the number of columns
+func normalizeRow(row []string, colCount int) []string {
+	normalized := make([]string, colCount)
+	copy(normalized, row)
+	return normalized
 }
 
 // displayExcelPreview displays the Excel data preview in formatted output
@@ -215,7 +217,7 @@ func displayExcelPreview(preview *common.DataPreview, totalSheets int) {
 	var analysisRows [][]string
 
 	for _, col := range preview.Columns {
-		nullPercent := common.FormatPercentage(col.NullCount, col.TotalCount)
+		unique, nulls := analysisCounts(preview, col)
 		sampleStr := strings.Join(col.SampleValues, ", ")
 		if len(col.SampleValues) < col.UniqueCount {
 			sampleStr += "..."
@@ -225,14 +227,17 @@ func displayExcelPreview(preview *common.DataPreview, totalSheets int) {
 			fmt.Sprintf("%d", col.Index),
 			common.TruncateString(col.Name, 20),
 			string(col.DataType),
-			fmt.Sprintf("%d", col.UniqueCount),
-			fmt.Sprintf("%d (%s)", col.NullCount, nullPercent),
+			unique,
+			nulls,
 			sampleStr,
 		}
 		analysisRows = append(analysisRows, row)
 	}
 
 	fmt.Println(common.FormatTable(analysisHeaders, analysisRows, 120))
+	if note := analysisNote(preview); note != "" {
+		fmt.Println(note)
+	}
 	fmt.Println()
 
 	// Data Preview
@@ -289,7 +294,7 @@ func displayExcelPreview(preview *common.DataPreview, totalSheets int) {
 		fmt.Printf("• To see random sample: read-excel %s -sample random\n", preview.FileName)
 	}
 	if totalSheets > 1 {
-		fmt.Printf("• To select different sheet: read-excel %s -sheet 2\n", preview.FileName)
+		fmt.Printf("• To select different sheet: read-excel %s -sheet 2 (or -sheet \"<name>\", or -sheet all to combine sheets with the same columns)\n", preview.FileName)
 	}
 	fmt.Println(separator)
 }
\ No newline at end of file
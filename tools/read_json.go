@@ -0,0 +1,266 @@
+package tools
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"ai-general-tool/common"
+)
+
+// jsonArrayStrategies lists the supported -json-arrays values
+var jsonArrayStrategies = map[string]bool{"join": true, "explode": true, "json": true}
+
+// jsonMaxRowsPerRecord caps the rows one record may explode into
+const jsonMaxRowsPerRecord = 10000
+
+// RunReadJSON handles the read-json command
+func RunReadJSON(args []string) error {
+	fs := flag.NewFlagSet("read-json", flag.ExitOnError)
+
+	// Define flags
+	fileName := fs.String("file", "", "JSON file to read (required)")
+	rowCount := fs.Int("rows", 20, "Number of rows to display")
+	sampleType := fs.String("sample", "first", "Sample type: 'first' or 'random'")
+	format := fs.String("format", "text", "Output format: text, md (Markdown), html, json")
+	applyJSON := jsonFlag(fs, format)
+	chart := chartFlags(fs)
+	input := inputFlags(fs)
+
+	// Parse flags
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	applyJSON()
+	if !previewFormats[*format] {
+		return fmt.Errorf("invalid format '%s' (use text, md, html or json)", *format)
+	}
+	if err := chart.check(*format); err != nil {
+		return err
+	}
+
+	// Handle positional argument for filename
+	if *fileName == "" && fs.NArg() > 0 {
+		*fileName = fs.Arg(0)
+	}
+
+	if *fileName == "" {
+		fmt.Println("Error: JSON file name is required")
+		fmt.Println("\nUsage:")
+		fmt.Println("  read-json <filename> [flags]")
+		fmt.Println("  read-json -file <filename> [flags]")
+		fmt.Println("\nFlags:")
+		fs.PrintDefaults()
+		return fmt.Errorf("missing required file argument")
+	}
+
+	headers, data, err := loadJSON(*fileName, *input)
+	if err != nil {
+		return fmt.Errorf("error reading JSON: %v", err)
+	}
+
+	// Create data preview
+	preview := &common.DataPreview{
+		FileName:     *fileName,
+		FileType:     "JSON File",
+		TotalRows:    len(data),
+		TotalColumns: len(headers),
+		Headers:      headers,
+		SampleType:   *sampleType,
+	}
+	preview.Columns = analyzeColumns(headers, data)
+	displayRows := selectRows(data, *rowCount, *sampleType)
+	preview.Rows = displayRows
+	preview.RowsDisplayed = len(displayRows)
+
+	if *format == "json" {
+		return printJSON(preview)
+	}
+	if *format != "text" {
+		printPreviewDocument(preview, *format)
+		return nil
+	}
+	displayPreview(preview)
+
+	return chart.print(headers, data, len(data), common.Locale{})
+}
+
+// loadJSON loads a file holding an array of objects, or a .jsonl file with
+// one object per line, flattening nested objects into dot-separated columns
+func loadJSON(filename string, opts InputOptions) ([]string, [][]string, error) {
+	file, err := openInput(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	return readJSON(file, dataExt(filename) == ".jsonl", opts)
+}
+
+// readJSON reads an array of objects, or one object per line
+func readJSON(r io.Reader, lines bool, opts InputOptions) ([]string, [][]string, error) {
+	if opts.JSONArrays == "" {
+		opts.JSONArrays = "json"
+	}
+	if !jsonArrayStrategies[opts.JSONArrays] {
+		return nil, nil, fmt.Errorf("invalid JSON array handling '%s' (use join, explode or json)", opts.JSONArrays)
+	}
+
+	var items []interface{}
+	if lines {
+		// One object per line
+		decoder := json.NewDecoder(r)
+		for {
+			var item interface{}
+			if err := decoder.Decode(&item); err == io.EOF {
+				break
+			} else if err != nil {
+				return nil, nil, fmt.Errorf("invalid JSON line after %d records: %v", len(items), err)
+			}
+			items = append(items, item)
+		}
+	} else if err := json.NewDecoder(r).Decode(&items); err != nil {
+		return nil, nil, fmt.Errorf("file must contain a JSON array of objects: %v", err)
+	}
+
+	var flat []map[string]string
+	for i, item := range items {
+		record, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, nil, fmt.Errorf("element %d is not an object", i)
+		}
+		rows := flattenJSON("", 0, record, opts)
+		if len(rows) > jsonMaxRowsPerRecord {
+			return nil, nil, fmt.Errorf("element %d explodes into %d rows (max %d); use -json-arrays join or json", i, len(rows), jsonMaxRowsPerRecord)
+		}
+		flat = append(flat, rows...)
+	}
+	if len(flat) == 0 {
+		return nil, nil, fmt.Errorf("file must have at least one record")
+	}
+
+	headers, rows := tabulateRecords(flat)
+	return headers, rows, nil
+}
+
+// flattenJSON flattens a value found at prefix, level objects deep, into one
+// or more partial rows. More than one row results only from exploded arrays,
+// which combine with the rows of sibling fields.
+func flattenJSON(prefix string, level int, value interface{}, opts InputOptions) []map[string]string {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if opts.JSONDepth > 0 && level >= opts.JSONDepth {
+			return []map[string]string{{prefix: jsonString(v)}}
+		}
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		rows := []map[string]string{{}}
+		for _, k := range keys {
+			key := k
+			if prefix != "" {
+				key = prefix + "." + k
+			}
+			rows = combineRows(rows, flattenJSON(key, level+1, v[k], opts))
+		}
+		return rows
+	case []interface{}:
+		switch opts.JSONArrays {
+		case "explode":
+			if len(v) == 0 {
+				return []map[string]string{{prefix: ""}}
+			}
+			var rows []map[string]string
+			for _, element := range v {
+				rows = append(rows, flattenJSON(prefix, level, element, opts)...)
+			}
+			return rows
+		case "join":
+			parts := make([]string, len(v))
+			for i, element := range v {
+				parts[i] = jsonScalar(element)
+			}
+			return []map[string]string{{prefix: strings.Join(parts, "; ")}}
+		default:
+			return []map[string]string{{prefix: jsonString(v)}}
+		}
+	default:
+		return []map[string]string{{prefix: jsonScalar(v)}}
+	}
+}
+
+// combineRows returns every combination of a row from each side
+func combineRows(left, right []map[string]string) []map[string]string {
+	combined := make([]map[string]string, 0, len(left)*len(right))
+	for _, l := range left {
+		for _, r := range right {
+			row := make(map[string]string, len(l)+len(r))
+			for k, v := range l {
+				row[k] = v
+			}
+			for k, v := range r {
+				row[k] = v
+			}
+			combined = append(combined, row)
+		}
+	}
+	return combined
+}
+
+// jsonScalar formats a JSON value as cell text; objects and arrays stay JSON
+func jsonScalar(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		return jsonString(v)
+	}
+}
+
+// jsonString encodes a value as compact JSON
+func jsonString(value interface{}) string {
+	data, _ := json.Marshal(value)
+	return string(data)
+}
+
+// tabulateRecords converts flattened records into rows. Columns keep their
+// first-seen order, sorted within a record.
+func tabulateRecords(flat []map[string]string) ([]string, [][]string) {
+	var headers []string
+	seen := make(map[string]bool)
+	for _, record := range flat {
+		keys := make([]string, 0, len(record))
+		for k := range record {
+			if !seen[k] {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			seen[k] = true
+			headers = append(headers, k)
+		}
+	}
+
+	rows := make([][]string, len(flat))
+	for i, values := range flat {
+		rows[i] = make([]string, len(headers))
+		for j, header := range headers {
+			rows[i][j] = values[header]
+		}
+	}
+	return headers, rows
+}
@@ -0,0 +1,230 @@
+package tools
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// RunReprocess handles the reprocess command: it regenerates some columns of
+// an enriched file and leaves every other column untouched
+func RunReprocess(args []string) error {
+	fs := flag.NewFlagSet("reprocess", flag.ExitOnError)
+
+	// Define flags
+	inputFile := fs.String("input", "", "Enriched file (CSV or Excel)")
+	outputFile := fs.String("output", "", "Output file (default: overwrite the input file)")
+	columns := fs.String("columns", "", "Comma-separated generated columns to regenerate")
+	prompt := fs.String("prompt", "", "Prompt for the regenerated columns (default: the original prompt from the run sidecar)")
+	model := fs.String("model", "", "Model for the regenerated columns (default: the original model)")
+	sampleSize := fs.Int("sample", 5, "Number of rows to test first")
+	batchSize := fs.Int("batch-size", 100, "Save progress every N rows")
+	workers := fs.String("workers", "10", "Number of parallel workers, or auto to tune it while processing")
+	sheet := fs.String("sheet", "1", "Excel sheet: name or number (1-based)")
+	var header HeaderOptions
+	headerFlags(fs, &header)
+	output := outputFlags(fs)
+	assumeYes := fs.Bool("yes", false, "Skip confirmation prompts")
+	var cells CellLimitOptions
+	cellLimitFlags(fs, &cells)
+
+	// Parse flags
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	// Handle positional argument for filename
+	if *inputFile == "" && fs.NArg() > 0 {
+		*inputFile = fs.Arg(0)
+	}
+
+	// Validate inputs
+	if *inputFile == "" {
+		return fmt.Errorf("input file is required")
+	}
+	if *columns == "" {
+		return fmt.Errorf("columns to regenerate are required")
+	}
+	workerCount, tuner, err := parseWorkers(*workers)
+	if err != nil {
+		return err
+	}
+	if err := cells.check(); err != nil {
+		return err
+	}
+	if *outputFile == "" {
+		*outputFile = *inputFile
+		if isXLSFile(*inputFile) {
+			*outputFile = outputStem(*inputFile) + ".xlsx"
+		}
+	}
+	name, err := output.compressedName(*outputFile)
+	if err != nil {
+		return err
+	}
+	*outputFile = name
+
+	info, err := readRunInfo(*inputFile)
+	if err != nil {
+		return fmt.Errorf("error reading run info: %v", err)
+	}
+	if *prompt == "" {
+		if info == nil || info.Prompt == "" {
+			return fmt.Errorf("no run info with a prompt found for %s; pass -prompt", *inputFile)
+		}
+		*prompt = info.Prompt
+	}
+
+	// Load the enriched file
+	fmt.Printf("Loading %s...\n", *inputFile)
+	input := InputOptions{Sheet: *sheet, Header: header}
+	headers, rows, err := loadInputFile(*inputFile, input)
+	if err != nil {
+		return fmt.Errorf("error loading input: %v", err)
+	}
+	if err := output.setInput(*inputFile, input, headers); err != nil {
+		return err
+	}
+	fmt.Printf("Loaded %d rows with %d columns\n", len(rows), len(headers))
+
+	// The regenerated columns keep their names, so the results overwrite them.
+	// Generated values are hidden from the model, which sees the same data as
+	// the original run.
+	previous := make(map[string]RunColumn)
+	hidden := make(map[string]bool)
+	if info != nil {
+		for _, column := range info.Columns {
+			previous[column.Name] = column
+			if !column.Overwritten {
+				hidden[column.Name] = true
+			}
+		}
+	}
+
+	var columnSpecs []ColumnSpec
+	for _, name := range strings.Split(*columns, ",") {
+		name = strings.TrimSpace(name)
+		if indexOf(headers, name) == -1 {
+			return fmt.Errorf("column '%s' not found in %s", name, *inputFile)
+		}
+		spec := ColumnSpec{Name: name, DataType: "string", Model: *model}
+		if spec.Model == "" {
+			spec.Model = previous[name].Model
+		}
+		columnSpecs = append(columnSpecs, spec)
+		if !previous[name].Overwritten {
+			hidden[name] = true
+		}
+	}
+	columnSpecs = append(columnSpecs, statusColumnSpecs()...)
+
+	client, err := newOpenAIClient()
+	if err != nil {
+		return err
+	}
+
+	config := &ProcessingConfig{
+		Client:      client,
+		ColumnSpecs: columnSpecs,
+		Prompt:      *prompt,
+		AssumeYes:   *assumeYes,
+		Hidden:      hidden,
+		Cells:       &cells,
+		tuner:       tuner,
+	}
+
+	// Test on sample first
+	fmt.Println("\n=== TESTING ON SAMPLE ===")
+	sample, err := testSample(config, headers, rows, *sampleSize)
+	if err != nil {
+		return fmt.Errorf("sample test failed: %v", err)
+	}
+	estimateWorkers := workerCount
+	if tuner != nil {
+		estimateWorkers = autoStartWorkers
+	}
+	printRunEstimate(config, sample, len(rows), estimateWorkers)
+	if !config.AssumeYes && !confirm("\nProceed with reprocessing all rows? (y/n): ") {
+		fmt.Println("Reprocessing cancelled.")
+		return nil
+	}
+
+	ctx, cancel := interruptContext()
+	defer cancel()
+
+	var journal *runJournal
+	if !isCloudURI(*outputFile) {
+		if journal, err = openRunJournal(*outputFile, headers, config.ColumnSpecs, "", false); err != nil {
+			return err
+		}
+	}
+
+	fmt.Println("\n=== REPROCESSING ===")
+	enrichedRows, stats := processFullDataset(ctx, config, headers, rows, workerCount, *batchSize, journal, 0)
+	if err := journal.close(); err != nil {
+		warnf("\nrun journal: %v", err)
+	}
+	printRemainingRows(stats.Remaining, len(rows), false)
+	enrichedRows, config.ColumnSpecs = dropStatusColumns(headers, enrichedRows, config.ColumnSpecs)
+
+	// Show what will change and confirm before writing
+	printOutputDiff(headers, rows, enrichedRows, config.ColumnSpecs)
+	if !config.AssumeYes && !confirm(fmt.Sprintf("\nSave output to %s? (y/n): ", *outputFile)) {
+		fmt.Println("Output not saved.")
+		return nil
+	}
+
+	// Update the run info with the regenerated columns
+	if info == nil {
+		info = &RunInfo{Command: "reprocess", Input: *inputFile, StartedAt: stats.StartTime, Rows: len(rows), Prompt: *prompt}
+	}
+	info.Output = *outputFile
+	info.FinishedAt = time.Now()
+	info.Tokens += stats.TotalTokens
+	info.InputTokens += stats.InputTokens
+	info.OutputTokens += stats.OutputTokens
+	info.EstimatedCost += stats.Cost()
+	for _, spec := range config.ColumnSpecs {
+		i := -1
+		for j, column := range info.Columns {
+			if column.Name == spec.Name {
+				i = j
+				break
+			}
+		}
+		if i == -1 {
+			info.Columns = append(info.Columns, RunColumn{Name: spec.Name})
+			i = len(info.Columns) - 1
+		}
+		if isStatusColumn(spec.Name) {
+			info.Columns[i].Source = "status"
+			continue
+		}
+		info.Columns[i].Model = config.modelFor(spec)
+		info.Columns[i].Source = ""
+		info.Columns[i].Prompt = ""
+		if *prompt != info.Prompt {
+			info.Columns[i].Prompt = *prompt
+		}
+	}
+
+	fmt.Println("\nSaving final output...")
+	output.Run = info
+	if err := saveOutputFile(*outputFile, headers, enrichedRows, config.ColumnSpecs, *output); err != nil {
+		return fmt.Errorf("error saving output: %v", err)
+	}
+	if err := writeRunInfo(*outputFile, info); err != nil {
+		warnf("could not write run info: %v", err)
+	}
+
+	printFinalStats(stats)
+	config.Cells.printSummary()
+	printWorkerTuning(config.tuner)
+	fmt.Printf("\nOutput saved to: %s\n", *outputFile)
+
+	if ctx.Err() != nil {
+		return fmt.Errorf("interrupted with %d rows not processed", len(stats.Remaining))
+	}
+	return nil
+}
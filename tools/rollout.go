@@ -0,0 +1,173 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"ai-general-tool/common"
+)
+
+// parseRolloutStages converts a spec like "1%,10%,100%" or "50,500,100%"
+// into cumulative row counts
+func parseRolloutStages(spec string, totalRows int) ([]int, error) {
+	var stages []int
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		var end int
+		if strings.HasSuffix(part, "%") {
+			pct, err := strconv.ParseFloat(strings.TrimSuffix(part, "%"), 64)
+			if err != nil || pct <= 0 || pct > 100 {
+				return nil, fmt.Errorf("invalid rollout stage '%s'", part)
+			}
+			end = int(math.Ceil(pct * float64(totalRows) / 100))
+		} else {
+			n, err := strconv.Atoi(part)
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("invalid rollout stage '%s'", part)
+			}
+			end = n
+		}
+
+		end = common.Min(common.Max(end, 1), totalRows)
+		if len(stages) > 0 && end <= stages[len(stages)-1] {
+			if end < stages[len(stages)-1] {
+				return nil, fmt.Errorf("rollout stages must be increasing")
+			}
+			continue
+		}
+		stages = append(stages, end)
+	}
+
+	if len(stages) == 0 {
+		return nil, fmt.Errorf("no rollout stages given")
+	}
+	return stages, nil
+}
+
+// runRollout processes the rows stage by stage, printing a quality summary
+// and asking for confirmation before each further stage. Rows of stages that
+// were not run keep empty generated columns.
+func runRollout(
+	ctx context.Context,
+	config *ProcessingConfig,
+	headers []string,
+	rows [][]string,
+	stages []int,
+	workerCount int,
+	batchSize int,
+	journal *runJournal,
+) ([][]string, *ProcessingStats) {
+	total := &ProcessingStats{
+		TotalRows: len(rows),
+		StartTime: time.Now(),
+	}
+
+	enrichedRows := make([][]string, len(rows))
+	for i, row := range rows {
+		enrichedRows[i] = make([]string, len(headers)+len(config.ColumnSpecs))
+		copy(enrichedRows[i], row)
+	}
+
+	start := 0
+	for i, end := range stages {
+		fmt.Printf("\n--- Stage %d/%d: rows %d-%d of %d ---\n", i+1, len(stages), start+1, end, len(rows))
+
+		stageRows, stageStats := processFullDataset(ctx, config, headers, rows[start:end], workerCount, batchSize, journal, start)
+		copy(enrichedRows[start:end], stageRows)
+
+		total.CompletedRows += stageStats.CompletedRows
+		total.FailedRows += stageStats.FailedRows
+		total.addUsage(stageStats.usage())
+		total.ResumedRows += stageStats.ResumedRows
+		total.Retries += stageStats.Retries
+		total.Workers = stageStats.Workers
+		total.Remaining = append(total.Remaining, stageStats.Remaining...)
+		total.Stopped = stageStats.Stopped
+
+		printStageSummary(headers, stageRows, config.ColumnSpecs, stageStats, len(rows)-end)
+		start = end
+
+		if ctx.Err() != nil || total.Stopped != nil || i == len(stages)-1 {
+			break
+		}
+		if !config.Deadline.IsZero() && !time.Now().Before(config.Deadline) {
+			fmt.Printf("Time budget reached after %d of %d rows.\n", end, len(rows))
+			break
+		}
+		next := stages[i+1] - end
+		if !config.AssumeYes && !confirm(fmt.Sprintf("\nContinue with next stage (%d rows)? (y/n): ", next)) {
+			fmt.Printf("Rollout stopped after %d of %d rows.\n", end, len(rows))
+			break
+		}
+	}
+
+	// Rows of stages that were not run
+	for r := start; r < len(rows); r++ {
+		total.Remaining = append(total.Remaining, r)
+	}
+	return enrichedRows, total
+}
+
+// printStageSummary reports failure and fill rates, value distributions and
+// the projected cost of the remaining rows
+func printStageSummary(headers []string, stageRows [][]string, columnSpecs []ColumnSpec, stats *ProcessingStats, remainingRows int) {
+	processed := int(stats.CompletedRows + stats.FailedRows)
+
+	fmt.Println("\n\nSTAGE SUMMARY:")
+	fmt.Printf("Rows: %d | Failed: %d (%s) | Tokens: %d | Cost: $%.4f\n",
+		processed, stats.FailedRows, common.FormatPercentage(int(stats.FailedRows), processed),
+		stats.TotalTokens, stats.Cost())
+
+	if processed > 0 && remainingRows > 0 {
+		projected := int64(float64(stats.TotalTokens) / float64(processed) * float64(remainingRows))
+		cost := stats.Cost() / float64(processed) * float64(remainingRows)
+		fmt.Printf("Projected for remaining %d rows: ~%d tokens, ~$%.4f\n", remainingRows, projected, cost)
+	}
+
+	summaryHeaders := []string{"Column", "Filled", "Distinct", "Top Values"}
+	var summaryRows [][]string
+	status := statusSpecIndex(columnSpecs)
+	for i, spec := range columnSpecs {
+		counts := make(map[string]int)
+		filled := 0
+		for _, row := range stageRows {
+			value := row[len(headers)+i]
+			if value == "" || rowStatus(row, headers, status) == journalError {
+				continue
+			}
+			counts[value]++
+			if !strings.EqualFold(value, "N/A") {
+				filled++
+			}
+		}
+
+		values := make([]string, 0, len(counts))
+		for value := range counts {
+			values = append(values, value)
+		}
+		sort.Slice(values, func(a, b int) bool {
+			if counts[values[a]] != counts[values[b]] {
+				return counts[values[a]] > counts[values[b]]
+			}
+			return values[a] < values[b]
+		})
+
+		var top []string
+		for _, value := range values[:common.Min(3, len(values))] {
+			top = append(top, fmt.Sprintf("%s (%d)", common.TruncateString(value, 20), counts[value]))
+		}
+
+		summaryRows = append(summaryRows, []string{
+			spec.Name,
+			fmt.Sprintf("%d (%s)", filled, common.FormatPercentage(filled, len(stageRows))),
+			fmt.Sprintf("%d", len(counts)),
+			strings.Join(top, ", "),
+		})
+	}
+	fmt.Println(common.FormatTable(summaryHeaders, summaryRows, 120))
+}
@@ -0,0 +1,178 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"strconv"
+
+	"github.com/openai/openai-go"
+)
+
+// Error classes of failed rows, so retries and reports can tell a rate limit
+// from a response that could not be read
+const (
+	errorRateLimit     = "rate_limit"
+	errorTimeout       = "timeout"
+	errorParse         = "parse"          // the response had no usable values
+	errorContentFilter = "content_filter" // the prompt or response was blocked
+	errorAPI           = "api"            // any other error returned by the API
+	errorOther         = "other"          // failures outside the API, e.g. an unreadable attachment
+)
+
+// Status columns added to the outputs of process-data, reprocess and enrich:
+// whether the row was done or failed, the class and message of its error, and
+// how many times its requests were sent. The generated columns of failed rows
+// are left empty. Outputs whose rows were all done get none.
+const (
+	statusColumn     = "_status"
+	errorClassColumn = "_error_class"
+	errorColumn      = "_error"
+	attemptsColumn   = "_attempts"
+)
+
+// statusColumnNames lists the status columns in output order
+var statusColumnNames = []string{statusColumn, errorClassColumn, errorColumn, attemptsColumn}
+
+// statusColumnSpecs returns the column specs of the status columns
+func statusColumnSpecs() []ColumnSpec {
+	specs := make([]ColumnSpec, len(statusColumnNames))
+	for i, name := range statusColumnNames {
+		specs[i] = ColumnSpec{Name: name, DataType: "string", Local: true}
+	}
+	return specs
+}
+
+// dropStatusColumns leaves the status columns out of an output whose rows
+// were all done, unless the input has them already: a clean run gets no
+// columns that only say so. It returns the rows and column specs to save.
+func dropStatusColumns(headers []string, enrichedRows [][]string, columnSpecs []ColumnSpec) ([][]string, []ColumnSpec) {
+	status := statusSpecIndex(columnSpecs)
+	if status == -1 || indexOf(headers, statusColumn) != -1 {
+		return enrichedRows, columnSpecs
+	}
+	for _, row := range enrichedRows {
+		if rowStatus(row, headers, status) != journalDone {
+			return enrichedRows, columnSpecs
+		}
+	}
+	kept := withoutStatusColumns(columnSpecs)
+	rows := make([][]string, len(enrichedRows))
+	for r, row := range enrichedRows {
+		rows[r] = make([]string, len(headers), len(headers)+len(kept))
+		copy(rows[r], row)
+		for i, spec := range columnSpecs {
+			if !isStatusColumn(spec.Name) {
+				rows[r] = append(rows[r], cell(row, len(headers)+i))
+			}
+		}
+	}
+	return rows, kept
+}
+
+// withoutStatusColumns returns the column specs other than the status columns
+func withoutStatusColumns(columnSpecs []ColumnSpec) []ColumnSpec {
+	var kept []ColumnSpec
+	for _, spec := range columnSpecs {
+		if !isStatusColumn(spec.Name) {
+			kept = append(kept, spec)
+		}
+	}
+	return kept
+}
+
+// isStatusColumn reports whether a column is one of the status columns
+func isStatusColumn(name string) bool {
+	for _, status := range statusColumnNames {
+		if name == status {
+			return true
+		}
+	}
+	return false
+}
+
+// statusSpecIndex returns the index of the status column among the column
+// specs, or -1
+func statusSpecIndex(columnSpecs []ColumnSpec) int {
+	for i, spec := range columnSpecs {
+		if spec.Name == statusColumn {
+			return i
+		}
+	}
+	return -1
+}
+
+// rowStatus returns the status of an enriched row, given the index of the
+// status column among the column specs: done, error, or empty for rows not
+// processed
+func rowStatus(row []string, headers []string, status int) string {
+	if status == -1 || len(headers)+status >= len(row) {
+		return ""
+	}
+	return row[len(headers)+status]
+}
+
+// classedError is an error whose class is known where it is made, such as a
+// response that cannot be parsed
+type classedError struct {
+	class string
+	err   error
+}
+
+func (e *classedError) Error() string { return e.err.Error() }
+func (e *classedError) Unwrap() error { return e.err }
+
+// withClass gives err the given class
+func withClass(class string, err error) error {
+	return &classedError{class: class, err: err}
+}
+
+// keepClass gives wrapped, an error adding context to cause, the class of
+// cause, which formatting it with %v loses
+func keepClass(cause, wrapped error) error {
+	return withClass(classifyError(cause), wrapped)
+}
+
+// classifyError returns the class of a row's error
+func classifyError(err error) string {
+	var classed *classedError
+	if errors.As(err, &classed) {
+		return classed.class
+	}
+	var apiErr *openai.Error
+	if errors.As(err, &apiErr) {
+		switch {
+		case apiErr.StatusCode == 429:
+			return errorRateLimit
+		case apiErr.StatusCode == 408 || apiErr.StatusCode == 504:
+			return errorTimeout
+		case apiErr.Code == "content_filter" || apiErr.Code == "content_policy_violation":
+			return errorContentFilter
+		}
+		return errorAPI
+	}
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr) && netErr.Timeout() {
+		return errorTimeout
+	}
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &syntaxErr) || errors.As(err, &typeErr) {
+		return errorParse
+	}
+	return errorOther
+}
+
+// setRowStatus fills the status columns of a row's results. class and err
+// are empty for rows that were done.
+func setRowStatus(results map[string]string, class string, err error, attempts int) {
+	results[statusColumn] = journalDone
+	results[errorClassColumn] = class
+	results[errorColumn] = ""
+	results[attemptsColumn] = strconv.Itoa(attempts)
+	if err != nil {
+		results[statusColumn] = journalError
+		results[errorColumn] = err.Error()
+	}
+}
@@ -0,0 +1,207 @@
+package tools
+
+import (
+	"flag"
+	"fmt"
+	"io"
+)
+
+// rowRange selects data rows by position: rows from (1-based) through to,
+// to 0 meaning the end, or with last the final n rows
+type rowRange struct {
+	from, to int
+	last     int
+}
+
+// RunHead handles the head command: it writes the first rows of a file,
+// reading no further than needed
+func RunHead(args []string) error {
+	fs := flag.NewFlagSet("head", flag.ExitOnError)
+	n := fs.Int("n", 10, "Number of rows")
+	return runRowRange(fs, args, func() (rowRange, error) {
+		if *n < 1 {
+			return rowRange{}, fmt.Errorf("-n must be at least 1")
+		}
+		return rowRange{from: 1, to: *n}, nil
+	})
+}
+
+// RunTail handles the tail command: it writes the last rows of a file,
+// streaming through it with only those rows in memory
+func RunTail(args []string) error {
+	fs := flag.NewFlagSet("tail", flag.ExitOnError)
+	n := fs.Int("n", 10, "Number of rows")
+	return runRowRange(fs, args, func() (rowRange, error) {
+		if *n < 1 {
+			return rowRange{}, fmt.Errorf("-n must be at least 1")
+		}
+		return rowRange{last: *n}, nil
+	})
+}
+
+// RunSlice handles the slice command: it writes a range of rows of a file,
+// streaming through it and stopping after the last one
+func RunSlice(args []string) error {
+	fs := flag.NewFlagSet("slice", flag.ExitOnError)
+	from := fs.Int("from", 1, "First data row, 1-based (the header row is not counted)")
+	to := fs.Int("to", 0, "Last data row, inclusive (default: the end of the file)")
+	count := fs.Int("count", 0, "Number of rows from -from, instead of -to")
+	return runRowRange(fs, args, func() (rowRange, error) {
+		if *from < 1 {
+			return rowRange{}, fmt.Errorf("-from must be at least 1")
+		}
+		if *count > 0 && *to > 0 {
+			return rowRange{}, fmt.Errorf("use -to or -count, not both")
+		}
+		if *count > 0 {
+			*to = *from + *count - 1
+		}
+		if *to > 0 && *to < *from {
+			return rowRange{}, fmt.Errorf("-to %d is before -from %d", *to, *from)
+		}
+		return rowRange{from: *from, to: *to}, nil
+	})
+}
+
+// runRowRange registers the flags shared by head, tail and slice, parses
+// them and writes the selected rows. CSV, stdin and Excel inputs are read
+// row by row; CSV outputs, the default being stdout, are written as rows
+// are selected.
+func runRowRange(fs *flag.FlagSet, args []string, selection func() (rowRange, error)) error {
+	// Define flags
+	inputFile := fs.String("input", "", "Input file (CSV, Excel or JSON)")
+	outputFile := fs.String("output", "", "Output file (default: CSV to stdout)")
+	fs.StringVar(outputFile, "o", "", "Shorthand for -output")
+	input := inputFlags(fs)
+	output := &OutputOptions{}
+	fs.StringVar(&output.Format, "format", "same", "Output format: same, csv, sqlite, ods, md (Markdown table), html")
+	fs.BoolVar(&output.QuoteAll, "quote-all", false, "Quote every field of CSV output")
+
+	// Parse flags
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	// Handle positional argument for filename
+	if *inputFile == "" && fs.NArg() > 0 {
+		*inputFile = fs.Arg(0)
+	}
+
+	// Validation
+	if *inputFile == "" {
+		return fmt.Errorf("input file is required")
+	}
+	r, err := selection()
+	if err != nil {
+		return err
+	}
+	if *outputFile == "" {
+		*outputFile = stdioName
+	}
+	toStdout, err := useStdout(*inputFile, outputFile, *output)
+	if err != nil {
+		return err
+	}
+	if *outputFile == *inputFile && *inputFile != stdioName {
+		return fmt.Errorf("output would overwrite the input %s", *inputFile)
+	}
+
+	var headers []string
+	var source rowSource
+	if canStreamInput(*inputFile) {
+		var closer io.Closer
+		if headers, source, closer, err = openStreamInput(*inputFile, *input); err != nil {
+			return fmt.Errorf("error loading input: %v", err)
+		}
+		defer closer.Close()
+	} else {
+		var rows [][]string
+		if headers, rows, err = loadInputFile(*inputFile, *input); err != nil {
+			return fmt.Errorf("error loading input: %v", err)
+		}
+		source = &sliceSource{rows: rows}
+	}
+
+	// CSV outputs are written as the rows come; other formats need them all
+	csvFormat := output.Format == "same" || output.Format == "csv"
+	streamed := csvFormat && (toStdout || (isCSVFile(*outputFile) && !isCloudURI(*outputFile)))
+	var writer csvRecordWriter
+	var file io.WriteCloser
+	var collected [][]string
+	if streamed {
+		w := io.Writer(dataStdout)
+		if !toStdout {
+			if file, err = createOutput(*outputFile); err != nil {
+				return err
+			}
+			defer func() {
+				if file != nil {
+					file.Close()
+				}
+			}()
+			w = file
+		}
+		writer = newCSVRecordWriter(w, output.QuoteAll)
+		if err := writer.Write(headers); err != nil {
+			return err
+		}
+	}
+	emit := func(row []string) error {
+		if !streamed {
+			collected = append(collected, row)
+			return nil
+		}
+		return writer.Write(padRow(row, len(headers)))
+	}
+
+	// Read up to the last selected row; tail keeps a ring of the last rows
+	read, written := 0, 0
+	var ring [][]string
+	for r.to == 0 || read < r.to {
+		row, err := source.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("error reading row %d: %v", read+1, err)
+		}
+		read++
+		switch {
+		case r.last > 0:
+			if len(ring) == r.last {
+				ring = ring[1:]
+			}
+			ring = append(ring, append([]string(nil), row...))
+		case read >= r.from:
+			if err := emit(row); err != nil {
+				return err
+			}
+			written++
+		}
+	}
+	for _, row := range ring {
+		if err := emit(row); err != nil {
+			return err
+		}
+		written++
+	}
+
+	if streamed {
+		writer.Flush()
+		if err := writer.Error(); err != nil {
+			return err
+		}
+		if file != nil {
+			err, file = file.Close(), nil
+			if err != nil {
+				return err
+			}
+		}
+	} else if err := saveOutputTable(*outputFile, headers, collected, nil, *output); err != nil {
+		return fmt.Errorf("error saving output: %v", err)
+	}
+	if !toStdout {
+		fmt.Printf("%d rows saved to: %s (%d rows read)\n", written, *outputFile, read)
+	}
+	return nil
+}
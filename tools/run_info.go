@@ -0,0 +1,92 @@
+package tools
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+)
+
+// runInfoSuffix is appended to the output file name to form the sidecar
+// describing how it was produced
+const runInfoSuffix = ".run.json"
+
+// RunInfo records how an output file was produced
+type RunInfo struct {
+	Command       string      `json:"command"`
+	Input         string      `json:"input"`
+	InputSHA256   string      `json:"input_sha256,omitempty"` // set for local input files
+	Output        string      `json:"output"`
+	Prompt        string      `json:"prompt,omitempty"`
+	Columns       []RunColumn `json:"columns"`
+	StartedAt     time.Time   `json:"started_at"`
+	FinishedAt    time.Time   `json:"finished_at"`
+	Rows          int         `json:"rows"`
+	CompletedRows int         `json:"completed_rows"`
+	FailedRows    int         `json:"failed_rows"`
+	Tokens        int64       `json:"tokens"`
+	InputTokens   int64       `json:"input_tokens,omitempty"`
+	OutputTokens  int64       `json:"output_tokens,omitempty"`
+	EstimatedCost float64     `json:"estimated_cost"` // from the model pricing table
+	DeadLetter    string      `json:"dead_letter,omitempty"`
+}
+
+// RunColumn describes one column added or overwritten by a run
+type RunColumn struct {
+	Name        string `json:"name"`
+	Model       string `json:"model,omitempty"`  // empty for columns computed locally
+	Source      string `json:"source,omitempty"` // what filled the column when not a model
+	Prompt      string `json:"prompt,omitempty"` // set when regenerated with a different prompt
+	Overwritten bool   `json:"overwritten,omitempty"`
+}
+
+// runColumns describes the column specs of a run
+func runColumns(config *ProcessingConfig, headers []string) []RunColumn {
+	columns := make([]RunColumn, len(config.ColumnSpecs))
+	for i, spec := range config.ColumnSpecs {
+		columns[i] = RunColumn{Name: spec.Name, Overwritten: indexOf(headers, spec.Name) != -1}
+		if spec.Name == rowHashColumn {
+			columns[i].Source = "row_hash"
+		} else if isStatusColumn(spec.Name) {
+			columns[i].Source = "status"
+		} else if spec.Local {
+			columns[i].Source = "web_search"
+		} else {
+			columns[i].Model = config.modelFor(spec)
+		}
+	}
+	return columns
+}
+
+// writeRunInfo saves the sidecar next to the output file
+func writeRunInfo(outputFile string, info *RunInfo) error {
+	if outputFile == stdioName {
+		return nil // no sidecar for stdout
+	}
+	data, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return err
+	}
+	if isCloudURI(outputFile) {
+		return saveCloudOutput(outputFile+runInfoSuffix, func(local string) error {
+			return os.WriteFile(local, append(data, '\n'), 0644)
+		})
+	}
+	return os.WriteFile(outputFile+runInfoSuffix, append(data, '\n'), 0644)
+}
+
+// readRunInfo loads the sidecar of an output file, returning nil when the
+// file has none
+func readRunInfo(outputFile string) (*RunInfo, error) {
+	data, err := os.ReadFile(outputFile + runInfoSuffix)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var info RunInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
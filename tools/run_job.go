@@ -0,0 +1,322 @@
+package tools
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"ai-general-tool/common"
+
+	"gopkg.in/yaml.v3"
+)
+
+// jobSpec is a job file of the run-job command: everything a process-data
+// run needs, kept in a file that can be reviewed and re-run
+type jobSpec struct {
+	Name        string            `yaml:"name"`
+	Description string            `yaml:"description"`
+	Input       string            `yaml:"input"`
+	Filter      jobFilter         `yaml:"filter"` // row expressions, all of which must match
+	Prompt      string            `yaml:"prompt"`
+	Model       string            `yaml:"model"`
+	Columns     []jobColumn       `yaml:"columns"`
+	Provider    *jobProvider      `yaml:"provider"`
+	Options     map[string]string `yaml:"options"`  // other process-data flags, e.g. sheet or workers
+	Validate    yaml.Node         `yaml:"validate"` // schema file, or the schema itself, checked on the output
+	Output      string            `yaml:"output"`
+}
+
+// jobColumn is a generated column: a name with its type, model and a
+// description added to the prompt. A plain string is read as in -columns,
+// e.g. risk:number@gpt-4o.
+type jobColumn struct {
+	Name        string `yaml:"name"`
+	Type        string `yaml:"type"`
+	Model       string `yaml:"model"`
+	Description string `yaml:"description"`
+}
+
+// UnmarshalYAML reads a column given as a mapping or as a -columns string
+func (c *jobColumn) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		specs := parseColumnSpecs(node.Value)
+		if len(specs) != 1 {
+			return fmt.Errorf("line %d: list one column per entry", node.Line)
+		}
+		*c = jobColumn{Name: specs[0].Name, Type: specs[0].DataType, Model: specs[0].Model}
+		return nil
+	}
+	type plain jobColumn
+	return node.Decode((*plain)(c))
+}
+
+// jobFilter holds the row expressions of a job, given as one string or a list
+type jobFilter []string
+
+// UnmarshalYAML reads a filter given as a string or a list of strings
+func (f *jobFilter) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*f = jobFilter{node.Value}
+		return nil
+	}
+	var list []string
+	if err := node.Decode(&list); err != nil {
+		return err
+	}
+	*f = list
+	return nil
+}
+
+// jobProvider is the API a job's columns are generated with; it overrides
+// aitool.yaml
+type jobProvider struct {
+	Name      string `yaml:"name"`
+	BaseURL   string `yaml:"base_url"`
+	APIKeyEnv string `yaml:"api_key_env"`
+	RateLimit int    `yaml:"rate_limit"`
+}
+
+// jobFields are the process-data flags set by fields of the job file rather
+// than its options
+var jobFields = map[string]string{
+	"input": "input", "output": "output", "prompt": "prompt", "columns": "columns",
+	"model": "model", "where": "filter",
+}
+
+// RunJob handles the run-job command: it runs the process-data job described
+// by a YAML file and checks its output against the job's validation schema
+func RunJob(args []string) error {
+	fs := flag.NewFlagSet("run-job", flag.ExitOnError)
+
+	// Define flags
+	inputFile := fs.String("input", "", "Input file replacing the job's input")
+	outputFile := fs.String("output", "", "Output file replacing the job's output")
+	assumeYes := fs.Bool("yes", false, "Skip confirmation prompts")
+	dryRun := fs.Bool("dry-run", false, "Print the process-data command the job runs, without running it")
+	resume := fs.Bool("resume", false, "Continue an interrupted run of the job from its run journal, when its output allows it")
+
+	// Parse flags
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("a job file is required: run-job [flags] <job.yaml>")
+	}
+	jobFile := fs.Arg(0)
+
+	job, err := loadJob(jobFile)
+	if err != nil {
+		return fmt.Errorf("error loading job %s: %v", jobFile, err)
+	}
+	if *inputFile != "" {
+		job.Input = *inputFile
+	}
+	if *outputFile != "" {
+		job.Output = *outputFile
+	}
+	if job.Input == "" {
+		return fmt.Errorf("job %s has no input; set input in the job or use -input", jobFile)
+	}
+
+	var schema *validateSchema
+	if !job.Validate.IsZero() {
+		if schema, err = job.schema(); err != nil {
+			return fmt.Errorf("job %s: invalid validate: %v", jobFile, err)
+		}
+		if job.Output == "" {
+			if job.Options["output-template"] != "" {
+				return fmt.Errorf("job %s: validate needs the job's output, not an output-template", jobFile)
+			}
+			format := job.Options["format"]
+			if format == "" {
+				format = "same"
+			}
+			job.Output = defaultOutputFile(job.Input, format)
+		}
+		if job.Output == stdioName {
+			return fmt.Errorf("job %s: validate needs an output file, not stdout", jobFile)
+		}
+	}
+	validated := job.Output
+	if schema != nil {
+		output := OutputOptions{Compress: job.Options["compress"]}
+		if validated, err = output.compressedName(job.Output); err != nil {
+			return err
+		}
+	}
+
+	processArgs := job.args()
+	if *assumeYes {
+		processArgs = append([]string{"-yes"}, processArgs...)
+	}
+	if *resume {
+		if resumable(processArgs) {
+			processArgs = append([]string{"-resume"}, processArgs...)
+		} else {
+			notef("the job streams or writes its output elsewhere, so it runs again from the start")
+		}
+	}
+
+	title := job.Name
+	if title == "" {
+		title = jobFile
+	}
+	fmt.Printf("=== JOB: %s ===\n", title)
+	if job.Description != "" {
+		fmt.Println(strings.TrimSpace(job.Description))
+	}
+	if *dryRun {
+		quoted := make([]string, len(processArgs))
+		for i, arg := range processArgs {
+			quoted[i] = quoteArg(arg)
+		}
+		fmt.Printf("process-data %s\n", strings.Join(quoted, " "))
+		if schema != nil {
+			fmt.Printf("Then validates %s against the job's schema\n", validated)
+		}
+		return nil
+	}
+
+	if job.Provider != nil {
+		jobSettings = &Settings{
+			Provider:  job.Provider.Name,
+			BaseURL:   job.Provider.BaseURL,
+			APIKeyEnv: job.Provider.APIKeyEnv,
+			RateLimit: job.Provider.RateLimit,
+			Sources:   []string{jobFile},
+		}
+		defer func() { jobSettings = nil }()
+	}
+
+	// An output left as it was means the run was cancelled at a prompt
+	before, _ := os.Stat(validated)
+	if err := RunProcessData(processArgs); err != nil {
+		return err
+	}
+	if schema == nil {
+		return nil
+	}
+	after, err := os.Stat(validated)
+	if err != nil || before != nil && after.ModTime().Equal(before.ModTime()) {
+		fmt.Println("Output not written; skipping validation")
+		return nil
+	}
+	return validateFile(validated, InputOptions{Table: job.Options["output-table"]}, schema, jobFile, 20, "", common.Locale{})
+}
+
+// loadJob reads a job file, rejecting unknown fields so that typos do not
+// silently change a run
+func loadJob(filename string) (*jobSpec, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	var job jobSpec
+	if err := decoder.Decode(&job); err != nil {
+		return nil, err
+	}
+
+	if strings.TrimSpace(job.Prompt) == "" {
+		return nil, fmt.Errorf("no prompt")
+	}
+	if len(job.Columns) == 0 {
+		return nil, fmt.Errorf("no columns")
+	}
+	for i, column := range job.Columns {
+		if column.Name == "" {
+			return nil, fmt.Errorf("column %d has no name", i+1)
+		}
+		if strings.ContainsAny(column.Name, ",:@") || strings.ContainsAny(column.Type, ",@") || strings.Contains(column.Model, ",") {
+			return nil, fmt.Errorf("column %s: names, types and models cannot contain , : or @", column.Name)
+		}
+	}
+	for name := range job.Options {
+		if field, ok := jobFields[strings.TrimLeft(name, "-")]; ok {
+			return nil, fmt.Errorf("option %s is set by the job's %s field", name, field)
+		}
+	}
+	return &job, nil
+}
+
+// schema returns the job's validation schema: the file it names or the
+// schema written in the job
+func (job *jobSpec) schema() (*validateSchema, error) {
+	if job.Validate.Kind == yaml.ScalarNode {
+		return loadValidateSchema(job.Validate.Value, common.Locale{})
+	}
+	data, err := yaml.Marshal(&job.Validate)
+	if err != nil {
+		return nil, err
+	}
+	return parseValidateSchema(data, common.Locale{})
+}
+
+// args returns the process-data arguments of the job: its options in name
+// order, then the flags of its fields
+func (job *jobSpec) args() []string {
+	names := make([]string, 0, len(job.Options))
+	for name := range job.Options {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var args []string
+	for _, name := range names {
+		args = append(args, "-"+strings.TrimLeft(name, "-")+"="+job.Options[name])
+	}
+
+	columns := make([]string, len(job.Columns))
+	for i, column := range job.Columns {
+		columns[i] = column.Name
+		if column.Type != "" {
+			columns[i] += ":" + column.Type
+		}
+		if column.Model != "" {
+			columns[i] += "@" + column.Model
+		}
+	}
+	args = append(args, "-input", job.Input, "-columns", strings.Join(columns, ","), "-prompt", job.prompt())
+	if job.Model != "" {
+		args = append(args, "-model", job.Model)
+	}
+	if len(job.Filter) > 0 {
+		where := job.Filter[0]
+		if len(job.Filter) > 1 {
+			where = "(" + strings.Join(job.Filter, ") && (") + ")"
+		}
+		args = append(args, "-where", where)
+	}
+	if job.Output != "" {
+		args = append(args, "-output", job.Output)
+	}
+	return args
+}
+
+// prompt returns the job's prompt followed by the descriptions of its columns
+func (job *jobSpec) prompt() string {
+	var lines []string
+	for _, column := range job.Columns {
+		if column.Description != "" {
+			lines = append(lines, fmt.Sprintf("- %s: %s", column.Name, strings.TrimSpace(column.Description)))
+		}
+	}
+	prompt := strings.TrimSpace(job.Prompt)
+	if len(lines) == 0 {
+		return prompt
+	}
+	return prompt + "\n\nColumns:\n" + strings.Join(lines, "\n")
+}
+
+// quoteArg quotes a command-line argument for display when it holds spaces
+// or quotes
+func quoteArg(arg string) string {
+	if arg != "" && !strings.ContainsAny(arg, " \t\n'\"\\$`*?&|;<>()") {
+		return arg
+	}
+	return strconv.Quote(arg)
+}
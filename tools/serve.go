@@ -0,0 +1,669 @@
+package tools
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"ai-general-tool/common"
+
+	"github.com/openai/openai-go"
+)
+
+// serveMaxUpload caps the size of a file uploaded to the server
+const serveMaxUpload = 512 << 20
+
+// serveMaxSample caps the rows of a sample run
+const serveMaxSample = 20
+
+// serveExtensions are the file types the server lists and accepts
+var serveExtensions = map[string]bool{
+	".csv": true, ".tsv": true, ".txt": true, ".xlsx": true, ".xlsm": true, ".xls": true,
+	".ods": true, ".json": true, ".sqlite": true, ".db": true,
+}
+
+// Job states
+const (
+	jobRunning   = "running"
+	jobDone      = "done"
+	jobFailed    = "failed"
+	jobCancelled = "cancelled"
+)
+
+// RunServe handles the serve command: it starts a local web app where a file
+// can be uploaded or picked, previewed, enriched on a sample and then in
+// full with live progress, and the result downloaded, and a REST API
+// submitting the same enrichments from other programs
+func RunServe(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+
+	// Define flags
+	ui := fs.Bool("ui", false, "Serve the web app")
+	api := fs.String("api", "", "Serve the REST API at this address, e.g. :8080; with -ui the web app is served there too")
+	addr := fs.String("addr", "localhost:8765", "Address the web app listens on without -api")
+	dir := fs.String("dir", ".", "Directory whose files are listed; uploads and results are saved there")
+	token := fs.String("token", os.Getenv(apiTokenEnv), "Bearer token required by the REST API (default: $"+apiTokenEnv+")")
+
+	// Parse flags
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if !*ui && *api == "" {
+		return fmt.Errorf("nothing to serve: use -ui and/or -api <address>")
+	}
+	if info, err := os.Stat(*dir); err != nil || !info.IsDir() {
+		return fmt.Errorf("-dir %s is not a directory", *dir)
+	}
+
+	client, err := newOpenAIClient()
+	if err != nil {
+		return err
+	}
+	s := &server{dir: *dir, client: client, jobs: make(map[string]*serveJob)}
+
+	mux := http.NewServeMux()
+	listen := *addr
+	if *api != "" {
+		s.routeAPI(mux, *token)
+		listen = *api
+	}
+	if *ui {
+		s.routeUI(mux)
+	}
+	listener, err := net.Listen("tcp", listen)
+	if err != nil {
+		return err
+	}
+	local := false
+	if host, _, _ := net.SplitHostPort(listen); host == "localhost" || host == "127.0.0.1" || host == "::1" {
+		local = true
+	}
+	if *ui && !local {
+		warnf("the web app has no login; anyone who can reach this address can read the files of -dir and spend API credits")
+	}
+	if *api != "" && *token == "" && !local {
+		warnf("the REST API has no token; set -token or %s to require one", apiTokenEnv)
+	}
+	fmt.Printf("Serving %s at http://%s (Ctrl+C to stop)\n", *dir, listener.Addr())
+
+	ctx, cancel := interruptContext()
+	defer cancel()
+	srv := &http.Server{Handler: mux}
+	go func() {
+		<-ctx.Done()
+		s.cancelJobs()
+		shutdown, done := context.WithTimeout(context.Background(), 5*time.Second)
+		defer done()
+		srv.Shutdown(shutdown)
+	}()
+	if err := srv.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// server holds the files, client and jobs of the serve command
+type server struct {
+	dir    string
+	client *openai.Client
+
+	mu     sync.Mutex
+	jobs   map[string]*serveJob
+	nextID int
+}
+
+// serveRequest describes an enrichment: the file, sheet, prompt and columns
+// as for process-data, and how to run it
+type serveRequest struct {
+	File    string `json:"file,omitempty"`
+	Input   string `json:"input,omitempty"`  // object-store URI read instead of a file, e.g. s3://bucket/tickets.csv
+	Output  string `json:"output,omitempty"` // object-store URI the result is written to instead of the directory
+	Sheet   string `json:"sheet,omitempty"`
+	Prompt  string `json:"prompt"`
+	Columns string `json:"columns"` // as -columns, e.g. "category,risk@gpt-4o"
+	Model   string `json:"model,omitempty"`
+	Workers int    `json:"workers,omitempty"`
+	Sample  int    `json:"sample,omitempty"` // rows of a sample run
+	Format  string `json:"format,omitempty"` // same, csv, xlsx or ods
+}
+
+// serveJob is a full enrichment run by the server
+type serveJob struct {
+	ID       string    `json:"id"`
+	File     string    `json:"file"`
+	Output   string    `json:"output,omitempty"` // relative to the served directory, set when saved
+	State    string    `json:"state"`
+	Error    string    `json:"error,omitempty"`
+	Progress Progress  `json:"progress"`
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished,omitzero"`
+
+	cancel context.CancelFunc
+	target string // where the result is saved
+}
+
+// routeUI registers the web app and the endpoints it calls
+func (s *server) routeUI(mux *http.ServeMux) {
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		io.WriteString(w, serveUIPage)
+	})
+	mux.HandleFunc("GET /ui/files", s.handleFiles)
+	mux.HandleFunc("POST /ui/upload", s.handleUpload)
+	mux.HandleFunc("GET /ui/preview", s.handlePreview)
+	mux.HandleFunc("POST /ui/sample", s.handleSample)
+	mux.HandleFunc("POST /ui/jobs", s.handleStartJob)
+	mux.HandleFunc("GET /ui/jobs", s.handleJobs)
+	mux.HandleFunc("GET /ui/jobs/{id}", s.handleJob)
+	mux.HandleFunc("POST /ui/jobs/{id}/cancel", s.handleCancelJob)
+	mux.HandleFunc("GET /ui/download", s.handleDownload)
+}
+
+// servedFile is a data file of the served directory
+type servedFile struct {
+	Name     string    `json:"name"` // slash-separated path within the directory
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+}
+
+// handleFiles lists the data files of the served directory and its
+// subdirectories, newest first
+func (s *server) handleFiles(w http.ResponseWriter, r *http.Request) {
+	var files []servedFile
+	err := filepath.WalkDir(s.dir, func(p string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if entry.IsDir() {
+			if p != s.dir && strings.HasPrefix(entry.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !serveExtensions[dataExt(entry.Name())] {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil
+		}
+		rel, _ := filepath.Rel(s.dir, p)
+		files = append(files, servedFile{Name: filepath.ToSlash(rel), Size: info.Size(), Modified: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Modified.After(files[j].Modified) })
+	writeJSON(w, files)
+}
+
+// handleUpload saves an uploaded file in the served directory, renaming it
+// rather than replacing an existing file
+func (s *server) handleUpload(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, serveMaxUpload)
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+	defer file.Close()
+	name, err := s.saveUpload(header.Filename, file)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, map[string]string{"name": name})
+}
+
+// saveUpload writes an uploaded file into the served directory and returns
+// its name there
+func (s *server) saveUpload(filename string, src io.Reader) (string, error) {
+	base := filepath.Base(filepath.FromSlash(filename))
+	if !serveExtensions[dataExt(base)] {
+		return "", fmt.Errorf("unsupported file type '%s'", filepath.Ext(base))
+	}
+	name := uniqueName(s.dir, base, nil)
+	dst, err := os.OpenFile(filepath.Join(s.dir, name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		os.Remove(dst.Name())
+		return "", err
+	}
+	return name, dst.Close()
+}
+
+// resolve returns the path of a file of the served directory, refusing
+// names outside it
+func (s *server) resolve(name string) (string, error) {
+	if strings.TrimSpace(name) == "" {
+		return "", fmt.Errorf("no file given")
+	}
+	clean := path.Clean("/" + name)
+	if strings.Contains(clean, "/.") || !serveExtensions[dataExt(clean)] {
+		return "", fmt.Errorf("file %s cannot be served", name)
+	}
+	p := filepath.Join(s.dir, filepath.FromSlash(clean))
+	if _, err := os.Stat(p); err != nil {
+		return "", fmt.Errorf("file %s not found", name)
+	}
+	return p, nil
+}
+
+// filePreview is what the web app shows of a file: its sheets, columns and
+// first rows
+type filePreview struct {
+	File    string          `json:"file"`
+	Sheets  []string        `json:"sheets,omitempty"`
+	Rows    int             `json:"rows"`
+	Columns []ColumnSummary `json:"columns"`
+	Headers []string        `json:"headers"`
+	First   [][]string      `json:"first"`
+}
+
+// handlePreview describes a file's columns and returns its first rows
+func (s *server) handlePreview(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("file")
+	p, err := s.resolve(name)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, err)
+		return
+	}
+	preview := filePreview{File: name}
+	if isExcelWorkbook(p) || isODSFile(p) || isXLSFile(p) {
+		sheets, err := summarizeSheets(p)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err)
+			return
+		}
+		for _, sheet := range sheets {
+			preview.Sheets = append(preview.Sheets, sheet.Name)
+		}
+	}
+	headers, rows, err := loadInputFile(p, InputOptions{Sheet: r.URL.Query().Get("sheet")})
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+	preview.Rows = len(rows)
+	preview.Headers = headers
+	preview.Columns = DescribeColumns(headers, rows, common.Locale{})
+	preview.First = rows[:min(len(rows), 10)]
+	writeJSON(w, preview)
+}
+
+// sampleRow is a row of a sample run: its input, generated values and error
+type sampleRow struct {
+	Input   map[string]string `json:"input"`
+	Results map[string]string `json:"results,omitempty"`
+	Error   string            `json:"error,omitempty"`
+}
+
+// sampleReply is the result of a sample run, with the cost projected over
+// the whole file
+type sampleReply struct {
+	Rows          []sampleRow `json:"rows"`
+	Tokens        int64       `json:"tokens"`
+	Cost          float64     `json:"cost"`
+	TotalRows     int         `json:"total_rows"`
+	ProjectedCost float64     `json:"projected_cost"`
+}
+
+// handleSample generates the columns for the first rows of a file
+func (s *server) handleSample(w http.ResponseWriter, r *http.Request) {
+	req, err := decodeServeRequest(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+	config, headers, rows, err := s.prepare(req)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	n := req.Sample
+	if n <= 0 {
+		n = 5
+	}
+	reply := sampleReply{TotalRows: len(rows)}
+	outcome := &sampleOutcome{}
+	start := time.Now()
+	for _, row := range rows[:min(n, serveMaxSample, len(rows))] {
+		rowData := rowToMap(headers, row)
+		outcome.Rows = append(outcome.Rows, rowData)
+		result, err := processRow(r.Context(), config, rowData)
+		if err != nil {
+			reply.Rows = append(reply.Rows, sampleRow{Input: rowData, Error: err.Error()})
+			continue
+		}
+		outcome.Results = append(outcome.Results, result.Results)
+		reply.Rows = append(reply.Rows, sampleRow{Input: rowData, Results: result.Results})
+		reply.Tokens += result.Usage.Total()
+		reply.Cost += result.Usage.Cost
+	}
+	outcome.Elapsed = time.Since(start)
+	if estimate, err := estimateRun(config, outcome); err == nil {
+		reply.ProjectedCost = (estimate.InputCost + estimate.OutputCost) * float64(len(rows))
+	}
+	writeJSON(w, reply)
+}
+
+// handleStartJob starts enriching a whole file in the background
+func (s *server) handleStartJob(w http.ResponseWriter, r *http.Request) {
+	req, err := decodeServeRequest(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+	job, err := s.start(req)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, job)
+}
+
+// start checks a request, then processes its file in the background
+func (s *server) start(req *serveRequest) (*serveJob, error) {
+	config, headers, rows, err := s.prepare(req)
+	if err != nil {
+		return nil, err
+	}
+	workers := req.Workers
+	if workers <= 0 {
+		workers = 10
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	output, options, err := s.outputFor(req)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s.nextID++
+	job := &serveJob{
+		ID:       strconv.Itoa(s.nextID),
+		File:     cmp.Or(req.File, req.Input),
+		State:    jobRunning,
+		Progress: Progress{Time: time.Now(), Total: len(rows)},
+		Started:  time.Now(),
+		cancel:   cancel,
+		target:   output,
+	}
+	s.jobs[job.ID] = job
+
+	config.OnEvent = func(event Event) {
+		s.mu.Lock()
+		job.Progress = eventProgress(event)
+		s.mu.Unlock()
+	}
+	go func() {
+		defer cancel()
+		enriched, stats := ProcessRows(ctx, config, headers, rows, workers, 100, "")
+		enriched, columnSpecs := dropStatusColumns(headers, enriched, config.ColumnSpecs)
+		outHeaders, outRows := mergeGeneratedColumns(headers, enriched, columnSpecs)
+		target := output
+		if !isCloudURI(target) {
+			target = filepath.Join(s.dir, filepath.FromSlash(output))
+		}
+		err := saveOutputTable(target, outHeaders, outRows, nil, options)
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		job.Progress = stats.progress()
+		job.Finished = time.Now()
+		switch {
+		case err != nil:
+			job.State, job.Error = jobFailed, fmt.Sprintf("error saving output: %v", err)
+			return
+		case ctx.Err() != nil:
+			job.State = jobCancelled
+		default:
+			job.State = jobDone
+		}
+		job.Output = output
+	}()
+	return job.snapshot(), nil
+}
+
+// prepare loads the file of a request and builds its processing config
+func (s *server) prepare(req *serveRequest) (*ProcessingConfig, []string, [][]string, error) {
+	if strings.TrimSpace(req.Prompt) == "" {
+		return nil, nil, nil, fmt.Errorf("a prompt is required")
+	}
+	if strings.TrimSpace(req.Columns) == "" {
+		return nil, nil, nil, fmt.Errorf("columns to generate are required")
+	}
+	source := req.Input
+	switch {
+	case req.File != "" && req.Input != "":
+		return nil, nil, nil, fmt.Errorf("give either a file or an input URI, not both")
+	case source != "":
+		if !isCloudURI(source) {
+			return nil, nil, nil, fmt.Errorf("input must be an object-store URI (s3://, gs:// or az://)")
+		}
+	default:
+		p, err := s.resolve(req.File)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		source = p
+	}
+	headers, rows, err := loadInputFile(source, InputOptions{Sheet: req.Sheet})
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("error loading %s: %v", cmp.Or(req.File, req.Input), err)
+	}
+	model := req.Model
+	if model == "" {
+		model = defaultModel
+	}
+	config := &ProcessingConfig{
+		Client:      s.client,
+		ColumnSpecs: append(parseColumnSpecs(req.Columns), statusColumnSpecs()...),
+		Prompt:      req.Prompt,
+		Model:       model,
+		AssumeYes:   true,
+		Quiet:       true,
+		Hidden:      make(map[string]bool),
+	}
+	for _, spec := range config.ColumnSpecs {
+		if spec.Name == "" {
+			return nil, nil, nil, fmt.Errorf("invalid columns '%s'", req.Columns)
+		}
+	}
+	return config, headers, rows, nil
+}
+
+// outputFor names the result of a request after its file, e.g.
+// tickets_enriched.xlsx, without replacing an existing file or the result of
+// another job. The caller holds the server's lock.
+func (s *server) outputFor(req *serveRequest) (string, OutputOptions, error) {
+	options := OutputOptions{Format: req.Format}
+	ext := ""
+	switch req.Format {
+	case "", "same":
+		options.Format = "same"
+	case "xlsx":
+		options.Format, ext = "same", ".xlsx"
+	case "csv", "ods":
+	default:
+		return "", options, fmt.Errorf("unknown format '%s' (use same, csv, xlsx or ods)", req.Format)
+	}
+	if req.Output != "" {
+		if !isCloudURI(req.Output) {
+			return "", options, fmt.Errorf("output must be an object-store URI (s3://, gs:// or az://)")
+		}
+		return req.Output, options, nil
+	}
+
+	source := req.File
+	if req.Input != "" {
+		source = path.Base(req.Input)
+	}
+	name := defaultOutputFile(source, options.Format)
+	if ext != "" {
+		name = outputStem(source) + "_enriched" + ext
+	}
+	taken := make(map[string]bool)
+	for _, job := range s.jobs {
+		taken[job.target] = true
+	}
+	return uniqueName(s.dir, name, taken), options, nil
+}
+
+// uniqueName returns name, or when a file of dir or taken has it, name
+// numbered before its extension, e.g. data_2.csv.gz
+func uniqueName(dir, name string, taken map[string]bool) string {
+	ext := dataExt(name)
+	if strings.HasSuffix(strings.ToLower(name), gzipSuffix) {
+		ext += gzipSuffix
+	}
+	stem := name[:len(name)-len(ext)]
+	for i := 2; ; i++ {
+		if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(name))); os.IsNotExist(err) && !taken[name] {
+			return name
+		}
+		name = fmt.Sprintf("%s_%d%s", stem, i, ext)
+	}
+}
+
+// handleJobs lists the jobs of the server, newest first
+func (s *server) handleJobs(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	jobs := make([]*serveJob, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		jobs = append(jobs, job.snapshot())
+	}
+	s.mu.Unlock()
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].Started.After(jobs[j].Started) })
+	writeJSON(w, jobs)
+}
+
+// handleJob returns the state and progress of a job
+func (s *server) handleJob(w http.ResponseWriter, r *http.Request) {
+	job := s.job(r.PathValue("id"))
+	if job == nil {
+		writeJSONError(w, http.StatusNotFound, fmt.Errorf("job %s not found", r.PathValue("id")))
+		return
+	}
+	writeJSON(w, job)
+}
+
+// handleCancelJob stops a running job; the rows done so far are saved
+func (s *server) handleCancelJob(w http.ResponseWriter, r *http.Request) {
+	job := s.cancelJob(r.PathValue("id"))
+	if job == nil {
+		writeJSONError(w, http.StatusNotFound, fmt.Errorf("job %s not found", r.PathValue("id")))
+		return
+	}
+	writeJSON(w, job)
+}
+
+// handleDownload sends a file of the served directory as an attachment
+func (s *server) handleDownload(w http.ResponseWriter, r *http.Request) {
+	p, err := s.resolve(r.URL.Query().Get("file"))
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, err)
+		return
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filepath.Base(p)))
+	http.ServeFile(w, r, p)
+}
+
+// job returns a copy of a job, or nil when there is none with the id
+func (s *server) job(id string) *serveJob {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[id]
+	if !ok {
+		return nil
+	}
+	return job.snapshot()
+}
+
+// cancelJob stops a job and returns a copy of it, or nil when there is none
+// with the id
+func (s *server) cancelJob(id string) *serveJob {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[id]
+	if !ok {
+		return nil
+	}
+	job.cancel()
+	return job.snapshot()
+}
+
+// snapshot copies a job for a reply; the caller holds the server's lock
+func (job *serveJob) snapshot() *serveJob {
+	c := *job
+	return &c
+}
+
+// cancelJobs stops every running job, when the server shuts down
+func (s *server) cancelJobs() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, job := range s.jobs {
+		job.cancel()
+	}
+}
+
+// eventProgress returns the running state carried by an engine event
+func eventProgress(event Event) Progress {
+	switch ev := event.(type) {
+	case RowCompleted:
+		return ev.Progress
+	case ErrorEvent:
+		return ev.Progress
+	case BatchSaved:
+		return ev.Progress
+	case BudgetWarning:
+		return ev.Progress
+	}
+	return Progress{Time: event.EventTime()}
+}
+
+// decodeServeRequest reads the JSON body of a request
+func decodeServeRequest(r *http.Request) (*serveRequest, error) {
+	var req serveRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		return nil, fmt.Errorf("invalid request: %v", err)
+	}
+	return &req, nil
+}
+
+// writeJSON sends a value as JSON
+func writeJSON(w http.ResponseWriter, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(value)
+}
+
+// writeJSONError sends an error as JSON {"error": "..."} with a status code
+func writeJSONError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
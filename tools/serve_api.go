@@ -0,0 +1,169 @@
+package tools
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// apiTokenEnv holds the bearer token the REST API requires when -token is
+// not given
+const apiTokenEnv = "AITOOL_API_TOKEN"
+
+// apiJob is a job as the REST API reports it, with the URL of its result
+type apiJob struct {
+	*serveJob
+	Result string `json:"result,omitempty"` // set once the result is saved in the served directory
+}
+
+// newAPIJob adds the result URL to a job
+func newAPIJob(job *serveJob) apiJob {
+	out := apiJob{serveJob: job}
+	if job.Output != "" && !isCloudURI(job.Output) {
+		out.Result = "/api/jobs/" + job.ID + "/result"
+	}
+	return out
+}
+
+// routeAPI registers the REST API endpoints, requiring the token when set
+func (s *server) routeAPI(mux *http.ServeMux, token string) {
+	handle := func(pattern string, handler http.HandlerFunc) {
+		mux.Handle(pattern, requireToken(token, handler))
+	}
+	handle("POST /api/jobs", s.handleAPISubmit)
+	handle("GET /api/jobs", s.handleAPIJobs)
+	handle("GET /api/jobs/{id}", s.handleAPIJob)
+	handle("POST /api/jobs/{id}/cancel", s.handleAPICancel)
+	handle("GET /api/jobs/{id}/result", s.handleAPIResult)
+	handle("POST /api/sample", s.handleSample)
+}
+
+// requireToken rejects requests without the bearer token; an empty token
+// lets every request through
+func requireToken(token string, next http.Handler) http.Handler {
+	if token == "" {
+		return next
+	}
+	want := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), want) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeJSONError(w, http.StatusUnauthorized, fmt.Errorf("missing or invalid bearer token"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleAPISubmit starts a job. The body is the job spec as JSON, or a
+// multipart form with the spec in its "spec" field and the file to enrich in
+// its "file" field.
+func (s *server) handleAPISubmit(w http.ResponseWriter, r *http.Request) {
+	var req *serveRequest
+	var err error
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		req, err = s.decodeMultipartRequest(w, r)
+	} else {
+		req, err = decodeServeRequest(r)
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+	job, err := s.start(req)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+	w.Header().Set("Location", "/api/jobs/"+job.ID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(newAPIJob(job))
+}
+
+// decodeMultipartRequest reads the spec of a multipart submission and saves
+// its file in the served directory
+func (s *server) decodeMultipartRequest(w http.ResponseWriter, r *http.Request) (*serveRequest, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, serveMaxUpload)
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		return nil, fmt.Errorf("invalid form: %v", err)
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	var req serveRequest
+	decoder := json.NewDecoder(strings.NewReader(r.FormValue("spec")))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		return nil, fmt.Errorf("invalid spec: %v", err)
+	}
+	file, header, err := r.FormFile("file")
+	if err == http.ErrMissingFile {
+		return &req, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	if req.File != "" || req.Input != "" {
+		return nil, fmt.Errorf("the spec names a file or input as well as uploading one")
+	}
+	if req.File, err = s.saveUpload(header.Filename, file); err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+// handleAPIJobs lists the jobs, newest first
+func (s *server) handleAPIJobs(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	jobs := make([]apiJob, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		jobs = append(jobs, newAPIJob(job.snapshot()))
+	}
+	s.mu.Unlock()
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].Started.After(jobs[j].Started) })
+	writeJSON(w, jobs)
+}
+
+// handleAPIJob returns the state and progress of a job
+func (s *server) handleAPIJob(w http.ResponseWriter, r *http.Request) {
+	job := s.job(r.PathValue("id"))
+	if job == nil {
+		writeJSONError(w, http.StatusNotFound, fmt.Errorf("job %s not found", r.PathValue("id")))
+		return
+	}
+	writeJSON(w, newAPIJob(job))
+}
+
+// handleAPICancel stops a running job; the rows done so far are saved
+func (s *server) handleAPICancel(w http.ResponseWriter, r *http.Request) {
+	job := s.cancelJob(r.PathValue("id"))
+	if job == nil {
+		writeJSONError(w, http.StatusNotFound, fmt.Errorf("job %s not found", r.PathValue("id")))
+		return
+	}
+	writeJSON(w, newAPIJob(job))
+}
+
+// handleAPIResult sends the result file of a finished job
+func (s *server) handleAPIResult(w http.ResponseWriter, r *http.Request) {
+	job := s.job(r.PathValue("id"))
+	switch {
+	case job == nil:
+		writeJSONError(w, http.StatusNotFound, fmt.Errorf("job %s not found", r.PathValue("id")))
+	case job.State == jobRunning:
+		writeJSONError(w, http.StatusConflict, fmt.Errorf("job %s is still running", job.ID))
+	case job.Output == "":
+		writeJSONError(w, http.StatusNotFound, fmt.Errorf("job %s has no result: %s", job.ID, job.Error))
+	case isCloudURI(job.Output):
+		writeJSONError(w, http.StatusNotFound, fmt.Errorf("job %s wrote its result to %s", job.ID, job.Output))
+	default:
+		p := filepath.Join(s.dir, filepath.FromSlash(job.Output))
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filepath.Base(p)))
+		http.ServeFile(w, r, p)
+	}
+}
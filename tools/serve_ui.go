@@ -0,0 +1,249 @@
+package tools
+
+// serveUIPage is the web app of serve -ui: a single page calling the /ui/
+// endpoints
+const serveUIPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>AI General Tool</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", sans-serif; margin: 0; color: #222; background: #f6f7f9; }
+header { background: #1f3b57; color: #fff; padding: 12px 24px; font-size: 18px; }
+main { display: grid; grid-template-columns: 280px 1fr; gap: 16px; padding: 16px 24px; }
+section { background: #fff; border: 1px solid #dde1e6; border-radius: 6px; padding: 12px 16px; margin-bottom: 16px; }
+h2 { font-size: 15px; margin: 0 0 10px; }
+table { border-collapse: collapse; font-size: 13px; width: 100%; }
+th, td { border-bottom: 1px solid #eceef1; padding: 4px 6px; text-align: left; vertical-align: top; max-width: 280px; overflow: hidden; text-overflow: ellipsis; }
+th { background: #f0f2f5; }
+.scroll { overflow: auto; max-height: 320px; }
+.files div { padding: 4px 6px; cursor: pointer; border-radius: 4px; font-size: 13px; word-break: break-all; }
+.files div:hover, .files div.active { background: #e3ecf6; }
+.muted { color: #777; font-size: 12px; }
+label { display: block; font-size: 13px; margin: 8px 0 2px; }
+input[type=text], input[type=number], textarea, select { width: 100%; box-sizing: border-box; padding: 5px; font: inherit; font-size: 13px; }
+textarea { height: 90px; }
+button { padding: 6px 14px; margin: 10px 8px 0 0; border: 0; border-radius: 4px; background: #1f6feb; color: #fff; cursor: pointer; }
+button.secondary { background: #8a94a0; }
+button:disabled { opacity: .5; cursor: default; }
+.col-row { display: grid; grid-template-columns: 1fr 1fr auto; gap: 6px; margin-bottom: 4px; }
+.col-row button { margin: 0; padding: 4px 8px; }
+.grid2 { display: grid; grid-template-columns: repeat(4, 1fr); gap: 10px; }
+.bar { height: 14px; background: #e3e6ea; border-radius: 7px; overflow: hidden; margin: 8px 0; }
+.bar div { height: 100%; background: #2da44e; width: 0; transition: width .5s; }
+.error { color: #b42318; }
+.new { background: #eef7ee; }
+</style>
+</head>
+<body>
+<header>AI General Tool</header>
+<main>
+<div>
+<section>
+<h2>Files</h2>
+<input type="file" id="upload">
+<div class="muted">Upload a CSV, Excel, ODS, JSON or SQLite file, or pick one below</div>
+<div class="files" id="files"></div>
+</section>
+<section>
+<h2>Jobs</h2>
+<div id="jobs" class="muted">No jobs yet</div>
+</section>
+</div>
+<div>
+<section id="preview-section" hidden>
+<h2 id="preview-title"></h2>
+<div id="sheet-box" hidden><label>Sheet</label><select id="sheet"></select></div>
+<div class="scroll"><table id="columns"></table></div>
+<p class="muted">First rows</p>
+<div class="scroll"><table id="rows"></table></div>
+</section>
+<section id="build-section" hidden>
+<h2>Enrichment</h2>
+<label>Prompt: what should the model do with each row? The row's values are sent with it.</label>
+<textarea id="prompt" placeholder="Categorize the ticket and rate its urgency from 1 to 5"></textarea>
+<label>Columns to generate (model is optional and overrides the default)</label>
+<div id="col-list"></div>
+<button class="secondary" id="add-col">Add column</button>
+<div class="grid2">
+<div><label>Default model</label><input type="text" id="model" value="gpt-4o-mini"></div>
+<div><label>Sample rows</label><input type="number" id="sample" value="5" min="1" max="20"></div>
+<div><label>Workers</label><input type="number" id="workers" value="10" min="1"></div>
+<div><label>Result format</label><select id="format"><option value="same">Same as input</option><option value="xlsx">Excel</option><option value="csv">CSV</option><option value="ods">ODS</option></select></div>
+</div>
+<button id="run-sample">Run sample</button>
+<button id="run-all">Run all rows</button>
+<div id="form-error" class="error"></div>
+</section>
+<section id="sample-section" hidden>
+<h2>Sample</h2>
+<div id="sample-summary" class="muted"></div>
+<div class="scroll"><table id="sample-rows"></table></div>
+</section>
+<section id="progress-section" hidden>
+<h2>Progress</h2>
+<div class="bar"><div id="bar"></div></div>
+<div id="progress-text"></div>
+<button class="secondary" id="cancel">Cancel</button>
+<a id="download" hidden><button>Download result</button></a>
+</section>
+</div>
+</main>
+<script>
+let current = null, preview = null, polling = null, jobID = null;
+const $ = id => document.getElementById(id);
+const esc = s => String(s ?? "").replace(/[&<>"]/g, c => ({"&": "&amp;", "<": "&lt;", ">": "&gt;", '"': "&quot;"}[c]));
+
+async function call(url, options) {
+  const response = await fetch(url, options);
+  const body = await response.json();
+  if (!response.ok) throw new Error(body.error || response.statusText);
+  return body;
+}
+
+function table(el, headers, rows, classes) {
+  el.innerHTML = "<tr>" + headers.map((h, i) => "<th class='" + ((classes || [])[i] || "") + "'>" + esc(h) + "</th>").join("") + "</tr>" +
+    rows.map(r => "<tr>" + r.map((c, i) => "<td class='" + ((classes || [])[i] || "") + "' title='" + esc(c) + "'>" + esc(c) + "</td>").join("") + "</tr>").join("");
+}
+
+async function loadFiles() {
+  const files = await call("/ui/files");
+  $("files").innerHTML = files.map(f => "<div data-name='" + esc(f.name) + "'>" + esc(f.name) + " <span class='muted'>" + (f.size / 1024).toFixed(1) + " KB</span></div>").join("") || "<p class='muted'>No data files</p>";
+  for (const div of $("files").children) {
+    if (div.dataset.name) div.onclick = () => openFile(div.dataset.name, "");
+    if (div.dataset.name === current) div.classList.add("active");
+  }
+}
+
+async function openFile(name, sheet) {
+  current = name;
+  $("form-error").textContent = "";
+  try {
+    preview = await call("/ui/preview?file=" + encodeURIComponent(name) + "&sheet=" + encodeURIComponent(sheet));
+  } catch (e) {
+    alert(e.message);
+    return;
+  }
+  loadFiles();
+  $("preview-section").hidden = $("build-section").hidden = false;
+  $("preview-title").textContent = name + " - " + preview.rows + " rows, " + preview.headers.length + " columns";
+  $("sheet-box").hidden = !preview.sheets;
+  $("sheet").innerHTML = (preview.sheets || []).map(s => "<option" + (s === sheet ? " selected" : "") + ">" + esc(s) + "</option>").join("");
+  table($("columns"), ["Column", "Type", "Nulls", "Unique", "Examples"],
+    preview.columns.map(c => [c.Name, c.Type, c.Nulls, c.Unique, (c.Examples || []).join(", ")]));
+  table($("rows"), preview.headers, preview.first);
+  if (!$("col-list").children.length) addColumn("", "");
+}
+
+function addColumn(name, model) {
+  const row = document.createElement("div");
+  row.className = "col-row";
+  row.innerHTML = "<input type='text' placeholder='column name' class='col-name'><input type='text' placeholder='model (optional)' class='col-model'><button class='secondary'>x</button>";
+  row.querySelector(".col-name").value = name;
+  row.querySelector(".col-model").value = model;
+  row.querySelector("button").onclick = () => row.remove();
+  $("col-list").appendChild(row);
+}
+
+function request() {
+  const columns = [...$("col-list").children].map(row => {
+    const name = row.querySelector(".col-name").value.trim(), model = row.querySelector(".col-model").value.trim();
+    return name && (model ? name + "@" + model : name);
+  }).filter(Boolean);
+  return {
+    file: current, sheet: preview.sheets ? $("sheet").value : "", prompt: $("prompt").value,
+    columns: columns.join(","), model: $("model").value.trim(), sample: +$("sample").value,
+    workers: +$("workers").value, format: $("format").value,
+  };
+}
+
+async function runSample() {
+  $("form-error").textContent = "";
+  $("run-sample").disabled = true;
+  $("sample-section").hidden = false;
+  $("sample-summary").textContent = "Running...";
+  $("sample-rows").innerHTML = "";
+  try {
+    const req = request(), reply = await call("/ui/sample", {method: "POST", body: JSON.stringify(req)});
+    const generated = req.columns.split(",").map(c => c.split("@")[0].split(":")[0]);
+    const headers = preview.headers.concat(generated, ["error"]);
+    table($("sample-rows"), headers,
+      reply.rows.map(r => preview.headers.map(h => r.input[h]).concat(generated.map(c => (r.results || {})[c]), [r.error || ""])),
+      headers.map((h, i) => i >= preview.headers.length ? "new" : ""));
+    $("sample-summary").textContent = reply.rows.length + " rows, " + reply.tokens + " tokens, $" + reply.cost.toFixed(4) +
+      ". Projected for all " + reply.total_rows + " rows: ~$" + reply.projected_cost.toFixed(4);
+  } catch (e) {
+    $("sample-summary").textContent = "";
+    $("form-error").textContent = e.message;
+  }
+  $("run-sample").disabled = false;
+}
+
+async function runAll() {
+  $("form-error").textContent = "";
+  try {
+    const job = await call("/ui/jobs", {method: "POST", body: JSON.stringify(request())});
+    watch(job.id);
+  } catch (e) {
+    $("form-error").textContent = e.message;
+  }
+}
+
+function watch(id) {
+  jobID = id;
+  $("progress-section").hidden = false;
+  $("download").hidden = true;
+  $("cancel").hidden = false;
+  clearInterval(polling);
+  const poll = async () => {
+    const job = await call("/ui/jobs/" + id);
+    const p = job.progress, done = p.completed + p.failed;
+    $("bar").style.width = (p.total ? 100 * done / p.total : 0) + "%";
+    $("progress-text").textContent = job.file + ": " + done + " of " + p.total + " rows, " + p.failed + " failed, " +
+      p.tokens + " tokens, $" + p.cost.toFixed(4) + " - " + job.state + (job.error ? ": " + job.error : "");
+    if (job.state !== "running") {
+      clearInterval(polling);
+      $("cancel").hidden = true;
+      if (job.output) {
+        $("download").href = "/ui/download?file=" + encodeURIComponent(job.output);
+        $("download").hidden = false;
+      }
+      loadFiles();
+    }
+    loadJobs();
+  };
+  poll();
+  polling = setInterval(poll, 1000);
+}
+
+async function loadJobs() {
+  const jobs = await call("/ui/jobs");
+  if (!jobs.length) return;
+  $("jobs").innerHTML = jobs.map(j => "<div>#" + j.id + " " + esc(j.file) + ": " + j.state +
+    (j.output ? " <a href='/ui/download?file=" + encodeURIComponent(j.output) + "'>download</a>" : "") + "</div>").join("");
+}
+
+$("upload").onchange = async () => {
+  const file = $("upload").files[0];
+  if (!file) return;
+  const form = new FormData();
+  form.append("file", file);
+  try {
+    const reply = await call("/ui/upload", {method: "POST", body: form});
+    await openFile(reply.name, "");
+  } catch (e) {
+    alert(e.message);
+  }
+  $("upload").value = "";
+};
+$("sheet").onchange = () => openFile(current, $("sheet").value);
+$("add-col").onclick = () => addColumn("", "");
+$("run-sample").onclick = runSample;
+$("run-all").onclick = runAll;
+$("cancel").onclick = () => call("/ui/jobs/" + jobID + "/cancel", {method: "POST"});
+loadFiles();
+loadJobs();
+</script>
+</body>
+</html>
+`
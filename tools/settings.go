@@ -0,0 +1,302 @@
+package tools
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"ai-general-tool/common"
+
+	"github.com/openai/openai-go/option"
+	"gopkg.in/yaml.v3"
+)
+
+// Settings files: aitool.yaml in the working directory overrides the one in
+// the user's config directory; AITOOL_CONFIG names a file to use instead of
+// both. AITOOL_PROFILE selects a profile when -profile is not given.
+const (
+	settingsFileName = "aitool.yaml"
+	settingsEnv      = "AITOOL_CONFIG"
+	profileEnv       = "AITOOL_PROFILE"
+)
+
+// Settings are the defaults of aitool.yaml. Flag values are strings as on
+// the command line, e.g. workers: 20 or yes: true.
+type Settings struct {
+	Provider   string                       `yaml:"provider"`    // openai, the only provider; other OpenAI-compatible servers through base_url
+	BaseURL    string                       `yaml:"base_url"`    // API endpoint of an OpenAI-compatible server
+	APIKeyEnv  string                       `yaml:"api_key_env"` // environment variable holding the API key (default: OPENAI_API_KEY)
+	Model      string                       `yaml:"model"`       // shorthand for flags: {model: ...}
+	Workers    string                       `yaml:"workers"`     // shorthand for flags: {workers: ...}
+	RateLimit  int                          `yaml:"rate_limit"`  // API requests per minute, across workers
+	Pricing    map[string]modelPrice        `yaml:"pricing"`     // model prices, as in the AI_TOOL_PRICING file
+	NullTokens []string                     `yaml:"null_tokens"` // cell values read as missing besides empty, null and nil
+	Flags      map[string]string            `yaml:"flags"`       // flag defaults of every command that has the flag
+	Commands   map[string]map[string]string `yaml:"commands"`    // flag defaults of one command
+	Profiles   map[string]*Settings         `yaml:"profiles"`    // named settings applied over the rest with -profile
+
+	Sources []string `yaml:"-"` // files the settings were read from
+}
+
+// activeSettings are the settings of the running command, nil without a
+// settings file
+var activeSettings *Settings
+
+// jobSettings are the provider settings of the job run by run-job; they
+// override aitool.yaml and its profile
+var jobSettings *Settings
+
+// rateLimitOnce guards the single limiter shared by every client
+var (
+	rateLimitOnce sync.Once
+	rateLimiter   *requestLimiter
+)
+
+// parseFlags parses a command's flags with the defaults of aitool.yaml:
+// values from the file fill the flags not given on the command line, with a
+// -profile, and the file's provider, pricing, rate limit and null tokens
+// apply to the run
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	profile := fs.String("profile", os.Getenv(profileEnv), "Profile of aitool.yaml whose settings apply")
+	fs.Usage = usage(fs)
+	args, err := commandGlobalFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+	if err := applyGlobalFlags(fs, explicit); err != nil {
+		return err
+	}
+	settings, err := loadSettings(*profile)
+	if err != nil {
+		return err
+	}
+	if settings == nil {
+		return nil
+	}
+	for _, source := range settings.Sources {
+		debugf("settings from %s", source)
+	}
+
+	values := settings.flagValues(fs.Name())
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if explicit[name] || fs.Lookup(name) == nil {
+			continue
+		}
+		if err := fs.Set(name, values[name]); err != nil {
+			return fmt.Errorf("%s: invalid value '%s' for -%s: %v", strings.Join(settings.Sources, ", "), values[name], name, err)
+		}
+	}
+	return settings.apply()
+}
+
+// loadSettings reads the settings files and applies a profile and the
+// settings of a job over them. It returns nil when there is none of them.
+func loadSettings(profile string) (*Settings, error) {
+	settings, err := loadSettingsFiles(profile)
+	if err != nil || jobSettings == nil {
+		return settings, err
+	}
+	return settings.merge(jobSettings), nil
+}
+
+// loadSettingsFiles reads the settings files and applies a profile over them
+func loadSettingsFiles(profile string) (*Settings, error) {
+	var files []string
+	named := strings.TrimSpace(os.Getenv(settingsEnv))
+	if named != "" {
+		files = []string{named}
+	} else {
+		dir := os.Getenv("XDG_CONFIG_HOME")
+		if home, err := os.UserHomeDir(); dir == "" && err == nil {
+			dir = filepath.Join(home, ".config")
+		}
+		if dir != "" {
+			files = append(files, filepath.Join(dir, "aitool", settingsFileName))
+		}
+		files = append(files, settingsFileName)
+	}
+
+	var settings *Settings
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if os.IsNotExist(err) && named == "" {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading settings: %v", err)
+		}
+		var s Settings
+		if err := yaml.Unmarshal(data, &s); err != nil {
+			return nil, fmt.Errorf("invalid settings file %s: %v", file, err)
+		}
+		s.Sources = []string{file}
+		settings = settings.merge(&s)
+	}
+
+	if profile == "" {
+		return settings, nil
+	}
+	if settings == nil {
+		return nil, fmt.Errorf("profile '%s' requested but no %s found", profile, settingsFileName)
+	}
+	p, ok := settings.Profiles[profile]
+	if !ok || p == nil {
+		var names []string
+		for name := range settings.Profiles {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("profile '%s' not found in %s (profiles: %s)", profile, strings.Join(settings.Sources, ", "), strings.Join(names, ", "))
+	}
+	p.Sources = []string{fmt.Sprintf("profile %s", profile)}
+	return settings.merge(p), nil
+}
+
+// merge returns the settings of s overridden by those set in o. Maps are
+// merged key by key; profiles are kept from both.
+func (s *Settings) merge(o *Settings) *Settings {
+	if s == nil {
+		return o
+	}
+	out := *s
+	out.Sources = append(append([]string{}, s.Sources...), o.Sources...)
+	for _, field := range []struct{ dst, src *string }{
+		{&out.Provider, &o.Provider}, {&out.BaseURL, &o.BaseURL}, {&out.APIKeyEnv, &o.APIKeyEnv},
+		{&out.Model, &o.Model}, {&out.Workers, &o.Workers},
+	} {
+		if *field.src != "" {
+			*field.dst = *field.src
+		}
+	}
+	if o.RateLimit != 0 {
+		out.RateLimit = o.RateLimit
+	}
+	if o.NullTokens != nil {
+		out.NullTokens = o.NullTokens
+	}
+	out.Pricing = mergeMaps(s.Pricing, o.Pricing)
+	out.Flags = mergeMaps(s.Flags, o.Flags)
+	out.Profiles = mergeMaps(s.Profiles, o.Profiles)
+	out.Commands = make(map[string]map[string]string)
+	for name, flags := range s.Commands {
+		out.Commands[name] = flags
+	}
+	for name, flags := range o.Commands {
+		out.Commands[name] = mergeMaps(out.Commands[name], flags)
+	}
+	return &out
+}
+
+// mergeMaps returns the entries of a overridden by those of b
+func mergeMaps[V any](a, b map[string]V) map[string]V {
+	out := make(map[string]V, len(a)+len(b))
+	for k, v := range a {
+		out[k] = v
+	}
+	for k, v := range b {
+		out[k] = v
+	}
+	return out
+}
+
+// flagValues returns the flag defaults for a command: the shorthands, then
+// flags, then the command's own section
+func (s *Settings) flagValues(command string) map[string]string {
+	values := make(map[string]string)
+	if s.Model != "" {
+		values["model"] = s.Model
+	}
+	if s.Workers != "" {
+		values["workers"] = s.Workers
+	}
+	for name, value := range s.Flags {
+		values[strings.TrimLeft(name, "-")] = value
+	}
+	for name, value := range s.Commands[command] {
+		values[strings.TrimLeft(name, "-")] = value
+	}
+	return values
+}
+
+// apply makes the provider, pricing, rate limit and null tokens of the
+// settings those of the run
+func (s *Settings) apply() error {
+	switch strings.ToLower(s.Provider) {
+	case "", "openai":
+	default:
+		return fmt.Errorf("unknown provider '%s' (use openai, with base_url for an OpenAI-compatible server)", s.Provider)
+	}
+	if s.RateLimit < 0 {
+		return fmt.Errorf("rate_limit must be a number of requests per minute")
+	}
+	for model, price := range s.Pricing {
+		modelPrices[model] = price
+	}
+	common.SetNullTokens(s.NullTokens)
+	activeSettings = s
+	return nil
+}
+
+// clientOptions returns the client options of the settings: the API key,
+// base URL and rate limit
+func (s *Settings) clientOptions() ([]option.RequestOption, string) {
+	keyEnv := "OPENAI_API_KEY"
+	var opts []option.RequestOption
+	if logsAt(logDebug) {
+		opts = append(opts, option.WithMiddleware(debugRequests))
+	}
+	if s == nil {
+		return opts, keyEnv
+	}
+	if s.APIKeyEnv != "" {
+		keyEnv = s.APIKeyEnv
+	}
+	if s.BaseURL != "" {
+		opts = append(opts, option.WithBaseURL(s.BaseURL))
+	}
+	if s.RateLimit > 0 {
+		rateLimitOnce.Do(func() { rateLimiter = &requestLimiter{interval: time.Minute / time.Duration(s.RateLimit)} })
+		opts = append(opts, option.WithMiddleware(rateLimiter.middleware))
+	}
+	return opts, keyEnv
+}
+
+// requestLimiter spaces API requests evenly to stay under a rate limit
+type requestLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+// middleware waits for the request's turn before sending it
+func (l *requestLimiter) middleware(req *http.Request, next option.MiddlewareNext) (*http.Response, error) {
+	l.mu.Lock()
+	now := time.Now()
+	wait := l.next.Sub(now)
+	l.next = now.Add(max(wait, 0) + l.interval)
+	l.mu.Unlock()
+	if wait > 0 {
+		select {
+		case <-time.After(wait):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+	return next(req)
+}
@@ -0,0 +1,131 @@
+package tools
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// excelSheetNameLength is the longest sheet name Excel accepts; routed sheet
+// names leave room for a counter
+const excelSheetNameLength = 31
+
+// rowGroup holds the rows sharing a value of a column, under a name derived
+// from the value
+type rowGroup struct {
+	Name string
+	Rows [][]string
+}
+
+// groupRows groups rows by the value of a column, in order of first
+// appearance. Values whose names clash, ignoring case, get a counter.
+func groupRows(headers []string, rows [][]string, column string, name func(string) string) []rowGroup {
+	col := indexOf(headers, column)
+	byValue := make(map[string]int)
+	used := make(map[string]bool)
+	var groups []rowGroup
+	for _, row := range rows {
+		value := ""
+		if col < len(row) {
+			value = row[col]
+		}
+		i, ok := byValue[value]
+		if !ok {
+			groupName := name(value)
+			for n := 2; used[strings.ToLower(groupName)]; n++ {
+				groupName = fmt.Sprintf("%s_%d", name(value), n)
+			}
+			used[strings.ToLower(groupName)] = true
+			i = len(groups)
+			byValue[value] = i
+			groups = append(groups, rowGroup{Name: groupName})
+		}
+		groups[i].Rows = append(groups[i].Rows, row)
+	}
+	return groups
+}
+
+// sheetNamePart turns a column value into a sheet name: characters Excel
+// rejects are replaced and long values are cut
+func sheetNamePart(value string) string {
+	name := strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) {
+			return '_'
+		}
+		return r
+	}, strings.TrimSpace(value))
+	name = strings.Trim(name, "'")
+	if name == "" {
+		return "blank"
+	}
+	if runes := []rune(name); len(runes) > excelSheetNameLength-3 {
+		name = string(runes[:excelSheetNameLength-3])
+	}
+	if strings.EqualFold(name, errorsSheet) || strings.EqualFold(name, runInfoSheet) {
+		name += "_rows"
+	}
+	return name
+}
+
+// saveRoutedExcel writes a workbook with one styled sheet per value of a
+// column, in order of first appearance
+func saveRoutedExcel(filename string, headers []string, rows [][]string, columnSpecs []ColumnSpec, column string, sheets *runSheets) error {
+	if indexOf(headers, column) == -1 {
+		return fmt.Errorf("sheet column '%s' not found", column)
+	}
+	f := excelize.NewFile()
+	defer f.Close()
+
+	groups := groupRows(headers, rows, column, sheetNamePart)
+	if len(groups) == 0 {
+		groups = []rowGroup{{Name: "Sheet1"}}
+	}
+	for i, group := range groups {
+		if i == 0 {
+			if err := f.SetSheetName("Sheet1", group.Name); err != nil {
+				return err
+			}
+		} else if _, err := f.NewSheet(group.Name); err != nil {
+			return err
+		}
+		sheets.listErrors(group.Name, headers, group.Rows, columnSpecs, 1)
+		if err := f.SetSheetRow(group.Name, "A1", &headers); err != nil {
+			return err
+		}
+		for r, row := range group.Rows {
+			if err := f.SetSheetRow(group.Name, fmt.Sprintf("A%d", r+2), &row); err != nil {
+				return err
+			}
+		}
+		if err := styleSheet(f, group.Name, headers, group.Rows); err != nil {
+			return err
+		}
+	}
+	if sheets != nil {
+		if err := addRunSheets(f, sheets); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("Routed rows to %d sheets by %s\n", len(groups), column)
+	return f.SaveAs(filename)
+}
+
+// saveRoutedODS writes a spreadsheet with one sheet per value of a column
+func saveRoutedODS(filename string, headers []string, rows [][]string, column string) error {
+	if indexOf(headers, column) == -1 {
+		return fmt.Errorf("sheet column '%s' not found", column)
+	}
+	groups := groupRows(headers, rows, column, sheetNamePart)
+	sheets := make([]workbookSheet, len(groups))
+	for i, group := range groups {
+		sheets[i] = workbookSheet{Name: group.Name, Rows: append([][]string{headers}, group.Rows...)}
+	}
+	if len(sheets) == 0 {
+		sheets = []workbookSheet{{Name: "Sheet1", Rows: [][]string{headers}}}
+	}
+
+	fmt.Printf("Routed rows to %d sheets by %s\n", len(sheets), column)
+	return saveODSSheets(filename, sheets)
+}
@@ -0,0 +1,199 @@
+package tools
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+
+	"ai-general-tool/common"
+)
+
+// sortKey is a column to sort by, with its direction and the type its values
+// are compared as
+type sortKey struct {
+	index int
+	desc  bool
+	kind  common.DataType
+}
+
+// RunSort handles the sort command: it orders rows by one or more columns,
+// comparing numbers and dates by value rather than as text
+func RunSort(args []string) error {
+	fs := flag.NewFlagSet("sort", flag.ExitOnError)
+
+	// Define flags
+	inputFile := fs.String("input", "", "Input file (CSV, Excel or JSON)")
+	by := fs.String("by", "", "Comma-separated columns, each optionally followed by asc or desc, e.g. \"amount desc,created_at\" (required)")
+	top := fs.Int("top", 0, "Keep only the first N rows after sorting (0 = all)")
+	outputFile := fs.String("output", "", "Output file (default: <input>_sorted)")
+	fs.StringVar(outputFile, "o", "", "Shorthand for -output")
+	input := inputFlags(fs)
+	output := &OutputOptions{}
+	fs.StringVar(&output.Format, "format", "same", "Output format: same, csv, sqlite, ods, md (Markdown table), html")
+	fs.BoolVar(&output.QuoteAll, "quote-all", false, "Quote every field of CSV output")
+	var locale common.Locale
+	localeFlag(fs, &locale)
+
+	// Parse flags
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	// Handle positional argument for filename
+	if *inputFile == "" && fs.NArg() > 0 {
+		*inputFile = fs.Arg(0)
+	}
+
+	// Validation
+	if *inputFile == "" {
+		return fmt.Errorf("input file is required")
+	}
+	if *by == "" {
+		return fmt.Errorf("-by is required")
+	}
+	if *top < 0 {
+		return fmt.Errorf("-top cannot be negative")
+	}
+	toStdout, err := useStdout(*inputFile, outputFile, *output)
+	if err != nil {
+		return err
+	}
+	if *outputFile == "" {
+		*outputFile = suffixedOutputFile(*inputFile, output.Format, "_sorted")
+	}
+	if *outputFile == *inputFile && *inputFile != stdioName {
+		return fmt.Errorf("output would overwrite the input %s", *inputFile)
+	}
+
+	fmt.Printf("Loading %s...\n", *inputFile)
+	headers, rows, err := loadInputFile(*inputFile, *input)
+	if err != nil {
+		return fmt.Errorf("error loading input: %v", err)
+	}
+	keys, err := parseSortKeys(*by, headers, rows, locale)
+	if err != nil {
+		return err
+	}
+	var described []string
+	for _, key := range keys {
+		direction := "asc"
+		if key.desc {
+			direction = "desc"
+		}
+		described = append(described, fmt.Sprintf("%s %s (%s)", headers[key.index], direction, key.kind))
+	}
+	fmt.Printf("Sorting %d rows by %s\n", len(rows), strings.Join(described, ", "))
+
+	sortRows(rows, keys, locale)
+	if *top > 0 && len(rows) > *top {
+		rows = rows[:*top]
+	}
+
+	if err := saveOutputTable(*outputFile, headers, rows, nil, *output); err != nil {
+		return fmt.Errorf("error saving output: %v", err)
+	}
+	if !toStdout {
+		fmt.Printf("%d rows saved to: %s\n", len(rows), *outputFile)
+	}
+	return nil
+}
+
+// parseSortKeys reads -by, typing each column with the detection of the read
+// commands: numeric columns sort as numbers, date columns as dates and any
+// other column as text
+func parseSortKeys(by string, headers []string, rows [][]string, locale common.Locale) ([]sortKey, error) {
+	var keys []sortKey
+	for _, part := range strings.Split(by, ",") {
+		fields := strings.Fields(part)
+		if len(fields) == 0 {
+			continue
+		}
+		name, desc := strings.Join(fields, " "), false
+		if last := strings.ToLower(fields[len(fields)-1]); len(fields) > 1 && (last == "asc" || last == "desc") {
+			name, desc = strings.Join(fields[:len(fields)-1], " "), last == "desc"
+		}
+		index := indexOf(headers, name)
+		if index == -1 {
+			return nil, fmt.Errorf("sort column '%s' not found", name)
+		}
+		types := common.TypeCounter{Locale: locale}
+		for _, row := range rows {
+			types.Add(cell(row, index))
+		}
+		kind := types.Type()
+		switch {
+		case isNumericType(kind):
+			kind = common.TypeNumber
+		case kind != common.TypeDate:
+			kind = common.TypeString
+		}
+		keys = append(keys, sortKey{index: index, desc: desc, kind: kind})
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("-by names no column")
+	}
+	return keys, nil
+}
+
+// sortRows sorts rows in place, keeping the input order of equal rows. Empty
+// cells and values that do not read as the column's type sort last in either
+// direction.
+func sortRows(rows [][]string, keys []sortKey, locale common.Locale) {
+	// Read every sort value once
+	type sortValue struct {
+		number float64
+		text   string
+		ok     bool
+	}
+	values := make([][]sortValue, len(rows))
+	for r, row := range rows {
+		values[r] = make([]sortValue, len(keys))
+		for k, key := range keys {
+			value := cell(row, key.index)
+			v := sortValue{text: value, ok: !common.IsNull(value)}
+			switch key.kind {
+			case common.TypeNumber:
+				v.number, v.ok = numericValue(value, locale)
+			case common.TypeDate:
+				date, ok := common.ParseDate(value, locale)
+				v.number, v.ok = float64(date.UnixNano()), ok
+			}
+			values[r][k] = v
+		}
+	}
+
+	order := make([]int, len(rows))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := values[order[i]], values[order[j]]
+		for k, key := range keys {
+			if a[k].ok != b[k].ok {
+				return a[k].ok
+			}
+			if !a[k].ok {
+				continue
+			}
+			c := 0
+			if key.kind == common.TypeString {
+				c = strings.Compare(a[k].text, b[k].text)
+			} else if a[k].number < b[k].number {
+				c = -1
+			} else if a[k].number > b[k].number {
+				c = 1
+			}
+			if c != 0 {
+				return c < 0 != key.desc
+			}
+		}
+		return false
+	})
+
+	sorted := make([][]string, len(rows))
+	for i, r := range order {
+		sorted[i] = rows[r]
+	}
+	copy(rows, sorted)
+}
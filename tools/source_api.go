@@ -0,0 +1,385 @@
+package tools
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+// apiSourcePrefix marks an input as an API source config file
+const apiSourcePrefix = "api:"
+
+// defaultMaxPages caps the pages fetched when max_pages is not set, so an
+// API that never signals the last page cannot be paged forever
+const defaultMaxPages = 1000
+
+// APISourceConfig describes a REST or GraphQL endpoint to read rows from
+type APISourceConfig struct {
+	URL         string            `json:"url"`
+	Method      string            `json:"method"`
+	Headers     map[string]string `json:"headers"`
+	Params      map[string]string `json:"params"`
+	Auth        APIAuthConfig     `json:"auth"`
+	GraphQL     *GraphQLConfig    `json:"graphql"`
+	RecordsPath string            `json:"records_path"` // JSONPath to the records array, e.g. $.data.items
+	Pagination  APIPagination     `json:"pagination"`
+}
+
+// APIAuthConfig describes how to authenticate. Secrets are read from
+// environment variables so config files can be committed safely.
+type APIAuthConfig struct {
+	Type        string `json:"type"` // none, bearer, basic, header
+	TokenEnv    string `json:"token_env"`
+	Username    string `json:"username"`
+	PasswordEnv string `json:"password_env"`
+	HeaderName  string `json:"header_name"`
+}
+
+// GraphQLConfig holds the query sent as a POST body
+type GraphQLConfig struct {
+	Query     string                 `json:"query"`
+	Variables map[string]interface{} `json:"variables"`
+}
+
+// APIPagination describes how to fetch subsequent pages
+type APIPagination struct {
+	Type        string `json:"type"`         // none, cursor, offset, page
+	CursorPath  string `json:"cursor_path"`  // JSONPath to the next cursor in the response
+	CursorParam string `json:"cursor_param"` // query param or GraphQL variable for the cursor
+	OffsetParam string `json:"offset_param"` // query param or GraphQL variable for offset/page
+	LimitParam  string `json:"limit_param"`  // query param or GraphQL variable for page size
+	Limit       int    `json:"limit"`
+	MaxPages    int    `json:"max_pages"` // default: defaultMaxPages
+}
+
+// loadAPISource fetches all pages described by the config file and flattens
+// the records into rows
+func loadAPISource(configFile string) ([]string, [][]string, error) {
+	data, err := os.ReadFile(configFile)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var config APISourceConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, nil, fmt.Errorf("invalid API source config: %v", err)
+	}
+	if config.URL == "" {
+		return nil, nil, fmt.Errorf("API source config must set url")
+	}
+	if config.RecordsPath == "" {
+		config.RecordsPath = "$"
+	}
+
+	// Secrets usually live in .env
+	godotenv.Load(".env")
+
+	client := &http.Client{Timeout: 60 * time.Second}
+	var records []map[string]interface{}
+
+	cursor := ""
+	offset := 0
+	if config.Pagination.Type == "page" {
+		offset = 1
+	}
+	maxPages := config.Pagination.MaxPages
+	if maxPages <= 0 {
+		maxPages = defaultMaxPages
+	}
+	seenCursors := map[string]bool{}
+	var previous []byte
+
+	for page := 1; ; page++ {
+		body, err := fetchAPIPage(client, &config, cursor, offset)
+		if err != nil {
+			return nil, nil, fmt.Errorf("page %d: %v", page, err)
+		}
+
+		// An API that ignores the pagination params keeps returning the
+		// same page
+		if page > 1 && bytes.Equal(body, previous) {
+			warnf("page %d repeats page %d, stopping", page, page-1)
+			break
+		}
+		previous = body
+
+		var response interface{}
+		if err := json.Unmarshal(body, &response); err != nil {
+			return nil, nil, fmt.Errorf("page %d: invalid JSON response: %v", page, err)
+		}
+
+		found, err := evalJSONPath(response, config.RecordsPath)
+		if err != nil {
+			return nil, nil, fmt.Errorf("page %d: %v", page, err)
+		}
+		items, ok := found.([]interface{})
+		if !ok {
+			return nil, nil, fmt.Errorf("page %d: records path %s is not an array", page, config.RecordsPath)
+		}
+		for _, item := range items {
+			if obj, ok := item.(map[string]interface{}); ok {
+				records = append(records, obj)
+			} else {
+				records = append(records, map[string]interface{}{"value": item})
+			}
+		}
+
+		infof("Fetched page %d (%d records)", page, len(items))
+
+		if page >= maxPages {
+			if config.Pagination.MaxPages <= 0 {
+				warnf("stopped after %d pages; set max_pages to fetch more", page)
+			}
+			break
+		}
+
+		// Advance to the next page
+		more := false
+		fullPage := len(items) > 0 && (config.Pagination.Limit == 0 || len(items) >= config.Pagination.Limit)
+		switch config.Pagination.Type {
+		case "cursor":
+			cursor = ""
+			if next, err := evalJSONPath(response, config.Pagination.CursorPath); err == nil && next != nil {
+				cursor = fmt.Sprint(next)
+			}
+			if seenCursors[cursor] {
+				warnf("page %d returned a cursor seen before, stopping", page)
+				cursor = ""
+			}
+			seenCursors[cursor] = true
+			more = cursor != "" && len(items) > 0
+		case "offset":
+			offset += len(items)
+			more = fullPage
+		case "page":
+			offset++
+			more = fullPage
+		}
+		if !more {
+			break
+		}
+	}
+
+	if len(records) == 0 {
+		return nil, nil, fmt.Errorf("API source returned no records")
+	}
+
+	headers, rows := flattenRecords(records)
+	return headers, rows, nil
+}
+
+// fetchAPIPage performs a single request for the given cursor/offset
+func fetchAPIPage(client *http.Client, config *APISourceConfig, cursor string, offset int) ([]byte, error) {
+	pagination := config.Pagination
+	pageVars := map[string]interface{}{}
+	if pagination.LimitParam != "" && pagination.Limit > 0 {
+		pageVars[pagination.LimitParam] = pagination.Limit
+	}
+	switch pagination.Type {
+	case "cursor":
+		if cursor != "" && pagination.CursorParam != "" {
+			pageVars[pagination.CursorParam] = cursor
+		}
+	case "offset", "page":
+		if pagination.OffsetParam != "" {
+			pageVars[pagination.OffsetParam] = offset
+		}
+	}
+
+	reqURL, err := url.Parse(config.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid url: %v", err)
+	}
+
+	method := strings.ToUpper(config.Method)
+	var body io.Reader
+
+	if config.GraphQL != nil {
+		// GraphQL passes pagination through variables
+		method = http.MethodPost
+		variables := map[string]interface{}{}
+		for k, v := range config.GraphQL.Variables {
+			variables[k] = v
+		}
+		for k, v := range pageVars {
+			variables[k] = v
+		}
+		payload, err := json.Marshal(map[string]interface{}{
+			"query":     config.GraphQL.Query,
+			"variables": variables,
+		})
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(payload)
+	} else {
+		// REST passes pagination through query params
+		query := reqURL.Query()
+		for k, v := range config.Params {
+			query.Set(k, v)
+		}
+		for k, v := range pageVars {
+			query.Set(k, fmt.Sprint(v))
+		}
+		reqURL.RawQuery = query.Encode()
+	}
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	req, err := http.NewRequest(method, reqURL.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for k, v := range config.Headers {
+		req.Header.Set(k, v)
+	}
+	if err := applyAPIAuth(req, config.Auth); err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	return data, nil
+}
+
+// applyAPIAuth adds authentication to the request
+func applyAPIAuth(req *http.Request, auth APIAuthConfig) error {
+	switch auth.Type {
+	case "", "none":
+		return nil
+	case "bearer":
+		token := os.Getenv(auth.TokenEnv)
+		if token == "" {
+			return fmt.Errorf("environment variable %s is not set", auth.TokenEnv)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	case "basic":
+		req.SetBasicAuth(auth.Username, os.Getenv(auth.PasswordEnv))
+	case "header":
+		token := os.Getenv(auth.TokenEnv)
+		if token == "" {
+			return fmt.Errorf("environment variable %s is not set", auth.TokenEnv)
+		}
+		req.Header.Set(auth.HeaderName, token)
+	default:
+		return fmt.Errorf("unknown auth type '%s'", auth.Type)
+	}
+	return nil
+}
+
+// evalJSONPath evaluates a simple JSONPath expression supporting $, .key,
+// ['key'] and [index] segments
+func evalJSONPath(data interface{}, path string) (interface{}, error) {
+	path = strings.TrimSpace(path)
+	path = strings.TrimPrefix(path, "$")
+
+	current := data
+	for len(path) > 0 {
+		var key string
+		index := -1
+
+		switch {
+		case path[0] == '.':
+			path = path[1:]
+			end := strings.IndexAny(path, ".[")
+			if end == -1 {
+				end = len(path)
+			}
+			key, path = path[:end], path[end:]
+		case strings.HasPrefix(path, "['"):
+			end := strings.Index(path, "']")
+			if end == -1 {
+				return nil, fmt.Errorf("unterminated bracket in path")
+			}
+			key, path = path[2:end], path[end+2:]
+		case path[0] == '[':
+			end := strings.Index(path, "]")
+			if end == -1 {
+				return nil, fmt.Errorf("unterminated bracket in path")
+			}
+			n, err := strconv.Atoi(path[1:end])
+			if err != nil {
+				return nil, fmt.Errorf("invalid array index '%s'", path[1:end])
+			}
+			index, path = n, path[end+1:]
+		default:
+			return nil, fmt.Errorf("invalid path segment '%s'", path)
+		}
+
+		if index >= 0 {
+			arr, ok := current.([]interface{})
+			if !ok || index >= len(arr) {
+				return nil, nil
+			}
+			current = arr[index]
+			continue
+		}
+
+		obj, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, nil
+		}
+		current = obj[key]
+	}
+
+	return current, nil
+}
+
+// flattenRecords converts JSON objects into tabular rows. Nested objects
+// become dot-separated columns and arrays are stored as JSON strings.
+func flattenRecords(records []map[string]interface{}) ([]string, [][]string) {
+	flat := make([]map[string]string, len(records))
+	for i, record := range records {
+		flat[i] = make(map[string]string)
+		flattenValue("", record, flat[i])
+	}
+	return tabulateRecords(flat)
+}
+
+// flattenValue writes value into out under prefix, recursing into objects
+func flattenValue(prefix string, value interface{}, out map[string]string) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for k, child := range v {
+			key := k
+			if prefix != "" {
+				key = prefix + "." + k
+			}
+			flattenValue(key, child, out)
+		}
+	case []interface{}:
+		data, _ := json.Marshal(v)
+		out[prefix] = string(data)
+	case nil:
+		out[prefix] = ""
+	case float64:
+		out[prefix] = strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		out[prefix] = fmt.Sprint(v)
+	}
+}
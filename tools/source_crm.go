@@ -0,0 +1,233 @@
+package tools
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"ai-general-tool/common"
+)
+
+// CRM inputs are written as "hubspot:<object>?properties=a,b" or
+// "salesforce:<SOQL query>"
+const (
+	hubspotPrefix    = "hubspot:"
+	salesforcePrefix = "salesforce:"
+
+	hubspotBaseURL      = "https://api.hubapi.com"
+	hubspotPageSize     = 100
+	hubspotBatchSize    = 100
+	salesforceAPI       = "v59.0"
+	salesforceBatchSize = 200
+)
+
+// parseHubSpotInput splits "contacts?properties=a,b" into the object type
+// and requested properties
+func parseHubSpotInput(spec string) (string, []string) {
+	objectType, query, _ := strings.Cut(spec, "?")
+	values, _ := url.ParseQuery(query)
+	var properties []string
+	if props := values.Get("properties"); props != "" {
+		for _, p := range strings.Split(props, ",") {
+			properties = append(properties, strings.TrimSpace(p))
+		}
+	}
+	return objectType, properties
+}
+
+// loadHubSpot pages through a HubSpot CRM object list
+func loadHubSpot(spec string) ([]string, [][]string, error) {
+	token := os.Getenv("HUBSPOT_TOKEN")
+	if token == "" {
+		return nil, nil, fmt.Errorf("HUBSPOT_TOKEN not found in environment")
+	}
+	objectType, properties := parseHubSpotInput(spec)
+	if objectType == "" {
+		return nil, nil, fmt.Errorf("HubSpot object type is required (e.g. hubspot:contacts)")
+	}
+
+	var records []map[string]interface{}
+	after := ""
+	for {
+		params := url.Values{}
+		params.Set("limit", fmt.Sprint(hubspotPageSize))
+		if len(properties) > 0 {
+			params.Set("properties", strings.Join(properties, ","))
+		}
+		if after != "" {
+			params.Set("after", after)
+		}
+
+		var page struct {
+			Results []struct {
+				ID         string                 `json:"id"`
+				Properties map[string]interface{} `json:"properties"`
+			} `json:"results"`
+			Paging struct {
+				Next struct {
+					After string `json:"after"`
+				} `json:"next"`
+			} `json:"paging"`
+		}
+		endpoint := fmt.Sprintf("%s/crm/v3/objects/%s?%s", hubspotBaseURL, objectType, params.Encode())
+		if err := connectorRequest(http.MethodGet, endpoint, bearerAuth(token), nil, &page); err != nil {
+			return nil, nil, err
+		}
+
+		for _, result := range page.Results {
+			record := map[string]interface{}{"id": result.ID}
+			for k, v := range result.Properties {
+				record[k] = v
+			}
+			records = append(records, record)
+		}
+
+		infof("Fetched %d %s", len(records), objectType)
+		after = page.Paging.Next.After
+		if after == "" {
+			break
+		}
+	}
+
+	if len(records) == 0 {
+		return nil, nil, fmt.Errorf("HubSpot returned no %s", objectType)
+	}
+	headers, rows := flattenRecords(records)
+	return headers, rows, nil
+}
+
+// pushHubSpot sends batch updates for the object type in spec
+func pushHubSpot(spec string, updates []recordUpdate) error {
+	token := os.Getenv("HUBSPOT_TOKEN")
+	if token == "" {
+		return fmt.Errorf("HUBSPOT_TOKEN not found in environment")
+	}
+
+	objectType, _ := parseHubSpotInput(spec)
+	endpoint := fmt.Sprintf("%s/crm/v3/objects/%s/batch/update", hubspotBaseURL, objectType)
+	for start := 0; start < len(updates); start += hubspotBatchSize {
+		end := common.Min(start+hubspotBatchSize, len(updates))
+		inputs := make([]map[string]interface{}, 0, end-start)
+		for _, update := range updates[start:end] {
+			inputs = append(inputs, map[string]interface{}{"id": update.ID, "properties": update.Properties})
+		}
+		if err := connectorRequest(http.MethodPost, endpoint, bearerAuth(token), map[string]interface{}{"inputs": inputs}, nil); err != nil {
+			return fmt.Errorf("batch starting at record %d: %v", start+1, err)
+		}
+		fmt.Printf("Pushed %d/%d records to HubSpot\n", end, len(updates))
+	}
+	return nil
+}
+
+// salesforceCredentials returns the instance URL and access token
+func salesforceCredentials() (string, string, error) {
+	instanceURL := strings.TrimSuffix(os.Getenv("SALESFORCE_INSTANCE_URL"), "/")
+	token := os.Getenv("SALESFORCE_ACCESS_TOKEN")
+	if instanceURL == "" || token == "" {
+		return "", "", fmt.Errorf("SALESFORCE_INSTANCE_URL and SALESFORCE_ACCESS_TOKEN must be set")
+	}
+	return instanceURL, token, nil
+}
+
+// loadSalesforce runs a SOQL query, following nextRecordsUrl pages
+func loadSalesforce(soql string) ([]string, [][]string, error) {
+	instanceURL, token, err := salesforceCredentials()
+	if err != nil {
+		return nil, nil, err
+	}
+	if strings.TrimSpace(soql) == "" {
+		return nil, nil, fmt.Errorf("SOQL query is required (e.g. salesforce:SELECT Id, Name FROM Account)")
+	}
+
+	var records []map[string]interface{}
+	endpoint := fmt.Sprintf("%s/services/data/%s/query?q=%s", instanceURL, salesforceAPI, url.QueryEscape(soql))
+	for endpoint != "" {
+		var page struct {
+			Records        []map[string]interface{} `json:"records"`
+			NextRecordsURL string                   `json:"nextRecordsUrl"`
+		}
+		if err := connectorRequest(http.MethodGet, endpoint, bearerAuth(token), nil, &page); err != nil {
+			return nil, nil, err
+		}
+
+		for _, record := range page.Records {
+			delete(record, "attributes")
+			for _, v := range record {
+				if nested, ok := v.(map[string]interface{}); ok {
+					delete(nested, "attributes")
+				}
+			}
+			records = append(records, record)
+		}
+
+		infof("Fetched %d records", len(records))
+		endpoint = ""
+		if page.NextRecordsURL != "" {
+			endpoint = instanceURL + page.NextRecordsURL
+		}
+	}
+
+	if len(records) == 0 {
+		return nil, nil, fmt.Errorf("Salesforce query returned no records")
+	}
+	headers, rows := flattenRecords(records)
+	return headers, rows, nil
+}
+
+// pushSalesforce updates records through the composite sObject collections API
+func pushSalesforce(soql string, updates []recordUpdate) error {
+	instanceURL, token, err := salesforceCredentials()
+	if err != nil {
+		return err
+	}
+
+	// The object type is the identifier following FROM
+	fields := strings.Fields(soql)
+	objectType := ""
+	for i, field := range fields {
+		if strings.EqualFold(field, "FROM") && i+1 < len(fields) {
+			objectType = fields[i+1]
+			break
+		}
+	}
+	if objectType == "" {
+		return fmt.Errorf("cannot determine the Salesforce object from query '%s'", soql)
+	}
+
+	endpoint := fmt.Sprintf("%s/services/data/%s/composite/sobjects", instanceURL, salesforceAPI)
+	for start := 0; start < len(updates); start += salesforceBatchSize {
+		end := common.Min(start+salesforceBatchSize, len(updates))
+		records := make([]map[string]interface{}, 0, end-start)
+		for _, update := range updates[start:end] {
+			record := map[string]interface{}{
+				"attributes": map[string]string{"type": objectType},
+				"id":         update.ID,
+			}
+			for k, v := range update.Properties {
+				record[k] = v
+			}
+			records = append(records, record)
+		}
+
+		var results []struct {
+			ID      string `json:"id"`
+			Success bool   `json:"success"`
+			Errors  []struct {
+				Message string `json:"message"`
+			} `json:"errors"`
+		}
+		body := map[string]interface{}{"allOrNone": false, "records": records}
+		if err := connectorRequest(http.MethodPatch, endpoint, bearerAuth(token), body, &results); err != nil {
+			return fmt.Errorf("batch starting at record %d: %v", start+1, err)
+		}
+		for _, result := range results {
+			if !result.Success && len(result.Errors) > 0 {
+				warnf("record %s not updated: %s", result.ID, result.Errors[0].Message)
+			}
+		}
+		fmt.Printf("Pushed %d/%d records to Salesforce\n", end, len(updates))
+	}
+	return nil
+}
@@ -0,0 +1,351 @@
+package tools
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Google Sheets inputs are written as "gsheet:<spreadsheet ID or URL>",
+// optionally with "?sheet=<tab name>". The first row holds the headers; the
+// sheet_row column records each row's position for writing results back.
+const (
+	sheetsPrefix    = "gsheet:"
+	sheetsBaseURL   = "https://sheets.googleapis.com/v4/spreadsheets"
+	sheetsScope     = "https://www.googleapis.com/auth/spreadsheets"
+	sheetsRowColumn = "sheet_row"
+)
+
+var (
+	// sheetsIDPattern extracts the spreadsheet ID from a sheet URL
+	sheetsIDPattern = regexp.MustCompile(`/spreadsheets/d/([a-zA-Z0-9_-]+)`)
+	// sheetsGIDPattern extracts the tab ID from a sheet URL
+	sheetsGIDPattern = regexp.MustCompile(`[#&?]gid=(\d+)`)
+)
+
+// sheetsInput identifies a spreadsheet tab
+type sheetsInput struct {
+	ID    string
+	Sheet string // tab name, empty for the first tab
+	GID   string // tab ID from a URL
+}
+
+// parseSheetsInput accepts a spreadsheet ID or URL with an optional
+// ?sheet=<tab name>
+func parseSheetsInput(spec string) (sheetsInput, error) {
+	var input sheetsInput
+	if m := sheetsIDPattern.FindStringSubmatch(spec); m != nil {
+		input.ID = m[1]
+		if g := sheetsGIDPattern.FindStringSubmatch(spec); g != nil {
+			input.GID = g[1]
+		}
+		return input, nil
+	}
+
+	id, query, _ := strings.Cut(spec, "?")
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return input, err
+	}
+	input.ID = strings.TrimSpace(id)
+	input.Sheet = values.Get("sheet")
+	if input.ID == "" {
+		return input, fmt.Errorf("spreadsheet ID or URL is required (e.g. gsheet:1AbC...?sheet=Leads)")
+	}
+	return input, nil
+}
+
+// sheetsAuth returns request headers for the Sheets API. GOOGLE_SHEETS_TOKEN
+// holds an OAuth access token; otherwise GOOGLE_APPLICATION_CREDENTIALS must
+// point to a service account key file.
+func sheetsAuth() (map[string]string, error) {
+	if token := os.Getenv("GOOGLE_SHEETS_TOKEN"); token != "" {
+		return bearerAuth(token), nil
+	}
+	keyFile := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+	if keyFile == "" {
+		return nil, fmt.Errorf("GOOGLE_SHEETS_TOKEN or GOOGLE_APPLICATION_CREDENTIALS must be set")
+	}
+	token, err := serviceAccountToken(keyFile, sheetsScope)
+	if err != nil {
+		return nil, fmt.Errorf("service account: %v", err)
+	}
+	return bearerAuth(token), nil
+}
+
+// serviceAccountToken exchanges a signed JWT for an access token
+func serviceAccountToken(keyFile, scope string) (string, error) {
+	data, err := os.ReadFile(keyFile)
+	if err != nil {
+		return "", err
+	}
+	var key struct {
+		ClientEmail string `json:"client_email"`
+		PrivateKey  string `json:"private_key"`
+		TokenURI    string `json:"token_uri"`
+	}
+	if err := json.Unmarshal(data, &key); err != nil {
+		return "", fmt.Errorf("invalid key file: %v", err)
+	}
+	if key.TokenURI == "" {
+		key.TokenURI = "https://oauth2.googleapis.com/token"
+	}
+
+	block, _ := pem.Decode([]byte(key.PrivateKey))
+	if block == nil {
+		return "", fmt.Errorf("key file has no private key")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return "", fmt.Errorf("invalid private key: %v", err)
+	}
+	privateKey, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return "", fmt.Errorf("private key is not RSA")
+	}
+
+	now := time.Now().Unix()
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`))
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iss":   key.ClientEmail,
+		"scope": scope,
+		"aud":   key.TokenURI,
+		"iat":   now,
+		"exp":   now + 3600,
+	})
+	unsigned := header + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(nil, privateKey, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	assertion := unsigned + "." + base64.RawURLEncoding.EncodeToString(signature)
+
+	resp, err := http.PostForm(key.TokenURI, url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var token struct {
+		AccessToken      string `json:"access_token"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("invalid token response: %v", err)
+	}
+	if token.AccessToken == "" {
+		return "", fmt.Errorf("token request failed (HTTP %d): %s", resp.StatusCode, token.ErrorDescription)
+	}
+	return token.AccessToken, nil
+}
+
+// resolveSheetName returns the tab name, looking up the tab ID or the first
+// tab when no name was given
+func resolveSheetName(input sheetsInput, auth map[string]string) (string, error) {
+	if input.Sheet != "" {
+		return input.Sheet, nil
+	}
+	var spreadsheet struct {
+		Sheets []struct {
+			Properties struct {
+				SheetID int64  `json:"sheetId"`
+				Title   string `json:"title"`
+			} `json:"properties"`
+		} `json:"sheets"`
+	}
+	endpoint := fmt.Sprintf("%s/%s?fields=sheets.properties(sheetId,title)", sheetsBaseURL, input.ID)
+	if err := connectorRequest(http.MethodGet, endpoint, auth, nil, &spreadsheet); err != nil {
+		return "", err
+	}
+	if len(spreadsheet.Sheets) == 0 {
+		return "", fmt.Errorf("spreadsheet has no tabs")
+	}
+	if input.GID == "" {
+		return spreadsheet.Sheets[0].Properties.Title, nil
+	}
+	for _, sheet := range spreadsheet.Sheets {
+		if strconv.FormatInt(sheet.Properties.SheetID, 10) == input.GID {
+			return sheet.Properties.Title, nil
+		}
+	}
+	return "", fmt.Errorf("no tab with gid %s", input.GID)
+}
+
+// sheetsRange builds an A1 range on a tab, quoting the tab name
+func sheetsRange(sheet, cells string) string {
+	quoted := "'" + strings.ReplaceAll(sheet, "'", "''") + "'"
+	if cells == "" {
+		return quoted
+	}
+	return quoted + "!" + cells
+}
+
+// sheetsColumn converts a 0-based column index to its letters (A, B, ..., AA)
+func sheetsColumn(index int) string {
+	letters := ""
+	for index >= 0 {
+		letters = string(rune('A'+index%26)) + letters
+		index = index/26 - 1
+	}
+	return letters
+}
+
+// readSheetValues returns the formatted cell values of a tab
+func readSheetValues(id, sheet string, auth map[string]string) ([][]string, error) {
+	var result struct {
+		Values [][]interface{} `json:"values"`
+	}
+	endpoint := fmt.Sprintf("%s/%s/values/%s?valueRenderOption=FORMATTED_VALUE", sheetsBaseURL, id, url.PathEscape(sheetsRange(sheet, "")))
+	if err := connectorRequest(http.MethodGet, endpoint, auth, nil, &result); err != nil {
+		return nil, err
+	}
+	values := make([][]string, len(result.Values))
+	for i, row := range result.Values {
+		values[i] = make([]string, len(row))
+		for j, cell := range row {
+			values[i][j] = fmt.Sprint(cell)
+		}
+	}
+	return values, nil
+}
+
+// loadGoogleSheet reads a tab; the first row holds the headers. Empty rows
+// are skipped.
+func loadGoogleSheet(spec string) ([]string, [][]string, error) {
+	auth, err := sheetsAuth()
+	if err != nil {
+		return nil, nil, err
+	}
+	input, err := parseSheetsInput(spec)
+	if err != nil {
+		return nil, nil, err
+	}
+	sheet, err := resolveSheetName(input, auth)
+	if err != nil {
+		return nil, nil, err
+	}
+	values, err := readSheetValues(input.ID, sheet, auth)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(values) < 2 {
+		return nil, nil, fmt.Errorf("sheet '%s' must have headers and at least one data row", sheet)
+	}
+
+	headers := append([]string{sheetsRowColumn}, values[0]...)
+	var rows [][]string
+	for i, values := range values[1:] {
+		if strings.TrimSpace(strings.Join(values, "")) == "" {
+			continue
+		}
+		row := make([]string, len(headers))
+		row[0] = strconv.Itoa(i + 2)
+		copy(row[1:], values)
+		rows = append(rows, row)
+	}
+	return headers, rows, nil
+}
+
+// pushGoogleSheet writes the generated values into the rows they came from.
+// Columns missing from the header row are added after the last column.
+func pushGoogleSheet(spec string, updates []recordUpdate) error {
+	auth, err := sheetsAuth()
+	if err != nil {
+		return err
+	}
+	input, err := parseSheetsInput(spec)
+	if err != nil {
+		return err
+	}
+	sheet, err := resolveSheetName(input, auth)
+	if err != nil {
+		return err
+	}
+
+	var header struct {
+		Values [][]interface{} `json:"values"`
+	}
+	endpoint := fmt.Sprintf("%s/%s/values/%s", sheetsBaseURL, input.ID, url.PathEscape(sheetsRange(sheet, "1:1")))
+	if err := connectorRequest(http.MethodGet, endpoint, auth, nil, &header); err != nil {
+		return err
+	}
+	var headers []string
+	if len(header.Values) > 0 {
+		for _, cell := range header.Values[0] {
+			headers = append(headers, fmt.Sprint(cell))
+		}
+	}
+
+	// Cell values by column index and sheet row
+	columns := make(map[int]map[int]string)
+	var data []map[string]interface{}
+	for _, update := range updates {
+		row, err := strconv.Atoi(update.ID)
+		if err != nil || row < 2 {
+			return fmt.Errorf("invalid %s '%s'", sheetsRowColumn, update.ID)
+		}
+		for name, value := range update.Properties {
+			col := indexOf(headers, name)
+			if col == -1 {
+				col = len(headers)
+				headers = append(headers, name)
+				data = append(data, map[string]interface{}{
+					"range":  sheetsRange(sheet, sheetsColumn(col)+"1"),
+					"values": [][]string{{name}},
+				})
+			}
+			if columns[col] == nil {
+				columns[col] = make(map[int]string)
+			}
+			columns[col][row] = value
+		}
+	}
+
+	// One range per run of consecutive rows in a column
+	for col, cells := range columns {
+		for row := range cells {
+			if _, continued := cells[row-1]; continued {
+				continue
+			}
+			var values [][]string
+			for end := row; ; end++ {
+				value, ok := cells[end]
+				if !ok {
+					break
+				}
+				values = append(values, []string{value})
+			}
+			data = append(data, map[string]interface{}{
+				"range":  sheetsRange(sheet, fmt.Sprintf("%s%d", sheetsColumn(col), row)),
+				"values": values,
+			})
+		}
+	}
+	if len(data) == 0 {
+		return nil
+	}
+
+	payload := map[string]interface{}{"valueInputOption": "RAW", "data": data}
+	endpoint = fmt.Sprintf("%s/%s/values:batchUpdate", sheetsBaseURL, input.ID)
+	if err := connectorRequest(http.MethodPost, endpoint, auth, payload, nil); err != nil {
+		return err
+	}
+	fmt.Printf("Pushed %d rows to Google Sheet tab '%s'\n", len(updates), sheet)
+	return nil
+}
@@ -0,0 +1,346 @@
+package tools
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"ai-general-tool/common"
+)
+
+// Ticket inputs are written as "zendesk:tickets?days=7&status=open" or
+// "intercom:conversations?days=7&state=open". A generated column named
+// "tags" adds tags; other columns are written to custom fields/attributes.
+const (
+	zendeskPrefix  = "zendesk:"
+	intercomPrefix = "intercom:"
+
+	zendeskBatchSize   = 100
+	intercomBaseURL    = "https://api.intercom.io"
+	intercomAPIVersion = "2.11"
+	intercomPageSize   = 150
+	ticketDefaultDays  = 7
+	ticketTagsColumn   = "tags"
+)
+
+// htmlTagPattern matches markup stripped from message bodies
+var htmlTagPattern = regexp.MustCompile(`<[^>]+>`)
+
+// parseTicketInput returns the lookback window and status filter of a spec
+// such as "tickets?days=7&status=open,pending"
+func parseTicketInput(spec, statusParam string) (time.Time, map[string]bool, error) {
+	_, query, _ := strings.Cut(spec, "?")
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return time.Time{}, nil, err
+	}
+
+	days := ticketDefaultDays
+	if d := values.Get("days"); d != "" {
+		if days, err = strconv.Atoi(d); err != nil || days <= 0 {
+			return time.Time{}, nil, fmt.Errorf("invalid days '%s'", d)
+		}
+	}
+
+	var statuses map[string]bool
+	if s := values.Get(statusParam); s != "" {
+		statuses = make(map[string]bool)
+		for _, status := range strings.Split(s, ",") {
+			statuses[strings.TrimSpace(status)] = true
+		}
+	}
+
+	return time.Now().AddDate(0, 0, -days), statuses, nil
+}
+
+// splitTags splits a comma-separated tag list, normalizing whitespace
+func splitTags(value string) []string {
+	var tags []string
+	for _, tag := range strings.Split(value, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, strings.ReplaceAll(tag, " ", "_"))
+		}
+	}
+	return tags
+}
+
+// zendeskCredentials returns the API base URL and auth headers
+func zendeskCredentials() (string, map[string]string, error) {
+	subdomain := os.Getenv("ZENDESK_SUBDOMAIN")
+	email := os.Getenv("ZENDESK_EMAIL")
+	token := os.Getenv("ZENDESK_API_TOKEN")
+	if subdomain == "" || email == "" || token == "" {
+		return "", nil, fmt.Errorf("ZENDESK_SUBDOMAIN, ZENDESK_EMAIL and ZENDESK_API_TOKEN must be set")
+	}
+	return fmt.Sprintf("https://%s.zendesk.com/api/v2", subdomain), basicAuth(email+"/token", token), nil
+}
+
+// loadZendesk pulls recently updated tickets through the incremental export
+func loadZendesk(spec string) ([]string, [][]string, error) {
+	baseURL, auth, err := zendeskCredentials()
+	if err != nil {
+		return nil, nil, err
+	}
+	since, statuses, err := parseTicketInput(spec, "status")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	headers := []string{"id", "subject", "description", "status", "priority", "type", "tags", "created_at", "updated_at"}
+	var rows [][]string
+
+	endpoint := fmt.Sprintf("%s/incremental/tickets/cursor.json?start_time=%d", baseURL, since.Unix())
+	for {
+		var page struct {
+			Tickets []struct {
+				ID          int64    `json:"id"`
+				Subject     string   `json:"subject"`
+				Description string   `json:"description"`
+				Status      string   `json:"status"`
+				Priority    string   `json:"priority"`
+				Type        string   `json:"type"`
+				Tags        []string `json:"tags"`
+				CreatedAt   string   `json:"created_at"`
+				UpdatedAt   string   `json:"updated_at"`
+			} `json:"tickets"`
+			AfterCursor string `json:"after_cursor"`
+			EndOfStream bool   `json:"end_of_stream"`
+		}
+		if err := connectorRequest(http.MethodGet, endpoint, auth, nil, &page); err != nil {
+			return nil, nil, err
+		}
+
+		for _, t := range page.Tickets {
+			if t.Status == "deleted" || (statuses != nil && !statuses[t.Status]) {
+				continue
+			}
+			rows = append(rows, []string{
+				strconv.FormatInt(t.ID, 10), t.Subject, t.Description, t.Status, t.Priority, t.Type,
+				strings.Join(t.Tags, ","), t.CreatedAt, t.UpdatedAt,
+			})
+		}
+
+		infof("Fetched %d tickets", len(rows))
+		if page.EndOfStream || page.AfterCursor == "" {
+			break
+		}
+		endpoint = fmt.Sprintf("%s/incremental/tickets/cursor.json?cursor=%s", baseURL, url.QueryEscape(page.AfterCursor))
+	}
+
+	if len(rows) == 0 {
+		return nil, nil, fmt.Errorf("Zendesk returned no tickets")
+	}
+	return headers, rows, nil
+}
+
+// pushZendesk adds tags and sets custom fields matched by field title
+func pushZendesk(spec string, updates []recordUpdate) error {
+	baseURL, auth, err := zendeskCredentials()
+	if err != nil {
+		return err
+	}
+
+	// Map custom field titles to IDs
+	var fields struct {
+		TicketFields []struct {
+			ID    int64  `json:"id"`
+			Title string `json:"title"`
+		} `json:"ticket_fields"`
+	}
+	if err := connectorRequest(http.MethodGet, baseURL+"/ticket_fields.json", auth, nil, &fields); err != nil {
+		return err
+	}
+	fieldIDs := make(map[string]int64)
+	for _, field := range fields.TicketFields {
+		fieldIDs[strings.ToLower(field.Title)] = field.ID
+	}
+
+	tickets := make([]map[string]interface{}, 0, len(updates))
+	for _, update := range updates {
+		id, err := strconv.ParseInt(update.ID, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid ticket id '%s'", update.ID)
+		}
+		ticket := map[string]interface{}{"id": id}
+		var customFields []map[string]interface{}
+		for name, value := range update.Properties {
+			if name == ticketTagsColumn {
+				ticket["additional_tags"] = splitTags(value)
+				continue
+			}
+			fieldID, ok := fieldIDs[strings.ToLower(name)]
+			if !ok {
+				return fmt.Errorf("no Zendesk ticket field titled '%s'", name)
+			}
+			customFields = append(customFields, map[string]interface{}{"id": fieldID, "value": value})
+		}
+		if len(customFields) > 0 {
+			ticket["custom_fields"] = customFields
+		}
+		tickets = append(tickets, ticket)
+	}
+
+	for start := 0; start < len(tickets); start += zendeskBatchSize {
+		end := common.Min(start+zendeskBatchSize, len(tickets))
+		body := map[string]interface{}{"tickets": tickets[start:end]}
+		if err := connectorRequest(http.MethodPut, baseURL+"/tickets/update_many.json", auth, body, nil); err != nil {
+			return fmt.Errorf("batch starting at ticket %d: %v", start+1, err)
+		}
+		fmt.Printf("Pushed %d/%d tickets to Zendesk\n", end, len(tickets))
+	}
+	return nil
+}
+
+// intercomHeaders returns the auth and version headers for Intercom
+func intercomHeaders() (map[string]string, error) {
+	token := os.Getenv("INTERCOM_TOKEN")
+	if token == "" {
+		return nil, fmt.Errorf("INTERCOM_TOKEN not found in environment")
+	}
+	headers := bearerAuth(token)
+	headers["Intercom-Version"] = intercomAPIVersion
+	return headers, nil
+}
+
+// loadIntercom searches for recently updated conversations
+func loadIntercom(spec string) ([]string, [][]string, error) {
+	auth, err := intercomHeaders()
+	if err != nil {
+		return nil, nil, err
+	}
+	since, states, err := parseTicketInput(spec, "state")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	headers := []string{"id", "title", "body", "state", "tags", "created_at", "updated_at"}
+	var rows [][]string
+
+	startingAfter := ""
+	for {
+		pagination := map[string]interface{}{"per_page": intercomPageSize}
+		if startingAfter != "" {
+			pagination["starting_after"] = startingAfter
+		}
+		body := map[string]interface{}{
+			"query":      map[string]interface{}{"field": "updated_at", "operator": ">", "value": since.Unix()},
+			"pagination": pagination,
+		}
+
+		var page struct {
+			Conversations []struct {
+				ID        string `json:"id"`
+				Title     string `json:"title"`
+				State     string `json:"state"`
+				CreatedAt int64  `json:"created_at"`
+				UpdatedAt int64  `json:"updated_at"`
+				Source    struct {
+					Subject string `json:"subject"`
+					Body    string `json:"body"`
+				} `json:"source"`
+				Tags struct {
+					Tags []struct {
+						Name string `json:"name"`
+					} `json:"tags"`
+				} `json:"tags"`
+			} `json:"conversations"`
+			Pages struct {
+				Next struct {
+					StartingAfter string `json:"starting_after"`
+				} `json:"next"`
+			} `json:"pages"`
+		}
+		if err := connectorRequest(http.MethodPost, intercomBaseURL+"/conversations/search", auth, body, &page); err != nil {
+			return nil, nil, err
+		}
+
+		for _, c := range page.Conversations {
+			if states != nil && !states[c.State] {
+				continue
+			}
+			title := c.Title
+			if title == "" {
+				title = c.Source.Subject
+			}
+			var tags []string
+			for _, tag := range c.Tags.Tags {
+				tags = append(tags, tag.Name)
+			}
+			rows = append(rows, []string{
+				c.ID, title, strings.TrimSpace(html.UnescapeString(htmlTagPattern.ReplaceAllString(c.Source.Body, " "))), c.State,
+				strings.Join(tags, ","),
+				time.Unix(c.CreatedAt, 0).UTC().Format(time.RFC3339), time.Unix(c.UpdatedAt, 0).UTC().Format(time.RFC3339),
+			})
+		}
+
+		infof("Fetched %d conversations", len(rows))
+		startingAfter = page.Pages.Next.StartingAfter
+		if startingAfter == "" {
+			break
+		}
+	}
+
+	if len(rows) == 0 {
+		return nil, nil, fmt.Errorf("Intercom returned no conversations")
+	}
+	return headers, rows, nil
+}
+
+// pushIntercom tags conversations and sets custom attributes
+func pushIntercom(spec string, updates []recordUpdate) error {
+	auth, err := intercomHeaders()
+	if err != nil {
+		return err
+	}
+	adminID := os.Getenv("INTERCOM_ADMIN_ID")
+
+	tagIDs := make(map[string]string)
+	for i, update := range updates {
+		attributes := make(map[string]string)
+		for name, value := range update.Properties {
+			if name != ticketTagsColumn {
+				attributes[name] = value
+				continue
+			}
+			if adminID == "" {
+				return fmt.Errorf("INTERCOM_ADMIN_ID must be set to tag conversations")
+			}
+			for _, tag := range splitTags(value) {
+				// Creating a tag that already exists returns the existing one
+				if _, ok := tagIDs[tag]; !ok {
+					var created struct {
+						ID string `json:"id"`
+					}
+					if err := connectorRequest(http.MethodPost, intercomBaseURL+"/tags", auth, map[string]string{"name": tag}, &created); err != nil {
+						return fmt.Errorf("error creating tag '%s': %v", tag, err)
+					}
+					tagIDs[tag] = created.ID
+				}
+				endpoint := fmt.Sprintf("%s/conversations/%s/tags", intercomBaseURL, update.ID)
+				body := map[string]string{"id": tagIDs[tag], "admin_id": adminID}
+				if err := connectorRequest(http.MethodPost, endpoint, auth, body, nil); err != nil {
+					return fmt.Errorf("conversation %s: %v", update.ID, err)
+				}
+			}
+		}
+
+		if len(attributes) > 0 {
+			endpoint := fmt.Sprintf("%s/conversations/%s", intercomBaseURL, update.ID)
+			body := map[string]interface{}{"custom_attributes": attributes}
+			if err := connectorRequest(http.MethodPut, endpoint, auth, body, nil); err != nil {
+				return fmt.Errorf("conversation %s: %v", update.ID, err)
+			}
+		}
+
+		if (i+1)%50 == 0 || i+1 == len(updates) {
+			fmt.Printf("Pushed %d/%d conversations to Intercom\n", i+1, len(updates))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,217 @@
+package tools
+
+import (
+	"flag"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// RunSplit handles the split command: it writes a file per distinct value of
+// a column and/or chunks of a fixed number of rows, or routes the rows to a
+// sheet per value
+func RunSplit(args []string) error {
+	fs := flag.NewFlagSet("split", flag.ExitOnError)
+
+	// Define flags
+	inputFile := fs.String("input", "", "Input file (CSV, Excel or JSON)")
+	outputFile := fs.String("output", "", "Output file name the parts are named after (default: the input name)")
+	input := inputFlags(fs)
+	output := outputFlags(fs)
+	fs.StringVar(&output.SplitBy, "by", "", "Write one file per distinct value of this column, e.g. country")
+	fs.IntVar(&output.SplitSize, "size", 0, "Write files of at most this many rows, e.g. 50000")
+	fs.StringVar(&output.SheetBy, "sheet-by", "", "Excel/ODS output: write one sheet per distinct value of this column")
+
+	// Parse flags
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	// Handle positional argument for filename
+	if *inputFile == "" && fs.NArg() > 0 {
+		*inputFile = fs.Arg(0)
+	}
+
+	// Validation
+	if *inputFile == "" {
+		return fmt.Errorf("input file is required")
+	}
+	if output.SplitBy == "" && output.SplitSize <= 0 && output.SheetBy == "" {
+		return fmt.Errorf("-by, -size or -sheet-by is required")
+	}
+	if *outputFile == "" {
+		*outputFile = outputStem(*inputFile) + outputExt(*inputFile, output.Format)
+		if output.SplitBy == "" && output.SplitSize <= 0 {
+			// A single workbook must not replace the input
+			*outputFile = suffixedOutputFile(*inputFile, output.Format, "_sheets")
+		}
+	}
+	name, err := output.compressedName(*outputFile)
+	if err != nil {
+		return err
+	}
+	*outputFile = name
+
+	fmt.Printf("Loading %s...\n", *inputFile)
+	headers, rows, err := loadInputFile(*inputFile, *input)
+	if err != nil {
+		return fmt.Errorf("error loading input: %v", err)
+	}
+	if err := checkSplit(*output, *outputFile, headers, nil); err != nil {
+		return err
+	}
+	fmt.Printf("Loaded %d rows with %d columns\n", len(rows), len(headers))
+
+	if output.SplitBy == "" && output.SplitSize <= 0 {
+		if err := saveOutputTable(*outputFile, headers, rows, nil, *output); err != nil {
+			return fmt.Errorf("error saving output: %v", err)
+		}
+		fmt.Printf("Output saved to: %s\n", *outputFile)
+		return nil
+	}
+	return saveSplitOutput(*outputFile, headers, rows, nil, *output)
+}
+
+// splitFlags registers the flags that split an output into several files or
+// route its rows to several sheets
+func splitFlags(fs *flag.FlagSet, opts *OutputOptions) {
+	fs.StringVar(&opts.SplitBy, "split-by", "", "Write one output file per distinct value of this column, e.g. region")
+	fs.IntVar(&opts.SplitSize, "split-size", 0, "Write outputs of at most this many rows, e.g. 50000 (default: no limit)")
+	fs.StringVar(&opts.SheetBy, "sheet-by", "", "Excel/ODS output: write one sheet per distinct value of this column, e.g. category")
+}
+
+// checkSplit validates the split and sheet routing flags before any work is
+// done. Their columns may be input columns or generated ones.
+func checkSplit(opts OutputOptions, outputFile string, headers []string, columnSpecs []ColumnSpec) error {
+	if opts.SplitSize < 0 {
+		return fmt.Errorf("split size must be positive")
+	}
+	if opts.SplitBy != "" || opts.SplitSize > 0 {
+		if outputFile == stdioName || isCloudURI(outputFile) {
+			return fmt.Errorf("split outputs need a local output file name")
+		}
+		if err := checkOutputColumn("split", opts.SplitBy, opts, headers, columnSpecs); err != nil {
+			return err
+		}
+	}
+	if opts.SheetBy != "" {
+		workbook := opts.Format == "ods" || opts.Format == "same" && (isExcelWorkbook(outputFile) || isODSFile(outputFile))
+		if !workbook {
+			return fmt.Errorf("-sheet-by needs an Excel (.xlsx) or .ods output file")
+		}
+		if err := checkOutputColumn("sheet", opts.SheetBy, opts, headers, columnSpecs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkOutputColumn checks that a column used to split the output is part of
+// it
+func checkOutputColumn(use, column string, opts OutputOptions, headers []string, columnSpecs []ColumnSpec) error {
+	if column == "" {
+		return nil
+	}
+	for _, spec := range columnSpecs {
+		if spec.Name == column {
+			return nil
+		}
+	}
+	switch {
+	case indexOf(headers, column) == -1:
+		return fmt.Errorf("%s column '%s' not found", use, column)
+	case opts.Mode == outputModeDelta && column != opts.KeyColumn:
+		return fmt.Errorf("%s column '%s' is not in the delta output; use the key column or a generated column", use, column)
+	}
+	return nil
+}
+
+// outputPart is one file of a split output
+type outputPart struct {
+	Name string
+	Rows [][]string
+}
+
+// splitRows groups rows by the value of a column and chunks each group into
+// at most size rows. Part names are
+// the output name with the value and the chunk number added, e.g.
+// out_DE_part2.csv.
+func splitRows(outputFile string, headers []string, rows [][]string, column string, size int) []outputPart {
+	groups := []rowGroup{{Rows: rows}}
+	if column != "" {
+		groups = groupRows(headers, rows, column, fileNamePart)
+	}
+
+	var parts []outputPart
+	for _, g := range groups {
+		if size <= 0 || len(g.Rows) <= size {
+			parts = append(parts, outputPart{Name: partName(outputFile, g.Name), Rows: g.Rows})
+			continue
+		}
+		chunks := (len(g.Rows) + size - 1) / size
+		width := len(fmt.Sprint(chunks))
+		for i := 0; i < chunks; i++ {
+			suffix := fmt.Sprintf("part%0*d", width, i+1)
+			if g.Name != "" {
+				suffix = g.Name + "_" + suffix
+			}
+			end := min((i+1)*size, len(g.Rows))
+			parts = append(parts, outputPart{Name: partName(outputFile, suffix), Rows: g.Rows[i*size : end]})
+		}
+	}
+	return parts
+}
+
+// partName adds a suffix to a file name before its extension, keeping a
+// gzip suffix last: out.csv.gz -> out_DE.csv.gz
+func partName(filename, suffix string) string {
+	if suffix == "" {
+		return filename
+	}
+	gz := ""
+	if isGzipFile(filename) {
+		gz = filename[len(filename)-len(gzipSuffix):]
+		filename = filename[:len(filename)-len(gzipSuffix)]
+	}
+	ext := filepath.Ext(filename)
+	return strings.TrimSuffix(filename, ext) + "_" + suffix + ext + gz
+}
+
+// fileNamePart turns a column value into a safe piece of a file name
+func fileNamePart(value string) string {
+	name := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '.' {
+			return r
+		}
+		return '_'
+	}, strings.TrimSpace(value))
+	name = strings.Trim(name, "._")
+	if name == "" {
+		return "blank"
+	}
+	if runes := []rune(name); len(runes) > 60 {
+		name = string(runes[:60])
+	}
+	return name
+}
+
+// saveSplitOutput writes each part of a split output to its own file
+func saveSplitOutput(outputFile string, headers []string, rows [][]string, columnSpecs []ColumnSpec, opts OutputOptions) error {
+	if opts.SplitBy != "" && indexOf(headers, opts.SplitBy) == -1 {
+		return fmt.Errorf("split column '%s' not found", opts.SplitBy)
+	}
+	opts.Workbook = "" // parts hold different rows than the input sheet
+
+	parts := splitRows(outputFile, headers, rows, opts.SplitBy, opts.SplitSize)
+	for _, part := range parts {
+		if err := saveOutputTable(part.Name, headers, part.Rows, columnSpecs, opts); err != nil {
+			return fmt.Errorf("error writing %s: %v", part.Name, err)
+		}
+	}
+	fmt.Printf("Split output into %d files:\n", len(parts))
+	for _, part := range parts {
+		fmt.Printf("  %s (%d rows)\n", part.Name, len(part.Rows))
+	}
+	return nil
+}
@@ -0,0 +1,315 @@
+package tools
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"ai-general-tool/common"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// sqliteExtensions lists the file extensions read and written as SQLite
+var sqliteExtensions = map[string]bool{".sqlite": true, ".sqlite3": true, ".db": true}
+
+// sqliteDefaultTable receives the output when no table is named
+const sqliteDefaultTable = "enriched"
+
+// isSQLiteFile reports whether a file name has a SQLite extension
+func isSQLiteFile(filename string) bool {
+	return sqliteExtensions[strings.ToLower(filepath.Ext(filename))]
+}
+
+// RunReadSQLite handles the read-sqlite command
+func RunReadSQLite(args []string) error {
+	fs := flag.NewFlagSet("read-sqlite", flag.ExitOnError)
+
+	// Define flags
+	fileName := fs.String("file", "", "SQLite database to read (required)")
+	table := fs.String("table", "", "Table to read (lists the tables when omitted)")
+	query := fs.String("query", "", "SELECT query to read instead of a table")
+	rowCount := fs.Int("rows", 20, "Number of rows to display")
+	sampleType := fs.String("sample", "first", "Sample type: 'first' or 'random'")
+	format := fs.String("format", "text", "Output format: text, md (Markdown), html, json")
+	applyJSON := jsonFlag(fs, format)
+	chart := chartFlags(fs)
+
+	// Parse flags
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	applyJSON()
+	if !previewFormats[*format] {
+		return fmt.Errorf("invalid format '%s' (use text, md, html or json)", *format)
+	}
+	if err := chart.check(*format); err != nil {
+		return err
+	}
+
+	// Handle positional argument for filename
+	if *fileName == "" && fs.NArg() > 0 {
+		*fileName = fs.Arg(0)
+	}
+
+	if *fileName == "" {
+		fmt.Println("Error: SQLite file name is required")
+		fmt.Println("\nUsage:")
+		fmt.Println("  read-sqlite <filename> -table <name> [flags]")
+		fmt.Println("  read-sqlite -file <filename> -query \"SELECT ...\" [flags]")
+		fmt.Println("\nFlags:")
+		fs.PrintDefaults()
+		return fmt.Errorf("missing required file argument")
+	}
+
+	if *table == "" && *query == "" {
+		tables, err := listSQLiteTables(*fileName)
+		if err != nil {
+			return err
+		}
+		if len(tables) == 0 {
+			return fmt.Errorf("database has no tables")
+		}
+		if *format == "json" {
+			return printJSON(map[string][]string{"tables": tables})
+		}
+		fmt.Printf("Tables in %s:\n", *fileName)
+		for _, name := range tables {
+			fmt.Printf("  %s\n", name)
+		}
+		fmt.Printf("\nUse: read-sqlite %s -table %s\n", *fileName, tables[0])
+		return nil
+	}
+
+	headers, data, err := loadSQLite(*fileName, *table, *query)
+	if err != nil {
+		return err
+	}
+
+	// Create data preview
+	sheetInfo := "Table: " + *table
+	if *query != "" {
+		sheetInfo = "Query: " + common.TruncateString(*query, 80)
+	}
+	preview := &common.DataPreview{
+		FileName:     *fileName,
+		FileType:     "SQLite Database",
+		SheetInfo:    sheetInfo,
+		TotalRows:    len(data),
+		TotalColumns: len(headers),
+		Headers:      headers,
+		SampleType:   *sampleType,
+	}
+	preview.Columns = analyzeColumns(headers, data)
+	displayRows := selectRows(data, *rowCount, *sampleType)
+	preview.Rows = displayRows
+	preview.RowsDisplayed = len(displayRows)
+
+	if *format == "json" {
+		return printJSON(preview)
+	}
+	if *format != "text" {
+		printPreviewDocument(preview, *format)
+		return nil
+	}
+	displayPreview(preview)
+
+	return chart.print(headers, data, len(data), common.Locale{})
+}
+
+// openSQLite opens a database file, failing when it does not exist
+func openSQLite(filename string, create bool) (*sql.DB, error) {
+	mode := "rw"
+	if create {
+		mode = "rwc"
+	}
+	db, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?mode=%s", filename, mode))
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error opening %s: %v", filename, err)
+	}
+	return db, nil
+}
+
+// listSQLiteTables returns the user tables of a database
+func listSQLiteTables(filename string) ([]string, error) {
+	db, err := openSQLite(filename, false)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query("SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tables []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		tables = append(tables, name)
+	}
+	return tables, rows.Err()
+}
+
+// loadSQLite reads a table, or the result of a query, as text rows
+func loadSQLite(filename, table, query string) ([]string, [][]string, error) {
+	if table == "" && query == "" {
+		tables, err := listSQLiteTables(filename)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(tables) != 1 {
+			return nil, nil, fmt.Errorf("use -table or -query to choose what to read (tables: %s)", strings.Join(tables, ", "))
+		}
+		table = tables[0]
+	}
+	if query == "" {
+		query = "SELECT * FROM " + quoteSQLIdentifier(table)
+	}
+
+	db, err := openSQLite(filename, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer db.Close()
+
+	return querySQLRows(db, query)
+}
+
+// querySQLRows runs a query and formats every value as text; NULL becomes an
+// empty cell
+func querySQLRows(db *sql.DB, query string, args ...interface{}) ([]string, [][]string, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("query failed: %v", err)
+	}
+	defer rows.Close()
+
+	headers, err := rows.Columns()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var data [][]string
+	values := make([]interface{}, len(headers))
+	pointers := make([]interface{}, len(headers))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, nil, err
+		}
+		row := make([]string, len(headers))
+		for i, value := range values {
+			row[i] = formatSQLValue(value)
+		}
+		data = append(data, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	if len(data) == 0 {
+		return nil, nil, fmt.Errorf("query returned no rows")
+	}
+	return headers, data, nil
+}
+
+// formatSQLValue converts a scanned database value to cell text
+func formatSQLValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(v)
+	case string:
+		return v
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case time.Time:
+		return v.Format(time.RFC3339)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// saveSQLite writes the rows to a table of a database file, replacing the
+// table if it exists and leaving other tables untouched. Columns are TEXT
+// unless types gives them a type; dates stay ISO 8601 text.
+func saveSQLite(filename, table string, headers []string, rows [][]string, types []string) error {
+	if table == "" {
+		table = sqliteDefaultTable
+	}
+
+	db, err := openSQLite(filename, true)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	columns := make([]string, len(headers))
+	placeholders := make([]string, len(headers))
+	for i, header := range headers {
+		columns[i] = quoteSQLIdentifier(header) + " TEXT"
+		if i < len(types) {
+			columns[i] = quoteSQLIdentifier(header) + " " + sqliteColumnType(types[i])
+		}
+		placeholders[i] = "?"
+	}
+	if _, err := tx.Exec("DROP TABLE IF EXISTS " + quoteSQLIdentifier(table)); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(fmt.Sprintf("CREATE TABLE %s (%s)", quoteSQLIdentifier(table), strings.Join(columns, ", "))); err != nil {
+		return fmt.Errorf("error creating table: %v", err)
+	}
+
+	insert, err := tx.Prepare(fmt.Sprintf("INSERT INTO %s VALUES (%s)", quoteSQLIdentifier(table), strings.Join(placeholders, ", ")))
+	if err != nil {
+		return err
+	}
+	defer insert.Close()
+
+	values := make([]interface{}, len(headers))
+	for _, row := range rows {
+		for i := range values {
+			values[i] = ""
+			if i < len(row) {
+				values[i] = row[i]
+			}
+			if i < len(types) && types[i] != castDate {
+				values[i] = typedValue(cell(row, i), types[i])
+			}
+		}
+		if _, err := insert.Exec(values...); err != nil {
+			return fmt.Errorf("error inserting row: %v", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// quoteSQLIdentifier quotes a table or column name
+func quoteSQLIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
@@ -0,0 +1,34 @@
+package tools
+
+import (
+	"fmt"
+	"os"
+)
+
+// stdioName stands for stdin as an input and stdout as an output
+const stdioName = "-"
+
+// dataStdout receives output written to stdout. It is captured before
+// progress messages are moved to stderr.
+var dataStdout = os.Stdout
+
+// useStdout resolves the output of a pipeline run: "-" writes CSV (or a
+// Markdown or HTML table) to stdout, which is also the default when reading
+// stdin. Progress messages then go to stderr so that only the data reaches
+// the pipe.
+func useStdout(inputFile string, outputFile *string, opts OutputOptions) (bool, error) {
+	if *outputFile == "" && inputFile == stdioName {
+		*outputFile = stdioName
+	}
+	if *outputFile != stdioName {
+		return false, nil
+	}
+	switch opts.Format {
+	case "same", "csv", "md", "html":
+	default:
+		return false, fmt.Errorf("stdout output is CSV, md or html (got -format %s)", opts.Format)
+	}
+	os.Stdout = os.Stderr
+	messageOutput = os.Stderr
+	return true, nil
+}
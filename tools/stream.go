@@ -0,0 +1,508 @@
+package tools
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// csvStream writes enriched rows to a CSV output in input order. Rows that
+// finish before earlier ones are held back until the gap is filled, so only
+// the rows in flight are kept in memory.
+type csvStream struct {
+	writer      csvRecordWriter
+	headers     []string // input headers
+	columnSpecs []ColumnSpec
+	key         string // key column of delta outputs
+	delta       bool
+	escape      []int // generated output columns whose formulas are escaped
+	next        int
+	pending     map[int][]string
+}
+
+// newCSVStream writes the output header row and returns the stream
+func newCSVStream(w io.Writer, headers []string, columnSpecs []ColumnSpec, opts OutputOptions) (*csvStream, error) {
+	s := &csvStream{
+		writer:      newCSVRecordWriter(w, opts.QuoteAll),
+		headers:     headers,
+		columnSpecs: columnSpecs,
+		key:         opts.KeyColumn,
+		delta:       opts.Mode == outputModeDelta,
+		pending:     make(map[int][]string),
+	}
+	fullHeaders, _ := s.output(nil)
+	if !opts.Formulas {
+		s.escape = generatedColumns(fullHeaders, columnSpecs)
+	}
+	if err := s.writer.Write(fullHeaders); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// output builds the output headers and row of an enriched row, as
+// saveOutputFile does for a whole table
+func (s *csvStream) output(row []string) ([]string, []string) {
+	var rows [][]string
+	if row != nil {
+		rows = [][]string{row}
+	}
+	fullHeaders, outRows := mergeGeneratedColumns(s.headers, rows, s.columnSpecs)
+	if s.delta {
+		key := s.key
+		if key == "" {
+			key = fullHeaders[0]
+		}
+		fullHeaders, outRows = deltaColumns(fullHeaders, outRows, key, s.columnSpecs)
+	}
+	if len(outRows) == 0 {
+		return fullHeaders, nil
+	}
+	return fullHeaders, outRows[0]
+}
+
+// add queues the enriched row with the given input index and writes every
+// row that is now next in order. A nil row takes its place in the order
+// without being written.
+func (s *csvStream) add(index int, row []string) error {
+	s.pending[index] = row
+	for {
+		row, ok := s.pending[s.next]
+		if !ok {
+			return nil
+		}
+		delete(s.pending, s.next)
+		s.next++
+		if row == nil {
+			continue
+		}
+		_, out := s.output(row)
+		if err := s.writer.Write(escapeRow(out, s.escape)); err != nil {
+			return err
+		}
+	}
+}
+
+// flush pushes the written rows to the output
+func (s *csvStream) flush() error {
+	s.writer.Flush()
+	return s.writer.Error()
+}
+
+// streamWindow bounds the rows per worker that are in flight or waiting for
+// earlier rows before being written, which bounds the memory of a stream
+const streamWindow = 64
+
+// streamPeekRows is the number of rows of a streamed input read ahead for the
+// sample test and column selection
+const streamPeekRows = 100
+
+// rowSource yields input rows one at a time, returning io.EOF at the end
+type rowSource interface {
+	Next() ([]string, error)
+}
+
+// sliceSource yields rows that are already loaded
+type sliceSource struct {
+	rows [][]string
+	next int
+}
+
+func (s *sliceSource) Next() ([]string, error) {
+	if s.next >= len(s.rows) {
+		return nil, io.EOF
+	}
+	s.next++
+	return s.rows[s.next-1], nil
+}
+
+// csvRowSource reads the rows of a CSV input one at a time, see
+// csvDialect.rows
+type csvRowSource struct {
+	reader  *csv.Reader
+	swap    bool // single-quoted input, see csvDialect.reader
+	fit     bool // fit rows to the width of the first row
+	start   int  // line of the first row returned, see HeaderOptions.readHeader
+	width   int
+	repairs csvRepairs
+	ended   bool
+}
+
+func (s *csvRowSource) Next() ([]string, error) {
+	record, err := s.reader.Read()
+	if err == io.EOF && s.fit && !s.ended {
+		s.repairs.report()
+		s.ended = true
+	}
+	if err != nil {
+		return nil, err
+	}
+	if s.start > 1 {
+		if line, _ := s.reader.FieldPos(0); line < s.start {
+			return s.Next()
+		}
+		s.start = 0
+	}
+	if s.swap {
+		for i, field := range record {
+			record[i] = swapCSVQuotes(field)
+		}
+	}
+	if s.fit {
+		if s.width == 0 {
+			s.width = len(record)
+		}
+		line, _ := s.reader.FieldPos(0)
+		record = s.repairs.fit(record, s.width, line)
+	}
+	return record, nil
+}
+
+// peekSource lets the first rows of a source be looked at before they are
+// processed
+type peekSource struct {
+	source   rowSource
+	buffered [][]string // rows read ahead by peek
+}
+
+func (s *peekSource) Next() ([]string, error) {
+	if len(s.buffered) > 0 {
+		row := s.buffered[0]
+		s.buffered = s.buffered[1:]
+		return row, nil
+	}
+	return s.source.Next()
+}
+
+// peek returns up to n rows from the start of the remaining input; they are
+// returned again by Next
+func (s *peekSource) peek(n int) ([][]string, error) {
+	for len(s.buffered) < n {
+		row, err := s.source.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		s.buffered = append(s.buffered, row)
+	}
+	if len(s.buffered) == 0 {
+		return nil, io.EOF
+	}
+	return s.buffered[:min(n, len(s.buffered))], nil
+}
+
+// canStreamInput reports whether an input is read row by row with -stream:
+// CSV files, CSV on stdin and Excel workbooks. Other inputs are loaded first.
+func canStreamInput(filename string) bool {
+	if filename == stdioName {
+		return true
+	}
+	if isConnectorSource(filename) || strings.HasPrefix(filename, apiSourcePrefix) || isDatabaseSource(filename) || isCloudURI(filename) {
+		return false
+	}
+	if _, _, ok := splitZipEntry(filename); ok {
+		return false
+	}
+	return !isMultiInput(filename) && (isCSVFile(filename) || isExcelWorkbook(filename))
+}
+
+// openStreamInput reads the header row of an input accepted by
+// canStreamInput and returns a source for the data rows. The caller closes
+// the returned closer.
+func openStreamInput(filename string, opts InputOptions) ([]string, *peekSource, io.Closer, error) {
+	var source rowSource
+	var closer io.Closer
+	if isExcelWorkbook(filename) && isAllSheets(opts.Sheet) {
+		// The sheets are combined before the first row is known
+		headers, rows, err := loadAllSheets(filename, opts)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		return headers, &peekSource{source: &sliceSource{rows: rows}}, io.NopCloser(nil), nil
+	}
+	if isExcelWorkbook(filename) {
+		_, rows, err := openExcelRows(filename, opts.Sheet, opts.Excel)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		source, closer = rows, rows
+	} else {
+		fixed, err := opts.CSV.dialect()
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		file := io.NopCloser(os.Stdin)
+		if filename != stdioName {
+			if file, err = openInput(filename); err != nil {
+				return nil, nil, nil, err
+			}
+		}
+		dialect, r := sniffReader(file, fixed)
+		source = dialect.rows(r)
+		closer = file
+	}
+
+	headers, data, err := opts.Header.readHeader(source)
+	peeked := &peekSource{source: data}
+	if err == nil {
+		_, err = peeked.peek(1)
+	}
+	if err == io.EOF {
+		err = fmt.Errorf("file must have headers and at least one data row")
+	}
+	if err != nil {
+		closer.Close()
+		return nil, nil, nil, err
+	}
+	return headers, peeked, closer, nil
+}
+
+// readRows reads every remaining row of a source
+func readRows(source rowSource) ([][]string, error) {
+	var rows [][]string
+	for {
+		row, err := source.Next()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, row)
+	}
+}
+
+// streamDataset processes the rows of a source like processFullDataset, but
+// writes each enriched row to a CSV output as soon as it and the rows before
+// it are done instead of keeping the dataset in memory: at most streamWindow
+// rows per worker are read ahead of the output. total is the number of rows
+// when known, for progress. Rows left unprocessed by an interrupt or deadline
+// are written with empty generated columns, so the output always has every
+// row. Failed rows are written to the deadLetter file instead, unless it is
+// empty.
+func streamDataset(
+	ctx context.Context,
+	config *ProcessingConfig,
+	headers []string,
+	source rowSource,
+	total int,
+	workerCount int,
+	batchSize int,
+	outputFile string,
+	opts OutputOptions,
+	deadLetter string,
+) (*ProcessingStats, error) {
+	w := io.Writer(dataStdout)
+	var file io.WriteCloser
+	if outputFile != stdioName {
+		var err error
+		if file, err = createOutput(outputFile); err != nil {
+			return nil, err
+		}
+		defer func() {
+			if file != nil {
+				file.Close()
+			}
+		}()
+		w = file
+	}
+	// With a dead-letter file, the output only gets rows that were done, so
+	// the status columns would only say so
+	columnSpecs := config.ColumnSpecs
+	if deadLetter != "" {
+		columnSpecs = withoutStatusColumns(columnSpecs)
+	}
+	stream, err := newCSVStream(w, headers, columnSpecs, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &ProcessingStats{
+		TotalRows: total,
+		StartTime: time.Now(),
+	}
+
+	var dead *deadLetterStream
+	if deadLetter != "" {
+		dead = &deadLetterStream{filename: deadLetter, headers: headers}
+		defer func() {
+			if dead != nil {
+				dead.close()
+			}
+		}()
+	}
+
+	taskChan := make(chan ProcessingTask, workerCount*2)
+	resultChan := make(chan ProcessingResult, workerCount*2)
+
+	// A strict run stops at the first failed row
+	ctx, stop := stats.withStrictStop(ctx, config)
+	defer stop()
+
+	defer config.tuner.tune(ctx, stats)()
+	var wg sync.WaitGroup
+	for i := 0; i < workerCount; i++ {
+		wg.Add(1)
+		go processWorker(ctx, config, taskChan, resultChan, &wg, stats)
+	}
+	go func() {
+		wg.Wait()
+		close(resultChan)
+	}()
+
+	// Input rows read but not yet written, by index. A slot of the window is
+	// taken for each row read and given back when it is written.
+	var inflightMutex sync.Mutex
+	inflight := make(map[int][]string)
+	window := make(chan struct{}, max(workerCount, 1)*streamWindow)
+	sent := 0
+	var readErr error
+
+	// Send tasks in file order until the deadline
+	go func() {
+		defer close(taskChan)
+
+		var deadline <-chan time.Time
+		if !config.Deadline.IsZero() {
+			timer := time.NewTimer(time.Until(config.Deadline))
+			defer timer.Stop()
+			deadline = timer.C
+		}
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-deadline:
+				return
+			case window <- struct{}{}:
+			}
+			row, err := source.Next()
+			if err != nil {
+				if err != io.EOF {
+					readErr = err
+				}
+				<-window
+				return
+			}
+			i := sent
+			inflightMutex.Lock()
+			inflight[i] = row
+			sent++
+			inflightMutex.Unlock()
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-deadline:
+				return
+			case taskChan <- ProcessingTask{RowIndex: i, RowData: rowToMap(headers, row)}:
+			}
+		}
+	}()
+
+	// Write the results as they line up, flushing every batch
+	enrich := func(index int, results map[string]string) []string {
+		inflightMutex.Lock()
+		input := inflight[index]
+		delete(inflight, index)
+		inflightMutex.Unlock()
+
+		row := make([]string, len(headers)+len(columnSpecs))
+		copy(row, input)
+		for i, spec := range columnSpecs {
+			row[len(headers)+i] = results[spec.Name]
+		}
+		fillRowHashes(headers, [][]string{input}, [][]string{row}, columnSpecs)
+		return row
+	}
+	add := func(index int, row []string) error {
+		written := stream.next
+		err := stream.add(index, row)
+		for ; written < stream.next; written++ {
+			<-window
+		}
+		return err
+	}
+	budgetLevel, processed := 0, 0
+	var writeErr error
+	for result := range resultChan {
+		recordResult(config, stats, result, &budgetLevel)
+		stats.strictStop(config, result, result.RowIndex)
+		processed++
+		if writeErr != nil {
+			continue
+		}
+		row := enrich(result.RowIndex, result.Results)
+		if result.Error != nil && dead != nil {
+			// Failed rows go to the dead-letter file instead of the output
+			writeErr = dead.add(row[:len(headers)], result.RowIndex, result.Results)
+			row = nil
+		}
+		if writeErr == nil {
+			writeErr = add(result.RowIndex, row)
+		}
+		if writeErr == nil && batchSize > 0 && processed%batchSize == 0 {
+			if writeErr = stream.flush(); writeErr == nil {
+				config.emit(BatchSaved{Progress: stats.progress(), File: outputFile})
+			}
+		}
+	}
+	if writeErr != nil {
+		return stats, writeErr
+	}
+	if readErr != nil {
+		return stats, fmt.Errorf("error reading input: %v", readErr)
+	}
+
+	// Rows that were read but never processed, and the rest of the input,
+	// keep empty generated columns
+	for stream.next < sent {
+		stats.Remaining = append(stats.Remaining, stream.next)
+		if err := add(stream.next, enrich(stream.next, nil)); err != nil {
+			return stats, err
+		}
+	}
+	for {
+		row, err := source.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return stats, fmt.Errorf("error reading input: %v", err)
+		}
+		inflight[sent] = row
+		sent++
+		stats.Remaining = append(stats.Remaining, stream.next)
+		if err := stream.add(stream.next, enrich(stream.next, nil)); err != nil {
+			return stats, err
+		}
+	}
+	stats.TotalRows = sent
+
+	if err := stream.flush(); err != nil {
+		return stats, err
+	}
+	if file != nil {
+		err := file.Close()
+		file = nil
+		if err != nil {
+			return stats, fmt.Errorf("error closing %s: %v", outputFile, err)
+		}
+	}
+	if dead != nil {
+		err := dead.close()
+		dead = nil
+		if err != nil {
+			return stats, fmt.Errorf("error writing %s: %v", deadLetter, err)
+		}
+	}
+	return stats, nil
+}
@@ -0,0 +1,349 @@
+package tools
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"ai-general-tool/common"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// Kinds of row changes found by diff
+const (
+	diffAdded     = "added"
+	diffRemoved   = "removed"
+	diffChanged   = "changed"
+	diffUnchanged = "unchanged"
+)
+
+// diffColumn holds the change of each row of an annotated diff workbook
+const diffColumn = "_diff"
+
+// diffMaxComments caps the changed cells of an annotated workbook that get a
+// comment with their old value; excelize writes comments slowly
+const diffMaxComments = 10000
+
+// RunDiff handles the diff command: it compares two tabular files, matching
+// rows by key columns or by position, and reports the rows added, removed
+// and changed and the cells that changed
+func RunDiff(args []string) error {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+
+	// Define flags
+	key := fs.String("key", "", "Comma-separated columns matching the rows of both files, e.g. id (default: row position)")
+	normalize := fs.Bool("normalize", false, "Ignore case and surrounding whitespace when comparing cells")
+	examples := fs.Int("examples", 20, "Changed cells listed in the report")
+	outputFile := fs.String("output", "", "Save every change as a table (CSV, Excel, Markdown or HTML) with key, change, column, old and new value")
+	workbook := fs.String("workbook", "", "Save an annotated Excel workbook: the new rows with removed rows appended, added rows green, removed rows red, changed cells yellow with the old value as a comment")
+	input := inputFlags(fs)
+
+	// Parse flags
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		return fmt.Errorf("two files are required: diff [flags] <old> <new>")
+	}
+	oldFile, newFile := fs.Arg(0), fs.Arg(1)
+	if *workbook != "" && !isExcelWorkbook(*workbook) {
+		return fmt.Errorf("-workbook must be an .xlsx file")
+	}
+
+	oldHeaders, oldRows, err := loadInputFile(oldFile, *input)
+	if err != nil {
+		return fmt.Errorf("error loading %s: %v", oldFile, err)
+	}
+	newHeaders, newRows, err := loadInputFile(newFile, *input)
+	if err != nil {
+		return fmt.Errorf("error loading %s: %v", newFile, err)
+	}
+
+	d, err := diffTables(oldHeaders, oldRows, newHeaders, newRows, *key, *normalize)
+	if err != nil {
+		return err
+	}
+	d.print(oldFile, newFile, *examples)
+
+	if *outputFile != "" {
+		if err := saveOutputTable(*outputFile, []string{"Key", "Change", "Column", "Old value", "New value"}, d.changeRows(), nil, OutputOptions{Format: "same"}); err != nil {
+			return fmt.Errorf("error saving changes: %v", err)
+		}
+		fmt.Printf("Changes saved to: %s\n", *outputFile)
+	}
+	if *workbook != "" {
+		if err := d.saveWorkbook(*workbook); err != nil {
+			return fmt.Errorf("error saving workbook: %v", err)
+		}
+		fmt.Printf("Annotated workbook saved to: %s\n", *workbook)
+	}
+	return nil
+}
+
+// cellChange is a cell whose value differs between the files
+type cellChange struct {
+	Column   string
+	Old, New string
+}
+
+// rowDiff is the change of a row: the rows it is in the old and new file
+// (-1 when missing) and, for changed rows, its changed cells
+type rowDiff struct {
+	Key      string
+	Kind     string
+	Old, New int
+	Cells    []cellChange
+}
+
+// tableDiff is the comparison of two files
+type tableDiff struct {
+	oldHeaders, newHeaders []string
+	oldRows, newRows       [][]string
+	added, removed         []string // columns only in the new or old file
+	rows                   []rowDiff
+	duplicateKeys          int // rows of either file whose key was already seen in it
+}
+
+// diffTables matches the rows of two files by their key columns, or by
+// position without keys, and compares the columns both files have
+func diffTables(oldHeaders []string, oldRows [][]string, newHeaders []string, newRows [][]string, keySpec string, normalize bool) (*tableDiff, error) {
+	d := &tableDiff{oldHeaders: oldHeaders, newHeaders: newHeaders, oldRows: oldRows, newRows: newRows}
+	for _, header := range newHeaders {
+		if indexOf(oldHeaders, header) == -1 {
+			d.added = append(d.added, header)
+		}
+	}
+	for _, header := range oldHeaders {
+		if indexOf(newHeaders, header) == -1 {
+			d.removed = append(d.removed, header)
+		}
+	}
+
+	var oldKeys, newKeys []int
+	if strings.TrimSpace(keySpec) != "" {
+		var err error
+		if oldKeys, err = columnIndexes(oldHeaders, keySpec); err != nil {
+			return nil, fmt.Errorf("old file: %v", err)
+		}
+		if newKeys, err = columnIndexes(newHeaders, keySpec); err != nil {
+			return nil, fmt.Errorf("new file: %v", err)
+		}
+	}
+	rowKey := func(row []string, keys []int, r int) string {
+		if keys == nil {
+			return "row " + strconv.Itoa(r+1)
+		}
+		parts := make([]string, len(keys))
+		for i, index := range keys {
+			parts[i] = cell(row, index)
+		}
+		return strings.Join(parts, " | ")
+	}
+
+	oldByKey := make(map[string]int)
+	for r, row := range oldRows {
+		k := rowKey(row, oldKeys, r)
+		if _, ok := oldByKey[k]; ok {
+			d.duplicateKeys++
+			continue
+		}
+		oldByKey[k] = r
+	}
+
+	same := func(a, b string) bool {
+		if normalize {
+			return strings.EqualFold(strings.TrimSpace(a), strings.TrimSpace(b))
+		}
+		return a == b
+	}
+	seen := make(map[string]bool)
+	for r, row := range newRows {
+		k := rowKey(row, newKeys, r)
+		if seen[k] {
+			d.duplicateKeys++
+			continue
+		}
+		seen[k] = true
+		o, ok := oldByKey[k]
+		if !ok {
+			d.rows = append(d.rows, rowDiff{Key: k, Kind: diffAdded, Old: -1, New: r})
+			continue
+		}
+		change := rowDiff{Key: k, Kind: diffUnchanged, Old: o, New: r}
+		for c, header := range newHeaders {
+			oc := indexOf(oldHeaders, header)
+			if oc == -1 {
+				continue
+			}
+			if before, after := cell(oldRows[o], oc), cell(row, c); !same(before, after) {
+				change.Cells = append(change.Cells, cellChange{header, before, after})
+			}
+		}
+		if len(change.Cells) > 0 {
+			change.Kind = diffChanged
+		}
+		d.rows = append(d.rows, change)
+	}
+	for r, row := range oldRows {
+		if k := rowKey(row, oldKeys, r); !seen[k] && oldByKey[k] == r {
+			d.rows = append(d.rows, rowDiff{Key: k, Kind: diffRemoved, Old: r, New: -1})
+		}
+	}
+	return d, nil
+}
+
+// count returns the number of rows with the given change
+func (d *tableDiff) count(kind string) int {
+	n := 0
+	for _, row := range d.rows {
+		if row.Kind == kind {
+			n++
+		}
+	}
+	return n
+}
+
+// print reports the differences: row and column counts, changed cells per
+// column and the first changed cells
+func (d *tableDiff) print(oldFile, newFile string, examples int) {
+	fmt.Printf("\n=== DIFF: %s -> %s ===\n", oldFile, newFile)
+	fmt.Printf("Rows: %d -> %d | Added: %d | Removed: %d | Changed: %d | Unchanged: %d\n",
+		len(d.oldRows), len(d.newRows), d.count(diffAdded), d.count(diffRemoved), d.count(diffChanged), d.count(diffUnchanged))
+	if len(d.added) > 0 {
+		fmt.Printf("Added columns: %s\n", strings.Join(d.added, ", "))
+	}
+	if len(d.removed) > 0 {
+		fmt.Printf("Removed columns: %s\n", strings.Join(d.removed, ", "))
+	}
+	if d.duplicateKeys > 0 {
+		warnf("%d rows repeat a key already seen in their file and were compared by their first occurrence only", d.duplicateKeys)
+	}
+
+	perColumn := make(map[string]int)
+	var cells [][]string
+	for _, row := range d.rows {
+		for _, change := range row.Cells {
+			perColumn[change.Column]++
+			if len(cells) < examples {
+				cells = append(cells, []string{row.Key, change.Column, change.Old, change.New})
+			}
+		}
+	}
+	if len(perColumn) == 0 {
+		fmt.Println("No changed cells")
+		return
+	}
+	var columnRows [][]string
+	for _, header := range d.newHeaders {
+		if n, ok := perColumn[header]; ok {
+			columnRows = append(columnRows, []string{header, strconv.Itoa(n), common.FormatPercentage(n, d.count(diffChanged)+d.count(diffUnchanged))})
+		}
+	}
+	fmt.Println("\nCHANGED CELLS BY COLUMN:")
+	fmt.Println(common.FormatTable([]string{"Column", "Changed", "Of matched rows"}, columnRows, 120))
+	if len(cells) > 0 {
+		fmt.Printf("FIRST %d CHANGED CELLS:\n", len(cells))
+		fmt.Println(common.FormatTable([]string{"Key", "Column", "Old", "New"}, cells, 140))
+	}
+}
+
+// changeRows lists the changes as rows of key, change, column, old and new
+// value: one row per added or removed row and per changed cell
+func (d *tableDiff) changeRows() [][]string {
+	var rows [][]string
+	for _, row := range d.rows {
+		switch row.Kind {
+		case diffAdded, diffRemoved:
+			rows = append(rows, []string{row.Key, row.Kind, "", "", ""})
+		case diffChanged:
+			for _, change := range row.Cells {
+				rows = append(rows, []string{row.Key, row.Kind, change.Column, change.Old, change.New})
+			}
+		}
+	}
+	return rows
+}
+
+// saveWorkbook writes the annotated workbook: a Diff sheet with the change
+// of every row, the new file's columns and then the removed ones, and a
+// Changes sheet listing the changes
+func (d *tableDiff) saveWorkbook(filename string) error {
+	headers := append(append([]string{diffColumn}, d.newHeaders...), d.removed...)
+	var rows [][]string
+	for _, row := range d.rows {
+		out := []string{row.Kind}
+		for _, header := range headers[1:] {
+			value := ""
+			if row.New != -1 {
+				if c := indexOf(d.newHeaders, header); c != -1 {
+					value = cell(d.newRows[row.New], c)
+				}
+			}
+			if row.New == -1 || indexOf(d.newHeaders, header) == -1 {
+				if c := indexOf(d.oldHeaders, header); c != -1 && row.Old != -1 {
+					value = cell(d.oldRows[row.Old], c)
+				}
+			}
+			out = append(out, value)
+		}
+		rows = append(rows, out)
+	}
+
+	f := excelize.NewFile()
+	defer f.Close()
+	const sheet = "Diff"
+	if err := f.SetSheetName("Sheet1", sheet); err != nil {
+		return err
+	}
+	if err := f.SetSheetRow(sheet, "A1", &headers); err != nil {
+		return err
+	}
+	for r, row := range rows {
+		if err := f.SetSheetRow(sheet, fmt.Sprintf("A%d", r+2), &row); err != nil {
+			return err
+		}
+	}
+	if err := styleSheet(f, sheet, headers, rows); err != nil {
+		return err
+	}
+
+	fills := make(map[string]int)
+	for kind, color := range map[string]string{diffAdded: "C6EFCE", diffRemoved: "FFC7CE", diffChanged: "FFEB9C"} {
+		style, err := f.NewStyle(&excelize.Style{Fill: excelize.Fill{Type: "pattern", Pattern: 1, Color: []string{color}}})
+		if err != nil {
+			return err
+		}
+		fills[kind] = style
+	}
+	last := columnIndexToLetter(len(headers) - 1)
+	comments := 0
+	for r, row := range d.rows {
+		line := r + 2
+		switch row.Kind {
+		case diffAdded, diffRemoved:
+			if err := f.SetCellStyle(sheet, fmt.Sprintf("A%d", line), fmt.Sprintf("%s%d", last, line), fills[row.Kind]); err != nil {
+				return err
+			}
+		case diffChanged:
+			for _, change := range row.Cells {
+				ref := fmt.Sprintf("%s%d", columnIndexToLetter(indexOf(headers, change.Column)), line)
+				if err := f.SetCellStyle(sheet, ref, ref, fills[diffChanged]); err != nil {
+					return err
+				}
+				if comments < diffMaxComments {
+					comments++
+					if err := f.AddComment(sheet, excelize.Comment{Cell: ref, Author: "diff", Text: "Was: " + common.TruncateString(change.Old, 500)}); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+
+	if err := writeSheet(f, "Changes", []string{"Key", "Change", "Column", "Old value", "New value"}, d.changeRows()); err != nil {
+		return err
+	}
+	return f.SaveAs(filename)
+}
@@ -0,0 +1,147 @@
+package tools
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"ai-general-tool/common"
+)
+
+// Markdown and HTML tables, for previews and small enriched tables pasted
+// into wikis, pull requests and reports
+var tableExtensions = map[string]string{".md": "md", ".markdown": "md", ".html": "html", ".htm": "html"}
+
+// previewFormats lists the -format values of the read and analysis commands
+var previewFormats = map[string]bool{"text": true, "md": true, "html": true, "json": true}
+
+// jsonFlag adds -json, the same as -format json, to a command with -format.
+// Call the returned function after parsing: it applies -json and, for JSON
+// output, sends warnings and notes to stderr so that stdout holds the JSON
+// alone.
+func jsonFlag(fs *flag.FlagSet, format *string) func() {
+	jsonOutput := fs.Bool("json", false, "Same as -format json")
+	return func() {
+		if *jsonOutput {
+			*format = "json"
+		}
+		if *format == "json" {
+			messageOutput = os.Stderr
+		}
+	}
+}
+
+// printJSON prints v as indented JSON, for scripts
+func printJSON(v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(data))
+	return nil
+}
+
+// tableFormat returns "md" or "html" when an output is written as a table
+// document, from -format or the file extension, and "" otherwise
+func tableFormat(filename string, format string) string {
+	if format == "md" || format == "html" {
+		return format
+	}
+	return tableExtensions[strings.ToLower(filepath.Ext(filename))]
+}
+
+// writeTableDocument writes rows as a Markdown table, or as an HTML page
+// holding the table
+func writeTableDocument(w io.Writer, format string, title string, headers []string, rows [][]string) error {
+	var err error
+	if format == "md" {
+		_, err = io.WriteString(w, common.FormatMarkdownTable(headers, rows))
+	} else {
+		_, err = io.WriteString(w, htmlDocument(title, common.FormatHTMLTable(headers, rows)))
+	}
+	return err
+}
+
+// saveTableDocument saves rows as a Markdown or HTML file
+func saveTableDocument(filename string, format string, headers []string, rows [][]string) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := writeTableDocument(file, format, filepath.Base(filename), headers, rows); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// htmlDocument wraps body in a standalone page with light table styling
+func htmlDocument(title string, body string) string {
+	return fmt.Sprintf(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>%s</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; vertical-align: top; }
+th { background: #f2f2f2; }
+</style>
+</head>
+<body>
+%s</body>
+</html>
+`, html.EscapeString(title), body)
+}
+
+// printPreviewDocument prints a read command's preview as Markdown or HTML:
+// the file summary, the column analysis and the sampled rows
+func printPreviewDocument(preview *common.DataPreview, format string) {
+	fileType := preview.FileType
+	if preview.SheetInfo != "" {
+		fileType += " (" + preview.SheetInfo + ")"
+	}
+	summary := fmt.Sprintf("%s, %d rows, %d columns", fileType, preview.TotalRows, preview.TotalColumns)
+	if note := analysisNote(preview); note != "" {
+		summary += ". " + note
+	}
+
+	columnHeaders := []string{"Column", "Type", "Unique", "Nulls", "Sample Values"}
+	var columnRows [][]string
+	for _, col := range preview.Columns {
+		unique, nulls := analysisCounts(preview, col)
+		columnRows = append(columnRows, []string{
+			col.Name,
+			string(col.DataType),
+			unique,
+			nulls,
+			strings.Join(col.SampleValues, ", "),
+		})
+	}
+
+	rowsTitle := fmt.Sprintf("First %d of %d rows", preview.RowsDisplayed, preview.TotalRows)
+	if preview.SampleType == "random" {
+		rowsTitle = fmt.Sprintf("Random sample of %d of %d rows", preview.RowsDisplayed, preview.TotalRows)
+	}
+	rowHeaders := append([]string{"Row"}, preview.Headers...)
+	var dataRows [][]string
+	for i, row := range preview.Rows {
+		dataRows = append(dataRows, append([]string{fmt.Sprintf("%d", i+1)}, row...))
+	}
+
+	if format == "md" {
+		fmt.Printf("# %s\n\n%s\n\n## Columns\n\n%s\n## %s\n\n%s", preview.FileName, summary,
+			common.FormatMarkdownTable(columnHeaders, columnRows), rowsTitle, common.FormatMarkdownTable(rowHeaders, dataRows))
+		return
+	}
+	body := fmt.Sprintf("<h1>%s</h1>\n<p>%s</p>\n<h2>Columns</h2>\n%s<h2>%s</h2>\n%s",
+		html.EscapeString(preview.FileName), html.EscapeString(summary),
+		common.FormatHTMLTable(columnHeaders, columnRows), rowsTitle, common.FormatHTMLTable(rowHeaders, dataRows))
+	fmt.Print(htmlDocument(preview.FileName, body))
+}
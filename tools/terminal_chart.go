@@ -0,0 +1,138 @@
+package tools
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"ai-general-tool/common"
+)
+
+// Terminal charts of the read commands: the widest bar in characters, the
+// bars of a histogram and the values of a bar chart
+const (
+	chartBarWidth = 40
+	chartBins     = 10
+	chartTopCount = 10
+)
+
+// chartOptions are the -chart flags of the read commands
+type chartOptions struct {
+	Enabled bool
+	Columns string
+}
+
+// chartFlags registers the flags that add terminal charts to a preview
+func chartFlags(fs *flag.FlagSet) *chartOptions {
+	opts := &chartOptions{}
+	fs.BoolVar(&opts.Enabled, "chart", false, "Draw a chart per column below the preview: a histogram of numbers and dates, a bar chart of the most frequent values, or of text lengths for free text")
+	fs.StringVar(&opts.Columns, "chart-columns", "", "Comma-separated columns to chart (default: all)")
+	return opts
+}
+
+// check validates the chart flags against the preview format
+func (o *chartOptions) check(format string) error {
+	if o.Enabled && format != "text" {
+		return fmt.Errorf("-chart draws on the terminal; use it with -format text")
+	}
+	return nil
+}
+
+// sampler returns the sampler collecting the rows charts are drawn from:
+// every row up to analysisSampleRows, then a uniform random sample
+func (o *chartOptions) sampler() rowSampler {
+	if !o.Enabled {
+		return rowSampler{}
+	}
+	return rowSampler{count: analysisSampleRows, random: true}
+}
+
+// print draws the charts of the selected columns from the sampled rows; seen
+// is the number of rows the sample was drawn from
+func (o *chartOptions) print(headers []string, rows [][]string, seen int, locale common.Locale) error {
+	if !o.Enabled {
+		return nil
+	}
+	indexes, err := columnIndexes(headers, o.Columns)
+	if err != nil {
+		return err
+	}
+	fmt.Println("CHARTS:")
+	if seen > len(rows) {
+		fmt.Printf("Drawn from a random sample of %d of %d rows\n", len(rows), seen)
+	}
+	for _, index := range indexes {
+		values := make([]string, len(rows))
+		for r, row := range rows {
+			values[r] = cell(row, index)
+		}
+		s := describeColumn(headers[index], values, locale)
+		fmt.Printf("\n%s [%s]\n", headers[index], s.Type)
+		if s.Count == 0 {
+			fmt.Println("  (no values)")
+			continue
+		}
+		fmt.Print(columnChart(s, values))
+	}
+	fmt.Println()
+	return nil
+}
+
+// columnChart draws a column: numbers and dates as a histogram, repeated
+// values as a bar chart of the most frequent ones, and free text, where most
+// values are distinct, as a histogram of its lengths
+func columnChart(s columnStats, values []string) string {
+	if isNumericType(s.Type) || s.Type == common.TypeDate || s.Unique > s.Count/2 && s.Unique > chartTopCount {
+		title, labels, counts := columnHistogram(s, chartBins)
+		if title != "Distribution" {
+			return "  " + title + "\n" + terminalBars(labels, counts, s.Count)
+		}
+		return terminalBars(labels, counts, s.Count)
+	}
+
+	var present []string
+	for _, value := range values {
+		if !common.IsNull(value) {
+			present = append(present, value)
+		}
+	}
+	counts := valueCounts(present)
+	var labels []string
+	var bars []int
+	other := 0
+	for i, c := range counts {
+		if i < chartTopCount {
+			labels = append(labels, common.TruncateString(c.Value, 30))
+			bars = append(bars, c.Count)
+		} else {
+			other += c.Count
+		}
+	}
+	if other > 0 {
+		labels = append(labels, fmt.Sprintf("(%d others)", len(counts)-chartTopCount))
+		bars = append(bars, other)
+	}
+	return terminalBars(labels, bars, s.Count)
+}
+
+// terminalBars draws one labelled bar per count, scaled to the largest, with
+// the count and its share of total
+func terminalBars(labels []string, counts []int, total int) string {
+	labelWidth, highest := 0, 0
+	for i, label := range labels {
+		labelWidth = common.Max(labelWidth, utf8.RuneCountInString(label))
+		highest = common.Max(highest, counts[i])
+	}
+	var b strings.Builder
+	for i, label := range labels {
+		width := 0
+		if highest > 0 {
+			width = (counts[i]*chartBarWidth + highest - 1) / highest
+		}
+		padding := strings.Repeat(" ", labelWidth-utf8.RuneCountInString(label))
+		fmt.Fprintf(&b, "  %s%s │%s %s (%s)\n", label, padding, strings.Repeat("█", width), strconv.Itoa(counts[i]), common.FormatPercentage(counts[i], total))
+	}
+	return b.String()
+}
@@ -0,0 +1,368 @@
+package tools
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"ai-general-tool/common"
+
+	"gopkg.in/yaml.v3"
+)
+
+// validateSchema is a schema file of the validate command
+type validateSchema struct {
+	Columns []*columnRule `yaml:"columns"`
+	Strict  bool          `yaml:"strict"` // no columns beyond those listed
+	Unique  [][]string    `yaml:"unique"` // column combinations unique together
+}
+
+// columnRule holds the constraints of a column
+type columnRule struct {
+	Name       string   `yaml:"name"`
+	Required   bool     `yaml:"required"`  // the column must exist
+	NotEmpty   bool     `yaml:"not_empty"` // every row needs a value
+	Type       string   `yaml:"type"`
+	Pattern    string   `yaml:"pattern"`
+	Allowed    []string `yaml:"allowed"`
+	IgnoreCase bool     `yaml:"ignore_case"` // for allowed values
+	Unique     bool     `yaml:"unique"`
+	Min        string   `yaml:"min"` // a number, or a date for date columns
+	Max        string   `yaml:"max"`
+	MinLength  int      `yaml:"min_length"`
+	MaxLength  int      `yaml:"max_length"`
+
+	pattern  *regexp.Regexp
+	min, max float64
+	hasMin   bool
+	hasMax   bool
+	allowed  map[string]bool
+}
+
+// validateTypes lists the types a column rule can require
+var validateTypes = map[string]bool{
+	"string": true, "number": true, "integer": true, "date": true,
+	"boolean": true, "email": true, "url": true,
+}
+
+// emailPattern is a loose check of an email address: something@domain.tld
+var emailPattern = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s]+$`)
+
+// violation is a value, or a missing column, breaking a schema rule
+type violation struct {
+	Row    int // 0 for the header
+	Column string
+	Rule   string
+	Value  string
+}
+
+// RunValidate handles the validate command: it checks a file against a
+// schema of required columns, types, patterns, allowed values and uniqueness,
+// and fails when any rule is broken so pipelines can stop on bad data
+func RunValidate(args []string) error {
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+
+	// Define flags
+	inputFile := fs.String("input", "", "Input file (CSV, Excel or JSON)")
+	schemaFile := fs.String("schema", "", "Schema file (YAML or JSON) with the column rules (required)")
+	examples := fs.Int("examples", 20, "Violations listed in the report")
+	outputFile := fs.String("output", "", "Save every violation as a table (CSV, Excel, Markdown or HTML) with row, column, rule and value")
+	input := inputFlags(fs)
+	var locale common.Locale
+	localeFlag(fs, &locale)
+
+	// Parse flags
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	// Handle positional argument for filename
+	if *inputFile == "" && fs.NArg() > 0 {
+		*inputFile = fs.Arg(0)
+	}
+
+	// Validation
+	if *inputFile == "" {
+		return fmt.Errorf("input file is required")
+	}
+	if *schemaFile == "" {
+		return fmt.Errorf("-schema is required")
+	}
+	schema, err := loadValidateSchema(*schemaFile, locale)
+	if err != nil {
+		return fmt.Errorf("error loading schema: %v", err)
+	}
+	return validateFile(*inputFile, *input, schema, *schemaFile, *examples, *outputFile, locale)
+}
+
+// validateFile checks a file against a schema and reports the violations,
+// saving them to outputFile when set. It fails when any rule is broken.
+func validateFile(inputFile string, input InputOptions, schema *validateSchema, schemaName string, examples int, outputFile string, locale common.Locale) error {
+	fmt.Printf("Loading %s...\n", inputFile)
+	headers, rows, err := loadInputFile(inputFile, input)
+	if err != nil {
+		return fmt.Errorf("error loading input: %v", err)
+	}
+
+	violations := schema.validate(headers, rows, locale)
+	fmt.Printf("\n=== VALIDATE: %s against %s ===\n", inputFile, schemaName)
+	fmt.Printf("Rows: %d | Columns: %d | Rules: %d columns\n", len(rows), len(headers), len(schema.Columns))
+
+	table := make([][]string, len(violations))
+	for i, v := range violations {
+		row := "header"
+		if v.Row > 0 {
+			row = strconv.Itoa(v.Row)
+		}
+		table[i] = []string{row, v.Column, v.Rule, v.Value}
+	}
+	if outputFile != "" {
+		if err := saveOutputTable(outputFile, []string{"Row", "Column", "Rule", "Value"}, table, nil, OutputOptions{Format: "same"}); err != nil {
+			return fmt.Errorf("error saving violations: %v", err)
+		}
+		fmt.Printf("Violations saved to: %s\n", outputFile)
+	}
+	if len(violations) == 0 {
+		fmt.Println("Valid: no violations")
+		return nil
+	}
+
+	counts := make(map[[2]string]int)
+	var order [][2]string
+	for _, v := range violations {
+		key := [2]string{v.Column, v.Rule}
+		if counts[key] == 0 {
+			order = append(order, key)
+		}
+		counts[key]++
+	}
+	var summary [][]string
+	for _, key := range order {
+		summary = append(summary, []string{key[0], key[1], strconv.Itoa(counts[key])})
+	}
+	fmt.Println("\nVIOLATIONS BY RULE:")
+	fmt.Println(common.FormatTable([]string{"Column", "Rule", "Violations"}, summary, 140))
+	if examples > 0 {
+		shown := table[:common.Min(examples, len(table))]
+		fmt.Printf("FIRST %d VIOLATIONS (row numbers exclude the header):\n", len(shown))
+		fmt.Println(common.FormatTable([]string{"Row", "Column", "Rule", "Value"}, shown, 140))
+	}
+	return fmt.Errorf("%d violations found", len(violations))
+}
+
+// loadValidateSchema reads and checks a schema file. JSON works as well,
+// being valid YAML.
+func loadValidateSchema(filename string, locale common.Locale) (*validateSchema, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return parseValidateSchema(data, locale)
+}
+
+// parseValidateSchema decodes and checks the YAML of a schema
+func parseValidateSchema(data []byte, locale common.Locale) (*validateSchema, error) {
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	var schema validateSchema
+	err := decoder.Decode(&schema)
+	if err != nil {
+		return nil, err
+	}
+	if len(schema.Columns) == 0 && len(schema.Unique) == 0 {
+		return nil, fmt.Errorf("no column rules")
+	}
+
+	for _, rule := range schema.Columns {
+		if rule.Name == "" {
+			return nil, fmt.Errorf("a column rule has no name")
+		}
+		rule.Type = strings.ToLower(rule.Type)
+		if rule.Type != "" && !validateTypes[rule.Type] {
+			return nil, fmt.Errorf("column %s: unknown type '%s' (use string, number, integer, date, boolean, email or url)", rule.Name, rule.Type)
+		}
+		if rule.Pattern != "" {
+			if rule.pattern, err = regexp.Compile(rule.Pattern); err != nil {
+				return nil, fmt.Errorf("column %s: invalid pattern: %v", rule.Name, err)
+			}
+		}
+		if len(rule.Allowed) > 0 {
+			rule.allowed = make(map[string]bool)
+			for _, value := range rule.Allowed {
+				rule.allowed[rule.fold(value)] = true
+			}
+		}
+		if rule.Min != "" {
+			if rule.min, rule.hasMin = rule.bound(rule.Min, locale); !rule.hasMin {
+				return nil, fmt.Errorf("column %s: invalid min '%s'", rule.Name, rule.Min)
+			}
+		}
+		if rule.Max != "" {
+			if rule.max, rule.hasMax = rule.bound(rule.Max, locale); !rule.hasMax {
+				return nil, fmt.Errorf("column %s: invalid max '%s'", rule.Name, rule.Max)
+			}
+		}
+	}
+	return &schema, nil
+}
+
+// fold returns a value as compared against the allowed values
+func (rule *columnRule) fold(value string) string {
+	value = strings.TrimSpace(value)
+	if rule.IgnoreCase {
+		return strings.ToLower(value)
+	}
+	return value
+}
+
+// bound reads a value as a number, or as a date for date columns, for the
+// min and max checks
+func (rule *columnRule) bound(value string, locale common.Locale) (float64, bool) {
+	if rule.Type == "date" {
+		date, ok := common.ParseDate(strings.TrimSpace(value), locale)
+		return float64(date.UnixNano()), ok
+	}
+	return numericValue(strings.TrimSpace(value), locale)
+}
+
+// check returns the rules a non-empty value breaks
+func (rule *columnRule) check(value string, locale common.Locale) []string {
+	var broken []string
+	trimmed := strings.TrimSpace(value)
+	typed := true
+	switch rule.Type {
+	case "number":
+		_, typed = numericValue(trimmed, locale)
+	case "integer":
+		number, ok := common.ParseNumber(trimmed, locale)
+		typed = ok && number == float64(int64(number))
+	case "date":
+		_, typed = common.ParseDate(trimmed, locale)
+	case "boolean":
+		switch strings.ToLower(trimmed) {
+		case "true", "false", "yes", "no", "1", "0":
+		default:
+			typed = false
+		}
+	case "email":
+		typed = emailPattern.MatchString(trimmed)
+	case "url":
+		u, err := url.Parse(trimmed)
+		typed = err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+	}
+	if !typed {
+		broken = append(broken, "type "+rule.Type)
+	}
+	if rule.pattern != nil && !rule.pattern.MatchString(value) {
+		broken = append(broken, "pattern "+rule.Pattern)
+	}
+	if rule.allowed != nil && !rule.allowed[rule.fold(value)] {
+		broken = append(broken, "allowed values")
+	}
+	if length := len([]rune(value)); rule.MinLength > 0 && length < rule.MinLength {
+		broken = append(broken, fmt.Sprintf("min_length %d", rule.MinLength))
+	} else if rule.MaxLength > 0 && length > rule.MaxLength {
+		broken = append(broken, fmt.Sprintf("max_length %d", rule.MaxLength))
+	}
+	if (rule.hasMin || rule.hasMax) && typed {
+		if n, ok := rule.bound(trimmed, locale); ok {
+			if rule.hasMin && n < rule.min {
+				broken = append(broken, "min "+rule.Min)
+			}
+			if rule.hasMax && n > rule.max {
+				broken = append(broken, "max "+rule.Max)
+			}
+		}
+	}
+	return broken
+}
+
+// validate checks the header and every row against the schema, returning
+// the violations in row order
+func (s *validateSchema) validate(headers []string, rows [][]string, locale common.Locale) []violation {
+	var violations []violation
+	indexes := make([]int, len(s.Columns))
+	for i, rule := range s.Columns {
+		indexes[i] = indexOf(headers, rule.Name)
+		if indexes[i] == -1 && rule.Required {
+			violations = append(violations, violation{Column: rule.Name, Rule: "required column missing"})
+		}
+	}
+	if s.Strict {
+		for _, header := range headers {
+			known := false
+			for _, rule := range s.Columns {
+				known = known || rule.Name == header
+			}
+			if !known {
+				violations = append(violations, violation{Column: header, Rule: "unexpected column"})
+			}
+		}
+	}
+	var uniqueSets [][]int
+	for _, set := range s.Unique {
+		columns, err := columnIndexes(headers, strings.Join(set, ","))
+		if err != nil {
+			violations = append(violations, violation{Column: strings.Join(set, ", "), Rule: "unique columns missing"})
+			continue
+		}
+		uniqueSets = append(uniqueSets, columns)
+	}
+
+	seen := make([]map[string]int, len(s.Columns))
+	seenSets := make([]map[string]int, len(uniqueSets))
+	for r, row := range rows {
+		line := r + 1
+		for i, rule := range s.Columns {
+			if indexes[i] == -1 {
+				continue
+			}
+			value := cell(row, indexes[i])
+			if common.IsNull(value) {
+				if rule.NotEmpty {
+					violations = append(violations, violation{line, rule.Name, "not_empty", ""})
+				}
+				continue
+			}
+			for _, broken := range rule.check(value, locale) {
+				violations = append(violations, violation{line, rule.Name, broken, value})
+			}
+			if rule.Unique {
+				if seen[i] == nil {
+					seen[i] = make(map[string]int)
+				}
+				if first, ok := seen[i][value]; ok {
+					violations = append(violations, violation{line, rule.Name, fmt.Sprintf("unique (same as row %d)", first), value})
+				} else {
+					seen[i][value] = line
+				}
+			}
+		}
+		for i, set := range uniqueSets {
+			parts := make([]string, len(set))
+			blank := true
+			for j, index := range set {
+				parts[j] = cell(row, index)
+				blank = blank && common.IsNull(parts[j])
+			}
+			if blank {
+				continue
+			}
+			if seenSets[i] == nil {
+				seenSets[i] = make(map[string]int)
+			}
+			key := strings.Join(parts, " | ")
+			if first, ok := seenSets[i][key]; ok {
+				violations = append(violations, violation{line, strings.Join(s.Unique[i], ", "), fmt.Sprintf("unique together (same as row %d)", first), key})
+			} else {
+				seenSets[i][key] = line
+			}
+		}
+	}
+	return violations
+}
@@ -0,0 +1,174 @@
+package tools
+
+import (
+	"flag"
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+
+	"ai-general-tool/common"
+)
+
+// emptyValueLabel stands for empty and null cells in frequency tables
+const emptyValueLabel = "(empty)"
+
+// valueCountsBarWidth is the width in characters of the longest bar of
+// value-counts -bar
+const valueCountsBarWidth = 30
+
+// RunValueCounts handles the value-counts command: a frequency table of a
+// column's values over every row
+func RunValueCounts(args []string) error {
+	fs := flag.NewFlagSet("value-counts", flag.ExitOnError)
+
+	// Define flags
+	inputFile := fs.String("input", "", "Input file (CSV, Excel or JSON)")
+	column := fs.String("column", "", "Column to count the values of (required)")
+	top := fs.Int("top", 50, "Most frequent values listed; the rest are summed up as other (0 = all)")
+	bar := fs.Bool("bar", false, "Show a bar chart next to the counts")
+	fold := fs.Bool("fold", false, "Count values differing only in case or surrounding whitespace as one")
+	dropEmpty := fs.Bool("drop-empty", false, "Leave empty and null cells out of the counts and percentages")
+	format := fs.String("format", "text", "Output format: text, md (Markdown), html, json")
+	applyJSON := jsonFlag(fs, format)
+	input := inputFlags(fs)
+
+	// Parse flags
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	applyJSON()
+	if !previewFormats[*format] {
+		return fmt.Errorf("invalid format '%s' (use text, md, html or json)", *format)
+	}
+
+	// Handle positional argument for filename
+	if *inputFile == "" && fs.NArg() > 0 {
+		*inputFile = fs.Arg(0)
+	}
+
+	if *inputFile == "" {
+		return fmt.Errorf("input file is required")
+	}
+	if *column == "" {
+		return fmt.Errorf("column is required")
+	}
+	if *top < 0 {
+		return fmt.Errorf("-top cannot be negative")
+	}
+
+	headers, rows, err := loadInputFile(*inputFile, *input)
+	if err != nil {
+		return fmt.Errorf("error loading file: %v", err)
+	}
+	index := indexOf(headers, *column)
+	if index == -1 {
+		return fmt.Errorf("column '%s' not found in %s", *column, *inputFile)
+	}
+
+	// Folded values are shown in the spelling met first
+	values := make([]string, 0, len(rows))
+	spelling := make(map[string]string)
+	for _, row := range rows {
+		value := cell(row, index)
+		switch {
+		case common.IsNull(value) && *dropEmpty:
+			continue
+		case common.IsNull(value):
+			value = emptyValueLabel
+		case *fold:
+			key := strings.ToLower(strings.TrimSpace(value))
+			if _, ok := spelling[key]; !ok {
+				spelling[key] = strings.TrimSpace(value)
+			}
+			value = spelling[key]
+		}
+		values = append(values, value)
+	}
+	counts := valueCounts(values)
+
+	shown := counts
+	other := 0
+	if *top > 0 && len(counts) > *top {
+		shown = counts[:*top]
+		for _, vc := range counts[*top:] {
+			other += vc.Count
+		}
+	}
+	highest := 0
+	if len(counts) > 0 {
+		highest = counts[0].Count
+	}
+
+	tableHeaders := []string{"Value", "Count", "Percent", "Cumulative"}
+	if *bar {
+		tableHeaders = append(tableHeaders, "")
+	}
+	var tableRows [][]string
+	cumulative := 0
+	addRow := func(label string, count int) {
+		cumulative += count
+		row := []string{label, strconv.Itoa(count), common.FormatPercentage(count, len(values)), common.FormatPercentage(cumulative, len(values))}
+		if *bar {
+			row = append(row, strings.Repeat("#", count*valueCountsBarWidth/max(highest, 1)))
+		}
+		tableRows = append(tableRows, row)
+	}
+	for _, vc := range shown {
+		addRow(vc.Value, vc.Count)
+	}
+	if other > 0 {
+		addRow(fmt.Sprintf("(%d other values)", len(counts)-len(shown)), other)
+	}
+
+	summary := fmt.Sprintf("%d rows, %d distinct values", len(values), len(counts))
+	switch *format {
+	case "json":
+		output := valueCountsOutput{File: *inputFile, Column: *column, Rows: len(values), Distinct: len(counts), Values: []valueShare{}}
+		for _, vc := range shown {
+			output.Values = append(output.Values, valueShare{vc.Value, vc.Count, percentOf(vc.Count, len(values))})
+		}
+		if other > 0 {
+			output.Other = &valueShare{fmt.Sprintf("(%d other values)", len(counts)-len(shown)), other, percentOf(other, len(values))}
+		}
+		return printJSON(output)
+	case "md":
+		fmt.Printf("# %s: %s\n\n%s\n\n%s", *inputFile, *column, summary, common.FormatMarkdownTable(tableHeaders, tableRows))
+	case "html":
+		title := *inputFile + ": " + *column
+		body := fmt.Sprintf("<h1>%s</h1>\n<p>%s</p>\n%s", html.EscapeString(title), summary, common.FormatHTMLTable(tableHeaders, tableRows))
+		fmt.Print(htmlDocument(title, body))
+	default:
+		fmt.Printf("\n=== VALUE COUNTS: %s (%s) ===\n", *column, *inputFile)
+		fmt.Println(summary)
+		fmt.Println()
+		fmt.Println(common.FormatTable(tableHeaders, tableRows, 160))
+	}
+	return nil
+}
+
+// valueCountsOutput is the JSON output of value-counts. Other sums up the
+// values beyond -top.
+type valueCountsOutput struct {
+	File     string       `json:"file"`
+	Column   string       `json:"column"`
+	Rows     int          `json:"rows"`
+	Distinct int          `json:"distinct"`
+	Values   []valueShare `json:"values"`
+	Other    *valueShare  `json:"other,omitempty"`
+}
+
+// valueShare is a value with its count and percentage of the rows
+type valueShare struct {
+	Value   string  `json:"value"`
+	Count   int     `json:"count"`
+	Percent float64 `json:"percent"`
+}
+
+// percentOf returns count as a percentage of total, with two decimals
+func percentOf(count, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return common.Round(float64(count)*100/float64(total), 2)
+}
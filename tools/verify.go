@@ -0,0 +1,278 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"ai-general-tool/common"
+
+	"github.com/openai/openai-go"
+)
+
+// defaultVerifyModel reviews the sampled outputs of the cheaper run model
+const defaultVerifyModel = openai.ChatModelGPT4o
+
+// verdict is the reviewer's judgment of one generated value
+type verdict struct {
+	Row       int // index into the rows
+	Column    string
+	Value     string
+	Correct   bool
+	Suggested string
+	Reason    string
+}
+
+// parseSampleCount resolves a row count written as "5%" or "50"
+func parseSampleCount(spec string, totalRows int) (int, error) {
+	spec = strings.TrimSpace(spec)
+	if strings.HasSuffix(spec, "%") {
+		pct, err := strconv.ParseFloat(strings.TrimSuffix(spec, "%"), 64)
+		if err != nil || pct <= 0 || pct > 100 {
+			return 0, fmt.Errorf("invalid sample '%s'", spec)
+		}
+		return common.Max(int(math.Ceil(pct*float64(totalRows)/100)), 1), nil
+	}
+	n, err := strconv.Atoi(spec)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid sample '%s'", spec)
+	}
+	return n, nil
+}
+
+// verifySample has a second model review the generated values of a random
+// sample of successful rows. It prints the disagreement rate per column and
+// writes the disagreements to qaFile.
+func verifySample(ctx context.Context, config *ProcessingConfig, headers []string, enrichedRows [][]string, sampleSpec string, model string, workers int, qaFile string, stats *ProcessingStats) error {
+	fmt.Println("\n=== QA VERIFICATION ===")
+
+	// Only rows where every generated column succeeded can be reviewed
+	var candidates []int
+	status := statusSpecIndex(config.ColumnSpecs)
+	for r, row := range enrichedRows {
+		ok := rowStatus(row, headers, status) != journalError
+		for i, spec := range config.ColumnSpecs {
+			if !spec.Local && row[len(headers)+i] == "" {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			candidates = append(candidates, r)
+		}
+	}
+	if len(candidates) == 0 {
+		fmt.Println("No successful rows to verify.")
+		return nil
+	}
+
+	count, err := parseSampleCount(sampleSpec, len(candidates))
+	if err != nil {
+		return err
+	}
+	rand.Shuffle(len(candidates), func(i, j int) { candidates[i], candidates[j] = candidates[j], candidates[i] })
+	sample := candidates[:common.Min(count, len(candidates))]
+	sort.Ints(sample)
+	fmt.Printf("Reviewing %d of %d rows with %s...\n", len(sample), len(candidates), model)
+
+	var mu sync.Mutex
+	var verdicts []verdict
+	failed := 0
+	var firstErr error
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, common.Max(workers, 1))
+	for _, r := range sample {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(r int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			rowVerdicts, usage, err := verifyRow(ctx, config, model, headers, enrichedRows[r])
+			mu.Lock()
+			defer mu.Unlock()
+			stats.addUsage(usage)
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				failed++
+				return
+			}
+			for _, v := range rowVerdicts {
+				v.Row = r
+				verdicts = append(verdicts, v)
+			}
+		}(r)
+	}
+	wg.Wait()
+	if failed > 0 {
+		fmt.Printf("Review failed for %d rows: %v\n", failed, firstErr)
+	}
+
+	// Disagreement rate per column with a 95% confidence interval
+	var reportRows [][]string
+	for _, spec := range config.ColumnSpecs {
+		if spec.Local {
+			continue
+		}
+		checked, wrong := 0, 0
+		for _, v := range verdicts {
+			if v.Column == spec.Name {
+				checked++
+				if !v.Correct {
+					wrong++
+				}
+			}
+		}
+		rate := "-"
+		if checked > 0 {
+			low, high := wilsonInterval(wrong, checked)
+			rate = fmt.Sprintf("%s (%.1f%%-%.1f%%)", common.FormatPercentage(wrong, checked), low*100, high*100)
+		}
+		reportRows = append(reportRows, []string{spec.Name, fmt.Sprintf("%d", checked), fmt.Sprintf("%d", wrong), rate})
+	}
+	fmt.Println(common.FormatTable([]string{"Column", "Checked", "Disagreements", "Error rate (95% CI)"}, reportRows, 120))
+
+	sort.SliceStable(verdicts, func(a, b int) bool { return verdicts[a].Row < verdicts[b].Row })
+	var qaRows [][]string
+	for _, v := range verdicts {
+		if !v.Correct {
+			qaRows = append(qaRows, []string{fmt.Sprintf("%d", v.Row+2), v.Column, escapeFormula(v.Value), escapeFormula(v.Suggested), escapeFormula(v.Reason)})
+		}
+	}
+	if len(qaRows) == 0 {
+		fmt.Println("No disagreements found.")
+		return nil
+	}
+	if err := saveCSV(qaFile, []string{"row", "column", "value", "suggested", "reason"}, qaRows, false); err != nil {
+		return fmt.Errorf("error saving QA report: %v", err)
+	}
+	fmt.Printf("%d disagreements written to %s\n", len(qaRows), qaFile)
+	return nil
+}
+
+// verifyRow asks the reviewer model whether the generated values of a row
+// are correct for the task, given the same row data the run model saw
+func verifyRow(ctx context.Context, config *ProcessingConfig, model string, headers []string, row []string) ([]verdict, TokenUsage, error) {
+	var data strings.Builder
+	for i, header := range headers {
+		if config.Hidden[header] {
+			continue
+		}
+		value := row[i]
+		if value == "" {
+			value = "[empty]"
+		}
+		data.WriteString(fmt.Sprintf("%s: %s\n", header, value))
+	}
+
+	var generated strings.Builder
+	values := make(map[string]string)
+	for i, spec := range config.ColumnSpecs {
+		if spec.Local {
+			continue
+		}
+		values[spec.Name] = row[len(headers)+i]
+		generated.WriteString(fmt.Sprintf("%s: %s\n", spec.Name, row[len(headers)+i]))
+	}
+
+	schema := map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"reviews": map[string]interface{}{
+				"type": "array",
+				"items": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"column":    map[string]interface{}{"type": "string", "description": "The generated column"},
+						"correct":   map[string]interface{}{"type": "boolean", "description": "Whether the value is correct for the task"},
+						"suggested": map[string]interface{}{"type": "string", "description": "The correct value, when the generated one is wrong"},
+						"reason":    map[string]interface{}{"type": "string", "description": "Short explanation, when the generated one is wrong"},
+					},
+					"required":             []string{"column", "correct", "suggested", "reason"},
+					"additionalProperties": false,
+				},
+			},
+		},
+		"required":             []string{"reviews"},
+		"additionalProperties": false,
+	}
+
+	userMessage := fmt.Sprintf("Data:\n%s\nTask: %s\n\nGenerated values:\n%s\n"+
+		"Check each generated value against the data and the task. Mark a value correct when it is an acceptable answer, "+
+		"even if worded differently from what you would write.",
+		data.String(), config.Prompt, generated.String())
+
+	completion, err := config.Client.Chat.Completions.New(ctx, openai.ChatCompletionNewParams{
+		Model: model,
+		Messages: []openai.ChatCompletionMessageParamUnion{
+			openai.SystemMessage("You are a careful reviewer checking the output of a data extraction model."),
+			openai.UserMessage(userMessage),
+		},
+		Functions: []openai.ChatCompletionNewParamsFunction{
+			{
+				Name:        "review_values",
+				Description: openai.String("Report whether each generated value is correct"),
+				Parameters:  openai.FunctionParameters(schema),
+			},
+		},
+		FunctionCall: openai.ChatCompletionNewParamsFunctionCallUnion{
+			OfFunctionCallOption: &openai.ChatCompletionFunctionCallOptionParam{Name: "review_values"},
+		},
+		Temperature: openai.Float(0),
+	})
+	if err != nil {
+		return nil, TokenUsage{}, err
+	}
+	usage := chatUsage(model, completion.Usage)
+	if len(completion.Choices) == 0 || completion.Choices[0].Message.FunctionCall.Name == "" {
+		return nil, usage, fmt.Errorf("no function call in response")
+	}
+
+	var result struct {
+		Reviews []struct {
+			Column    string `json:"column"`
+			Correct   bool   `json:"correct"`
+			Suggested string `json:"suggested"`
+			Reason    string `json:"reason"`
+		} `json:"reviews"`
+	}
+	if err := json.Unmarshal([]byte(completion.Choices[0].Message.FunctionCall.Arguments), &result); err != nil {
+		return nil, usage, fmt.Errorf("failed to parse AI response: %v", err)
+	}
+
+	// Keep one review per generated column, ignoring columns the model invented
+	var verdicts []verdict
+	for _, review := range result.Reviews {
+		value, ok := values[review.Column]
+		if !ok {
+			continue
+		}
+		delete(values, review.Column)
+		verdicts = append(verdicts, verdict{
+			Column:    review.Column,
+			Value:     value,
+			Correct:   review.Correct,
+			Suggested: review.Suggested,
+			Reason:    review.Reason,
+		})
+	}
+	return verdicts, usage, nil
+}
+
+// wilsonInterval returns the 95% Wilson score interval of a proportion
+func wilsonInterval(successes, total int) (float64, float64) {
+	const z = 1.96
+	n := float64(total)
+	p := float64(successes) / n
+	center := (p + z*z/(2*n)) / (1 + z*z/n)
+	margin := z * math.Sqrt(p*(1-p)/n+z*z/(4*n*n)) / (1 + z*z/n)
+	return math.Max(0, center-margin), math.Min(1, center+margin)
+}
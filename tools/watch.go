@@ -0,0 +1,266 @@
+package tools
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// watchedFile is what watch last saw of a file: it is processed once its size
+// and modification time stop changing
+type watchedFile struct {
+	size    int64
+	modTime time.Time
+}
+
+// RunWatch handles the watch command: it runs a job file on every data file
+// dropped into a directory, moving each file to the output directory when its
+// run succeeds or to the failed directory when it does not, with a run log
+// next to it
+func RunWatch(args []string) error {
+	fs := flag.NewFlagSet("watch", flag.ExitOnError)
+
+	// Define flags
+	jobFile := fs.String("job", "", "Job file run on each new file (required)")
+	outDir := fs.String("out", "", "Directory for results, run logs and processed files (default <dir>/done)")
+	failedDir := fs.String("failed", "", "Directory for files whose run failed, with their run logs (default <dir>/failed)")
+	poll := fs.Duration("poll", 5*time.Second, "How often the directory is checked for new files")
+	settle := fs.Duration("settle", 5*time.Second, "How long a file must stay unchanged before it is processed, so that files still being copied are left alone")
+	once := fs.Bool("once", false, "Process the files in the directory, then exit instead of waiting for more")
+
+	// The directory may come first, as in watch ./incoming -job job.yaml
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		args = append(args[1:], args[0])
+	}
+
+	// Parse flags
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("a directory to watch is required: watch <dir> -job <job.yaml> [flags]")
+	}
+	if *jobFile == "" {
+		return fmt.Errorf("-job is required")
+	}
+	if *poll <= 0 || *settle < 0 {
+		return fmt.Errorf("-poll must be positive and -settle cannot be negative")
+	}
+	dir := fs.Arg(0)
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+	if *outDir == "" {
+		*outDir = filepath.Join(dir, "done")
+	}
+	if *failedDir == "" {
+		*failedDir = filepath.Join(dir, "failed")
+	}
+	for _, d := range []string{*outDir, *failedDir} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			return fmt.Errorf("error creating %s: %v", d, err)
+		}
+	}
+
+	job, err := loadJob(*jobFile)
+	if err != nil {
+		return fmt.Errorf("error loading job %s: %v", *jobFile, err)
+	}
+	if job.Options["output-template"] != "" {
+		return fmt.Errorf("job %s: watch names each result after its file; remove the output-template option", *jobFile)
+	}
+	format := job.Options["format"]
+	if format == "" {
+		format = "same"
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("cannot find the aitool executable to run the job with: %v", err)
+	}
+
+	ctx, stop := stopContext()
+	defer stop()
+
+	fmt.Printf("Watching %s: each new file runs %s, then moves to %s (or %s if its run fails)\n", dir, *jobFile, *outDir, *failedDir)
+	seen := make(map[string]watchedFile)
+	processed, failed := 0, 0
+	for {
+		ready, waiting, err := settledFiles(dir, seen, *settle)
+		if err != nil {
+			return err
+		}
+		for _, name := range ready {
+			if ctx.Err() != nil {
+				break
+			}
+			ok, err := watchFile(ctx, exe, *jobFile, format, filepath.Join(dir, name), *outDir, *failedDir)
+			if err != nil {
+				return err
+			}
+			if ok {
+				processed++
+			} else if ctx.Err() == nil {
+				failed++
+			}
+			delete(seen, name)
+		}
+		if ctx.Err() != nil || *once && len(ready) == 0 && waiting == 0 {
+			break
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(*poll):
+		}
+	}
+	fmt.Printf("\nStopped watching %s: %d files processed, %d failed\n", dir, processed, failed)
+	return nil
+}
+
+// settledFiles returns the data files of dir that have not changed since the
+// previous check and are older than settle, and how many others are still
+// changing
+func settledFiles(dir string, seen map[string]watchedFile, settle time.Duration) ([]string, int, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error reading %s: %v", dir, err)
+	}
+	var ready []string
+	waiting := 0
+	present := make(map[string]bool)
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || strings.HasPrefix(name, ".") || !serveExtensions[dataExt(name)] {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		present[name] = true
+		current := watchedFile{size: info.Size(), modTime: info.ModTime()}
+		if previous, ok := seen[name]; ok && previous == current && time.Since(current.modTime) >= settle {
+			ready = append(ready, name)
+			continue
+		}
+		seen[name] = current
+		waiting++
+	}
+	for name := range seen {
+		if !present[name] {
+			delete(seen, name)
+		}
+	}
+	sort.Strings(ready)
+	return ready, waiting, nil
+}
+
+// watchFile runs the job on one file, logging to <result>.log, and moves the
+// file away. An interrupted run leaves the file in place: the
+// next watch resumes it. Only errors moving files are returned.
+func watchFile(ctx context.Context, exe, jobFile, format, file, outDir, failedDir string) (bool, error) {
+	name := filepath.Base(file)
+	outputName := filepath.Base(defaultOutputFile(name, format))
+	output := filepath.Join(outDir, outputName)
+	resume := false
+	if _, err := os.Stat(output + journalSuffix); err == nil {
+		resume = true // an earlier run of the file was interrupted
+	} else {
+		output = filepath.Join(outDir, uniqueName(outDir, outputName, nil))
+	}
+
+	logFile := output + ".log"
+	log, err := os.OpenFile(logFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return false, fmt.Errorf("error opening %s: %v", logFile, err)
+	}
+	args := []string{"run-job", "-yes", "-input", file, "-output", output}
+	if resume {
+		args = append(args, "-resume")
+	}
+	args = append(args, jobFile)
+	fmt.Fprintf(log, "=== %s: aitool %s ===\n", time.Now().Format(time.DateTime), strings.Join(args, " "))
+
+	fmt.Printf("%s: processing...\n", name)
+	start := time.Now()
+	cmd := exec.Command(exe, args...)
+	cmd.Stdout = log
+	cmd.Stderr = log
+	if err := cmd.Start(); err != nil {
+		log.Close()
+		return false, fmt.Errorf("error running the job on %s: %v", name, err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		stopProcess(ctx, cmd)
+		err = <-done
+	}
+	elapsed := time.Since(start).Round(time.Second)
+	reason := strings.TrimPrefix(lastLogLine(logFile), "Error: ")
+	fmt.Fprintf(log, "=== %s: finished in %s ===\n", time.Now().Format(time.DateTime), elapsed)
+	log.Close()
+
+	if ctx.Err() != nil && err != nil {
+		fmt.Printf("%s: interrupted; it stays in place and resumes on the next watch\n", name)
+		return false, nil
+	}
+	// Only an interrupted run is resumed
+	os.Remove(output + journalSuffix)
+	if err != nil {
+		moved := filepath.Join(failedDir, uniqueName(failedDir, name, nil))
+		if err := moveFile(file, moved); err != nil {
+			return false, err
+		}
+		if err := moveFile(logFile, moved+".log"); err != nil {
+			return false, err
+		}
+		if _, err := os.Stat(output); err == nil {
+			if err := moveFile(output, filepath.Join(failedDir, uniqueName(failedDir, filepath.Base(output), nil))); err != nil {
+				return false, err
+			}
+		}
+		fmt.Printf("%s: failed after %s (%s); moved to %s, log in %s.log\n", name, elapsed, reason, moved, moved)
+		return false, nil
+	}
+	moved := filepath.Join(outDir, uniqueName(outDir, name, nil))
+	if err := moveFile(file, moved); err != nil {
+		return false, err
+	}
+	fmt.Printf("%s: done in %s; result in %s (log in %s), file moved to %s\n", name, elapsed, output, logFile, moved)
+	return true, nil
+}
+
+// moveFile moves a file, copying it when it goes to another file system
+func moveFile(from, to string) error {
+	if err := os.Rename(from, to); err == nil {
+		return nil
+	}
+	src, err := os.Open(from)
+	if err != nil {
+		return fmt.Errorf("error moving %s: %v", from, err)
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(to, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("error moving %s: %v", from, err)
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		os.Remove(to)
+		return fmt.Errorf("error moving %s: %v", from, err)
+	}
+	if err := dst.Close(); err != nil {
+		return fmt.Errorf("error moving %s: %v", from, err)
+	}
+	src.Close()
+	return os.Remove(from)
+}
@@ -0,0 +1,240 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/openai/openai-go"
+)
+
+const (
+	webSearchFunctionName = "web_search"
+	webSearchResultCount  = 5
+)
+
+// SearchResult is a single web search hit
+type SearchResult struct {
+	Title   string
+	URL     string
+	Snippet string
+}
+
+// WebSearcher runs web searches for the model
+type WebSearcher interface {
+	Search(ctx context.Context, query string) ([]SearchResult, error)
+}
+
+// webSearchers maps provider names to their constructors
+var webSearchers = map[string]func() (WebSearcher, error){
+	"brave":   newBraveSearcher,
+	"bing":    newBingSearcher,
+	"serpapi": newSerpAPISearcher,
+}
+
+// WebSearchOptions configures the web search tool offered to the model
+type WebSearchOptions struct {
+	Searcher      WebSearcher
+	Budget        int    // maximum searches per row
+	SourcesColumn string // column receiving the URLs of the results seen
+}
+
+// rowSearch tracks the searches made while processing one row. The budget
+// is shared by the calls for each model group of the row.
+type rowSearch struct {
+	options   *WebSearchOptions
+	remaining int
+	sources   []string
+	seen      map[string]bool
+}
+
+func newRowSearch(options *WebSearchOptions) *rowSearch {
+	return &rowSearch{options: options, remaining: options.Budget, seen: make(map[string]bool)}
+}
+
+// available reports whether the row still has searches left
+func (s *rowSearch) available() bool {
+	return s.remaining > 0
+}
+
+// run performs a search, records the result URLs as sources and returns the
+// results formatted for the model
+func (s *rowSearch) run(ctx context.Context, query string) (string, error) {
+	s.remaining--
+
+	results, err := s.options.Searcher.Search(ctx, query)
+	if err != nil {
+		return "", fmt.Errorf("web search failed: %v", err)
+	}
+	if len(results) == 0 {
+		return "No results found.", nil
+	}
+
+	var text strings.Builder
+	for i, result := range results {
+		text.WriteString(fmt.Sprintf("%d. %s\n%s\n%s\n\n", i+1, result.Title, result.URL, result.Snippet))
+		if !s.seen[result.URL] {
+			s.seen[result.URL] = true
+			s.sources = append(s.sources, result.URL)
+		}
+	}
+	return text.String(), nil
+}
+
+// provenance returns the URLs of all results seen for the row
+func (s *rowSearch) provenance() string {
+	return strings.Join(s.sources, "\n")
+}
+
+// webSearchFunction describes the search tool to the model
+func webSearchFunction() openai.ChatCompletionNewParamsFunction {
+	return openai.ChatCompletionNewParamsFunction{
+		Name:        webSearchFunctionName,
+		Description: openai.String("Search the web for current information that is not contained in the data"),
+		Parameters: openai.FunctionParameters{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"query": map[string]interface{}{
+					"type":        "string",
+					"description": "The search query",
+				},
+			},
+			"required":             []string{"query"},
+			"additionalProperties": false,
+		},
+	}
+}
+
+// braveSearcher uses the Brave Search API (BRAVE_SEARCH_API_KEY)
+type braveSearcher struct {
+	apiKey string
+}
+
+func newBraveSearcher() (WebSearcher, error) {
+	apiKey := os.Getenv("BRAVE_SEARCH_API_KEY")
+	if apiKey == "" {
+		return nil, fmt.Errorf("BRAVE_SEARCH_API_KEY not found in environment")
+	}
+	return &braveSearcher{apiKey: apiKey}, nil
+}
+
+func (b *braveSearcher) Search(ctx context.Context, query string) ([]SearchResult, error) {
+	params := url.Values{}
+	params.Set("q", query)
+	params.Set("count", fmt.Sprintf("%d", webSearchResultCount))
+
+	var resp struct {
+		Web struct {
+			Results []struct {
+				Title       string `json:"title"`
+				URL         string `json:"url"`
+				Description string `json:"description"`
+			} `json:"results"`
+		} `json:"web"`
+	}
+	headers := map[string]string{"X-Subscription-Token": b.apiKey}
+	if err := connectorRequest(http.MethodGet, "https://api.search.brave.com/res/v1/web/search?"+params.Encode(), headers, nil, &resp); err != nil {
+		return nil, err
+	}
+
+	var results []SearchResult
+	for _, r := range resp.Web.Results {
+		results = append(results, SearchResult{Title: r.Title, URL: r.URL, Snippet: htmlTagPattern.ReplaceAllString(r.Description, "")})
+	}
+	return results, nil
+}
+
+// bingSearcher uses the Bing Web Search API (BING_SEARCH_API_KEY)
+type bingSearcher struct {
+	apiKey string
+}
+
+func newBingSearcher() (WebSearcher, error) {
+	apiKey := os.Getenv("BING_SEARCH_API_KEY")
+	if apiKey == "" {
+		return nil, fmt.Errorf("BING_SEARCH_API_KEY not found in environment")
+	}
+	return &bingSearcher{apiKey: apiKey}, nil
+}
+
+func (b *bingSearcher) Search(ctx context.Context, query string) ([]SearchResult, error) {
+	params := url.Values{}
+	params.Set("q", query)
+	params.Set("count", fmt.Sprintf("%d", webSearchResultCount))
+
+	var resp struct {
+		WebPages struct {
+			Value []struct {
+				Name    string `json:"name"`
+				URL     string `json:"url"`
+				Snippet string `json:"snippet"`
+			} `json:"value"`
+		} `json:"webPages"`
+	}
+	headers := map[string]string{"Ocp-Apim-Subscription-Key": b.apiKey}
+	if err := connectorRequest(http.MethodGet, "https://api.bing.microsoft.com/v7.0/search?"+params.Encode(), headers, nil, &resp); err != nil {
+		return nil, err
+	}
+
+	var results []SearchResult
+	for _, r := range resp.WebPages.Value {
+		results = append(results, SearchResult{Title: r.Name, URL: r.URL, Snippet: r.Snippet})
+	}
+	return results, nil
+}
+
+// serpAPISearcher uses SerpAPI's Google search (SERPAPI_API_KEY)
+type serpAPISearcher struct {
+	apiKey string
+}
+
+func newSerpAPISearcher() (WebSearcher, error) {
+	apiKey := os.Getenv("SERPAPI_API_KEY")
+	if apiKey == "" {
+		return nil, fmt.Errorf("SERPAPI_API_KEY not found in environment")
+	}
+	return &serpAPISearcher{apiKey: apiKey}, nil
+}
+
+func (s *serpAPISearcher) Search(ctx context.Context, query string) ([]SearchResult, error) {
+	params := url.Values{}
+	params.Set("engine", "google")
+	params.Set("q", query)
+	params.Set("num", fmt.Sprintf("%d", webSearchResultCount))
+	params.Set("api_key", s.apiKey)
+
+	var resp struct {
+		OrganicResults []struct {
+			Title   string `json:"title"`
+			Link    string `json:"link"`
+			Snippet string `json:"snippet"`
+		} `json:"organic_results"`
+	}
+	if err := connectorRequest(http.MethodGet, "https://serpapi.com/search.json?"+params.Encode(), nil, nil, &resp); err != nil {
+		return nil, err
+	}
+
+	var results []SearchResult
+	for i, r := range resp.OrganicResults {
+		if i == webSearchResultCount {
+			break
+		}
+		results = append(results, SearchResult{Title: r.Title, URL: r.Link, Snippet: r.Snippet})
+	}
+	return results, nil
+}
+
+// parseSearchQuery extracts the query argument of a web_search call
+func parseSearchQuery(arguments string) (string, error) {
+	var args struct {
+		Query string `json:"query"`
+	}
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil || strings.TrimSpace(args.Query) == "" {
+		return "", withClass(errorParse, fmt.Errorf("invalid web_search arguments: %s", arguments))
+	}
+	return args.Query, nil
+}
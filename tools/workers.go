@@ -0,0 +1,203 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// workersAuto is the -workers value that tunes the number of workers while
+// processing
+const workersAuto = "auto"
+
+// Limits of -workers auto: the concurrency it starts with and the most it
+// tries
+const (
+	autoStartWorkers = 4
+	autoMaxWorkers   = 64
+)
+
+// A tuning step measures at least autoTuneMinWindow and two rows per worker
+// (and no fewer than autoTuneMinRows). A step that raises throughput by less
+// than autoTuneMinGain is not worth its extra workers; one where more than
+// autoTuneMaxErrors of the rows were retried or failed means the account or
+// model is at its rate limit.
+const (
+	autoTuneMinWindow = 3 * time.Second
+	autoTuneMinRows   = 10
+	autoTuneMinGain   = 0.10
+	autoTuneMaxErrors = 0.05
+)
+
+// parseWorkers reads the -workers flag: a number of workers, or auto. With
+// auto, the returned count is the most workers the tuner may use.
+func parseWorkers(value string) (int, *workerTuner, error) {
+	value = strings.TrimSpace(value)
+	if strings.EqualFold(value, workersAuto) {
+		return autoMaxWorkers, newWorkerTuner(), nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		return 0, nil, fmt.Errorf("invalid -workers value %q: use a positive number or %s", value, workersAuto)
+	}
+	return n, nil, nil
+}
+
+// workerTuner finds the concurrency giving the best throughput for -workers
+// auto. Workers only process a row while fewer than limit rows are in
+// progress. Starting at autoStartWorkers, the limit is doubled as long as
+// throughput keeps improving and requests are not being retried or failing;
+// it then settles on the best limit seen. Once settled, retries or failures
+// lower it and quiet periods bring it back up to the best.
+type workerTuner struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	limit  int
+	active int
+
+	best     int     // limit with the best throughput so far
+	bestRate float64 // rows per minute at best
+	settled  bool
+}
+
+func newWorkerTuner() *workerTuner {
+	t := &workerTuner{limit: autoStartWorkers}
+	t.cond = sync.NewCond(&t.mu)
+	return t
+}
+
+// acquire waits until a worker may start a row
+func (t *workerTuner) acquire() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	for t.active >= t.limit {
+		t.cond.Wait()
+	}
+	t.active++
+	t.mu.Unlock()
+}
+
+// release ends a row started with acquire
+func (t *workerTuner) release() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	t.active--
+	t.mu.Unlock()
+	t.cond.Signal()
+}
+
+// workers returns the current concurrency limit
+func (t *workerTuner) workers() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.limit
+}
+
+// setLimit changes the concurrency limit, waking workers when it grows
+func (t *workerTuner) setLimit(limit int) {
+	t.mu.Lock()
+	t.limit = min(max(limit, 1), autoMaxWorkers)
+	t.mu.Unlock()
+	t.cond.Broadcast()
+}
+
+// tune measures the throughput of a run in steps and adjusts the limit until
+// the returned function is called
+func (t *workerTuner) tune(ctx context.Context, stats *ProcessingStats) (stop func()) {
+	if t == nil {
+		return func() {}
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	atomic.StoreInt32(&stats.Workers, int32(t.workers()))
+
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+
+		rows := func() int32 {
+			return atomic.LoadInt32(&stats.CompletedRows) + atomic.LoadInt32(&stats.FailedRows) - atomic.LoadInt32(&stats.ResumedRows)
+		}
+		errors := func() int64 {
+			return atomic.LoadInt64(&stats.Retries) + int64(atomic.LoadInt32(&stats.FailedRows))
+		}
+		start, startRows, startErrors := time.Now(), rows(), errors()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			limit := t.workers()
+			elapsed := time.Since(start)
+			done := int(rows() - startRows)
+			if elapsed < autoTuneMinWindow || done < max(2*limit, autoTuneMinRows) {
+				continue
+			}
+			errorRate := float64(errors()-startErrors) / float64(done)
+			t.setLimit(t.next(limit, float64(done)/elapsed.Minutes(), errorRate))
+			atomic.StoreInt32(&stats.Workers, int32(t.workers()))
+			start, startRows, startErrors = time.Now(), rows(), errors()
+		}
+	}()
+
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// next returns the limit to try after a step run at limit with the given
+// throughput and share of retried or failed rows
+func (t *workerTuner) next(limit int, rate, errorRate float64) int {
+	if errorRate > autoTuneMaxErrors {
+		// Back off: to the best limit below this one while searching, by a
+		// quarter once settled
+		if !t.settled && t.best > 0 && t.best < limit {
+			t.settled = true
+			return t.best
+		}
+		t.settled = true
+		return max(limit*3/4, 1)
+	}
+	if t.settled {
+		if limit < t.best {
+			return limit + 1
+		}
+		return limit
+	}
+	if t.best == 0 || rate > t.bestRate*(1+autoTuneMinGain) {
+		t.best, t.bestRate = limit, rate
+		if limit >= autoMaxWorkers {
+			t.settled = true
+			return limit
+		}
+		return limit * 2
+	}
+	t.settled = true
+	return t.best
+}
+
+// printWorkerTuning reports the concurrency -workers auto settled on
+func printWorkerTuning(t *workerTuner) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.settled {
+		fmt.Printf("Auto workers: still tuning at %d workers when the run ended\n", t.limit)
+		return
+	}
+	fmt.Printf("Auto workers: settled on %d (best throughput %s rows/min at %d); pass -workers %d to start there next time\n",
+		t.limit, formatRate(t.bestRate), t.best, t.best)
+}
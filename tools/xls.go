@@ -0,0 +1,514 @@
+package tools
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/richardlehane/mscfb"
+	"github.com/xuri/excelize/v2"
+)
+
+// Legacy .xls workbooks (Excel 97-2003, BIFF8) are OLE compound files with a
+// "Workbook" stream of records. Only the cell values are read; outputs are
+// written as .xlsx.
+const (
+	xlsExtension = ".xls"
+	biff8Version = 0x0600
+)
+
+// BIFF record types
+const (
+	xlsFormula    = 0x0006
+	xlsEOF        = 0x000A
+	xlsDateMode   = 0x0022
+	xlsFilePass   = 0x002F
+	xlsContinue   = 0x003C
+	xlsBoundSheet = 0x0085
+	xlsMulRK      = 0x00BD
+	xlsXF         = 0x00E0
+	xlsSST        = 0x00FC
+	xlsLabelSST   = 0x00FD
+	xlsNumber     = 0x0203
+	xlsLabel      = 0x0204
+	xlsBoolErr    = 0x0205
+	xlsString     = 0x0207
+	xlsRK         = 0x027E
+	xlsFormat     = 0x041E
+	xlsBOF        = 0x0809
+)
+
+// xlsErrors maps BIFF error codes to their display text
+var xlsErrors = map[byte]string{
+	0x00: "#NULL!", 0x07: "#DIV/0!", 0x0F: "#VALUE!", 0x17: "#REF!",
+	0x1D: "#NAME?", 0x24: "#NUM!", 0x2A: "#N/A",
+}
+
+// isXLSFile reports whether a file name is a legacy Excel workbook
+func isXLSFile(filename string) bool {
+	return strings.HasSuffix(strings.ToLower(filename), xlsExtension)
+}
+
+// xlsRecord is one BIFF record with the CONTINUE records that follow it
+type xlsRecord struct {
+	Type     uint16
+	Segments [][]byte
+}
+
+// xlsWorkbook holds the globals needed to read cell values
+type xlsWorkbook struct {
+	stream   []byte
+	sst      []string
+	formats  map[uint16]string // custom number formats by id
+	xfFormat []uint16          // number format id of each cell format
+	date1904 bool
+}
+
+// readXLS reads every worksheet of a legacy workbook. Files that are really
+// .xlsx workbooks with an .xls name are read with excelize.
+func readXLS(filename string) ([]workbookSheet, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(file, magic); err != nil {
+		return nil, fmt.Errorf("not an Excel workbook: %v", err)
+	}
+	if bytes.Equal(magic, []byte("PK\x03\x04")) {
+		return readXLSX(filename)
+	}
+	if !bytes.Equal(magic, []byte{0xD0, 0xCF, 0x11, 0xE0}) {
+		return nil, fmt.Errorf("%s is not a binary Excel workbook (HTML and XML files saved as .xls must be re-saved as .xlsx or CSV)", filename)
+	}
+
+	reader, err := mscfb.New(file)
+	if err != nil {
+		return nil, fmt.Errorf("invalid .xls file: %v", err)
+	}
+	var stream []byte
+	for entry, err := reader.Next(); err == nil; entry, err = reader.Next() {
+		switch entry.Name {
+		case "Workbook":
+			if stream, err = io.ReadAll(entry); err != nil {
+				return nil, err
+			}
+		case "Book":
+			if stream == nil {
+				return nil, fmt.Errorf("Excel 5.0/95 workbooks are not supported; re-save %s as .xlsx", filename)
+			}
+		}
+	}
+	if stream == nil {
+		return nil, fmt.Errorf("no workbook stream in %s", filename)
+	}
+
+	wb := &xlsWorkbook{stream: stream, formats: make(map[uint16]string)}
+	return wb.read()
+}
+
+// readXLSX reads every sheet of an .xlsx workbook
+func readXLSX(filename string) ([]workbookSheet, error) {
+	f, err := excelize.OpenFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var sheets []workbookSheet
+	for i, name := range f.GetSheetList() {
+		_, source, err := openExcelRows(filename, strconv.Itoa(i+1), ExcelOptions{})
+		if err != nil {
+			return nil, err
+		}
+		rows, err := readRows(source)
+		source.Close()
+		if err != nil {
+			return nil, err
+		}
+		sheets = append(sheets, workbookSheet{Name: name, Rows: rows})
+	}
+	return sheets, nil
+}
+
+// loadXLS loads one sheet, by name or number (1-based), of a legacy workbook
+func loadXLS(filename string, sheet string, header HeaderOptions) ([]string, [][]string, error) {
+	sheets, err := readXLS(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	return sheetTable(sheets, sheet, header)
+}
+
+// record reads the record at offset and returns it with the offset of the
+// next record
+func (wb *xlsWorkbook) record(offset int) (xlsRecord, int, error) {
+	var rec xlsRecord
+	for first := true; offset+4 <= len(wb.stream); first = false {
+		typ := binary.LittleEndian.Uint16(wb.stream[offset:])
+		size := int(binary.LittleEndian.Uint16(wb.stream[offset+2:]))
+		if !first && typ != xlsContinue {
+			break
+		}
+		if offset+4+size > len(wb.stream) {
+			return rec, 0, fmt.Errorf("truncated record at offset %d", offset)
+		}
+		if first {
+			rec.Type = typ
+		}
+		rec.Segments = append(rec.Segments, wb.stream[offset+4:offset+4+size])
+		offset += 4 + size
+	}
+	if rec.Segments == nil {
+		return rec, 0, io.EOF
+	}
+	return rec, offset, nil
+}
+
+// read parses the workbook globals, then each worksheet
+func (wb *xlsWorkbook) read() ([]workbookSheet, error) {
+	type boundSheet struct {
+		name   string
+		offset int
+		hidden bool
+	}
+	var bound []boundSheet
+
+	for offset := 0; ; {
+		rec, next, err := wb.record(offset)
+		if err != nil {
+			return nil, fmt.Errorf("invalid .xls file: %v", err)
+		}
+		offset = next
+		data := rec.Segments[0]
+
+		switch rec.Type {
+		case xlsBOF:
+			if len(data) < 2 || binary.LittleEndian.Uint16(data) != biff8Version {
+				return nil, fmt.Errorf("only Excel 97-2003 (BIFF8) .xls files are supported; re-save the file as .xlsx")
+			}
+		case xlsFilePass:
+			return nil, fmt.Errorf("the workbook is password-protected")
+		case xlsDateMode:
+			wb.date1904 = len(data) >= 2 && data[0] == 1
+		case xlsFormat:
+			if len(data) >= 2 {
+				r := &xlsStringReader{segments: rec.Segments, pos: 2}
+				wb.formats[binary.LittleEndian.Uint16(data)] = r.unicodeString(false)
+			}
+		case xlsXF:
+			if len(data) >= 4 {
+				wb.xfFormat = append(wb.xfFormat, binary.LittleEndian.Uint16(data[2:]))
+			}
+		case xlsSST:
+			wb.sst = readSST(rec.Segments)
+		case xlsBoundSheet:
+			// Only worksheets; chart and macro sheets have no cells
+			if len(data) >= 6 && data[5] == 0 {
+				r := &xlsStringReader{segments: rec.Segments, pos: 6}
+				bound = append(bound, boundSheet{name: r.unicodeString(true), offset: int(binary.LittleEndian.Uint32(data)), hidden: data[4]&0x03 != 0})
+			}
+		case xlsEOF:
+			sheets := make([]workbookSheet, len(bound))
+			for i, b := range bound {
+				rows, err := wb.readSheet(b.offset)
+				if err != nil {
+					return nil, fmt.Errorf("sheet '%s': %v", b.name, err)
+				}
+				sheets[i] = workbookSheet{Name: b.name, Rows: rows, Hidden: b.hidden}
+			}
+			if len(sheets) == 0 {
+				return nil, fmt.Errorf("no worksheets found")
+			}
+			return sheets, nil
+		}
+	}
+}
+
+// readSheet reads the cells of the worksheet substream at offset
+func (wb *xlsWorkbook) readSheet(offset int) ([][]string, error) {
+	var rows [][]string
+	set := func(row, col uint16, value string) {
+		if value == "" {
+			return
+		}
+		for len(rows) <= int(row) {
+			rows = append(rows, nil)
+		}
+		for len(rows[row]) <= int(col) {
+			rows[row] = append(rows[row], "")
+		}
+		rows[row][col] = value
+	}
+	u16 := binary.LittleEndian.Uint16
+
+	// A formula with a string result is followed by a STRING record
+	var pendingRow, pendingCol uint16
+	pending := false
+
+	// Embedded charts are nested BOF/EOF substreams
+	depth := 0
+	for first := true; ; first = false {
+		rec, next, err := wb.record(offset)
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		offset = next
+		data := rec.Segments[0]
+		if first && rec.Type != xlsBOF {
+			return nil, fmt.Errorf("missing sheet header")
+		}
+		switch rec.Type {
+		case xlsBOF:
+			depth++
+			continue
+		case xlsEOF:
+			if depth--; depth == 0 {
+				return rows, nil
+			}
+			continue
+		}
+		if depth > 1 || (rec.Type != xlsString && len(data) < 6) {
+			continue
+		}
+
+		switch rec.Type {
+		case xlsLabelSST:
+			if len(data) >= 10 {
+				if i := int(binary.LittleEndian.Uint32(data[6:])); i < len(wb.sst) {
+					set(u16(data), u16(data[2:]), wb.sst[i])
+				}
+			}
+		case xlsLabel:
+			r := &xlsStringReader{segments: rec.Segments, pos: 6}
+			set(u16(data), u16(data[2:]), r.unicodeString(false))
+		case xlsNumber:
+			if len(data) >= 14 {
+				value := math.Float64frombits(binary.LittleEndian.Uint64(data[6:]))
+				set(u16(data), u16(data[2:]), wb.formatNumber(value, u16(data[4:])))
+			}
+		case xlsRK:
+			if len(data) >= 10 {
+				set(u16(data), u16(data[2:]), wb.formatNumber(decodeRK(binary.LittleEndian.Uint32(data[6:])), u16(data[4:])))
+			}
+		case xlsMulRK:
+			row, col := u16(data), u16(data[2:])
+			for i := 4; i+6 <= len(data)-2; i, col = i+6, col+1 {
+				set(row, col, wb.formatNumber(decodeRK(binary.LittleEndian.Uint32(data[i+2:])), u16(data[i:])))
+			}
+		case xlsBoolErr:
+			if len(data) >= 8 {
+				set(u16(data), u16(data[2:]), boolErrText(data[6], data[7] == 1))
+			}
+		case xlsFormula:
+			if len(data) < 14 {
+				continue
+			}
+			row, col, result := u16(data), u16(data[2:]), data[6:14]
+			if result[6] != 0xFF || result[7] != 0xFF {
+				set(row, col, wb.formatNumber(math.Float64frombits(binary.LittleEndian.Uint64(result)), u16(data[4:])))
+				continue
+			}
+			switch result[0] {
+			case 0:
+				pendingRow, pendingCol, pending = row, col, true
+			case 1:
+				set(row, col, boolErrText(result[2], false))
+			case 2:
+				set(row, col, boolErrText(result[2], true))
+			}
+		case xlsString:
+			if pending {
+				r := &xlsStringReader{segments: rec.Segments}
+				set(pendingRow, pendingCol, r.unicodeString(false))
+				pending = false
+			}
+		}
+	}
+}
+
+// formatNumber renders a number as Excel would show it in General format,
+// or as an ISO date/time when the cell has a date format
+func (wb *xlsWorkbook) formatNumber(value float64, xf uint16) string {
+	date := int(xf) < len(wb.xfFormat) && isDateFormat(wb.xfFormat[xf], wb.formats[wb.xfFormat[xf]])
+	return formatExcelNumber(value, date, wb.date1904)
+}
+
+// isDateFormat reports whether a number format shows dates or times: one of
+// the built-in date formats, or a custom format with date or time codes
+// outside quoted text, escapes and [color] sections
+func isDateFormat(id uint16, format string) bool {
+	switch {
+	case id >= 14 && id <= 22, id >= 27 && id <= 36, id >= 45 && id <= 47, id >= 50 && id <= 58:
+		return true
+	case format == "":
+		return false
+	}
+
+	inQuote, inBracket := false, false
+	for i := 0; i < len(format); i++ {
+		c := format[i]
+		switch {
+		case inQuote:
+			inQuote = c != '"'
+		case inBracket:
+			inBracket = c != ']'
+			if strings.ContainsRune("hms", rune(c|0x20)) {
+				return true // elapsed time, e.g. [h]:mm
+			}
+		case c == '"':
+			inQuote = true
+		case c == '[':
+			inBracket = true
+		case c == '\\' || c == '_' || c == '*':
+			i++
+		case strings.ContainsRune("dmyhs", rune(c|0x20)):
+			return true
+		}
+	}
+	return false
+}
+
+// decodeRK decodes a compressed RK number
+func decodeRK(rk uint32) float64 {
+	var value float64
+	if rk&0x02 != 0 {
+		value = float64(int32(rk) >> 2)
+	} else {
+		value = math.Float64frombits(uint64(rk&0xFFFFFFFC) << 32)
+	}
+	if rk&0x01 != 0 {
+		value /= 100
+	}
+	return value
+}
+
+// boolErrText renders a boolean or error cell value
+func boolErrText(value byte, isError bool) string {
+	if isError {
+		if text, ok := xlsErrors[value]; ok {
+			return text
+		}
+		return "#ERROR"
+	}
+	if value != 0 {
+		return "TRUE"
+	}
+	return "FALSE"
+}
+
+// readSST reads the shared string table, which may span CONTINUE records
+func readSST(segments [][]byte) []string {
+	if len(segments[0]) < 8 {
+		return nil
+	}
+	count := int(binary.LittleEndian.Uint32(segments[0][4:]))
+	r := &xlsStringReader{segments: segments, pos: 8}
+	strs := make([]string, 0, min(count, 1<<16))
+	for i := 0; i < count && !r.done(); i++ {
+		strs = append(strs, r.unicodeString(false))
+	}
+	return strs
+}
+
+// xlsStringReader reads BIFF8 strings from a record and its CONTINUE records.
+// Characters split across records restart with an option byte giving the
+// width of the rest of the string.
+type xlsStringReader struct {
+	segments [][]byte
+	seg, pos int
+}
+
+func (r *xlsStringReader) done() bool {
+	for r.seg < len(r.segments) && r.pos >= len(r.segments[r.seg]) {
+		r.seg, r.pos = r.seg+1, 0
+	}
+	return r.seg >= len(r.segments)
+}
+
+// bytes reads n bytes, crossing record boundaries
+func (r *xlsStringReader) bytes(n int) []byte {
+	var out []byte
+	for n > 0 && !r.done() {
+		take := min(n, len(r.segments[r.seg])-r.pos)
+		out = append(out, r.segments[r.seg][r.pos:r.pos+take]...)
+		r.pos += take
+		n -= take
+	}
+	return out
+}
+
+func (r *xlsStringReader) uint16() int {
+	b := r.bytes(2)
+	if len(b) < 2 {
+		return 0
+	}
+	return int(binary.LittleEndian.Uint16(b))
+}
+
+// unicodeString reads an XLUnicodeString, or a ShortXLUnicodeString with a
+// one-byte length, skipping any rich text runs and phonetic data
+func (r *xlsStringReader) unicodeString(short bool) string {
+	var length int
+	if short {
+		if b := r.bytes(1); len(b) == 1 {
+			length = int(b[0])
+		}
+	} else {
+		length = r.uint16()
+	}
+	flags := r.bytes(1)
+	if len(flags) == 0 {
+		return ""
+	}
+	wide := flags[0]&0x01 != 0
+	runs, ext := 0, 0
+	if flags[0]&0x08 != 0 {
+		runs = r.uint16()
+	}
+	if flags[0]&0x04 != 0 {
+		if b := r.bytes(4); len(b) == 4 {
+			ext = int(binary.LittleEndian.Uint32(b))
+		}
+	}
+
+	chars := make([]uint16, 0, length)
+	for len(chars) < length {
+		if r.seg < len(r.segments) && r.pos >= len(r.segments[r.seg]) {
+			if r.seg+1 >= len(r.segments) {
+				break
+			}
+			r.seg, r.pos = r.seg+1, 0
+			if b := r.bytes(1); len(b) == 1 {
+				wide = b[0]&0x01 != 0
+			}
+			continue
+		}
+		if r.seg >= len(r.segments) {
+			break
+		}
+		if wide {
+			b := r.bytes(2)
+			if len(b) < 2 {
+				break
+			}
+			chars = append(chars, binary.LittleEndian.Uint16(b))
+		} else {
+			chars = append(chars, uint16(r.bytes(1)[0]))
+		}
+	}
+
+	r.bytes(4*runs + ext)
+	return string(utf16.Decode(chars))
+}